@@ -2,13 +2,17 @@ package nzbrepair
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/javi11/nzb-repair/internal/app"
 	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
 	"github.com/spf13/cobra"
 )
 
@@ -16,9 +20,37 @@ var (
 	configFile      string
 	outputFileOrDir string
 	verbose         bool
+	inPlace         bool
+	extract         bool
+	referenceDir    string
+	postAddTo       string
+	progressOutput  string
+	bundleDir       string
+	checkOnly       bool
+	dryRun          bool
 	watchDir        string
+	scanInterval    time.Duration
+	apiPort         int
+	watchWorkers    int
 	dbPath          string
 	tmpDir          string
+	statsMonth      string
+	statsJSON       bool
+	queueAddOpts    app.QueueAddOptions
+	queueJSON       bool
+	queueListOpts   app.QueueListOptions
+	approveOpts     app.QueueApproveOptions
+	noteOpts        app.QueueNoteOptions
+	markOpts        app.QueueMarkOptions
+	statusOpts      app.StatusOptions
+	remoteAddr      string
+	benchOpts       app.BenchOptions
+	speedtestOpts   app.SpeedtestOptions
+	statOpts        app.StatOptions
+	reportOpts      app.ReportOptions
+	rescanOpts      app.RescanOptions
+	postBundleOpts  app.PostBundleOptions
+	postProcessOpts app.PostProcessOptions
 	rootCmd         = &cobra.Command{
 		Use:   "nzbrepair [nzb file]",
 		Short: "NZB Repair tool",
@@ -31,18 +63,50 @@ var (
 				return err
 			}
 
+			if checkOnly {
+				return app.RunStat(cmd.Context(), cfg, args[0], app.StatOptions{}, cmd.OutOrStdout())
+			}
+
 			effectiveTmpDir := tmpDir
 			if effectiveTmpDir == "" {
 				effectiveTmpDir = os.TempDir()
 			}
 
+			if inPlace {
+				cfg.InPlace.Enabled = true
+			}
+
+			if extract {
+				cfg.Extract.Enabled = true
+			}
+
+			if referenceDir != "" {
+				cfg.ReferenceDir = referenceDir
+			}
+
+			if postAddTo != "" {
+				cfg.PostAddTo = postAddTo
+			}
+
+			if progressOutput != "" {
+				cfg.Progress = progressOutput
+			}
+
+			if bundleDir != "" {
+				cfg.BundleDir = bundleDir
+			}
+
+			if dryRun {
+				cfg.DryRun = true
+			}
+
 			return app.RunSingleRepair(cmd.Context(), cfg, args[0], outputFileOrDir, effectiveTmpDir, verbose)
 		},
 	}
 	watchCmd = &cobra.Command{
 		Use:   "watch",
 		Short: "Scan a directory for NZB files and repair them",
-		Long:  `Periodically scans a specified directory for .nzb files and queues them for repair. The scan interval can be configured in the config file.`,
+		Long:  `Watches a specified directory for .nzb files and queues them for repair. Besides file system events, the directory is scanned every scan interval, set in the config file or with --scan-interval.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.NewFromFile(configFile)
 			if err != nil {
@@ -55,26 +119,483 @@ var (
 				effectiveTmpDir = os.TempDir()
 			}
 
+			if inPlace {
+				cfg.InPlace.Enabled = true
+			}
+
+			if extract {
+				cfg.Extract.Enabled = true
+			}
+
+			if referenceDir != "" {
+				cfg.ReferenceDir = referenceDir
+			}
+
+			if postAddTo != "" {
+				cfg.PostAddTo = postAddTo
+			}
+
+			if scanInterval > 0 {
+				cfg.ScanInterval = scanInterval
+			}
+
+			if apiPort > 0 {
+				cfg.API.Listen = fmt.Sprintf("127.0.0.1:%d", apiPort)
+			}
+
+			if watchWorkers > 0 {
+				cfg.WatchWorkers = watchWorkers
+			}
+
+			if dryRun {
+				cfg.DryRun = true
+			}
+
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 			defer stop()
 
 			return app.RunWatcher(ctx, cfg, watchDir, dbPath, outputFileOrDir, effectiveTmpDir, verbose)
 		},
 	}
+	batchCmd = &cobra.Command{
+		Use:   "batch [nzb file, directory or glob]...",
+		Short: "Repair many NZBs at once and print a summary",
+		Long:  `Repairs every NZB matched by the arguments, watch_workers at a time with shared provider pools, and exits once all are done, printing the status of each NZB. Globs are expanded by the command, so quote them; ** matches any number of directories, e.g. 'dir/**/*.nzb'. A directory stands for every NZB below it. The command fails when any NZB failed.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			effectiveTmpDir := tmpDir
+			if effectiveTmpDir == "" {
+				effectiveTmpDir = os.TempDir()
+			}
+
+			if inPlace {
+				cfg.InPlace.Enabled = true
+			}
+
+			if extract {
+				cfg.Extract.Enabled = true
+			}
+
+			if referenceDir != "" {
+				cfg.ReferenceDir = referenceDir
+			}
+
+			if postAddTo != "" {
+				cfg.PostAddTo = postAddTo
+			}
+
+			if watchWorkers > 0 {
+				cfg.WatchWorkers = watchWorkers
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return app.RunBatch(ctx, cfg, args, outputFileOrDir, effectiveTmpDir, verbose, cmd.OutOrStdout())
+		},
+	}
+	rescanCmd = &cobra.Command{
+		Use:   "rescan",
+		Short: "Make a running watcher scan its watch directories now",
+		Long:  `Asks a running watcher to scan all of its watch directories right away instead of at the next scan interval, e.g. after restoring a large batch of NZBs from a backup. Needs the API of the watcher.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			rescanOpts.Remote = remoteAddr
+			return app.RunRescan(cmd.Context(), cfg, rescanOpts, cmd.OutOrStdout())
+		},
+	}
+	statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show per-provider bandwidth usage",
+		Long:  `Prints the monthly downloaded and uploaded bytes recorded per provider by the watcher, along with the configured monthly caps.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			return app.RunStats(cmd.Context(), cfg, dbPath, statsMonth, statsJSON, cmd.OutOrStdout())
+		},
+	}
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show the job counts and the jobs being processed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			statusOpts.Remote = remoteAddr
+			return app.RunStatus(cmd.Context(), cfg, dbPath, statusOpts, cmd.OutOrStdout())
+		},
+	}
+	benchCmd = &cobra.Command{
+		Use:   "bench",
+		Short: "Measure download, yEnc, disk and par2 throughput",
+		Long:  `Measures the NNTP download throughput of every download provider (with --nzb), yEnc decode speed, disk write throughput to the tmp dir and par2 speed on a synthetic set, to help size worker and connection counts.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			effectiveTmpDir := tmpDir
+			if effectiveTmpDir == "" {
+				effectiveTmpDir = os.TempDir()
+			}
+
+			return app.RunBench(cmd.Context(), cfg, effectiveTmpDir, benchOpts, cmd.OutOrStdout())
+		},
+	}
+	queueCmd = &cobra.Command{
+		Use:   "queue",
+		Short: "Manage the watcher queue",
+	}
+	queueAddCmd = &cobra.Command{
+		Use:   "add [nzb file]...",
+		Short: "Add NZB files to the watcher queue",
+		Long:  `Inserts NZB files directly into the queue database used by a running watcher, without copying them into the watch directory. The files are repaired from where they are.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			queueAddOpts.JSON = queueJSON
+			queueAddOpts.Remote = remoteAddr
+			return app.RunQueueAdd(cmd.Context(), cfg, dbPath, args, queueAddOpts, cmd.OutOrStdout())
+		},
+	}
+	queueListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the jobs of the watcher queue",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			queueListOpts.JSON = queueJSON
+			queueListOpts.Remote = remoteAddr
+			return app.RunQueueList(cmd.Context(), cfg, dbPath, queueListOpts, cmd.OutOrStdout())
+		},
+	}
+	queueApproveCmd = &cobra.Command{
+		Use:   "approve [job id]...",
+		Short: "Approve the repair of triaged jobs",
+		Long:  `Approves jobs left awaiting approval by a watcher running with watch_mode: triage. Approved jobs are repaired the next time a worker picks them, without being triaged again.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids := make([]int64, 0, len(args))
+			for _, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid job id %q", arg)
+				}
+				ids = append(ids, id)
+			}
+
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			approveOpts.JSON = queueJSON
+			approveOpts.Remote = remoteAddr
+			return app.RunQueueApprove(cmd.Context(), cfg, dbPath, ids, approveOpts, cmd.OutOrStdout())
+		},
+	}
+	queueNoteCmd = &cobra.Command{
+		Use:   "note [job id] [note]",
+		Short: "Attach a note to a job",
+		Long:  `Attaches a free-text note to a job, replacing its previous note, e.g. to record how it was handled outside the tool. An empty note removes it.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid job id %q", args[0])
+			}
+
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			noteOpts.Remote = remoteAddr
+			return app.RunQueueNote(cmd.Context(), cfg, dbPath, id, args[1], noteOpts, cmd.OutOrStdout())
+		},
+	}
+	queueMarkCmd = &cobra.Command{
+		Use:   "mark [completed|failed] [job id]...",
+		Short: "Mark jobs handled outside the tool as completed or failed",
+		Long:  `Forces the status of jobs that were handled outside the tool. Jobs marked failed are not retried and are moved to the broken folder like jobs out of retries. Jobs being processed cannot be marked.`,
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids := make([]int64, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid job id %q", arg)
+				}
+				ids = append(ids, id)
+			}
+
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			markOpts.JSON = queueJSON
+			markOpts.Remote = remoteAddr
+			return app.RunQueueMark(cmd.Context(), cfg, dbPath, args[0], ids, markOpts, cmd.OutOrStdout())
+		},
+	}
+	queueBackupCmd = &cobra.Command{
+		Use:   "backup [dest]",
+		Short: "Back up the queue database",
+		Long:  `Writes a consistent copy of the queue database using the SQLite online backup API. It is safe to run while the watcher is running.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.RunQueueBackup(cmd.Context(), dbPath, args[0], cmd.OutOrStdout())
+		},
+	}
+	speedtestCmd = &cobra.Command{
+		Use:   "speedtest",
+		Short: "Measure the download speed of a provider",
+		Long:  `Downloads articles of an NZB from a single provider with each of the given connection counts and reports the aggregate and per-connection throughput, to help tune the connections setting.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			return app.RunSpeedtest(cmd.Context(), cfg, speedtestOpts, cmd.OutOrStdout())
+		},
+	}
+	postBundleCmd = &cobra.Command{
+		Use:   "post-bundle [bundle dir]",
+		Short: "Post the articles of an article bundle",
+		Long:  `Posts the articles of a bundle written by --bundle through the upload providers, checks on the download providers that each one arrived and patches the NZB of the bundle when an article had to be posted again under a new message id. Posted articles are recorded in the manifest, so an interrupted run can be repeated. With --output the NZB is also written there.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			if postAddTo != "" {
+				cfg.PostAddTo = postAddTo
+			}
+
+			return app.RunPostBundle(cmd.Context(), cfg, args[0], outputFileOrDir, postBundleOpts, cmd.OutOrStdout())
+		},
+	}
+	postProcessCmd = &cobra.Command{
+		Use:   "postprocess",
+		Short: "Repair a failed download as a SABnzbd or NZBGet post-processing script",
+		Long:  `Runs as a post-processing script of SABnzbd or an extension of NZBGet, reading the environment they set. When the download failed its NZB is repaired and the repaired NZB is handed back through post_add_to (defaulting to the NzbDir of NZBGet) or the output sink, so the downloader fetches it again. Exits with the codes the downloader expects: 93 (success), 94 (failure) or 95 (nothing to do) for NZBGet, 0 or 1 for SABnzbd.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			if referenceDir != "" {
+				cfg.ReferenceDir = referenceDir
+			}
+
+			if postAddTo != "" {
+				cfg.PostAddTo = postAddTo
+			}
+
+			postProcessOpts.Output = outputFileOrDir
+			postProcessOpts.Verbose = verbose
+
+			os.Exit(app.RunPostProcess(cmd.Context(), cfg, tmpDir, postProcessOpts, os.Getenv, cmd.OutOrStdout()))
+			return nil
+		},
+	}
+	statCmd = &cobra.Command{
+		Use:     "stat [nzb file]",
+		Aliases: []string{"check"},
+		Short:   "Check the availability of an NZB without downloading it",
+		Long:    `Checks every segment of the NZB with STAT (or HEAD) on the download providers and prints the available and missing segments of each file and of the whole NZB. It only takes seconds, even for large NZBs, as no article body is transferred.`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			return app.RunStat(cmd.Context(), cfg, args[0], statOpts, cmd.OutOrStdout())
+		},
+	}
+	reportCmd = &cobra.Command{
+		Use:   "report [dir]",
+		Short: "Write a health report of every NZB in a directory tree",
+		Long:  `Checks every NZB below the directory like stat --verdict and writes one row per NZB with its size, availability, repairability verdict and age, as CSV or JSON.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.NewFromFile(configFile)
+			if err != nil {
+				slog.Error("Failed to load config", "error", err)
+				return err
+			}
+
+			return app.RunReport(cmd.Context(), cfg, args[0], reportOpts, cmd.OutOrStdout())
+		},
+	}
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+	}
+	configEncryptSecretsCmd = &cobra.Command{
+		Use:   "encrypt-secrets",
+		Short: "Encrypt the provider passwords of the config file",
+		Long:  `Encrypts every plaintext provider password of the config file in place with the master key from ` + config.MasterKeyEnv + ` or the file named by ` + config.MasterKeyFileEnv + `. The same master key must be set whenever the config is loaded.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.RunConfigEncryptSecrets(configFile, cmd.OutOrStdout())
+		},
+	}
+	queueRestoreCmd = &cobra.Command{
+		Use:   "restore [backup]",
+		Short: "Restore the queue database from a backup",
+		Long:  `Replaces the content of the queue database with a backup made by queue backup, migrating it to the current schema. Stop the watcher before restoring.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.RunQueueRestore(cmd.Context(), dbPath, args[0], cmd.OutOrStdout())
+		},
+	}
 )
 
+const remoteUsage = "API address of a running watcher, e.g. http://host:8090 or unix:/run/nzb-repair.sock (default: api.listen from the config when it answers, else the database file)"
+
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file path")
 	rootCmd.PersistentFlags().StringVarP(&outputFileOrDir, "output", "o", "", "output file path or directory for repaired nzb files (default: next to input / repaired/ dir for watch)")
 	rootCmd.PersistentFlags().StringVar(&tmpDir, "tmp-dir", os.TempDir(), "temporary directory for processing files")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose logging")
+	rootCmd.PersistentFlags().BoolVar(&inPlace, "in-place", false, "overwrite the source nzb with the repaired one, keeping the original as <name>.nzb.<timestamp>.bak")
+	rootCmd.PersistentFlags().BoolVar(&extract, "extract", false, "unpack the rar, 7z and zip archives of complete releases into a folder named after the nzb, next to the output nzb")
+	rootCmd.PersistentFlags().StringVar(&referenceDir, "reference-dir", "", "directory of files par2 may reuse blocks from, e.g. a previous partial extraction")
+	rootCmd.PersistentFlags().StringVar(&postAddTo, "post-add-to", "", "directory that also receives every written nzb, e.g. the watched folder of a downloader, renamed into place once complete")
+	rootCmd.Flags().StringVar(&progressOutput, "progress", "", "progress output: bar, json (JSON lines on stderr) or none (default: progress from the config, else bar)")
+	rootCmd.Flags().BoolVar(&checkOnly, "check-only", false, "only check the availability of the segments with STAT, like the check command, without downloading or repairing anything")
+	rootCmd.Flags().StringVar(&bundleDir, "bundle", "", "write the repaired articles as yEnc article files with a manifest to this directory instead of posting them")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "download and verify the segments and run par2 verify only, reporting the broken segments and whether the nzb can be repaired, without posting articles or writing the nzb")
 	_ = rootCmd.MarkPersistentFlagRequired("config")
 
-	watchCmd.Flags().StringVarP(&watchDir, "dir", "d", "", "directory to watch for nzb files")
-	watchCmd.Flags().StringVarP(&dbPath, "db", "b", "queue.db", "path to the sqlite database file")
-	_ = watchCmd.MarkFlagRequired("dir")
+	watchCmd.Flags().StringVarP(&watchDir, "dir", "d", "", "directory to watch for nzb files (required unless watch_dirs is set in the config)")
+	watchCmd.Flags().StringVarP(&dbPath, "db", "b", queue.DefaultPath(), "path to the sqlite database file")
+	watchCmd.Flags().DurationVar(&scanInterval, "scan-interval", 0, "interval of the full scans of the watch directory, e.g. 40s or 1h (default: scan_interval from the config)")
+	watchCmd.Flags().IntVar(&apiPort, "api-port", 0, "serve the HTTP API on this port of localhost (default: api.listen from the config)")
+	watchCmd.Flags().IntVar(&watchWorkers, "workers", 0, "number of jobs repaired at the same time (default: watch_workers from the config)")
+	watchCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only verify the queued nzbs and record their broken segments and verdict, without posting articles or writing nzbs")
+
+	rescanCmd.Flags().StringVar(&remoteAddr, "remote", "", "API address of the running watcher, e.g. http://host:8090 or unix:/run/nzb-repair.sock (default: api.listen from the config)")
+
+	statsCmd.Flags().StringVarP(&dbPath, "db", "b", queue.DefaultPath(), "path to the sqlite database file")
+	statsCmd.Flags().StringVar(&statsMonth, "month", "", "month to report in YYYY-MM format (default: current month)")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "print machine-readable JSON")
+
+	benchCmd.Flags().StringVar(&benchOpts.NzbFile, "nzb", "", "nzb whose articles are used for the download benchmark (skipped when empty)")
+	benchCmd.Flags().IntVar(&benchOpts.Segments, "segments", 100, "number of articles downloaded per provider")
+	benchCmd.Flags().IntVar(&benchOpts.SizeMB, "size-mb", 256, "size of the synthetic data for the yEnc, disk and par2 benchmarks")
+	benchCmd.Flags().BoolVar(&benchOpts.JSON, "json", false, "print machine-readable JSON")
+
+	queueCmd.PersistentFlags().StringVarP(&dbPath, "db", "b", queue.DefaultPath(), "path to the sqlite database file")
+	queueCmd.PersistentFlags().BoolVar(&queueJSON, "json", false, "print machine-readable JSON")
+	queueAddCmd.Flags().StringVar(&queueAddOpts.Priority, "priority", "normal", "job priority: low, normal, high or a number")
+	queueAddCmd.Flags().StringVar(&queueAddOpts.Category, "category", "", "category of the job, used as output subdirectory")
+	queueAddCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	queueCmd.AddCommand(queueAddCmd)
+	queueListCmd.Flags().StringVar(&queueListOpts.Status, "status", "", "only list jobs in this status")
+	queueListCmd.Flags().IntVar(&queueListOpts.Limit, "limit", 50, "maximum number of jobs to list (0 = all)")
+	queueListCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	queueCmd.AddCommand(queueListCmd)
+	queueApproveCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	queueCmd.AddCommand(queueApproveCmd)
+	queueNoteCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	queueCmd.AddCommand(queueNoteCmd)
+	queueMarkCmd.Flags().StringVar(&markOpts.Reason, "reason", "", "message recorded as the error of the marked jobs")
+	queueMarkCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	queueCmd.AddCommand(queueMarkCmd)
+	queueCmd.AddCommand(queueBackupCmd)
+	queueCmd.AddCommand(queueRestoreCmd)
 
 	rootCmd.AddCommand(watchCmd)
+	batchCmd.Flags().IntVar(&watchWorkers, "workers", 0, "number of nzbs repaired at the same time (default: watch_workers from the config)")
+	rootCmd.AddCommand(batchCmd)
+	rootCmd.AddCommand(rescanCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(queueCmd)
+	configCmd.AddCommand(configEncryptSecretsCmd)
+	rootCmd.AddCommand(configCmd)
+
+	statusCmd.Flags().StringVarP(&dbPath, "db", "b", queue.DefaultPath(), "path to the sqlite database file")
+	statusCmd.Flags().BoolVar(&statusOpts.JSON, "json", false, "print machine-readable JSON")
+	statusCmd.Flags().StringVar(&remoteAddr, "remote", "", remoteUsage)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(benchCmd)
+
+	speedtestCmd.Flags().StringVar(&speedtestOpts.Provider, "provider", "", "name or host of the provider to test")
+	speedtestCmd.Flags().StringVar(&speedtestOpts.NzbFile, "nzb", "", "nzb whose articles are downloaded; they must be available on the provider")
+	speedtestCmd.Flags().IntVar(&speedtestOpts.SizeMB, "size-mb", 200, "data downloaded per connection count")
+	speedtestCmd.Flags().IntSliceVar(&speedtestOpts.Connections, "connections", nil, "connection counts to test, e.g. 5,10,20 (default: the configured connections)")
+	speedtestCmd.Flags().BoolVar(&speedtestOpts.JSON, "json", false, "print machine-readable JSON")
+	_ = speedtestCmd.MarkFlagRequired("provider")
+	_ = speedtestCmd.MarkFlagRequired("nzb")
+	rootCmd.AddCommand(speedtestCmd)
+
+	postBundleCmd.Flags().BoolVar(&postBundleOpts.NoVerify, "no-verify", false, "do not check that the posted articles arrived")
+	rootCmd.AddCommand(postBundleCmd)
+
+	postProcessCmd.Flags().StringVar(&postProcessOpts.Nzb, "nzb", "", "nzb of the download, instead of the one passed by the downloader (gzipped when ending in .gz)")
+	rootCmd.AddCommand(postProcessCmd)
+
+	statCmd.Flags().IntVar(&statOpts.Concurrency, "concurrency", 50, "number of articles checked at once")
+	statCmd.Flags().BoolVar(&statOpts.Head, "head", false, "check articles with HEAD instead of STAT")
+	statCmd.Flags().BoolVar(&statOpts.Verdict, "verdict", false, "read the par2 block size and tell whether the nzb is healthy, repairable or unrepairable")
+	statCmd.Flags().BoolVar(&statOpts.JSON, "json", false, "print machine-readable JSON")
+	rootCmd.AddCommand(statCmd)
+
+	reportCmd.Flags().StringVar(&reportOpts.Format, "format", "csv", "report format: csv or json")
+	reportCmd.Flags().IntVar(&reportOpts.Concurrency, "concurrency", 50, "number of articles checked at once")
+	reportCmd.Flags().BoolVar(&reportOpts.Head, "head", false, "check articles with HEAD instead of STAT")
+	rootCmd.AddCommand(reportCmd)
 }
 
 func Execute() {
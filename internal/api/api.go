@@ -0,0 +1,487 @@
+// Package api serves the HTTP API of the watcher: adding, listing, approving,
+// annotating, retrying and deleting jobs, bandwidth stats, a stream of job
+// events, pausing the workers, the log level and rescans of the watch
+// directories.
+// pkg/client is its Go client.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+const (
+	// eventBuffer is the number of events buffered per stream. Events for a
+	// stream that falls further behind are dropped.
+	eventBuffer     = 64
+	shutdownTimeout = 5 * time.Second
+)
+
+// ErrInvalidRequest marks backend errors caused by the request, which are
+// answered with 400 Bad Request.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Backend is implemented by the watcher and served by the API.
+type Backend interface {
+	AddJob(ctx context.Context, req client.AddJobRequest) (client.AddJobResult, error)
+	ListJobs(ctx context.Context, opts client.ListJobsOptions) ([]client.Job, error)
+	GetJob(ctx context.Context, id int64) (client.Job, error)
+	RetryJob(ctx context.Context, id int64) error
+	RetryFailedJobs(ctx context.Context) (int64, error)
+	DeleteJob(ctx context.Context, id int64) error
+	Stats(ctx context.Context, month string) (client.Stats, error)
+	ApproveJob(ctx context.Context, id int64) error
+	SetJobNote(ctx context.Context, id int64, note string) error
+	OverrideJobStatus(ctx context.Context, id int64, status, reason string) error
+}
+
+// Server is the HTTP API. It is also an events.Subscriber that forwards
+// events to the connected event streams.
+type Server struct {
+	backend Backend
+	log     *slog.Logger
+	mux     *http.ServeMux
+
+	mu      sync.Mutex
+	streams map[chan client.Event]struct{}
+
+	level  *slog.LevelVar
+	rescan func() []string
+	paused *atomic.Bool
+}
+
+// Ensure Server implements events.Subscriber
+var _ events.Subscriber = (*Server)(nil)
+
+// New creates a Server for b.
+func New(b Backend, logger *slog.Logger) *Server {
+	s := &Server{
+		backend: b,
+		log:     logger,
+		mux:     http.NewServeMux(),
+		streams: make(map[chan client.Event]struct{}),
+	}
+
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/jobs", s.listJobs)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/jobs", s.addJob)
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/jobs/{id}", s.getJob)
+	s.mux.HandleFunc("DELETE "+client.APIPrefix+"/jobs/{id}", s.deleteJob)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/jobs/retry", s.retryFailedJobs)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/jobs/{id}/retry", s.retryJob)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/jobs/{id}/approve", s.approveJob)
+	s.mux.HandleFunc("PUT "+client.APIPrefix+"/jobs/{id}/note", s.setJobNote)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/jobs/{id}/status", s.overrideJobStatus)
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/stats", s.stats)
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/events", s.streamEvents)
+
+	return s
+}
+
+// EnableLogLevel serves level, the log level of the watcher, to be read and
+// changed at runtime.
+func (s *Server) EnableLogLevel(level *slog.LevelVar) {
+	s.level = level
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/log-level", s.getLogLevel)
+	s.mux.HandleFunc("PUT "+client.APIPrefix+"/log-level", s.setLogLevel)
+}
+
+// EnableRescan serves rescan, which starts a full scan of the watch
+// directories and returns them.
+func (s *Server) EnableRescan(rescan func() []string) {
+	s.rescan = rescan
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/rescan", s.startRescan)
+}
+
+// EnablePause serves paused, which stops the workers from picking new jobs
+// while set, to be read and changed at runtime.
+func (s *Server) EnablePause(paused *atomic.Bool) {
+	s.paused = paused
+	s.mux.HandleFunc("GET "+client.APIPrefix+"/worker", s.getWorkerState)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/worker/pause", s.pauseWorker)
+	s.mux.HandleFunc("POST "+client.APIPrefix+"/worker/resume", s.resumeWorker)
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Listen opens the listener for addr, a TCP address such as 127.0.0.1:8090
+// or a unix socket such as unix:/run/nzb-repair.sock. A stale socket file is
+// replaced.
+func Listen(addr string) (net.Listener, error) {
+	if socket, ok := strings.CutPrefix(addr, "unix:"); ok {
+		socket = strings.TrimPrefix(socket, "//")
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale socket %q: %w", socket, err)
+		}
+
+		return net.Listen("unix", socket)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// Serve serves the API on l until ctx is canceled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Requests, including event streams, end when the watcher stops.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("api server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down api server: %w", err)
+	}
+
+	return nil
+}
+
+// HandleEvent forwards e to every connected event stream.
+func (s *Server) HandleEvent(_ context.Context, e events.Event) {
+	ce := client.Event{
+		Type:       string(e.Type),
+		Time:       e.Time,
+		JobID:      e.JobID,
+		FilePath:   e.FilePath,
+		OutputPath: e.OutputPath,
+		Phase:      e.Phase,
+		Duration:   e.Duration,
+		Error:      e.Error,
+		Fields:     e.Fields,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.streams {
+		select {
+		case ch <- ce:
+		default:
+		}
+	}
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	opts := client.ListJobsOptions{Status: r.URL.Query().Get("status")}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			s.writeError(w, fmt.Errorf("%w: invalid limit %q", ErrInvalidRequest, limit))
+			return
+		}
+		opts.Limit = n
+	}
+
+	jobs, err := s.backend.ListJobs(r.Context(), opts)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if jobs == nil {
+		jobs = []client.Job{}
+	}
+
+	s.writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) addJob(w http.ResponseWriter, r *http.Request) {
+	var req client.AddJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+		return
+	}
+
+	res, err := s.backend.AddJob(r.Context(), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, res)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	job, err := s.backend.GetJob(r.Context(), id)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) deleteJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	if err := s.backend.DeleteJob(r.Context(), id); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) retryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	if err := s.backend.RetryJob(r.Context(), id); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) retryFailedJobs(w http.ResponseWriter, r *http.Request) {
+	n, err := s.backend.RetryFailedJobs(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, client.RetryResult{Retried: n})
+}
+
+func (s *Server) approveJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	if err := s.backend.ApproveJob(r.Context(), id); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) setJobNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	var req client.JobNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+		return
+	}
+
+	if err := s.backend.SetJobNote(r.Context(), id, req.Note); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) overrideJobStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid job id %q", ErrInvalidRequest, r.PathValue("id")))
+		return
+	}
+
+	var req client.JobStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+		return
+	}
+
+	if err := s.backend.OverrideJobStatus(r.Context(), id, req.Status, req.Reason); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.backend.Stats(r.Context(), r.URL.Query().Get("month"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, client.LogLevel{Level: s.level.Level().String()})
+}
+
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req client.LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		s.writeError(w, fmt.Errorf("%w: invalid log level %q, expected debug, info, warn or error", ErrInvalidRequest, req.Level))
+		return
+	}
+
+	if level != s.level.Level() {
+		s.level.Set(level)
+		s.log.Log(r.Context(), max(level, slog.LevelInfo), "Log level changed", "level", level)
+	}
+
+	s.writeJSON(w, http.StatusOK, client.LogLevel{Level: level.String()})
+}
+
+func (s *Server) startRescan(w http.ResponseWriter, r *http.Request) {
+	dirs := s.rescan()
+	s.log.InfoContext(r.Context(), "Rescan requested through the API", "directories", dirs)
+
+	s.writeJSON(w, http.StatusAccepted, client.RescanResult{Directories: dirs})
+}
+
+func (s *Server) getWorkerState(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, client.WorkerState{Paused: s.paused.Load()})
+}
+
+func (s *Server) pauseWorker(w http.ResponseWriter, r *http.Request) {
+	if !s.paused.Swap(true) {
+		s.log.InfoContext(r.Context(), "Workers paused through the API, running jobs are finished")
+	}
+
+	s.writeJSON(w, http.StatusOK, client.WorkerState{Paused: true})
+}
+
+func (s *Server) resumeWorker(w http.ResponseWriter, r *http.Request) {
+	if s.paused.Swap(false) {
+		s.log.InfoContext(r.Context(), "Workers resumed through the API")
+	}
+
+	s.writeJSON(w, http.StatusOK, client.WorkerState{Paused: false})
+}
+
+// streamEvents sends events as server-sent events until the client
+// disconnects.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	var jobID int64
+	if id := r.URL.Query().Get("job_id"); id != "" {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			s.writeError(w, fmt.Errorf("%w: invalid job_id %q", ErrInvalidRequest, id))
+			return
+		}
+		jobID = n
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, errors.New("streaming not supported"))
+		return
+	}
+
+	ch := make(chan client.Event, eventBuffer)
+	s.mu.Lock()
+	s.streams[ch] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			if jobID != 0 && e.JobID != jobID {
+				continue
+			}
+
+			b, err := json.Marshal(e)
+			if err != nil {
+				s.log.WarnContext(r.Context(), "Failed to encode event", "error", err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Warn("Failed to write API response", "error", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrInvalidRequest) {
+		status = http.StatusBadRequest
+	} else {
+		s.log.Error("API request failed", "error", err)
+	}
+
+	s.writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+type fakeBackend struct {
+	added    []client.AddJobRequest
+	jobs     []client.Job
+	approved []int64
+	notes    map[int64]string
+	statuses map[int64]string
+	retried  []int64
+	deleted  []int64
+}
+
+func (f *fakeBackend) AddJob(_ context.Context, req client.AddJobRequest) (client.AddJobResult, error) {
+	if req.Path == "" {
+		return client.AddJobResult{}, fmt.Errorf("%w: path is required", ErrInvalidRequest)
+	}
+
+	f.added = append(f.added, req)
+
+	return client.AddJobResult{Path: req.Path, Status: "pending"}, nil
+}
+
+func (f *fakeBackend) ListJobs(_ context.Context, opts client.ListJobsOptions) ([]client.Job, error) {
+	var out []client.Job
+	for _, j := range f.jobs {
+		if opts.Status == "" || j.Status == opts.Status {
+			out = append(out, j)
+		}
+	}
+
+	return out, nil
+}
+
+func (f *fakeBackend) GetJob(_ context.Context, id int64) (client.Job, error) {
+	for _, j := range f.jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+
+	return client.Job{}, fmt.Errorf("%w: job %d not found", ErrInvalidRequest, id)
+}
+
+func (f *fakeBackend) RetryJob(_ context.Context, id int64) error {
+	job, err := f.GetJob(context.Background(), id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != "failed" {
+		return fmt.Errorf("%w: job %d has not failed", ErrInvalidRequest, id)
+	}
+
+	f.retried = append(f.retried, id)
+
+	return nil
+}
+
+func (f *fakeBackend) RetryFailedJobs(_ context.Context) (int64, error) {
+	var n int64
+	for _, j := range f.jobs {
+		if j.Status == "failed" {
+			f.retried = append(f.retried, j.ID)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (f *fakeBackend) DeleteJob(_ context.Context, id int64) error {
+	if _, err := f.GetJob(context.Background(), id); err != nil {
+		return err
+	}
+
+	f.deleted = append(f.deleted, id)
+
+	return nil
+}
+
+func (f *fakeBackend) Stats(_ context.Context, month string) (client.Stats, error) {
+	if month == "bad" {
+		return client.Stats{}, errors.New("boom")
+	}
+
+	return client.Stats{Month: month, Jobs: map[string]int64{"pending": 1}}, nil
+}
+
+func (f *fakeBackend) ApproveJob(_ context.Context, id int64) error {
+	if id != 1 {
+		return fmt.Errorf("%w: job %d is not awaiting approval", ErrInvalidRequest, id)
+	}
+
+	f.approved = append(f.approved, id)
+
+	return nil
+}
+
+func (f *fakeBackend) SetJobNote(_ context.Context, id int64, note string) error {
+	if f.notes == nil {
+		f.notes = make(map[int64]string)
+	}
+	f.notes[id] = note
+
+	return nil
+}
+
+func (f *fakeBackend) OverrideJobStatus(_ context.Context, id int64, status, reason string) error {
+	if status != "completed" && status != "failed" {
+		return fmt.Errorf("%w: cannot mark a job as %q", ErrInvalidRequest, status)
+	}
+
+	if f.statuses == nil {
+		f.statuses = make(map[int64]string)
+	}
+	f.statuses[id] = status + ": " + reason
+
+	return nil
+}
+
+func newTestServer(t *testing.T, b Backend) (*Server, *client.Client) {
+	t.Helper()
+
+	srv := New(b, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(ts.URL)
+	require.NoError(t, err)
+
+	return srv, c
+}
+
+func TestServer_Jobs(t *testing.T) {
+	backend := &fakeBackend{jobs: []client.Job{
+		{ID: 1, FilePath: "/watch/a.nzb", Status: "pending"},
+		{ID: 2, FilePath: "/watch/b.nzb", Status: "failed", Error: "par2 failed"},
+	}}
+	_, c := newTestServer(t, backend)
+	ctx := context.Background()
+
+	res, err := c.AddJob(ctx, client.AddJobRequest{Path: "/srv/c.nzb", Priority: "high"})
+	require.NoError(t, err)
+	assert.Equal(t, client.AddJobResult{Path: "/srv/c.nzb", Status: "pending"}, res)
+	assert.Equal(t, []client.AddJobRequest{{Path: "/srv/c.nzb", Priority: "high"}}, backend.added)
+
+	jobs, err := c.ListJobs(ctx, client.ListJobsOptions{Status: "failed"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "par2 failed", jobs[0].Error)
+
+	_, err = c.AddJob(ctx, client.AddJobRequest{})
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Contains(t, apiErr.Message, "path is required")
+}
+
+func TestServer_RetryAndDeleteJob(t *testing.T) {
+	backend := &fakeBackend{jobs: []client.Job{
+		{ID: 1, FilePath: "/watch/a.nzb", Status: "pending"},
+		{ID: 2, FilePath: "/watch/b.nzb", Status: "failed", Error: "par2 failed"},
+	}}
+	_, c := newTestServer(t, backend)
+	ctx := context.Background()
+
+	job, err := c.GetJob(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "par2 failed", job.Error)
+
+	require.NoError(t, c.RetryJob(ctx, 2))
+	assert.Equal(t, []int64{2}, backend.retried)
+
+	err = c.RetryJob(ctx, 1)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+	n, err := c.RetryFailedJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, c.DeleteJob(ctx, 1))
+	assert.Equal(t, []int64{1}, backend.deleted)
+
+	_, err = c.GetJob(ctx, 3)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestServer_PauseWorker(t *testing.T) {
+	srv, c := newTestServer(t, &fakeBackend{})
+	ctx := context.Background()
+
+	// Not served until enabled
+	_, err := c.WorkerState(ctx)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+
+	paused := new(atomic.Bool)
+	srv.EnablePause(paused)
+
+	state, err := c.PauseWorker(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.True(t, paused.Load())
+
+	state, err = c.WorkerState(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+
+	state, err = c.ResumeWorker(ctx)
+	require.NoError(t, err)
+	assert.False(t, state.Paused)
+	assert.False(t, paused.Load())
+}
+
+func TestServer_ApproveJob(t *testing.T) {
+	backend := &fakeBackend{}
+	_, c := newTestServer(t, backend)
+
+	require.NoError(t, c.ApproveJob(context.Background(), 1))
+	assert.Equal(t, []int64{1}, backend.approved)
+
+	err := c.ApproveJob(context.Background(), 2)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestServer_JobNoteAndStatus(t *testing.T) {
+	backend := &fakeBackend{}
+	_, c := newTestServer(t, backend)
+	ctx := context.Background()
+
+	require.NoError(t, c.SetJobNote(ctx, 3, "re-downloaded by hand"))
+	assert.Equal(t, map[int64]string{3: "re-downloaded by hand"}, backend.notes)
+
+	require.NoError(t, c.OverrideJobStatus(ctx, 3, "completed", "fixed manually"))
+	assert.Equal(t, map[int64]string{3: "completed: fixed manually"}, backend.statuses)
+
+	err := c.OverrideJobStatus(ctx, 3, "pending", "")
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestServer_Stats(t *testing.T) {
+	_, c := newTestServer(t, &fakeBackend{})
+
+	stats, err := c.Stats(context.Background(), "2025-01")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01", stats.Month)
+	assert.Equal(t, int64(1), stats.Jobs["pending"])
+
+	_, err = c.Stats(context.Background(), "bad")
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	srv, c := newTestServer(t, &fakeBackend{})
+	ctx := context.Background()
+
+	// Not served until enabled
+	_, err := c.LogLevel(ctx)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+
+	level := new(slog.LevelVar)
+	srv.EnableLogLevel(level)
+
+	got, err := c.LogLevel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "INFO", got)
+
+	got, err = c.SetLogLevel(ctx, "debug")
+	require.NoError(t, err)
+	assert.Equal(t, "DEBUG", got)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	_, err = c.SetLogLevel(ctx, "chatty")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+}
+
+func TestServer_Rescan(t *testing.T) {
+	srv, c := newTestServer(t, &fakeBackend{})
+	ctx := context.Background()
+
+	// Not served until enabled
+	_, err := c.Rescan(ctx)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+
+	rescans := 0
+	srv.EnableRescan(func() []string {
+		rescans++
+		return []string{"/watch"}
+	})
+
+	dirs, err := c.Rescan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/watch"}, dirs)
+	assert.Equal(t, 1, rescans)
+}
+
+func TestServer_JobEvents(t *testing.T) {
+	srv, c := newTestServer(t, &fakeBackend{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan client.Event, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.JobEvents(ctx, 7, func(e client.Event) error {
+			received <- e
+			return errors.New("stop")
+		})
+	}()
+
+	// Publish until the stream is connected; events of other jobs are filtered.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-received:
+			assert.Equal(t, string(events.JobCompleted), e.Type)
+			assert.Equal(t, int64(7), e.JobID)
+			assert.EqualError(t, <-done, "stop")
+			return
+		case <-ticker.C:
+			srv.HandleEvent(ctx, events.Event{Type: events.JobStarted, JobID: 8})
+			srv.HandleEvent(ctx, events.Event{Type: events.JobCompleted, JobID: 7})
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	srv := New(&fakeBackend{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	l, err := Listen("unix:" + socket)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ctx, l)
+	}()
+
+	c, err := client.New("unix:" + socket)
+	require.NoError(t, err)
+
+	stats, err := c.Stats(context.Background(), "2025-02")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-02", stats.Month)
+
+	cancel()
+	assert.NoError(t, <-served)
+}
@@ -0,0 +1,312 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/rules"
+)
+
+// admission deduplicates NZBs against the repair history and evaluates the
+// size and age limits and the configured rules before jobs reach the queue and
+// again right before they are processed.
+type admission struct {
+	queue          *queue.Queue
+	rules          *rules.Engine
+	maxSizeBytes   int64
+	oversizeStatus queue.JobStatus
+	maxPostAge     time.Duration
+	minPostAge     time.Duration
+	maxRetries     int64
+	// dirs give jobs from configured watch directories their settings.
+	dirs watchDirs
+	log  *slog.Logger
+}
+
+// Ensure admission implements Queuer
+var _ queue.Queuer = (*admission)(nil)
+
+// verdict is the admission outcome for an NZB.
+type verdict struct {
+	// status is StatusPending when the job may run.
+	status queue.JobStatus
+	reason string
+	rule   string
+	route  config.RouteConfig
+	// notBefore delays a pending job.
+	notBefore time.Time
+	// permanent marks a failure that retries cannot fix.
+	permanent bool
+	// size is the total size of the NZB, 0 when it was not inspected.
+	size int64
+}
+
+var acceptVerdict = verdict{status: queue.StatusPending}
+
+func newAdmission(cfg config.Config, q *queue.Queue, engine *rules.Engine, logger *slog.Logger) (*admission, error) {
+	a := &admission{
+		queue:        q,
+		rules:        engine,
+		maxSizeBytes: int64(cfg.MaxNzbSizeGB * (1 << 30)),
+		maxPostAge:   time.Duration(cfg.MaxPostAgeDays) * 24 * time.Hour,
+		minPostAge:   cfg.MinPostAge,
+		maxRetries:   cfg.MaxRetries,
+		log:          logger.With("component", "admission"),
+	}
+
+	dirs, err := newWatchDirs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a.dirs = dirs
+
+	switch rules.Action(cfg.OversizeAction) {
+	case "", rules.ActionSkip:
+		a.oversizeStatus = queue.StatusTooLarge
+	case rules.ActionHold:
+		a.oversizeStatus = queue.StatusHeld
+	default:
+		return nil, fmt.Errorf("unknown oversize_action %q, expected skip or hold", cfg.OversizeAction)
+	}
+
+	return a, nil
+}
+
+// enabled reports whether any admission check is configured.
+func (a *admission) enabled() bool {
+	return a.maxSizeBytes > 0 || a.maxPostAge > 0 || a.minPostAge > 0 || !a.rules.Empty()
+}
+
+// AddJob queues the file with the status decided by the admission checks.
+// Files already known to the queue are only re-evaluated when their job
+// failed or lost its file, matching the requeue behaviour of Queue.AddJob. An NZB with the same
+// content as a previously completed job is completed right away, pointing to
+// the existing output.
+func (a *admission) AddJob(absPath, relPath string) error {
+	_, err := a.add(absPath, relPath, queue.AddOptions{})
+	return err
+}
+
+// add implements AddJob, applying the priority and category of override when
+// set. It returns the status of the job after the call.
+func (a *admission) add(absPath, relPath string, override queue.AddOptions) (queue.JobStatus, error) {
+	job, err := a.queue.GetJobByPath(absPath)
+	if err == nil && job.Status != queue.StatusFailed && job.Status != queue.StatusMissingSource {
+		return job.Status, nil
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	hash, err := hashFile(absPath)
+	if err != nil {
+		a.log.Warn("Failed to hash nzb", "path", absPath, "error", err)
+	}
+
+	if prev := a.previouslyRepaired(hash); prev != nil {
+		a.log.Info("NZB already repaired, reusing previous output", "path", absPath, "previous", prev.FilePath, "output", prev.OutputPath)
+
+		return queue.StatusCompleted, a.queue.AddJobWithOptions(absPath, relPath, queue.AddOptions{
+			Status:      queue.StatusCompleted,
+			Reason:      fmt.Sprintf("already repaired as %s", prev.FilePath),
+			ContentHash: hash,
+			OutputPath:  prev.OutputPath,
+			Category:    a.category(absPath, override.Category),
+		})
+	}
+
+	// The NZB is inspected even without checks to record its size, for the
+	// smallest-first order and queue ETAs.
+	v := a.evaluate(absPath, relPath)
+
+	if v.status != queue.StatusPending || !v.notBefore.IsZero() {
+		a.log.Info("Job not admitted for processing", "path", absPath, "status", v.status, "rule", v.rule, "reason", v.reason)
+	}
+
+	opts := queue.AddOptions{
+		Status:      v.status,
+		Reason:      v.reason,
+		Priority:    a.route(absPath, v.route).Priority,
+		NotBefore:   v.notBefore,
+		ContentHash: hash,
+		Category:    a.category(absPath, override.Category),
+		SizeBytes:   v.size,
+	}
+	if override.Priority != 0 {
+		opts.Priority = override.Priority
+	}
+	if v.permanent {
+		opts.RetryCount = a.maxRetries
+	}
+
+	return v.status, a.queue.AddJobWithOptions(absPath, relPath, opts)
+}
+
+// previouslyRepaired returns the completed job with the same content hash whose
+// output still exists, or nil.
+func (a *admission) previouslyRepaired(hash string) *queue.Job {
+	if hash == "" {
+		return nil
+	}
+
+	prev, err := a.queue.FindCompletedByHash(hash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			a.log.Warn("Failed to look up repair history", "error", err)
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(prev.OutputPath); err != nil {
+		return nil
+	}
+
+	return prev
+}
+
+// hashFile returns the hex encoded SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recheck re-evaluates the admission checks for a job about to be processed
+// and updates its status when it must not run. It reports whether the job may
+// proceed, along with the route it must be processed with.
+func (a *admission) recheck(ctx context.Context, job *queue.Job) (verdict, bool) {
+	if !a.enabled() {
+		v := acceptVerdict
+		v.route = a.route(job.FilePath, v.route)
+		return v, true
+	}
+
+	v := a.evaluate(job.FilePath, job.RelativePath)
+	v.route = a.route(job.FilePath, v.route)
+	if v.status == queue.StatusPending && v.notBefore.IsZero() {
+		return v, true
+	}
+
+	a.log.InfoContext(ctx, "Job stopped before processing", "job_id", job.ID, "status", v.status, "rule", v.rule, "reason", v.reason)
+
+	var err error
+	switch {
+	case !v.notBefore.IsZero():
+		err = a.queue.DeferJob(job.ID, v.notBefore, v.reason)
+	case v.permanent:
+		err = a.queue.FailJobPermanently(job.ID, a.maxRetries, v.reason)
+	default:
+		err = a.queue.UpdateJobStatus(job.ID, v.status, v.reason)
+	}
+	if err != nil {
+		a.log.ErrorContext(ctx, "Failed to update job status", "job_id", job.ID, "error", err)
+	}
+
+	return v, false
+}
+
+// route completes the route of a rule with the settings of the configured
+// watch directory holding path.
+func (a *admission) route(path string, route config.RouteConfig) config.RouteConfig {
+	if dir, ok := a.dirs.of(path); ok {
+		return mergeRoute(route, dir.RouteConfig)
+	}
+
+	return route
+}
+
+// category returns the category of a job for path: category when set, else
+// the category of the configured watch directory holding path. Empty lets the
+// queue derive it from the relative path.
+func (a *admission) category(path, category string) string {
+	if category != "" {
+		return category
+	}
+
+	dir, _ := a.dirs.of(path)
+	return dir.Category
+}
+
+// evaluate inspects the NZB and runs the checks. Unreadable NZBs and rule
+// errors are logged and accepted so the job fails in the worker with a
+// proper error.
+func (a *admission) evaluate(absPath, relPath string) verdict {
+	attrs, err := rules.Inspect(absPath, relPath)
+	if err != nil {
+		a.log.Warn("Failed to inspect nzb for admission", "path", absPath, "error", err)
+		return acceptVerdict
+	}
+
+	v := a.check(absPath, attrs)
+	v.size = attrs.SizeBytes
+
+	return v
+}
+
+// check runs the checks against the attributes of the NZB at absPath.
+func (a *admission) check(absPath string, attrs rules.Attributes) verdict {
+	if a.maxSizeBytes > 0 && attrs.SizeBytes > a.maxSizeBytes {
+		return verdict{
+			status: a.oversizeStatus,
+			reason: fmt.Sprintf("nzb size %s exceeds the %s limit", formatBytes(attrs.SizeBytes), formatBytes(a.maxSizeBytes)),
+		}
+	}
+
+	if a.maxPostAge > 0 && !attrs.OldestPost.IsZero() && time.Since(attrs.OldestPost) > a.maxPostAge {
+		return verdict{
+			status:    queue.StatusFailed,
+			reason:    fmt.Sprintf("posted %d days ago, beyond the %d day max_post_age_days limit", int(attrs.AgeDays), int(a.maxPostAge.Hours()/24)),
+			permanent: true,
+		}
+	}
+
+	if a.minPostAge > 0 && !attrs.NewestPost.IsZero() {
+		if ready := attrs.NewestPost.Add(a.minPostAge); time.Now().Before(ready) {
+			return verdict{
+				status:    queue.StatusPending,
+				reason:    fmt.Sprintf("waiting for propagation until %s", ready.Format(time.RFC3339)),
+				notBefore: ready,
+			}
+		}
+	}
+
+	decision, err := a.rules.Evaluate(attrs)
+	if err != nil {
+		a.log.Warn("Failed to evaluate rules", "path", absPath, "error", err)
+		return acceptVerdict
+	}
+
+	v := verdict{status: queue.StatusPending, rule: decision.Rule, route: decision.Route}
+	switch decision.Action {
+	case rules.ActionHold:
+		v.status = queue.StatusHeld
+		v.reason = decision.Reason
+	case rules.ActionSkip:
+		v.status = queue.StatusSkipped
+		v.reason = decision.Reason
+	}
+
+	return v
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/rules"
+)
+
+// writeTestNzb writes an NZB with a single file of the given segment size.
+func writeTestNzb(t *testing.T, dir, name string, segmentBytes int64) string {
+	t.Helper()
+
+	return writeTestNzbPosted(t, dir, name, segmentBytes, time.Unix(1678886400, 0))
+}
+
+// writeTestNzbPosted writes an NZB with a single file posted at the given time.
+func writeTestNzbPosted(t *testing.T, dir, name string, segmentBytes int64, posted time.Time) string {
+	t.Helper()
+
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="` + strconv.FormatInt(posted.Unix(), 10) + `" subject="[1/1] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="` + strconv.FormatInt(segmentBytes, 10) + `" number="1">seg@test</segment></segments>
+ </file>
+</nzb>`
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	return path
+}
+
+func newTestAdmission(t *testing.T, cfg config.Config) (*admission, *queue.Queue) {
+	t.Helper()
+
+	q, err := queue.NewQueue(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+
+	engine, err := rules.Compile(cfg.Rules)
+	require.NoError(t, err)
+
+	a, err := newAdmission(cfg, q, engine, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	return a, q
+}
+
+func TestAdmission_MaxSize(t *testing.T) {
+	dir := t.TempDir()
+	small := writeTestNzb(t, dir, "small.nzb", 1<<20)
+	big := writeTestNzb(t, dir, "big.nzb", 3<<30)
+
+	t.Run("skip", func(t *testing.T) {
+		a, q := newTestAdmission(t, config.Config{MaxNzbSizeGB: 2})
+
+		require.NoError(t, a.AddJob(small, "small.nzb"))
+		require.NoError(t, a.AddJob(big, "big.nzb"))
+
+		job, err := q.GetJobByPath(big)
+		require.NoError(t, err)
+		assert.Equal(t, queue.StatusTooLarge, job.Status)
+		assert.Contains(t, job.ErrorMsg.String, "exceeds the 2.0 GiB limit")
+
+		job, err = q.GetJobByPath(small)
+		require.NoError(t, err)
+		assert.Equal(t, queue.StatusPending, job.Status)
+	})
+
+	t.Run("hold", func(t *testing.T) {
+		a, q := newTestAdmission(t, config.Config{MaxNzbSizeGB: 2, OversizeAction: "hold"})
+
+		require.NoError(t, a.AddJob(big, "big.nzb"))
+
+		job, err := q.GetJobByPath(big)
+		require.NoError(t, err)
+		assert.Equal(t, queue.StatusHeld, job.Status)
+	})
+}
+
+func TestAdmission_RecordsSize(t *testing.T) {
+	dir := t.TempDir()
+	big := writeTestNzb(t, dir, "big.nzb", 3<<30)
+	small := writeTestNzb(t, dir, "small.nzb", 1<<20)
+
+	a, q := newTestAdmission(t, config.Config{})
+	q.SetOrder(queue.OrderSmallestFirst)
+
+	require.NoError(t, a.AddJob(big, "big.nzb"))
+	require.NoError(t, a.AddJob(small, "small.nzb"))
+
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, small, job.FilePath)
+	assert.Equal(t, int64(1<<20), job.SizeBytes)
+}
+
+func TestAdmission_RulesAndRecheck(t *testing.T) {
+	dir := t.TempDir()
+	movie := writeTestNzb(t, dir, filepath.Join("movies", "film.nzb"), 1<<20)
+	show := writeTestNzb(t, dir, filepath.Join("tv", "show.nzb"), 1<<20)
+
+	a, q := newTestAdmission(t, config.Config{Rules: []config.RuleConfig{
+		{Name: "tv", When: `category == "tv"`, Route: config.RouteConfig{Priority: 3}},
+		{Name: "no-movies", When: `category == "movies"`, Action: "skip"},
+	}})
+
+	require.NoError(t, a.AddJob(movie, filepath.Join("movies", "film.nzb")))
+	require.NoError(t, a.AddJob(show, filepath.Join("tv", "show.nzb")))
+
+	job, err := q.GetJobByPath(movie)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusSkipped, job.Status)
+
+	job, err = q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, show, job.FilePath)
+	assert.Equal(t, 3, job.Priority)
+
+	v, ok := a.recheck(context.Background(), job)
+	assert.True(t, ok)
+	assert.Equal(t, "tv", v.rule)
+
+	// The file changed category after being queued
+	job.RelativePath = filepath.Join("movies", "show.nzb")
+	_, ok = a.recheck(context.Background(), job)
+	assert.False(t, ok)
+
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	job, err = q.GetJobByPath(show)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusSkipped, job.Status)
+}
+
+func TestAdmission_PostAge(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestNzb(t, dir, "old.nzb", 1<<20)
+	fresh := writeTestNzbPosted(t, dir, "fresh.nzb", 1<<20, time.Now().Add(-time.Hour))
+
+	a, q := newTestAdmission(t, config.Config{MaxPostAgeDays: 30, MinPostAge: 6 * time.Hour, MaxRetries: 3})
+
+	require.NoError(t, a.AddJob(old, "old.nzb"))
+	require.NoError(t, a.AddJob(fresh, "fresh.nzb"))
+
+	job, err := q.GetJobByPath(old)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusFailed, job.Status)
+	assert.Equal(t, int64(3), job.RetryCount, "aged out jobs must not be retried")
+	assert.Contains(t, job.ErrorMsg.String, "max_post_age_days")
+
+	job, err = q.GetJobByPath(fresh)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusPending, job.Status)
+	assert.Contains(t, job.ErrorMsg.String, "waiting for propagation")
+
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "fresh posts are delayed")
+}
+
+func TestAdmission_SkipsPreviouslyRepaired(t *testing.T) {
+	dir := t.TempDir()
+	first := writeTestNzb(t, dir, "first.nzb", 1<<20)
+	copyPath := filepath.Join(dir, "renamed.nzb")
+	content, err := os.ReadFile(first)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(copyPath, content, 0644))
+
+	a, q := newTestAdmission(t, config.Config{})
+
+	require.NoError(t, a.AddJob(first, "first.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	output := filepath.Join(dir, "repaired", "first.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(output), 0755))
+	require.NoError(t, os.WriteFile(output, content, 0644))
+	require.NoError(t, q.UpdateJobStatus(job.ID, queue.StatusCompleted, ""))
+	require.NoError(t, q.SetJobOutputPath(job.ID, output))
+
+	require.NoError(t, a.AddJob(copyPath, "renamed.nzb"))
+
+	dup, err := q.GetJobByPath(copyPath)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusCompleted, dup.Status)
+	assert.Equal(t, output, dup.OutputPath)
+
+	// Without the previous output the NZB is repaired again
+	require.NoError(t, os.Remove(output))
+	other := filepath.Join(dir, "again.nzb")
+	require.NoError(t, os.WriteFile(other, content, 0644))
+	require.NoError(t, a.AddJob(other, "again.nzb"))
+	assert.Equal(t, queue.StatusPending, mustJob(t, q, other).Status)
+}
+
+func mustJob(t *testing.T, q *queue.Queue, path string) *queue.Job {
+	t.Helper()
+
+	job, err := q.GetJobByPath(path)
+	require.NoError(t, err)
+
+	return job
+}
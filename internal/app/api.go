@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/api"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// statsFailureDays is the number of days the failures per day of the stats
+// cover, today included.
+const statsFailureDays = 7
+
+// apiBackend serves the watcher API from the queue database.
+type apiBackend struct {
+	cfg   config.Config
+	queue *queue.Queue
+	admit *admission
+}
+
+// Ensure apiBackend implements api.Backend
+var _ api.Backend = (*apiBackend)(nil)
+
+func (b *apiBackend) AddJob(_ context.Context, req client.AddJobRequest) (client.AddJobResult, error) {
+	if req.Path == "" {
+		return client.AddJobResult{}, fmt.Errorf("%w: path is required", api.ErrInvalidRequest)
+	}
+
+	priority, err := queue.ParsePriority(req.Priority)
+	if err != nil {
+		return client.AddJobResult{}, fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+	}
+
+	if err := validateCategory(req.Category); err != nil {
+		return client.AddJobResult{}, fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+	}
+
+	result, err := enqueueFile(b.admit, req.Path, priority, req.Category)
+	if err != nil {
+		return client.AddJobResult{}, err
+	}
+
+	return client.AddJobResult{Path: result.Path, Status: string(result.Status)}, nil
+}
+
+func (b *apiBackend) ListJobs(_ context.Context, opts client.ListJobsOptions) ([]client.Job, error) {
+	jobs, err := b.queue.ListJobs(queue.JobStatus(opts.Status), opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var eta queueEstimate
+	if slices.ContainsFunc(jobs, func(j *queue.Job) bool {
+		return j.Status == queue.StatusPending || j.Status == queue.StatusProcessing
+	}) {
+		if eta, err = estimateQueue(b.queue, b.cfg.WatchWorkers); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]client.Job, 0, len(jobs))
+	for _, j := range jobs {
+		job := toClientJob(j)
+		job.ETA = eta.jobs[j.ID]
+		out = append(out, job)
+	}
+
+	return out, nil
+}
+
+func (b *apiBackend) GetJob(_ context.Context, id int64) (client.Job, error) {
+	job, err := b.queue.GetJob(id)
+	if err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) {
+			return client.Job{}, fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return client.Job{}, err
+	}
+
+	return toClientJob(job), nil
+}
+
+func (b *apiBackend) RetryJob(_ context.Context, id int64) error {
+	if err := b.queue.RetryJob(id); err != nil {
+		if errors.Is(err, queue.ErrJobNotFailed) {
+			return fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *apiBackend) RetryFailedJobs(_ context.Context) (int64, error) {
+	return b.queue.RetryFailedJobs()
+}
+
+func (b *apiBackend) DeleteJob(_ context.Context, id int64) error {
+	if err := b.queue.DeleteJob(id); err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) || errors.Is(err, queue.ErrJobProcessing) {
+			return fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *apiBackend) Stats(_ context.Context, month string) (client.Stats, error) {
+	if month == "" {
+		month = queue.UsageMonth(time.Now())
+	}
+
+	usage, err := b.queue.GetProviderUsage(month)
+	if err != nil {
+		return client.Stats{}, err
+	}
+
+	queueStats, err := b.queue.Stats(statsFailureDays)
+	if err != nil {
+		return client.Stats{}, err
+	}
+
+	jobs := make(map[string]int64, len(queueStats.Counts))
+	for status, n := range queueStats.Counts {
+		jobs[string(status)] = n
+	}
+
+	nodes, err := b.queue.ListNodes()
+	if err != nil {
+		return client.Stats{}, err
+	}
+
+	eta, err := estimateQueue(b.queue, b.cfg.WatchWorkers)
+	if err != nil {
+		return client.Stats{}, err
+	}
+
+	stats := client.Stats{
+		Month:      month,
+		Providers:  providerStats(usage, monthlyCaps(b.cfg)),
+		Jobs:       jobs,
+		QueueETA:   eta.total,
+		Throughput: eta.throughput,
+	}
+	if !queueStats.OldestPending.IsZero() {
+		stats.OldestPendingAge = time.Since(queueStats.OldestPending)
+	}
+	for _, d := range queueStats.FailuresPerDay {
+		stats.FailuresPerDay = append(stats.FailuresPerDay, client.DailyFailures(d))
+	}
+	for _, n := range nodes {
+		stats.Nodes = append(stats.Nodes, client.Node(n))
+	}
+
+	return stats, nil
+}
+
+func (b *apiBackend) ApproveJob(_ context.Context, id int64) error {
+	if err := b.queue.ApproveJob(id); err != nil {
+		if errors.Is(err, queue.ErrNotAwaitingApproval) {
+			return fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *apiBackend) SetJobNote(_ context.Context, id int64, note string) error {
+	if err := b.queue.SetJobNote(id, note); err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) {
+			return fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *apiBackend) OverrideJobStatus(_ context.Context, id int64, status, reason string) error {
+	switch queue.JobStatus(status) {
+	case queue.StatusCompleted, queue.StatusFailed:
+	default:
+		return fmt.Errorf("%w: cannot mark a job as %q, expected completed or failed", api.ErrInvalidRequest, status)
+	}
+
+	if err := b.queue.OverrideJobStatus(id, queue.JobStatus(status), b.cfg.MaxRetries, reason); err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) || errors.Is(err, queue.ErrJobProcessing) {
+			return fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func toClientJob(j *queue.Job) client.Job {
+	var progress *client.JobProgress
+	if j.Progress != nil {
+		p := client.JobProgress(*j.Progress)
+		progress = &p
+	}
+
+	return client.Job{
+		ID:           j.ID,
+		FilePath:     j.FilePath,
+		RelativePath: j.RelativePath,
+		Status:       string(j.Status),
+		Error:        j.ErrorMsg.String,
+		RetryCount:   j.RetryCount,
+		Priority:     j.Priority,
+		Category:     j.Category,
+		OutputPath:   j.OutputPath,
+		Verdict:      j.Verdict,
+		Note:         j.Note,
+		Progress:     progress,
+		CreatedAt:    j.CreatedAt,
+		UpdatedAt:    j.UpdatedAt,
+	}
+}
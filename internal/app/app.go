@@ -7,16 +7,26 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/api"
 	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/hooks"
+	"github.com/javi11/nzb-repair/internal/metrics"
+	"github.com/javi11/nzb-repair/internal/notify"
+	"github.com/javi11/nzb-repair/internal/pools"
 	"github.com/javi11/nzb-repair/internal/queue"
 	"github.com/javi11/nzb-repair/internal/repairnzb"
-	"github.com/javi11/nzb-repair/internal/scanner"
+	"github.com/javi11/nzb-repair/internal/rules"
 	"github.com/javi11/nzb-repair/pkg/par2exedownloader"
 	"golang.org/x/sync/errgroup"
 )
@@ -29,40 +39,139 @@ const (
 
 // RunSingleRepair executes the repair process for a single NZB file.
 func RunSingleRepair(ctx context.Context, cfg config.Config, nzbFile string, outputFileOrDir string, tmpDir string, verbose bool) error {
-	logger := setupLogging(verbose)
+	_, err := runSingleRepair(ctx, cfg, nzbFile, outputFileOrDir, tmpDir, setupLogging(verbose))
+	return err
+}
+
+// runSingleRepair repairs one NZB with opts and returns the result of the
+// repair.
+func runSingleRepair(ctx context.Context, cfg config.Config, nzbFile string, outputFileOrDir string, tmpDir string, logger *slog.Logger, opts ...repairnzb.Option) (result *repairnzb.RepairResult, err error) {
+	if err := validateOutputConflict(cfg.OutputConflict); err != nil {
+		return nil, err
+	}
+
+	if err := validateProgress(cfg.Progress); err != nil {
+		return nil, err
+	}
+
+	if err := validateFailureMode(cfg.FailureMode); err != nil {
+		return nil, err
+	}
+
+	if err := repairnzb.ValidateSubjectTemplate(cfg.Upload.SubjectTemplate); err != nil {
+		return nil, err
+	}
+
+	if err := validatePar2Recreate(cfg); err != nil {
+		return nil, err
+	}
+
+	sink, err := newOutputSink(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output sink: %w", err)
+	}
+
+	started := time.Now()
+	usageMeter := pools.NewUsageMeter()
+	defer func() {
+		exportRunMetrics(ctx, cfg, usageMeter, started, err, logger)
+	}()
 
 	absTmpDir, err := prepareTmpDir(ctx, tmpDir, logger)
 	if err != nil {
-		return fmt.Errorf("failed to prepare temporary directory: %w", err)
+		return nil, fmt.Errorf("failed to prepare temporary directory: %w", err)
 	}
 
 	// Ensure par2 executable exists and get its path
 	par2ExePath, err := ensurePar2Executable(ctx, cfg, logger)
 	if err != nil {
-		return fmt.Errorf("failed to ensure par2 executable: %w", err)
+		return nil, fmt.Errorf("failed to ensure par2 executable: %w", err)
 	}
 	// Create the par2 executor
 	par2Executor := &repairnzb.Par2CmdExecutor{ExePath: par2ExePath}
 
-	uploadPool, downloadPool, err := createPools(ctx, cfg)
+	cache, err := newArticleCache(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer logArticleCacheStats(ctx, cache, logger)
+
+	var bundle *repairnzb.ArticleBundle
+	if cfg.BundleDir != "" {
+		if cfg.InPlace.Enabled || outputFileOrDir != "" || cfg.DryRun {
+			return nil, errors.New("--bundle cannot be combined with --in-place, --dry-run or an output path")
+		}
+
+		bundle, err = repairnzb.NewArticleBundle(cfg.BundleDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	poolOpts := poolOptions{
+		meter:   usageMeter,
+		limiter: newConnLimiter(ctx, cfg, logger),
+		warmer:  pools.NewWarmer(cfg.Pool.WarmupConnections, logger),
+		cache:   cache,
+	}
+
+	var uploadPool, downloadPool repairnzb.NNTPPool
+	if bundle != nil {
+		// Nothing is posted, the bundle takes the articles.
+		uploadPool = bundle
+		downloadPool, err = createDownloadPool(ctx, cfg.DownloadProviders, poolOpts)
+	} else if cfg.DryRun {
+		// Nothing is posted, the upload providers are not needed.
+		downloadPool, err = createDownloadPool(ctx, cfg.DownloadProviders, poolOpts)
+	} else {
+		uploadPool, downloadPool, err = createPools(ctx, cfg, poolOpts)
+	}
 	if err != nil {
-		return err // Error already contains context
+		return nil, err // Error already contains context
 	}
 	// Ensure pools are closed properly
 	defer func() {
 		logger.DebugContext(ctx, "Closing download pool")
 		_ = downloadPool.Close()
-		logger.DebugContext(ctx, "Closing upload pool")
-		_ = uploadPool.Close()
+		if uploadPool != nil {
+			logger.DebugContext(ctx, "Closing upload pool")
+			_ = uploadPool.Close()
+		}
 	}()
 
 	outputFile, err := getSingleOutputFilePath(nzbFile, outputFileOrDir)
 	if err != nil {
-		return fmt.Errorf("failed to determine output file path: %w", err)
+		return nil, fmt.Errorf("failed to determine output file path: %w", err)
+	}
+
+	// The repaired NZB references articles that do not exist yet, so it
+	// stays in the bundle.
+	if bundle != nil {
+		outputFile = filepath.Join(bundle.Dir(), filepath.Base(nzbFile))
+		sink = nil
+	}
+
+	if cfg.InPlace.Enabled {
+		if outputFileOrDir != "" {
+			return nil, errors.New("--in-place cannot be combined with an output path")
+		}
+
+		outputFile = inPlaceTempPath(nzbFile)
+		// The temporary file must be replaced, never versioned.
+		cfg.OutputConflict = repairnzb.OutputConflictOverwrite
 	}
 	logger.InfoContext(ctx, "Starting repair", "input", nzbFile, "output", outputFile, "temp", absTmpDir)
 
-	err = repairnzb.RepairNzb(
+	repairOpts := []repairnzb.Option{
+		repairnzb.WithProgressReporter(singleRepairProgress(cfg.Progress, os.Stdout, os.Stderr)),
+		repairnzb.WithOutputSink(sink),
+	}
+	if cfg.DryRun {
+		repairOpts = append(repairOpts, repairnzb.WithDryRun())
+	}
+	repairOpts = append(repairOpts, opts...)
+
+	result, err = repairnzb.RepairNzb(
 		ctx,
 		cfg,
 		downloadPool,
@@ -71,20 +180,114 @@ func RunSingleRepair(ctx context.Context, cfg config.Config, nzbFile string, out
 		nzbFile,
 		outputFile,
 		absTmpDir,
+		repairOpts...,
 	)
 	if err != nil {
 		logger.ErrorContext(ctx, "Repair failed", "input", nzbFile, "error", err)
-		return fmt.Errorf("repair process failed for %q: %w", nzbFile, err)
+		return nil, fmt.Errorf("repair process failed for %q: %w", nzbFile, err)
 	}
 
-	logger.InfoContext(ctx, "Repair successful", "input", nzbFile, "output", outputFile)
-	return nil
+	if len(result.Errors) > 0 {
+		logger.WarnContext(ctx, "Repair completed despite failures", "input", nzbFile, "errors", result.Errors)
+	}
+
+	if result.ExtractedTo != "" {
+		logger.InfoContext(ctx, "Release extracted", "input", nzbFile, "dest", result.ExtractedTo)
+	}
+
+	if cfg.DryRun {
+		return result, writeDryRunReport(os.Stdout, nzbFile, result)
+	}
+
+	if result.Healthy {
+		logger.InfoContext(ctx, "NZB is healthy, no repair needed", "input", nzbFile)
+		return result, nil
+	}
+
+	if bundle != nil {
+		if err := bundle.WriteManifest(result.OutputPath); err != nil {
+			return nil, err
+		}
+
+		logger.InfoContext(ctx, "Repaired articles written to bundle", "input", nzbFile, "bundle", bundle.Dir(), "articles", bundle.Len(), "nzb", result.OutputPath)
+		return result, nil
+	}
+
+	if err := completeOutput(ctx, cfg, nzbFile, result, logger); err != nil {
+		return nil, err
+	}
+
+	logger.InfoContext(ctx, "Repair successful", "input", nzbFile, "output", result.OutputPath, "segments_checked", result.SegmentsChecked, "broken_segments", result.BrokenSegments, "corrupt_segments", result.CorruptSegments, "segments_replaced", result.SegmentsReplaced, "downloaded", result.BytesDownloaded, "uploaded", result.BytesUploaded, "backup", result.BackupPath)
+	return result, nil
 }
 
 // RunWatcher starts the directory scanner and the repair worker goroutines.
 func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath string, outputBaseDirFlag string, tmpDir string, verbose bool) error {
 	logger := setupLogging(verbose)
 
+	ruleEngine, err := rules.Compile(cfg.Rules)
+	if err != nil {
+		return fmt.Errorf("invalid rules: %w", err)
+	}
+
+	if err := validateRouteProviders(cfg, ruleEngine.Providers()); err != nil {
+		return fmt.Errorf("invalid rules: %w", err)
+	}
+
+	if err := validateRouteUploadProviders(cfg, ruleEngine.UploadProviders()); err != nil {
+		return fmt.Errorf("invalid rules: %w", err)
+	}
+
+	if watchDir == "" && len(cfg.WatchDirs) == 0 {
+		return errors.New("no directory to watch: use --dir or set watch_dirs in the config")
+	}
+
+	if err := validateStallAction(cfg.StallAction); err != nil {
+		return err
+	}
+
+	if err := validateWatchMode(cfg.WatchMode); err != nil {
+		return err
+	}
+
+	if err := validateOrder(cfg.Order); err != nil {
+		return err
+	}
+
+	if err := validateHealthyOutput(cfg.HealthyOutput); err != nil {
+		return err
+	}
+
+	if err := validateOutputTemplate(cfg.OutputTemplate); err != nil {
+		return err
+	}
+
+	if err := validateOutputConflict(cfg.OutputConflict); err != nil {
+		return err
+	}
+
+	if err := validateFailureMode(cfg.FailureMode); err != nil {
+		return err
+	}
+
+	if err := repairnzb.ValidateSubjectTemplate(cfg.Upload.SubjectTemplate); err != nil {
+		return err
+	}
+
+	if err := validatePar2Recreate(cfg); err != nil {
+		return err
+	}
+
+	sink, err := newOutputSink(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid output sink: %w", err)
+	}
+
+	if cfg.InPlace.Enabled {
+		// The temporary file of an in-place repair must be replaced, never versioned.
+		cfg.OutputConflict = repairnzb.OutputConflictOverwrite
+	}
+
 	logger.InfoContext(ctx, "Initializing database...", "path", dbPath)
 	dbQueue, err := queue.NewQueue(dbPath)
 	if err != nil {
@@ -98,8 +301,24 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 		}
 	}()
 
+	dbQueue.SetOrder(cfg.Order)
+	dbQueue.SetMaxRetries(cfg.MaxRetries)
+	dbQueue.SetCategoryLimits(cfg.CategoryConcurrency)
+	if cfg.FairScheduling.Enabled {
+		dbQueue.EnableFairScheduling(cfg.FairScheduling.Weights)
+	}
+
+	dbQueue.SetLeaseDuration(cfg.Node.LeaseDuration)
+
+	if cfg.Node.Name != "" {
+		if err := dbQueue.RegisterNode(cfg.Node.Name, cfg.Node.SharedStorage); err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Registered node on the shared queue", "node", cfg.Node.Name, "shared_storage", cfg.Node.SharedStorage)
+	}
+
 	// Cleanup interrupted jobs from previous runs
-	logger.InfoContext(ctx, "Cleaning up any jobs marked as 'processing' from previous runs")
+	logger.InfoContext(ctx, "Releasing jobs claimed by previous runs or with expired leases")
 	cleanedCount, err := dbQueue.CleanupProcessingJobs()
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to cleanup processing jobs, continuing...", "error", err)
@@ -107,12 +326,21 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 		logger.InfoContext(ctx, "Cleaned up processing jobs", "count", cleanedCount)
 	}
 
-	absTmpDir, err := prepareTmpDir(ctx, tmpDir, logger)
+	absTmpDir, err := createTmpDir(tmpDir)
 	if err != nil {
 		return fmt.Errorf("failed to prepare temporary directory: %w", err)
 	}
 
-	// Note: Tmp dir is prepared once at the start for the watcher.
+	// Every job repairs in its own directory below the tmp dir. Directories
+	// left behind by a previous run are removed here and periodically below,
+	// except those of interrupted downloads of queued jobs.
+	jobDirs := newJobTmpDirs(absTmpDir, cfg.KeepTmpRetention, queuedJobStatus(dbQueue))
+	if reaped, err := jobDirs.reap(); err != nil {
+		logger.WarnContext(ctx, "Failed to remove stale job directories", "error", err)
+	} else if reaped > 0 {
+		logger.InfoContext(ctx, "Removed stale job directories", "count", reaped)
+	}
+
 	// Determine and prepare the base output directory.
 	outputBaseDir := outputBaseDirFlag
 	if outputBaseDir == "" {
@@ -139,10 +367,33 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 	// Create the par2 executor
 	par2Executor := &repairnzb.Par2CmdExecutor{ExePath: par2ExePath}
 
-	uploadPool, downloadPool, err := createPools(ctx, cfg)
+	usageMeter := pools.NewUsageMeter()
+	cache, err := newArticleCache(ctx, cfg, logger)
 	if err != nil {
 		return err
 	}
+	defer logArticleCacheStats(ctx, cache, logger)
+
+	poolOpts := poolOptions{
+		meter:     usageMeter,
+		limiter:   newConnLimiter(ctx, cfg, logger),
+		warmer:    pools.NewWarmer(cfg.Pool.WarmupConnections, logger),
+		cache:     cache,
+		idleClose: cfg.Pool.IdleClose,
+	}
+	// Cold pools are only open while jobs use them, so an idle watcher holds
+	// no connections.
+	createDownload, createUpload := watcherPoolCreators(poolOpts)
+	uploadPool, err := createUpload(ctx, cfg.UploadProviders, poolOpts)
+	if err != nil {
+		return err
+	}
+
+	downloadPool, err := createDownload(ctx, cfg.DownloadProviders, poolOpts)
+	if err != nil {
+		_ = uploadPool.Close()
+		return err
+	}
 
 	defer func() {
 		logger.DebugContext(ctx, "Closing download pool")
@@ -151,23 +402,74 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 		_ = uploadPool.Close()
 	}()
 
-	fileScanner := scanner.New(watchDir, dbQueue, logger, cfg.ScanInterval)
+	routed := newRoutedPools(ctx, cfg, downloadPool, uploadPool, poolOpts)
+	defer routed.Close()
+
+	registry := metrics.NewRegistry()
+	bus := events.NewBus()
+	bus.Subscribe(newMetricsSubscriber(registry))
+	jobHooks := hooks.New(cfg.Hooks, logger)
+
+	notifier, err := notify.New(cfg.Notifications, logger)
+	if err != nil {
+		return fmt.Errorf("invalid notifications: %w", err)
+	}
+	// The notifications of the last jobs are sent before the watcher exits.
+	defer notifier.Close()
+	bus.Subscribe(notifier)
+
+	statsExporter, err := newStatsExporter(cfg, registry, dbQueue, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create stats exporter: %w", err)
+	}
+
+	admit, err := newAdmission(cfg, dbQueue, ruleEngine, logger)
+	if err != nil {
+		return fmt.Errorf("invalid admission settings: %w", err)
+	}
+
+	ingester := newIngest(cfg, watchDir, admit, logger)
+
+	// Set through the API, paused workers pick no new jobs.
+	paused := new(atomic.Bool)
+
+	var apiServer *api.Server
+	var apiListener net.Listener
+	if cfg.API.Listen != "" {
+		apiListener, err = api.Listen(cfg.API.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen for api on %q: %w", cfg.API.Listen, err)
+		}
+
+		apiServer = api.New(&apiBackend{cfg: cfg, queue: dbQueue, admit: admit}, logger)
+		apiServer.EnableLogLevel(logLevel)
+		apiServer.EnableRescan(ingester.Rescan)
+		apiServer.EnablePause(paused)
+		bus.Subscribe(apiServer)
+	}
+
 	eg, gCtx := errgroup.WithContext(ctx)
 
-	// Goroutine for the directory scanner
+	// Goroutine feeding the queue from the watch directory
 	eg.Go(func() error {
-		logger.InfoContext(gCtx, "Starting directory scanner...", "directory", watchDir, "interval", cfg.ScanInterval)
-		err := fileScanner.Run(gCtx)
+		err := ingester.Run(gCtx)
 		if err != nil && !errors.Is(err, context.Canceled) {
-			logger.ErrorContext(gCtx, "Directory scanner failed", "error", err)
-			return fmt.Errorf("directory scanner error: %w", err) // Return error to errgroup
+			logger.ErrorContext(gCtx, "Ingest failed", "error", err)
+			return fmt.Errorf("ingest error: %w", err) // Return error to errgroup
 		}
-		logger.InfoContext(gCtx, "Directory scanner stopped")
 		return nil
 	})
 
-	// Goroutine for the repair worker
-	eg.Go(func() error {
+	// Repair worker loop.
+	runWorker := func(workerID int) error {
+		logger := logger.With("worker", workerID)
+
+		// The NZBs found at startup are queued first, so the first jobs
+		// picked already follow the queue order.
+		if err := ingester.WaitScanned(gCtx); err != nil {
+			return err
+		}
+
 		logger.InfoContext(gCtx, "Starting repair worker...")
 		workerTicker := time.NewTicker(defaultWorkerInterval)
 		defer workerTicker.Stop()
@@ -178,6 +480,11 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 				logger.InfoContext(gCtx, "Repair worker stopping due to context cancellation.")
 				return gCtx.Err()
 			case <-workerTicker.C:
+				workerTicker.Reset(defaultWorkerInterval)
+				if paused.Load() {
+					continue
+				}
+
 				job, err := dbQueue.GetNextJob()
 				if err != nil {
 					if errors.Is(err, sql.ErrNoRows) {
@@ -189,39 +496,382 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 					continue
 				}
 
-				logger.InfoContext(gCtx, "Processing job", "job_id", job.ID, "filepath", job.FilePath, "relative_path", job.RelativePath)
+				// Look for the next job as soon as this one is done instead of
+				// at the next tick, so a backlog is worked through without pauses.
+				workerTicker.Reset(time.Millisecond)
+
+				if sourceMissing(gCtx, dbQueue, job, logger) {
+					continue
+				}
+
+				decision, proceed := admit.recheck(gCtx, job)
+				if !proceed {
+					continue
+				}
+
+				logger.InfoContext(gCtx, "Processing job", "job_id", job.ID, "filepath", job.FilePath, "relative_path", job.RelativePath, "rule", decision.rule)
+
+				jobCfg := routedConfig(cfg, decision.route)
+				jobOutputDir := outputBaseDir
+				if decision.route.OutputDir != "" {
+					jobOutputDir = decision.route.OutputDir
+				}
+
+				jobDownloadPool, poolErr := routed.download(decision.route.Providers)
+				if poolErr != nil {
+					logger.ErrorContext(gCtx, "Failed to create routed download pool", "job_id", job.ID, "error", poolErr)
+					if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, poolErr.Error()); updateErr != nil {
+						logger.ErrorContext(gCtx, "Failed to update job status to failed", "job_id", job.ID, "error", updateErr)
+					}
+					continue
+				}
+
+				var jobOptions []repairnzb.Option
+				jobUploadPool := uploadPool
+				switch {
+				case cfg.DryRun:
+					jobOptions = append(jobOptions, repairnzb.WithDryRun())
+				case decision.route.NoUpload:
+					jobOptions = append(jobOptions, repairnzb.WithoutUpload())
+				default:
+					jobUploadPool, poolErr = routed.upload(decision.route.UploadProviders)
+					if poolErr != nil {
+						logger.ErrorContext(gCtx, "Failed to create routed upload pool", "job_id", job.ID, "error", poolErr)
+						if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, poolErr.Error()); updateErr != nil {
+							logger.ErrorContext(gCtx, "Failed to update job status to failed", "job_id", job.ID, "error", updateErr)
+						}
+						continue
+					}
+				}
+
+				if cfg.WatchMode == watchModeTriage && !job.Approved {
+					triageJob(gCtx, dbQueue, jobDownloadPool, job, events.ForJob(bus, job.ID, job.FilePath), jobHooks, logger)
+					continue
+				}
 
 				// Calculate output path and handle potential errors
-				outputFilePath, pathErr := calculateJobOutputPath(outputBaseDir, job, logger, gCtx, dbQueue)
-				if pathErr != nil {
-					// Error already logged and status updated in calculateJobOutputPath
+				var outputFilePath string
+				var pathErr error
+				if cfg.InPlace.Enabled {
+					// The repaired NZB replaces the source once written.
+					outputFilePath = inPlaceTempPath(job.FilePath)
+				} else {
+					outputFilePath, pathErr = calculateJobOutputPath(datedOutputDir(jobOutputDir, cfg.DateOutputFolders, time.Now()), cfg.OutputTemplate, job, logger, gCtx, dbQueue)
+					if pathErr != nil {
+						// Error already logged and status updated in calculateJobOutputPath
+						continue
+					}
+				}
+
+				hookPayload := hooks.Payload{
+					JobID:        job.ID,
+					FilePath:     job.FilePath,
+					RelativePath: job.RelativePath,
+					OutputPath:   outputFilePath,
+					RetryCount:   job.RetryCount,
+					Priority:     job.Priority,
+				}
+
+				hookPayload.Event = hooks.PreJob
+				directive := jobHooks.Run(gCtx, hookPayload)
+				applyHookPriority(gCtx, dbQueue, job, directive, logger)
+				if directive.Skip {
+					logger.InfoContext(gCtx, "Skipping job as requested by hook", "job_id", job.ID, "reason", directive.Reason)
+					if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusSkipped, directive.Reason); updateErr != nil {
+						logger.ErrorContext(gCtx, "Failed to update job status to skipped", "job_id", job.ID, "error", updateErr)
+					}
 					continue
 				}
 
+				if directive.OutputDir != "" && !cfg.InPlace.Enabled {
+					outputFilePath, pathErr = calculateJobOutputPath(datedOutputDir(directive.OutputDir, cfg.DateOutputFolders, time.Now()), cfg.OutputTemplate, job, logger, gCtx, dbQueue)
+					if pathErr != nil {
+						continue
+					}
+					hookPayload.OutputPath = outputFilePath
+				}
+
+				// The other NZBs of a split release are repaired with this one.
+				var grouped []*queue.Job
+				if cfg.GroupReleases && !cfg.InPlace.Enabled {
+					var groupErr error
+					grouped, groupErr = dbQueue.ClaimPendingJobs(func(j *queue.Job) bool { return sameRelease(job, j) })
+					if groupErr != nil {
+						logger.WarnContext(gCtx, "Failed to group the nzbs of the release, repairing the job alone", "job_id", job.ID, "error", groupErr)
+					} else if len(grouped) > 0 {
+						logger.InfoContext(gCtx, "Repairing release split across nzbs", "job_id", job.ID, "nzbs", len(grouped)+1)
+					}
+				}
+
+				jobEvents := events.ForJob(bus, job.ID, job.FilePath)
+				jobEvents.Publish(gCtx, events.Event{Type: events.JobStarted, OutputPath: outputFilePath})
+
 				// Process the job
-				err = repairnzb.RepairNzb(
-					gCtx,
-					cfg,
-					downloadPool,
-					uploadPool,
+				jobTmpDir := jobDirs.acquire(job.ID)
+				stall := watchStall(gCtx, cfg.StallTimeout, jobEvents)
+				result, err := repairnzb.RepairNzbs(
+					stall.Context(),
+					jobCfg,
+					jobDownloadPool,
+					jobUploadPool,
 					par2Executor,
-					job.FilePath,
+					releaseFiles(job, grouped),
 					outputFilePath,
-					absTmpDir,
+					jobTmpDir,
+					append([]repairnzb.Option{
+						repairnzb.WithEvents(stall),
+						repairnzb.WithProgress(stall.progress),
+						repairnzb.WithProgressReporter(watcherJobProgress(dbQueue, job.ID, jobEvents, logger)),
+						repairnzb.WithOutputSink(sink),
+					}, jobOptions...)...,
 				)
+				stall.Stop()
+				// A canceled repair returns without error, so a stall is only
+				// visible through the watch.
+				stalled := stall.Err()
+				if stalled != nil {
+					err = stalled
+				}
+				// A repair interrupted by the shutdown is queued again, and
+				// resumes its download from the kept directory on restart.
+				if stalled == nil && gCtx.Err() != nil {
+					logger.InfoContext(gCtx, "Repair interrupted, queuing the job again", "job_id", job.ID, "filepath", job.FilePath)
+					finishGrouped(gCtx, dbQueue, append([]*queue.Job{job}, grouped...), queue.StatusPending, "", "", logger)
+					if _, releaseErr := jobDirs.release(job.ID, false); releaseErr != nil {
+						logger.WarnContext(gCtx, "Failed to clean up job temporary directory", "job_id", job.ID, "path", jobTmpDir, "error", releaseErr)
+					}
+					continue
+				}
+				if err == nil && cfg.InPlace.Enabled && !result.Healthy && !result.NotUploaded {
+					var replaced, backup string
+					replaced, backup, err = completeInPlace(job.FilePath, result.OutputPath)
+					if replaced == job.FilePath {
+						result.OutputPath = replaced
+						result.BackupPath = backup
+						outputFilePath = replaced
+						hookPayload.OutputPath = replaced
+					}
+				}
+				keptTmpDir, releaseErr := jobDirs.release(job.ID, err != nil && cfg.KeepTmpOnFailure)
+				if releaseErr != nil {
+					logger.WarnContext(gCtx, "Failed to clean up job temporary directory", "job_id", job.ID, "path", jobTmpDir, "error", releaseErr)
+				} else if keptTmpDir != "" {
+					logger.InfoContext(gCtx, "Kept temporary directory of failed job", "job_id", job.ID, "path", keptTmpDir, "retention", cfg.KeepTmpRetention)
+				}
 
 				if err != nil {
 					logger.ErrorContext(gCtx, "Repair failed", "job_id", job.ID, "filepath", job.FilePath, "error", err)
-					if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, err.Error()); updateErr != nil {
+					failedEvent := events.Event{Type: events.JobFailed, OutputPath: outputFilePath, Error: err.Error()}
+					var updateErr error
+					rejection := postRejection(err)
+					if (stalled != nil && cfg.StallAction == stallActionFail) || isUnrepairable(err) || rejection != "" {
+						updateErr = dbQueue.FailJobPermanently(job.ID, cfg.MaxRetries, err.Error())
+					} else {
+						updateErr = dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, err.Error())
+					}
+					if updateErr != nil {
 						logger.ErrorContext(gCtx, "Failed to update job status to failed", "job_id", job.ID, "error", updateErr)
 					}
+					finishGrouped(gCtx, dbQueue, grouped, queue.StatusFailed, err.Error(), "", logger)
+					if stalled != nil {
+						failedEvent.Fields = map[string]any{"classification": errStalled.Error()}
+					} else if isUnrepairable(err) {
+						failedEvent.Fields = map[string]any{"classification": "unrepairable"}
+					} else if rejection != "" {
+						failedEvent.Fields = map[string]any{"classification": rejection}
+					}
+					jobEvents.Publish(gCtx, failedEvent)
+					if moved := moveExhaustedJobs(gCtx, dbQueue, append([]*queue.Job{job}, grouped...), cfg.MaxRetries, cfg.BrokenFolder, logger); moved > 0 {
+						bus.Publish(gCtx, events.Event{Type: events.JobMoved, Fields: map[string]any{"count": moved}})
+					}
+
+					hookPayload.Event = hooks.OnFailure
+					hookPayload.Error = err.Error()
+					applyHookPriority(gCtx, dbQueue, job, jobHooks.Run(gCtx, hookPayload), logger)
+					continue
+				}
+
+				if result.Healthy {
+					logger.InfoContext(gCtx, "Job healthy, no repair needed", "job_id", job.ID, "filepath", job.FilePath)
+					if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusHealthy, toleratedErrors(result)); updateErr != nil {
+						logger.ErrorContext(gCtx, "Failed to update job status to healthy", "job_id", job.ID, "error", updateErr)
+					}
+					finishGrouped(gCtx, dbQueue, grouped, queue.StatusHealthy, toleratedErrors(result), "", logger)
+
+					// In-place repairs leave a healthy NZB where it is and
+					// dry runs write nothing.
+					healthyMode := jobCfg.HealthyOutput
+					if cfg.InPlace.Enabled || cfg.DryRun {
+						healthyMode = healthyOutputNone
+					}
+
+					healthyOutput, backup, placeErr := placeHealthyOutput(gCtx, sink, healthyMode, job.FilePath, outputFilePath)
+					if backup != "" {
+						logger.InfoContext(gCtx, "Backed up existing output before overwriting it", "job_id", job.ID, "output", outputFilePath, "backup", backup)
+					}
+					if placeErr != nil {
+						logger.ErrorContext(gCtx, "Failed to place healthy nzb in output directory", "job_id", job.ID, "output", outputFilePath, "error", placeErr)
+					} else if healthyOutput != "" {
+						if updateErr := dbQueue.SetJobOutputPath(job.ID, healthyOutput); updateErr != nil {
+							logger.ErrorContext(gCtx, "Failed to record job output path", "job_id", job.ID, "error", updateErr)
+						}
+						postAddJobOutput(gCtx, jobCfg.PostAddTo, healthyOutput, job.ID, logger)
+					}
+					healthyEvent := events.Event{Type: events.JobHealthy, OutputPath: healthyOutput, Fields: map[string]any{}}
+					if backup != "" {
+						healthyEvent.Fields["backup_path"] = backup
+					}
+					if result.ExtractedTo != "" {
+						healthyEvent.Fields["extracted_to"] = result.ExtractedTo
+					}
+					if len(result.Errors) > 0 {
+						healthyEvent.Fields["errors"] = result.Errors
+					}
+					jobEvents.Publish(gCtx, healthyEvent)
+
+					hookPayload.Event = hooks.PostJob
+					hookPayload.OutputPath = healthyOutput
+					hookPayload.BackupPath = backup
+					hookPayload.Healthy = true
+					hookPayload.Error = toleratedErrors(result)
+					applyHookPriority(gCtx, dbQueue, job, jobHooks.Run(gCtx, hookPayload), logger)
 					continue
 				}
 
-				logger.InfoContext(gCtx, "Repair successful", "job_id", job.ID, "filepath", job.FilePath, "output", outputFilePath)
-				if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusCompleted, ""); updateErr != nil {
+				if result.NotUploaded {
+					reportJob(gCtx, dbQueue, job, grouped, result, jobEvents, logger)
+
+					hookPayload.Event = hooks.PostJob
+					hookPayload.OutputPath = ""
+					hookPayload.Verdict = string(result.Verdict)
+					applyHookPriority(gCtx, dbQueue, job, jobHooks.Run(gCtx, hookPayload), logger)
+					continue
+				}
+
+				if result.OutputPath != "" && result.OutputPath != outputFilePath {
+					if result.OutputFallback {
+						logger.WarnContext(gCtx, "Repaired file written to fallback output directory", "job_id", job.ID, "output", result.OutputPath)
+					} else if sink == nil {
+						logger.InfoContext(gCtx, "Output path exists, repaired file written as a new version", "job_id", job.ID, "output", result.OutputPath)
+					}
+					outputFilePath = result.OutputPath
+					hookPayload.OutputPath = outputFilePath
+				}
+
+				if len(result.Errors) > 0 {
+					logger.WarnContext(gCtx, "Repair completed despite failures", "job_id", job.ID, "errors", result.Errors)
+				}
+				logger.InfoContext(gCtx, "Repair successful", "job_id", job.ID, "filepath", job.FilePath, "output", outputFilePath, "backup", result.BackupPath)
+				if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusCompleted, toleratedErrors(result)); updateErr != nil {
 					logger.ErrorContext(gCtx, "Failed to update job status to completed", "job_id", job.ID, "error", updateErr)
 				}
+				if updateErr := dbQueue.SetJobOutputPath(job.ID, outputFilePath); updateErr != nil {
+					logger.ErrorContext(gCtx, "Failed to record job output path", "job_id", job.ID, "error", updateErr)
+				}
+				finishGrouped(gCtx, dbQueue, grouped, queue.StatusCompleted, toleratedErrors(result), outputFilePath, logger)
+				postAddJobOutput(gCtx, jobCfg.PostAddTo, outputFilePath, job.ID, logger)
+				completedFields := map[string]any{
+					"verdict":           string(result.Verdict),
+					"segments_checked":  result.SegmentsChecked,
+					"segments_missing":  result.SegmentsMissing,
+					"segments_replaced": result.SegmentsReplaced,
+					"broken_segments":   result.BrokenSegments,
+					"corrupt_segments":  result.CorruptSegments,
+					"bytes_downloaded":  result.BytesDownloaded,
+					"bytes_uploaded":    result.BytesUploaded,
+				}
+				if result.BackupPath != "" {
+					completedFields["backup_path"] = result.BackupPath
+				}
+				if result.ExtractedTo != "" {
+					completedFields["extracted_to"] = result.ExtractedTo
+				}
+				if len(result.Errors) > 0 {
+					completedFields["errors"] = result.Errors
+				}
+				jobEvents.Publish(gCtx, events.Event{Type: events.JobCompleted, OutputPath: outputFilePath, Fields: completedFields})
+
+				hookPayload.Event = hooks.PostJob
+				hookPayload.BackupPath = result.BackupPath
+				hookPayload.Verdict = string(result.Verdict)
+				hookPayload.Error = toleratedErrors(result)
+				applyHookPriority(gCtx, dbQueue, job, jobHooks.Run(gCtx, hookPayload), logger)
+			}
+		}
+	}
+
+	// Goroutines for the repair workers
+	for i := range cfg.WatchWorkers {
+		eg.Go(func() error {
+			return runWorker(i + 1)
+		})
+	}
+
+	// Goroutine keeping the warm connections of the pools open between jobs
+	eg.Go(func() error {
+		poolOpts.warmer.Run(gCtx, cfg.Pool.KeepaliveInterval)
+		return nil
+	})
+
+	// Goroutine for removing job directories orphaned by failed cleanups and
+	// expired in-place backups
+	eg.Go(func() error {
+		reaperTicker := time.NewTicker(cfg.ScanInterval)
+		defer reaperTicker.Stop()
+
+		for {
+			select {
+			case <-gCtx.Done():
+				return nil
+			case <-reaperTicker.C:
+				reaped, err := jobDirs.reap()
+				if err != nil {
+					logger.WarnContext(gCtx, "Failed to remove stale job directories", "error", err)
+				} else if reaped > 0 {
+					logger.InfoContext(gCtx, "Removed stale job directories", "count", reaped)
+				}
+
+				if cfg.InPlace.Enabled && cfg.InPlace.BackupRetention > 0 {
+					for _, dir := range ingester.dirs() {
+						pruned, err := pruneBackups(dir, cfg.InPlace.BackupRetention, true)
+						if err != nil {
+							logger.WarnContext(gCtx, "Failed to remove old in-place backups", "directory", dir, "error", err)
+						} else if pruned > 0 {
+							logger.InfoContext(gCtx, "Removed old in-place backups", "directory", dir, "count", pruned)
+						}
+					}
+				}
+			}
+		}
+	})
+
+	// Goroutine renewing the leases of running jobs and reclaiming the jobs of
+	// workers that stopped renewing theirs
+	eg.Go(func() error {
+		heartbeatTicker := time.NewTicker(cfg.Node.LeaseDuration / 3)
+		defer heartbeatTicker.Stop()
+
+		for {
+			select {
+			case <-gCtx.Done():
+				return nil
+			case <-heartbeatTicker.C:
+				if err := dbQueue.TouchNode(); err != nil {
+					logger.WarnContext(gCtx, "Failed to update node heartbeat", "error", err)
+				}
+
+				if _, err := dbQueue.RenewLeases(); err != nil {
+					logger.WarnContext(gCtx, "Failed to renew job leases", "error", err)
+				}
+
+				reclaimed, err := dbQueue.ReclaimExpiredJobs()
+				if err != nil {
+					logger.WarnContext(gCtx, "Failed to reclaim expired jobs", "error", err)
+					continue
+				}
+				if reclaimed > 0 {
+					logger.InfoContext(gCtx, "Reclaimed jobs with expired leases", "count", reclaimed)
+				}
 			}
 		}
 	})
@@ -245,11 +895,41 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 				}
 				if movedCount > 0 {
 					logger.InfoContext(gCtx, "Moved failed files to broken folder", "count", movedCount)
+					bus.Publish(gCtx, events.Event{Type: events.JobMoved, Fields: map[string]any{"count": movedCount}})
 				}
 			}
 		}
 	})
 
+	// Goroutine changing the log level on SIGUSR1/SIGUSR2
+	eg.Go(func() error {
+		handleLogLevelSignals(gCtx, logger)
+		return nil
+	})
+
+	// Goroutine for persisting provider bandwidth usage
+	usage := newUsageRecorder(cfg, usageMeter, dbQueue, registry, logger)
+	eg.Go(func() error {
+		usage.Run(gCtx)
+		return nil
+	})
+
+	// Goroutine for the HTTP API
+	if apiServer != nil {
+		eg.Go(func() error {
+			logger.InfoContext(gCtx, "Starting API server...", "listen", cfg.API.Listen)
+			return apiServer.Serve(gCtx, apiListener)
+		})
+	}
+
+	// Goroutine for the InfluxDB/Graphite stats exporter
+	if statsExporter != nil {
+		eg.Go(func() error {
+			statsExporter.Run(gCtx)
+			return nil
+		})
+	}
+
 	logger.InfoContext(ctx, "Watcher and worker started. Waiting for jobs or termination signal (Ctrl+C)...")
 	// Wait for all goroutines to complete
 	if err := eg.Wait(); err != nil {
@@ -260,26 +940,91 @@ func RunWatcher(ctx context.Context, cfg config.Config, watchDir string, dbPath
 	return nil
 }
 
+// completeOutput finishes the output of a repaired NZB: the in-place swap
+// with the source NZB and the copy to the post-add directory.
+func completeOutput(ctx context.Context, cfg config.Config, nzbFile string, result *repairnzb.RepairResult, logger *slog.Logger) error {
+	if cfg.InPlace.Enabled {
+		output, backup, err := completeInPlace(nzbFile, result.OutputPath)
+		if err != nil {
+			return err
+		}
+		result.OutputPath = output
+		if backup != "" {
+			result.BackupPath = backup
+		}
+
+		if cfg.InPlace.BackupRetention > 0 {
+			if _, pruneErr := pruneBackups(filepath.Dir(nzbFile), cfg.InPlace.BackupRetention, false); pruneErr != nil {
+				logger.WarnContext(ctx, "Failed to remove old backups", "error", pruneErr)
+			}
+		}
+	}
+
+	if cfg.PostAddTo != "" {
+		added, err := postAddNzb(result.OutputPath, cfg.PostAddTo)
+		if err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Added repaired nzb to post-add directory", "path", added)
+	}
+
+	return nil
+}
+
 // setupLogging configures the global logger based on the verbosity level.
 func setupLogging(verbose bool) *slog.Logger {
-	var level slog.Level
 	if verbose {
-		level = slog.LevelDebug
+		logLevel.Set(slog.LevelDebug)
 	} else {
-		level = slog.LevelInfo
+		logLevel.Set(slog.LevelInfo)
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
 	slog.SetDefault(logger)
 	return logger
 }
 
+// createTmpDir ensures the temporary directory exists and returns its absolute
+// path. Unlike prepareTmpDir it keeps existing contents, so a tmp dir shared
+// with other programs is safe to use.
+func createTmpDir(tmpDir string) (string, error) {
+	absTmpDir, err := filepath.Abs(tmpDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for temporary directory %q: %w", tmpDir, err)
+	}
+
+	if err := os.MkdirAll(absTmpDir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create temporary directory %q: %w", absTmpDir, err)
+	}
+
+	return absTmpDir, nil
+}
+
+// queuedJobStatus returns the status of a job of dbQueue, or "" when it
+// cannot be read.
+func queuedJobStatus(dbQueue *queue.Queue) func(jobID int64) queue.JobStatus {
+	return func(jobID int64) queue.JobStatus {
+		job, err := dbQueue.GetJob(jobID)
+		if err != nil {
+			return ""
+		}
+
+		return job.Status
+	}
+}
+
 // prepareTmpDir ensures the temporary directory exists, is clean, and returns its absolute path.
+// The directory of an interrupted download is kept, so the repair resumes it.
 func prepareTmpDir(ctx context.Context, tmpDir string, logger *slog.Logger) (string, error) {
 	absTmpDir, err := filepath.Abs(tmpDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path for temporary directory %q: %w", tmpDir, err)
 	}
 
+	if repairnzb.HasResumeState(absTmpDir) {
+		logger.InfoContext(ctx, "Keeping temporary directory of an interrupted download", "path", absTmpDir)
+		return absTmpDir, nil
+	}
+
 	logger.DebugContext(ctx, "Cleaning up and preparing temporary directory...", "path", absTmpDir)
 	// Attempt to remove existing contents first. Log error but continue.
 	if err := os.RemoveAll(absTmpDir); err != nil {
@@ -294,6 +1039,30 @@ func prepareTmpDir(ctx context.Context, tmpDir string, logger *slog.Logger) (str
 	return absTmpDir, nil
 }
 
+// isUnrepairable reports whether retrying a failed repair cannot help, as the
+// NZB has no par2 files or too few recovery blocks.
+func isUnrepairable(err error) bool {
+	return errors.Is(err, repairnzb.ErrNoPar2) || errors.Is(err, repairnzb.ErrTooDamaged)
+}
+
+// postRejection classifies a repair that failed because the upload providers
+// turned its articles down: "posting_not_allowed" (NNTP 440), "post_rejected"
+// (NNTP 441) or "article_too_large". It is empty for other failures. A retry
+// would post the same articles to the same providers, so these jobs are not
+// retried.
+func postRejection(err error) string {
+	switch {
+	case errors.Is(err, repairnzb.ErrPostingNotAllowed):
+		return "posting_not_allowed"
+	case errors.Is(err, repairnzb.ErrPostRejected):
+		return "post_rejected"
+	case errors.Is(err, repairnzb.ErrArticleTooLarge):
+		return "article_too_large"
+	}
+
+	return ""
+}
+
 // ensurePar2Executable checks if a par2 executable is configured, downloads one if necessary,
 // and returns the final path to the executable.
 func ensurePar2Executable(ctx context.Context, cfg config.Config, logger *slog.Logger) (string, error) {
@@ -361,29 +1130,263 @@ func toNNTPProvider(p config.ProviderConfig) nntppool.Provider {
 }
 
 // createPools initializes and returns the NNTP connection pools.
-func createPools(ctx context.Context, cfg config.Config) (uploadPool, downloadPool *nntppool.Client, err error) {
-	uploadProviders := make([]nntppool.Provider, len(cfg.UploadProviders))
-	for i, p := range cfg.UploadProviders {
-		uploadProviders[i] = toNNTPProvider(p)
+// Download providers are grouped by tier, with one client per tier, so higher
+// tiers are only used once all lower tiers miss an article.
+func createPools(ctx context.Context, cfg config.Config, opts poolOptions) (uploadPool, downloadPool repairnzb.NNTPPool, err error) {
+	uploadPool, err = createUploadPool(ctx, cfg.UploadProviders, opts)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	uploadPool, err = nntppool.NewClient(ctx, uploadProviders)
+	downloadPool, err = createDownloadPool(ctx, cfg.DownloadProviders, opts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create upload pool: %w", err)
+		_ = uploadPool.Close()
+		return nil, nil, err
+	}
+
+	return uploadPool, downloadPool, nil
+}
+
+// newConnLimiter returns the limiter for max_total_connections, or nil when
+// connections are not capped.
+func newConnLimiter(ctx context.Context, cfg config.Config, logger *slog.Logger) *pools.ConnLimiter {
+	limiter := pools.NewConnLimiter(cfg.MaxTotalConnections)
+	if limiter == nil {
+		return nil
+	}
+
+	configured := 0
+	for _, p := range cfg.DownloadProviders {
+		configured += p.Connections
+	}
+	for _, p := range cfg.UploadProviders {
+		configured += p.Connections
+	}
+
+	if configured > limiter.Max() {
+		logger.InfoContext(ctx, "Provider connections exceed max_total_connections, pools share the cap",
+			"configured", configured, "max_total_connections", limiter.Max())
+	}
+
+	return limiter
+}
+
+// poolOptions are the settings shared by every pool created by createPools and
+// createDownloadPool. The zero value creates plain pools.
+type poolOptions struct {
+	// meter, when not nil, accounts the transferred bytes of every provider.
+	meter *pools.UsageMeter
+	// limiter, when not nil, caps the connections of all pools together.
+	limiter *pools.ConnLimiter
+	// warmer, when not nil, opens connections of new pools ahead of use.
+	warmer *pools.Warmer
+	// cache, when not nil, serves downloads from the article cache.
+	cache *pools.ArticleCache
+	// idleClose is how long pools created by lazily stay open unused.
+	idleClose time.Duration
+	// meterKey, when not empty, registers the download tiers in meter under
+	// keys derived from it, replacing the tiers of the previous pool with it.
+	meterKey string
+}
+
+// poolCreator creates a pool for providers, like createDownloadPool.
+type poolCreator func(ctx context.Context, providers []config.ProviderConfig, opts poolOptions) (repairnzb.NNTPPool, error)
+
+// provider converts p to a nntppool provider dialing with the pool options.
+func (o poolOptions) provider(p config.ProviderConfig) nntppool.Provider {
+	np := toNNTPProvider(p)
+	if p.Compress {
+		np = o.meter.Compress(p.DisplayName(), np)
+	}
+
+	return o.limiter.Provider(np)
+}
+
+// createUploadPool creates one client posting through all providers. Providers
+// with different date policies or posts limits get a client each, and the
+// posts are spread between them by their connections.
+func createUploadPool(ctx context.Context, providers []config.ProviderConfig, opts poolOptions) (repairnzb.NNTPPool, error) {
+	for _, p := range providers {
+		if err := validateDatePolicy(p); err != nil {
+			return nil, err
+		}
+
+		if err := validatePostingLimits(p); err != nil {
+			return nil, err
+		}
 	}
 
-	downloadProviders := make([]nntppool.Provider, len(cfg.DownloadProviders))
-	for i, p := range cfg.DownloadProviders {
-		downloadProviders[i] = toNNTPProvider(p)
+	groups := postingGroups(providers)
+	if len(groups) == 0 {
+		return nil, errors.New("failed to create upload pool: no upload providers configured")
 	}
 
-	downloadPool, err = nntppool.NewClient(ctx, downloadProviders)
+	groupPools := make([]repairnzb.NNTPPool, 0, len(groups))
+	weights := make([]int, 0, len(groups))
+	for _, group := range groups {
+		uploadProviders := make([]nntppool.Provider, len(group))
+		connections := 0
+		for i, p := range group {
+			uploadProviders[i] = opts.provider(p)
+			connections += p.Connections
+		}
+
+		uploadClient, err := nntppool.NewClient(ctx, uploadProviders)
+		if err != nil {
+			for _, created := range groupPools {
+				_ = created.Close()
+			}
+			return nil, fmt.Errorf("failed to create upload pool: %w", err)
+		}
+
+		opts.warmer.Add(ctx, "upload", uploadClient)
+
+		groupPools = append(groupPools, postingPool(uploadClient, group))
+		weights = append(weights, connections)
+	}
+
+	var uploadPool repairnzb.NNTPPool
+	if len(groupPools) == 1 {
+		uploadPool = groupPools[0]
+	} else {
+		uploadPool = pools.NewSpread(groupPools, weights)
+	}
+
+	if opts.meter != nil {
+		return opts.meter.CountUploads(uploadPool, uploadShares(providers)), nil
+	}
+
+	return uploadPool, nil
+}
+
+// lazyPools numbers the pools created by lazily.
+var lazyPools atomic.Int64
+
+// lazily returns a creator of pools like create that only hold their
+// connections while used: the pool is created on the first request and closed
+// after opts.idleClose without requests. Pools created this way are not warmed
+// up, which would keep them open. The providers are checked right away.
+//
+// The pool stays open when opts.idleClose <= 0 or a provider has a quota, as a
+// new pool would count the quota from zero again.
+func lazily(create poolCreator) poolCreator {
+	return func(ctx context.Context, providers []config.ProviderConfig, opts poolOptions) (repairnzb.NNTPPool, error) {
+		opts.warmer = nil
+		if opts.idleClose <= 0 || slices.ContainsFunc(providers, func(p config.ProviderConfig) bool { return p.QuotaBytes > 0 }) {
+			return create(ctx, providers, opts)
+		}
+
+		opts.meterKey = fmt.Sprintf("lazy%d", lazyPools.Add(1))
+		checked, err := create(ctx, providers, opts)
+		if err != nil {
+			return nil, err
+		}
+		_ = checked.Close()
+
+		return pools.NewLazy(ctx, func(ctx context.Context) (repairnzb.NNTPPool, error) {
+			return create(ctx, providers, opts)
+		}, opts.idleClose), nil
+	}
+}
+
+// watcherPoolCreators returns the creators of the download and upload pools of
+// the watcher. Upload pools are created lazily, download pools too unless they
+// are warmed up.
+func watcherPoolCreators(opts poolOptions) (download, upload poolCreator) {
+	download = createDownloadPool
+	if opts.warmer == nil {
+		download = lazily(createDownloadPool)
+	}
+
+	return download, lazily(createUploadPool)
+}
+
+// createDownloadPool creates one client per provider tier, consulted in tier
+// order. Only the first tier is warmed up, as higher tiers are rarely used.
+func createDownloadPool(ctx context.Context, providers []config.ProviderConfig, opts poolOptions) (repairnzb.NNTPPool, error) {
+	tiers := config.Config{DownloadProviders: providers}.DownloadTiers()
+	tierPools := make([]repairnzb.NNTPPool, 0, len(tiers))
+	for t, tier := range tiers {
+		downloadProviders := make([]nntppool.Provider, len(tier))
+		names := make(map[string]string, len(tier))
+		for i, p := range tier {
+			downloadProviders[i] = opts.provider(p)
+			names[nntpProviderName(downloadProviders[i])] = p.DisplayName()
+		}
+
+		tierClient, err := nntppool.NewClient(ctx, downloadProviders)
+		if err != nil {
+			for _, created := range tierPools {
+				_ = created.Close()
+			}
+			return nil, fmt.Errorf("failed to create download pool for tier %d: %w", tier[0].Tier, err)
+		}
+
+		switch {
+		case opts.meter != nil && opts.meterKey != "":
+			opts.meter.SetDownloadSource(opts.meterKey+"/"+strconv.Itoa(t), tierClient, names)
+		case opts.meter != nil:
+			opts.meter.AddDownloadSource(tierClient, names)
+		}
+
+		if len(tierPools) == 0 {
+			opts.warmer.Add(ctx, "download", tierClient)
+		}
+
+		tierPools = append(tierPools, tierClient)
+	}
+
+	return opts.cache.Wrap(pools.NewTiered(tierPools...)), nil
+}
+
+// newArticleCache opens the article cache of cfg, nil when it is disabled.
+func newArticleCache(ctx context.Context, cfg config.Config, logger *slog.Logger) (*pools.ArticleCache, error) {
+	cache, err := pools.NewArticleCache(cfg.ArticleCache.Dir, int64(cfg.ArticleCache.MaxSizeGB*(1<<30)))
 	if err != nil {
-		_ = uploadPool.Close()
-		return nil, nil, fmt.Errorf("failed to create download pool: %w", err)
+		return nil, err
 	}
 
-	return uploadPool, downloadPool, nil
+	if cache != nil {
+		logger.InfoContext(ctx, "Using article cache", "dir", cfg.ArticleCache.Dir, "size", cache.Size(), "max_size_gb", cfg.ArticleCache.MaxSizeGB)
+	}
+
+	return cache, nil
+}
+
+// logArticleCacheStats logs how many downloads the article cache served.
+func logArticleCacheStats(ctx context.Context, cache *pools.ArticleCache, logger *slog.Logger) {
+	if cache == nil {
+		return
+	}
+
+	hits, misses := cache.Stats()
+	logger.InfoContext(ctx, "Article cache usage", "hits", hits, "misses", misses, "size", cache.Size())
+}
+
+// nntpProviderName mirrors the name nntppool assigns to a provider in its stats.
+func nntpProviderName(p nntppool.Provider) string {
+	if p.Auth.Username != "" {
+		return p.Host + "+" + p.Auth.Username
+	}
+
+	return p.Host
+}
+
+// uploadShares splits uploaded bytes between upload providers by connection count.
+func uploadShares(providers []config.ProviderConfig) map[string]float64 {
+	total := 0
+	for _, p := range providers {
+		total += p.Connections
+	}
+
+	shares := make(map[string]float64, len(providers))
+	for _, p := range providers {
+		if total > 0 {
+			shares[p.DisplayName()] += float64(p.Connections) / float64(total)
+		}
+	}
+
+	return shares
 }
 
 // getSingleOutputFilePath determines the output path for a single file repair.
@@ -429,12 +1432,22 @@ func getSingleOutputFilePath(inputFile string, outputFileOrDir string) (string,
 }
 
 // calculateJobOutputPath determines the final path for a repaired file within the watcher's output directory.
+// The path mirrors the job's relative path, or follows outputTemplate when set.
 // It ensures the relative path is safe and creates necessary subdirectories.
-func calculateJobOutputPath(outputBaseDir string, job *queue.Job, logger *slog.Logger, gCtx context.Context, dbQueue *queue.Queue) (string, error) {
+func calculateJobOutputPath(outputBaseDir, outputTemplate string, job *queue.Job, logger *slog.Logger, gCtx context.Context, dbQueue *queue.Queue) (string, error) {
+	relativePath := job.RelativePath
+	if outputTemplate != "" {
+		nzb, err := parseNzbFile(job.FilePath)
+		if err != nil {
+			logger.WarnContext(gCtx, "Failed to read nzb meta for output template, using job metadata only", "job_id", job.ID, "error", err)
+		}
+		relativePath = renderOutputTemplate(outputTemplate, jobTemplateVars(job, nzb))
+	}
+
 	// Clean the relative path to prevent path traversal issues (e.g., ../../..)
-	cleanRelativePath := filepath.Clean(job.RelativePath)
+	cleanRelativePath := filepath.Clean(relativePath)
 	if strings.HasPrefix(cleanRelativePath, "..") || cleanRelativePath == "." || cleanRelativePath == "" || filepath.IsAbs(cleanRelativePath) {
-		errMsg := fmt.Sprintf("invalid relative path calculated: %q", job.RelativePath)
+		errMsg := fmt.Sprintf("invalid relative path calculated: %q", relativePath)
 		logger.ErrorContext(gCtx, errMsg, "job_id", job.ID)
 		if uerr := dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, errMsg); uerr != nil {
 			logger.ErrorContext(gCtx, "Failed to update job status to failed after invalid relative path error", "job_id", job.ID, "update_error", uerr)
@@ -458,3 +1471,17 @@ func calculateJobOutputPath(outputBaseDir string, job *queue.Job, logger *slog.L
 
 	return outputFilePath, nil
 }
+
+// applyHookPriority stores the priority requested by a hook directive, if any.
+func applyHookPriority(ctx context.Context, dbQueue *queue.Queue, job *queue.Job, d hooks.Directive, logger *slog.Logger) {
+	if d.Priority == nil || *d.Priority == job.Priority {
+		return
+	}
+
+	if err := dbQueue.SetJobPriority(job.ID, *d.Priority); err != nil {
+		logger.ErrorContext(ctx, "Failed to update job priority", "job_id", job.ID, "error", err)
+		return
+	}
+
+	job.Priority = *d.Priority
+}
@@ -0,0 +1,382 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// Batch statuses of a repaired NZB.
+const (
+	batchHealthy     = "healthy"
+	batchRepaired    = "repaired"
+	batchNotUploaded = "not uploaded"
+	batchFailed      = "failed"
+)
+
+// batchResult is the outcome of one NZB of a batch.
+type batchResult struct {
+	File     string
+	Status   string
+	Broken   int
+	Replaced int
+	Output   string
+	Duration time.Duration
+	Err      error
+}
+
+// RunBatch repairs every NZB matched by patterns, watch_workers at a time
+// with shared pools, and prints a summary of the outcome of each to w. It
+// fails when any NZB failed.
+func RunBatch(ctx context.Context, cfg config.Config, patterns []string, outputDir string, tmpDir string, verbose bool, w io.Writer) (err error) {
+	logger := setupLogging(verbose)
+
+	if err := validateOutputConflict(cfg.OutputConflict); err != nil {
+		return err
+	}
+
+	if err := validateFailureMode(cfg.FailureMode); err != nil {
+		return err
+	}
+
+	if err := repairnzb.ValidateSubjectTemplate(cfg.Upload.SubjectTemplate); err != nil {
+		return err
+	}
+
+	if err := validatePar2Recreate(cfg); err != nil {
+		return err
+	}
+
+	if cfg.BundleDir != "" {
+		return errors.New("bundle_dir is not supported by batch repairs")
+	}
+
+	if outputDir != "" {
+		if cfg.InPlace.Enabled {
+			return errors.New("--in-place cannot be combined with an output path")
+		}
+
+		if info, err := os.Stat(outputDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("output path %q of a batch must be an existing directory", outputDir)
+		}
+	}
+
+	if cfg.InPlace.Enabled {
+		// The temporary file must be replaced, never versioned.
+		cfg.OutputConflict = repairnzb.OutputConflictOverwrite
+	}
+
+	files, err := expandNzbPatterns(patterns)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newOutputSink(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid output sink: %w", err)
+	}
+
+	started := time.Now()
+	usageMeter := pools.NewUsageMeter()
+	defer func() {
+		exportRunMetrics(ctx, cfg, usageMeter, started, err, logger)
+	}()
+
+	absTmpDir, err := createTmpDir(tmpDir)
+	if err != nil {
+		return fmt.Errorf("failed to prepare temporary directory: %w", err)
+	}
+
+	// The batch works below a directory of its own, so a watcher sharing the
+	// tmp dir does not take its job directories for stale ones.
+	batchTmpDir := filepath.Join(absTmpDir, fmt.Sprintf("batch-%d", os.Getpid()))
+	// A batch is not queued, so its downloads are never resumed.
+	jobDirs := newJobTmpDirs(batchTmpDir, 0, nil)
+	defer func() {
+		if cfg.KeepTmpOnFailure {
+			return
+		}
+
+		if err := os.RemoveAll(batchTmpDir); err != nil {
+			logger.WarnContext(ctx, "Failed to clean up batch temporary directory", "path", batchTmpDir, "error", err)
+		}
+	}()
+
+	par2ExePath, err := ensurePar2Executable(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to ensure par2 executable: %w", err)
+	}
+	par2Executor := &repairnzb.Par2CmdExecutor{ExePath: par2ExePath}
+
+	cache, err := newArticleCache(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer logArticleCacheStats(ctx, cache, logger)
+
+	poolOpts := poolOptions{
+		meter:   usageMeter,
+		limiter: newConnLimiter(ctx, cfg, logger),
+		warmer:  pools.NewWarmer(cfg.Pool.WarmupConnections, logger),
+		cache:   cache,
+	}
+	uploadPool, downloadPool, err := createPools(ctx, cfg, poolOpts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		logger.DebugContext(ctx, "Closing download pool")
+		_ = downloadPool.Close()
+		logger.DebugContext(ctx, "Closing upload pool")
+		_ = uploadPool.Close()
+	}()
+
+	logger.InfoContext(ctx, "Starting batch repair", "nzbs", len(files), "workers", cfg.WatchWorkers)
+
+	results := make([]batchResult, len(files))
+	queued := make(chan int)
+	var wg sync.WaitGroup
+	for range max(cfg.WatchWorkers, 1) {
+		wg.Go(func() {
+			for i := range queued {
+				results[i] = repairBatchNzb(ctx, cfg, downloadPool, uploadPool, par2Executor, sink, jobDirs, int64(i+1), files[i], outputDir, logger)
+			}
+		})
+	}
+
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		queued <- i
+	}
+	close(queued)
+	wg.Wait()
+
+	for i := range results {
+		if results[i].Status == "" {
+			results[i] = batchResult{File: files[i], Status: batchFailed, Err: context.Cause(ctx)}
+		}
+	}
+
+	return writeBatchSummary(w, results, time.Since(started))
+}
+
+// repairBatchNzb repairs one NZB of a batch in the job directory of id.
+func repairBatchNzb(
+	ctx context.Context,
+	cfg config.Config,
+	downloadPool, uploadPool repairnzb.NNTPPool,
+	par2Executor repairnzb.Par2Executor,
+	sink repairnzb.OutputSink,
+	jobDirs *jobTmpDirs,
+	id int64,
+	nzbFile, outputDir string,
+	logger *slog.Logger,
+) batchResult {
+	started := time.Now()
+	res := batchResult{File: nzbFile}
+	fail := func(err error) batchResult {
+		logger.ErrorContext(ctx, "Repair failed", "input", nzbFile, "error", err)
+		res.Status, res.Err, res.Duration = batchFailed, err, time.Since(started)
+		return res
+	}
+
+	outputFile, err := getSingleOutputFilePath(nzbFile, outputDir)
+	if err != nil {
+		return fail(fmt.Errorf("failed to determine output file path: %w", err))
+	}
+	if cfg.InPlace.Enabled {
+		outputFile = inPlaceTempPath(nzbFile)
+	}
+
+	logger.InfoContext(ctx, "Starting repair", "input", nzbFile, "output", outputFile)
+	jobTmpDir := jobDirs.acquire(id)
+	result, err := repairnzb.RepairNzb(ctx, cfg, downloadPool, uploadPool, par2Executor, nzbFile, outputFile, jobTmpDir, repairnzb.WithOutputSink(sink))
+	if kept, releaseErr := jobDirs.release(id, err != nil && cfg.KeepTmpOnFailure); releaseErr != nil {
+		logger.WarnContext(ctx, "Failed to clean up job temporary directory", "input", nzbFile, "path", jobTmpDir, "error", releaseErr)
+	} else if kept != "" {
+		logger.InfoContext(ctx, "Kept temporary directory of failed repair", "input", nzbFile, "path", kept)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	res.Broken, res.Replaced = result.BrokenSegments, result.SegmentsReplaced
+	switch {
+	case result.Healthy:
+		res.Status = batchHealthy
+	case result.NotUploaded:
+		res.Status = batchNotUploaded
+	default:
+		if err := completeOutput(ctx, cfg, nzbFile, result, logger); err != nil {
+			return fail(err)
+		}
+		res.Status, res.Output = batchRepaired, result.OutputPath
+	}
+	res.Duration = time.Since(started)
+
+	logger.InfoContext(ctx, "Repair finished", "input", nzbFile, "status", res.Status, "output", res.Output)
+
+	return res
+}
+
+// writeBatchSummary prints a row per NZB and the totals, and returns an
+// error when any NZB failed.
+func writeBatchSummary(w io.Writer, results []batchResult, took time.Duration) error {
+	counts := make(map[string]int)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tSTATUS\tBROKEN\tREPLACED\tDURATION\tDETAIL")
+	for _, r := range results {
+		counts[r.Status]++
+		detail := r.Output
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", r.File, r.Status, r.Broken, r.Replaced, r.Duration.Round(time.Second), detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "%d nzbs in %s: %d repaired, %d healthy, %d not uploaded, %d failed\n",
+		len(results), took.Round(time.Second), counts[batchRepaired], counts[batchHealthy], counts[batchNotUploaded], counts[batchFailed])
+
+	if counts[batchFailed] > 0 {
+		return fmt.Errorf("%d of %d nzbs failed", counts[batchFailed], len(results))
+	}
+
+	return nil
+}
+
+// expandNzbPatterns returns the files matched by patterns, deduplicated and
+// sorted. A directory stands for every NZB below it, and ** in a pattern
+// matches any number of directories.
+func expandNzbPatterns(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		var matches []string
+		info, statErr := os.Stat(pattern)
+		switch {
+		case statErr == nil && info.IsDir():
+			found, err := findNzbs(pattern)
+			if err != nil {
+				return nil, err
+			}
+			matches = found
+		case statErr == nil:
+			matches = []string{pattern}
+		case strings.Contains(pattern, "**"):
+			found, err := globRecursive(pattern)
+			if err != nil {
+				return nil, err
+			}
+			matches = found
+		default:
+			found, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			matches = found
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no nzb matches %q", pattern)
+		}
+
+		for _, m := range matches {
+			abs, err := filepath.Abs(m)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, abs)
+		}
+	}
+
+	slices.Sort(files)
+
+	return slices.Compact(files), nil
+}
+
+// globRecursive returns the files matching pattern, whose ** segments match
+// any number of directories.
+func globRecursive(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	if _, err := path.Match(strings.Join(segments, "/"), ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	// The walk starts at the directory before the first wildcard.
+	static := 0
+	for static < len(segments) && !strings.ContainsAny(segments[static], `*?[\`) {
+		static++
+	}
+	root := filepath.FromSlash(strings.Join(segments[:static], "/"))
+	switch {
+	case root == "" && strings.HasPrefix(filepath.ToSlash(pattern), "/"):
+		root = string(filepath.Separator)
+	case root == "":
+		root = "."
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return fs.SkipAll
+			}
+			return err
+		}
+
+		if !d.IsDir() && matchSegments(segments, strings.Split(filepath.ToSlash(p), "/")) {
+			matches = append(matches, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand %q: %w", pattern, err)
+	}
+
+	return matches, nil
+}
+
+// matchSegments reports whether the path segments of name match those of
+// pattern, where a ** segment matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], name[0])
+
+	return ok && matchSegments(pattern[1:], name[1:])
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandNzbPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.nzb", "sub/b.nzb", "sub/deep/c.nzb", "sub/notes.txt", "other/d.nzb"} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, nil, 0644))
+	}
+	abs := func(names ...string) []string {
+		paths := make([]string, len(names))
+		for i, n := range names {
+			paths[i] = filepath.Join(dir, n)
+		}
+		return paths
+	}
+
+	files, err := expandNzbPatterns([]string{filepath.Join(dir, "sub", "**", "*.nzb")})
+	require.NoError(t, err)
+	assert.Equal(t, abs("sub/b.nzb", "sub/deep/c.nzb"), files, "** matches no directory too")
+
+	files, err = expandNzbPatterns([]string{filepath.Join(dir, "*.nzb"), filepath.Join(dir, "other"), filepath.Join(dir, "a.nzb")})
+	require.NoError(t, err)
+	assert.Equal(t, abs("a.nzb", "other/d.nzb"), files, "directories are searched and duplicates dropped")
+
+	_, err = expandNzbPatterns([]string{filepath.Join(dir, "**", "*.par2")})
+	assert.ErrorContains(t, err, "no nzb matches")
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"dir/**/*.nzb", "dir/a.nzb", true},
+		{"dir/**/*.nzb", "dir/x/y/a.nzb", true},
+		{"dir/**/*.nzb", "other/a.nzb", false},
+		{"dir/**", "dir/x/a.nzb", true},
+		{"dir/*/a.nzb", "dir/x/y/a.nzb", false},
+	}
+
+	for _, tt := range tests {
+		got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.name, "/"))
+		assert.Equal(t, tt.want, got, "%s ~ %s", tt.pattern, tt.name)
+	}
+}
+
+func TestWriteBatchSummary(t *testing.T) {
+	var out bytes.Buffer
+	err := writeBatchSummary(&out, []batchResult{
+		{File: "a.nzb", Status: batchRepaired, Broken: 3, Replaced: 3, Output: "a_repaired.nzb"},
+		{File: "b.nzb", Status: batchHealthy},
+		{File: "c.nzb", Status: batchFailed, Err: errors.New("no par2 files")},
+	}, 0)
+
+	assert.EqualError(t, err, "1 of 3 nzbs failed")
+	assert.Contains(t, out.String(), "a_repaired.nzb")
+	assert.Contains(t, out.String(), "no par2 files")
+	assert.Contains(t, out.String(), "3 nzbs in 0s: 1 repaired, 1 healthy, 0 not uploaded, 1 failed")
+}
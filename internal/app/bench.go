@@ -0,0 +1,318 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	benchSegmentsDefault = 100
+	benchSizeMBDefault   = 256
+	benchPar2Files       = 4
+)
+
+// BenchOptions are the flags of the bench command.
+type BenchOptions struct {
+	// NzbFile supplies the articles for the download benchmark. Without it the
+	// download benchmark is skipped.
+	NzbFile string
+	// Segments is the number of articles downloaded from every provider.
+	Segments int
+	// SizeMB is the amount of synthetic data used by the yEnc, disk and par2
+	// benchmarks.
+	SizeMB int
+	// JSON prints the results as JSON instead of a table.
+	JSON bool
+}
+
+// benchResult is the outcome of one benchmark.
+type benchResult struct {
+	Name           string  `json:"name"`
+	Bytes          int64   `json:"bytes"`
+	Seconds        float64 `json:"seconds"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	Note           string  `json:"note,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+func newBenchResult(name string, n int64, d time.Duration, err error) benchResult {
+	r := benchResult{Name: name, Bytes: n, Seconds: d.Seconds()}
+	if d > 0 {
+		r.BytesPerSecond = float64(n) / d.Seconds()
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+// RunBench measures the NNTP download throughput of every download provider,
+// yEnc decode speed, disk write throughput to tmpDir and par2 speed on a
+// synthetic set, to help size worker and connection counts.
+func RunBench(ctx context.Context, cfg config.Config, tmpDir string, opts BenchOptions, w io.Writer) error {
+	if opts.Segments <= 0 {
+		opts.Segments = benchSegmentsDefault
+	}
+
+	if opts.SizeMB <= 0 {
+		opts.SizeMB = benchSizeMBDefault
+	}
+
+	if err := os.MkdirAll(tmpDir, 0750); err != nil {
+		return fmt.Errorf("failed to create temporary directory %q: %w", tmpDir, err)
+	}
+
+	benchDir, err := os.MkdirTemp(tmpDir, "nzb-repair-bench-")
+	if err != nil {
+		return fmt.Errorf("failed to create benchmark directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(benchDir)
+	}()
+
+	var results []benchResult
+
+	if opts.NzbFile != "" {
+		segments, err := benchSegments(opts.NzbFile, opts.Segments)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range cfg.DownloadProviders {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			results = append(results, benchProvider(ctx, p, segments))
+		}
+	}
+
+	data := make([]byte, opts.SizeMB<<20)
+	_, _ = rand.Read(data)
+
+	results = append(results,
+		benchYencDecode(data),
+		benchDiskWrite(filepath.Join(benchDir, "disk.bin"), data),
+	)
+
+	par2ExePath, err := ensurePar2Executable(ctx, cfg, slog.Default())
+	if err != nil {
+		results = append(results, newBenchResult("par2 create", 0, 0, err))
+	} else {
+		par2Executor := &repairnzb.Par2CmdExecutor{ExePath: par2ExePath}
+		results = append(results, benchPar2(ctx, par2Executor, filepath.Join(benchDir, "par2"), data, cfg.Par2RecreateRedundancy))
+	}
+
+	if opts.JSON {
+		return writeJSON(w, results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "BENCHMARK\tSIZE\tTIME\tTHROUGHPUT\tNOTE")
+	for _, r := range results {
+		note := r.Note
+		if r.Error != "" {
+			note = "error: " + r.Error
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s/s\t%s\n",
+			r.Name,
+			formatBytes(r.Bytes),
+			time.Duration(r.Seconds*float64(time.Second)).Round(time.Millisecond),
+			formatBytes(int64(r.BytesPerSecond)),
+			note,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// benchSegments returns up to limit article IDs from the NZB at path.
+func benchSegments(path string, limit int) ([]nzbparser.NzbSegment, error) {
+	nzb, err := parseNzbFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []nzbparser.NzbSegment
+	for _, file := range nzb.Files {
+		for _, s := range file.Segments {
+			if len(segments) == limit {
+				return segments, nil
+			}
+
+			segments = append(segments, s)
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.New("nzb has no segments")
+	}
+
+	return segments, nil
+}
+
+// benchProvider downloads segments from a single provider using all of its
+// connections.
+func benchProvider(ctx context.Context, p config.ProviderConfig, segments []nzbparser.NzbSegment) benchResult {
+	name := "download " + p.DisplayName()
+
+	pool, err := createDownloadPool(ctx, []config.ProviderConfig{p}, poolOptions{})
+	if err != nil {
+		return newBenchResult(name, 0, 0, err)
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	n, missing, d, err := benchDownload(ctx, pool, segments, p.Connections)
+	r := newBenchResult(name, n, d, err)
+	r.Note = fmt.Sprintf("%d articles, %d connections", len(segments), p.Connections)
+	if missing > 0 {
+		r.Note += fmt.Sprintf(", %d missing", missing)
+	}
+
+	return r
+}
+
+// benchDownload fetches segments from pool with the given concurrency and
+// returns the downloaded bytes, the number of missing articles and the time
+// it took.
+func benchDownload(ctx context.Context, pool repairnzb.NNTPPool, segments []nzbparser.NzbSegment, workers int) (int64, int64, time.Duration, error) {
+	var downloaded, missing atomic.Int64
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(max(workers, 1))
+
+	started := time.Now()
+	for _, s := range segments {
+		eg.Go(func() error {
+			cw := &countingWriter{n: &downloaded}
+			if _, err := pool.BodyStream(egCtx, s.Id, cw); err != nil {
+				if errors.Is(err, nntppool.ErrArticleNotFound) {
+					missing.Add(1)
+					return nil
+				}
+
+				return fmt.Errorf("failed to download %s: %w", s.Id, err)
+			}
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+
+	return downloaded.Load(), missing.Load(), time.Since(started), err
+}
+
+// countingWriter discards what is written to it while counting the bytes.
+type countingWriter struct {
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// benchYencDecode measures decoding a yEnc encoded copy of data.
+func benchYencDecode(data []byte) benchResult {
+	const name = "yenc decode"
+
+	var encoded bytes.Buffer
+	enc, err := rapidyenc.NewEncoder(&encoded, rapidyenc.Meta{
+		FileName:   "bench.bin",
+		FileSize:   int64(len(data)),
+		PartNumber: 1,
+		TotalParts: 1,
+		PartSize:   int64(len(data)),
+	})
+	if err != nil {
+		return newBenchResult(name, 0, 0, err)
+	}
+
+	if _, err := enc.Write(data); err != nil {
+		return newBenchResult(name, 0, 0, err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return newBenchResult(name, 0, 0, err)
+	}
+
+	started := time.Now()
+	n, err := io.Copy(io.Discard, rapidyenc.NewDecoder(&encoded))
+
+	return newBenchResult(name, n, time.Since(started), err)
+}
+
+// benchDiskWrite measures writing data to path, including the final fsync.
+func benchDiskWrite(path string, data []byte) benchResult {
+	const name = "disk write"
+
+	started := time.Now()
+	n, err := writeSynced(path, data)
+
+	return newBenchResult(name, n, time.Since(started), err)
+}
+
+func writeSynced(path string, data []byte) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return int64(n), err
+}
+
+// benchPar2 measures creating a par2 set for data split into a few files.
+func benchPar2(ctx context.Context, par2Executor repairnzb.Par2Executor, dir string, data []byte, redundancy int) benchResult {
+	const name = "par2 create"
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return newBenchResult(name, 0, 0, err)
+	}
+
+	chunk := (len(data) + benchPar2Files - 1) / benchPar2Files
+	for i := range benchPar2Files {
+		part := data[min(i*chunk, len(data)):min((i+1)*chunk, len(data))]
+		if _, err := writeSynced(filepath.Join(dir, fmt.Sprintf("bench.%03d", i+1)), part); err != nil {
+			return newBenchResult(name, 0, 0, err)
+		}
+	}
+
+	started := time.Now()
+	_, err := par2Executor.Create(ctx, dir, redundancy, 0, 0)
+	r := newBenchResult(name, int64(len(data)), time.Since(started), err)
+	r.Note = fmt.Sprintf("%d%% redundancy", redundancy)
+
+	return r
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/javi11/nzb-repair/internal/mocks"
+)
+
+func TestBenchDownload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	pool.EXPECT().BodyStream(gomock.Any(), "a@test", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(make([]byte, 1000))
+			return &nntppool.ArticleBody{}, err
+		})
+	pool.EXPECT().BodyStream(gomock.Any(), "b@test", gomock.Any()).
+		Return(nil, nntppool.ErrArticleNotFound)
+
+	segments := []nzbparser.NzbSegment{{Id: "a@test"}, {Id: "b@test"}}
+	n, missing, _, err := benchDownload(context.Background(), pool, segments, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), n)
+	assert.Equal(t, int64(1), missing)
+}
+
+func TestBenchYencDecodeAndDiskWrite(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	decode := benchYencDecode(data)
+	assert.Empty(t, decode.Error)
+	assert.Equal(t, int64(len(data)), decode.Bytes)
+
+	disk := benchDiskWrite(filepath.Join(t.TempDir(), "disk.bin"), data)
+	assert.Empty(t, disk.Error)
+	assert.Equal(t, int64(len(data)), disk.Bytes)
+}
+
+func TestBenchPar2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	executor := mocks.NewMockPar2Executor(ctrl)
+
+	dir := filepath.Join(t.TempDir(), "par2")
+	executor.EXPECT().Create(gomock.Any(), dir, 10, 0, int64(0)).Return([]string{filepath.Join(dir, "repair.par2")}, nil)
+
+	r := benchPar2(context.Background(), executor, dir, make([]byte, 4096), 10)
+	assert.Empty(t, r.Error)
+	assert.Equal(t, int64(4096), r.Bytes)
+
+	files, err := filepath.Glob(filepath.Join(dir, "bench.*"))
+	require.NoError(t, err)
+	assert.Len(t, files, benchPar2Files)
+}
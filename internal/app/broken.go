@@ -0,0 +1,27 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// moveExhaustedJobs moves the files of the jobs that just failed and are out
+// of retries to the broken folder instead of leaving them for the next sweep
+// of the failed files mover. It returns the number of files moved.
+func moveExhaustedJobs(ctx context.Context, dbQueue *queue.Queue, jobs []*queue.Job, maxRetries int64, brokenFolder string, logger *slog.Logger) int64 {
+	var moved int64
+	for _, job := range jobs {
+		ok, err := dbQueue.MoveFailedJob(job.ID, maxRetries, brokenFolder)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to move failed file to broken folder", "job_id", job.ID, "error", err)
+			continue
+		}
+		if ok {
+			moved++
+		}
+	}
+
+	return moved
+}
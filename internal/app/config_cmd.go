@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// RunConfigEncryptSecrets encrypts the plaintext provider passwords of the
+// config file at path in place, using the master key from the environment.
+func RunConfigEncryptSecrets(path string, w io.Writer) error {
+	key, err := config.MasterKey()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	encrypted, n, err := config.EncryptSecrets(data, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secrets of %s: %w", path, err)
+	}
+
+	if n == 0 {
+		_, _ = fmt.Fprintf(w, "no plaintext passwords in %s\n", path)
+		return nil
+	}
+
+	// Replace the file atomically so an interrupted run cannot lose the config.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(encrypted); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	_, _ = fmt.Fprintf(w, "encrypted %d password(s) in %s\n", n, path)
+
+	return nil
+}
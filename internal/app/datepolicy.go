@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// validateDatePolicy rejects unknown date_policy values of upload provider p.
+func validateDatePolicy(p config.ProviderConfig) error {
+	switch p.DatePolicy {
+	case "", config.DatePolicyOriginal, config.DatePolicyNow:
+		return nil
+	case config.DatePolicyJitter:
+		if p.DateJitter < 0 {
+			return fmt.Errorf("upload provider %s: date_jitter must not be negative", p.DisplayName())
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("upload provider %s: unknown date_policy %q, expected original, now or jitter", p.DisplayName(), p.DatePolicy)
+}
+
+// postDate returns how the articles posted through p are dated, or nil when
+// they keep the date the repair gives them, the one of the replaced article.
+// A jittered date never lies in the future.
+func postDate(p config.ProviderConfig) func(time.Time) time.Time {
+	switch p.DatePolicy {
+	case config.DatePolicyNow:
+		return func(time.Time) time.Time {
+			return time.Now().UTC()
+		}
+	case config.DatePolicyJitter:
+		if p.DateJitter <= 0 {
+			return nil
+		}
+
+		return func(original time.Time) time.Time {
+			// A zero date is already the time of posting.
+			if original.IsZero() {
+				return original
+			}
+
+			return minTime(original.Add(rand.N(p.DateJitter)), time.Now().UTC())
+		}
+	}
+
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDatePolicy(t *testing.T) {
+	require.NoError(t, validateDatePolicy(config.ProviderConfig{}))
+	require.NoError(t, validateDatePolicy(config.ProviderConfig{DatePolicy: config.DatePolicyNow}))
+	require.NoError(t, validateDatePolicy(config.ProviderConfig{DatePolicy: config.DatePolicyJitter, DateJitter: time.Hour}))
+	require.Error(t, validateDatePolicy(config.ProviderConfig{DatePolicy: "yesterday"}))
+	require.Error(t, validateDatePolicy(config.ProviderConfig{DatePolicy: config.DatePolicyJitter, DateJitter: -time.Hour}))
+}
+
+func TestPostDate(t *testing.T) {
+	original := time.Now().UTC().Add(-48 * time.Hour)
+
+	assert.Nil(t, postDate(config.ProviderConfig{DatePolicy: config.DatePolicyOriginal}), "the original date is kept")
+
+	now := postDate(config.ProviderConfig{DatePolicy: config.DatePolicyNow})
+	assert.WithinDuration(t, time.Now(), now(original), time.Minute)
+
+	jitter := postDate(config.ProviderConfig{DatePolicy: config.DatePolicyJitter, DateJitter: time.Hour})
+	for range 20 {
+		date := jitter(original)
+		assert.False(t, date.Before(original))
+		assert.True(t, date.Before(original.Add(time.Hour)))
+	}
+	assert.True(t, jitter(time.Time{}).IsZero(), "an undated article is dated when posted")
+
+	recent := time.Now().UTC()
+	assert.False(t, jitter(recent).After(time.Now().UTC()), "a jittered date is never in the future")
+}
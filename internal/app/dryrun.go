@@ -0,0 +1,46 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// writeDryRunReport prints the broken segments of every damaged file of a
+// dry run and whether the release can be repaired.
+func writeDryRunReport(w io.Writer, nzbFile string, result *repairnzb.RepairResult) error {
+	_, _ = fmt.Fprintf(w, "dry run of %s: nothing was posted and no nzb was written\n", nzbFile)
+
+	if len(result.Damage) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "FILE\tBROKEN\tMISSING\tCORRUPT\tSEGMENTS")
+		for _, f := range result.Damage {
+			var missing, corrupt int
+			numbers := make([]string, 0, len(f.Segments))
+			for _, s := range f.Segments {
+				if s.Reason == repairnzb.DamageCRC {
+					corrupt++
+				} else {
+					missing++
+				}
+				numbers = append(numbers, strconv.Itoa(s.Number))
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", f.Filename, len(f.Segments), missing, corrupt, strings.Join(numbers, ","))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "checked %d segments: %d broken, %d corrupt\n", result.SegmentsChecked, result.BrokenSegments, result.CorruptSegments)
+	if result.Par2Recreate {
+		_, _ = fmt.Fprintln(w, "the par2 set would be recreated")
+	}
+	_, _ = fmt.Fprintf(w, "verdict: %s\n", result.Verdict)
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDryRunReport(t *testing.T) {
+	result := &repairnzb.RepairResult{
+		Verdict:         repairnzb.VerdictRepairable,
+		DryRun:          true,
+		SegmentsChecked: 100,
+		BrokenSegments:  3,
+		CorruptSegments: 1,
+		Par2Recreate:    true,
+		Damage: []repairnzb.FileDamage{{
+			Filename: "show.part01.rar",
+			Segments: []repairnzb.SegmentDamage{
+				{Number: 4, Reason: repairnzb.DamageMissing},
+				{Number: 9, Reason: repairnzb.DamageCRC},
+				{Number: 12, Reason: repairnzb.DamageMissing},
+			},
+		}},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, writeDryRunReport(&out, "show.nzb", result))
+
+	assert.Equal(t, `dry run of show.nzb: nothing was posted and no nzb was written
+FILE             BROKEN  MISSING  CORRUPT  SEGMENTS
+show.part01.rar  3       2        1        4,9,12
+checked 100 segments: 3 broken, 1 corrupt
+the par2 set would be recreated
+verdict: repairable
+`, out.String())
+}
+
+func TestWriteDryRunReport_Healthy(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, writeDryRunReport(&out, "show.nzb", &repairnzb.RepairResult{Verdict: repairnzb.VerdictHealthy, Healthy: true, SegmentsChecked: 10}))
+
+	assert.NotContains(t, out.String(), "FILE")
+	assert.Contains(t, out.String(), "verdict: healthy")
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"slices"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// etaSampleJobs is the number of recently finished jobs whose processing
+// times queue ETAs are estimated from.
+const etaSampleJobs = 50
+
+// queueEstimate is the estimated time until the processing and pending jobs
+// of the queue finish.
+type queueEstimate struct {
+	// jobs maps a job ID to the time until it finishes. Jobs without an
+	// estimate are missing.
+	jobs map[int64]time.Duration
+	// total is the time until the last job finishes, 0 when unknown.
+	total time.Duration
+	// throughput is the NZB bytes processed per second by a worker.
+	throughput float64
+}
+
+// estimateQueue estimates, from the throughput of recently finished jobs,
+// when the jobs of q finish when processed by workers in the configured
+// order.
+func estimateQueue(q *queue.Queue, workers int) (queueEstimate, error) {
+	t, err := q.Throughput(etaSampleJobs)
+	if err != nil {
+		return queueEstimate{}, err
+	}
+
+	processing, err := q.ListJobs(queue.StatusProcessing, 0)
+	if err != nil {
+		return queueEstimate{}, err
+	}
+
+	pending, err := q.ListPendingJobs()
+	if err != nil {
+		return queueEstimate{}, err
+	}
+
+	return estimate(t, processing, pending, workers, time.Now()), nil
+}
+
+// estimate simulates workers processing the remainder of the processing jobs,
+// then the pending jobs in order, each taking as long as t estimates. A
+// processing job that has already run longer than estimated has no estimate.
+func estimate(t queue.Throughput, processing, pending []*queue.Job, workers int, now time.Time) queueEstimate {
+	e := queueEstimate{jobs: make(map[int64]time.Duration), throughput: t.BytesPerSecond()}
+	if _, ok := t.Estimate(&queue.Job{}); !ok {
+		return e
+	}
+
+	// busy holds the time until each worker is free.
+	busy := make([]time.Duration, max(workers, 1))
+	next := func() int {
+		return slices.Index(busy, slices.Min(busy))
+	}
+
+	for _, job := range processing {
+		d, _ := t.Estimate(job)
+		if !job.StartedAt.IsZero() {
+			d -= now.Sub(job.StartedAt)
+		}
+		if d <= 0 {
+			continue
+		}
+
+		i := next()
+		busy[i] += d
+		e.jobs[job.ID] = busy[i]
+	}
+
+	for _, job := range pending {
+		d, _ := t.Estimate(job)
+
+		i := next()
+		busy[i] += d
+		e.jobs[job.ID] = busy[i]
+	}
+
+	e.total = slices.Max(busy)
+
+	return e
+}
+
+// formatETA renders an estimate rounded to the second, "-" when unknown.
+func formatETA(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+
+	return d.Round(time.Second).String()
+}
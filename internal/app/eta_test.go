@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestEstimate(t *testing.T) {
+	now := time.Now()
+	// 1 MB/s, 60s per job of unknown size
+	tp := queue.Throughput{Jobs: 2, Duration: 2 * time.Minute, SizedBytes: 60e6, SizedDuration: time.Minute}
+
+	processing := []*queue.Job{
+		{ID: 1, SizeBytes: 30e6, StartedAt: now.Add(-10 * time.Second)},
+		{ID: 2, SizeBytes: 10e6, StartedAt: now.Add(-time.Minute)}, // overdue
+	}
+	pending := []*queue.Job{
+		{ID: 3, SizeBytes: 5e6},
+		{ID: 4},
+		{ID: 5, SizeBytes: 20e6},
+	}
+
+	e := estimate(tp, processing, pending, 2, now)
+
+	assert.Equal(t, map[int64]time.Duration{
+		1: 20 * time.Second,
+		3: 5 * time.Second,
+		4: 65 * time.Second,
+		5: 40 * time.Second,
+	}, e.jobs)
+	assert.Equal(t, 65*time.Second, e.total)
+	assert.InDelta(t, 1e6, e.throughput, 0.001)
+}
+
+func TestEstimate_NoHistory(t *testing.T) {
+	e := estimate(queue.Throughput{}, nil, []*queue.Job{{ID: 1, SizeBytes: 1e6}}, 1, time.Now())
+
+	assert.Empty(t, e.jobs)
+	assert.Zero(t, e.total)
+}
+
+func TestFormatETA(t *testing.T) {
+	assert.Equal(t, "-", formatETA(0))
+	assert.Equal(t, "1h2m3s", formatETA(time.Hour+2*time.Minute+3*time.Second+400*time.Millisecond))
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// validateFailureMode rejects unknown failure_mode values.
+func validateFailureMode(mode string) error {
+	switch mode {
+	case repairnzb.FailureModeBestEffort, repairnzb.FailureModeStrict:
+		return nil
+	}
+
+	return fmt.Errorf("unknown failure_mode %q, expected best_effort or strict", mode)
+}
+
+// toleratedErrors joins the failures a best-effort repair went on despite,
+// empty when there were none.
+func toleratedErrors(result *repairnzb.RepairResult) string {
+	return strings.Join(result.Errors, "; ")
+}
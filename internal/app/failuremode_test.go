@@ -0,0 +1,19 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFailureMode(t *testing.T) {
+	assert.NoError(t, validateFailureMode("best_effort"))
+	assert.NoError(t, validateFailureMode("strict"))
+	assert.Error(t, validateFailureMode("lenient"))
+}
+
+func TestToleratedErrors(t *testing.T) {
+	assert.Empty(t, toleratedErrors(&repairnzb.RepairResult{}))
+	assert.Equal(t, "a; b", toleratedErrors(&repairnzb.RepairResult{Errors: []string{"a", "b"}}))
+}
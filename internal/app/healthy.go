@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// Outputs accepted in healthy_output.
+const (
+	healthyOutputNone    = "none"
+	healthyOutputCopy    = "copy"
+	healthyOutputSymlink = "symlink"
+)
+
+// validateHealthyOutput rejects unknown healthy_output values.
+func validateHealthyOutput(mode string) error {
+	switch mode {
+	case healthyOutputNone, healthyOutputCopy, healthyOutputSymlink:
+		return nil
+	}
+
+	return fmt.Errorf("unknown healthy_output %q, expected none, copy or symlink", mode)
+}
+
+// placeHealthyOutput puts the original NZB of a job that needed no repair at
+// outputPath, as a copy or a symlink depending on mode, so automation watching
+// the output directory receives every processed NZB. An existing file at
+// outputPath is backed up, then replaced. With a sink, the copy is stored in
+// the sink instead. It returns where the NZB was placed, empty for none, and
+// the backup.
+func placeHealthyOutput(ctx context.Context, sink repairnzb.OutputSink, mode, nzbPath, outputPath string) (path, backup string, err error) {
+	if mode == healthyOutputNone {
+		return "", "", nil
+	}
+
+	if sink != nil {
+		b, err := os.ReadFile(nzbPath)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read healthy nzb: %w", err)
+		}
+
+		stored, err := sink.WriteNzb(ctx, outputPath, b)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to store healthy nzb: %w", err)
+		}
+
+		return stored.Location, stored.BackupPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0750); err != nil {
+		return "", "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	backup, err = repairnzb.BackupExisting(outputPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	if mode == healthyOutputSymlink {
+		target, err := filepath.Abs(nzbPath)
+		if err != nil {
+			return "", backup, fmt.Errorf("failed to get absolute path for %q: %w", nzbPath, err)
+		}
+
+		if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+			return "", backup, fmt.Errorf("failed to replace %q: %w", outputPath, err)
+		}
+
+		if err := os.Symlink(target, outputPath); err != nil {
+			return "", backup, fmt.Errorf("failed to link healthy nzb: %w", err)
+		}
+
+		return outputPath, backup, nil
+	}
+
+	if err := copyFile(nzbPath, outputPath); err != nil {
+		return "", backup, fmt.Errorf("failed to copy healthy nzb: %w", err)
+	}
+
+	return outputPath, backup, nil
+}
+
+// copyFile copies src to dst through a temporary file in the directory of
+// dst, so dst never holds a partial copy.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
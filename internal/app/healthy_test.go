@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceHealthyOutput(t *testing.T) {
+	src := writeTestNzb(t, t.TempDir(), "show.nzb", 1000)
+	want, err := os.ReadFile(src)
+	require.NoError(t, err)
+
+	out := t.TempDir()
+
+	path, backup, err := placeHealthyOutput(context.Background(), nil, healthyOutputNone, src, filepath.Join(out, "none", "show.nzb"))
+	require.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Empty(t, backup)
+	assert.NoDirExists(t, filepath.Join(out, "none"))
+
+	copied := filepath.Join(out, "copy", "show.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(copied), 0755))
+	require.NoError(t, os.WriteFile(copied, []byte("stale"), 0644))
+	path, backup, err = placeHealthyOutput(context.Background(), nil, healthyOutputCopy, src, copied)
+	require.NoError(t, err)
+	assert.Equal(t, copied, path)
+	got, err := os.ReadFile(copied)
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "an existing output is replaced")
+	got, err = os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, "stale", string(got), "the replaced output is backed up")
+
+	linked := filepath.Join(out, "link", "show.nzb")
+	for range 2 {
+		path, backup, err = placeHealthyOutput(context.Background(), nil, healthyOutputSymlink, src, linked)
+		require.NoError(t, err)
+		assert.Empty(t, backup, "symlinks hold no data to back up")
+	}
+	assert.Equal(t, linked, path)
+	target, err := os.Readlink(linked)
+	require.NoError(t, err)
+	assert.Equal(t, src, target)
+
+	entries, err := os.ReadDir(filepath.Join(out, "copy"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files are left behind")
+}
+
+// memorySink stores NZBs in memory.
+type memorySink map[string][]byte
+
+func (m memorySink) WriteNzb(_ context.Context, path string, nzb []byte) (repairnzb.StoredNzb, error) {
+	m[path] = nzb
+
+	return repairnzb.StoredNzb{Location: "memory:" + path}, nil
+}
+
+func TestPlaceHealthyOutput_Sink(t *testing.T) {
+	src := writeTestNzb(t, t.TempDir(), "show.nzb", 1000)
+	want, err := os.ReadFile(src)
+	require.NoError(t, err)
+
+	sink := memorySink{}
+	out := filepath.Join(t.TempDir(), "show.nzb")
+	path, backup, err := placeHealthyOutput(context.Background(), sink, healthyOutputCopy, src, out)
+	require.NoError(t, err)
+	assert.Equal(t, "memory:"+out, path)
+	assert.Empty(t, backup)
+	assert.Equal(t, want, sink[out])
+	assert.NoFileExists(t, out, "nothing is written locally")
+}
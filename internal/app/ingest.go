@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/scanner"
+	"golang.org/x/sync/errgroup"
+)
+
+// ingest feeds the queue from the watch directories. File system events
+// queue new NZBs once they settle and a full scan every scan_interval picks
+// up whatever the events missed. Both add through the same queuer, whose
+// AddJob ignores files that are already queued.
+type ingest struct {
+	scanners []*scanner.Scanner
+	interval time.Duration
+	log      *slog.Logger
+}
+
+// newIngest creates the ingest of watchDir, if set, and of the configured
+// watch_dirs, adding to q.
+func newIngest(cfg config.Config, watchDir string, q queue.Queuer, logger *slog.Logger) *ingest {
+	var opts []scanner.Option
+	if cfg.WatchDebounce > 0 {
+		opts = append(opts, scanner.WithEvents(cfg.WatchDebounce))
+	}
+	if cfg.WatchMaxDepth > 0 {
+		opts = append(opts, scanner.WithMaxDepth(cfg.WatchMaxDepth))
+	}
+	if cfg.FollowSymlinks {
+		opts = append(opts, scanner.WithFollowSymlinks())
+	}
+
+	var scanners []*scanner.Scanner
+	if watchDir != "" {
+		scanners = append(scanners, scanner.New(watchDir, q, logger, cfg.ScanInterval, opts...))
+	}
+	for _, d := range cfg.WatchDirs {
+		scanners = append(scanners, scanner.New(d.Path, q, logger, cfg.ScanInterval, opts...))
+	}
+
+	return &ingest{
+		scanners: scanners,
+		interval: cfg.ScanInterval,
+		log:      logger.With("component", "ingest"),
+	}
+}
+
+// Run watches and scans every watch directory until ctx is canceled, like
+// Scanner.Run.
+func (in *ingest) Run(ctx context.Context) error {
+	in.log.InfoContext(ctx, "Starting ingest", "directories", in.dirs(), "interval", in.interval)
+
+	eg, gCtx := errgroup.WithContext(ctx)
+	for _, s := range in.scanners {
+		eg.Go(func() error {
+			if err := s.Run(gCtx); err != nil && gCtx.Err() == nil {
+				return fmt.Errorf("scanner of %s: %w", s.Dir(), err)
+			}
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	in.log.InfoContext(ctx, "Ingest stopped")
+	return ctx.Err()
+}
+
+// WaitScanned blocks until the initial scans of Run queued the NZBs already
+// in every watch directory, or ctx is canceled.
+func (in *ingest) WaitScanned(ctx context.Context) error {
+	for _, s := range in.scanners {
+		select {
+		case <-s.Scanned():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Rescan starts a full scan of every watch directory right away and returns
+// the directories.
+func (in *ingest) Rescan() []string {
+	for _, s := range in.scanners {
+		s.Rescan()
+	}
+
+	return in.dirs()
+}
+
+// dirs returns the watch directories.
+func (in *ingest) dirs() []string {
+	dirs := make([]string, 0, len(in.scanners))
+	for _, s := range in.scanners {
+		dirs = append(dirs, s.Dir())
+	}
+
+	return dirs
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingQueuer records the paths added to it.
+type recordingQueuer struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *recordingQueuer) AddJob(absPath, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paths = append(r.paths, absPath)
+	return nil
+}
+
+func TestIngest_EventsAndScans(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.nzb")
+	require.NoError(t, os.WriteFile(existing, nil, 0644))
+
+	cfg := config.Config{ScanInterval: time.Hour, WatchDebounce: 50 * time.Millisecond}
+	q := &recordingQueuer{}
+	in := newIngest(cfg, dir, q, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	added := filepath.Join(dir, "added.nzb")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.WriteFile(added, nil, 0644)
+	}()
+
+	assert.ErrorIs(t, in.Run(ctx), context.DeadlineExceeded)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// The initial scan finds the existing NZB, the events the new one long
+	// before the next scan
+	assert.ElementsMatch(t, []string{existing, added}, q.paths)
+}
+
+func TestIngest_WaitScanned(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	var existing []string
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "existing.nzb")
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+		existing = append(existing, path)
+	}
+
+	cfg := config.Config{ScanInterval: time.Hour, WatchDirs: []config.WatchDirConfig{{Path: dirs[1]}}}
+	q := &recordingQueuer{}
+	in := newIngest(cfg, dirs[0], q, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, in.WaitScanned(canceled), context.Canceled, "nothing is scanned before Run")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = in.Run(ctx)
+	}()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	require.NoError(t, in.WaitScanned(waitCtx))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	assert.ElementsMatch(t, existing, q.paths)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// backupPattern matches the backups of NZBs, <name>.nzb.bak and the
+// timestamped <name>.nzb.<time>.bak written by repairnzb.BackupExisting.
+var backupPattern = regexp.MustCompile(`(?i)\.nzb(\.\d{8}-\d{6}(-\d+)?)?\.bak$`)
+
+// inPlaceTempPath returns where the in-place repair of nzbPath writes the
+// repaired NZB: a hidden file next to it, which the scanner ignores and which
+// can replace nzbPath with a rename.
+func inPlaceTempPath(nzbPath string) string {
+	return filepath.Join(filepath.Dir(nzbPath), "."+filepath.Base(nzbPath)+".repaired")
+}
+
+// completeInPlace replaces nzbPath with the repaired NZB at writtenPath after
+// copying the original to a timestamped <name>.nzb.<time>.bak. When the
+// repaired NZB was not written to inPlaceTempPath, e.g. because the fallback
+// output directory was used, nzbPath is left alone. It returns where the
+// repaired NZB ended up and the backup.
+func completeInPlace(nzbPath, writtenPath string) (path, backup string, err error) {
+	if writtenPath != inPlaceTempPath(nzbPath) {
+		return writtenPath, "", nil
+	}
+
+	backup, err = repairnzb.BackupExisting(nzbPath)
+	if err != nil {
+		_ = os.Remove(writtenPath)
+		return "", "", err
+	}
+
+	if err := os.Rename(writtenPath, nzbPath); err != nil {
+		_ = os.Remove(writtenPath)
+		return "", "", fmt.Errorf("failed to replace %q: %w", nzbPath, err)
+	}
+
+	return nzbPath, backup, nil
+}
+
+// pruneBackups removes the in-place backups in dir that are older than
+// retention, including those in subdirectories when recursive is set. It
+// returns the number of removed backups.
+func pruneBackups(dir string, retention time.Duration, recursive bool) (int, error) {
+	cutoff := time.Now().Add(-retention)
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !backupPattern.MatchString(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed++
+
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune backups in %s: %w", dir, err)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompleteInPlace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "show.nzb")
+	require.NoError(t, os.WriteFile(src, []byte("original"), 0644))
+
+	tmp := inPlaceTempPath(src)
+	assert.Equal(t, dir, filepath.Dir(tmp))
+	require.NoError(t, os.WriteFile(tmp, []byte("repaired"), 0644))
+
+	path, backupPath, err := completeInPlace(src, tmp)
+	require.NoError(t, err)
+	assert.Equal(t, src, path)
+	assert.Regexp(t, `show\.nzb\.\d{8}-\d{6}\.bak$`, backupPath)
+
+	got, err := os.ReadFile(src)
+	require.NoError(t, err)
+	assert.Equal(t, "repaired", string(got))
+
+	backup, err := os.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(backup))
+	assert.NoFileExists(t, tmp)
+
+	fallback := filepath.Join(t.TempDir(), "show.nzb")
+	path, backupPath, err = completeInPlace(src, fallback)
+	require.NoError(t, err)
+	assert.Equal(t, fallback, path, "a repair written to the fallback directory leaves the source alone")
+	assert.Empty(t, backupPath)
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	oldBackup := write("a.nzb.bak", old)
+	newBackup := write("b.nzb.bak", time.Now())
+	stamped := write("d.nzb.20260101-120000.bak", old)
+	retried := write("d.nzb.20260101-120000-2.bak", old)
+	nested := write("tv/c.NZB.bak", old)
+	other := write("notes.bak", old)
+
+	removed, err := pruneBackups(dir, 24*time.Hour, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.NoFileExists(t, oldBackup)
+	assert.NoFileExists(t, stamped)
+	assert.NoFileExists(t, retried)
+	assert.FileExists(t, newBackup)
+	assert.FileExists(t, nested, "subdirectories are only searched when recursive")
+
+	removed, err = pruneBackups(dir, 24*time.Hour, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, nested)
+	assert.FileExists(t, other)
+}
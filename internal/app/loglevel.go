@@ -0,0 +1,26 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logLevel is the level of the logger created by setupLogging. The watcher
+// changes it at runtime on SIGUSR1/SIGUSR2 and through the API.
+var logLevel = new(slog.LevelVar)
+
+// logLevelStep is the distance between the levels of log/slog.
+const logLevelStep = slog.LevelInfo - slog.LevelDebug
+
+// shiftLogLevel moves the log level by steps, negative for more verbose
+// logging, between debug and error. It returns the new level.
+func shiftLogLevel(ctx context.Context, steps int, logger *slog.Logger) slog.Level {
+	level := logLevel.Level() + slog.Level(steps)*logLevelStep
+	level = min(max(level, slog.LevelDebug), slog.LevelError)
+	logLevel.Set(level)
+
+	// The change is logged even when the new level hides info messages.
+	logger.Log(ctx, max(level, slog.LevelInfo), "Log level changed", "level", level)
+
+	return level
+}
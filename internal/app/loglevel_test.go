@@ -0,0 +1,25 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftLogLevel(t *testing.T) {
+	t.Cleanup(func() { logLevel.Set(slog.LevelInfo) })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	logLevel.Set(slog.LevelInfo)
+	assert.Equal(t, slog.LevelDebug, shiftLogLevel(ctx, -1, logger))
+	assert.Equal(t, slog.LevelDebug, shiftLogLevel(ctx, -1, logger), "debug is the most verbose level")
+	assert.Equal(t, slog.LevelInfo, shiftLogLevel(ctx, 1, logger))
+	assert.Equal(t, slog.LevelWarn, shiftLogLevel(ctx, 1, logger))
+	assert.Equal(t, slog.LevelError, shiftLogLevel(ctx, 1, logger))
+	assert.Equal(t, slog.LevelError, shiftLogLevel(ctx, 1, logger), "error is the least verbose level")
+}
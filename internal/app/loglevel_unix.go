@@ -0,0 +1,32 @@
+//go:build !windows
+
+package app
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleLogLevelSignals makes the logging more verbose on SIGUSR1 and less
+// verbose on SIGUSR2 until ctx is canceled.
+func handleLogLevelSignals(ctx context.Context, logger *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR1 {
+				shiftLogLevel(ctx, -1, logger)
+			} else {
+				shiftLogLevel(ctx, 1, logger)
+			}
+		}
+	}
+}
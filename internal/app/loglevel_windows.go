@@ -0,0 +1,12 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+)
+
+// handleLogLevelSignals does nothing: Windows has no SIGUSR1/SIGUSR2. The log
+// level can be changed through the API instead.
+func handleLogLevelSignals(ctx context.Context, _ *slog.Logger) {
+	<-ctx.Done()
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/metrics"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// exportRunMetrics pushes the metrics of a single repair run to the configured
+// Pushgateway and/or textfile. Export errors are logged, never returned, so they
+// cannot change the outcome of the run.
+func exportRunMetrics(ctx context.Context, cfg config.Config, meter *pools.UsageMeter, started time.Time, runErr error, logger *slog.Logger) {
+	if cfg.Metrics.PushgatewayURL == "" && cfg.Metrics.TextfilePath == "" {
+		return
+	}
+
+	reg := metrics.NewRegistry()
+	success := 1.0
+	if runErr != nil {
+		success = 0
+	}
+
+	reg.Set("nzbrepair_run_success", "Whether the last repair run succeeded.", nil, success)
+	reg.Set("nzbrepair_run_duration_seconds", "Duration of the last repair run.", nil, time.Since(started).Seconds())
+	reg.Set("nzbrepair_run_last_timestamp_seconds", "Unix time at which the last repair run finished.", nil, float64(time.Now().Unix()))
+
+	for provider, u := range meter.Collect() {
+		labels := metrics.Labels{"provider": provider}
+		reg.Add("nzbrepair_provider_downloaded_bytes_total", "Bytes downloaded per provider.", labels, float64(u.Downloaded))
+		reg.Add("nzbrepair_provider_uploaded_bytes_total", "Bytes uploaded per provider.", labels, float64(u.Uploaded))
+		if u.CompressedRaw > 0 {
+			reg.Add("nzbrepair_provider_compressed_raw_bytes_total", "Uncompressed bytes of compressed connections per provider.", labels, float64(u.CompressedRaw))
+			reg.Add("nzbrepair_provider_compressed_wire_bytes_total", "Transferred bytes of compressed connections per provider.", labels, float64(u.CompressedWire))
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if cfg.Metrics.PushgatewayURL != "" {
+		if err := reg.Push(ctx, cfg.Metrics.PushgatewayURL, cfg.Metrics.JobName); err != nil {
+			logger.ErrorContext(ctx, "Failed to push run metrics", "url", cfg.Metrics.PushgatewayURL, "error", err)
+		} else {
+			logger.DebugContext(ctx, "Pushed run metrics", "url", cfg.Metrics.PushgatewayURL)
+		}
+	}
+
+	if cfg.Metrics.TextfilePath != "" {
+		if err := reg.WriteTextfile(cfg.Metrics.TextfilePath); err != nil {
+			logger.ErrorContext(ctx, "Failed to write run metrics textfile", "path", cfg.Metrics.TextfilePath, "error", err)
+		}
+	}
+}
+
+// newMetricsSubscriber counts finished and triaged watcher jobs and accumulates
+// the time spent in every repair phase.
+func newMetricsSubscriber(reg *metrics.Registry) events.Subscriber {
+	return events.SubscriberFunc(func(_ context.Context, e events.Event) {
+		switch e.Type {
+		case events.JobCompleted:
+			recordJobOutcome(reg, queue.StatusCompleted, 1)
+		case events.JobHealthy:
+			recordJobOutcome(reg, queue.StatusHealthy, 1)
+		case events.JobFailed:
+			recordJobOutcome(reg, queue.StatusFailed, 1)
+		case events.JobMoved:
+			count, _ := e.Fields["count"].(int64)
+			recordJobOutcome(reg, queue.StatusMoved, float64(count))
+		case events.JobTriaged:
+			verdict, _ := e.Fields["verdict"].(string)
+			reg.Add("nzbrepair_jobs_triaged_total", "Jobs triaged by a watcher in triage mode, by verdict.", metrics.Labels{"verdict": verdict}, 1)
+		case events.PhaseFinished:
+			labels := metrics.Labels{"phase": e.Phase}
+			reg.Add("nzbrepair_phase_duration_seconds_total", "Time spent in each repair phase.", labels, e.Duration.Seconds())
+			reg.Add("nzbrepair_phase_runs_total", "Number of times each repair phase ran.", labels, 1)
+		}
+	})
+}
+
+// recordJobOutcome counts n watcher jobs with the given final status.
+func recordJobOutcome(reg *metrics.Registry, status queue.JobStatus, n float64) {
+	reg.Add("nzbrepair_jobs_total", "Jobs processed by the watcher, by outcome.", metrics.Labels{"status": string(status)}, n)
+}
+
+// newStatsExporter creates the configured InfluxDB/Graphite exporter, or nil when disabled.
+// The queue depth gauges are refreshed before every export.
+func newStatsExporter(cfg config.Config, reg *metrics.Registry, dbQueue *queue.Queue, logger *slog.Logger) (*metrics.Exporter, error) {
+	if cfg.StatsExport.Type == "" {
+		return nil, nil
+	}
+
+	collect := func() {
+		counts, err := dbQueue.CountByStatus()
+		if err != nil {
+			logger.Error("Failed to count jobs for stats export", "error", err)
+			return
+		}
+
+		for _, status := range []queue.JobStatus{queue.StatusPending, queue.StatusProcessing, queue.StatusCompleted, queue.StatusFailed, queue.StatusMoved, queue.StatusSkipped, queue.StatusHeld, queue.StatusTooLarge, queue.StatusAwaitingApproval, queue.StatusHealthy, queue.StatusMissingSource, queue.StatusReported} {
+			reg.Set("nzbrepair_queue_jobs", "Jobs in the queue, by status.", metrics.Labels{"status": string(status)}, float64(counts[status]))
+		}
+	}
+
+	return metrics.NewExporter(metrics.ExporterConfig{
+		Format:   cfg.StatsExport.Type,
+		Address:  cfg.StatsExport.Address,
+		Database: cfg.StatsExport.Database,
+		Org:      cfg.StatsExport.Org,
+		Bucket:   cfg.StatsExport.Bucket,
+		Token:    cfg.StatsExport.Token,
+		Prefix:   cfg.StatsExport.Prefix,
+		Interval: cfg.StatsExport.Interval,
+	}, reg, collect, logger)
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// reportJob finishes a damaged job whose route disables uploads, or of a dry
+// run, recording the verdict of the repair in place of a repaired NZB.
+func reportJob(ctx context.Context, dbQueue *queue.Queue, job *queue.Job, grouped []*queue.Job, result *repairnzb.RepairResult, publisher events.Publisher, logger *slog.Logger) {
+	reason := fmt.Sprintf("not repaired, uploads are disabled: %s (%d broken segments)", result.Verdict, result.BrokenSegments)
+	if result.DryRun {
+		reason = fmt.Sprintf("dry run: %s (%d broken segments)", result.Verdict, result.BrokenSegments)
+	}
+
+	logger.InfoContext(ctx, "Job checked without upload", "job_id", job.ID, "filepath", job.FilePath, "verdict", result.Verdict, "broken_segments", result.BrokenSegments)
+	for _, j := range append([]*queue.Job{job}, grouped...) {
+		if err := dbQueue.ReportJob(j.ID, string(result.Verdict), reason); err != nil {
+			logger.ErrorContext(ctx, "Failed to record job verdict", "job_id", j.ID, "error", err)
+		}
+	}
+
+	publisher.Publish(ctx, events.Event{Type: events.JobTriaged, Fields: map[string]any{
+		"verdict":          string(result.Verdict),
+		"uploaded":         false,
+		"segments_checked": result.SegmentsChecked,
+		"broken_segments":  result.BrokenSegments,
+		"corrupt_segments": result.CorruptSegments,
+		"dry_run":          result.DryRun,
+	}})
+}
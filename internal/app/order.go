@@ -0,0 +1,17 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// validateOrder rejects unknown order values.
+func validateOrder(order string) error {
+	switch order {
+	case queue.OrderPriority, queue.OrderFIFO, queue.OrderSmallestFirst:
+		return nil
+	}
+
+	return fmt.Errorf("unknown order %q, expected fifo, smallest-first or priority", order)
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/output"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// newOutputSink returns the sink repaired NZBs are stored in, nil for the
+// local file system that RepairNzb writes to by default. In-place repairs,
+// healthy_output symlinks and post_add_to need the NZB on the local file
+// system.
+func newOutputSink(cfg config.Config) (repairnzb.OutputSink, error) {
+	if cfg.OutputSink.Type == output.TypeLocal {
+		return nil, nil
+	}
+
+	if cfg.InPlace.Enabled {
+		return nil, errors.New("in-place repairs require the local output sink")
+	}
+
+	if cfg.HealthyOutput == healthyOutputSymlink {
+		return nil, errors.New("healthy_output symlink requires the local output sink")
+	}
+
+	if cfg.PostAddTo != "" {
+		return nil, errors.New("post_add_to requires the local output sink")
+	}
+
+	return output.New(output.Config{
+		Type:      cfg.OutputSink.Type,
+		URL:       cfg.OutputSink.URL,
+		Headers:   cfg.OutputSink.Headers,
+		APIKey:    cfg.OutputSink.APIKey,
+		Username:  cfg.OutputSink.Username,
+		Password:  cfg.OutputSink.Password,
+		Category:  cfg.OutputSink.Category,
+		Bucket:    cfg.OutputSink.Bucket,
+		Region:    cfg.OutputSink.Region,
+		Prefix:    cfg.OutputSink.Prefix,
+		AccessKey: cfg.OutputSink.AccessKey,
+		SecretKey: cfg.OutputSink.SecretKey,
+		Timeout:   cfg.OutputSink.Timeout,
+	})
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOutputSink(t *testing.T) {
+	sink, err := newOutputSink(config.Config{OutputSink: config.OutputSinkConfig{Type: "local"}})
+	require.NoError(t, err)
+	assert.Nil(t, sink, "local output is written by RepairNzb itself")
+
+	remote := config.OutputSinkConfig{Type: "http", URL: "http://localhost/nzbs"}
+	sink, err = newOutputSink(config.Config{OutputSink: remote, HealthyOutput: healthyOutputCopy})
+	require.NoError(t, err)
+	assert.NotNil(t, sink)
+
+	_, err = newOutputSink(config.Config{OutputSink: remote, InPlace: config.InPlaceConfig{Enabled: true}})
+	assert.Error(t, err)
+
+	_, err = newOutputSink(config.Config{OutputSink: remote, HealthyOutput: healthyOutputSymlink})
+	assert.Error(t, err)
+
+	_, err = newOutputSink(config.Config{OutputSink: remote, PostAddTo: "/srv/sabnzbd/watch"})
+	assert.Error(t, err)
+
+	_, err = newOutputSink(config.Config{OutputSink: config.OutputSinkConfig{Type: "ftp"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// outputTemplateVar matches a {variable} of output_template.
+var outputTemplateVar = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// outputTemplateVars are the variables output_template may use.
+var outputTemplateVars = []string{"category", "year", "month", "day", "name", "dir"}
+
+// validateOutputTemplate rejects output_template values with unknown
+// variables or that do not stay below the output directory.
+func validateOutputTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+
+	if filepath.IsAbs(tmpl) || strings.HasPrefix(filepath.Clean(tmpl), "..") {
+		return fmt.Errorf("output_template %q must be relative to the output directory", tmpl)
+	}
+
+	for _, m := range outputTemplateVar.FindAllStringSubmatch(tmpl, -1) {
+		known := false
+		for _, v := range outputTemplateVars {
+			known = known || m[1] == v
+		}
+		if !known {
+			return fmt.Errorf("unknown variable {%s} in output_template, expected one of %s", m[1], strings.Join(outputTemplateVars, ", "))
+		}
+	}
+
+	return nil
+}
+
+// validateOutputConflict rejects unknown output_conflict values.
+func validateOutputConflict(policy string) error {
+	switch policy {
+	case repairnzb.OutputConflictOverwrite, repairnzb.OutputConflictVersion:
+		return nil
+	}
+
+	return fmt.Errorf("unknown output_conflict %q, expected overwrite or version", policy)
+}
+
+// jobTemplateVars resolves the output_template variables of job. The category
+// is the job category, falling back to the category meta of the NZB; the date
+// is the oldest post of the NZB, falling back to when the job was queued. nzb
+// may be nil when it could not be read.
+func jobTemplateVars(job *queue.Job, nzb *nzbparser.Nzb) map[string]string {
+	category := job.Category
+	date := job.CreatedAt
+	if nzb != nil {
+		if category == "" {
+			category = nzb.Meta["category"]
+		}
+		if posted := oldestPost(nzb); !posted.IsZero() {
+			date = posted
+		}
+	}
+
+	name := filepath.Base(job.RelativePath)
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".nzb") {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	dir := filepath.Dir(job.RelativePath)
+	if dir == "." {
+		dir = ""
+	}
+
+	return map[string]string{
+		// Meta values come from the NZB and must not add folders of their own.
+		"category": strings.NewReplacer("/", "_", `\`, "_").Replace(category),
+		"year":     date.Format("2006"),
+		"month":    date.Format("01"),
+		"day":      date.Format("02"),
+		"name":     name,
+		"dir":      dir,
+	}
+}
+
+// datedOutputDir returns the YYYY-MM-DD folder of now below dir when dated is
+// set, dir otherwise.
+func datedOutputDir(dir string, dated bool, now time.Time) string {
+	if !dated {
+		return dir
+	}
+
+	return filepath.Join(dir, now.Format(time.DateOnly))
+}
+
+// renderOutputTemplate expands the variables of tmpl. Empty values drop their
+// folder, e.g. {category}/{name}.nzb of a job without category is {name}.nzb.
+func renderOutputTemplate(tmpl string, vars map[string]string) string {
+	rendered := outputTemplateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		return vars[m[1:len(m)-1]]
+	})
+
+	return strings.TrimLeft(filepath.Clean(rendered), `/\`)
+}
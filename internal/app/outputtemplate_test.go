@@ -0,0 +1,46 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestValidateOutputTemplate(t *testing.T) {
+	require.NoError(t, validateOutputTemplate(""))
+	require.NoError(t, validateOutputTemplate("{category}/{year}/{month}/{name}.nzb"))
+	require.Error(t, validateOutputTemplate("{genre}/{name}.nzb"))
+	require.Error(t, validateOutputTemplate("/srv/{name}.nzb"))
+	require.Error(t, validateOutputTemplate("../{name}.nzb"))
+}
+
+func TestRenderOutputTemplate(t *testing.T) {
+	queued := time.Date(2026, 3, 9, 12, 0, 0, 0, time.Local)
+	posted := time.Date(2025, 11, 2, 8, 0, 0, 0, time.Local)
+	job := &queue.Job{RelativePath: "tv/show/ep1.NZB", Category: "tv", CreatedAt: queued}
+	nzb := &nzbparser.Nzb{
+		Meta:  map[string]string{"category": "Movies/HD"},
+		Files: nzbparser.NzbFiles{{Date: int(posted.Unix())}},
+	}
+
+	tmpl := "{category}/{year}/{month}/{name}.nzb"
+	assert.Equal(t, "tv/2025/11/ep1.nzb", renderOutputTemplate(tmpl, jobTemplateVars(job, nzb)))
+	assert.Equal(t, "tv/2026/03/ep1.nzb", renderOutputTemplate(tmpl, jobTemplateVars(job, nil)), "the queue date is used without nzb")
+	assert.Equal(t, "tv/show/09-ep1.nzb", renderOutputTemplate("{dir}/{day}-{name}.nzb", jobTemplateVars(job, nil)))
+
+	root := &queue.Job{RelativePath: "ep1.nzb", CreatedAt: queued}
+	assert.Equal(t, "Movies_HD/ep1.nzb", renderOutputTemplate("{category}/{name}.nzb", jobTemplateVars(root, nzb)), "nzb meta fills a missing category")
+	assert.Equal(t, "ep1.nzb", renderOutputTemplate("{category}/{dir}/{name}.nzb", jobTemplateVars(root, nil)), "empty values drop their folder")
+}
+
+func TestDatedOutputDir(t *testing.T) {
+	now := time.Date(2026, 3, 9, 23, 59, 0, 0, time.Local)
+	assert.Equal(t, "/out", datedOutputDir("/out", false, now))
+	assert.Equal(t, filepath.Join("/out", "2026-03-09"), datedOutputDir("/out", true, now))
+}
@@ -0,0 +1,25 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// validatePar2Recreate rejects par2 create settings par2 would refuse, so
+// they fail at startup instead of after a repair.
+func validatePar2Recreate(cfg config.Config) error {
+	if cfg.Par2RecreateRedundancy < 0 || cfg.Par2RecreateBlockCount < 0 || cfg.Par2RecreateBlockSize < 0 {
+		return errors.New("par2_recreate settings must not be negative")
+	}
+
+	if cfg.Par2RecreateBlockCount > 0 && cfg.Par2RecreateBlockSize > 0 {
+		return errors.New("par2_recreate_block_count and par2_recreate_block_size are mutually exclusive")
+	}
+
+	if cfg.Par2RecreateBlockSize%4 != 0 {
+		return errors.New("par2_recreate_block_size must be a multiple of 4")
+	}
+
+	return nil
+}
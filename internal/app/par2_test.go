@@ -0,0 +1,18 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePar2Recreate(t *testing.T) {
+	assert.NoError(t, validatePar2Recreate(config.Config{Par2RecreateRedundancy: 10}))
+	assert.NoError(t, validatePar2Recreate(config.Config{Par2RecreateRedundancy: 5, Par2RecreateBlockCount: 2000}))
+	assert.NoError(t, validatePar2Recreate(config.Config{Par2RecreateRedundancy: 5, Par2RecreateBlockSize: 768000}))
+
+	assert.Error(t, validatePar2Recreate(config.Config{Par2RecreateRedundancy: -1}))
+	assert.Error(t, validatePar2Recreate(config.Config{Par2RecreateBlockCount: 2000, Par2RecreateBlockSize: 768000}))
+	assert.Error(t, validatePar2Recreate(config.Config{Par2RecreateBlockSize: 768001}))
+}
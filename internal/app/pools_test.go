@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLazily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	created := 0
+	create := func(context.Context, []config.ProviderConfig, poolOptions) (repairnzb.NNTPPool, error) {
+		created++
+		pool := mocks.NewMockNNTPPool(ctrl)
+		pool.EXPECT().Close().Return(nil).AnyTimes()
+		return pool, nil
+	}
+	providers := []config.ProviderConfig{{Host: "news.example.com"}}
+
+	p, err := lazily(create)(context.Background(), providers, poolOptions{idleClose: time.Minute})
+	require.NoError(t, err)
+	lazy, ok := p.(*pools.Lazy)
+	require.True(t, ok, "the pool is created on first use")
+	assert.False(t, lazy.Open())
+	assert.Equal(t, 1, created, "the providers are checked once")
+	require.NoError(t, p.Close())
+
+	p, err = lazily(create)(context.Background(), providers, poolOptions{idleClose: -1})
+	require.NoError(t, err)
+	assert.IsType(t, &mocks.MockNNTPPool{}, p, "negative idle_close keeps the pool open")
+
+	quota := []config.ProviderConfig{{Host: "news.example.com", QuotaBytes: 1 << 30}}
+	p, err = lazily(create)(context.Background(), quota, poolOptions{idleClose: time.Minute})
+	require.NoError(t, err)
+	assert.IsType(t, &mocks.MockNNTPPool{}, p, "pools of providers with a quota stay open")
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// postAddNzb puts the NZB at path into dir, e.g. the watched folder of a
+// downloader, as a hardlink or, across file systems, a copy. The NZB appears
+// in dir under its final name at once, so whatever watches dir never picks up
+// a partial file. An NZB of the same name in dir is replaced. It returns the
+// path of the NZB in dir.
+func postAddNzb(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create post-add directory: %w", err)
+	}
+
+	// A healthy output may be a symlink to the original NZB.
+	src, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", path, err)
+	}
+
+	dst := filepath.Join(dir, filepath.Base(path))
+	if err := linkFile(src, dst); err == nil {
+		return dst, nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return "", fmt.Errorf("failed to add %q to %q: %w", path, dir, err)
+	}
+
+	return dst, nil
+}
+
+// linkFile hardlinks src to dst through a temporary name in the directory of
+// dst, replacing dst.
+func linkFile(src, dst string) error {
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.tmp-%d", filepath.Base(dst), time.Now().UnixNano()))
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// postAddJobOutput puts the output of a watcher job into dir when set. A
+// failure is logged; the job keeps its outcome.
+func postAddJobOutput(ctx context.Context, dir, outputPath string, jobID int64, logger *slog.Logger) {
+	if dir == "" || outputPath == "" {
+		return
+	}
+
+	added, err := postAddNzb(outputPath, dir)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to add nzb to post-add directory", "job_id", jobID, "output", outputPath, "error", err)
+		return
+	}
+
+	logger.InfoContext(ctx, "Added nzb to post-add directory", "job_id", jobID, "path", added)
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostAddNzb(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out", "show.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(output), 0755))
+	require.NoError(t, os.WriteFile(output, []byte("repaired"), 0644))
+
+	watched := filepath.Join(dir, "sabnzbd", "watch")
+	added, err := postAddNzb(output, watched)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(watched, "show.nzb"), added)
+
+	b, err := os.ReadFile(added)
+	require.NoError(t, err)
+	assert.Equal(t, "repaired", string(b))
+
+	// A later NZB of the same name replaces the first one.
+	require.NoError(t, os.Remove(output))
+	require.NoError(t, os.WriteFile(output, []byte("repaired again"), 0644))
+	_, err = postAddNzb(output, watched)
+	require.NoError(t, err)
+
+	b, err = os.ReadFile(added)
+	require.NoError(t, err)
+	assert.Equal(t, "repaired again", string(b))
+
+	entries, err := os.ReadDir(watched)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
+
+func TestPostAddNzb_ResolvesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "watch", "show.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(original), 0755))
+	require.NoError(t, os.WriteFile(original, []byte("healthy"), 0644))
+
+	link := filepath.Join(dir, "out", "show.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(link), 0755))
+	require.NoError(t, os.Symlink(original, link))
+
+	added, err := postAddNzb(link, filepath.Join(dir, "sabnzbd"))
+	require.NoError(t, err)
+
+	info, err := os.Lstat(added)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+}
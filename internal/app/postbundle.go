@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// PostBundleOptions are the flags of the post-bundle command.
+type PostBundleOptions struct {
+	// NoVerify skips checking that the posted articles arrived.
+	NoVerify bool
+}
+
+// RunPostBundle posts the articles of the article bundle in dir through the
+// upload providers, checks on the download providers that they arrived and
+// writes the NZB of the bundle to output, when given.
+func RunPostBundle(ctx context.Context, cfg config.Config, dir string, output string, opts PostBundleOptions, w io.Writer) error {
+	uploadPool, err := createUploadPool(ctx, cfg.UploadProviders, poolOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = uploadPool.Close()
+	}()
+
+	var checker repairnzb.ArticleChecker
+	if !opts.NoVerify {
+		downloadPool, err := createDownloadPool(ctx, cfg.DownloadProviders, poolOptions{})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = downloadPool.Close()
+		}()
+
+		c, ok := downloadPool.(repairnzb.CheckingPool)
+		if !ok {
+			return errors.New("download pool cannot check articles")
+		}
+		checker = c
+	}
+
+	result, err := repairnzb.PostBundle(ctx, dir, uploadPool, checker, cfg.UploadWorkers)
+	if result != nil {
+		_, _ = fmt.Fprintf(w, "posted\t%d\nskipped\t%d\nreposted\t%d\n", result.Posted, result.Skipped, result.Reposted)
+	}
+	if err != nil {
+		return err
+	}
+
+	nzbPath := result.NZB
+	if output != "" {
+		nzbPath, err = getSingleOutputFilePath(result.NZB, output)
+		if err != nil {
+			return fmt.Errorf("failed to determine output file path: %w", err)
+		}
+
+		b, err := os.ReadFile(result.NZB)
+		if err != nil {
+			return fmt.Errorf("failed to read nzb of the bundle: %w", err)
+		}
+
+		stored, err := (&repairnzb.LocalSink{Conflict: cfg.OutputConflict, FallbackDir: cfg.FallbackOutputDir}).WriteNzb(ctx, nzbPath, b)
+		if err != nil {
+			return err
+		}
+		nzbPath = stored.Location
+	}
+
+	if cfg.PostAddTo != "" {
+		if _, err := postAddNzb(nzbPath, cfg.PostAddTo); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "nzb\t%s\n", nzbPath)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// validatePostingLimits rejects negative posting limits of upload provider p.
+func validatePostingLimits(p config.ProviderConfig) error {
+	if p.MaxArticleSize < 0 {
+		return fmt.Errorf("upload provider %s: max_article_size must not be negative", p.DisplayName())
+	}
+
+	if p.MaxPostsPerMinute < 0 {
+		return fmt.Errorf("upload provider %s: max_posts_per_minute must not be negative", p.DisplayName())
+	}
+
+	return nil
+}
+
+// postingGroups splits providers into groups that post alike, with the same
+// date policy and posts limit, in the order they are configured. Each group
+// gets a client of its own.
+func postingGroups(providers []config.ProviderConfig) [][]config.ProviderConfig {
+	type key struct {
+		policy   config.DatePolicy
+		jitter   time.Duration
+		maxPosts int
+	}
+
+	var groups [][]config.ProviderConfig
+	index := make(map[key]int)
+	for _, p := range providers {
+		k := key{policy: p.DatePolicy, jitter: p.DateJitter, maxPosts: p.MaxPostsPerMinute}
+		if k.policy == "" {
+			k.policy = config.DatePolicyOriginal
+		}
+		if k.policy != config.DatePolicyJitter {
+			k.jitter = 0
+		}
+
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+
+	return groups
+}
+
+// postingPool wraps the client of a posting group to date and throttle its
+// posts like the providers of group want.
+func postingPool(client repairnzb.NNTPPool, group []config.ProviderConfig) repairnzb.NNTPPool {
+	p := client
+	if date := postDate(group[0]); date != nil {
+		p = pools.NewDated(p, date)
+	}
+
+	// Every provider of the group takes its own share of the posts.
+	if maxPosts := group[0].MaxPostsPerMinute; maxPosts > 0 {
+		p = pools.NewThrottled(p, maxPosts*len(group))
+	}
+
+	return p
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostingGroups(t *testing.T) {
+	groups := postingGroups([]config.ProviderConfig{
+		{Host: "a"},
+		{Host: "b", DatePolicy: config.DatePolicyNow},
+		{Host: "c", DatePolicy: config.DatePolicyOriginal, DateJitter: time.Hour},
+		{Host: "d", DatePolicy: config.DatePolicyNow},
+		{Host: "e", MaxPostsPerMinute: 30},
+	})
+
+	require.Len(t, groups, 3)
+	assert.Equal(t, []string{"a", "c"}, []string{groups[0][0].Host, groups[0][1].Host})
+	assert.Equal(t, []string{"b", "d"}, []string{groups[1][0].Host, groups[1][1].Host})
+	assert.Equal(t, "e", groups[2][0].Host)
+}
+
+func TestPostingPool(t *testing.T) {
+	client := mocks.NewMockNNTPPool(gomock.NewController(t))
+
+	assert.Same(t, client, postingPool(client, []config.ProviderConfig{{Host: "a"}}), "posts are left alone without limits")
+	assert.IsType(t, &pools.Throttled{}, postingPool(client, []config.ProviderConfig{{Host: "a", Connections: 5, MaxPostsPerMinute: 30}}))
+	assert.IsType(t, &pools.Dated{}, postingPool(client, []config.ProviderConfig{{Host: "a", DatePolicy: config.DatePolicyNow}}))
+}
+
+func TestValidatePostingLimits(t *testing.T) {
+	require.NoError(t, validatePostingLimits(config.ProviderConfig{MaxArticleSize: 750_000, MaxPostsPerMinute: 60}))
+	require.Error(t, validatePostingLimits(config.ProviderConfig{MaxArticleSize: -1}))
+	require.Error(t, validatePostingLimits(config.ProviderConfig{MaxPostsPerMinute: -1}))
+}
+
+func TestPostRejection(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("%w: failed to upload segment: %w", repairnzb.ErrUploadFailed, err)
+	}
+
+	assert.Equal(t, "posting_not_allowed", postRejection(wrap(repairnzb.ErrPostingNotAllowed)))
+	assert.Equal(t, "post_rejected", postRejection(wrap(repairnzb.ErrPostRejected)))
+	assert.Equal(t, "article_too_large", postRejection(wrap(repairnzb.ErrArticleTooLarge)))
+	assert.Empty(t, postRejection(wrap(errors.New("connection reset"))))
+	assert.Empty(t, postRejection(repairnzb.ErrTooDamaged))
+}
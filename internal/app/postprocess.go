@@ -0,0 +1,322 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/output"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// Exit codes NZBGet expects from extensions and SABnzbd from
+// post-processing scripts.
+const (
+	nzbgetExitSuccess = 93
+	nzbgetExitError   = 94
+	nzbgetExitNone    = 95
+	sabExitSuccess    = 0
+	sabExitFailure    = 1
+)
+
+const (
+	downloaderNzbget  = "nzbget"
+	downloaderSabnzbd = "sabnzbd"
+)
+
+// errNotPostProcess is returned when the environment was not set by NZBGet or
+// SABnzbd.
+var errNotPostProcess = errors.New("not run by NZBGet or SABnzbd: neither NZBPP_DIRECTORY nor SAB_COMPLETE_DIR is set")
+
+// PostProcessOptions are the flags of the postprocess command.
+type PostProcessOptions struct {
+	// Nzb is the NZB to repair instead of the one found through the
+	// environment.
+	Nzb string
+	// Output is the output file or directory of the repaired NZB. It
+	// defaults to a folder of the temporary directory, removed once the NZB
+	// is handed to post_add_to or the output sink.
+	Output string
+	// Verbose enables debug logging.
+	Verbose bool
+}
+
+// postProcessOutcome is how a post-processing run ended.
+type postProcessOutcome int
+
+const (
+	// postProcessNone means there was nothing to repair.
+	postProcessNone postProcessOutcome = iota
+	// postProcessRetry means an NZB was handed back to the downloader to be
+	// downloaded again.
+	postProcessRetry
+	// postProcessFailure means the download stays failed.
+	postProcessFailure
+)
+
+// postProcessJob is the download a downloader ran the post-processing for.
+type postProcessJob struct {
+	downloader string
+	// name is the name of the download, without .nzb.
+	name string
+	// dir holds the files the downloader got, possibly incomplete.
+	dir string
+	// failed is set when the download or its par2 repair failed.
+	failed bool
+	// nzbFile is the NZB of the download, gzipped when nzbGzipped is set.
+	nzbFile    string
+	nzbGzipped bool
+	// nzbDir is the NzbDir of NZBGet, the directory it watches for NZBs.
+	nzbDir string
+	// nzbID is the NZB ID of the download in NZBGet, 0 for SABnzbd.
+	nzbID int
+}
+
+// detectPostProcess reads the environment NZBGet or SABnzbd set for a
+// post-processing script.
+func detectPostProcess(getenv func(string) string) (postProcessJob, error) {
+	if dir := getenv("NZBPP_DIRECTORY"); dir != "" {
+		job := postProcessJob{
+			downloader: downloaderNzbget,
+			name:       getenv("NZBPP_NZBNAME"),
+			dir:        dir,
+			failed:     getenv("NZBPP_TOTALSTATUS") == "FAILURE",
+			nzbDir:     getenv("NZBOP_NZBDIR"),
+		}
+		job.nzbID, _ = strconv.Atoi(getenv("NZBPP_NZBID"))
+
+		// The file name is a full path for NZBs added from NzbDir, which
+		// NZBGet renames while it has them.
+		if name := getenv("NZBPP_NZBFILENAME"); name != "" {
+			if !filepath.IsAbs(name) && job.nzbDir != "" {
+				name = filepath.Join(job.nzbDir, name)
+			}
+			for _, candidate := range []string{name, name + ".queued", name + ".processed"} {
+				if _, err := os.Stat(candidate); err == nil {
+					job.nzbFile = candidate
+					break
+				}
+			}
+		}
+
+		if job.name == "" {
+			job.name = filepath.Base(dir)
+		}
+
+		return job, nil
+	}
+
+	if dir := getenv("SAB_COMPLETE_DIR"); dir != "" {
+		status := getenv("SAB_PP_STATUS")
+		job := postProcessJob{
+			downloader: downloaderSabnzbd,
+			name:       strings.TrimSuffix(getenv("SAB_FILENAME"), ".nzb"),
+			dir:        dir,
+			failed:     status != "" && status != "0",
+			nzbFile:    getenv("SAB_ORIG_NZB_GZ"),
+			nzbGzipped: true,
+		}
+
+		if job.name == "" {
+			job.name = filepath.Base(dir)
+		}
+
+		return job, nil
+	}
+
+	return postProcessJob{}, errNotPostProcess
+}
+
+// exitCode is the exit code the downloader of the job expects for outcome.
+func (j postProcessJob) exitCode(outcome postProcessOutcome) int {
+	if j.downloader == downloaderNzbget {
+		switch outcome {
+		case postProcessNone:
+			return nzbgetExitNone
+		case postProcessRetry:
+			return nzbgetExitSuccess
+		default:
+			return nzbgetExitError
+		}
+	}
+
+	if outcome == postProcessFailure {
+		return sabExitFailure
+	}
+
+	return sabExitSuccess
+}
+
+// copyNzb writes the NZB of the job, unpacked, to dst.
+func (j postProcessJob) copyNzb(dst string) error {
+	if j.nzbFile == "" {
+		return fmt.Errorf("%s did not pass the NZB of %q, use --nzb", j.downloader, j.name)
+	}
+
+	src, err := os.Open(j.nzbFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	var r io.Reader = src
+	if j.nzbGzipped {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", j.nzbFile, err)
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		r = gz
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to copy %q: %w", j.nzbFile, err)
+	}
+
+	return f.Close()
+}
+
+// RunPostProcess repairs the NZB of a failed download when run as a
+// post-processing script of SABnzbd or an extension of NZBGet, and hands the
+// repaired NZB back to the downloader. It reports through w in the format
+// both downloaders log and returns the exit code they expect.
+func RunPostProcess(ctx context.Context, cfg config.Config, tmpDir string, opts PostProcessOptions, getenv func(string) string, w io.Writer) int {
+	job, err := detectPostProcess(getenv)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "[ERROR] %v\n", err)
+		return sabExitFailure
+	}
+
+	outcome, err := postProcess(ctx, cfg, tmpDir, opts, job, w)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "[ERROR] %v\n", err)
+	}
+
+	return job.exitCode(outcome)
+}
+
+// postProcess repairs the NZB of job.
+func postProcess(ctx context.Context, cfg config.Config, tmpDir string, opts PostProcessOptions, job postProcessJob, w io.Writer) (postProcessOutcome, error) {
+	if !job.failed {
+		_, _ = fmt.Fprintf(w, "[INFO] %s downloaded %q, nothing to repair\n", job.downloader, job.name)
+		return postProcessNone, nil
+	}
+
+	if opts.Nzb != "" {
+		job.nzbFile = opts.Nzb
+		job.nzbGzipped = strings.HasSuffix(opts.Nzb, ".gz")
+	}
+
+	// NZBGet picks up NZBs put in its NzbDir.
+	if cfg.PostAddTo == "" && job.nzbDir != "" && cfg.OutputSink.Type == output.TypeLocal {
+		cfg.PostAddTo = job.nzbDir
+	}
+
+	if cfg.PostAddTo == "" && cfg.OutputSink.Type == output.TypeLocal && opts.Output == "" {
+		return postProcessFailure, errors.New("nowhere to hand the repaired NZB to: set post_add_to, an output sink or --output")
+	}
+
+	// par2 reuses what the downloader already got.
+	if cfg.ReferenceDir == "" {
+		if info, err := os.Stat(job.dir); err == nil && info.IsDir() {
+			cfg.ReferenceDir = job.dir
+		}
+	}
+
+	// A download NZBGet left in its InterDir also spares the download of
+	// the segments it wrote.
+	if cfg.NzbgetInterDir == "" && job.nzbID > 0 && filepath.Base(job.dir) == fmt.Sprintf("%s.#%d", job.name, job.nzbID) {
+		cfg.NzbgetInterDir = filepath.Dir(job.dir)
+	}
+
+	cfg.Progress = progressNone
+	cfg.InPlace.Enabled = false
+	cfg.BundleDir = ""
+
+	workDir, err := os.MkdirTemp(tmpDir, "postprocess-")
+	if err != nil {
+		return postProcessFailure, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(workDir)
+	}()
+
+	nzbFile := filepath.Join(workDir, job.name+".nzb")
+	if err := job.copyNzb(nzbFile); err != nil {
+		return postProcessFailure, err
+	}
+
+	outputFileOrDir := opts.Output
+	if outputFileOrDir == "" {
+		outputFileOrDir = filepath.Join(workDir, "repaired")
+		if err := os.Mkdir(outputFileOrDir, 0750); err != nil {
+			return postProcessFailure, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	logger := newPostProcessLogger(w, opts.Verbose)
+	_, _ = fmt.Fprintf(w, "[INFO] Repairing %q\n", job.name)
+
+	// The repair clears its temporary directory, so it gets one of its own
+	// rather than the one holding the work directory.
+	result, err := runSingleRepair(ctx, cfg, nzbFile, outputFileOrDir, filepath.Join(workDir, "tmp"), logger, repairnzb.WithNzbgetID(job.nzbID))
+	if err != nil {
+		return postProcessFailure, err
+	}
+
+	if result.DryRun {
+		_, _ = fmt.Fprintf(w, "[INFO] Dry run of %q: %s, %d broken segments\n", job.name, result.Verdict, result.BrokenSegments)
+		return postProcessNone, nil
+	}
+
+	if !result.Healthy {
+		_, _ = fmt.Fprintf(w, "[INFO] Repaired %q: %d of %d segments replaced, NZB written to %s\n", job.name, result.SegmentsReplaced, result.SegmentsChecked, result.OutputPath)
+		return postProcessRetry, nil
+	}
+
+	// Every article is available again, so the download can simply be
+	// retried.
+	if cfg.PostAddTo == "" {
+		_, _ = fmt.Fprintf(w, "[WARNING] The NZB of %q is healthy, download it again\n", job.name)
+		return postProcessFailure, nil
+	}
+
+	added, err := postAddNzb(nzbFile, cfg.PostAddTo)
+	if err != nil {
+		return postProcessFailure, err
+	}
+
+	_, _ = fmt.Fprintf(w, "[INFO] The NZB of %q is healthy, queued again as %s\n", job.name, added)
+	return postProcessRetry, nil
+}
+
+// newPostProcessLogger logs to w, which the downloader records in the log of
+// the download.
+func newPostProcessLogger(w io.Writer, verbose bool) *slog.Logger {
+	if verbose {
+		logLevel.Set(slog.LevelDebug)
+	} else {
+		logLevel.Set(slog.LevelInfo)
+	}
+	logger := slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: logLevel}))
+	slog.SetDefault(logger)
+	return logger
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envOf(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestDetectPostProcess_Nzbget(t *testing.T) {
+	nzbDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(nzbDir, "show.nzb.queued"), []byte("nzb"), 0644))
+
+	job, err := detectPostProcess(envOf(map[string]string{
+		"NZBPP_DIRECTORY":   "/downloads/inter/show.#12",
+		"NZBPP_NZBNAME":     "show",
+		"NZBPP_NZBFILENAME": "show.nzb",
+		"NZBPP_TOTALSTATUS": "FAILURE",
+		"NZBPP_NZBID":       "12",
+		"NZBOP_NZBDIR":      nzbDir,
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, downloaderNzbget, job.downloader)
+	assert.Equal(t, "show", job.name)
+	assert.Equal(t, "/downloads/inter/show.#12", job.dir)
+	assert.True(t, job.failed)
+	assert.Equal(t, filepath.Join(nzbDir, "show.nzb.queued"), job.nzbFile, "the renamed NZB is found")
+	assert.False(t, job.nzbGzipped)
+	assert.Equal(t, nzbDir, job.nzbDir)
+	assert.Equal(t, 12, job.nzbID)
+}
+
+func TestDetectPostProcess_Sabnzbd(t *testing.T) {
+	job, err := detectPostProcess(envOf(map[string]string{
+		"SAB_COMPLETE_DIR": "/downloads/complete/_FAILED_show",
+		"SAB_FILENAME":     "show.nzb",
+		"SAB_PP_STATUS":    "1",
+		"SAB_ORIG_NZB_GZ":  "/admin/future/show.nzb.gz",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, downloaderSabnzbd, job.downloader)
+	assert.Equal(t, "show", job.name)
+	assert.True(t, job.failed)
+	assert.Equal(t, "/admin/future/show.nzb.gz", job.nzbFile)
+	assert.True(t, job.nzbGzipped)
+
+	job, err = detectPostProcess(envOf(map[string]string{
+		"SAB_COMPLETE_DIR": "/downloads/complete/show",
+		"SAB_PP_STATUS":    "0",
+	}))
+	require.NoError(t, err)
+	assert.False(t, job.failed)
+	assert.Equal(t, "show", job.name, "the name falls back to the folder")
+}
+
+func TestDetectPostProcess_NotRunByDownloader(t *testing.T) {
+	_, err := detectPostProcess(envOf(nil))
+	assert.ErrorIs(t, err, errNotPostProcess)
+}
+
+func TestPostProcessJob_ExitCode(t *testing.T) {
+	nzbget := postProcessJob{downloader: downloaderNzbget}
+	assert.Equal(t, 95, nzbget.exitCode(postProcessNone))
+	assert.Equal(t, 93, nzbget.exitCode(postProcessRetry))
+	assert.Equal(t, 94, nzbget.exitCode(postProcessFailure))
+
+	sab := postProcessJob{downloader: downloaderSabnzbd}
+	assert.Equal(t, 0, sab.exitCode(postProcessNone))
+	assert.Equal(t, 0, sab.exitCode(postProcessRetry))
+	assert.Equal(t, 1, sab.exitCode(postProcessFailure))
+}
+
+func TestPostProcessJob_CopyNzbGzipped(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "show.nzb.gz")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte("<nzb/>"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(src, buf.Bytes(), 0644))
+
+	dst := filepath.Join(dir, "show.nzb")
+	job := postProcessJob{downloader: downloaderSabnzbd, nzbFile: src, nzbGzipped: true}
+	require.NoError(t, job.copyNzb(dst))
+
+	b, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "<nzb/>", string(b))
+
+	err = postProcessJob{downloader: downloaderNzbget, name: "show"}.copyNzb(dst)
+	assert.ErrorContains(t, err, "use --nzb")
+}
+
+func TestRunPostProcess_SuccessfulDownload(t *testing.T) {
+	var out bytes.Buffer
+	code := RunPostProcess(context.Background(), config.Config{}, t.TempDir(), PostProcessOptions{}, envOf(map[string]string{
+		"NZBPP_DIRECTORY":   "/downloads/show",
+		"NZBPP_NZBNAME":     "show",
+		"NZBPP_TOTALSTATUS": "SUCCESS",
+	}), &out)
+
+	assert.Equal(t, nzbgetExitNone, code)
+	assert.Contains(t, out.String(), "nothing to repair")
+}
+
+func TestRunPostProcess_NowhereToQueue(t *testing.T) {
+	var out bytes.Buffer
+	cfg := config.Config{OutputSink: config.OutputSinkConfig{Type: "local"}}
+	code := RunPostProcess(context.Background(), cfg, t.TempDir(), PostProcessOptions{}, envOf(map[string]string{
+		"SAB_COMPLETE_DIR": "/downloads/_FAILED_show",
+		"SAB_PP_STATUS":    "2",
+	}), &out)
+
+	assert.Equal(t, sabExitFailure, code)
+	assert.Contains(t, out.String(), "[ERROR] nowhere to hand the repaired NZB to")
+}
+
+func TestRunPostProcess_NotRunByDownloader(t *testing.T) {
+	var out bytes.Buffer
+	code := RunPostProcess(context.Background(), config.Config{}, t.TempDir(), PostProcessOptions{}, envOf(nil), &out)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), "[ERROR] not run by NZBGet or SABnzbd")
+}
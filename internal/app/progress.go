@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// Progress outputs accepted in progress.
+const (
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressNone = "none"
+)
+
+// jobProgressInterval bounds how often the progress of a watcher job is
+// written to the queue and published.
+const jobProgressInterval = time.Second
+
+// validateProgress rejects unknown progress values.
+func validateProgress(output string) error {
+	switch output {
+	case progressBar, progressJSON, progressNone:
+		return nil
+	}
+
+	return fmt.Errorf("unknown progress %q, expected bar, json or none", output)
+}
+
+// singleRepairProgress returns the progress reporter of a single repair,
+// nil for none.
+func singleRepairProgress(output string, stdout, stderr io.Writer) repairnzb.ProgressReporter {
+	switch output {
+	case progressBar:
+		return repairnzb.NewBarProgress(stdout)
+	case progressJSON:
+		return repairnzb.NewJSONProgress(stderr)
+	}
+
+	return nil
+}
+
+// watcherJobProgress returns the progress reporter of a watcher job: it
+// records the progress in the queue, for status and the API job list, and
+// publishes it on the job's event stream.
+func watcherJobProgress(dbQueue *queue.Queue, jobID int64, p events.Publisher, logger *slog.Logger) repairnzb.ProgressReporter {
+	return throttleProgress(repairnzb.MultiProgress(
+		&queueProgress{queue: dbQueue, jobID: jobID, logger: logger},
+		&eventProgress{events: p},
+	), jobProgressInterval)
+}
+
+// queueProgress records progress in the progress column of a job.
+type queueProgress struct {
+	queue  *queue.Queue
+	jobID  int64
+	logger *slog.Logger
+}
+
+func (q *queueProgress) ReportProgress(ctx context.Context, p repairnzb.Progress) {
+	err := q.queue.SetJobProgress(q.jobID, queue.JobProgress{
+		Phase: p.Phase,
+		Unit:  p.Unit,
+		Done:  p.Done,
+		Total: p.Total,
+		Rate:  p.Rate,
+	})
+	if err != nil {
+		q.logger.DebugContext(ctx, "Failed to record job progress", "job_id", q.jobID, "error", err)
+	}
+}
+
+// eventProgress publishes progress as JobProgress events.
+type eventProgress struct {
+	events events.Publisher
+}
+
+func (e *eventProgress) ReportProgress(ctx context.Context, p repairnzb.Progress) {
+	e.events.Publish(ctx, events.Event{
+		Type:  events.JobProgress,
+		Phase: p.Phase,
+		Fields: map[string]any{
+			"unit":  p.Unit,
+			"done":  p.Done,
+			"total": p.Total,
+			"rate":  p.Rate,
+		},
+	})
+}
+
+// throttleProgress passes at most one snapshot per interval to next, plus
+// the first and last one of every phase.
+func throttleProgress(next repairnzb.ProgressReporter, interval time.Duration) repairnzb.ProgressReporter {
+	return &throttledProgress{next: next, interval: interval}
+}
+
+type throttledProgress struct {
+	next     repairnzb.ProgressReporter
+	interval time.Duration
+
+	mu       sync.Mutex
+	phase    string
+	reported time.Time
+}
+
+func (t *throttledProgress) ReportProgress(ctx context.Context, p repairnzb.Progress) {
+	t.mu.Lock()
+	now := time.Now()
+	if p.Phase == t.phase && !p.Finished && now.Sub(t.reported) < t.interval {
+		t.mu.Unlock()
+		return
+	}
+	t.phase, t.reported = p.Phase, now
+	t.mu.Unlock()
+
+	t.next.ReportProgress(ctx, p)
+}
+
+// formatProgress renders the progress of a job for the status table, e.g.
+// "download 42% 12.5 MB/s".
+func formatProgress(p *client.JobProgress) string {
+	if p == nil {
+		return "-"
+	}
+
+	if p.Unit == repairnzb.ProgressPercent {
+		return fmt.Sprintf("%s %d%%", p.Phase, p.Done)
+	}
+
+	s := p.Phase
+	if p.Total > 0 {
+		s += fmt.Sprintf(" %d%%", p.Done*100/p.Total)
+	}
+
+	if p.Unit == repairnzb.ProgressBytes {
+		return s + fmt.Sprintf(" %.1f MB/s", p.Rate/1e6)
+	}
+
+	return s + fmt.Sprintf(" %.0f %s/s", p.Rate, p.Unit)
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/javi11/nzb-repair/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherJobProgress(t *testing.T) {
+	q, err := queue.NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	var got []events.Event
+	bus := events.NewBus()
+	bus.Subscribe(events.SubscriberFunc(func(_ context.Context, e events.Event) { got = append(got, e) }))
+
+	r := watcherJobProgress(q, job.ID, events.ForJob(bus, job.ID, job.FilePath), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseDownload, Unit: repairnzb.ProgressBytes, Total: 100})
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseDownload, Unit: repairnzb.ProgressBytes, Done: 50, Total: 100})
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseDownload, Unit: repairnzb.ProgressBytes, Done: 100, Total: 100, Rate: 20, Finished: true})
+
+	require.Len(t, got, 2, "snapshots within a second are dropped, the last one of a phase is kept")
+	assert.Equal(t, events.JobProgress, got[1].Type)
+	assert.Equal(t, job.ID, got[1].JobID)
+	assert.Equal(t, repairnzb.PhaseDownload, got[1].Phase)
+	assert.Equal(t, int64(100), got[1].Fields["done"])
+
+	stored, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	require.NotNil(t, stored.Progress)
+	assert.Equal(t, queue.JobProgress{Phase: repairnzb.PhaseDownload, Unit: repairnzb.ProgressBytes, Done: 100, Total: 100, Rate: 20}, *stored.Progress)
+}
+
+func TestThrottleProgress_NewPhase(t *testing.T) {
+	var phases []string
+	r := throttleProgress(repairnzb.ProgressReporterFunc(func(_ context.Context, p repairnzb.Progress) {
+		phases = append(phases, p.Phase)
+	}), time.Hour)
+
+	ctx := context.Background()
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseDownload})
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseDownload})
+	r.ReportProgress(ctx, repairnzb.Progress{Phase: repairnzb.PhaseVerify})
+
+	assert.Equal(t, []string{repairnzb.PhaseDownload, repairnzb.PhaseVerify}, phases)
+}
+
+func TestFormatProgress(t *testing.T) {
+	assert.Equal(t, "-", formatProgress(nil))
+	assert.Equal(t, "download 25% 2.5 MB/s", formatProgress(&client.JobProgress{Phase: "download", Unit: "bytes", Done: 25, Total: 100, Rate: 2.5e6}))
+	assert.Equal(t, "upload 50% 3 segments/s", formatProgress(&client.JobProgress{Phase: "upload", Unit: "segments", Done: 5, Total: 10, Rate: 3}))
+	assert.Equal(t, "par2_repair 40%", formatProgress(&client.JobProgress{Phase: "par2_repair", Unit: "percent", Done: 40, Total: 100}))
+	assert.NoError(t, validateProgress("json"))
+	assert.Error(t, validateProgress("fancy"))
+}
@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/api"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// QueueAddOptions are the flags of the queue add command.
+type QueueAddOptions struct {
+	// Priority is a named priority (low, normal, high) or a number.
+	Priority string
+	// Category groups the job like a top-level subdirectory of the watch
+	// directory, and becomes the subdirectory of its output.
+	Category string
+	// JSON prints the result as a JSON array instead of text lines.
+	JSON bool
+	// Remote is the API address of a running watcher. Empty uses the
+	// configured API when it answers, else the database file.
+	Remote string
+}
+
+// queuedFile is the JSON form of a queue add result.
+type queuedFile struct {
+	Path   string          `json:"path"`
+	Status queue.JobStatus `json:"status"`
+}
+
+// RunQueueAdd inserts NZB files into the queue of a watcher, through its API
+// or directly into the database, applying the same admission checks as files
+// found in the watch directory. The files are processed from where they are,
+// without being copied.
+func RunQueueAdd(ctx context.Context, cfg config.Config, dbPath string, files []string, opts QueueAddOptions, w io.Writer) error {
+	if _, err := queue.ParsePriority(opts.Priority); err != nil {
+		return err
+	}
+
+	if err := validateCategory(opts.Category); err != nil {
+		return err
+	}
+
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	results := make([]queuedFile, 0, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for %q: %w", file, err)
+		}
+
+		res, err := backend.AddJob(ctx, client.AddJobRequest{Path: absPath, Priority: opts.Priority, Category: opts.Category})
+		if err != nil {
+			return fmt.Errorf("failed to add %q: %w", file, err)
+		}
+
+		results = append(results, queuedFile{Path: res.Path, Status: queue.JobStatus(res.Status)})
+	}
+
+	if opts.JSON {
+		return writeJSON(w, results)
+	}
+
+	for _, r := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", r.Status, r.Path)
+	}
+
+	return nil
+}
+
+// RunQueueBackup writes a consistent copy of the queue database to dest. It
+// uses the SQLite online backup API, so the watcher can keep running.
+func RunQueueBackup(ctx context.Context, dbPath, dest string, w io.Writer) error {
+	dbQueue, err := queue.NewQueue(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize queue: %w", err)
+	}
+	defer func() {
+		_ = dbQueue.Close()
+	}()
+
+	if err := dbQueue.Backup(ctx, dest); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "backed up %s to %s\n", dbPath, dest)
+
+	return nil
+}
+
+// RunQueueRestore replaces the queue database with the backup at src,
+// migrating it to the current schema.
+func RunQueueRestore(ctx context.Context, dbPath, src string, w io.Writer) error {
+	dbQueue, err := queue.NewQueue(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize queue: %w", err)
+	}
+	defer func() {
+		_ = dbQueue.Close()
+	}()
+
+	if err := dbQueue.Restore(ctx, src); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "restored %s from %s\n", dbPath, src)
+
+	return nil
+}
+
+// validateCategory rejects categories that are not a single path element.
+func validateCategory(category string) error {
+	if strings.ContainsAny(category, `/\`) || category == "." || category == ".." {
+		return fmt.Errorf("invalid category %q", category)
+	}
+
+	return nil
+}
+
+// enqueueFile runs file through admission as a job of category, processed
+// from where it is.
+func enqueueFile(admit *admission, file string, priority int, category string) (queuedFile, error) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return queuedFile{}, fmt.Errorf("failed to get absolute path for %q: %w", file, err)
+	}
+
+	if _, err := os.Stat(absPath); err != nil {
+		return queuedFile{}, fmt.Errorf("%w: %w", api.ErrInvalidRequest, err)
+	}
+
+	relPath := filepath.Base(absPath)
+	if category != "" {
+		relPath = filepath.Join(category, relPath)
+	}
+
+	status, err := admit.add(absPath, relPath, queue.AddOptions{Priority: priority, Category: category})
+	if err != nil {
+		return queuedFile{}, err
+	}
+
+	return queuedFile{Path: absPath, Status: status}, nil
+}
+
+// QueueListOptions are the flags of the queue list command.
+type QueueListOptions struct {
+	// Status only lists jobs in this status.
+	Status string
+	// Limit caps the number of listed jobs, most recently updated first.
+	Limit int
+	// JSON prints the jobs as a JSON array instead of a table.
+	JSON bool
+	// Remote is the API address of a running watcher, see QueueAddOptions.
+	Remote string
+}
+
+// RunQueueList prints the jobs of the queue.
+func RunQueueList(ctx context.Context, cfg config.Config, dbPath string, opts QueueListOptions, w io.Writer) error {
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	jobs, err := backend.ListJobs(ctx, client.ListJobsOptions{Status: opts.Status, Limit: opts.Limit})
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	if opts.JSON {
+		if jobs == nil {
+			jobs = []client.Job{}
+		}
+
+		return writeJSON(w, jobs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tSTATUS\tPRIORITY\tRETRIES\tUPDATED\tPATH\tERROR\tNOTE")
+	for _, j := range jobs {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			j.ID, j.Status, j.Priority, j.RetryCount, j.UpdatedAt.Local().Format(time.DateTime), j.FilePath, j.Error, j.Note)
+	}
+
+	return tw.Flush()
+}
+
+// QueueApproveOptions are the flags of the queue approve command.
+type QueueApproveOptions struct {
+	// JSON prints the approved job IDs as a JSON array instead of text lines.
+	JSON bool
+	// Remote is the API address of a running watcher, see QueueAddOptions.
+	Remote string
+}
+
+// RunQueueApprove approves jobs left awaiting approval by a watcher in triage
+// mode, which then repairs them without triaging them again.
+func RunQueueApprove(ctx context.Context, cfg config.Config, dbPath string, ids []int64, opts QueueApproveOptions, w io.Writer) error {
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	approved := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if err := backend.ApproveJob(ctx, id); err != nil {
+			return fmt.Errorf("failed to approve job %d: %w", id, err)
+		}
+
+		approved = append(approved, id)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, approved)
+	}
+
+	for _, id := range approved {
+		_, _ = fmt.Fprintf(w, "approved\t%d\n", id)
+	}
+
+	return nil
+}
+
+// QueueNoteOptions are the flags of the queue note command.
+type QueueNoteOptions struct {
+	// Remote is the API address of a running watcher, see QueueAddOptions.
+	Remote string
+}
+
+// RunQueueNote attaches a free-text note to a job, replacing its previous
+// note. An empty note removes it.
+func RunQueueNote(ctx context.Context, cfg config.Config, dbPath string, id int64, note string, opts QueueNoteOptions, w io.Writer) error {
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	if err := backend.SetJobNote(ctx, id, note); err != nil {
+		return fmt.Errorf("failed to set the note of job %d: %w", id, err)
+	}
+
+	_, _ = fmt.Fprintf(w, "noted\t%d\n", id)
+
+	return nil
+}
+
+// QueueMarkOptions are the flags of the queue mark command.
+type QueueMarkOptions struct {
+	// Reason replaces the error message of the marked jobs.
+	Reason string
+	// JSON prints the marked job IDs as a JSON array instead of text lines.
+	JSON bool
+	// Remote is the API address of a running watcher, see QueueAddOptions.
+	Remote string
+}
+
+// RunQueueMark forces jobs handled outside the tool to status, completed or
+// failed. Failed jobs are not retried; jobs being processed are refused.
+func RunQueueMark(ctx context.Context, cfg config.Config, dbPath string, status string, ids []int64, opts QueueMarkOptions, w io.Writer) error {
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	marked := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if err := backend.OverrideJobStatus(ctx, id, status, opts.Reason); err != nil {
+			return fmt.Errorf("failed to mark job %d as %s: %w", id, status, err)
+		}
+
+		marked = append(marked, id)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, marked)
+	}
+
+	for _, id := range marked {
+		_, _ = fmt.Fprintf(w, "%s\t%d\n", status, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestRunQueueAdd(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "queue.db")
+	nzb := writeTestNzb(t, dir, filepath.Join("incoming", "show.nzb"), 1<<20)
+
+	var out bytes.Buffer
+	err := RunQueueAdd(context.Background(), config.Config{}, dbPath, []string{nzb}, QueueAddOptions{Priority: "high", Category: "tv"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "pending\t"+nzb+"\n", out.String())
+
+	q, err := queue.NewQueue(dbPath)
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, nzb, job.FilePath)
+	assert.Equal(t, filepath.Join("tv", "show.nzb"), job.RelativePath)
+	assert.Equal(t, "tv", job.Category)
+	assert.Equal(t, queue.PriorityHigh, job.Priority)
+
+	out.Reset()
+	err = RunQueueAdd(context.Background(), config.Config{}, dbPath, []string{nzb}, QueueAddOptions{JSON: true}, &out)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"path": "`+nzb+`", "status": "processing"}]`, out.String())
+
+	err = RunQueueAdd(context.Background(), config.Config{}, dbPath, []string{nzb}, QueueAddOptions{Category: "../etc"}, &out)
+	assert.ErrorContains(t, err, "invalid category")
+}
+
+func TestRunQueueNoteAndMark(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "queue.db")
+	cfg := config.Config{MaxRetries: 3}
+
+	q, err := queue.NewQueue(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	a, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	b, err := q.GetJobByPath("/watch/b.nzb")
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	var out bytes.Buffer
+	require.NoError(t, RunQueueNote(context.Background(), cfg, dbPath, a.ID, "grabbed from another indexer", QueueNoteOptions{}, &out))
+
+	out.Reset()
+	require.NoError(t, RunQueueMark(context.Background(), cfg, dbPath, "completed", []int64{a.ID}, QueueMarkOptions{Reason: "handled by hand"}, &out))
+	assert.Equal(t, "completed\t1\n", out.String())
+
+	out.Reset()
+	require.NoError(t, RunQueueMark(context.Background(), cfg, dbPath, "failed", []int64{b.ID}, QueueMarkOptions{JSON: true}, &out))
+	assert.JSONEq(t, `[2]`, out.String())
+
+	err = RunQueueMark(context.Background(), cfg, dbPath, "pending", []int64{b.ID}, QueueMarkOptions{}, &out)
+	assert.ErrorContains(t, err, "expected completed or failed")
+
+	err = RunQueueNote(context.Background(), cfg, dbPath, 99, "missing", QueueNoteOptions{}, &out)
+	assert.ErrorIs(t, err, queue.ErrJobNotFound)
+
+	q, err = queue.NewQueue(dbPath)
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	a, err = q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusCompleted, a.Status)
+	assert.Equal(t, "grabbed from another indexer", a.Note)
+	assert.Equal(t, "handled by hand", a.ErrorMsg.String)
+
+	b, err = q.GetJobByPath("/watch/b.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusFailed, b.Status)
+	assert.Equal(t, int64(3), b.RetryCount, "failed jobs are not retried")
+}
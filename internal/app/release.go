@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// releasePartSuffix matches the part of an NZB name that tells the NZBs of a
+// split release apart, e.g. ".part01", ".vol00+01", "-par2" or " (1of3)".
+var releasePartSuffix = regexp.MustCompile(`(?i)(?:[ ._-]*(?:part\d+|vol\d+[+-]\d+|par2|pars|\(?\d+ ?of ?\d+\)?))+$`)
+
+// releaseName returns the release an NZB belongs to: its file name without
+// extension and part suffix, case-insensitive.
+func releaseName(path string) string {
+	name := filepath.Base(path)
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".nzb") {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	if release := releasePartSuffix.ReplaceAllString(name, ""); release != "" {
+		name = release
+	}
+
+	return strings.ToLower(name)
+}
+
+// sameRelease reports whether b is another NZB of the release of a, in the
+// same folder of the watch directory.
+func sameRelease(a, b *queue.Job) bool {
+	return a.ID != b.ID &&
+		filepath.Dir(a.FilePath) == filepath.Dir(b.FilePath) &&
+		releaseName(a.FilePath) == releaseName(b.FilePath)
+}
+
+// releaseFiles returns the NZB paths of job and the jobs grouped with it.
+func releaseFiles(job *queue.Job, grouped []*queue.Job) []string {
+	files := []string{job.FilePath}
+	for _, g := range grouped {
+		files = append(files, g.FilePath)
+	}
+
+	return files
+}
+
+// finishGrouped gives the jobs grouped with a job its final status and output.
+func finishGrouped(ctx context.Context, dbQueue *queue.Queue, grouped []*queue.Job, status queue.JobStatus, errorMsg, outputPath string, logger *slog.Logger) {
+	for _, g := range grouped {
+		if err := dbQueue.UpdateJobStatus(g.ID, status, errorMsg); err != nil {
+			logger.ErrorContext(ctx, "Failed to update status of grouped job", "job_id", g.ID, "status", status, "error", err)
+		}
+
+		if outputPath == "" {
+			continue
+		}
+
+		if err := dbQueue.SetJobOutputPath(g.ID, outputPath); err != nil {
+			logger.ErrorContext(ctx, "Failed to record output path of grouped job", "job_id", g.ID, "error", err)
+		}
+	}
+}
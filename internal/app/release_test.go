@@ -0,0 +1,33 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestReleaseName(t *testing.T) {
+	for path, want := range map[string]string{
+		"/w/Show.S01E01.part1.nzb":    "show.s01e01",
+		"/w/Show.S01E01.PART02.NZB":   "show.s01e01",
+		"/w/Show.S01E01.vol00+01.nzb": "show.s01e01",
+		"/w/Show.S01E01-par2.nzb":     "show.s01e01",
+		"/w/Show.S01E01 (2of3).nzb":   "show.s01e01",
+		"/w/Show.S01E01.nzb":          "show.s01e01",
+		"/w/part1.nzb":                "part1",
+	} {
+		assert.Equal(t, want, releaseName(path), path)
+	}
+}
+
+func TestSameRelease(t *testing.T) {
+	job := &queue.Job{ID: 1, FilePath: "/w/tv/Show.part1.nzb"}
+
+	assert.True(t, sameRelease(job, &queue.Job{ID: 2, FilePath: "/w/tv/Show.part2.nzb"}))
+	assert.False(t, sameRelease(job, job), "a job is not grouped with itself")
+	assert.False(t, sameRelease(job, &queue.Job{ID: 3, FilePath: "/w/movies/Show.part2.nzb"}), "releases are grouped per folder")
+	assert.False(t, sameRelease(job, &queue.Job{ID: 4, FilePath: "/w/tv/Other.part2.nzb"}))
+	assert.Equal(t, []string{"/w/tv/Show.part1.nzb", "/w/tv/Show.part2.nzb"}, releaseFiles(job, []*queue.Job{{FilePath: "/w/tv/Show.part2.nzb"}}))
+}
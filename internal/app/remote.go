@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/api"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/rules"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// apiProbeTimeout bounds the check whether the configured API is up.
+const apiProbeTimeout = 500 * time.Millisecond
+
+// Ensure the client can stand in for the local backend
+var _ api.Backend = (*client.Client)(nil)
+
+// openQueueBackend returns what the queue commands talk to: the API at remote
+// when it is set, else the API of a running watcher configured in api.listen
+// if it answers, else the queue database at dbPath. The returned function
+// releases the backend.
+func openQueueBackend(ctx context.Context, cfg config.Config, dbPath, remote string) (api.Backend, func(), error) {
+	if remote == "" && cfg.API.Listen != "" {
+		addr := clientAddr(cfg.API.Listen)
+		if apiReachable(ctx, addr) {
+			remote = addr
+		}
+	}
+
+	if remote != "" {
+		c, err := client.New(remote)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return c, func() {}, nil
+	}
+
+	ruleEngine, err := rules.Compile(cfg.Rules)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	dbQueue, err := queue.NewQueue(dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize queue: %w", err)
+	}
+	dbQueue.SetOrder(cfg.Order)
+
+	admit, err := newAdmission(cfg, dbQueue, ruleEngine, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		_ = dbQueue.Close()
+		return nil, nil, fmt.Errorf("invalid admission settings: %w", err)
+	}
+
+	return &apiBackend{cfg: cfg, queue: dbQueue, admit: admit}, func() { _ = dbQueue.Close() }, nil
+}
+
+// clientAddr turns an api.listen value into a client address. Wildcard
+// listen addresses are reached through localhost.
+func clientAddr(listen string) string {
+	if strings.HasPrefix(listen, "unix:") {
+		return listen
+	}
+
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// apiReachable reports whether something accepts connections at addr.
+func apiReachable(ctx context.Context, addr string) bool {
+	network, address := "tcp", strings.TrimPrefix(addr, "http://")
+	if socket, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, address = "unix", strings.TrimPrefix(socket, "//")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiProbeTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+
+	return true
+}
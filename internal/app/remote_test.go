@@ -0,0 +1,77 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/api"
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+func TestClientAddr(t *testing.T) {
+	assert.Equal(t, "http://127.0.0.1:8090", clientAddr(":8090"))
+	assert.Equal(t, "http://127.0.0.1:8090", clientAddr("0.0.0.0:8090"))
+	assert.Equal(t, "http://nas:8090", clientAddr("nas:8090"))
+	assert.Equal(t, "unix:/run/nzb-repair.sock", clientAddr("unix:/run/nzb-repair.sock"))
+}
+
+func TestRemoteQueueCommands(t *testing.T) {
+	dir := t.TempDir()
+	nzb := writeTestNzb(t, dir, "show.nzb", 1<<20)
+
+	a, q := newTestAdmission(t, config.Config{})
+	srv := api.New(&apiBackend{queue: q, admit: a}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// The database path is never opened in remote mode.
+	dbPath := filepath.Join(dir, "missing", "queue.db")
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	err := RunQueueAdd(ctx, config.Config{}, dbPath, []string{nzb}, QueueAddOptions{Priority: "high", Remote: ts.URL}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "pending\t"+nzb+"\n", out.String())
+
+	job, err := q.GetJobByPath(nzb)
+	require.NoError(t, err)
+	assert.Equal(t, 10, job.Priority)
+
+	out.Reset()
+	err = RunQueueList(ctx, config.Config{}, dbPath, QueueListOptions{Remote: ts.URL}, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), nzb)
+
+	out.Reset()
+	err = RunStatus(ctx, config.Config{}, dbPath, StatusOptions{Remote: ts.URL}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"STATUS   JOBS", "pending  1"}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+	assert.NoDirExists(t, filepath.Dir(dbPath))
+}
+
+func TestRemoteQueueCommands_AutoDetectsConfiguredAPI(t *testing.T) {
+	dir := t.TempDir()
+	nzb := writeTestNzb(t, dir, "movie.nzb", 1<<20)
+
+	a, q := newTestAdmission(t, config.Config{})
+	srv := api.New(&apiBackend{queue: q, admit: a}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	cfg := config.Config{API: config.APIConfig{Listen: strings.TrimPrefix(ts.URL, "http://")}}
+	err := RunQueueAdd(context.Background(), cfg, filepath.Join(dir, "queue.db"), []string{nzb}, QueueAddOptions{}, io.Discard)
+	require.NoError(t, err)
+
+	_, err = q.GetJobByPath(nzb)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "queue.db"))
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// ReportOptions are the flags of the report command.
+type ReportOptions struct {
+	// Format is csv or json.
+	Format string
+	// Concurrency is the number of articles checked at once.
+	Concurrency int
+	// Head checks articles with HEAD instead of STAT.
+	Head bool
+}
+
+// reportRow is the health of one NZB in the report.
+type reportRow struct {
+	Path            string     `json:"path"`
+	SizeBytes       int64      `json:"size_bytes"`
+	Segments        int        `json:"segments"`
+	Available       int        `json:"available"`
+	Availability    float64    `json:"availability"`
+	Verdict         string     `json:"verdict"`
+	BlocksNeeded    int        `json:"blocks_needed"`
+	BlocksAvailable int        `json:"blocks_available"`
+	OldestPost      *time.Time `json:"oldest_post,omitempty"`
+	AgeDays         float64    `json:"age_days"`
+	Error           string     `json:"error,omitempty"`
+}
+
+var reportHeader = []string{"path", "size_bytes", "segments", "available", "availability", "verdict", "blocks_needed", "blocks_available", "oldest_post", "age_days", "error"}
+
+// RunReport health-checks every NZB below dir, like stat --verdict, and
+// writes one row per NZB as CSV or JSON. NZBs that cannot be checked are
+// reported with their error instead of aborting the report.
+func RunReport(ctx context.Context, cfg config.Config, dir string, opts ReportOptions, w io.Writer) error {
+	if opts.Format != "csv" && opts.Format != "json" {
+		return fmt.Errorf("unknown report format %q, use csv or json", opts.Format)
+	}
+
+	paths, err := findNzbs(dir)
+	if err != nil {
+		return err
+	}
+
+	pool, err := createDownloadPool(ctx, cfg.DownloadProviders, poolOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	checker, ok := pool.(repairnzb.CheckingPool)
+	if !ok {
+		return errors.New("download pool cannot check articles")
+	}
+
+	scanOpts := repairnzb.ScanOptions{Concurrency: opts.Concurrency, Head: opts.Head}
+	rows := make([]reportRow, 0, len(paths))
+	for i, path := range paths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		slog.InfoContext(ctx, "Checking nzb", "nzb", rel, "progress", fmt.Sprintf("%d/%d", i+1, len(paths)))
+
+		rows = append(rows, reportNzb(ctx, checker, path, rel, scanOpts))
+	}
+
+	if opts.Format == "json" {
+		return writeJSON(w, rows)
+	}
+
+	return writeReportCSV(w, rows)
+}
+
+// findNzbs returns the .nzb files below dir in lexical order.
+func findNzbs(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".nzb") {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nzbs in %s: %w", dir, err)
+	}
+
+	return paths, nil
+}
+
+func reportNzb(ctx context.Context, pool repairnzb.CheckingPool, path, rel string, opts repairnzb.ScanOptions) reportRow {
+	row := reportRow{Path: rel}
+
+	nzb, err := parseNzbFile(path)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+
+	row.SizeBytes = nzb.Bytes
+	if oldest := oldestPost(nzb); !oldest.IsZero() {
+		row.OldestPost = &oldest
+		row.AgeDays = time.Since(oldest).Hours() / 24
+	}
+
+	r, err := repairnzb.AssessRepairability(ctx, pool, nzb, opts)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+
+	row.Segments, row.Available = r.Availability.Totals()
+	row.Availability = ratio(row.Available, row.Segments)
+	row.Verdict = string(r.Verdict)
+	row.BlocksNeeded = r.BlocksNeeded
+	row.BlocksAvailable = r.BlocksAvailable
+
+	return row
+}
+
+// oldestPost returns the date of the oldest file of nzb, zero when unknown.
+func oldestPost(nzb *nzbparser.Nzb) time.Time {
+	var oldest time.Time
+	for _, f := range nzb.Files {
+		if f.Date <= 0 {
+			continue
+		}
+
+		if posted := time.Unix(int64(f.Date), 0); oldest.IsZero() || posted.Before(oldest) {
+			oldest = posted
+		}
+	}
+
+	return oldest
+}
+
+func writeReportCSV(w io.Writer, rows []reportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reportHeader); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		oldest := ""
+		if r.OldestPost != nil {
+			oldest = r.OldestPost.UTC().Format(time.RFC3339)
+		}
+
+		record := []string{
+			r.Path,
+			strconv.FormatInt(r.SizeBytes, 10),
+			strconv.Itoa(r.Segments),
+			strconv.Itoa(r.Available),
+			strconv.FormatFloat(r.Availability, 'f', 4, 64),
+			r.Verdict,
+			strconv.Itoa(r.BlocksNeeded),
+			strconv.Itoa(r.BlocksAvailable),
+			oldest,
+			strconv.FormatFloat(r.AgeDays, 'f', 1, 64),
+			r.Error,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
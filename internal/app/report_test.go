@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+type checkingPool struct {
+	*mocks.MockNNTPPool
+	*mocks.MockArticleChecker
+}
+
+func TestReport_RowsAndCSV(t *testing.T) {
+	dir := t.TempDir()
+	posted := time.Now().Add(-48 * time.Hour)
+	writeTestNzbPosted(t, dir, "movies/b.nzb", 1000, posted)
+	writeTestNzb(t, dir, "a.NZB", 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.nzb"), []byte("not xml"), 0644))
+
+	paths, err := findNzbs(dir)
+	require.NoError(t, err)
+	require.Len(t, paths, 3)
+	assert.Equal(t, filepath.Join(dir, "a.NZB"), paths[0])
+
+	ctrl := gomock.NewController(t)
+	pool := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	pool.MockArticleChecker.EXPECT().Stat(gomock.Any(), "seg@test").Return(&nntppool.StatResult{}, nil)
+
+	row := reportNzb(context.Background(), pool, paths[2], "movies/b.nzb", repairnzb.ScanOptions{})
+	assert.Empty(t, row.Error)
+	assert.Equal(t, "healthy", row.Verdict)
+	assert.Equal(t, 1, row.Segments)
+	assert.InDelta(t, 1.0, row.Availability, 0.001)
+	assert.InDelta(t, 2.0, row.AgeDays, 0.1)
+
+	broken := reportNzb(context.Background(), pool, paths[1], "broken.nzb", repairnzb.ScanOptions{})
+	assert.NotEmpty(t, broken.Error, "unreadable nzbs are reported, not fatal")
+
+	var out bytes.Buffer
+	require.NoError(t, writeReportCSV(&out, []reportRow{row, broken}))
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, reportHeader, records[0])
+	assert.Equal(t, []string{"movies/b.nzb", "1000", "1", "1", "1.0000", "healthy", "0", "0"}, records[1][:8])
+	assert.Equal(t, broken.Error, records[2][len(reportHeader)-1])
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// RescanOptions are the flags of the rescan command.
+type RescanOptions struct {
+	// Remote is the API address of the watcher. Empty uses api.listen from
+	// the config.
+	Remote string
+}
+
+// RunRescan makes a running watcher scan every watch directory right away
+// instead of at its next scan interval, e.g. after restoring NZBs from a
+// backup. It returns once the scans started.
+func RunRescan(ctx context.Context, cfg config.Config, opts RescanOptions, w io.Writer) error {
+	remote := opts.Remote
+	if remote == "" {
+		if cfg.API.Listen == "" {
+			return errors.New("rescan talks to a running watcher: set api.listen in the config or use --remote")
+		}
+		remote = clientAddr(cfg.API.Listen)
+	}
+
+	c, err := client.New(remote)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := c.Rescan(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start the rescan: %w", err)
+	}
+
+	for _, dir := range dirs {
+		_, _ = fmt.Fprintf(w, "rescanning\t%s\n", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/api"
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+func TestRunRescan(t *testing.T) {
+	a, q := newTestAdmission(t, config.Config{})
+	srv := api.New(&apiBackend{queue: q, admit: a}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv.EnableRescan(func() []string { return []string{"/watch/a", "/watch/b"} })
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, RunRescan(context.Background(), config.Config{}, RescanOptions{Remote: ts.URL}, &out))
+	assert.Equal(t, "rescanning\t/watch/a\nrescanning\t/watch/b\n", out.String())
+
+	err := RunRescan(context.Background(), config.Config{}, RescanOptions{}, &out)
+	assert.ErrorContains(t, err, "api.listen")
+}
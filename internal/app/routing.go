@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// routedPools hands out the download and upload pools for the provider sets
+// of a route. Pools for restricted provider sets are created on first use and
+// reused, each opening its own connections to the providers it contains,
+// within the shared connection limit.
+type routedPools struct {
+	ctx             context.Context
+	providers       []config.ProviderConfig
+	uploadProviders []config.ProviderConfig
+	opts            poolOptions
+	def             repairnzb.NNTPPool
+	defUpload       repairnzb.NNTPPool
+	createDownload  poolCreator
+	createUpload    poolCreator
+
+	mu          sync.Mutex
+	pools       map[string]repairnzb.NNTPPool
+	uploadPools map[string]repairnzb.NNTPPool
+}
+
+func newRoutedPools(ctx context.Context, cfg config.Config, def, defUpload repairnzb.NNTPPool, opts poolOptions) *routedPools {
+	createDownload, createUpload := watcherPoolCreators(opts)
+
+	return &routedPools{
+		ctx:             ctx,
+		providers:       cfg.DownloadProviders,
+		uploadProviders: cfg.UploadProviders,
+		opts:            opts,
+		def:             def,
+		defUpload:       defUpload,
+		createDownload:  createDownload,
+		createUpload:    createUpload,
+		pools:           make(map[string]repairnzb.NNTPPool),
+		uploadPools:     make(map[string]repairnzb.NNTPPool),
+	}
+}
+
+// download returns the pool restricted to the named providers, or the default
+// pool when names is empty.
+func (r *routedPools) download(names []string) (repairnzb.NNTPPool, error) {
+	if len(names) == 0 {
+		return r.def, nil
+	}
+
+	return r.subset(r.pools, r.providers, names, r.createDownload)
+}
+
+// upload returns the upload pool restricted to the named upload providers, or
+// the default upload pool when names is empty.
+func (r *routedPools) upload(names []string) (repairnzb.NNTPPool, error) {
+	if len(names) == 0 {
+		return r.defUpload, nil
+	}
+
+	return r.subset(r.uploadPools, r.uploadProviders, names, r.createUpload)
+}
+
+// subset returns the pool in pools for the named providers, creating it on
+// first use.
+func (r *routedPools) subset(
+	pools map[string]repairnzb.NNTPPool,
+	providers []config.ProviderConfig,
+	names []string,
+	create poolCreator,
+) (repairnzb.NNTPPool, error) {
+	key := strings.Join(names, ",")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := pools[key]; ok {
+		return p, nil
+	}
+
+	subset := make([]config.ProviderConfig, 0, len(names))
+	for _, p := range providers {
+		if slices.Contains(names, p.DisplayName()) {
+			subset = append(subset, p)
+		}
+	}
+
+	p, err := create(r.ctx, subset, r.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pools[key] = p
+
+	return p, nil
+}
+
+// Close closes the pools created for routes. The default pools are owned by the caller.
+func (r *routedPools) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.pools {
+		_ = p.Close()
+	}
+	for _, p := range r.uploadPools {
+		_ = p.Close()
+	}
+}
+
+// validateRouteProviders checks that every provider referenced by a route is a
+// configured download provider.
+func validateRouteProviders(cfg config.Config, names []string) error {
+	return validateProviderNames(cfg.DownloadProviders, "download", names)
+}
+
+// validateRouteUploadProviders checks that every upload provider referenced by
+// a route is a configured upload provider.
+func validateRouteUploadProviders(cfg config.Config, names []string) error {
+	return validateProviderNames(cfg.UploadProviders, "upload", names)
+}
+
+func validateProviderNames(providers []config.ProviderConfig, kind string, names []string) error {
+	for _, name := range names {
+		found := slices.ContainsFunc(providers, func(p config.ProviderConfig) bool {
+			return p.DisplayName() == name
+		})
+		if !found {
+			return fmt.Errorf("route references unknown %s provider %q", kind, name)
+		}
+	}
+
+	return nil
+}
+
+// routedConfig applies the overrides of a route to the repair configuration.
+func routedConfig(cfg config.Config, route config.RouteConfig) config.Config {
+	if route.ObfuscationPolicy != "" {
+		cfg.Upload.ObfuscationPolicy = route.ObfuscationPolicy
+	}
+
+	if route.HealthyOutput != "" {
+		cfg.HealthyOutput = route.HealthyOutput
+	}
+
+	if route.PostAddTo != "" {
+		cfg.PostAddTo = route.PostAddTo
+	}
+
+	return cfg
+}
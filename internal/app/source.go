@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+// sourceMissing reports whether the NZB of job was deleted or moved away
+// since it was queued, marking the job missing_source so it does not fail
+// with an open error halfway through the repair.
+func sourceMissing(ctx context.Context, dbQueue *queue.Queue, job *queue.Job, logger *slog.Logger) bool {
+	_, err := os.Stat(job.FilePath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+
+	logger.WarnContext(ctx, "NZB file disappeared before processing", "job_id", job.ID, "filepath", job.FilePath)
+	if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusMissingSource, "nzb file was deleted or moved before processing"); updateErr != nil {
+		logger.ErrorContext(ctx, "Failed to update job status to missing_source", "job_id", job.ID, "error", updateErr)
+	}
+
+	return true
+}
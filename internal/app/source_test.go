@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMissing(t *testing.T) {
+	a, q := newTestAdmission(t, config.Config{})
+
+	dir := t.TempDir()
+	present := writeTestNzb(t, dir, "present.nzb", 1000)
+	gone := writeTestNzb(t, dir, "gone.nzb", 1000)
+	require.NoError(t, q.AddJob(present, "present.nzb"))
+	require.NoError(t, q.AddJob(gone, "gone.nzb"))
+	require.NoError(t, os.Remove(gone))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, path := range []string{present, gone} {
+		job, err := q.GetJobByPath(path)
+		require.NoError(t, err)
+		assert.Equal(t, path == gone, sourceMissing(context.Background(), q, job, logger), path)
+	}
+
+	job, err := q.GetJobByPath(gone)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusMissingSource, job.Status)
+
+	// The job is queued again once the file is back
+	writeTestNzb(t, dir, "gone.nzb", 1000)
+	require.NoError(t, a.AddJob(gone, "gone.nzb"))
+	job, err = q.GetJobByPath(gone)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StatusPending, job.Status)
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"golang.org/x/sync/errgroup"
+)
+
+const speedtestSizeMBDefault = 200
+
+// SpeedtestOptions are the flags of the speedtest command.
+type SpeedtestOptions struct {
+	// Provider is the name (or host) of the provider to test.
+	Provider string
+	// NzbFile supplies the articles to download. They should be available on
+	// the provider, e.g. a recent post known to be complete.
+	NzbFile string
+	// SizeMB is the amount of data downloaded per connection count.
+	SizeMB int
+	// Connections are the connection counts to test. Defaults to the
+	// connections configured for the provider.
+	Connections []int
+	// JSON prints the results as JSON instead of a table.
+	JSON bool
+}
+
+// speedtestResult is the throughput measured with one connection count.
+type speedtestResult struct {
+	Connections                 int     `json:"connections"`
+	Bytes                       int64   `json:"bytes"`
+	Seconds                     float64 `json:"seconds"`
+	BytesPerSecond              float64 `json:"bytes_per_second"`
+	PerConnectionBytesPerSecond float64 `json:"per_connection_bytes_per_second"`
+	Missing                     int64   `json:"missing,omitempty"`
+	Error                       string  `json:"error,omitempty"`
+}
+
+// RunSpeedtest downloads SizeMB from a single provider with each of the
+// requested connection counts and reports the aggregate and per-connection
+// throughput, to help choose the connections setting.
+func RunSpeedtest(ctx context.Context, cfg config.Config, opts SpeedtestOptions, w io.Writer) error {
+	p, ok := findProvider(cfg, opts.Provider)
+	if !ok {
+		return fmt.Errorf("provider %q is not configured", opts.Provider)
+	}
+
+	if opts.NzbFile == "" {
+		return errors.New("an nzb with articles available on the provider is required")
+	}
+
+	if opts.SizeMB <= 0 {
+		opts.SizeMB = speedtestSizeMBDefault
+	}
+
+	if len(opts.Connections) == 0 {
+		opts.Connections = []int{p.Connections}
+	}
+
+	segments, err := benchSegments(opts.NzbFile, math.MaxInt)
+	if err != nil {
+		return err
+	}
+
+	results := make([]speedtestResult, 0, len(opts.Connections))
+	for _, conns := range opts.Connections {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if conns <= 0 {
+			return fmt.Errorf("invalid connection count %d", conns)
+		}
+
+		results = append(results, speedtestProvider(ctx, p, conns, segments, int64(opts.SizeMB)<<20))
+	}
+
+	if opts.JSON {
+		return writeJSON(w, struct {
+			Provider string            `json:"provider"`
+			Results  []speedtestResult `json:"results"`
+		}{Provider: p.DisplayName(), Results: results})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Speed test of %s\n", p.DisplayName())
+	_, _ = fmt.Fprintln(tw, "CONNECTIONS\tDOWNLOADED\tTIME\tAGGREGATE\tPER CONNECTION\tNOTE")
+	for _, r := range results {
+		note := ""
+		if r.Missing > 0 {
+			note = fmt.Sprintf("%d missing", r.Missing)
+		}
+		if r.Error != "" {
+			note = "error: " + r.Error
+		}
+
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s/s\t%s/s\t%s\n",
+			r.Connections,
+			formatBytes(r.Bytes),
+			time.Duration(r.Seconds*float64(time.Second)).Round(time.Millisecond),
+			formatBytes(int64(r.BytesPerSecond)),
+			formatBytes(int64(r.PerConnectionBytesPerSecond)),
+			note,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// findProvider returns the download or upload provider called name.
+func findProvider(cfg config.Config, name string) (config.ProviderConfig, bool) {
+	for _, p := range append(append([]config.ProviderConfig{}, cfg.DownloadProviders...), cfg.UploadProviders...) {
+		if p.DisplayName() == name || p.Host == name {
+			return p, true
+		}
+	}
+
+	return config.ProviderConfig{}, false
+}
+
+// speedtestProvider measures p with conns connections on a fresh pool.
+func speedtestProvider(ctx context.Context, p config.ProviderConfig, conns int, segments []nzbparser.NzbSegment, target int64) speedtestResult {
+	r := speedtestResult{Connections: conns}
+
+	p.Connections = conns
+	pool, err := createDownloadPool(ctx, []config.ProviderConfig{p}, poolOptions{})
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	n, missing, d, err := speedtestDownload(ctx, pool, segments, conns, target)
+	r.Bytes, r.Missing, r.Seconds = n, missing, d.Seconds()
+	if d > 0 {
+		r.BytesPerSecond = float64(n) / d.Seconds()
+		r.PerConnectionBytesPerSecond = r.BytesPerSecond / float64(conns)
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+// speedtestDownload fetches segments, starting over once all were fetched,
+// with the given number of workers until target bytes were downloaded. It
+// returns the downloaded bytes, the number of missing articles and the time
+// it took.
+func speedtestDownload(ctx context.Context, pool repairnzb.NNTPPool, segments []nzbparser.NzbSegment, workers int, target int64) (int64, int64, time.Duration, error) {
+	var downloaded, missing, next atomic.Int64
+
+	eg, egCtx := errgroup.WithContext(ctx)
+
+	started := time.Now()
+	for range max(workers, 1) {
+		eg.Go(func() error {
+			for downloaded.Load() < target {
+				if m := missing.Load(); m >= int64(len(segments)) && downloaded.Load() == 0 {
+					return errors.New("none of the articles is available on the provider")
+				}
+
+				s := segments[(next.Add(1)-1)%int64(len(segments))]
+				cw := &countingWriter{n: &downloaded}
+				if _, err := pool.BodyStream(egCtx, s.Id, cw); err != nil {
+					if errors.Is(err, nntppool.ErrArticleNotFound) {
+						missing.Add(1)
+						continue
+					}
+
+					return fmt.Errorf("failed to download %s: %w", s.Id, err)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+
+	return downloaded.Load(), missing.Load(), time.Since(started), err
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+)
+
+func TestSpeedtestDownload_RepeatsArticlesUntilTarget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	pool.EXPECT().BodyStream(gomock.Any(), "a@test", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(make([]byte, 1000))
+			return &nntppool.ArticleBody{}, err
+		}).Times(5)
+	pool.EXPECT().BodyStream(gomock.Any(), "b@test", gomock.Any()).
+		Return(nil, nntppool.ErrArticleNotFound).MinTimes(4)
+
+	segments := []nzbparser.NzbSegment{{Id: "a@test"}, {Id: "b@test"}}
+	n, missing, _, err := speedtestDownload(context.Background(), pool, segments, 1, 5000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), n)
+	assert.Equal(t, int64(4), missing)
+}
+
+func TestSpeedtestDownload_FailsWhenNothingIsAvailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	pool.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, nntppool.ErrArticleNotFound).Times(2)
+
+	segments := []nzbparser.NzbSegment{{Id: "a@test"}, {Id: "b@test"}}
+	_, _, _, err := speedtestDownload(context.Background(), pool, segments, 1, 5000)
+	require.Error(t, err)
+}
+
+func TestFindProvider(t *testing.T) {
+	cfg := config.Config{
+		DownloadProviders: []config.ProviderConfig{{Name: "main", Host: "news.example.com"}},
+		UploadProviders:   []config.ProviderConfig{{Host: "upload.example.com"}},
+	}
+
+	p, ok := findProvider(cfg, "main")
+	require.True(t, ok)
+	assert.Equal(t, "news.example.com", p.Host)
+
+	_, ok = findProvider(cfg, "upload.example.com")
+	assert.True(t, ok)
+
+	_, ok = findProvider(cfg, "missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/events"
+)
+
+// Stall actions accepted in stall_action.
+const (
+	stallActionRetry = "retry"
+	stallActionFail  = "fail"
+)
+
+// errStalled is the cancel cause of a job that made no progress for the
+// stall timeout.
+var errStalled = errors.New("stalled")
+
+// minStallCheckInterval bounds how often a stall watch checks for progress.
+const minStallCheckInterval = 100 * time.Millisecond
+
+// stallWatch cancels the context of a job once the job stops making
+// progress. It is the progress function of the repair and wraps the job's
+// event publisher to know the current phase.
+type stallWatch struct {
+	timeout time.Duration
+	next    events.Publisher
+	cancel  context.CancelCauseFunc
+	ctx     context.Context
+	done    chan struct{}
+	stopped sync.Once
+
+	mu       sync.Mutex
+	phase    string
+	lastSeen time.Time
+}
+
+// Ensure stallWatch implements events.Publisher
+var _ events.Publisher = (*stallWatch)(nil)
+
+// watchStall returns a watch whose context is canceled with errStalled when
+// progress is not reported for timeout. A timeout <= 0 never cancels. The
+// watch must be stopped once the job is done.
+func watchStall(ctx context.Context, timeout time.Duration, next events.Publisher) *stallWatch {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	w := &stallWatch{
+		timeout:  timeout,
+		next:     next,
+		cancel:   cancel,
+		ctx:      jobCtx,
+		done:     make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+
+	if timeout > 0 {
+		go w.run()
+	}
+
+	return w
+}
+
+// Context is the context the job runs with.
+func (w *stallWatch) Context() context.Context {
+	return w.ctx
+}
+
+// progress records that the job advanced.
+func (w *stallWatch) progress() {
+	w.mu.Lock()
+	w.lastSeen = time.Now()
+	w.mu.Unlock()
+}
+
+// Publish records the phase of phase events and forwards e.
+func (w *stallWatch) Publish(ctx context.Context, e events.Event) {
+	if e.Type == events.PhaseStarted {
+		w.mu.Lock()
+		w.phase = e.Phase
+		w.mu.Unlock()
+	}
+
+	w.next.Publish(ctx, e)
+}
+
+// Stop ends the watch and releases its context.
+func (w *stallWatch) Stop() {
+	w.stopped.Do(func() {
+		close(w.done)
+		w.cancel(nil)
+	})
+}
+
+// Err returns the stall error if the job was canceled for stalling.
+func (w *stallWatch) Err() error {
+	if cause := context.Cause(w.ctx); errors.Is(cause, errStalled) {
+		return cause
+	}
+
+	return nil
+}
+
+func (w *stallWatch) run() {
+	ticker := time.NewTicker(max(w.timeout/4, minStallCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			idle, phase := time.Since(w.lastSeen), w.phase
+			w.mu.Unlock()
+
+			if idle < w.timeout {
+				continue
+			}
+
+			if phase == "" {
+				phase = "setup"
+			}
+
+			w.cancel(fmt.Errorf("%w: no progress during %s for %s", errStalled, phase, idle.Round(time.Second)))
+
+			return
+		}
+	}
+}
+
+// validateStallAction rejects unknown stall_action values.
+func validateStallAction(action string) error {
+	switch action {
+	case stallActionRetry, stallActionFail:
+		return nil
+	}
+
+	return fmt.Errorf("unknown stall_action %q, expected retry or fail", action)
+}
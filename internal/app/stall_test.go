@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/events"
+)
+
+func TestStallWatch_CancelsJobWithoutProgress(t *testing.T) {
+	w := watchStall(context.Background(), 200*time.Millisecond, events.Discard)
+	defer w.Stop()
+
+	w.Publish(context.Background(), events.Event{Type: events.PhaseStarted, Phase: "download"})
+
+	select {
+	case <-w.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled job was not canceled")
+	}
+
+	require.ErrorIs(t, w.Err(), errStalled)
+	assert.Contains(t, w.Err().Error(), "no progress during download")
+}
+
+func TestStallWatch_ProgressKeepsJobAlive(t *testing.T) {
+	w := watchStall(context.Background(), 300*time.Millisecond, events.Discard)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		w.progress()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	assert.NoError(t, w.Context().Err())
+
+	w.Stop()
+	assert.Error(t, w.Context().Err())
+	assert.NoError(t, w.Err(), "stopping is not a stall")
+}
+
+func TestStallWatch_DisabledWithoutTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := watchStall(ctx, 0, events.Discard)
+	defer w.Stop()
+
+	cancel()
+	<-w.Context().Done()
+	assert.NoError(t, w.Err(), "a canceled watcher is not a stall")
+}
+
+func TestValidateStallAction(t *testing.T) {
+	assert.NoError(t, validateStallAction("retry"))
+	assert.NoError(t, validateStallAction("fail"))
+	assert.Error(t, validateStallAction("ignore"))
+}
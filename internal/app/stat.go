@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// StatOptions are the flags of the stat command.
+type StatOptions struct {
+	// Concurrency is the number of articles checked at once.
+	Concurrency int
+	// Head checks articles with HEAD instead of STAT.
+	Head bool
+	// Verdict also reads the par2 block size to tell whether the NZB can be
+	// repaired.
+	Verdict bool
+	// JSON prints the result as JSON instead of a table.
+	JSON bool
+}
+
+// fileStat is the availability of one NZB file in stat and report output.
+type fileStat struct {
+	Name         string  `json:"name"`
+	Par2         bool    `json:"par2"`
+	Segments     int     `json:"segments"`
+	Available    int     `json:"available"`
+	Missing      int     `json:"missing"`
+	Availability float64 `json:"availability"`
+}
+
+// RunStat checks every segment of the NZB at path with STAT (or HEAD) and
+// prints the availability of each file, without downloading any body. With
+// opts.Verdict it also tells whether the NZB can be repaired.
+func RunStat(ctx context.Context, cfg config.Config, path string, opts StatOptions, w io.Writer) error {
+	pool, err := createDownloadPool(ctx, cfg.DownloadProviders, poolOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	checker, ok := pool.(repairnzb.CheckingPool)
+	if !ok {
+		return errors.New("download pool cannot check articles")
+	}
+
+	nzb, err := parseNzbFile(path)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	scanOpts := repairnzb.ScanOptions{Concurrency: opts.Concurrency, Head: opts.Head}
+
+	var r *repairnzb.Repairability
+	if opts.Verdict {
+		r, err = repairnzb.AssessRepairability(ctx, checker, nzb, scanOpts)
+	} else {
+		var a *repairnzb.Availability
+		a, err = repairnzb.ScanAvailability(ctx, checker, nzb, scanOpts)
+		r = &repairnzb.Repairability{Availability: a}
+	}
+	if err != nil {
+		return err
+	}
+
+	a := r.Availability
+	segments, available := a.Totals()
+	if opts.JSON {
+		return writeJSON(w, struct {
+			Nzb          string      `json:"nzb"`
+			Segments     int         `json:"segments"`
+			Available    int         `json:"available"`
+			Missing      int         `json:"missing"`
+			Availability float64     `json:"availability"`
+			Verdict      *verdictOut `json:"verdict,omitempty"`
+			Files        []fileStat  `json:"files"`
+		}{
+			Nzb:          path,
+			Segments:     segments,
+			Available:    available,
+			Missing:      segments - available,
+			Availability: ratio(available, segments),
+			Verdict:      newVerdictOut(r),
+			Files:        fileStats(a),
+		})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tSEGMENTS\tAVAILABLE\tMISSING\tAVAILABILITY")
+	for _, f := range fileStats(a) {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\n", f.Name, f.Segments, f.Available, f.Missing, f.Availability*100)
+	}
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%d\t%.1f%%\n", segments, available, segments-available, ratio(available, segments)*100)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(w, "checked %d segments in %s\n", segments, time.Since(started).Round(time.Millisecond))
+	if v := newVerdictOut(r); v != nil {
+		_, _ = fmt.Fprintf(w, "verdict: %s\n", v)
+	}
+
+	return nil
+}
+
+// verdictOut is the repairability verdict in stat and report output.
+type verdictOut struct {
+	Verdict         repairnzb.Verdict `json:"verdict"`
+	BlocksNeeded    int               `json:"blocks_needed,omitempty"`
+	BlocksAvailable int               `json:"blocks_available"`
+}
+
+// newVerdictOut returns the verdict of r, nil when none was assessed.
+func newVerdictOut(r *repairnzb.Repairability) *verdictOut {
+	if r.Verdict == "" {
+		return nil
+	}
+
+	return &verdictOut{Verdict: r.Verdict, BlocksNeeded: r.BlocksNeeded, BlocksAvailable: r.BlocksAvailable}
+}
+
+func (v *verdictOut) String() string {
+	switch {
+	case v.Verdict == repairnzb.VerdictUnrepairable && v.BlocksAvailable == 0:
+		return fmt.Sprintf("%s (no recovery blocks available)", v.Verdict)
+	case v.Verdict == repairnzb.VerdictRepairable || v.Verdict == repairnzb.VerdictUnrepairable:
+		return fmt.Sprintf("%s (%d blocks needed, %d available)", v.Verdict, v.BlocksNeeded, v.BlocksAvailable)
+	case v.Verdict == repairnzb.VerdictUnknown:
+		return fmt.Sprintf("%s (no complete par2 file, %d blocks available)", v.Verdict, v.BlocksAvailable)
+	default:
+		return string(v.Verdict)
+	}
+}
+
+// parseNzbFile reads and parses the NZB at path.
+func parseNzbFile(path string) (*nzbparser.Nzb, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nzb: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	nzb, err := nzbparser.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nzb: %w", err)
+	}
+
+	return nzb, nil
+}
+
+func fileStats(a *repairnzb.Availability) []fileStat {
+	files := make([]fileStat, 0, len(a.Files))
+	for _, f := range a.Files {
+		files = append(files, fileStat{
+			Name:         f.File.Filename,
+			Par2:         f.Par2,
+			Segments:     f.Segments(),
+			Available:    f.Available(),
+			Missing:      len(f.Missing),
+			Availability: f.Ratio(),
+		})
+	}
+
+	return files
+}
+
+// ratio returns n/total, 1 when total is 0.
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+
+	return float64(n) / float64(total)
+}
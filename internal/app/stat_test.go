@@ -0,0 +1,34 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+func TestFileStats(t *testing.T) {
+	a := &repairnzb.Availability{Files: []repairnzb.FileAvailability{
+		{
+			File:    nzbparser.NzbFile{Filename: "show.mkv", Segments: nzbparser.NzbSegments{{Id: "1@test"}, {Id: "2@test"}}},
+			Missing: nzbparser.NzbSegments{{Id: "2@test"}},
+		},
+		{File: nzbparser.NzbFile{Filename: "show.par2"}, Par2: true},
+	}}
+
+	assert.Equal(t, []fileStat{
+		{Name: "show.mkv", Segments: 2, Available: 1, Missing: 1, Availability: 0.5},
+		{Name: "show.par2", Par2: true, Availability: 1},
+	}, fileStats(a))
+	assert.InDelta(t, 1.0, ratio(0, 0), 0.001)
+}
+
+func TestVerdictOut(t *testing.T) {
+	assert.Nil(t, newVerdictOut(&repairnzb.Repairability{}), "no verdict without --verdict")
+
+	v := newVerdictOut(&repairnzb.Repairability{Verdict: repairnzb.VerdictRepairable, BlocksNeeded: 3, BlocksAvailable: 10})
+	assert.Equal(t, "repairable (3 blocks needed, 10 available)", v.String())
+	assert.Equal(t, "healthy", newVerdictOut(&repairnzb.Repairability{Verdict: repairnzb.VerdictHealthy}).String())
+}
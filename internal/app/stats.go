@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// RunStats prints the recorded per-provider bandwidth usage for month, as a
+// table or, with asJSON, as a JSON document. An empty month selects the current one.
+func RunStats(ctx context.Context, cfg config.Config, dbPath string, month string, asJSON bool, w io.Writer) error {
+	if month == "" {
+		month = queue.UsageMonth(time.Now())
+	}
+
+	dbQueue, err := queue.NewQueue(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize queue: %w", err)
+	}
+	defer func() {
+		_ = dbQueue.Close()
+	}()
+
+	usage, err := dbQueue.GetProviderUsage(month)
+	if err != nil {
+		return err
+	}
+
+	caps := monthlyCaps(cfg)
+
+	if asJSON {
+		return writeJSON(w, struct {
+			Month     string                 `json:"month"`
+			Providers []client.ProviderStats `json:"providers"`
+		}{Month: month, Providers: providerStats(usage, caps)})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Bandwidth usage for %s\n", month)
+	_, _ = fmt.Fprintln(tw, "PROVIDER\tDOWNLOADED\tUPLOADED\tCAP\tCOMPRESSED")
+	for _, u := range usage {
+		capStr := "-"
+		if limit, ok := caps[u.Provider]; ok {
+			capStr = fmt.Sprintf("%s (%.1f%%)", formatBytes(limit), float64(u.DownloadedBytes+u.UploadedBytes)/float64(limit)*100)
+		}
+		compressed := "-"
+		if u.CompressedRawBytes > 0 {
+			compressed = fmt.Sprintf("%s -> %s (%.1f%%)", formatBytes(u.CompressedRawBytes), formatBytes(u.CompressedWireBytes), float64(u.CompressedWireBytes)/float64(u.CompressedRawBytes)*100)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Provider, formatBytes(u.DownloadedBytes), formatBytes(u.UploadedBytes), capStr, compressed)
+	}
+
+	return tw.Flush()
+}
+
+// monthlyCaps returns the configured monthly cap of every provider that has one.
+func monthlyCaps(cfg config.Config) map[string]int64 {
+	caps := make(map[string]int64)
+	for _, p := range append(append([]config.ProviderConfig{}, cfg.DownloadProviders...), cfg.UploadProviders...) {
+		if p.MonthlyCapBytes > 0 {
+			caps[p.DisplayName()] = p.MonthlyCapBytes
+		}
+	}
+
+	return caps
+}
+
+// providerStats converts recorded usage to its API form.
+func providerStats(usage []queue.ProviderUsage, caps map[string]int64) []client.ProviderStats {
+	providers := make([]client.ProviderStats, 0, len(usage))
+	for _, u := range usage {
+		providers = append(providers, client.ProviderStats{
+			Provider:        u.Provider,
+			DownloadedBytes: u.DownloadedBytes,
+			UploadedBytes:   u.UploadedBytes,
+			MonthlyCapBytes: caps[u.Provider],
+
+			CompressedRawBytes:  u.CompressedRawBytes,
+			CompressedWireBytes: u.CompressedWireBytes,
+		})
+	}
+
+	return providers
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write json: %w", err)
+	}
+
+	return nil
+}
+
+// formatBytes renders n using binary units, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
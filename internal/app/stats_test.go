@@ -0,0 +1,56 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestRunStats_JSON(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := queue.NewQueue(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, q.AddProviderUsage("main", "2025-01", 2048, 10))
+	require.NoError(t, q.Close())
+
+	cfg := config.Config{DownloadProviders: []config.ProviderConfig{{Name: "main", Host: "news.example.com", MonthlyCapBytes: 4096}}}
+
+	var out bytes.Buffer
+	require.NoError(t, RunStats(context.Background(), cfg, dbPath, "2025-01", true, &out))
+	assert.JSONEq(t, `{
+		"month": "2025-01",
+		"providers": [
+			{"provider": "main", "downloaded_bytes": 2048, "uploaded_bytes": 10, "monthly_cap_bytes": 4096}
+		]
+	}`, out.String())
+
+	out.Reset()
+	require.NoError(t, RunStats(context.Background(), cfg, dbPath, "2025-01", false, &out))
+	assert.Contains(t, out.String(), "2.0 KiB")
+}
+
+func TestRunStatus_FailuresPerDay(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := queue.NewQueue(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(job.ID, queue.StatusFailed, "boom"))
+	require.NoError(t, q.Close())
+
+	var out bytes.Buffer
+	require.NoError(t, RunStatus(context.Background(), config.Config{}, dbPath, StatusOptions{}, &out))
+	assert.Contains(t, out.String(), "FAILED ON")
+	assert.Contains(t, out.String(), time.Now().UTC().Format(time.DateOnly)+"  1")
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/pkg/client"
+)
+
+// StatusOptions are the flags of the status command.
+type StatusOptions struct {
+	// JSON prints the status as a JSON document instead of tables.
+	JSON bool
+	// Remote is the API address of a running watcher, see QueueAddOptions.
+	Remote string
+}
+
+// RunStatus prints the number of jobs per status, the estimated time until the
+// queue is done and the jobs being processed.
+func RunStatus(ctx context.Context, cfg config.Config, dbPath string, opts StatusOptions, w io.Writer) error {
+	backend, closeBackend, err := openQueueBackend(ctx, cfg, dbPath, opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer closeBackend()
+
+	stats, err := backend.Stats(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to get job counts: %w", err)
+	}
+
+	processing, err := backend.ListJobs(ctx, client.ListJobsOptions{Status: string(queue.StatusProcessing)})
+	if err != nil {
+		return fmt.Errorf("failed to list processing jobs: %w", err)
+	}
+
+	if processing == nil {
+		processing = []client.Job{}
+	}
+
+	if opts.JSON {
+		return writeJSON(w, struct {
+			Jobs             map[string]int64       `json:"jobs"`
+			OldestPendingAge time.Duration          `json:"oldest_pending_age,omitempty"`
+			FailuresPerDay   []client.DailyFailures `json:"failures_per_day,omitempty"`
+			QueueETA         time.Duration          `json:"queue_eta,omitempty"`
+			Throughput       float64                `json:"throughput,omitempty"`
+			Processing       []client.Job           `json:"processing"`
+			Nodes            []client.Node          `json:"nodes,omitempty"`
+		}{Jobs: stats.Jobs, OldestPendingAge: stats.OldestPendingAge, FailuresPerDay: stats.FailuresPerDay, QueueETA: stats.QueueETA, Throughput: stats.Throughput, Processing: processing, Nodes: stats.Nodes})
+	}
+
+	statuses := make([]string, 0, len(stats.Jobs))
+	for status := range stats.Jobs {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STATUS\tJOBS")
+	for _, status := range statuses {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", status, stats.Jobs[status])
+	}
+
+	// Jobs waiting for less than a minute are just being picked up.
+	waiting := stats.OldestPendingAge >= time.Minute
+	if waiting || stats.QueueETA > 0 {
+		_, _ = fmt.Fprintln(tw)
+	}
+	if waiting {
+		_, _ = fmt.Fprintf(tw, "Oldest pending\t%s\n", formatETA(stats.OldestPendingAge))
+	}
+	if stats.QueueETA > 0 {
+		_, _ = fmt.Fprintf(tw, "Queue ETA\t%s (%.1f MB/s per worker)\n", formatETA(stats.QueueETA), stats.Throughput/1e6)
+	}
+
+	if len(stats.FailuresPerDay) > 0 {
+		_, _ = fmt.Fprintln(tw)
+		_, _ = fmt.Fprintln(tw, "FAILED ON\tJOBS")
+		for _, d := range stats.FailuresPerDay {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\n", d.Day, d.Failures)
+		}
+	}
+
+	if len(processing) > 0 {
+		_, _ = fmt.Fprintln(tw)
+		_, _ = fmt.Fprintln(tw, "PROCESSING\tPROGRESS\tETA\tPATH")
+		for _, j := range processing {
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", j.ID, formatProgress(j.Progress), formatETA(j.ETA), j.FilePath)
+		}
+	}
+
+	if len(stats.Nodes) > 0 {
+		_, _ = fmt.Fprintln(tw)
+		_, _ = fmt.Fprintln(tw, "NODE\tSHARED\tLAST SEEN")
+		for _, n := range stats.Nodes {
+			_, _ = fmt.Fprintf(tw, "%s\t%t\t%s\n", n.Name, n.SharedStorage, n.LastSeenAt.Local().Format(time.DateTime))
+		}
+	}
+
+	return tw.Flush()
+}
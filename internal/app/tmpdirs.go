@@ -0,0 +1,186 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+const (
+	// jobTmpDirPrefix prefixes the per-job temporary directories of the watcher.
+	jobTmpDirPrefix = "job-"
+	// failedTmpDirPrefix prefixes the kept directories of failed jobs, which
+	// are named failed-job-<id>-<unix time of the failure>.
+	failedTmpDirPrefix = "failed-" + jobTmpDirPrefix
+)
+
+// jobTmpDirs hands out a temporary directory per watcher job, named after the
+// job ID so jobs whose NZBs share a name never collide, and removes the
+// directories left behind by jobs that are no longer running. Directories of
+// failed jobs can be kept for a retention period for debugging, and those of
+// interrupted downloads are kept while their job is queued, so it resumes.
+type jobTmpDirs struct {
+	base      string
+	retention time.Duration
+	// jobStatus returns the status of a job in the queue, or "" when it is
+	// unknown. Without it, no directory is kept for resuming.
+	jobStatus func(jobID int64) queue.JobStatus
+	now       func() time.Time
+	mu        sync.Mutex
+	active    map[int64]struct{}
+}
+
+func newJobTmpDirs(base string, retention time.Duration, jobStatus func(jobID int64) queue.JobStatus) *jobTmpDirs {
+	return &jobTmpDirs{
+		base:      base,
+		retention: retention,
+		jobStatus: jobStatus,
+		now:       time.Now,
+		active:    make(map[int64]struct{}),
+	}
+}
+
+// acquire marks the directory of jobID as in use and returns its path.
+func (d *jobTmpDirs) acquire(jobID int64) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active[jobID] = struct{}{}
+
+	return d.path(jobID)
+}
+
+// release removes the directory of jobID. With keep, the directory is
+// renamed instead and removed by reap once the retention period is over, so
+// a retry of the job starts from a clean directory. The directory of an
+// interrupted download whose job is pending again is left as it is, for the
+// job to resume it.
+func (d *jobTmpDirs) release(jobID int64, keep bool) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.active, jobID)
+
+	if d.resumable(jobID, queue.StatusPending) {
+		return "", nil
+	}
+
+	if keep {
+		kept := filepath.Join(d.base, fmt.Sprintf("%s%d-%d", failedTmpDirPrefix, jobID, d.now().Unix()))
+		if err := os.Rename(d.path(jobID), kept); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		return kept, nil
+	}
+
+	return "", os.RemoveAll(d.path(jobID))
+}
+
+// reap removes the job directories in base that belong to no running job,
+// e.g. after a crash, and kept directories of failed jobs older than the
+// retention period. It returns how many were removed. Other entries in base
+// are left alone, as are the directories of interrupted downloads whose job
+// is pending, or claimed and about to start.
+func (d *jobTmpDirs) reap() (int, error) {
+	entries, err := os.ReadDir(d.base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("failed to read temporary directory: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if failedAt, ok := parseFailedTmpDir(entry.Name()); ok {
+			if d.now().Sub(failedAt) < d.retention {
+				continue
+			}
+		} else {
+			jobID, ok := parseJobTmpDir(entry.Name())
+			if !ok {
+				continue
+			}
+
+			if _, running := d.active[jobID]; running {
+				continue
+			}
+
+			if d.resumable(jobID, queue.StatusPending, queue.StatusProcessing) {
+				continue
+			}
+		}
+
+		if err := os.RemoveAll(filepath.Join(d.base, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to remove stale job directory %q: %w", entry.Name(), err)
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// resumable reports whether the directory of jobID holds an interrupted
+// download and the job has one of statuses, so it resumes the download.
+func (d *jobTmpDirs) resumable(jobID int64, statuses ...queue.JobStatus) bool {
+	if d.jobStatus == nil || !repairnzb.HasResumeState(d.path(jobID)) {
+		return false
+	}
+
+	return slices.Contains(statuses, d.jobStatus(jobID))
+}
+
+func (d *jobTmpDirs) path(jobID int64) string {
+	return filepath.Join(d.base, fmt.Sprintf("%s%d", jobTmpDirPrefix, jobID))
+}
+
+func parseJobTmpDir(name string) (int64, bool) {
+	idStr, ok := strings.CutPrefix(name, jobTmpDirPrefix)
+	if !ok {
+		return 0, false
+	}
+
+	jobID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return jobID, true
+}
+
+func parseFailedTmpDir(name string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(name, failedTmpDirPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	_, unixStr, ok := strings.Cut(rest, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	unix, err := strconv.ParseInt(unixStr, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unix, 0), true
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestJobTmpDirs(t *testing.T) {
+	base := t.TempDir()
+	dirs := newJobTmpDirs(base, time.Hour, nil)
+
+	running := dirs.acquire(1)
+	assert.Equal(t, filepath.Join(base, "job-1"), running)
+	require.NoError(t, os.MkdirAll(running, 0755))
+
+	stale := filepath.Join(base, "job-2")
+	require.NoError(t, os.MkdirAll(stale, 0755))
+
+	other := filepath.Join(base, "unrelated")
+	require.NoError(t, os.MkdirAll(other, 0755))
+
+	reaped, err := dirs.reap()
+	require.NoError(t, err)
+	assert.Equal(t, 1, reaped)
+	assert.DirExists(t, running)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, other)
+
+	kept, err := dirs.release(1, false)
+	require.NoError(t, err)
+	assert.Empty(t, kept)
+	assert.NoDirExists(t, running)
+}
+
+func TestJobTmpDirs_KeepsFailedJobsForRetention(t *testing.T) {
+	base := t.TempDir()
+	now := time.Unix(1_700_000_000, 0)
+	dirs := newJobTmpDirs(base, time.Hour, nil)
+	dirs.now = func() time.Time { return now }
+
+	dir := dirs.acquire(7)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	kept, err := dirs.release(7, true)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "failed-job-7-1700000000"), kept)
+	assert.DirExists(t, kept)
+	assert.NoDirExists(t, dir)
+
+	now = now.Add(59 * time.Minute)
+	reaped, err := dirs.reap()
+	require.NoError(t, err)
+	assert.Zero(t, reaped)
+	assert.DirExists(t, kept)
+
+	now = now.Add(time.Minute)
+	reaped, err = dirs.reap()
+	require.NoError(t, err)
+	assert.Equal(t, 1, reaped)
+	assert.NoDirExists(t, kept)
+}
+
+func TestJobTmpDirs_ResumesInterruptedJob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+	par2 := mocks.NewMockPar2Executor(ctrl)
+	logger := slog.New(slog.DiscardHandler)
+
+	q, err := queue.NewQueue(filepath.Join(t.TempDir(), "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	nzbFile := filepath.Join(t.TempDir(), "show.nzb")
+	require.NoError(t, os.WriteFile(nzbFile, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] show.mkv yEnc (1/2)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments>
+   <segment bytes="8" number="1">1@test</segment>
+   <segment bytes="4" number="2">2@test</segment>
+  </segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] show.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2@test</segment></segments>
+ </file>
+</nzb>`), 0644))
+	require.NoError(t, q.AddJob(nzbFile, "show.nzb"))
+
+	segment := func(begin int64, data string) func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+		return func(_ context.Context, _ string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			for _, f := range onMeta {
+				f(nntppool.YEncMeta{PartBegin: begin, PartSize: int64(len(data))})
+			}
+			_, err := w.Write([]byte(data))
+			return &nntppool.ArticleBody{ExpectedCRC: crc32.ChecksumIEEE([]byte(data))}, err
+		}
+	}
+
+	// The watcher is stopped while the second segment downloads.
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.EXPECT().BodyStream(gomock.Any(), "1@test", gomock.Any(), gomock.Any()).DoAndReturn(segment(0, "aaaaaaaa")).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "2@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			cancel()
+			return nil, context.Canceled
+		}).Times(1)
+
+	cfg := config.Config{DownloadWorkers: 1}
+	base := t.TempDir()
+	dirs := newJobTmpDirs(base, time.Hour, queuedJobStatus(q))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	dir := dirs.acquire(job.ID)
+	_, err = repairnzb.RepairNzb(ctx, cfg, pool, nil, par2, nzbFile, "", dir)
+	require.NoError(t, err)
+	require.Error(t, ctx.Err())
+
+	finishGrouped(context.Background(), q, []*queue.Job{job}, queue.StatusPending, "", "", logger)
+	kept, err := dirs.release(job.ID, false)
+	require.NoError(t, err)
+	assert.Empty(t, kept)
+	assert.DirExists(t, dir, "the directory of the interrupted download is kept")
+
+	// After a restart, the directory is not taken for a stale one and the job
+	// downloads only the segment it is missing.
+	dirs = newJobTmpDirs(base, time.Hour, queuedJobStatus(q))
+	reaped, err := dirs.reap()
+	require.NoError(t, err)
+	assert.Zero(t, reaped)
+
+	job, err = q.GetNextJob()
+	require.NoError(t, err)
+	reaped, err = dirs.reap()
+	require.NoError(t, err)
+	assert.Zero(t, reaped, "a claimed job keeps its directory before it starts")
+	require.Equal(t, dir, dirs.acquire(job.ID))
+
+	pool.EXPECT().BodyStream(gomock.Any(), "2@test", gomock.Any(), gomock.Any()).DoAndReturn(segment(8, "bbbb")).Times(1)
+	result, err := repairnzb.RepairNzb(context.Background(), cfg, pool, nil, par2, nzbFile, "", dir)
+	require.NoError(t, err)
+	assert.True(t, result.Healthy)
+
+	require.NoError(t, q.UpdateJobStatus(job.ID, queue.StatusHealthy, ""))
+	_, err = dirs.release(job.ID, false)
+	require.NoError(t, err)
+	assert.NoDirExists(t, dir)
+}
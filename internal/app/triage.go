@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/hooks"
+	"github.com/javi11/nzb-repair/internal/queue"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// Watch modes accepted in watch_mode.
+const (
+	watchModeRepair = "repair"
+	watchModeTriage = "triage"
+)
+
+// validateWatchMode rejects unknown watch_mode values.
+func validateWatchMode(mode string) error {
+	switch mode {
+	case watchModeRepair, watchModeTriage:
+		return nil
+	}
+
+	return fmt.Errorf("unknown watch_mode %q, expected repair or triage", mode)
+}
+
+// triageJob records the repairability verdict of job instead of repairing it,
+// for watchers in triage mode. Healthy jobs need no repair and are marked healthy,
+// the others wait for approval. A job that cannot be assessed fails like a
+// failed repair.
+func triageJob(ctx context.Context, dbQueue *queue.Queue, pool repairnzb.NNTPPool, job *queue.Job, publisher events.Publisher, jobHooks *hooks.Runner, logger *slog.Logger) {
+	hookPayload := hooks.Payload{
+		JobID:        job.ID,
+		FilePath:     job.FilePath,
+		RelativePath: job.RelativePath,
+		RetryCount:   job.RetryCount,
+		Priority:     job.Priority,
+	}
+
+	r, err := assessJob(ctx, pool, job.FilePath)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Interrupted jobs are put back to pending on the next start.
+			return
+		}
+
+		logger.ErrorContext(ctx, "Triage failed", "job_id", job.ID, "filepath", job.FilePath, "error", err)
+		if updateErr := dbQueue.UpdateJobStatus(job.ID, queue.StatusFailed, err.Error()); updateErr != nil {
+			logger.ErrorContext(ctx, "Failed to update job status to failed", "job_id", job.ID, "error", updateErr)
+		}
+		publisher.Publish(ctx, events.Event{Type: events.JobFailed, Error: err.Error()})
+
+		hookPayload.Event = hooks.OnFailure
+		hookPayload.Error = err.Error()
+		applyHookPriority(ctx, dbQueue, job, jobHooks.Run(ctx, hookPayload), logger)
+		return
+	}
+
+	verdict := newVerdictOut(r)
+	status := queue.StatusAwaitingApproval
+	if r.Verdict == repairnzb.VerdictHealthy {
+		status = queue.StatusHealthy
+	}
+
+	logger.InfoContext(ctx, "Job triaged", "job_id", job.ID, "filepath", job.FilePath, "verdict", verdict.String(), "status", status)
+	if updateErr := dbQueue.TriageJob(job.ID, string(r.Verdict), status, verdict.String()); updateErr != nil {
+		logger.ErrorContext(ctx, "Failed to record job verdict", "job_id", job.ID, "error", updateErr)
+	}
+
+	publisher.Publish(ctx, events.Event{Type: events.JobTriaged, Fields: map[string]any{
+		"verdict":          string(r.Verdict),
+		"blocks_needed":    r.BlocksNeeded,
+		"blocks_available": r.BlocksAvailable,
+	}})
+
+	hookPayload.Event = hooks.OnTriage
+	hookPayload.Verdict = string(r.Verdict)
+	applyHookPriority(ctx, dbQueue, job, jobHooks.Run(ctx, hookPayload), logger)
+}
+
+// assessJob reads the NZB at path and assesses its repairability through pool.
+func assessJob(ctx context.Context, pool repairnzb.NNTPPool, path string) (*repairnzb.Repairability, error) {
+	checker, ok := pool.(repairnzb.CheckingPool)
+	if !ok {
+		return nil, errors.New("download pool cannot check articles")
+	}
+
+	nzb, err := parseNzbFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return repairnzb.AssessRepairability(ctx, checker, nzb, repairnzb.ScanOptions{})
+}
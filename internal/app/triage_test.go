@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/javi11/nzb-repair/internal/hooks"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+func TestTriageJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		statErr  error
+		status   queue.JobStatus
+		verdict  string
+		approved bool
+	}{
+		{name: "healthy", status: queue.StatusHealthy, verdict: "healthy"},
+		{name: "missing", statErr: nntppool.ErrArticleNotFound, status: queue.StatusAwaitingApproval, verdict: "unrepairable", approved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestNzb(t, t.TempDir(), "show.nzb", 1000)
+			q, err := queue.NewQueue(":memory:")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = q.Close() })
+
+			require.NoError(t, q.AddJob(path, "show.nzb"))
+			job, err := q.GetNextJob()
+			require.NoError(t, err)
+
+			ctrl := gomock.NewController(t)
+			pool := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+			pool.MockArticleChecker.EXPECT().Stat(gomock.Any(), "seg@test").Return(&nntppool.StatResult{}, tt.statErr)
+
+			var published []events.Event
+			bus := events.NewBus()
+			bus.Subscribe(events.SubscriberFunc(func(_ context.Context, e events.Event) {
+				published = append(published, e)
+			}))
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			triageJob(context.Background(), q, pool, job, events.ForJob(bus, job.ID, job.FilePath), hooks.New(nil, logger), logger)
+
+			triaged, err := q.GetJobByPath(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, triaged.Status)
+			assert.Equal(t, tt.verdict, triaged.Verdict)
+
+			require.Len(t, published, 1)
+			assert.Equal(t, events.JobTriaged, published[0].Type)
+			assert.Equal(t, job.ID, published[0].JobID)
+			assert.Equal(t, tt.verdict, published[0].Fields["verdict"])
+
+			if tt.approved {
+				require.NoError(t, q.ApproveJob(job.ID))
+				next, err := q.GetNextJob()
+				require.NoError(t, err)
+				assert.True(t, next.Approved, "approved jobs are repaired, not triaged again")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/metrics"
+	"github.com/javi11/nzb-repair/internal/pools"
+	"github.com/javi11/nzb-repair/internal/queue"
+)
+
+const defaultUsageFlushInterval = time.Minute
+
+// usageRecorder periodically persists the bandwidth used by each provider and
+// warns when a provider approaches its monthly cap.
+type usageRecorder struct {
+	cfg    config.Config
+	meter  *pools.UsageMeter
+	queue  *queue.Queue
+	reg    *metrics.Registry
+	log    *slog.Logger
+	caps   map[string]int64
+	warned map[string]string // provider -> month already warned about
+}
+
+func newUsageRecorder(cfg config.Config, meter *pools.UsageMeter, q *queue.Queue, reg *metrics.Registry, logger *slog.Logger) *usageRecorder {
+	caps := make(map[string]int64)
+	for _, p := range append(append([]config.ProviderConfig{}, cfg.DownloadProviders...), cfg.UploadProviders...) {
+		if p.MonthlyCapBytes > 0 {
+			caps[p.DisplayName()] = p.MonthlyCapBytes
+		}
+	}
+
+	return &usageRecorder{
+		cfg:    cfg,
+		meter:  meter,
+		queue:  q,
+		reg:    reg,
+		log:    logger.With("component", "usage"),
+		caps:   caps,
+		warned: make(map[string]string),
+	}
+}
+
+// Run flushes usage every minute until ctx is canceled, then flushes one last time.
+func (r *usageRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(defaultUsageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			r.flush(ctx)
+		}
+	}
+}
+
+func (r *usageRecorder) flush(ctx context.Context) {
+	month := queue.UsageMonth(time.Now())
+	for provider, u := range r.meter.Collect() {
+		labels := metrics.Labels{"provider": provider}
+		r.reg.Add("nzbrepair_provider_downloaded_bytes_total", "Bytes downloaded per provider.", labels, float64(u.Downloaded))
+		r.reg.Add("nzbrepair_provider_uploaded_bytes_total", "Bytes uploaded per provider.", labels, float64(u.Uploaded))
+
+		if err := r.queue.AddProviderUsage(provider, month, u.Downloaded, u.Uploaded); err != nil {
+			r.log.ErrorContext(ctx, "Failed to record provider usage", "provider", provider, "error", err)
+		}
+
+		if u.CompressedRaw > 0 {
+			r.reg.Add("nzbrepair_provider_compressed_raw_bytes_total", "Uncompressed bytes of compressed connections per provider.", labels, float64(u.CompressedRaw))
+			r.reg.Add("nzbrepair_provider_compressed_wire_bytes_total", "Transferred bytes of compressed connections per provider.", labels, float64(u.CompressedWire))
+		}
+
+		if err := r.queue.AddProviderCompression(provider, month, u.CompressedRaw, u.CompressedWire); err != nil {
+			r.log.ErrorContext(ctx, "Failed to record provider compression", "provider", provider, "error", err)
+		}
+	}
+
+	if len(r.caps) == 0 {
+		return
+	}
+
+	usage, err := r.queue.GetProviderUsage(month)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to read provider usage", "error", err)
+		return
+	}
+
+	for _, u := range usage {
+		limit, ok := r.caps[u.Provider]
+		if !ok || r.warned[u.Provider] == month {
+			continue
+		}
+
+		used := u.DownloadedBytes + u.UploadedBytes
+		if float64(used) >= float64(limit)*r.cfg.BandwidthWarnRatio {
+			r.warned[u.Provider] = month
+			r.log.WarnContext(ctx, "Provider is nearing its monthly cap",
+				"provider", u.Provider,
+				"month", month,
+				"used_bytes", used,
+				"cap_bytes", limit)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// watchDirs are the configured watch directories, with absolute paths.
+type watchDirs []config.WatchDirConfig
+
+// newWatchDirs resolves and checks the configured watch directories.
+func newWatchDirs(cfg config.Config) (watchDirs, error) {
+	dirs := make(watchDirs, 0, len(cfg.WatchDirs))
+	for i, d := range cfg.WatchDirs {
+		if d.Path == "" {
+			return nil, fmt.Errorf("watch_dirs[%d]: path is required", i)
+		}
+
+		abs, err := filepath.Abs(d.Path)
+		if err != nil {
+			return nil, fmt.Errorf("watch_dirs[%d]: %w", i, err)
+		}
+		d.Path = abs
+
+		if err := validateRoute(cfg, d.RouteConfig); err != nil {
+			return nil, fmt.Errorf("watch_dirs[%d] %s: %w", i, d.Path, err)
+		}
+
+		dirs = append(dirs, d)
+	}
+
+	return dirs, nil
+}
+
+// of returns the watch directory holding path, the innermost one when they
+// nest.
+func (w watchDirs) of(path string) (config.WatchDirConfig, bool) {
+	var (
+		found config.WatchDirConfig
+		ok    bool
+	)
+	for _, d := range w {
+		if isBelow(d.Path, path) && (!ok || len(d.Path) > len(found.Path)) {
+			found, ok = d, true
+		}
+	}
+
+	return found, ok
+}
+
+// isBelow reports whether path is inside dir.
+func isBelow(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && filepath.IsLocal(rel)
+}
+
+// validateRoute checks the settings of a route that are not checked when the
+// rules are compiled.
+func validateRoute(cfg config.Config, route config.RouteConfig) error {
+	switch route.ObfuscationPolicy {
+	case "", config.ObfuscationPolicyNone, config.ObfuscationPolicyFull:
+	default:
+		return fmt.Errorf("unknown obfuscation policy %q", route.ObfuscationPolicy)
+	}
+
+	if route.HealthyOutput != "" {
+		if err := validateHealthyOutput(route.HealthyOutput); err != nil {
+			return err
+		}
+	}
+
+	if err := validateRouteProviders(cfg, route.Providers); err != nil {
+		return err
+	}
+
+	return validateRouteUploadProviders(cfg, route.UploadProviders)
+}
+
+// mergeRoute fills the empty fields of route with those of base.
+func mergeRoute(route, base config.RouteConfig) config.RouteConfig {
+	if route.OutputDir == "" {
+		route.OutputDir = base.OutputDir
+	}
+	if route.Priority == 0 {
+		route.Priority = base.Priority
+	}
+	if len(route.Providers) == 0 {
+		route.Providers = base.Providers
+	}
+	if route.ObfuscationPolicy == "" {
+		route.ObfuscationPolicy = base.ObfuscationPolicy
+	}
+	if route.HealthyOutput == "" {
+		route.HealthyOutput = base.HealthyOutput
+	}
+	if route.PostAddTo == "" {
+		route.PostAddTo = base.PostAddTo
+	}
+	if len(route.UploadProviders) == 0 {
+		route.UploadProviders = base.UploadProviders
+	}
+	route.NoUpload = route.NoUpload || base.NoUpload
+
+	return route
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+func TestWatchDirs_Of(t *testing.T) {
+	dirs, err := newWatchDirs(config.Config{WatchDirs: []config.WatchDirConfig{
+		{Path: "/watch", Category: "all"},
+		{Path: "/watch/tv", Category: "tv"},
+	}})
+	require.NoError(t, err)
+
+	d, ok := dirs.of("/watch/tv/show.nzb")
+	require.True(t, ok)
+	assert.Equal(t, "tv", d.Category, "the innermost directory wins")
+
+	d, ok = dirs.of("/watch/movie.nzb")
+	require.True(t, ok)
+	assert.Equal(t, "all", d.Category)
+
+	_, ok = dirs.of("/watched/movie.nzb")
+	assert.False(t, ok)
+
+	_, err = newWatchDirs(config.Config{WatchDirs: []config.WatchDirConfig{
+		{Path: "/watch", RouteConfig: config.RouteConfig{HealthyOutput: "move"}},
+	}})
+	assert.ErrorContains(t, err, "healthy_output")
+
+	_, err = newWatchDirs(config.Config{WatchDirs: []config.WatchDirConfig{
+		{Path: "/watch", RouteConfig: config.RouteConfig{Providers: []string{"missing"}}},
+	}})
+	assert.ErrorContains(t, err, "unknown download provider")
+
+	_, err = newWatchDirs(config.Config{WatchDirs: []config.WatchDirConfig{
+		{Path: "/watch", RouteConfig: config.RouteConfig{UploadProviders: []string{"missing"}}},
+	}})
+	assert.ErrorContains(t, err, "unknown upload provider")
+}
+
+func TestMergeRoute_Upload(t *testing.T) {
+	base := config.RouteConfig{UploadProviders: []string{"poster"}, NoUpload: true}
+
+	route := mergeRoute(config.RouteConfig{}, base)
+	assert.Equal(t, []string{"poster"}, route.UploadProviders)
+	assert.True(t, route.NoUpload, "uploads stay disabled for the watch directory")
+
+	route = mergeRoute(config.RouteConfig{UploadProviders: []string{"other"}}, config.RouteConfig{})
+	assert.Equal(t, []string{"other"}, route.UploadProviders)
+	assert.False(t, route.NoUpload)
+}
+
+func TestAdmission_WatchDirSettings(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive")
+	cfg := config.Config{
+		WatchDirs: []config.WatchDirConfig{{
+			Path:     archive,
+			Category: "archive",
+			RouteConfig: config.RouteConfig{
+				OutputDir:     "/out/archive",
+				Priority:      -10,
+				HealthyOutput: healthyOutputCopy,
+			},
+		}},
+		Rules: []config.RuleConfig{{
+			Name:  "big",
+			When:  "size_bytes > 1000",
+			Route: config.RouteConfig{OutputDir: "/out/big"},
+		}},
+	}
+	a, q := newTestAdmission(t, cfg)
+
+	small := writeTestNzb(t, filepath.Join(archive, "sub"), "small.nzb", 100)
+	big := writeTestNzb(t, archive, "big.nzb", 1<<20)
+	other := writeTestNzb(t, root, "other.nzb", 100)
+	for _, path := range []string{small, big, other} {
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		require.NoError(t, a.AddJob(path, rel))
+	}
+
+	job, err := q.GetJobByPath(small)
+	require.NoError(t, err)
+	assert.Equal(t, "archive", job.Category)
+	assert.Equal(t, -10, job.Priority)
+
+	v, ok := a.recheck(context.Background(), job)
+	require.True(t, ok)
+	assert.Equal(t, "/out/archive", v.route.OutputDir)
+	assert.Equal(t, healthyOutputCopy, routedConfig(cfg, v.route).HealthyOutput)
+
+	// The route of a matching rule takes precedence field by field
+	job, err = q.GetJobByPath(big)
+	require.NoError(t, err)
+	v, ok = a.recheck(context.Background(), job)
+	require.True(t, ok)
+	assert.Equal(t, "/out/big", v.route.OutputDir)
+	assert.Equal(t, -10, v.route.Priority)
+
+	job, err = q.GetJobByPath(other)
+	require.NoError(t, err)
+	assert.Empty(t, job.Category)
+	assert.Equal(t, 0, job.Priority)
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -22,17 +24,24 @@ type Logger interface {
 
 // ProviderConfig holds YAML-friendly NNTP provider settings that map to nntppool/v4 Provider.
 type ProviderConfig struct {
-	Host        string        `yaml:"host"`
-	Username    string        `yaml:"username"`
-	Password    string        `yaml:"password"`
-	Port        int           `yaml:"port"`
-	Connections int           `yaml:"connections"`
-	Inflight    int           `yaml:"inflight"`
-	TLS         bool          `yaml:"tls"`
-	InsecureSSL bool          `yaml:"insecure_ssl"`
-	Backup      bool          `yaml:"backup"`
-	IdleTimeout time.Duration `yaml:"idle_timeout"`
-	SkipPing    bool          `yaml:"skip_ping"`
+	// Name identifies the provider in stats and logs. Defaults to Host.
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+	// Username and Password may reference an environment variable as ${NAME}.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// UsernameFile and PasswordFile read the credential from a file instead,
+	// e.g. a Docker secret. Trailing newlines are ignored.
+	UsernameFile string        `yaml:"username_file"`
+	PasswordFile string        `yaml:"password_file"`
+	Port         int           `yaml:"port"`
+	Connections  int           `yaml:"connections"`
+	Inflight     int           `yaml:"inflight"`
+	TLS          bool          `yaml:"tls"`
+	InsecureSSL  bool          `yaml:"insecure_ssl"`
+	Backup       bool          `yaml:"backup"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	SkipPing     bool          `yaml:"skip_ping"`
 	// KeepaliveIntervalSeconds, if > 0, sends a lightweight NNTP command
 	// periodically when the connection is idle. Recommended: 30–60.
 	KeepaliveIntervalSeconds int `yaml:"keepalive_interval_seconds"`
@@ -46,6 +55,45 @@ type ProviderConfig struct {
 	QuotaBytes int64 `yaml:"quota_bytes"`
 	// QuotaPeriodHours is the rolling window (in hours) after which the quota resets.
 	QuotaPeriodHours int `yaml:"quota_period_hours"`
+	// Tier orders download providers. Providers in a higher tier (e.g. paid-per-GB
+	// block accounts) are only consulted after every lower tier misses an article.
+	// Defaults to 1. Ignored for upload providers.
+	Tier int `yaml:"tier"`
+	// MonthlyCapBytes is the monthly transfer allowance of the account, used to
+	// warn when the recorded usage approaches it. 0 disables the warning.
+	MonthlyCapBytes int64 `yaml:"monthly_cap_bytes"`
+	// Compress requests COMPRESS DEFLATE (RFC 8054) on every connection.
+	// Servers without support are used uncompressed.
+	Compress bool `yaml:"compress"`
+	// DatePolicy sets the Date header of the articles posted through this
+	// upload provider: original keeps the date of the replaced article, now
+	// dates them when posted and jitter adds a random delay of up to
+	// DateJitter to the original date. Defaults to original. Ignored for
+	// download providers.
+	DatePolicy DatePolicy `yaml:"date_policy"`
+	// DateJitter bounds the delay of the jitter date policy. Defaults to 1h.
+	DateJitter time.Duration `yaml:"date_jitter"`
+	// MaxArticleSize is the largest part, in decoded bytes, this upload
+	// provider accepts in an article. Any upload provider may post any
+	// article, so the smallest limit of the upload providers applies to all
+	// of them: recreated par2 files are split into parts no larger, and
+	// repaired segments that are larger fail the upload before they are
+	// posted, as they must keep the size of the article they replace. 0 means
+	// no limit. Ignored for download providers.
+	MaxArticleSize int64 `yaml:"max_article_size"`
+	// MaxPostsPerMinute throttles this upload provider to that many posts a
+	// minute over all its connections. 0 means no limit. Ignored for
+	// download providers.
+	MaxPostsPerMinute int `yaml:"max_posts_per_minute"`
+}
+
+// DisplayName returns the configured Name, falling back to Host.
+func (p ProviderConfig) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	return p.Host
 }
 
 type Config struct {
@@ -55,20 +103,408 @@ type Config struct {
 	DownloadFolder    string           `yaml:"download_folder"`
 	DownloadProviders []ProviderConfig `yaml:"download_providers"`
 	UploadProviders   []ProviderConfig `yaml:"upload_providers"`
-	Par2Exe           string           `yaml:"par2_exe"`
-	Upload            UploadConfig     `yaml:"upload"`
-	ScanInterval      time.Duration    `yaml:"scan_interval"` // duration string like "5m", "1h"
-	MaxRetries        int64            `yaml:"max_retries"`   // maximum number of retries before moving to broken folder
-	BrokenFolder      string           `yaml:"broken_folder"` // folder to move broken files to
+	// MaxTotalConnections caps the open connections of the download and upload
+	// pools combined, for providers that count connections per account. 0
+	// disables the cap.
+	MaxTotalConnections int           `yaml:"max_total_connections"`
+	Pool                PoolConfig    `yaml:"pool"`
+	Par2Exe             string        `yaml:"par2_exe"`
+	Upload              UploadConfig  `yaml:"upload"`
+	ScanInterval        time.Duration `yaml:"scan_interval"` // duration string like "5m", "1h"
+	MaxRetries          int64         `yaml:"max_retries"`   // maximum number of retries before moving to broken folder
+	BrokenFolder        string        `yaml:"broken_folder"` // folder to move broken files to
+	// WatchDebounce is how long the watcher waits after the last file system
+	// event of an NZB before queueing it, instead of waiting for the next
+	// scan. Defaults to 2s; a negative value disables events and relies on
+	// ScanInterval alone.
+	WatchDebounce time.Duration `yaml:"watch_debounce"`
+	// WatchDirs are further directories to watch, each with its own job
+	// settings.
+	WatchDirs []WatchDirConfig `yaml:"watch_dirs"`
+	// WatchMaxDepth limits how deep the watcher looks below the watch
+	// directory, like find -maxdepth: 1 only picks up the NZBs at its root.
+	// 0 does not limit the depth.
+	WatchMaxDepth int `yaml:"watch_max_depth"`
+	// FollowSymlinks makes the watcher descend into symlinked directories,
+	// each directory once, so links back to an ancestor cannot loop.
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+	// FallbackOutputDir receives the repaired NZB when writing it to its output
+	// path fails, e.g. on a read-only mount or a full disk. Empty disables it.
+	FallbackOutputDir string `yaml:"fallback_output_dir"`
+	// HealthyOutput is what the watcher puts in the output directory for a
+	// job that needed no repair: "none", "copy" of the original NZB or a
+	// "symlink" to it. Defaults to none.
+	HealthyOutput string `yaml:"healthy_output"`
+	// OutputTemplate lays out repaired NZBs below the output directory, e.g.
+	// "{category}/{year}/{month}/{name}.nzb". Empty mirrors the path of the
+	// NZB in the watch directory.
+	OutputTemplate string `yaml:"output_template"`
+	// DateOutputFolders puts repaired NZBs in a YYYY-MM-DD folder of the
+	// output directory, named after the day they were processed.
+	DateOutputFolders bool `yaml:"date_output_folders"`
+	// OutputConflict is what happens when the output path of a repaired NZB
+	// exists: "overwrite" backs it up and replaces it, "version" writes
+	// "name (2).nzb" and so on instead. Defaults to overwrite.
+	OutputConflict string `yaml:"output_conflict"`
+	// OutputSink is where repaired NZBs are stored. Defaults to the local
+	// file system.
+	OutputSink OutputSinkConfig `yaml:"output_sink"`
+	// PostAddTo is a directory, e.g. the watched folder of a downloader,
+	// that also receives every NZB written to the output directory, as a
+	// hardlink or a copy renamed into place once complete.
+	PostAddTo string `yaml:"post_add_to"`
+	// GroupReleases repairs the queued NZBs of a release split across several
+	// NZBs (e.g. name.part1.nzb, name.part2.nzb in the same folder) together,
+	// writing one merged NZB.
+	GroupReleases bool `yaml:"group_releases"`
+	// ReferenceDir holds files par2 may take blocks from, e.g. a previous
+	// partial extraction of the release. They are hardlinked into the
+	// temporary directory before par2 runs.
+	ReferenceDir string `yaml:"reference_dir"`
+	// NzbgetInterDir is the InterDir of NZBGet. The segments NZBGet wrote in
+	// the files it left there for a failed download are not downloaded again,
+	// and the files are used as reference files for its repair.
+	NzbgetInterDir string `yaml:"nzbget_inter_dir"`
+	// ArticleCache keeps downloaded articles on disk for later jobs.
+	ArticleCache ArticleCacheConfig `yaml:"article_cache"`
+	// InPlace overwrites the source NZB with the repaired one.
+	InPlace InPlaceConfig `yaml:"in_place"`
+	// Extract unpacks the archives of repaired releases.
+	Extract ExtractConfig `yaml:"extract"`
+	// BundleDir makes a single repair write the repaired articles as yEnc
+	// article files with a manifest to this directory instead of posting
+	// them, along with the repaired NZB. Also set by the --bundle flag.
+	BundleDir string `yaml:"bundle_dir"`
+	// DryRun downloads and verifies the segments and runs par2 verify only,
+	// reporting the broken segments and whether the release can be
+	// repaired, without posting articles or writing NZBs. Also set by the
+	// --dry-run flag.
+	DryRun bool `yaml:"dry_run"`
+	// Progress is how a single repair shows its progress: "bar" draws a
+	// progress bar per phase, "json" writes every update as a line of JSON
+	// to stderr and "none" shows nothing. Watcher jobs record their progress
+	// in the queue and the API event stream instead. Defaults to bar.
+	Progress string `yaml:"progress"`
+	// KeepTmpOnFailure preserves the temporary directory of a failed repair,
+	// including the par2 stderr, for inspection.
+	KeepTmpOnFailure bool `yaml:"keep_tmp_on_failure"`
+	// KeepTmpRetention is how long the watcher keeps the temporary directories
+	// of failed jobs. Defaults to 24h.
+	KeepTmpRetention time.Duration `yaml:"keep_tmp_retention"`
 	// Par2RecreateThreshold is the fraction of missing par2 segments that triggers
 	// recreation of the par2 set. 0 = disabled. Example: 0.1 = recreate when ≥10% missing.
 	Par2RecreateThreshold float64 `yaml:"par2_recreate_threshold"`
 	// Par2RecreateRedundancy is the recovery percentage used when creating a new par2 set.
 	Par2RecreateRedundancy int `yaml:"par2_recreate_redundancy"`
+	// Par2RecreateBlockCount and Par2RecreateBlockSize set the number of
+	// source blocks, or their size in bytes (a multiple of 4), of a new par2
+	// set. More, smaller blocks repair scattered damage with less recovery
+	// data but take longer to create. At most one of them may be set; 0
+	// leaves the choice to par2.
+	Par2RecreateBlockCount int   `yaml:"par2_recreate_block_count"`
+	Par2RecreateBlockSize  int64 `yaml:"par2_recreate_block_size"`
+	// FailureMode is what a repair does when a file download or par2 fails:
+	// "best_effort" goes on with what it has and records the failure in the
+	// result, "strict" fails the repair. Defaults to best_effort.
+	FailureMode string `yaml:"failure_mode"`
+	// BandwidthWarnRatio is the fraction of a provider's MonthlyCapBytes at which
+	// a warning is logged. Defaults to 0.9.
+	BandwidthWarnRatio float64           `yaml:"bandwidth_warn_ratio"`
+	Metrics            MetricsConfig     `yaml:"metrics"`
+	StatsExport        StatsExportConfig `yaml:"stats_export"`
+	// Hooks are external executables run around watcher jobs.
+	Hooks []HookConfig `yaml:"hooks"`
+	// Notifications are sent when watcher jobs complete, fail or are moved
+	// to the broken folder.
+	Notifications []NotificationConfig `yaml:"notifications"`
+	// MaxNzbSizeGB is the largest NZB (sum of its segment sizes) the watcher
+	// processes. 0 disables the limit.
+	MaxNzbSizeGB float64 `yaml:"max_nzb_size_gb"`
+	// OversizeAction is what happens to NZBs above MaxNzbSizeGB: "skip" marks
+	// them too_large, "hold" keeps them for manual approval. Defaults to skip.
+	OversizeAction string `yaml:"oversize_action"`
+	// MaxPostAgeDays fails NZBs whose oldest post is older than this many days,
+	// e.g. beyond the retention of every provider. 0 disables the filter.
+	MaxPostAgeDays int `yaml:"max_post_age_days"`
+	// MinPostAge delays NZBs until their newest post is at least this old, so
+	// fresh posts can propagate to every provider first. 0 disables the delay.
+	MinPostAge time.Duration `yaml:"min_post_age"`
+	// StallTimeout cancels a watcher job that made no progress (no segment
+	// transferred, no par2 output) for this long. 0 disables stall detection.
+	StallTimeout time.Duration `yaml:"stall_timeout"`
+	// StallAction is what happens to a stalled job: "retry" fails it like any
+	// other error so it is retried up to MaxRetries, "fail" fails it without
+	// further attempts. Defaults to retry.
+	StallAction string `yaml:"stall_action"`
+	// WatchWorkers is the number of jobs the watcher repairs concurrently. Defaults to 1.
+	WatchWorkers int `yaml:"watch_workers"`
+	// WatchMode is "repair" to repair every job, or "triage" to only record
+	// the repairability verdict of each job and repair it once approved with
+	// queue approve. Defaults to repair.
+	WatchMode string `yaml:"watch_mode"`
+	// Order is the order the watcher picks pending jobs in: "priority" by
+	// highest priority, oldest first, "fifo" by age alone and
+	// "smallest-first" by NZB size, so many small repairs complete before a
+	// large one occupies a worker. Defaults to priority.
+	Order string `yaml:"order"`
+	// CategoryConcurrency caps the concurrent jobs of a category (top-level
+	// subdirectory of the watch directory), e.g. remux: 1.
+	CategoryConcurrency map[string]int       `yaml:"category_concurrency"`
+	FairScheduling      FairSchedulingConfig `yaml:"fair_scheduling"`
+	API                 APIConfig            `yaml:"api"`
+	Node                NodeConfig           `yaml:"node"`
+	// Rules decide, on enqueue and again before processing, whether the watcher
+	// accepts, holds or skips a job. The first matching rule wins.
+	Rules []RuleConfig `yaml:"rules"`
+}
+
+// NodeConfig identifies this instance when several instances share one queue
+// database.
+type NodeConfig struct {
+	// Name of the node. Empty disables multi-node handling: every job in the
+	// queue is claimed, and jobs interrupted by a previous run are only
+	// reclaimed once their lease expires.
+	Name string `yaml:"name"`
+	// SharedStorage means the watch directory is mounted at the same path on
+	// every node, so other nodes may process the jobs this node finds.
+	SharedStorage bool `yaml:"shared_storage"`
+	// LeaseDuration is how long a job claim stays valid without a heartbeat.
+	// Jobs of a crashed worker are picked up again after this long.
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+}
+
+// InPlaceConfig makes repairs overwrite the source NZB instead of writing to
+// an output directory.
+type InPlaceConfig struct {
+	// Enabled replaces the source NZB with the repaired one after copying it
+	// to <name>.nzb.<timestamp>.bak. Also set by the --in-place flag.
+	Enabled bool `yaml:"enabled"`
+	// BackupRetention removes backups older than this. 0 keeps them forever.
+	BackupRetention time.Duration `yaml:"backup_retention"`
+}
+
+// ExtractConfig unpacks the archive sets (rar, 7z, zip and their split
+// volumes) of a release once its files are complete, before the temporary
+// directory is removed.
+type ExtractConfig struct {
+	// Enabled unpacks the archives after a successful repair, and of healthy
+	// NZBs. Also set by the --extract flag.
+	Enabled bool `yaml:"enabled"`
+	// Dir receives a folder per release, named after the NZB. Defaults to the
+	// directory of the output NZB.
+	Dir string `yaml:"dir"`
+	// Exe is the 7-Zip executable used to unpack. Defaults to 7z.
+	Exe string `yaml:"exe"`
+}
+
+// OutputSinkConfig selects where repaired NZBs are stored.
+type OutputSinkConfig struct {
+	// Type is "local" to write them to their output path, "http" to POST them
+	// to URL, "s3" to upload them to Bucket, or "sabnzbd" or "nzbget" to add
+	// them to the queue of the downloader at URL. Defaults to local.
+	Type string `yaml:"type"`
+	// URL is the endpoint of the http sink, the S3 endpoint (defaults to AWS
+	// in Region), or the base URL of the downloader.
+	URL string `yaml:"url"`
+	// Headers are set on the requests of the http sink, e.g. Authorization.
+	Headers map[string]string `yaml:"headers"`
+	// APIKey authenticates with SABnzbd.
+	APIKey string `yaml:"api_key"`
+	// Username and Password authenticate with NZBGet.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Category is the downloader category the NZB is added to.
+	Category string `yaml:"category"`
+	// Bucket, Region and Prefix locate the objects of the s3 sink, named
+	// after the file name of the output path.
+	Bucket string `yaml:"bucket"`
+	Region string `yaml:"region"`
+	Prefix string `yaml:"prefix"`
+	// AccessKey and SecretKey sign the requests of the s3 sink.
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// Timeout bounds a single upload. Defaults to 30s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ArticleCacheConfig configures the on-disk cache of downloaded articles,
+// shared by every job.
+type ArticleCacheConfig struct {
+	// Dir holds the cached articles. Empty disables the cache.
+	Dir string `yaml:"dir"`
+	// MaxSizeGB is the size of the cache. The least recently used articles
+	// are evicted beyond it. Defaults to 10.
+	MaxSizeGB float64 `yaml:"max_size_gb"`
+}
+
+// PoolConfig keeps connections of the NNTP pools ready between jobs.
+type PoolConfig struct {
+	// WarmupConnections is the number of connections each pool opens at
+	// startup, so the first job does not wait for the handshakes. 0 disables
+	// warmup.
+	WarmupConnections int `yaml:"warmup_connections"`
+	// KeepaliveInterval makes the watcher send DATE on the warm connections
+	// this often, so they outlive idle timeouts and stale ones are replaced
+	// before a job needs them. 0 disables it. Requires WarmupConnections.
+	KeepaliveInterval time.Duration `yaml:"keepalive_interval"`
+	// IdleClose is how long the watcher keeps a pool without requests open.
+	// Closed pools are created again by the next job. Warm pools and pools of
+	// providers with a quota stay open. Defaults to 2m, negative keeps every
+	// pool open.
+	IdleClose time.Duration `yaml:"idle_close"`
+}
+
+// APIConfig configures the HTTP API of the watcher.
+type APIConfig struct {
+	// Listen is a TCP address such as 127.0.0.1:8090 or a unix socket such as
+	// unix:/run/nzb-repair.sock. Empty disables the API.
+	Listen string `yaml:"listen"`
+}
+
+// FairSchedulingConfig interleaves watcher jobs across the top-level
+// subdirectories (categories) of the watch directory.
+type FairSchedulingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Weights gives a category a larger share of the worker, e.g. tv: 2 starts
+	// two tv jobs for every job of a category with the default weight of 1.
+	Weights map[string]float64 `yaml:"weights"`
+}
+
+// RuleConfig is a single admission rule.
+type RuleConfig struct {
+	Name string `yaml:"name"`
+	// When is an expr boolean expression, e.g. `size_gb > 100 && category == "movies"`.
+	When string `yaml:"when"`
+	// Action is accept, hold or skip. Defaults to accept.
+	Action string `yaml:"action"`
+	// Reason is stored on held and skipped jobs. Defaults to the rule name.
+	Reason string `yaml:"reason"`
+	// Route overrides how jobs accepted by this rule are processed.
+	Route RouteConfig `yaml:"route"`
+}
+
+// RouteConfig overrides the processing settings of a job. Empty fields keep the global settings.
+type RouteConfig struct {
+	OutputDir string `yaml:"output_dir"`
+	// Priority of the job in the queue; higher values are picked first.
+	Priority int `yaml:"priority"`
+	// Providers restricts downloads to the named download providers.
+	Providers         []string          `yaml:"providers"`
+	ObfuscationPolicy ObfuscationPolicy `yaml:"obfuscation_policy"`
+	// HealthyOutput overrides healthy_output for the job.
+	HealthyOutput string `yaml:"healthy_output"`
+	// PostAddTo overrides post_add_to for the job.
+	PostAddTo string `yaml:"post_add_to"`
+	// UploadProviders restricts uploads to the named upload providers.
+	UploadProviders []string `yaml:"upload_providers"`
+	// NoUpload only reports the health of the job: nothing is uploaded and
+	// no repaired NZB is written.
+	NoUpload bool `yaml:"no_upload"`
+}
+
+// WatchDirConfig is a directory the watcher picks up NZBs from besides the
+// one given with --dir, with settings for the jobs that come from it.
+type WatchDirConfig struct {
+	Path string `yaml:"path"`
+	// Category of its jobs. Empty uses the top-level subdirectory of the NZB,
+	// like the watch directory.
+	Category string `yaml:"category"`
+	// RouteConfig overrides the output directory, priority, providers and
+	// post-processing of its jobs. The route of a matching rule takes
+	// precedence field by field.
+	RouteConfig `yaml:",inline"`
+}
+
+// HookConfig registers an external executable that receives job events as JSON
+// on stdin and may answer with a JSON directive on stdout.
+type HookConfig struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Events the hook is run for: pre_job, post_job, on_failure and/or on_triage.
+	// Empty means all of them.
+	Events []string `yaml:"events"`
+	// Timeout bounds a single hook run. Defaults to 30s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// NotificationConfig sends a notification of job events to a webhook,
+// Discord, Telegram, Pushover or by e-mail.
+type NotificationConfig struct {
+	// Name identifies the notification in logs. Defaults to Type.
+	Name string `yaml:"name"`
+	// Type is webhook, discord, telegram, pushover or email.
+	Type string `yaml:"type"`
+	// Events the notification is sent for: job.completed, job.healthy,
+	// job.failed and/or job.moved. Empty means job.completed, job.failed and
+	// job.moved.
+	Events []string `yaml:"events"`
+	// URL is the endpoint of a webhook or the Discord webhook URL. A generic
+	// webhook receives the event as JSON.
+	URL string `yaml:"url"`
+	// Headers are added to the requests of a generic webhook.
+	Headers map[string]string `yaml:"headers"`
+	// Token is the Telegram bot token or the Pushover application token.
+	Token string `yaml:"token"`
+	// ChatID is the Telegram chat the bot writes to.
+	ChatID string `yaml:"chat_id"`
+	// User is the Pushover user or group key.
+	User string     `yaml:"user"`
+	SMTP SMTPConfig `yaml:"smtp"`
+	// Timeout bounds sending a single notification. Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SMTPConfig is the mail server e-mail notifications are sent through. The
+// connection is upgraded with STARTTLS when the server offers it.
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// StatsExportConfig periodically writes queue depth, throughput and job outcomes
+// of the watcher to InfluxDB or Graphite, for setups not running Prometheus.
+type StatsExportConfig struct {
+	// Type is "influxdb" or "graphite". Empty disables the exporter.
+	Type string `yaml:"type"`
+	// Address is the InfluxDB base URL (http://host:8086) or the Graphite
+	// plaintext endpoint (host:2003).
+	Address string `yaml:"address"`
+	// Database is the InfluxDB 1.x database.
+	Database string `yaml:"database"`
+	// Org, Bucket and Token select the InfluxDB 2.x write API.
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	Token  string `yaml:"token"`
+	// Prefix is prepended to Graphite metric paths.
+	Prefix   string        `yaml:"prefix"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// MetricsConfig controls how metrics of single repair runs are exported.
+// Single runs exit before a scraper could collect them, so they are pushed
+// at the end of the run instead.
+type MetricsConfig struct {
+	// PushgatewayURL, if set, receives the metrics of every single repair run.
+	PushgatewayURL string `yaml:"pushgateway_url"`
+	// JobName is the Pushgateway job label. Defaults to "nzb-repair".
+	JobName string `yaml:"job_name"`
+	// TextfilePath, if set, is rewritten with the run metrics for the
+	// node_exporter textfile collector.
+	TextfilePath string `yaml:"textfile_path"`
 }
 
 type UploadConfig struct {
 	ObfuscationPolicy ObfuscationPolicy `yaml:"obfuscation_policy"`
+	// SubjectTemplate is the subject of the articles posted when the
+	// obfuscation policy is none, with {file}, {files}, {filename}, {part}
+	// and {parts}, e.g. `[{file}/{files}] "{filename}" yEnc ({part}/{parts})`.
+	// Empty keeps the built-in subjects.
+	SubjectTemplate string `yaml:"subject_template"`
 }
 
 type ObfuscationPolicy string
@@ -78,20 +514,57 @@ const (
 	ObfuscationPolicyFull ObfuscationPolicy = "full"
 )
 
+// DatePolicy is how the Date header of posted articles is set.
+type DatePolicy string
+
+const (
+	DatePolicyOriginal DatePolicy = "original"
+	DatePolicyNow      DatePolicy = "now"
+	DatePolicyJitter   DatePolicy = "jitter"
+)
+
 type Option func(*Config)
 
 var (
 	providerConfigDefault = ProviderConfig{
 		Connections: 10,
 		IdleTimeout: 2400 * time.Second,
+		Tier:        1,
 	}
-	downloadWorkersDefault = 10
-	uploadWorkersDefault   = 10
-	scanIntervalDefault    = 5 * time.Minute
-	maxRetriesDefault      = int64(3)
-	brokenFolderDefault    = "broken"
+	downloadWorkersDefault  = 10
+	uploadWorkersDefault    = 10
+	scanIntervalDefault     = 5 * time.Minute
+	maxRetriesDefault       = int64(3)
+	brokenFolderDefault     = "broken"
+	bandwidthWarnDefault    = 0.9
+	metricsJobNameDefault   = "nzb-repair"
+	hookTimeoutDefault      = 30 * time.Second
+	dateJitterDefault       = time.Hour
+	notifyTimeoutDefault    = 10 * time.Second
+	smtpPortDefault         = 587
+	oversizeActionDefault   = "skip"
+	stallActionDefault      = "retry"
+	watchModeDefault        = "repair"
+	orderDefault            = "priority"
+	healthyOutputDefault    = "none"
+	outputConflictDefault   = "overwrite"
+	failureModeDefault      = "best_effort"
+	outputSinkDefault       = "local"
+	outputSinkTimeout       = 30 * time.Second
+	progressDefault         = "bar"
+	articleCacheSizeDefault = 10.0
+	watchWorkersDefault     = 1
+	keepTmpRetentionDefault = 24 * time.Hour
+	leaseDurationDefault    = time.Minute
+	watchDebounceDefault    = 2 * time.Second
+	poolIdleCloseDefault    = 2 * time.Minute
+	extractExeDefault       = "7z"
 )
 
+// leaseDurationMin keeps the lease heartbeat, sent every third of the lease,
+// at no more than one a second.
+const leaseDurationMin = 3 * time.Second
+
 func mergeWithDefault(config ...Config) Config {
 	if len(config) == 0 {
 		return Config{
@@ -101,9 +574,26 @@ func mergeWithDefault(config ...Config) Config {
 			UploadWorkers:          uploadWorkersDefault,
 			DownloadFolder:         "./",
 			ScanInterval:           scanIntervalDefault,
+			WatchDebounce:          watchDebounceDefault,
 			MaxRetries:             maxRetriesDefault,
 			BrokenFolder:           brokenFolderDefault,
 			Par2RecreateRedundancy: 10,
+			BandwidthWarnRatio:     bandwidthWarnDefault,
+			Metrics:                MetricsConfig{JobName: metricsJobNameDefault},
+			OversizeAction:         oversizeActionDefault,
+			StallAction:            stallActionDefault,
+			WatchMode:              watchModeDefault,
+			Order:                  orderDefault,
+			HealthyOutput:          healthyOutputDefault,
+			OutputConflict:         outputConflictDefault,
+			FailureMode:            failureModeDefault,
+			OutputSink:             OutputSinkConfig{Type: outputSinkDefault, Timeout: outputSinkTimeout},
+			Progress:               progressDefault,
+			WatchWorkers:           watchWorkersDefault,
+			KeepTmpRetention:       keepTmpRetentionDefault,
+			Node:                   NodeConfig{LeaseDuration: leaseDurationDefault},
+			Pool:                   PoolConfig{IdleClose: poolIdleCloseDefault},
+			Extract:                ExtractConfig{Exe: extractExeDefault},
 		}
 	}
 
@@ -119,6 +609,10 @@ func mergeWithDefault(config ...Config) Config {
 			p.IdleTimeout = providerConfigDefault.IdleTimeout
 		}
 
+		if p.Tier == 0 {
+			p.Tier = providerConfigDefault.Tier
+		}
+
 		cfg.DownloadProviders[i] = p
 		downloadWorkers += p.Connections
 	}
@@ -137,6 +631,14 @@ func mergeWithDefault(config ...Config) Config {
 			p.IdleTimeout = providerConfigDefault.IdleTimeout
 		}
 
+		if p.DatePolicy == "" {
+			p.DatePolicy = DatePolicyOriginal
+		}
+
+		if p.DatePolicy == DatePolicyJitter && p.DateJitter == 0 {
+			p.DateJitter = dateJitterDefault
+		}
+
 		cfg.UploadProviders[i] = p
 		uploadWorkers += p.Connections
 	}
@@ -149,6 +651,10 @@ func mergeWithDefault(config ...Config) Config {
 		cfg.ScanInterval = scanIntervalDefault
 	}
 
+	if cfg.WatchDebounce == 0 {
+		cfg.WatchDebounce = watchDebounceDefault
+	}
+
 	if cfg.MaxRetries == 0 {
 		cfg.MaxRetries = maxRetriesDefault
 	}
@@ -161,9 +667,145 @@ func mergeWithDefault(config ...Config) Config {
 		cfg.Par2RecreateRedundancy = 10
 	}
 
+	if cfg.BandwidthWarnRatio == 0 {
+		cfg.BandwidthWarnRatio = bandwidthWarnDefault
+	}
+
+	if cfg.Metrics.JobName == "" {
+		cfg.Metrics.JobName = metricsJobNameDefault
+	}
+
+	if cfg.WatchWorkers <= 0 {
+		cfg.WatchWorkers = watchWorkersDefault
+	}
+
+	if cfg.KeepTmpRetention == 0 {
+		cfg.KeepTmpRetention = keepTmpRetentionDefault
+	}
+
+	if cfg.Node.LeaseDuration == 0 {
+		cfg.Node.LeaseDuration = leaseDurationDefault
+	}
+
+	if cfg.Pool.IdleClose == 0 {
+		cfg.Pool.IdleClose = poolIdleCloseDefault
+	}
+
+	if cfg.Extract.Exe == "" {
+		cfg.Extract.Exe = extractExeDefault
+	}
+
+	if cfg.OversizeAction == "" {
+		cfg.OversizeAction = oversizeActionDefault
+	}
+
+	if cfg.StallAction == "" {
+		cfg.StallAction = stallActionDefault
+	}
+
+	if cfg.WatchMode == "" {
+		cfg.WatchMode = watchModeDefault
+	}
+
+	if cfg.Order == "" {
+		cfg.Order = orderDefault
+	}
+
+	if cfg.HealthyOutput == "" {
+		cfg.HealthyOutput = healthyOutputDefault
+	}
+
+	if cfg.OutputConflict == "" {
+		cfg.OutputConflict = outputConflictDefault
+	}
+
+	if cfg.FailureMode == "" {
+		cfg.FailureMode = failureModeDefault
+	}
+
+	if cfg.OutputSink.Type == "" {
+		cfg.OutputSink.Type = outputSinkDefault
+	}
+
+	if cfg.OutputSink.Timeout == 0 {
+		cfg.OutputSink.Timeout = outputSinkTimeout
+	}
+
+	if cfg.Progress == "" {
+		cfg.Progress = progressDefault
+	}
+
+	if cfg.ArticleCache.MaxSizeGB == 0 {
+		cfg.ArticleCache.MaxSizeGB = articleCacheSizeDefault
+	}
+
+	for i, h := range cfg.Hooks {
+		if h.Timeout == 0 {
+			h.Timeout = hookTimeoutDefault
+		}
+
+		if h.Name == "" {
+			h.Name = h.Command
+		}
+
+		cfg.Hooks[i] = h
+	}
+
+	for i, n := range cfg.Notifications {
+		if n.Timeout == 0 {
+			n.Timeout = notifyTimeoutDefault
+		}
+
+		if n.Name == "" {
+			n.Name = n.Type
+		}
+
+		if n.SMTP.Port == 0 {
+			n.SMTP.Port = smtpPortDefault
+		}
+
+		cfg.Notifications[i] = n
+	}
+
 	return cfg
 }
 
+// MaxArticleSize returns the smallest max_article_size of the upload
+// providers, or 0 when none has a limit. It is the limit of every article
+// posted, whichever provider posts it.
+func (c Config) MaxArticleSize() int64 {
+	var size int64
+	for _, p := range c.UploadProviders {
+		if p.MaxArticleSize > 0 && (size == 0 || p.MaxArticleSize < size) {
+			size = p.MaxArticleSize
+		}
+	}
+
+	return size
+}
+
+// DownloadTiers groups the download providers by tier, ordered from the lowest
+// tier to the highest.
+func (c Config) DownloadTiers() [][]ProviderConfig {
+	byTier := make(map[int][]ProviderConfig)
+	for _, p := range c.DownloadProviders {
+		byTier[p.Tier] = append(byTier[p.Tier], p)
+	}
+
+	tiers := make([]int, 0, len(byTier))
+	for t := range byTier {
+		tiers = append(tiers, t)
+	}
+	sort.Ints(tiers)
+
+	grouped := make([][]ProviderConfig, 0, len(tiers))
+	for _, t := range tiers {
+		grouped = append(grouped, byTier[t])
+	}
+
+	return grouped
+}
+
 func NewFromFile(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -175,5 +817,27 @@ func NewFromFile(path string) (Config, error) {
 		return Config{}, err
 	}
 
-	return mergeWithDefault(cfg), nil
+	if err := resolveCredentials(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	cfg = mergeWithDefault(cfg)
+	if err := validate(cfg); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// validate rejects settings that have no sensible meaning.
+func validate(cfg Config) error {
+	if cfg.Node.LeaseDuration < leaseDurationMin {
+		return fmt.Errorf("node.lease_duration must be at least %s, got %s", leaseDurationMin, cfg.Node.LeaseDuration)
+	}
+
+	if cfg.ScanInterval <= 0 {
+		return fmt.Errorf("scan_interval must be positive, got %s", cfg.ScanInterval)
+	}
+
+	return nil
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,3 +28,100 @@ par2_recreate_redundancy: 15
 	assert.Equal(t, 0.1, cfg.Par2RecreateThreshold)
 	assert.Equal(t, 15, cfg.Par2RecreateRedundancy)
 }
+
+func TestConfig_DownloadTiers(t *testing.T) {
+	yml := `
+download_providers:
+  - host: block.example.com
+    tier: 3
+  - host: main.example.com
+  - host: fill.example.com
+    tier: 2
+  - host: main2.example.com
+    tier: 1
+`
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yml), &cfg))
+	cfg = mergeWithDefault(cfg)
+
+	tiers := cfg.DownloadTiers()
+	require.Len(t, tiers, 3)
+	require.Len(t, tiers[0], 2)
+	assert.Equal(t, "main.example.com", tiers[0][0].Host)
+	assert.Equal(t, "main2.example.com", tiers[0][1].Host)
+	assert.Equal(t, "fill.example.com", tiers[1][0].Host)
+	assert.Equal(t, "block.example.com", tiers[2][0].Host)
+}
+
+func TestConfig_MaxArticleSize(t *testing.T) {
+	yml := `
+upload_providers:
+  - host: a.example.com
+  - host: b.example.com
+    max_article_size: 800000
+  - host: c.example.com
+    max_article_size: 500000
+    max_posts_per_minute: 60
+`
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yml), &cfg))
+	cfg = mergeWithDefault(cfg)
+
+	assert.Equal(t, int64(500000), cfg.MaxArticleSize())
+	assert.Equal(t, 60, cfg.UploadProviders[2].MaxPostsPerMinute)
+	assert.Zero(t, Config{}.MaxArticleSize())
+}
+
+func TestNewFromFile_LeaseDuration(t *testing.T) {
+	for _, tc := range []struct {
+		lease string
+		want  time.Duration
+		err   bool
+	}{
+		{lease: "0s", want: leaseDurationDefault},
+		{lease: "5m", want: 5 * time.Minute},
+		{lease: "3s", want: 3 * time.Second},
+		{lease: "1ns", err: true},
+		{lease: "-1m", err: true},
+	} {
+		t.Run(tc.lease, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte("node:\n  lease_duration: "+tc.lease+"\n"), 0600))
+
+			cfg, err := NewFromFile(path)
+			if tc.err {
+				assert.ErrorContains(t, err, "node.lease_duration")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cfg.Node.LeaseDuration)
+		})
+	}
+}
+
+func TestNewFromFile_ScanInterval(t *testing.T) {
+	for _, tc := range []struct {
+		interval string
+		want     time.Duration
+		err      bool
+	}{
+		{interval: "0s", want: scanIntervalDefault},
+		{interval: "40s", want: 40 * time.Second},
+		{interval: "-1m", err: true},
+	} {
+		t.Run(tc.interval, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte("scan_interval: "+tc.interval+"\n"), 0600))
+
+			cfg, err := NewFromFile(path)
+			if tc.err {
+				assert.ErrorContains(t, err, "scan_interval")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cfg.ScanInterval)
+		})
+	}
+}
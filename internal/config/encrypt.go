@@ -0,0 +1,206 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// MasterKeyEnv holds the passphrase that decrypts encrypted credentials.
+	MasterKeyEnv = "NZB_REPAIR_MASTER_KEY"
+	// MasterKeyFileEnv names a file holding the passphrase, e.g. a key file
+	// only readable by the service user.
+	MasterKeyFileEnv = "NZB_REPAIR_MASTER_KEY_FILE"
+
+	encryptedPrefix = "enc:v1:"
+	saltSize        = 16
+	// kdfIterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+	kdfIterations = 600_000
+)
+
+// ErrNoMasterKey is returned when encrypted credentials are used without a master key.
+var ErrNoMasterKey = errors.New("no master key: set " + MasterKeyEnv + " or " + MasterKeyFileEnv)
+
+// MasterKey returns the passphrase from MasterKeyEnv or, when unset, from the
+// file named by MasterKeyFileEnv.
+func MasterKey() (string, error) {
+	if key := os.Getenv(MasterKeyEnv); key != "" {
+		return key, nil
+	}
+
+	path := os.Getenv(MasterKeyFileEnv)
+	if path == "" {
+		return "", ErrNoMasterKey
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	key := strings.TrimRight(string(data), "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("master key file %s is empty", path)
+	}
+
+	return key, nil
+}
+
+// IsEncrypted reports whether value was produced by EncryptSecret.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// EncryptSecret encrypts plaintext with AES-256-GCM under a key derived from
+// passphrase. Every call uses a fresh salt and nonce.
+func EncryptSecret(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(append(salt, nonce...), nonce, []byte(plaintext), nil)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret.
+func DecryptSecret(value, passphrase string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("value is not encrypted")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	if len(data) < saltSize {
+		return "", errors.New("malformed encrypted value: too short")
+	}
+
+	gcm, err := newGCM(passphrase, data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value: too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value: wrong master key or corrupted value")
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecrets encrypts the plaintext provider passwords of the YAML config
+// data, leaving the rest of the document, comments included, as it is.
+// Passwords that are already encrypted or reference an environment variable
+// are kept. It returns the new document and the number of encrypted passwords.
+func EncryptSecrets(data []byte, passphrase string) ([]byte, int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	if len(doc.Content) == 0 {
+		return data, 0, nil
+	}
+
+	encrypted := 0
+	for _, section := range []string{"download_providers", "upload_providers"} {
+		providers := mappingValue(doc.Content[0], section)
+		if providers == nil || providers.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for _, p := range providers.Content {
+			password := mappingValue(p, "password")
+			if password == nil || password.Kind != yaml.ScalarNode || password.Value == "" ||
+				IsEncrypted(password.Value) || envReference.MatchString(password.Value) {
+				continue
+			}
+
+			value, err := EncryptSecret(password.Value, passphrase)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			password.Value = value
+			password.Tag = "!!str"
+			password.Style = 0
+			encrypted++
+		}
+	}
+
+	if encrypted == 0 {
+		return data, 0, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, 0, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, 0, err
+	}
+
+	return buf.Bytes(), encrypted, nil
+}
+
+// mappingValue returns the value of key in the mapping node m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+
+	return nil
+}
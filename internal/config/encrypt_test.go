@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptSecret_RoundTrip(t *testing.T) {
+	value, err := EncryptSecret("hunter2", "passphrase")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(value))
+	assert.NotContains(t, value, "hunter2")
+
+	plaintext, err := DecryptSecret(value, "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+
+	_, err = DecryptSecret(value, "wrong")
+	require.Error(t, err)
+}
+
+func TestEncryptSecrets_ThenLoad(t *testing.T) {
+	const passphrase = "correct horse"
+
+	data, n, err := EncryptSecrets([]byte(`# providers
+download_providers:
+  - host: news.example.com
+    username: user
+    password: hunter2 # main account
+  - host: env.example.com
+    password: ${NNTP_PASSWORD}
+upload_providers:
+  - host: upload.example.com
+`), passphrase)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.Contains(t, string(data), "# main account", "comments are kept")
+	assert.Contains(t, string(data), "${NNTP_PASSWORD}")
+
+	again, n, err := EncryptSecrets(data, passphrase)
+	require.NoError(t, err)
+	assert.Zero(t, n, "encrypted passwords are left alone")
+	assert.Equal(t, data, again)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	t.Setenv("NNTP_PASSWORD", "from-env")
+
+	t.Setenv(MasterKeyEnv, "")
+	t.Setenv(MasterKeyFileEnv, "")
+	_, err = NewFromFile(path)
+	require.ErrorIs(t, err, ErrNoMasterKey)
+
+	t.Setenv(MasterKeyEnv, passphrase)
+	cfg, err := NewFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", cfg.DownloadProviders[0].Password)
+	assert.Equal(t, "from-env", cfg.DownloadProviders[1].Password)
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envReference matches a value that consists only of ${NAME}. Values that
+// merely contain a $ are used verbatim, as passwords often do.
+var envReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// resolveCredentials replaces the credential references and encrypted
+// passwords of every provider, and the credential references of the output
+// sink, with their values.
+func resolveCredentials(cfg *Config) error {
+	for _, providers := range [][]ProviderConfig{cfg.DownloadProviders, cfg.UploadProviders} {
+		for i := range providers {
+			if err := providers[i].resolveCredentials(); err != nil {
+				return fmt.Errorf("provider %s: %w", providers[i].DisplayName(), err)
+			}
+		}
+	}
+
+	if err := cfg.OutputSink.resolveCredentials(); err != nil {
+		return fmt.Errorf("output_sink: %w", err)
+	}
+
+	for i := range cfg.Notifications {
+		if err := cfg.Notifications[i].resolveCredentials(); err != nil {
+			return fmt.Errorf("notification %s: %w", cfg.Notifications[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *OutputSinkConfig) resolveCredentials() error {
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"api_key", &s.APIKey},
+		{"password", &s.Password},
+		{"secret_key", &s.SecretKey},
+	} {
+		value, err := resolveSecret(field.name, *field.value, "")
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+
+	return nil
+}
+
+func (n *NotificationConfig) resolveCredentials() error {
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"url", &n.URL},
+		{"token", &n.Token},
+		{"user", &n.User},
+		{"password", &n.SMTP.Password},
+	} {
+		value, err := resolveSecret(field.name, *field.value, "")
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+
+	return nil
+}
+
+func (p *ProviderConfig) resolveCredentials() error {
+	username, err := resolveSecret("username", p.Username, p.UsernameFile)
+	if err != nil {
+		return err
+	}
+
+	password, err := resolveSecret("password", p.Password, p.PasswordFile)
+	if err != nil {
+		return err
+	}
+
+	if IsEncrypted(password) {
+		key, err := MasterKey()
+		if err != nil {
+			return fmt.Errorf("password is encrypted: %w", err)
+		}
+
+		if password, err = DecryptSecret(password, key); err != nil {
+			return fmt.Errorf("password: %w", err)
+		}
+	}
+
+	p.Username, p.Password = username, password
+	p.UsernameFile, p.PasswordFile = "", ""
+
+	return nil
+}
+
+// resolveSecret returns the value of the field named name, read from file
+// when set or from the environment when value is a ${NAME} reference.
+func resolveSecret(name, value, file string) (string, error) {
+	if file != "" {
+		if value != "" {
+			return "", fmt.Errorf("%s and %s_file are mutually exclusive", name, name)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_file: %w", name, err)
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	m := envReference.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+
+	env, ok := os.LookupEnv(m[1])
+	if !ok {
+		return "", fmt.Errorf("%s references unset environment variable %s", name, m[1])
+	}
+
+	return env, nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromFile_ResolvesCredentials(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600))
+	t.Setenv("NNTP_USER", "alice")
+	t.Setenv("SAB_API_KEY", "0123abcd")
+
+	cfgPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(`
+download_providers:
+  - host: news.example.com
+    username: ${NNTP_USER}
+    password_file: `+passwordFile+`
+upload_providers:
+  - host: upload.example.com
+    username: bob
+    password: pa$${NNTP_USER}
+output_sink:
+  type: sabnzbd
+  api_key: ${SAB_API_KEY}
+`), 0o600))
+
+	cfg, err := NewFromFile(cfgPath)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", cfg.DownloadProviders[0].Username)
+	assert.Equal(t, "s3cret", cfg.DownloadProviders[0].Password)
+	assert.Empty(t, cfg.DownloadProviders[0].PasswordFile)
+	assert.Equal(t, "pa$${NNTP_USER}", cfg.UploadProviders[0].Password, "only whole-value references are expanded")
+	assert.Equal(t, "0123abcd", cfg.OutputSink.APIKey)
+}
+
+func TestResolveCredentials_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		wantErr  string
+	}{
+		{
+			name:     "unset variable",
+			provider: ProviderConfig{Host: "news", Password: "${NZB_REPAIR_UNSET_VARIABLE}"},
+			wantErr:  "provider news: password references unset environment variable NZB_REPAIR_UNSET_VARIABLE",
+		},
+		{
+			name:     "missing file",
+			provider: ProviderConfig{Host: "news", UsernameFile: filepath.Join(t.TempDir(), "missing")},
+			wantErr:  "provider news: failed to read username_file",
+		},
+		{
+			name:     "value and file",
+			provider: ProviderConfig{Host: "news", Password: "x", PasswordFile: "/run/secrets/password"},
+			wantErr:  "provider news: password and password_file are mutually exclusive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{DownloadProviders: []ProviderConfig{tt.provider}}
+			err := resolveCredentials(&cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
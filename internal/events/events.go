@@ -0,0 +1,137 @@
+// Package events is the internal event bus for job lifecycle and repair-phase
+// events. Integrations such as metrics or notifications subscribe to the bus
+// instead of being called directly from the worker loop.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Type identifies an event.
+type Type string
+
+const (
+	JobStarted   Type = "job.started"
+	JobCompleted Type = "job.completed"
+	JobFailed    Type = "job.failed"
+	JobMoved     Type = "job.moved"
+	// JobHealthy is published instead of JobCompleted when the job needed no
+	// repair.
+	JobHealthy Type = "job.healthy"
+	// JobTriaged is published by a watcher in triage mode once the verdict of
+	// a job is recorded. Fields holds verdict, blocks_needed and
+	// blocks_available.
+	JobTriaged Type = "job.triaged"
+	// JobProgress is published while a job's repair advances, at most once a
+	// second. Phase is the current phase and Fields holds unit, done, total
+	// and rate.
+	JobProgress Type = "job.progress"
+
+	PhaseStarted  Type = "phase.started"
+	PhaseFinished Type = "phase.finished"
+)
+
+// Event describes something that happened to a job.
+type Event struct {
+	Type       Type
+	Time       time.Time
+	JobID      int64
+	FilePath   string
+	OutputPath string
+	// Phase is set for phase events.
+	Phase string
+	// Duration is set for PhaseFinished events.
+	Duration time.Duration
+	// Error is set for failed jobs and phases.
+	Error string
+	// Fields carries additional event specific data.
+	Fields map[string]any
+}
+
+// Publisher publishes events.
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+// Subscriber receives every event published on a Bus. Events are delivered
+// synchronously, so subscribers doing slow work (network calls) must hand it
+// off to their own goroutine.
+type Subscriber interface {
+	HandleEvent(ctx context.Context, e Event)
+}
+
+// SubscriberFunc adapts a function to a Subscriber.
+type SubscriberFunc func(ctx context.Context, e Event)
+
+// HandleEvent calls f(ctx, e).
+func (f SubscriberFunc) HandleEvent(ctx context.Context, e Event) { f(ctx, e) }
+
+// Bus fans events out to its subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []Subscriber
+}
+
+// Ensure Bus implements Publisher
+var _ Publisher = (*Bus)(nil)
+
+// NewBus creates a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers s for all future events.
+func (b *Bus) Subscribe(s Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs = append(b.subs, s)
+}
+
+// Publish delivers e to every subscriber in registration order.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.HandleEvent(ctx, e)
+	}
+}
+
+// ForJob returns a Publisher that stamps every event with the job ID and
+// file path before passing it to p.
+func ForJob(p Publisher, jobID int64, filePath string) Publisher {
+	return &jobPublisher{p: p, jobID: jobID, filePath: filePath}
+}
+
+type jobPublisher struct {
+	p        Publisher
+	jobID    int64
+	filePath string
+}
+
+func (j *jobPublisher) Publish(ctx context.Context, e Event) {
+	if e.JobID == 0 {
+		e.JobID = j.jobID
+	}
+
+	if e.FilePath == "" {
+		e.FilePath = j.filePath
+	}
+
+	j.p.Publish(ctx, e)
+}
+
+// Discard is a Publisher that drops every event.
+var Discard Publisher = discard{}
+
+type discard struct{}
+
+func (discard) Publish(context.Context, Event) {}
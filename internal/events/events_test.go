@@ -0,0 +1,35 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_DeliversToAllSubscribersInOrder(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe(SubscriberFunc(func(_ context.Context, e Event) { got = append(got, "a:"+string(e.Type)) }))
+	bus.Subscribe(SubscriberFunc(func(_ context.Context, e Event) { got = append(got, "b:"+string(e.Type)) }))
+
+	bus.Publish(context.Background(), Event{Type: JobStarted})
+
+	assert.Equal(t, []string{"a:job.started", "b:job.started"}, got)
+}
+
+func TestForJob_StampsJobFields(t *testing.T) {
+	bus := NewBus()
+
+	var got Event
+	bus.Subscribe(SubscriberFunc(func(_ context.Context, e Event) { got = e }))
+
+	ForJob(bus, 42, "/watch/a.nzb").Publish(context.Background(), Event{Type: PhaseStarted, Phase: "download"})
+
+	require.False(t, got.Time.IsZero())
+	assert.Equal(t, int64(42), got.JobID)
+	assert.Equal(t, "/watch/a.nzb", got.FilePath)
+	assert.Equal(t, "download", got.Phase)
+}
@@ -0,0 +1,141 @@
+// Package hooks runs external executables around watcher jobs. Every hook
+// receives the job as JSON on stdin and may print a JSON Directive on stdout
+// to skip the job, redirect its output or change its priority.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// Stage is the point of the job lifecycle a hook runs at.
+type Stage string
+
+const (
+	PreJob    Stage = "pre_job"
+	PostJob   Stage = "post_job"
+	OnFailure Stage = "on_failure"
+	// OnTriage runs once a watcher in triage mode recorded the verdict of a job.
+	OnTriage Stage = "on_triage"
+)
+
+// Payload is written as JSON to the stdin of a hook.
+type Payload struct {
+	Event        Stage  `json:"event"`
+	JobID        int64  `json:"job_id"`
+	FilePath     string `json:"file_path"`
+	RelativePath string `json:"relative_path"`
+	OutputPath   string `json:"output_path,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Verdict      string `json:"verdict,omitempty"`
+	Healthy      bool   `json:"healthy,omitempty"`
+	BackupPath   string `json:"backup_path,omitempty"`
+	RetryCount   int64  `json:"retry_count"`
+	Priority     int    `json:"priority"`
+}
+
+// Directive is the optional JSON answer of a hook. Empty output means no directive.
+type Directive struct {
+	// Skip stops the job before it is repaired. Only honoured for pre_job.
+	Skip   bool   `json:"skip,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// OutputDir replaces the watcher output directory for this job. Only honoured for pre_job.
+	OutputDir string `json:"output_dir,omitempty"`
+	// Priority changes the queue priority of the job, taking effect the next time it is picked.
+	Priority *int `json:"priority,omitempty"`
+}
+
+// Runner runs the configured hooks.
+type Runner struct {
+	hooks  []config.HookConfig
+	logger *slog.Logger
+}
+
+// New creates a Runner for the given hooks.
+func New(hooks []config.HookConfig, logger *slog.Logger) *Runner {
+	return &Runner{hooks: hooks, logger: logger}
+}
+
+// Run executes every hook registered for p.Event in configuration order and
+// merges their directives, later hooks overriding earlier ones. A failing hook
+// is logged and ignored so it cannot block the queue. Remaining hooks are not
+// run once one asks to skip the job.
+func (r *Runner) Run(ctx context.Context, p Payload) Directive {
+	var merged Directive
+
+	for _, h := range r.hooks {
+		if len(h.Events) > 0 && !slices.Contains(h.Events, string(p.Event)) {
+			continue
+		}
+
+		d, err := runHook(ctx, h, p)
+		if err != nil {
+			r.logger.With("err", err).ErrorContext(ctx, "Hook failed", "hook", h.Name, "event", p.Event, "job_id", p.JobID)
+			continue
+		}
+
+		if d.OutputDir != "" {
+			merged.OutputDir = d.OutputDir
+		}
+
+		if d.Priority != nil {
+			merged.Priority = d.Priority
+		}
+
+		if d.Skip {
+			merged.Skip = true
+			merged.Reason = d.Reason
+			r.logger.InfoContext(ctx, "Hook requested to skip job", "hook", h.Name, "job_id", p.JobID, "reason", d.Reason)
+
+			break
+		}
+	}
+
+	return merged
+}
+
+func runHook(ctx context.Context, h config.HookConfig, p Payload) (Directive, error) {
+	var d Directive
+
+	input, err := json.Marshal(p)
+	if err != nil {
+		return d, fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "NZBREPAIR_EVENT="+string(p.Event))
+
+	if err := cmd.Run(); err != nil {
+		return d, fmt.Errorf("failed to run %s: %w. Stderr: %s", h.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return d, nil
+	}
+
+	if err := json.Unmarshal(out, &d); err != nil {
+		return d, fmt.Errorf("invalid directive from %s: %w", h.Command, err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755))
+
+	return path
+}
+
+func TestRunner_Run(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	t.Run("merges directives of matching hooks", func(t *testing.T) {
+		outDir := writeScript(t, `cat > /dev/null; echo '{"output_dir": "/srv/tv"}'`)
+		priority := writeScript(t, `cat > /dev/null; echo '{"priority": 5}'`)
+		failureOnly := writeScript(t, `echo '{"output_dir": "/never"}'`)
+
+		r := New([]config.HookConfig{
+			{Name: "out", Command: outDir, Timeout: time.Second},
+			{Name: "prio", Command: priority, Events: []string{"pre_job"}, Timeout: time.Second},
+			{Name: "failure", Command: failureOnly, Events: []string{"on_failure"}, Timeout: time.Second},
+		}, logger)
+
+		d := r.Run(ctx, Payload{Event: PreJob, JobID: 1})
+		assert.False(t, d.Skip)
+		assert.Equal(t, "/srv/tv", d.OutputDir)
+		require.NotNil(t, d.Priority)
+		assert.Equal(t, 5, *d.Priority)
+	})
+
+	t.Run("payload is passed on stdin", func(t *testing.T) {
+		script := writeScript(t, `grep -q '"file_path":"/watch/a.nzb"' && echo '{"skip": true, "reason": "matched"}'`)
+		after := writeScript(t, `echo '{"output_dir": "/late"}'`)
+
+		r := New([]config.HookConfig{
+			{Name: "skip", Command: script, Timeout: time.Second},
+			{Name: "after", Command: after, Timeout: time.Second},
+		}, logger)
+
+		d := r.Run(ctx, Payload{Event: PreJob, FilePath: "/watch/a.nzb"})
+		assert.True(t, d.Skip)
+		assert.Equal(t, "matched", d.Reason)
+		assert.Empty(t, d.OutputDir, "hooks after a skip must not run")
+	})
+
+	t.Run("failing and invalid hooks are ignored", func(t *testing.T) {
+		failing := writeScript(t, `exit 3`)
+		invalid := writeScript(t, `echo not-json`)
+		silent := writeScript(t, `cat > /dev/null`)
+
+		r := New([]config.HookConfig{
+			{Name: "failing", Command: failing, Timeout: time.Second},
+			{Name: "invalid", Command: invalid, Timeout: time.Second},
+			{Name: "silent", Command: silent, Timeout: time.Second},
+		}, logger)
+
+		assert.Equal(t, Directive{}, r.Run(ctx, Payload{Event: PostJob}))
+	})
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exporter formats.
+const (
+	FormatInflux   = "influxdb"
+	FormatGraphite = "graphite"
+)
+
+// ExporterConfig configures a periodic push of the registry to InfluxDB or Graphite.
+type ExporterConfig struct {
+	// Format is FormatInflux or FormatGraphite.
+	Format string
+	// Address is the InfluxDB base URL (http://host:8086) or the Graphite
+	// plaintext endpoint (host:2003).
+	Address string
+	// Database selects the InfluxDB 1.x database.
+	Database string
+	// Org, Bucket and Token select the InfluxDB 2.x write API. Bucket takes
+	// precedence over Database when both are set.
+	Org    string
+	Bucket string
+	Token  string
+	// Prefix is prepended to Graphite metric paths.
+	Prefix   string
+	Interval time.Duration
+}
+
+// Exporter periodically writes the registry to an InfluxDB or Graphite sink.
+type Exporter struct {
+	cfg     ExporterConfig
+	reg     *Registry
+	collect func()
+	log     *slog.Logger
+	client  *http.Client
+}
+
+// NewExporter creates an Exporter. collect, if not nil, is called before every
+// write to refresh gauges such as the queue depth.
+func NewExporter(cfg ExporterConfig, reg *Registry, collect func(), logger *slog.Logger) (*Exporter, error) {
+	if cfg.Format != FormatInflux && cfg.Format != FormatGraphite {
+		return nil, fmt.Errorf("unknown stats export format %q", cfg.Format)
+	}
+
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("stats export address is required")
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+
+	return &Exporter{
+		cfg:     cfg,
+		reg:     reg,
+		collect: collect,
+		log:     logger.With("component", "stats-exporter", "format", cfg.Format),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Run exports the registry every interval until ctx is canceled.
+func (e *Exporter) Run(ctx context.Context) {
+	e.log.InfoContext(ctx, "Starting stats exporter", "address", e.cfg.Address, "interval", e.cfg.Interval)
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil {
+				e.log.ErrorContext(ctx, "Failed to export stats", "error", err)
+			}
+		}
+	}
+}
+
+// Export writes the current registry once.
+func (e *Exporter) Export(ctx context.Context) error {
+	if e.collect != nil {
+		e.collect()
+	}
+
+	now := time.Now()
+	samples := e.reg.Snapshot()
+
+	var buf bytes.Buffer
+	switch e.cfg.Format {
+	case FormatInflux:
+		writeInflux(&buf, samples, now)
+		return e.writeInflux(ctx, &buf)
+	default:
+		writeGraphite(&buf, samples, e.cfg.Prefix, now)
+		return e.writeGraphite(ctx, &buf)
+	}
+}
+
+func (e *Exporter) writeInflux(ctx context.Context, body io.Reader) error {
+	base := strings.TrimSuffix(e.cfg.Address, "/")
+
+	var endpoint string
+	if e.cfg.Bucket != "" {
+		endpoint = base + "/api/v2/write?precision=ns&org=" + url.QueryEscape(e.cfg.Org) + "&bucket=" + url.QueryEscape(e.cfg.Bucket)
+	} else {
+		endpoint = base + "/write?precision=ns&db=" + url.QueryEscape(e.cfg.Database)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create influxdb request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.cfg.Token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to influxdb: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("influxdb returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func (e *Exporter) writeGraphite(ctx context.Context, body io.Reader) error {
+	d := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", e.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to graphite: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := io.Copy(conn, body); err != nil {
+		return fmt.Errorf("failed to write to graphite: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	influxEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	graphiteInvalid = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+)
+
+// writeInflux renders samples in the InfluxDB line protocol, one line per sample.
+func writeInflux(w io.Writer, samples []Sample, ts time.Time) {
+	for _, s := range samples {
+		line := influxEscaper.Replace(s.Name)
+		for _, k := range sortedKeys(s.Labels) {
+			if s.Labels[k] == "" {
+				continue
+			}
+			line += "," + influxEscaper.Replace(k) + "=" + influxEscaper.Replace(s.Labels[k])
+		}
+		_, _ = fmt.Fprintf(w, "%s value=%s %d\n", line, formatValue(s.Value), ts.UnixNano())
+	}
+}
+
+// writeGraphite renders samples in the Graphite plaintext protocol. Labels become
+// path components, e.g. prefix.jobs_total.status.completed.
+func writeGraphite(w io.Writer, samples []Sample, prefix string, ts time.Time) {
+	for _, s := range samples {
+		parts := make([]string, 0, 2+2*len(s.Labels))
+		if prefix != "" {
+			parts = append(parts, prefix)
+		}
+		parts = append(parts, graphiteInvalid.ReplaceAllString(s.Name, "_"))
+		for _, k := range sortedKeys(s.Labels) {
+			parts = append(parts, graphiteInvalid.ReplaceAllString(k, "_"), graphiteInvalid.ReplaceAllString(s.Labels[k], "_"))
+		}
+		_, _ = fmt.Fprintf(w, "%s %s %d\n", strings.Join(parts, "."), formatValue(s.Value), ts.Unix())
+	}
+}
+
+func sortedKeys(labels Labels) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInflux(t *testing.T) {
+	var sb strings.Builder
+	writeInflux(&sb, []Sample{
+		{Name: "nzbrepair_jobs_total", Labels: Labels{"status": "completed"}, Value: 3},
+		{Name: "nzbrepair_queue_depth", Labels: Labels{"status": "pending", "dir": "movies hd"}, Value: 2},
+	}, time.Unix(10, 0))
+
+	assert.Equal(t, "nzbrepair_jobs_total,status=completed value=3 10000000000\n"+
+		"nzbrepair_queue_depth,dir=movies\\ hd,status=pending value=2 10000000000\n", sb.String())
+}
+
+func TestWriteGraphite(t *testing.T) {
+	var sb strings.Builder
+	writeGraphite(&sb, []Sample{
+		{Name: "nzbrepair_jobs_total", Labels: Labels{"status": "completed"}, Value: 3},
+	}, "home", time.Unix(10, 0))
+
+	assert.Equal(t, "home.nzbrepair_jobs_total.status.completed 3 10\n", sb.String())
+}
+
+func TestExporter_InfluxV2(t *testing.T) {
+	var gotQuery, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotQuery = req.URL.RawQuery
+		gotAuth = req.Header.Get("Authorization")
+		b, _ := io.ReadAll(req.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry()
+	collected := false
+	e, err := NewExporter(ExporterConfig{Format: FormatInflux, Address: srv.URL, Org: "home", Bucket: "nzb", Token: "secret"}, reg, func() {
+		collected = true
+		reg.Set("nzbrepair_queue_depth", "", Labels{"status": "pending"}, 4)
+	}, slog.Default())
+	require.NoError(t, err)
+
+	require.NoError(t, e.Export(context.Background()))
+	assert.True(t, collected)
+	assert.Equal(t, "precision=ns&org=home&bucket=nzb", gotQuery)
+	assert.Equal(t, "Token secret", gotAuth)
+	assert.Contains(t, gotBody, "nzbrepair_queue_depth,status=pending value=4 ")
+}
+
+func TestExporter_Graphite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = ln.Close()
+	}()
+
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	reg := NewRegistry()
+	reg.Add("nzbrepair_jobs_total", "", Labels{"status": "failed"}, 1)
+	e, err := NewExporter(ExporterConfig{Format: FormatGraphite, Address: ln.Addr().String(), Prefix: "nzb"}, reg, nil, slog.Default())
+	require.NoError(t, err)
+
+	require.NoError(t, e.Export(context.Background()))
+	assert.True(t, strings.HasPrefix(<-lines, "nzb.nzbrepair_jobs_total.status.failed 1 "))
+}
@@ -0,0 +1,216 @@
+// Package metrics keeps a small in-process registry of counters and gauges and
+// exports it in the Prometheus text format, either to a Pushgateway or to a
+// node_exporter textfile collector.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels attached to a sample.
+type Labels map[string]string
+
+// Kind is the Prometheus metric type.
+type Kind string
+
+const (
+	KindCounter Kind = "counter"
+	KindGauge   Kind = "gauge"
+)
+
+// Sample is a single labelled value of a metric.
+type Sample struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels Labels
+	Value  float64
+}
+
+// Registry holds the current value of every metric.
+type Registry struct {
+	mu      sync.Mutex
+	samples map[string]*Sample
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{samples: make(map[string]*Sample)}
+}
+
+// Set stores v as the value of the gauge name.
+func (r *Registry) Set(name, help string, labels Labels, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sample(name, help, KindGauge, labels).Value = v
+}
+
+// Add increments the counter name by v.
+func (r *Registry) Add(name, help string, labels Labels, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sample(name, help, KindCounter, labels).Value += v
+}
+
+func (r *Registry) sample(name, help string, kind Kind, labels Labels) *Sample {
+	key := name + "{" + formatLabels(labels) + "}"
+	s, ok := r.samples[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &Sample{Name: name, Help: help, Kind: kind, Labels: copied}
+		r.samples[key] = s
+	}
+
+	return s
+}
+
+// Snapshot returns a copy of all samples ordered by name and labels.
+func (r *Registry) Snapshot() []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.samples))
+	for k := range r.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]Sample, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, *r.samples[k])
+	}
+
+	return out
+}
+
+// WritePrometheus writes all samples in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	var lastName string
+	for _, s := range r.Snapshot() {
+		if s.Name != lastName {
+			if s.Help != "" {
+				if _, err := fmt.Fprintf(w, "# HELP %s %s\n", s.Name, s.Help); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", s.Name, s.Kind); err != nil {
+				return err
+			}
+			lastName = s.Name
+		}
+
+		name := s.Name
+		if len(s.Labels) > 0 {
+			name += "{" + formatLabels(s.Labels) + "}"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", name, formatValue(s.Value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Push replaces the metrics of job on the Pushgateway at gatewayURL.
+func (r *Registry) Push(ctx context.Context, gatewayURL, job string) error {
+	var body bytes.Buffer
+	if err := r.WritePrometheus(&body); err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// WriteTextfile atomically writes the metrics to path for the node_exporter
+// textfile collector.
+func (r *Registry) WriteTextfile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics textfile: %w", err)
+	}
+
+	if err := r.WritePrometheus(tmp); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to close metrics textfile: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to set metrics textfile permissions: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func formatLabels(labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
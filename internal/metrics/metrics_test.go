@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	r.Add("nzbrepair_jobs_total", "Jobs processed.", Labels{"status": "failed"}, 1)
+	r.Add("nzbrepair_jobs_total", "Jobs processed.", Labels{"status": "completed"}, 2)
+	r.Add("nzbrepair_jobs_total", "Jobs processed.", Labels{"status": "completed"}, 1)
+	r.Set("nzbrepair_run_success", "", nil, 1)
+
+	var sb strings.Builder
+	require.NoError(t, r.WritePrometheus(&sb))
+
+	assert.Equal(t, `# HELP nzbrepair_jobs_total Jobs processed.
+# TYPE nzbrepair_jobs_total counter
+nzbrepair_jobs_total{status="completed"} 3
+nzbrepair_jobs_total{status="failed"} 1
+# TYPE nzbrepair_run_success gauge
+nzbrepair_run_success 1
+`, sb.String())
+}
+
+func TestRegistry_Push(t *testing.T) {
+	var gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPut, req.Method)
+		gotPath = req.URL.Path
+		b, _ := io.ReadAll(req.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	r.Set("nzbrepair_run_success", "", nil, 0)
+
+	require.NoError(t, r.Push(context.Background(), srv.URL+"/", "nzb-repair"))
+	assert.Equal(t, "/metrics/job/nzb-repair", gotPath)
+	assert.Contains(t, gotBody, "nzbrepair_run_success 0")
+}
+
+func TestRegistry_WriteTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nzb_repair.prom")
+
+	r := NewRegistry()
+	r.Set("nzbrepair_run_success", "", nil, 1)
+	require.NoError(t, r.WriteTextfile(path))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "nzbrepair_run_success 1")
+}
@@ -0,0 +1,72 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../repairnzb/availability.go
+//
+// Generated by this command:
+//
+//	mockgen -source=../repairnzb/availability.go -destination=./article_checker_mock.go -package=mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockArticleChecker is a mock of ArticleChecker interface.
+type MockArticleChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockArticleCheckerMockRecorder
+	isgomock struct{}
+}
+
+// MockArticleCheckerMockRecorder is the mock recorder for MockArticleChecker.
+type MockArticleCheckerMockRecorder struct {
+	mock *MockArticleChecker
+}
+
+// NewMockArticleChecker creates a new mock instance.
+func NewMockArticleChecker(ctrl *gomock.Controller) *MockArticleChecker {
+	mock := &MockArticleChecker{ctrl: ctrl}
+	mock.recorder = &MockArticleCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockArticleChecker) EXPECT() *MockArticleCheckerMockRecorder {
+	return m.recorder
+}
+
+// Head mocks base method.
+func (m *MockArticleChecker) Head(ctx context.Context, messageID string) (*nntppool.ArticleHead, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Head", ctx, messageID)
+	ret0, _ := ret[0].(*nntppool.ArticleHead)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Head indicates an expected call of Head.
+func (mr *MockArticleCheckerMockRecorder) Head(ctx, messageID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Head", reflect.TypeOf((*MockArticleChecker)(nil).Head), ctx, messageID)
+}
+
+// Stat mocks base method.
+func (m *MockArticleChecker) Stat(ctx context.Context, messageID string) (*nntppool.StatResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", ctx, messageID)
+	ret0, _ := ret[0].(*nntppool.StatResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockArticleCheckerMockRecorder) Stat(ctx, messageID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockArticleChecker)(nil).Stat), ctx, messageID)
+}
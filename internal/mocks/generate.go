@@ -2,3 +2,4 @@ package mocks
 
 //go:generate mockgen -source=../repairnzb/par2.go -destination=./par2_executor_mock.go -package=mocks
 //go:generate mockgen -source=../repairnzb/repair_nzb.go -destination=./nntp_pool_mock.go -package=mocks
+//go:generate mockgen -source=../repairnzb/availability.go -destination=./article_checker_mock.go -package=mocks
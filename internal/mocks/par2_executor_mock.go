@@ -41,18 +41,18 @@ func (m *MockPar2Executor) EXPECT() *MockPar2ExecutorMockRecorder {
 }
 
 // Create mocks base method.
-func (m *MockPar2Executor) Create(ctx context.Context, tmpPath string, redundancy int) ([]string, error) {
+func (m *MockPar2Executor) Create(ctx context.Context, tmpPath string, redundancy, blockCount int, blockSize int64) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", ctx, tmpPath, redundancy)
+	ret := m.ctrl.Call(m, "Create", ctx, tmpPath, redundancy, blockCount, blockSize)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockPar2ExecutorMockRecorder) Create(ctx, tmpPath, redundancy any) *gomock.Call {
+func (mr *MockPar2ExecutorMockRecorder) Create(ctx, tmpPath, redundancy, blockCount, blockSize any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPar2Executor)(nil).Create), ctx, tmpPath, redundancy)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPar2Executor)(nil).Create), ctx, tmpPath, redundancy, blockCount, blockSize)
 }
 
 // Repair mocks base method.
@@ -68,3 +68,17 @@ func (mr *MockPar2ExecutorMockRecorder) Repair(ctx, tmpPath any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Repair", reflect.TypeOf((*MockPar2Executor)(nil).Repair), ctx, tmpPath)
 }
+
+// Verify mocks base method.
+func (m *MockPar2Executor) Verify(ctx context.Context, tmpPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, tmpPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockPar2ExecutorMockRecorder) Verify(ctx, tmpPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockPar2Executor)(nil).Verify), ctx, tmpPath)
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// email sends the message through an SMTP server.
+type email struct {
+	cfg config.SMTPConfig
+}
+
+func (e *email) send(ctx context.Context, m Message) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+	}
+
+	// net/smtp takes no context, so the send is abandoned once ctx is done.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, e.cfg.From, e.cfg.To, e.message(m))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message formats m as a plain text mail.
+func (e *email) message(m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Title())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Text(), "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Endpoints of the services, replaced in tests.
+var (
+	telegramAPI = "https://api.telegram.org"
+	pushoverAPI = "https://api.pushover.net/1/messages.json"
+)
+
+// post sends body to endpoint and fails unless the service answers 2xx.
+func post(ctx context.Context, client *http.Client, endpoint, contentType string, body io.Reader, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint string, v any, headers map[string]string) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, client, endpoint, "application/json", bytes.NewReader(body), headers)
+}
+
+// webhook posts the message as JSON.
+type webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (w *webhook) send(ctx context.Context, m Message) error {
+	return postJSON(ctx, w.client, w.url, m, w.headers)
+}
+
+// discord posts the message to a Discord webhook.
+type discord struct {
+	url    string
+	client *http.Client
+}
+
+func (d *discord) send(ctx context.Context, m Message) error {
+	return postJSON(ctx, d.client, d.url, map[string]string{
+		"content": "**" + m.Title() + "**\n" + m.Text(),
+	}, nil)
+}
+
+// telegram sends the message with a Telegram bot.
+type telegram struct {
+	api    string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func (t *telegram) send(ctx context.Context, m Message) error {
+	return postJSON(ctx, t.client, t.api+"/bot"+t.token+"/sendMessage", map[string]string{
+		"chat_id": t.chatID,
+		"text":    m.Title() + "\n" + m.Text(),
+	}, nil)
+}
+
+// pushover sends the message with Pushover.
+type pushover struct {
+	api    string
+	token  string
+	user   string
+	client *http.Client
+}
+
+func (p *pushover) send(ctx context.Context, m Message) error {
+	form := url.Values{
+		"token":   {p.token},
+		"user":    {p.user},
+		"title":   {m.Title()},
+		"message": {m.Text()},
+	}
+
+	return post(ctx, p.client, p.api, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil)
+}
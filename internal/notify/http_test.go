@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capture serves one request and records its path and body.
+func capture(t *testing.T, status int) (*httptest.Server, *http.Request, *[]byte) {
+	t.Helper()
+
+	var (
+		got  http.Request
+		body []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = *req
+		require.NoError(t, req.ParseForm())
+		got.Form = req.Form
+		if req.Header.Get("Content-Type") == "application/json" {
+			var v map[string]string
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&v))
+			body, _ = json.Marshal(v)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &got, &body
+}
+
+var completed = Message{Event: events.JobCompleted, FilePath: "/watch/movie.nzb"}
+
+func TestDiscord(t *testing.T) {
+	srv, _, body := capture(t, http.StatusNoContent)
+
+	require.NoError(t, (&discord{url: srv.URL, client: http.DefaultClient}).send(context.Background(), completed))
+	assert.JSONEq(t, `{"content": "**nzb-repair: job repaired**\nFile: /watch/movie.nzb"}`, string(*body))
+}
+
+func TestTelegram(t *testing.T) {
+	srv, req, body := capture(t, http.StatusOK)
+
+	tg := &telegram{api: srv.URL, token: "123:abc", chatID: "42", client: http.DefaultClient}
+	require.NoError(t, tg.send(context.Background(), completed))
+	assert.Equal(t, "/bot123:abc/sendMessage", req.URL.Path)
+	assert.JSONEq(t, `{"chat_id": "42", "text": "nzb-repair: job repaired\nFile: /watch/movie.nzb"}`, string(*body))
+}
+
+func TestPushover(t *testing.T) {
+	srv, req, _ := capture(t, http.StatusOK)
+
+	po := &pushover{api: srv.URL, token: "app", user: "me", client: http.DefaultClient}
+	require.NoError(t, po.send(context.Background(), completed))
+	assert.Equal(t, "app", req.Form.Get("token"))
+	assert.Equal(t, "me", req.Form.Get("user"))
+	assert.Equal(t, "nzb-repair: job repaired", req.Form.Get("title"))
+}
+
+func TestPost_FailsOnErrorStatus(t *testing.T) {
+	srv, _, _ := capture(t, http.StatusBadRequest)
+
+	err := (&webhook{url: srv.URL, client: http.DefaultClient}).send(context.Background(), completed)
+	assert.ErrorContains(t, err, "400")
+}
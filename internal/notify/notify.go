@@ -0,0 +1,226 @@
+// Package notify sends notifications of finished watcher jobs to a webhook,
+// Discord, Telegram, Pushover or by e-mail. A Notifier subscribes to the
+// event bus and sends in the background, so a slow service never holds up
+// the queue.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/events"
+)
+
+// Notification types.
+const (
+	TypeWebhook  = "webhook"
+	TypeDiscord  = "discord"
+	TypeTelegram = "telegram"
+	TypePushover = "pushover"
+	TypeEmail    = "email"
+)
+
+// defaultTimeout bounds sending a notification without a timeout.
+const defaultTimeout = 10 * time.Second
+
+// defaultEvents are notified when a notification lists no events.
+var defaultEvents = []events.Type{events.JobCompleted, events.JobFailed, events.JobMoved}
+
+// notifiable are the events a notification may be sent for.
+var notifiable = []events.Type{events.JobCompleted, events.JobHealthy, events.JobFailed, events.JobMoved}
+
+// Message is a notification of a job event. Generic webhooks receive it as
+// JSON.
+type Message struct {
+	Event      events.Type `json:"event"`
+	Time       time.Time   `json:"time"`
+	JobID      int64       `json:"job_id,omitempty"`
+	FilePath   string      `json:"file_path,omitempty"`
+	OutputPath string      `json:"output_path,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	// Stats holds the fields of the event, e.g. the verdict and segment
+	// counts of a completed job or the count of moved jobs.
+	Stats map[string]any `json:"stats,omitempty"`
+}
+
+// Title summarizes the message in a line.
+func (m Message) Title() string {
+	switch m.Event {
+	case events.JobCompleted:
+		return "nzb-repair: job repaired"
+	case events.JobHealthy:
+		return "nzb-repair: job healthy"
+	case events.JobFailed:
+		return "nzb-repair: job failed"
+	case events.JobMoved:
+		return "nzb-repair: jobs moved to the broken folder"
+	}
+
+	return "nzb-repair: " + string(m.Event)
+}
+
+// Text is the body of the message for chat services and e-mail.
+func (m Message) Text() string {
+	var b strings.Builder
+	if m.FilePath != "" {
+		fmt.Fprintf(&b, "File: %s\n", m.FilePath)
+	}
+	if m.OutputPath != "" {
+		fmt.Fprintf(&b, "Output: %s\n", m.OutputPath)
+	}
+	if m.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", m.Error)
+	}
+
+	keys := make([]string, 0, len(m.Stats))
+	for k := range m.Stats {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", k, m.Stats[k])
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// sender delivers a message to a service.
+type sender interface {
+	send(ctx context.Context, m Message) error
+}
+
+type target struct {
+	cfg    config.NotificationConfig
+	events []events.Type
+	sender sender
+}
+
+// Notifier sends the configured notifications of the events published on a
+// bus.
+type Notifier struct {
+	targets []target
+	logger  *slog.Logger
+	wg      sync.WaitGroup
+}
+
+// Ensure Notifier implements events.Subscriber
+var _ events.Subscriber = (*Notifier)(nil)
+
+// New creates a Notifier for cfgs, which it checks.
+func New(cfgs []config.NotificationConfig, logger *slog.Logger) (*Notifier, error) {
+	n := &Notifier{logger: logger.With("component", "notify")}
+	for _, c := range cfgs {
+		t, err := newTarget(c)
+		if err != nil {
+			return nil, fmt.Errorf("notification %s: %w", c.Name, err)
+		}
+
+		n.targets = append(n.targets, t)
+	}
+
+	return n, nil
+}
+
+func newTarget(c config.NotificationConfig) (target, error) {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	t := target{cfg: c, events: defaultEvents}
+	if len(c.Events) > 0 {
+		t.events = make([]events.Type, 0, len(c.Events))
+		for _, e := range c.Events {
+			if !slices.Contains(notifiable, events.Type(e)) {
+				return target{}, fmt.Errorf("unknown event %q, expected job.completed, job.healthy, job.failed or job.moved", e)
+			}
+
+			t.events = append(t.events, events.Type(e))
+		}
+	}
+
+	var err error
+	t.sender, err = newSender(c)
+
+	return t, err
+}
+
+func newSender(c config.NotificationConfig) (sender, error) {
+	switch c.Type {
+	case TypeWebhook:
+		if c.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+
+		return &webhook{url: c.URL, headers: c.Headers, client: http.DefaultClient}, nil
+	case TypeDiscord:
+		if c.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+
+		return &discord{url: c.URL, client: http.DefaultClient}, nil
+	case TypeTelegram:
+		if c.Token == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("token and chat_id are required")
+		}
+
+		return &telegram{api: telegramAPI, token: c.Token, chatID: c.ChatID, client: http.DefaultClient}, nil
+	case TypePushover:
+		if c.Token == "" || c.User == "" {
+			return nil, fmt.Errorf("token and user are required")
+		}
+
+		return &pushover{api: pushoverAPI, token: c.Token, user: c.User, client: http.DefaultClient}, nil
+	case TypeEmail:
+		if c.SMTP.Host == "" || c.SMTP.From == "" || len(c.SMTP.To) == 0 {
+			return nil, fmt.Errorf("smtp host, from and to are required")
+		}
+
+		return &email{cfg: c.SMTP}, nil
+	}
+
+	return nil, fmt.Errorf("unknown type %q, expected webhook, discord, telegram, pushover or email", c.Type)
+}
+
+// HandleEvent sends the notifications registered for e in the background.
+func (n *Notifier) HandleEvent(ctx context.Context, e events.Event) {
+	m := Message{
+		Event:      e.Type,
+		Time:       e.Time,
+		JobID:      e.JobID,
+		FilePath:   e.FilePath,
+		OutputPath: e.OutputPath,
+		Error:      e.Error,
+		Stats:      e.Fields,
+	}
+
+	for _, t := range n.targets {
+		if !slices.Contains(t.events, e.Type) {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+
+			// A notification of the last job must not be cut short by shutdown.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), t.cfg.Timeout)
+			defer cancel()
+
+			if err := t.sender.send(ctx, m); err != nil {
+				n.logger.WarnContext(ctx, "Failed to send notification", "notification", t.cfg.Name, "event", e.Type, "job_id", e.JobID, "error", err)
+			}
+		}()
+	}
+}
+
+// Close waits for the notifications being sent.
+func (n *Notifier) Close() {
+	n.wg.Wait()
+}
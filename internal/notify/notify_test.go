@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_ChecksConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := New([]config.NotificationConfig{{Type: TypeWebhook, URL: "http://localhost"}}, logger)
+	require.NoError(t, err)
+
+	for _, c := range []config.NotificationConfig{
+		{Type: "sms"},
+		{Type: TypeWebhook},
+		{Type: TypeTelegram, Token: "token"},
+		{Type: TypePushover, User: "user"},
+		{Type: TypeEmail, SMTP: config.SMTPConfig{Host: "mail.example.com"}},
+		{Type: TypeDiscord, URL: "http://localhost", Events: []string{"job.started"}},
+	} {
+		_, err := New([]config.NotificationConfig{c}, logger)
+		assert.Error(t, err, "%+v", c)
+	}
+}
+
+func TestNotifier_SendsRegisteredEvents(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []Message
+		auth     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var m Message
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&m))
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, m)
+		auth = req.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	n, err := New([]config.NotificationConfig{{
+		Name:    "hook",
+		Type:    TypeWebhook,
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	bus := events.NewBus()
+	bus.Subscribe(n)
+	bus.Publish(context.Background(), events.Event{Type: events.JobStarted, JobID: 1})
+	bus.Publish(context.Background(), events.Event{Type: events.JobHealthy, JobID: 1})
+	bus.Publish(context.Background(), events.Event{
+		Type:       events.JobCompleted,
+		JobID:      2,
+		FilePath:   "/watch/movie.nzb",
+		OutputPath: "/out/movie.nzb",
+		Fields:     map[string]any{"segments_replaced": 12},
+	})
+	n.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1, "only the default events are sent")
+	assert.Equal(t, events.JobCompleted, received[0].Event)
+	assert.Equal(t, int64(2), received[0].JobID)
+	assert.Equal(t, "/out/movie.nzb", received[0].OutputPath)
+	assert.EqualValues(t, 12, received[0].Stats["segments_replaced"])
+	assert.Equal(t, "Bearer secret", auth)
+}
+
+func TestMessage_Text(t *testing.T) {
+	m := Message{
+		Event:    events.JobFailed,
+		FilePath: "/watch/movie.nzb",
+		Error:    "too damaged",
+		Stats:    map[string]any{"classification": "unrepairable"},
+	}
+
+	assert.Equal(t, "nzb-repair: job failed", m.Title())
+	assert.Equal(t, "File: /watch/movie.nzb\nError: too damaged\nclassification: unrepairable", m.Text())
+}
+
+func TestEmail_Message(t *testing.T) {
+	e := &email{cfg: config.SMTPConfig{From: "nzb-repair@example.com", To: []string{"a@example.com", "b@example.com"}}}
+
+	msg := string(e.message(Message{Event: events.JobMoved, Stats: map[string]any{"count": 2}}))
+	assert.Contains(t, msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, msg, "Subject: nzb-repair: jobs moved to the broken folder\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\ncount: 2\r\n"))
+}
@@ -0,0 +1,142 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// sabnzbdSink adds repaired NZBs to the queue of SABnzbd through the addfile
+// API.
+type sabnzbdSink struct {
+	url      string
+	apiKey   string
+	category string
+	client   *http.Client
+}
+
+func (s *sabnzbdSink) WriteNzb(ctx context.Context, path string, nzb []byte) (repairnzb.StoredNzb, error) {
+	body, contentType, err := multipartNzb("name", filepath.Base(path), nzb)
+	if err != nil {
+		return repairnzb.StoredNzb{}, err
+	}
+
+	query := url.Values{"mode": {"addfile"}, "output": {"json"}, "apikey": {s.apiKey}}
+	if s.category != "" {
+		query.Set("cat", s.category)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/api?"+query.Encode(), body)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to create sabnzbd request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to add repaired nzb to sabnzbd: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := checkResponse(resp); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to add repaired nzb to sabnzbd: %w", err)
+	}
+
+	var result struct {
+		Status bool     `json:"status"`
+		NzoIDs []string `json:"nzo_ids"`
+		Error  string   `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to decode sabnzbd response: %w", err)
+	}
+
+	if !result.Status || len(result.NzoIDs) == 0 {
+		return repairnzb.StoredNzb{}, fmt.Errorf("sabnzbd rejected the repaired nzb: %s", result.Error)
+	}
+
+	return repairnzb.StoredNzb{Location: "sabnzbd:" + result.NzoIDs[0]}, nil
+}
+
+// nzbgetSink adds repaired NZBs to the queue of NZBGet through the append
+// JSON-RPC method.
+type nzbgetSink struct {
+	url      string
+	username string
+	password string
+	category string
+	client   *http.Client
+}
+
+func (s *nzbgetSink) WriteNzb(ctx context.Context, path string, nzb []byte) (repairnzb.StoredNzb, error) {
+	// NZBFilename, Content, Category, Priority, AddToTop, AddPaused, DupeKey,
+	// DupeScore, DupeMode, PPParameters.
+	params := []any{
+		filepath.Base(path),
+		base64.StdEncoding.EncodeToString(nzb),
+		s.category,
+		0,
+		false,
+		false,
+		"",
+		0,
+		"SCORE",
+		[]any{},
+	}
+
+	b, err := json.Marshal(map[string]any{"method": "append", "params": params})
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to encode nzbget request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/jsonrpc", bytes.NewReader(b))
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to create nzbget request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to add repaired nzb to nzbget: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := checkResponse(resp); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to add repaired nzb to nzbget: %w", err)
+	}
+
+	var result struct {
+		Result int64 `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to decode nzbget response: %w", err)
+	}
+
+	if result.Error != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("nzbget rejected the repaired nzb: %s", result.Error.Message)
+	}
+	// append returns the id of the new queue entry, or 0 or less on failure.
+	if result.Result <= 0 {
+		return repairnzb.StoredNzb{}, errors.New("nzbget rejected the repaired nzb")
+	}
+
+	return repairnzb.StoredNzb{Location: fmt.Sprintf("nzbget:%d", result.Result)}, nil
+}
@@ -0,0 +1,76 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// httpSink POSTs repaired NZBs to a URL as the "file" field of a multipart
+// form, named after the base name of their output path.
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *httpSink) WriteNzb(ctx context.Context, path string, nzb []byte) (repairnzb.StoredNzb, error) {
+	body, contentType, err := multipartNzb("file", filepath.Base(path), nzb)
+	if err != nil {
+		return repairnzb.StoredNzb{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, body)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to create output request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to post repaired nzb: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := checkResponse(resp); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to post repaired nzb: %w", err)
+	}
+
+	// Endpoints that store the upload may say where.
+	location := s.url
+	if l, err := resp.Location(); err == nil {
+		location = l.String()
+	}
+
+	return repairnzb.StoredNzb{Location: location}, nil
+}
+
+// multipartNzb encodes nzb as the file field of a multipart form, named
+// name.
+func multipartNzb(field, name string, nzb []byte) (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreateFormFile(field, name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode output request: %w", err)
+	}
+	if _, err := part.Write(nzb); err != nil {
+		return nil, "", fmt.Errorf("failed to encode output request: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to encode output request: %w", err)
+	}
+
+	return &buf, w.FormDataContentType(), nil
+}
@@ -0,0 +1,125 @@
+// Package output provides the output sinks that store repaired NZBs away from
+// the local file system: an HTTP endpoint, an S3 bucket, or the queue of
+// SABnzbd or NZBGet.
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// Sink types.
+const (
+	TypeLocal   = "local"
+	TypeHTTP    = "http"
+	TypeS3      = "s3"
+	TypeSABnzbd = "sabnzbd"
+	TypeNZBGet  = "nzbget"
+)
+
+// defaultTimeout bounds a single upload when Config.Timeout is not set.
+const defaultTimeout = 30 * time.Second
+
+// Config configures a remote output sink.
+type Config struct {
+	// Type is TypeHTTP, TypeS3, TypeSABnzbd or TypeNZBGet.
+	Type string
+	// URL is the endpoint of the http sink, the S3 endpoint, or the base URL
+	// of the downloader.
+	URL string
+	// Headers are set on the requests of the http sink.
+	Headers map[string]string
+	// APIKey authenticates with SABnzbd.
+	APIKey string
+	// Username and Password authenticate with NZBGet.
+	Username string
+	Password string
+	// Category is the downloader category the NZB is added to.
+	Category string
+	// Bucket, Region and Prefix locate the objects of the s3 sink.
+	Bucket string
+	Region string
+	Prefix string
+	// AccessKey and SecretKey sign the requests of the s3 sink.
+	AccessKey string
+	SecretKey string
+	Timeout   time.Duration
+}
+
+// New returns the sink of cfg.
+func New(cfg Config) (repairnzb.OutputSink, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Type {
+	case TypeHTTP:
+		if cfg.URL == "" {
+			return nil, errors.New("http output sink requires a url")
+		}
+
+		return &httpSink{url: cfg.URL, headers: cfg.Headers, client: client}, nil
+	case TypeS3:
+		if cfg.Bucket == "" || cfg.Region == "" {
+			return nil, errors.New("s3 output sink requires a bucket and a region")
+		}
+		if cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return nil, errors.New("s3 output sink requires an access key and a secret key")
+		}
+
+		endpoint := cfg.URL
+		if endpoint == "" {
+			endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+		}
+
+		return &s3Sink{
+			endpoint:  strings.TrimSuffix(endpoint, "/"),
+			bucket:    cfg.Bucket,
+			region:    cfg.Region,
+			prefix:    cfg.Prefix,
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			client:    client,
+			now:       time.Now,
+		}, nil
+	case TypeSABnzbd:
+		if cfg.URL == "" || cfg.APIKey == "" {
+			return nil, errors.New("sabnzbd output sink requires a url and an api key")
+		}
+
+		return &sabnzbdSink{url: strings.TrimSuffix(cfg.URL, "/"), apiKey: cfg.APIKey, category: cfg.Category, client: client}, nil
+	case TypeNZBGet:
+		if cfg.URL == "" {
+			return nil, errors.New("nzbget output sink requires a url")
+		}
+
+		return &nzbgetSink{
+			url:      strings.TrimSuffix(cfg.URL, "/"),
+			username: cfg.Username,
+			password: cfg.Password,
+			category: cfg.Category,
+			client:   client,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output sink %q, expected local, http, s3, sabnzbd or nzbget", cfg.Type)
+}
+
+// checkResponse returns an error for non-2xx responses, quoting the start of
+// their body.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
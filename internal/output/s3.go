@@ -0,0 +1,159 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// s3Sink uploads repaired NZBs to an S3 compatible bucket, as objects named
+// after the base name of their output path below prefix. Requests use path
+// style addressing, which MinIO and most other implementations accept.
+type s3Sink struct {
+	endpoint  string
+	bucket    string
+	region    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func (s *s3Sink) WriteNzb(ctx context.Context, path string, nzb []byte) (repairnzb.StoredNzb, error) {
+	key := strings.TrimPrefix(s.prefix+filepath.Base(path), "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+"/"+s.bucket+"/"+uriEncode(key, false), bytes.NewReader(nzb))
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-nzb")
+	s.sign(req, nzb, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to upload repaired nzb to s3: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := checkResponse(resp); err != nil {
+		return repairnzb.StoredNzb{}, fmt.Errorf("failed to upload repaired nzb to s3: %w", err)
+	}
+
+	return repairnzb.StoredNzb{Location: "s3://" + s.bucket + "/" + key}, nil
+}
+
+// sign adds the AWS Signature Version 4 of req, with payload as its body, to
+// its headers. Every header set on req is signed.
+func (s *s3Sink) sign(req *http.Request, payload []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// canonicalQuery returns the query of req sorted and encoded for signing.
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters of
+// RFC 3986 and, unless encodeSlash is set, slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,353 @@
+package pools
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+)
+
+// ArticleCache keeps downloaded article bodies on disk, keyed by message-ID,
+// so jobs sharing articles (the same release grabbed from two indexers, or a
+// retried job) read them from disk instead of the provider. The least recently
+// used articles are evicted once the cache exceeds its size. Recency survives
+// restarts through the modification time of the cached files.
+type ArticleCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// cachedMeta is the first line of a cached article. Articles cached before
+// the CRC was kept have no CRC and are served unchecked.
+type cachedMeta struct {
+	nntppool.YEncMeta
+	// CRC is the CRC32 the yEnc trailer announced for the body.
+	CRC uint32 `json:",omitempty"`
+}
+
+// NewArticleCache opens the cache in dir, creating it if needed, and indexes
+// the articles already there. It returns nil, which caches nothing, when dir
+// is empty.
+func NewArticleCache(dir string, maxBytes int64) (*ArticleCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create article cache directory: %w", err)
+	}
+
+	c := &ArticleCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+
+	type found struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var existing []found
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// Temporary files of interrupted writes have an extension.
+		if filepath.Ext(path) != "" {
+			_ = os.Remove(path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		existing = append(existing, found{key: d.Name(), size: info.Size(), modTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index article cache: %w", err)
+	}
+
+	// Oldest first, so the most recently used end up at the front.
+	sort.Slice(existing, func(i, j int) bool { return existing[i].modTime.Before(existing[j].modTime) })
+	c.mu.Lock()
+	for _, f := range existing {
+		c.entries[f.key] = c.lru.PushFront(&cacheEntry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+	c.evictLocked()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Wrap returns p reading articles through the cache. A nil cache returns p.
+func (c *ArticleCache) Wrap(p repairnzb.NNTPPool) repairnzb.NNTPPool {
+	if c == nil {
+		return p
+	}
+
+	return &cachedPool{NNTPPool: p, cache: c}
+}
+
+// Stats returns the number of article reads served from the cache and from
+// the provider.
+func (c *ArticleCache) Stats() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Size returns the bytes held by the cache.
+func (c *ArticleCache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+func cacheKey(messageID string) string {
+	sum := sha256.Sum256([]byte(messageID))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ArticleCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// get returns the cached body of messageID and its yEnc metadata. A body that
+// no longer matches its CRC, e.g. after a disk error, is dropped.
+func (c *ArticleCache) get(messageID string) ([]byte, cachedMeta, bool) {
+	key := cacheKey(messageID)
+
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, cachedMeta{}, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.remove(key)
+		return nil, cachedMeta{}, false
+	}
+
+	// The first line holds the yEnc metadata, the rest is the body.
+	header, body, ok := bytes.Cut(data, []byte("\n"))
+	var meta cachedMeta
+	if !ok || json.Unmarshal(header, &meta) != nil || (meta.CRC != 0 && crc32.ChecksumIEEE(body) != meta.CRC) {
+		c.remove(key)
+		return nil, cachedMeta{}, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+
+	return body, meta, true
+}
+
+// put stores the body of messageID, evicting older articles when the cache
+// grows beyond its size.
+func (c *ArticleCache) put(messageID string, body []byte, meta cachedMeta) error {
+	key := cacheKey(messageID)
+	path := c.path(key)
+
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	_, _ = w.Write(header)
+	_ = w.WriteByte('\n')
+	_, err = w.Write(body)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	size := int64(len(header) + 1 + len(body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		el.Value.(*cacheEntry).size = size
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	}
+	c.size += size
+	c.evictLocked()
+
+	return nil
+}
+
+func (c *ArticleCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*cacheEntry).size
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	_ = os.Remove(c.path(key))
+}
+
+func (c *ArticleCache) evictLocked() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 0 {
+		el := c.lru.Back()
+		e := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		c.size -= e.size
+		_ = os.Remove(c.path(e.key))
+	}
+}
+
+// cachedPool reads articles through an ArticleCache.
+type cachedPool struct {
+	repairnzb.NNTPPool
+	cache *ArticleCache
+}
+
+// Ensure cachedPool implements repairnzb.ArticleChecker
+var _ repairnzb.ArticleChecker = (*cachedPool)(nil)
+
+// BodyStream serves the article from the cache when the provider still has it,
+// and caches articles downloaded from the provider. A cached article is
+// confirmed with STAT, so articles that expired or were taken down are still
+// reported missing and get repaired.
+func (p *cachedPool) BodyStream(ctx context.Context, messageID string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	if body, meta, ok := p.cache.get(messageID); ok {
+		if _, err := p.Stat(ctx, messageID); errors.Is(err, nntppool.ErrArticleNotFound) {
+			p.cache.remove(cacheKey(messageID))
+			return nil, err
+		}
+
+		p.cache.hits.Add(1)
+		for _, fn := range onMeta {
+			fn(meta.YEncMeta)
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+
+		// The CRC lets the repair verify cached segments like downloaded ones.
+		return &nntppool.ArticleBody{
+			MessageID:    messageID,
+			BytesDecoded: len(body),
+			YEnc:         meta.YEncMeta,
+			CRC:          meta.CRC,
+			ExpectedCRC:  meta.CRC,
+			CRCValid:     meta.CRC != 0,
+		}, nil
+	}
+
+	p.cache.misses.Add(1)
+
+	var buf bytes.Buffer
+	var meta nntppool.YEncMeta
+	onMeta = append(onMeta, func(m nntppool.YEncMeta) { meta = m })
+	body, err := p.NNTPPool.BodyStream(ctx, messageID, io.MultiWriter(w, &buf), onMeta...)
+	if err != nil {
+		return body, err
+	}
+
+	cached := cachedMeta{YEncMeta: meta}
+	if body != nil {
+		if body.YEnc != (nntppool.YEncMeta{}) {
+			cached.YEncMeta = body.YEnc
+		}
+		cached.CRC = body.ExpectedCRC
+	}
+	// A failed write only loses the cache entry, never the download.
+	_ = p.cache.put(messageID, buf.Bytes(), cached)
+
+	return body, nil
+}
+
+// Stat checks the article with the wrapped pool.
+func (p *cachedPool) Stat(ctx context.Context, messageID string) (*nntppool.StatResult, error) {
+	c, ok := p.NNTPPool.(repairnzb.ArticleChecker)
+	if !ok {
+		// Without STAT the cached copy cannot be confirmed; trust it.
+		return &nntppool.StatResult{MessageID: messageID}, nil
+	}
+
+	return c.Stat(ctx, messageID)
+}
+
+// Head fetches the headers of the article with the wrapped pool.
+func (p *cachedPool) Head(ctx context.Context, messageID string) (*nntppool.ArticleHead, error) {
+	c, ok := p.NNTPPool.(repairnzb.ArticleChecker)
+	if !ok {
+		return nil, errors.New("pool cannot check articles")
+	}
+
+	return c.Head(ctx, messageID)
+}
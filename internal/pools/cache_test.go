@@ -0,0 +1,133 @@
+package pools
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func writeBody(body string) func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	return func(_ context.Context, _ string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+		meta := nntppool.YEncMeta{FileName: "show.mkv", Part: 1}
+		for _, fn := range onMeta {
+			fn(meta)
+		}
+		_, err := w.Write([]byte(body))
+		return &nntppool.ArticleBody{BytesDecoded: len(body), YEnc: meta}, err
+	}
+}
+
+func TestArticleCache_ServesRepeatedReads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	inner := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	inner.MockNNTPPool.EXPECT().BodyStream(gomock.Any(), "a@test", gomock.Any(), gomock.Any()).DoAndReturn(writeBody("article")).Times(1)
+	inner.MockArticleChecker.EXPECT().Stat(gomock.Any(), "a@test").Return(&nntppool.StatResult{}, nil)
+
+	cache, err := NewArticleCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+	p := cache.Wrap(inner)
+
+	for range 2 {
+		var buf bytes.Buffer
+		var meta nntppool.YEncMeta
+		body, err := p.BodyStream(context.Background(), "a@test", &buf, func(m nntppool.YEncMeta) { meta = m })
+		require.NoError(t, err)
+		assert.Equal(t, "article", buf.String())
+		assert.Equal(t, 7, body.BytesDecoded)
+		assert.Equal(t, "show.mkv", meta.FileName)
+	}
+
+	hits, misses := cache.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(1), misses)
+}
+
+func TestArticleCache_MissingOnProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	inner := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	inner.MockNNTPPool.EXPECT().BodyStream(gomock.Any(), "gone@test", gomock.Any(), gomock.Any()).DoAndReturn(writeBody("article"))
+	inner.MockArticleChecker.EXPECT().Stat(gomock.Any(), "gone@test").Return(nil, nntppool.ErrArticleNotFound)
+
+	cache, err := NewArticleCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+	p := cache.Wrap(inner)
+
+	_, err = p.BodyStream(context.Background(), "gone@test", io.Discard)
+	require.NoError(t, err)
+
+	_, err = p.BodyStream(context.Background(), "gone@test", io.Discard)
+	require.ErrorIs(t, err, nntppool.ErrArticleNotFound, "a cached copy does not hide a taken down article")
+	assert.Zero(t, cache.Size())
+}
+
+func TestArticleCache_ChecksCRC(t *testing.T) {
+	cache, err := NewArticleCache(t.TempDir(), 1<<20)
+	require.NoError(t, err)
+
+	crc := crc32.ChecksumIEEE([]byte("article"))
+	require.NoError(t, cache.put("a@test", []byte("article"), cachedMeta{CRC: crc}))
+
+	body := cachedBody(t, cache, "a@test")
+	assert.Equal(t, crc, body.ExpectedCRC, "cached segments are verified like downloaded ones")
+
+	// The cached copy rots on disk.
+	path := cache.path(cacheKey("a@test"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, bytes.Replace(data, []byte("article"), []byte("artXcle"), 1), 0644))
+
+	_, _, ok := cache.get("a@test")
+	assert.False(t, ok, "a corrupt article is downloaded again")
+	assert.Zero(t, cache.Size())
+}
+
+// cachedBody reads messageID through the cache, which must hold it.
+func cachedBody(t *testing.T, cache *ArticleCache, messageID string) *nntppool.ArticleBody {
+	t.Helper()
+
+	ctrl := gomock.NewController(t)
+	inner := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	inner.MockArticleChecker.EXPECT().Stat(gomock.Any(), messageID).Return(&nntppool.StatResult{}, nil)
+
+	body, err := cache.Wrap(inner).BodyStream(context.Background(), messageID, io.Discard)
+	require.NoError(t, err)
+
+	return body
+}
+
+func TestArticleCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewArticleCache(dir, 300)
+	require.NoError(t, err)
+
+	body := bytes.Repeat([]byte("x"), 60)
+	require.NoError(t, cache.put("a@test", body, cachedMeta{}))
+	require.NoError(t, cache.put("b@test", body, cachedMeta{}))
+	_, _, ok := cache.get("a@test")
+	require.True(t, ok)
+	require.NoError(t, cache.put("c@test", body, cachedMeta{}))
+
+	_, _, ok = cache.get("b@test")
+	assert.False(t, ok, "the least recently used article is evicted")
+	_, _, ok = cache.get("a@test")
+	assert.True(t, ok)
+
+	reopened, err := NewArticleCache(dir, 300)
+	require.NoError(t, err)
+	assert.Equal(t, cache.Size(), reopened.Size(), "the cache survives restarts")
+	_, _, ok = reopened.get("c@test")
+	assert.True(t, ok)
+
+	disabled, err := NewArticleCache("", 0)
+	require.NoError(t, err)
+	assert.Nil(t, disabled)
+}
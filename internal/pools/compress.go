@@ -0,0 +1,267 @@
+package pools
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+)
+
+const (
+	compressCommand = "COMPRESS DEFLATE\r\n"
+	// compressActive is the status code of an accepted COMPRESS DEFLATE.
+	compressActive = 206
+	// handshakeTimeout bounds the greeting, authentication and compression
+	// negotiation of a new connection.
+	handshakeTimeout = 30 * time.Second
+)
+
+// compressionCounter accumulates the traffic of a provider's compressed
+// connections.
+type compressionCounter struct {
+	raw  atomic.Int64
+	wire atomic.Int64
+}
+
+// Compress makes p request COMPRESS DEFLATE (RFC 8054) on every connection it
+// opens. Servers that refuse it are used uncompressed. The raw and on-the-wire
+// bytes of compressed connections are accounted under name; a nil meter
+// compresses without accounting.
+//
+// Compression must be enabled after authentication, before nntppool takes
+// over the connection, so the handshake happens here: nntppool then receives
+// the original greeting and its AUTHINFO commands are answered locally.
+func (m *UsageMeter) Compress(name string, p nntppool.Provider) nntppool.Provider {
+	counter := &compressionCounter{}
+	if m != nil {
+		m.mu.Lock()
+		if c, ok := m.compression[name]; ok {
+			counter = c
+		} else {
+			m.compression[name] = counter
+		}
+		m.mu.Unlock()
+	}
+
+	dial := p.Factory
+	if dial == nil {
+		dial = netDialer(p.Host, p.TLSConfig, p.KeepAlive)
+	}
+
+	auth := p.Auth
+	p.Factory = func(ctx context.Context) (net.Conn, error) {
+		conn, err := dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := negotiateCompression(ctx, conn, auth, counter)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	return p
+}
+
+// negotiateCompression reads the greeting of conn, authenticates and requests
+// compression.
+func negotiateCompression(ctx context.Context, conn net.Conn, auth nntppool.Auth, counter *compressionCounter) (net.Conn, error) {
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	greeting, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("nntp greeting: %w", err)
+	}
+
+	c := &compressedConn{Conn: conn, r: br, w: conn, local: []byte(greeting)}
+	if code := statusCode(greeting); code != 200 && code != 201 {
+		// Let nntppool report the refused greeting.
+		return c, nil
+	}
+
+	if auth.Username != "" {
+		if err := command(conn, br, "AUTHINFO USER "+auth.Username+"\r\n", 381, 281); err != nil {
+			return nil, fmt.Errorf("nntp auth: AUTHINFO USER: %w", err)
+		}
+		if err := command(conn, br, "AUTHINFO PASS "+auth.Password+"\r\n", 281); err != nil {
+			return nil, fmt.Errorf("nntp auth: AUTHINFO PASS: %w", err)
+		}
+		c.answerAuth = true
+	}
+
+	if err := command(conn, br, compressCommand, compressActive); err == nil {
+		wire := &countingConn{Conn: conn, n: &counter.wire}
+
+		// Anything buffered past the 206 response is already compressed.
+		buffered, _ := br.Peek(br.Buffered())
+		fw, err := flate.NewWriter(wire, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+
+		c.r = flate.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), wire)))
+		c.w = fw
+		c.flush = fw.Flush
+		c.raw = &counter.raw
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// command sends cmd and checks that the response has one of the expected codes.
+func command(w io.Writer, br *bufio.Reader, cmd string, expected ...int) error {
+	if _, err := io.WriteString(w, cmd); err != nil {
+		return err
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	code := statusCode(line)
+	for _, e := range expected {
+		if code == e {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected response %q", strings.TrimSpace(line))
+}
+
+func statusCode(line string) int {
+	if len(line) < 3 {
+		return 0
+	}
+
+	code, _ := strconv.Atoi(line[:3])
+
+	return code
+}
+
+// compressedConn hands nntppool a connection that was already greeted and
+// authenticated, and compresses its traffic once compression is active.
+type compressedConn struct {
+	net.Conn
+	r     io.Reader
+	w     io.Writer
+	flush func() error
+	// raw counts the uncompressed bytes of a compressed connection.
+	raw *atomic.Int64
+
+	mu sync.Mutex
+	// local holds responses produced locally, starting with the greeting.
+	local []byte
+	// answerAuth answers the AUTHINFO commands of nntppool locally, as the
+	// connection is already authenticated.
+	answerAuth bool
+
+	wmu sync.Mutex
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.local) > 0 {
+		n := copy(p, c.local)
+		c.local = c.local[n:]
+		c.mu.Unlock()
+
+		return n, nil
+	}
+	c.mu.Unlock()
+
+	n, err := c.r.Read(p)
+	if c.raw != nil {
+		c.raw.Add(int64(n))
+	}
+
+	return n, err
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	if c.answeredLocally(p) {
+		return len(p), nil
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	n, err := c.w.Write(p)
+	if err == nil && c.flush != nil {
+		// The server must see every command as soon as it is sent.
+		err = c.flush()
+	}
+	if c.raw != nil {
+		c.raw.Add(int64(n))
+	}
+
+	return n, err
+}
+
+// answeredLocally queues the response to an AUTHINFO command of nntppool.
+func (c *compressedConn) answeredLocally(p []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.answerAuth {
+		return false
+	}
+
+	switch {
+	case bytes.HasPrefix(p, []byte("AUTHINFO USER ")):
+		c.local = append(c.local, "381 Password required\r\n"...)
+	case bytes.HasPrefix(p, []byte("AUTHINFO PASS ")):
+		c.local = append(c.local, "281 Authentication accepted\r\n"...)
+		c.answerAuth = false
+	default:
+		c.answerAuth = false
+		return false
+	}
+
+	return true
+}
+
+// countingConn counts the bytes read from and written to a connection.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+
+	return n, err
+}
@@ -0,0 +1,115 @@
+package pools
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCompressServer greets, authenticates and answers COMPRESS DEFLATE with
+// compressCode, then answers DATE over the negotiated stream.
+func fakeCompressServer(t *testing.T, compressCode string) nntppool.ConnFactory {
+	return func(context.Context) (net.Conn, error) {
+		client, server := net.Pipe()
+
+		go func() {
+			defer func() { _ = server.Close() }()
+
+			br := bufio.NewReader(server)
+			_, _ = io.WriteString(server, "200 news ready\r\n")
+			for _, resp := range []string{"381 more\r\n", "281 ok\r\n", compressCode + " compress\r\n"} {
+				if _, err := br.ReadString('\n'); err != nil {
+					return
+				}
+				_, _ = io.WriteString(server, resp)
+			}
+
+			var (
+				r io.Reader = br
+				w io.Writer = server
+			)
+			flush := func() error { return nil }
+			if compressCode == "206" {
+				fw, _ := flate.NewWriter(server, flate.BestCompression)
+				r, w, flush = bufio.NewReader(flate.NewReader(br)), fw, fw.Flush
+			}
+
+			line, err := bufio.NewReader(r).ReadString('\n')
+			if err != nil || line != "DATE\r\n" {
+				t.Errorf("unexpected command %q: %v", line, err)
+				return
+			}
+			_, _ = io.WriteString(w, "111 "+strings.Repeat("2", 200)+"\r\n")
+			_ = flush()
+		}()
+
+		return client, nil
+	}
+}
+
+func exchange(t *testing.T, conn net.Conn, cmd string) string {
+	t.Helper()
+
+	_, err := io.WriteString(conn, cmd)
+	require.NoError(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+
+	return line
+}
+
+func TestUsageMeter_CompressNegotiatesDeflate(t *testing.T) {
+	m := NewUsageMeter()
+	p := m.Compress("main", nntppool.Provider{
+		Host:    "news",
+		Auth:    nntppool.Auth{Username: "user", Password: "pass"},
+		Factory: fakeCompressServer(t, "206"),
+	})
+
+	conn, err := p.Factory(context.Background())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "200 news ready\r\n", greeting, "nntppool sees the original greeting")
+
+	assert.Equal(t, "381 Password required\r\n", exchange(t, conn, "AUTHINFO USER user\r\n"))
+	assert.Equal(t, "281 Authentication accepted\r\n", exchange(t, conn, "AUTHINFO PASS pass\r\n"))
+	assert.True(t, strings.HasPrefix(exchange(t, conn, "DATE\r\n"), "111 "))
+
+	u := m.Collect()["main"]
+	assert.Equal(t, int64(len("DATE\r\n")+len("111 \r\n")+200), u.CompressedRaw)
+	assert.Positive(t, u.CompressedWire)
+	assert.Less(t, u.CompressedWire, u.CompressedRaw)
+}
+
+func TestUsageMeter_CompressFallsBackWhenRefused(t *testing.T) {
+	m := NewUsageMeter()
+	p := m.Compress("main", nntppool.Provider{
+		Host:    "news",
+		Auth:    nntppool.Auth{Username: "user", Password: "pass"},
+		Factory: fakeCompressServer(t, "500"),
+	})
+
+	conn, err := p.Factory(context.Background())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	exchange(t, conn, "AUTHINFO USER user\r\n")
+	exchange(t, conn, "AUTHINFO PASS pass\r\n")
+	assert.True(t, strings.HasPrefix(exchange(t, conn, "DATE\r\n"), "111 "), "the connection works uncompressed")
+
+	assert.Empty(t, m.Collect(), "uncompressed traffic is not accounted as compressed")
+}
@@ -0,0 +1,238 @@
+package pools
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+)
+
+const (
+	// dialTimeout bounds connecting and the TLS handshake of a limited
+	// connection, like nntppool does for the connections it dials itself.
+	dialTimeout = 10 * time.Second
+	// preemptIdleAfter is how long a connection must have been quiet, with
+	// every request answered, before a waiting dial may close it.
+	preemptIdleAfter = 5 * time.Second
+	// preemptInterval is how often a waiting dial looks for idle connections.
+	preemptInterval = time.Second
+)
+
+// ConnLimiter caps the number of open NNTP connections across every pool
+// whose providers were passed through Provider. Some providers count
+// connections per account, so the sum over download and upload pools must
+// stay within the plan even though each pool is sized on its own.
+//
+// Pools keep idle connections open until their idle timeout, so a dial that
+// waits for a slot closes an idle connection of any pool to take its place.
+type ConnLimiter struct {
+	slots chan struct{}
+	now   func() time.Time
+
+	mu    sync.Mutex
+	conns map[*limitedConn]struct{}
+}
+
+// NewConnLimiter creates a limiter allowing max open connections. It returns
+// nil, which limits nothing, when max <= 0.
+func NewConnLimiter(max int) *ConnLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &ConnLimiter{
+		slots: make(chan struct{}, max),
+		now:   time.Now,
+		conns: make(map[*limitedConn]struct{}),
+	}
+}
+
+// Max returns the connection cap.
+func (l *ConnLimiter) Max() int {
+	if l == nil {
+		return 0
+	}
+
+	return cap(l.slots)
+}
+
+// InUse returns the number of open limited connections.
+func (l *ConnLimiter) InUse() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.slots)
+}
+
+// Provider makes p dial through the limiter: a new connection waits for a
+// free slot and holds it until the connection is closed. A nil limiter
+// returns p unchanged.
+func (l *ConnLimiter) Provider(p nntppool.Provider) nntppool.Provider {
+	if l == nil {
+		return p
+	}
+
+	dial := p.Factory
+	if dial == nil {
+		dial = netDialer(p.Host, p.TLSConfig, p.KeepAlive)
+	}
+
+	p.Factory = l.factory(dial)
+
+	return p
+}
+
+func (l *ConnLimiter) factory(dial nntppool.ConnFactory) nntppool.ConnFactory {
+	return func(ctx context.Context) (net.Conn, error) {
+		if err := l.acquire(ctx); err != nil {
+			return nil, err
+		}
+
+		conn, err := dial(ctx)
+		if err != nil {
+			<-l.slots
+			return nil, err
+		}
+
+		lc := &limitedConn{Conn: conn, limiter: l}
+		lc.touch(&lc.lastRead)
+
+		l.mu.Lock()
+		l.conns[lc] = struct{}{}
+		l.mu.Unlock()
+
+		return lc, nil
+	}
+}
+
+// acquire takes a slot, closing idle connections while it waits for one.
+func (l *ConnLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	ticker := time.NewTicker(preemptInterval)
+	defer ticker.Stop()
+
+	for {
+		l.preemptIdle()
+
+		select {
+		case l.slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// preemptIdle closes the connection that has been idle the longest, if any
+// has been idle for preemptIdleAfter.
+func (l *ConnLimiter) preemptIdle() {
+	now := l.now()
+
+	l.mu.Lock()
+	var victim *limitedConn
+	var victimIdle time.Duration
+	for c := range l.conns {
+		if idle, ok := c.idleFor(now); ok && idle >= preemptIdleAfter && idle > victimIdle {
+			victim, victimIdle = c, idle
+		}
+	}
+	l.mu.Unlock()
+
+	if victim != nil {
+		_ = victim.Close()
+	}
+}
+
+func (l *ConnLimiter) release(c *limitedConn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+
+	<-l.slots
+}
+
+// limitedConn releases its limiter slot when closed and tracks its traffic
+// to tell whether it is idle.
+type limitedConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	once    sync.Once
+
+	// lastRead and lastWrite are unix nanoseconds of the last traffic.
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.touch(&c.lastRead)
+	}
+
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	c.touch(&c.lastWrite)
+
+	return c.Conn.Write(p)
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.limiter.release(c) })
+
+	return err
+}
+
+func (c *limitedConn) touch(t *atomic.Int64) {
+	t.Store(c.limiter.now().UnixNano())
+}
+
+// idleFor returns how long the connection has been quiet. A connection that
+// wrote after its last read still awaits a response and is not idle.
+func (c *limitedConn) idleFor(now time.Time) (time.Duration, bool) {
+	read, write := c.lastRead.Load(), c.lastWrite.Load()
+	if write > read {
+		return 0, false
+	}
+
+	return now.Sub(time.Unix(0, read)), true
+}
+
+// netDialer dials addr like nntppool does for providers without a factory.
+func netDialer(addr string, tlsConfig *tls.Config, keepAlive time.Duration) nntppool.ConnFactory {
+	return func(ctx context.Context) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+
+		dialer := net.Dialer{KeepAlive: keepAlive}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if tlsConfig == nil {
+			return conn, nil
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
@@ -0,0 +1,83 @@
+package pools
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pipeFactory(context.Context) (net.Conn, error) {
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestConnLimiter_CapsOpenConnections(t *testing.T) {
+	l := NewConnLimiter(1)
+	dial := l.Provider(nntppool.Provider{Host: "news", Factory: pipeFactory}).Factory
+
+	first, err := dial(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, l.InUse())
+
+	// A request is outstanding, so the connection must not be preempted.
+	first.(*limitedConn).touch(&first.(*limitedConn).lastWrite)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = dial(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "a second connection waits for a free slot")
+
+	dialed := make(chan net.Conn)
+	go func() {
+		c, err := dial(context.Background())
+		assert.NoError(t, err)
+		dialed <- c
+	}()
+
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close(), "closing twice releases the slot once")
+
+	second := <-dialed
+	assert.Equal(t, 1, l.InUse())
+	require.NoError(t, second.Close())
+	assert.Equal(t, 0, l.InUse())
+}
+
+func TestConnLimiter_PreemptsIdleConnection(t *testing.T) {
+	l := NewConnLimiter(1)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	dial := l.Provider(nntppool.Provider{Host: "news", Factory: pipeFactory}).Factory
+
+	idle, err := dial(context.Background())
+	require.NoError(t, err)
+
+	now = now.Add(preemptIdleAfter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	next, err := dial(ctx)
+	require.NoError(t, err, "an idle connection gives up its slot")
+	defer func() { _ = next.Close() }()
+
+	_, err = idle.Write([]byte("DATE\r\n"))
+	assert.Error(t, err, "the idle connection was closed")
+	assert.Equal(t, 1, l.InUse())
+}
+
+func TestConnLimiter_Provider(t *testing.T) {
+	var nilLimiter *ConnLimiter
+	p := nntppool.Provider{Host: "news"}
+	assert.Equal(t, p.Host, nilLimiter.Provider(p).Host)
+	assert.Nil(t, nilLimiter.Provider(p).Factory)
+	assert.Nil(t, NewConnLimiter(0))
+
+	limited := NewConnLimiter(4).Provider(p)
+	assert.NotNil(t, limited.Factory)
+	assert.Equal(t, "news", limited.Host, "the host still names the provider")
+}
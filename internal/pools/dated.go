@@ -0,0 +1,32 @@
+package pools
+
+import (
+	"context"
+	"io"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// Dated sets the Date header of every article posted through its pool with
+// date, which gets the date the caller chose, e.g. the date of the article a
+// repaired segment replaces. Some providers reject articles dated too far in
+// the past.
+type Dated struct {
+	repairnzb.NNTPPool
+	date func(time.Time) time.Time
+}
+
+// NewDated wraps p so that the articles it posts are dated by date.
+func NewDated(p repairnzb.NNTPPool, date func(time.Time) time.Time) *Dated {
+	return &Dated{NNTPPool: p, date: date}
+}
+
+// PostYenc posts the article with the Date header given by date.
+func (d *Dated) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	headers.Date = d.date(headers.Date)
+
+	return d.NNTPPool.PostYenc(ctx, headers, body, meta)
+}
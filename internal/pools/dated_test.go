@@ -0,0 +1,40 @@
+package pools
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDated_SetsDateHeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	original := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	reposted := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	pool := mocks.NewMockNNTPPool(ctrl)
+	pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, headers nntppool.PostHeaders, _ io.Reader, _ rapidyenc.Meta) (*nntppool.PostResult, error) {
+			assert.Equal(t, reposted, headers.Date)
+			assert.Equal(t, "subject", headers.Subject)
+
+			return &nntppool.PostResult{}, nil
+		})
+
+	dated := NewDated(pool, func(date time.Time) time.Time {
+		assert.Equal(t, original, date, "the date is derived from the one of the caller")
+		return reposted
+	})
+
+	_, err := dated.PostYenc(context.Background(), nntppool.PostHeaders{Subject: "subject", Date: original}, strings.NewReader("data"), rapidyenc.Meta{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,189 @@
+package pools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// errLazyClosed is returned by the calls made after Close.
+var errLazyClosed = errors.New("pool is closed")
+
+// Lazy creates its pool on first use and closes it once no call used it for
+// the idle period, so a quiet watcher holds no connections of it. The next
+// call creates the pool again.
+type Lazy struct {
+	ctx    context.Context
+	create func(context.Context) (repairnzb.NNTPPool, error)
+	idle   time.Duration
+
+	mu    sync.Mutex
+	pool  repairnzb.NNTPPool
+	inUse int
+	timer *time.Timer
+	// gen identifies the pending idle period, so a stale one closes nothing.
+	gen    int
+	closed bool
+}
+
+// Ensure Lazy implements repairnzb.NNTPPool and repairnzb.ArticleChecker
+var (
+	_ repairnzb.NNTPPool       = (*Lazy)(nil)
+	_ repairnzb.ArticleChecker = (*Lazy)(nil)
+)
+
+// NewLazy creates a Lazy pool created by create with ctx, which bounds the
+// lifetime of the pools. idle <= 0 keeps the pool open once created.
+func NewLazy(ctx context.Context, create func(context.Context) (repairnzb.NNTPPool, error), idle time.Duration) *Lazy {
+	return &Lazy{ctx: ctx, create: create, idle: idle}
+}
+
+// Open reports whether the pool is currently created.
+func (l *Lazy) Open() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.pool != nil
+}
+
+// acquire returns the pool, creating it if needed, and holds it open until
+// release.
+func (l *Lazy) acquire() (repairnzb.NNTPPool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, errLazyClosed
+	}
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.gen++
+
+	if l.pool == nil {
+		p, err := l.create(l.ctx)
+		if err != nil {
+			return nil, err
+		}
+		l.pool = p
+	}
+	l.inUse++
+
+	return l.pool, nil
+}
+
+// release ends a call and starts the idle period after the last one.
+func (l *Lazy) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inUse--
+	if l.inUse > 0 || l.closed || l.idle <= 0 {
+		return
+	}
+
+	l.gen++
+	gen := l.gen
+	l.timer = time.AfterFunc(l.idle, func() {
+		l.closeIdle(gen)
+	})
+}
+
+// closeIdle closes the pool when gen is still the pending idle period.
+func (l *Lazy) closeIdle(gen int) {
+	l.mu.Lock()
+	if l.gen != gen || l.inUse > 0 || l.pool == nil {
+		l.mu.Unlock()
+		return
+	}
+
+	p := l.pool
+	l.pool, l.timer = nil, nil
+	l.mu.Unlock()
+
+	_ = p.Close()
+}
+
+// BodyStream downloads the article through the pool.
+func (l *Lazy) BodyStream(ctx context.Context, messageID string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	p, err := l.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	return p.BodyStream(ctx, messageID, w, onMeta...)
+}
+
+// PostYenc posts the article through the pool.
+func (l *Lazy) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	p, err := l.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	return p.PostYenc(ctx, headers, body, meta)
+}
+
+// Stat checks for the article, reporting it missing when the pool cannot
+// check articles.
+func (l *Lazy) Stat(ctx context.Context, messageID string) (*nntppool.StatResult, error) {
+	p, err := l.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	c, ok := p.(repairnzb.ArticleChecker)
+	if !ok {
+		return nil, nntppool.ErrArticleNotFound
+	}
+
+	return c.Stat(ctx, messageID)
+}
+
+// Head fetches the headers of the article, reporting it missing when the pool
+// cannot check articles.
+func (l *Lazy) Head(ctx context.Context, messageID string) (*nntppool.ArticleHead, error) {
+	p, err := l.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	c, ok := p.(repairnzb.ArticleChecker)
+	if !ok {
+		return nil, nntppool.ErrArticleNotFound
+	}
+
+	return c.Head(ctx, messageID)
+}
+
+// Close closes the pool, if created, and fails every later call.
+func (l *Lazy) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.pool == nil {
+		return nil
+	}
+
+	p := l.pool
+	l.pool = nil
+
+	return p.Close()
+}
@@ -0,0 +1,60 @@
+package pools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLazy_CreatesOnUseAndClosesWhenIdle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	created := 0
+	closed := make(chan struct{}, 2)
+	lazy := NewLazy(context.Background(), func(context.Context) (repairnzb.NNTPPool, error) {
+		created++
+		pool := mocks.NewMockNNTPPool(ctrl)
+		pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&nntppool.PostResult{}, nil).AnyTimes()
+		pool.EXPECT().Close().DoAndReturn(func() error {
+			closed <- struct{}{}
+			return nil
+		})
+		return pool, nil
+	}, 50*time.Millisecond)
+
+	assert.False(t, lazy.Open(), "nothing is created before the first call")
+
+	post := func() {
+		_, err := lazy.PostYenc(context.Background(), nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+		require.NoError(t, err)
+	}
+	post()
+	post()
+	assert.Equal(t, 1, created)
+	assert.True(t, lazy.Open())
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle pool was not closed")
+	}
+	assert.False(t, lazy.Open())
+
+	post()
+	assert.Equal(t, 2, created, "the next call creates the pool again")
+
+	require.NoError(t, lazy.Close())
+	<-closed
+
+	_, err := lazy.PostYenc(context.Background(), nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+	assert.ErrorIs(t, err, errLazyClosed)
+}
@@ -0,0 +1,126 @@
+package pools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// Spread posts through several pools in turn, each receiving a share of the
+// articles proportional to its weight. It lets upload providers that post
+// differently, like with another date policy, share the uploads. Reads are
+// served by the first pool.
+type Spread struct {
+	pools   []repairnzb.NNTPPool
+	weights []int
+	total   int
+	next    atomic.Uint64
+}
+
+// Ensure Spread implements repairnzb.NNTPPool
+var _ repairnzb.NNTPPool = (*Spread)(nil)
+
+// NewSpread creates a Spread over pools, which weights pairs up by index.
+// Weights below 1 count as 1.
+func NewSpread(pools []repairnzb.NNTPPool, weights []int) *Spread {
+	s := &Spread{pools: pools, weights: make([]int, len(pools))}
+	for i := range pools {
+		w := 1
+		if i < len(weights) && weights[i] > 1 {
+			w = weights[i]
+		}
+		s.weights[i] = w
+		s.total += w
+	}
+
+	return s
+}
+
+// pick returns the pool of the next post, skipping the pools that rejected
+// the article of attempts. It returns nil when every pool did.
+func (s *Spread) pick(attempts *repairnzb.PostAttempts) repairnzb.NNTPPool {
+	for range s.total {
+		p := s.pools[0]
+		n := int(s.next.Add(1)-1) % s.total
+		for i, w := range s.weights {
+			if n < w {
+				p = s.pools[i]
+				break
+			}
+			n -= w
+		}
+
+		if attempts == nil || !attempts.Rejected(p) {
+			return p
+		}
+	}
+
+	// Concurrent posts may have advanced the turn past the remaining pools.
+	for _, p := range s.pools {
+		if !attempts.Rejected(p) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// untried reports whether a pool other than except has not rejected the
+// article of attempts.
+func (s *Spread) untried(attempts *repairnzb.PostAttempts, except repairnzb.NNTPPool) bool {
+	for _, p := range s.pools {
+		if p != except && !attempts.Rejected(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PostYenc posts the article through the next pool in turn. A pool that
+// rejected the article is recorded in the PostAttempts of ctx, if any, and
+// skipped when it is posted again.
+func (s *Spread) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	if len(s.pools) == 0 {
+		return nil, errors.New("no pools configured")
+	}
+
+	attempts := repairnzb.PostAttemptsFrom(ctx)
+	p := s.pick(attempts)
+	if p == nil {
+		return nil, errors.New("every pool rejected the article")
+	}
+
+	res, err := p.PostYenc(ctx, headers, body, meta)
+	if attempts != nil && repairnzb.IsPostRejection(err) {
+		attempts.Reject(p, s.untried(attempts, p))
+	}
+
+	return res, err
+}
+
+// BodyStream fetches the article from the first pool.
+func (s *Spread) BodyStream(ctx context.Context, messageID string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	if len(s.pools) == 0 {
+		return nil, nntppool.ErrArticleNotFound
+	}
+
+	return s.pools[0].BodyStream(ctx, messageID, w, onMeta...)
+}
+
+// Close closes every pool and returns the first error encountered.
+func (s *Spread) Close() error {
+	var firstErr error
+	for _, p := range s.pools {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
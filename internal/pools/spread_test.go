@@ -0,0 +1,60 @@
+package pools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSpread_PostsByWeight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	first := mocks.NewMockNNTPPool(ctrl)
+	first.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&nntppool.PostResult{}, nil).Times(6)
+	second := mocks.NewMockNNTPPool(ctrl)
+	second.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&nntppool.PostResult{}, nil).Times(2)
+
+	spread := NewSpread([]repairnzb.NNTPPool{first, second}, []int{3, 1})
+	for range 8 {
+		_, err := spread.PostYenc(context.Background(), nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+		require.NoError(t, err)
+	}
+
+	first.EXPECT().Close().Return(nil)
+	second.EXPECT().Close().Return(nil)
+	assert.NoError(t, spread.Close())
+}
+
+func TestSpread_SkipsPoolsThatRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	first := mocks.NewMockNNTPPool(ctrl)
+	second := mocks.NewMockNNTPPool(ctrl)
+	spread := NewSpread([]repairnzb.NNTPPool{first, second}, []int{1, 1})
+
+	attempts := &repairnzb.PostAttempts{}
+	ctx := repairnzb.WithPostAttempts(context.Background(), attempts)
+
+	first.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nntppool.ErrPostingFailed)
+	_, err := spread.PostYenc(ctx, nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+	require.ErrorIs(t, err, nntppool.ErrPostingFailed)
+	assert.True(t, attempts.Rejected(first))
+
+	// The article is posted again through the other pool only, even when it
+	// is the turn of the first one.
+	second.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nntppool.ErrPostingNotPermitted)
+	_, err = spread.PostYenc(ctx, nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+	require.ErrorIs(t, err, nntppool.ErrPostingNotPermitted)
+	assert.True(t, attempts.Rejected(second))
+
+	_, err = spread.PostYenc(ctx, nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+	assert.ErrorContains(t, err, "every pool rejected the article")
+}
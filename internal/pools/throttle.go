@@ -0,0 +1,63 @@
+package pools
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// Throttled spaces the posts through its pool evenly, so no more than a
+// number of articles are posted a minute. Providers limiting how fast they
+// are posted to reject the articles over the limit with a 441 otherwise.
+type Throttled struct {
+	repairnzb.NNTPPool
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewThrottled wraps p so that it posts at most perMinute articles a minute.
+func NewThrottled(p repairnzb.NNTPPool, perMinute int) *Throttled {
+	return &Throttled{NNTPPool: p, interval: time.Minute / time.Duration(max(perMinute, 1))}
+}
+
+// wait blocks until the next post may start or ctx is done. A post takes its
+// turn only once it starts, so one canceled while waiting delays no other.
+func (t *Throttled) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		if !now.Before(t.next) {
+			t.next = now.Add(t.interval)
+			t.mu.Unlock()
+
+			return nil
+		}
+		d := t.next.Sub(now)
+		t.mu.Unlock()
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// PostYenc posts the article once its turn comes.
+func (t *Throttled) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	if err := t.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return t.NNTPPool.PostYenc(ctx, headers, body, meta)
+}
@@ -0,0 +1,53 @@
+package pools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestThrottled_SpacesPosts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	pool := mocks.NewMockNNTPPool(ctrl)
+	pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&nntppool.PostResult{}, nil).Times(3)
+
+	// 1200 posts a minute is one every 50ms.
+	throttled := NewThrottled(pool, 1200)
+
+	start := time.Now()
+	for range 3 {
+		_, err := throttled.PostYenc(context.Background(), nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "the first post is immediate, the others wait their turn")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	throttled = NewThrottled(pool, 1)
+	_ = throttled.wait(context.Background())
+	_, err := throttled.PostYenc(ctx, nntppool.PostHeaders{}, strings.NewReader("data"), rapidyenc.Meta{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestThrottled_CanceledPostKeepsNoTurn(t *testing.T) {
+	// 1200 posts a minute is one every 50ms.
+	throttled := NewThrottled(nil, 1200)
+	require.NoError(t, throttled.wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, throttled.wait(ctx), context.DeadlineExceeded)
+
+	start := time.Now()
+	require.NoError(t, throttled.wait(context.Background()))
+	assert.Less(t, time.Since(start), 75*time.Millisecond, "the canceled post left its turn to the next one")
+}
@@ -0,0 +1,106 @@
+// Package pools composes NNTP connection pools used by the repair process.
+package pools
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// Tiered consults pools in ascending tier order. A higher tier is only asked
+// for an article once every lower tier has reported it as missing, which keeps
+// paid-per-GB block accounts from serving articles that cheaper providers have.
+type Tiered struct {
+	tiers []repairnzb.NNTPPool
+}
+
+// Ensure Tiered implements repairnzb.NNTPPool and repairnzb.ArticleChecker
+var (
+	_ repairnzb.NNTPPool       = (*Tiered)(nil)
+	_ repairnzb.ArticleChecker = (*Tiered)(nil)
+	_ repairnzb.ArticleChecker = (*nntppool.Client)(nil)
+)
+
+// NewTiered creates a Tiered pool. tiers must be ordered from lowest to highest tier.
+func NewTiered(tiers ...repairnzb.NNTPPool) *Tiered {
+	return &Tiered{tiers: tiers}
+}
+
+// BodyStream fetches the article from the first tier that has it.
+func (t *Tiered) BodyStream(ctx context.Context, messageID string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	if len(t.tiers) == 0 {
+		return nil, nntppool.ErrArticleNotFound
+	}
+
+	var lastErr error
+	for _, p := range t.tiers {
+		body, err := p.BodyStream(ctx, messageID, w, onMeta...)
+		if err == nil || !errors.Is(err, nntppool.ErrArticleNotFound) {
+			return body, err
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Stat checks for the article in ascending tier order. Tiers that cannot
+// check articles are skipped.
+func (t *Tiered) Stat(ctx context.Context, messageID string) (*nntppool.StatResult, error) {
+	return firstTier(t, func(c repairnzb.ArticleChecker) (*nntppool.StatResult, error) {
+		return c.Stat(ctx, messageID)
+	})
+}
+
+// Head fetches the headers of the article from the first tier that has it.
+// Tiers that cannot check articles are skipped.
+func (t *Tiered) Head(ctx context.Context, messageID string) (*nntppool.ArticleHead, error) {
+	return firstTier(t, func(c repairnzb.ArticleChecker) (*nntppool.ArticleHead, error) {
+		return c.Head(ctx, messageID)
+	})
+}
+
+func firstTier[T any](t *Tiered, fn func(repairnzb.ArticleChecker) (*T, error)) (*T, error) {
+	var lastErr error = nntppool.ErrArticleNotFound
+	for _, p := range t.tiers {
+		c, ok := p.(repairnzb.ArticleChecker)
+		if !ok {
+			continue
+		}
+
+		res, err := fn(c)
+		if err == nil || !errors.Is(err, nntppool.ErrArticleNotFound) {
+			return res, err
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// PostYenc posts through the lowest tier. Tiering only affects downloads.
+func (t *Tiered) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	if len(t.tiers) == 0 {
+		return nil, errors.New("no pools configured")
+	}
+
+	return t.tiers[0].PostYenc(ctx, headers, body, meta)
+}
+
+// Close closes every tier and returns the first error encountered.
+func (t *Tiered) Close() error {
+	var firstErr error
+	for _, p := range t.tiers {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,97 @@
+package pools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTiered_HigherTierOnlyAfterMiss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tier1 := mocks.NewMockNNTPPool(ctrl)
+	tier2 := mocks.NewMockNNTPPool(ctrl)
+
+	tier1.EXPECT().BodyStream(gomock.Any(), "found@test", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, _ = w.Write([]byte("tier1"))
+			return &nntppool.ArticleBody{}, nil
+		})
+	tier2.EXPECT().BodyStream(gomock.Any(), "found@test", gomock.Any()).Times(0)
+
+	tier1.EXPECT().BodyStream(gomock.Any(), "missing@test", gomock.Any()).Return(nil, nntppool.ErrArticleNotFound)
+	tier2.EXPECT().BodyStream(gomock.Any(), "missing@test", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, _ = w.Write([]byte("tier2"))
+			return &nntppool.ArticleBody{}, nil
+		})
+
+	p := NewTiered(tier1, tier2)
+
+	var buf bytes.Buffer
+	_, err := p.BodyStream(context.Background(), "found@test", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "tier1", buf.String())
+
+	buf.Reset()
+	_, err = p.BodyStream(context.Background(), "missing@test", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "tier2", buf.String())
+}
+
+func TestTiered_MissingInAllTiers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tier1 := mocks.NewMockNNTPPool(ctrl)
+	tier2 := mocks.NewMockNNTPPool(ctrl)
+
+	tier1.EXPECT().BodyStream(gomock.Any(), "gone@test", gomock.Any()).Return(nil, nntppool.ErrArticleNotFound)
+	tier2.EXPECT().BodyStream(gomock.Any(), "gone@test", gomock.Any()).Return(nil, nntppool.ErrArticleNotFound)
+
+	_, err := NewTiered(tier1, tier2).BodyStream(context.Background(), "gone@test", io.Discard)
+	assert.ErrorIs(t, err, nntppool.ErrArticleNotFound)
+}
+
+func TestTiered_OtherErrorsDoNotFallThrough(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tier1 := mocks.NewMockNNTPPool(ctrl)
+	tier2 := mocks.NewMockNNTPPool(ctrl)
+
+	boom := errors.New("connection reset")
+	tier1.EXPECT().BodyStream(gomock.Any(), "seg@test", gomock.Any()).Return(nil, boom)
+	tier2.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := NewTiered(tier1, tier2).BodyStream(context.Background(), "seg@test", io.Discard)
+	assert.ErrorIs(t, err, boom)
+}
+
+type checkingPool struct {
+	*mocks.MockNNTPPool
+	*mocks.MockArticleChecker
+}
+
+func TestTiered_StatFallsThroughOnMiss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tier1 := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	tier2 := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+	plain := mocks.NewMockNNTPPool(ctrl)
+
+	tier1.MockArticleChecker.EXPECT().Stat(gomock.Any(), "seg@test").Return(nil, nntppool.ErrArticleNotFound)
+	tier2.MockArticleChecker.EXPECT().Stat(gomock.Any(), "seg@test").Return(&nntppool.StatResult{MessageID: "seg@test"}, nil)
+
+	res, err := NewTiered(tier1, plain, tier2).Stat(context.Background(), "seg@test")
+	require.NoError(t, err)
+	assert.Equal(t, "seg@test", res.MessageID)
+
+	tier1.MockArticleChecker.EXPECT().Head(gomock.Any(), "gone@test").Return(nil, nntppool.ErrArticleNotFound)
+	tier2.MockArticleChecker.EXPECT().Head(gomock.Any(), "gone@test").Return(nil, nntppool.ErrArticleNotFound)
+
+	_, err = NewTiered(tier1, tier2).Head(context.Background(), "gone@test")
+	assert.ErrorIs(t, err, nntppool.ErrArticleNotFound)
+}
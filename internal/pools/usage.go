@@ -0,0 +1,194 @@
+package pools
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/repairnzb"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// StatsSource is implemented by *nntppool.Client.
+type StatsSource interface {
+	Stats() nntppool.ClientStats
+}
+
+// Usage holds the bytes transferred through a provider.
+type Usage struct {
+	Downloaded int64
+	Uploaded   int64
+	// CompressedRaw and CompressedWire are the uncompressed and transferred
+	// bytes of the provider's compressed connections.
+	CompressedRaw  int64
+	CompressedWire int64
+}
+
+type statsSource struct {
+	// key identifies the sources registered with SetDownloadSource.
+	key   string
+	src   StatsSource
+	names map[string]string
+}
+
+// UsageMeter turns the cumulative per-provider counters of the NNTP clients
+// into byte deltas that can be persisted periodically.
+type UsageMeter struct {
+	mu       sync.Mutex
+	sources  []statsSource
+	last     map[string]int64
+	uploaded map[string]int64
+	// replaced holds the downloads of replaced sources not collected yet.
+	replaced map[string]int64
+
+	compression     map[string]*compressionCounter
+	lastCompression map[string]Usage
+}
+
+// NewUsageMeter creates an empty UsageMeter.
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{
+		last:            make(map[string]int64),
+		uploaded:        make(map[string]int64),
+		replaced:        make(map[string]int64),
+		compression:     make(map[string]*compressionCounter),
+		lastCompression: make(map[string]Usage),
+	}
+}
+
+// AddDownloadSource registers a client whose consumed bytes count as downloads.
+// names maps the nntppool provider name to the name used for accounting;
+// providers missing from names are accounted under their nntppool name.
+func (m *UsageMeter) AddDownloadSource(src StatsSource, names map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sources = append(m.sources, statsSource{src: src, names: names})
+}
+
+// SetDownloadSource registers src like AddDownloadSource under key, replacing
+// the source registered under the same key before, e.g. a pool that was
+// closed while idle and created again. The bytes the replaced source consumed
+// since the last Collect are still reported.
+func (m *UsageMeter) SetDownloadSource(key string, src StatsSource, names map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.sources, func(s statsSource) bool { return s.key == key })
+	if i < 0 {
+		m.sources = append(m.sources, statsSource{key: key, src: src, names: names})
+		return
+	}
+
+	old := m.sources[i]
+	for _, ps := range old.src.Stats().Providers {
+		lastKey := strconv.Itoa(i) + "\x00" + ps.Name
+		if delta := ps.BytesConsumed - m.last[lastKey]; delta > 0 {
+			m.replaced[old.accountedName(ps.Name)] += delta
+		}
+		delete(m.last, lastKey)
+	}
+	m.sources[i] = statsSource{key: key, src: src, names: names}
+}
+
+// accountedName returns the name the bytes of the nntppool provider name are
+// accounted under.
+func (s statsSource) accountedName(name string) string {
+	if mapped, ok := s.names[name]; ok {
+		return mapped
+	}
+
+	return name
+}
+
+// CountUploads wraps p so that every successfully posted article is accounted
+// as uploaded bytes. The pool dispatches posts across its providers, so the
+// bytes are split between them using shares (normally their connection ratio).
+func (m *UsageMeter) CountUploads(p repairnzb.NNTPPool, shares map[string]float64) repairnzb.NNTPPool {
+	return &countingPool{NNTPPool: p, meter: m, shares: shares}
+}
+
+// Collect returns the bytes transferred per provider since the previous call.
+func (m *UsageMeter) Collect() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := make(map[string]Usage)
+	for i, s := range m.sources {
+		for _, ps := range s.src.Stats().Providers {
+			name := s.accountedName(ps.Name)
+
+			// The same provider may be reached through several sources.
+			key := strconv.Itoa(i) + "\x00" + ps.Name
+			delta := ps.BytesConsumed - m.last[key]
+			if delta < 0 {
+				// The client was recreated and its counters restarted.
+				delta = ps.BytesConsumed
+			}
+			m.last[key] = ps.BytesConsumed
+
+			if delta > 0 {
+				u := usage[name]
+				u.Downloaded += delta
+				usage[name] = u
+			}
+		}
+	}
+
+	for name, n := range m.replaced {
+		u := usage[name]
+		u.Downloaded += n
+		usage[name] = u
+	}
+	clear(m.replaced)
+
+	for name, n := range m.uploaded {
+		u := usage[name]
+		u.Uploaded += n
+		usage[name] = u
+	}
+	clear(m.uploaded)
+
+	for name, c := range m.compression {
+		raw, wire := c.raw.Load(), c.wire.Load()
+		last := m.lastCompression[name]
+		if raw == last.CompressedRaw && wire == last.CompressedWire {
+			continue
+		}
+		m.lastCompression[name] = Usage{CompressedRaw: raw, CompressedWire: wire}
+
+		u := usage[name]
+		u.CompressedRaw += raw - last.CompressedRaw
+		u.CompressedWire += wire - last.CompressedWire
+		usage[name] = u
+	}
+
+	return usage
+}
+
+func (m *UsageMeter) addUploaded(shares map[string]float64, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, share := range shares {
+		m.uploaded[name] += int64(float64(n) * share)
+	}
+}
+
+type countingPool struct {
+	repairnzb.NNTPPool
+	meter  *UsageMeter
+	shares map[string]float64
+}
+
+func (c *countingPool) PostYenc(ctx context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	res, err := c.NNTPPool.PostYenc(ctx, headers, body, meta)
+	if err == nil {
+		c.meter.addUploaded(c.shares, meta.PartSize)
+	}
+
+	return res, err
+}
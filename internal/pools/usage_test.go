@@ -0,0 +1,73 @@
+package pools
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeStats struct {
+	stats nntppool.ClientStats
+}
+
+func (f *fakeStats) Stats() nntppool.ClientStats { return f.stats }
+
+func TestUsageMeter_CollectReturnsDeltas(t *testing.T) {
+	src := &fakeStats{stats: nntppool.ClientStats{Providers: []nntppool.ProviderStats{
+		{Name: "news.example.com:563+user", BytesConsumed: 100},
+	}}}
+
+	m := NewUsageMeter()
+	m.AddDownloadSource(src, map[string]string{"news.example.com:563+user": "main"})
+
+	assert.Equal(t, map[string]Usage{"main": {Downloaded: 100}}, m.Collect())
+
+	src.stats.Providers[0].BytesConsumed = 250
+	assert.Equal(t, map[string]Usage{"main": {Downloaded: 150}}, m.Collect())
+
+	assert.Empty(t, m.Collect())
+}
+
+func TestUsageMeter_SetDownloadSourceReplaces(t *testing.T) {
+	names := map[string]string{"news.example.com:563+user": "main"}
+	first := &fakeStats{stats: nntppool.ClientStats{Providers: []nntppool.ProviderStats{
+		{Name: "news.example.com:563+user", BytesConsumed: 100},
+	}}}
+
+	m := NewUsageMeter()
+	m.SetDownloadSource("tier1", first, names)
+	assert.Equal(t, map[string]Usage{"main": {Downloaded: 100}}, m.Collect())
+
+	// The pool consumes more, is closed and created again before the next
+	// collection.
+	first.stats.Providers[0].BytesConsumed = 300
+	second := &fakeStats{stats: nntppool.ClientStats{Providers: []nntppool.ProviderStats{
+		{Name: "news.example.com:563+user", BytesConsumed: 50},
+	}}}
+	m.SetDownloadSource("tier1", second, names)
+	assert.Equal(t, map[string]Usage{"main": {Downloaded: 250}}, m.Collect())
+
+	second.stats.Providers[0].BytesConsumed = 80
+	assert.Equal(t, map[string]Usage{"main": {Downloaded: 30}}, m.Collect())
+}
+
+func TestUsageMeter_CountUploadsSplitsByShare(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	upload := mocks.NewMockNNTPPool(ctrl)
+	upload.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&nntppool.PostResult{}, nil)
+
+	m := NewUsageMeter()
+	p := m.CountUploads(upload, map[string]float64{"a": 0.75, "b": 0.25})
+
+	_, err := p.PostYenc(context.Background(), nntppool.PostHeaders{}, bytes.NewReader(nil), rapidyenc.Meta{PartSize: 400})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Usage{"a": {Uploaded: 300}, "b": {Uploaded: 100}}, m.Collect())
+}
@@ -0,0 +1,129 @@
+package pools
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+)
+
+const (
+	// warmCommand is answered by every server without touching articles.
+	warmCommand = "DATE\r\n"
+	// dateOK is the status code of a successful DATE.
+	dateOK = 111
+	// warmTimeout bounds a warm round, including connecting.
+	warmTimeout = 30 * time.Second
+)
+
+// Sender sends raw NNTP commands, as nntppool.Client does.
+type Sender interface {
+	Send(ctx context.Context, payload []byte, bodyWriter io.Writer, onMeta ...func(nntppool.YEncMeta)) <-chan nntppool.Response
+}
+
+// Ensure nntppool.Client implements Sender
+var _ Sender = (*nntppool.Client)(nil)
+
+// Warmer opens connections of pools ahead of the first job and keeps them
+// open: every round sends concurrent DATE commands, so idle pools dial their
+// connections, reset their idle timeouts and replace connections that went
+// stale.
+type Warmer struct {
+	conns int
+	log   *slog.Logger
+
+	mu    sync.Mutex
+	pools []warmPool
+}
+
+type warmPool struct {
+	name   string
+	sender Sender
+}
+
+// NewWarmer creates a Warmer keeping conns connections per pool warm. It
+// returns nil, which warms nothing, when conns <= 0.
+func NewWarmer(conns int, logger *slog.Logger) *Warmer {
+	if conns <= 0 {
+		return nil
+	}
+
+	return &Warmer{conns: conns, log: logger}
+}
+
+// Add registers the pool s, named name in logs, and warms it in the background.
+func (w *Warmer) Add(ctx context.Context, name string, s Sender) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	w.pools = append(w.pools, warmPool{name: name, sender: s})
+	w.mu.Unlock()
+
+	go func() {
+		answered := w.Warm(ctx, s)
+		w.log.InfoContext(ctx, "Warmed up connections", "pool", name, "answered", answered, "requested", w.conns)
+	}()
+}
+
+// Run warms every registered pool each interval until ctx is canceled.
+func (w *Warmer) Run(ctx context.Context, interval time.Duration) {
+	if w == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			pools := slices.Clone(w.pools)
+			w.mu.Unlock()
+
+			for _, p := range pools {
+				if answered := w.Warm(ctx, p.sender); answered < w.conns {
+					w.log.WarnContext(ctx, "Keepalive was not answered on every warm connection", "pool", p.name, "answered", answered, "requested", w.conns)
+				}
+			}
+		}
+	}
+}
+
+// Warm sends one DATE per warm connection at once and returns how many
+// were answered.
+func (w *Warmer) Warm(ctx context.Context, s Sender) int {
+	ctx, cancel := context.WithTimeout(ctx, warmTimeout)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		answered int
+	)
+	for range w.conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for resp := range s.Send(ctx, []byte(warmCommand), nil) {
+				if resp.Err == nil && resp.StatusCode == dateOK {
+					mu.Lock()
+					answered++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return answered
+}
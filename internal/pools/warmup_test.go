@@ -0,0 +1,51 @@
+package pools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSender answers DATE like a server, failing the first fail commands.
+type fakeSender struct {
+	sent atomic.Int64
+	fail int64
+}
+
+func (f *fakeSender) Send(_ context.Context, payload []byte, _ io.Writer, _ ...func(nntppool.YEncMeta)) <-chan nntppool.Response {
+	ch := make(chan nntppool.Response, 1)
+	if string(payload) != warmCommand {
+		ch <- nntppool.Response{Err: errors.New("unexpected command")}
+	} else if f.sent.Add(1) <= f.fail {
+		ch <- nntppool.Response{Err: errors.New("connection reset")}
+	} else {
+		ch <- nntppool.Response{StatusCode: dateOK}
+	}
+	close(ch)
+
+	return ch
+}
+
+func TestWarmer_Warm(t *testing.T) {
+	w := NewWarmer(4, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s := &fakeSender{fail: 1}
+
+	assert.Equal(t, 3, w.Warm(context.Background(), s))
+	assert.Equal(t, int64(4), s.sent.Load(), "one DATE per warm connection")
+}
+
+func TestWarmer_NilWarmsNothing(t *testing.T) {
+	w := NewWarmer(0, nil)
+	assert.Nil(t, w)
+
+	s := &fakeSender{}
+	w.Add(context.Background(), "download", s)
+	w.Run(context.Background(), 0)
+	assert.Zero(t, s.sent.Load())
+}
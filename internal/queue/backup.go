@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPagesPerStep is the number of pages copied per backup step. Copying
+// in steps releases the source lock in between, so a running watcher is not
+// blocked for the whole backup.
+const backupPagesPerStep = 256
+
+// Backup writes a consistent copy of the queue database to dest using the
+// SQLite online backup API. It is safe to call while a watcher is using the
+// database. An existing file at dest is overwritten.
+func (q *Queue) Backup(ctx context.Context, dest string) error {
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		_ = destDB.Close()
+	}()
+
+	if err := copyDatabase(ctx, destDB, q.db); err != nil {
+		return fmt.Errorf("failed to back up queue: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces the content of the queue database with the backup at src
+// and migrates it to the current schema. Jobs that were processing when the
+// backup was taken are reset to pending.
+func (q *Queue) Restore(ctx context.Context, src string) error {
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	srcDB, err := sql.Open("sqlite3", "file:"+src+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() {
+		_ = srcDB.Close()
+	}()
+
+	version, err := schemaVersion(srcDB)
+	if err != nil {
+		return fmt.Errorf("%s is not a queue database: %w", src, err)
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("backup schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	if err := copyDatabase(ctx, q.db, srcDB); err != nil {
+		return fmt.Errorf("failed to restore queue: %w", err)
+	}
+
+	if err := migrate(q.db); err != nil {
+		return fmt.Errorf("failed to migrate restored queue: %w", err)
+	}
+
+	// The restored claims belong to workers of the past, whatever their lease says.
+	if _, err := q.db.Exec(`UPDATE jobs SET status = ?, claimed_by = NULL, lease_expires_at = NULL, updated_at = ? WHERE status = ?`,
+		StatusPending, time.Now(), StatusProcessing); err != nil {
+		return fmt.Errorf("failed to reset processing jobs: %w", err)
+	}
+
+	return nil
+}
+
+// copyDatabase copies the main database of src into dest with the SQLite
+// backup API.
+func copyDatabase(ctx context.Context, dest, src *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = destConn.Close()
+	}()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcConn.Close()
+	}()
+
+	return destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			destSQLite, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("destination is not a sqlite3 connection")
+			}
+
+			srcSQLite, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("source is not a sqlite3 connection")
+			}
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			remaining := -1
+			for {
+				done, err := b.Step(backupPagesPerStep)
+				if err != nil {
+					_ = b.Close()
+					return err
+				}
+
+				if done {
+					return b.Finish()
+				}
+
+				if b.Remaining() != remaining {
+					remaining = b.Remaining()
+					continue
+				}
+
+				// The step made no progress because the source or the
+				// destination is busy; give the other connection a moment.
+				select {
+				case <-ctx.Done():
+					_ = b.Close()
+					return ctx.Err()
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	backupPath := filepath.Join(dir, "backup.db")
+
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NotNil(t, job)
+
+	require.NoError(t, q.Backup(context.Background(), backupPath))
+
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+
+	restored, err := NewQueue(filepath.Join(dir, "restored.db"))
+	require.NoError(t, err)
+	defer restored.Close()
+
+	require.NoError(t, restored.Restore(context.Background(), backupPath))
+
+	a, err := restored.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	assert.Equal(t, StatusPending, a.Status, "processing jobs are requeued on restore")
+
+	_, err = restored.GetJobByPath("/watch/b.nzb")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "jobs added after the backup are not restored")
+}
+
+func TestRestore_RejectsNonQueueDatabase(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "other.db")
+	require.NoError(t, os.WriteFile(src, nil, 0644))
+
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer q.Close()
+
+	err = q.Restore(context.Background(), src)
+	assert.ErrorContains(t, err, "not a queue database")
+}
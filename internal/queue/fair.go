@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// fairScheduler interleaves pending jobs of different categories with weighted
+// fair queuing, so a category flooding the queue cannot starve the others.
+// Every category has a virtual time that advances by 1/weight for each job
+// started from it; the category with the lowest virtual time goes next.
+// Priorities still win when jobs are ordered by priority: only jobs of the
+// highest pending priority compete.
+type fairScheduler struct {
+	weights map[string]float64
+	vtime   map[string]float64
+	// floor is the virtual time of the last pick. Categories that were idle
+	// start from it instead of catching up on the time they missed.
+	floor float64
+}
+
+// EnableFairScheduling makes GetNextJob interleave jobs across categories.
+// weights gives the share of a category relative to the others; categories
+// without a weight get 1.
+func (q *Queue) EnableFairScheduling(weights map[string]float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.fair = &fairScheduler{weights: weights, vtime: make(map[string]float64)}
+}
+
+func (f *fairScheduler) weight(category string) float64 {
+	if w, ok := f.weights[category]; ok && w > 0 {
+		return w
+	}
+
+	return 1
+}
+
+func (f *fairScheduler) start(category string) float64 {
+	return max(f.vtime[category], f.floor)
+}
+
+// next returns the next job matching the pending condition, or sql.ErrNoRows.
+// The jobs of the chosen category are ordered by orderBy; byPriority limits
+// the candidates to the highest pending priority.
+func (f *fairScheduler) next(tx *sql.Tx, condition string, args []any, orderBy string, byPriority bool) (*Job, error) {
+	where, whereArgs := condition, args
+	if byPriority {
+		where += ` AND priority = (SELECT MAX(priority) FROM jobs WHERE ` + condition + `)`
+		whereArgs = append(append([]any{}, args...), args...)
+	}
+
+	query := `SELECT COALESCE(category, ''), MIN(created_at) FROM jobs
+		WHERE ` + where + `
+		GROUP BY COALESCE(category, '')`
+	rows, err := tx.Query(query, whereArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending categories: %w", err)
+	}
+
+	var (
+		best        string
+		bestStart   float64
+		bestCreated string
+		found       bool
+	)
+	for rows.Next() {
+		var category, created string
+		if err := rows.Scan(&category, &created); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan pending category: %w", err)
+		}
+
+		s := f.start(category)
+		if !found || s < bestStart || (s == bestStart && created < bestCreated) {
+			best, bestStart, bestCreated, found = category, s, created, true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, fmt.Errorf("error iterating pending categories: %w", err)
+	}
+	_ = rows.Close()
+
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+
+	selectQuery := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + where + ` AND COALESCE(category, '') = ? ORDER BY ` + orderBy + ` LIMIT 1`
+	job, err := scanJob(tx.QueryRow(selectQuery, append(whereArgs, best)...))
+	if err != nil {
+		return nil, err
+	}
+
+	f.floor = bestStart
+	f.vtime[best] = bestStart + 1/f.weight(best)
+
+	return job, nil
+}
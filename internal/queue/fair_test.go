@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drainCategories(t *testing.T, q *Queue) []string {
+	t.Helper()
+
+	var order []string
+	for {
+		job, err := q.GetNextJob()
+		if err != nil {
+			break
+		}
+		order = append(order, job.Category)
+		require.NoError(t, q.UpdateJobStatus(job.ID, StatusCompleted, ""))
+	}
+
+	return order
+}
+
+func TestFairScheduling_InterleavesCategories(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	q.EnableFairScheduling(nil)
+
+	for i := range 4 {
+		require.NoError(t, q.AddJob(fmt.Sprintf("/watch/tv/%d.nzb", i), fmt.Sprintf("tv/%d.nzb", i)))
+	}
+	require.NoError(t, q.AddJob("/watch/movies/a.nzb", "movies/a.nzb"))
+	require.NoError(t, q.AddJob("/watch/anime/a.nzb", "anime/a.nzb"))
+
+	assert.Equal(t, []string{"tv", "movies", "anime", "tv", "tv", "tv"}, drainCategories(t, q))
+}
+
+func TestFairScheduling_Weights(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	q.EnableFairScheduling(map[string]float64{"tv": 2})
+
+	for i := range 4 {
+		require.NoError(t, q.AddJob(fmt.Sprintf("/watch/tv/%d.nzb", i), fmt.Sprintf("tv/%d.nzb", i)))
+		require.NoError(t, q.AddJob(fmt.Sprintf("/watch/movies/%d.nzb", i), fmt.Sprintf("movies/%d.nzb", i)))
+	}
+
+	assert.Equal(t, []string{"tv", "movies", "tv", "movies", "tv", "tv", "movies", "movies"}, drainCategories(t, q))
+}
+
+func TestFairScheduling_PriorityWins(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	q.EnableFairScheduling(nil)
+
+	require.NoError(t, q.AddJob("/watch/tv/a.nzb", "tv/a.nzb"))
+	require.NoError(t, q.AddJobWithOptions("/watch/tv/b.nzb", "tv/b.nzb", AddOptions{Priority: 5}))
+	require.NoError(t, q.AddJob("/watch/movies/a.nzb", "movies/a.nzb"))
+
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/tv/b.nzb", job.FilePath)
+}
+
+func TestCategoryLimits(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	q.SetCategoryLimits(map[string]int{"remux": 1})
+
+	require.NoError(t, q.AddJob("/watch/remux/a.nzb", "remux/a.nzb"))
+	require.NoError(t, q.AddJob("/watch/remux/b.nzb", "remux/b.nzb"))
+	require.NoError(t, q.AddJob("/watch/tv/a.nzb", "tv/a.nzb"))
+
+	first, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "remux", first.Category)
+
+	// remux is at its limit while the first job is processing
+	second, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "tv", second.Category)
+
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, q.UpdateJobStatus(first.ID, StatusCompleted, ""))
+	third, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/remux/b.nzb", third.FilePath)
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultLeaseDuration is how long a job claim stays valid without a heartbeat.
+const DefaultLeaseDuration = time.Minute
+
+// leaseExpiredCondition matches claims that ran out or were made before leases
+// existed. It takes the current UTC time as argument.
+const leaseExpiredCondition = `(lease_expires_at IS NULL OR lease_expires_at < ?)`
+
+// SetLeaseDuration changes how long claims made by GetNextJob and renewed by
+// RenewLeases stay valid. Claims should be renewed well within this duration.
+func (q *Queue) SetLeaseDuration(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if d > 0 {
+		q.lease = d
+	}
+}
+
+// RenewLeases extends the lease of every processing job claimed by this queue
+// and returns the number of renewed claims.
+func (q *Queue) RenewLeases() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec(`UPDATE jobs SET lease_expires_at = ? WHERE status = ? AND claimed_by = ?`,
+		time.Now().Add(q.lease).UTC(), StatusProcessing, q.owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to renew job leases: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ReclaimExpiredJobs puts processing jobs whose lease expired, because the
+// worker holding them crashed or lost the database, back to pending so any
+// reachable worker can pick them up. Returns the number of reclaimed jobs.
+func (q *Queue) ReclaimExpiredJobs() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	result, err := q.db.Exec(`UPDATE jobs SET status = ?, claimed_by = NULL, lease_expires_at = NULL, updated_at = ? WHERE status = ? AND `+leaseExpiredCondition,
+		StatusPending, now, StatusProcessing, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to reclaim expired jobs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// defaultOwner identifies the claims of a queue without a registered node.
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLeaseQueue(t *testing.T, dbPath string) *Queue {
+	t.Helper()
+
+	q, err := NewQueue(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+
+	return q
+}
+
+func TestLeases_ReclaimExpiredJobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+	crashed := newLeaseQueue(t, dbPath)
+	crashed.owner = "crashed"
+	crashed.SetLeaseDuration(time.Millisecond)
+	other := newLeaseQueue(t, dbPath)
+	other.owner = "other"
+
+	require.NoError(t, crashed.AddJob("/watch/a.nzb", "a.nzb"))
+	_, err := crashed.GetNextJob()
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	reclaimed, err := other.ReclaimExpiredJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), reclaimed)
+
+	job, err := other.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/a.nzb", job.FilePath)
+}
+
+func TestLeases_RenewedJobsAreNotReclaimed(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+	worker := newLeaseQueue(t, dbPath)
+	worker.owner = "worker"
+	other := newLeaseQueue(t, dbPath)
+	other.owner = "other"
+
+	require.NoError(t, worker.AddJob("/watch/a.nzb", "a.nzb"))
+	_, err := worker.GetNextJob()
+	require.NoError(t, err)
+
+	renewed, err := worker.RenewLeases()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), renewed)
+
+	reclaimed, err := other.ReclaimExpiredJobs()
+	require.NoError(t, err)
+	assert.Zero(t, reclaimed)
+
+	cleaned, err := other.CleanupProcessingJobs()
+	require.NoError(t, err)
+	assert.Zero(t, cleaned, "a live claim of another worker survives startup cleanup")
+
+	cleaned, err = worker.CleanupProcessingJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cleaned, "a restarted owner releases its own claims")
+}
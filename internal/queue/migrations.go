@@ -0,0 +1,292 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration upgrades the schema by one version. Migrations run in order,
+// each in its own transaction together with the schema_version update, so a
+// failing migration leaves the database at the previous version.
+type migration struct {
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations must only ever be appended to. Databases created before schema
+// versioning existed may already contain some of the columns, so column
+// additions go through addColumn which checks the current table layout.
+var migrations = []migration{
+	{
+		description: "create jobs table",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS jobs (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					filepath TEXT NOT NULL UNIQUE,
+					relative_path TEXT NOT NULL DEFAULT '',
+					status TEXT NOT NULL DEFAULT 'pending',
+					error_msg TEXT,
+					retry_count INTEGER NOT NULL DEFAULT 0,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs (status, created_at)`,
+			)
+		},
+	},
+	{
+		description: "add retry_count and relative_path to jobs",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "jobs", "retry_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			return addColumn(tx, "jobs", "relative_path", "TEXT NOT NULL DEFAULT ''")
+		},
+	},
+	{
+		description: "create provider_usage table",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS provider_usage (
+					provider TEXT NOT NULL,
+					month TEXT NOT NULL,
+					downloaded_bytes INTEGER NOT NULL DEFAULT 0,
+					uploaded_bytes INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (provider, month)
+				)`,
+			)
+		},
+	},
+	{
+		description: "add priority to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "priority", "INTEGER NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		description: "add next_attempt_at to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "next_attempt_at", "TIMESTAMP")
+		},
+	},
+	{
+		description: "add content_hash, output_path and category to jobs",
+		up: func(tx *sql.Tx) error {
+			for _, column := range []string{"content_hash", "output_path", "category"} {
+				if err := addColumn(tx, "jobs", column, "TEXT"); err != nil {
+					return err
+				}
+			}
+
+			return execAll(tx,
+				// Backfill the category of jobs queued before the column existed
+				`UPDATE jobs SET category = CASE WHEN instr(relative_path, '/') > 0 THEN substr(relative_path, 1, instr(relative_path, '/') - 1) ELSE '' END WHERE category IS NULL`,
+				`CREATE INDEX IF NOT EXISTS idx_jobs_content_hash ON jobs (content_hash)`,
+			)
+		},
+	},
+	{
+		description: "add nodes table and node, claimed_by to jobs",
+		up: func(tx *sql.Tx) error {
+			for _, column := range []string{"node", "claimed_by"} {
+				if err := addColumn(tx, "jobs", column, "TEXT"); err != nil {
+					return err
+				}
+			}
+
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS nodes (
+					name TEXT PRIMARY KEY,
+					shared_storage INTEGER NOT NULL DEFAULT 0,
+					started_at TIMESTAMP NOT NULL,
+					last_seen_at TIMESTAMP NOT NULL
+				)`)
+		},
+	},
+	{
+		description: "add lease_expires_at to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "lease_expires_at", "TIMESTAMP")
+		},
+	},
+	{
+		description: "add compressed byte counts to provider_usage",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "provider_usage", "compressed_raw_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+
+			return addColumn(tx, "provider_usage", "compressed_wire_bytes", "INTEGER NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		description: "add verdict and approved to jobs",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "jobs", "verdict", "TEXT"); err != nil {
+				return err
+			}
+
+			return addColumn(tx, "jobs", "approved", "INTEGER NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		description: "add progress to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "progress", "TEXT")
+		},
+	},
+	{
+		description: "add size_bytes to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "size_bytes", "INTEGER")
+		},
+	},
+	{
+		description: "add started_at and finished_at to jobs",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "jobs", "started_at", "TIMESTAMP"); err != nil {
+				return err
+			}
+
+			return addColumn(tx, "jobs", "finished_at", "TIMESTAMP")
+		},
+	},
+	{
+		description: "add note to jobs",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "jobs", "note", "TEXT")
+		},
+	},
+	{
+		description: "add job stats views and indexes",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE VIEW IF NOT EXISTS job_status_counts AS
+					SELECT status, COUNT(*) AS jobs FROM jobs GROUP BY status`,
+				`CREATE VIEW IF NOT EXISTS job_failures_per_day AS
+					SELECT date(updated_at) AS day, COUNT(*) AS failures FROM jobs
+					WHERE status IN ('failed', 'moved') GROUP BY date(updated_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_jobs_status_updated_at ON jobs (status, updated_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_jobs_status_finished_at ON jobs (status, finished_at)`,
+			)
+		},
+	},
+}
+
+// migrate brings the schema of db up to the latest version.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := runMigration(db, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+func runMigration(db *sql.DB, version int, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", version, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := m.up(tx); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", version, m.description, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+		return fmt.Errorf("failed to update schema version: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+		return fmt.Errorf("failed to update schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", version, err)
+	}
+
+	return nil
+}
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumn adds column to table unless it already exists.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate_UpgradesLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	// Layout written by releases before schema versioning
+	legacy, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`CREATE TABLE jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		filepath TEXT NOT NULL UNIQUE,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error_msg TEXT,
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`INSERT INTO jobs (filepath, status) VALUES ('/watch/old.nzb', 'pending')`)
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	q, err := NewQueue(dbPath)
+	require.NoError(t, err)
+
+	version, err := schemaVersion(q.db)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/old.nzb", job.FilePath)
+	assert.Equal(t, "", job.RelativePath)
+	require.NoError(t, q.Close())
+
+	// Reopening is a no-op
+	q, err = NewQueue(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+}
+
+func TestMigrate_RejectsNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := NewQueue(dbPath)
+	require.NoError(t, err)
+	_, err = q.db.Exec(`UPDATE schema_version SET version = ?`, len(migrations)+1)
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	_, err = NewQueue(dbPath)
+	assert.ErrorContains(t, err, "newer than supported")
+}
+
+func TestMigrate_FailedMigrationRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+
+	migrations = append(append([]migration{}, saved...), migration{
+		description: "broken",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `CREATE TABLE half_done (id INTEGER)`, `NOT SQL`)
+		},
+	})
+
+	assert.ErrorContains(t, migrate(db), "broken")
+
+	version, err := schemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, len(saved), version)
+
+	var tables int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&tables))
+	assert.Zero(t, tables)
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// Node is an nzb-repair instance working on a shared queue database.
+type Node struct {
+	Name string
+	// SharedStorage means the watch directory of the node is mounted at the
+	// same path on every node, so any node may process its jobs.
+	SharedStorage bool
+	StartedAt     time.Time
+	LastSeenAt    time.Time
+}
+
+// RegisterNode identifies this queue as the node name on a database shared by
+// several instances. Jobs added afterwards belong to the node, and only jobs
+// the node can reach are claimed: its own, jobs of nodes with shared storage
+// and jobs added before nodes were used. Without a registered node the queue
+// claims every job.
+func (q *Queue) RegisterNode(name string, sharedStorage bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now().UTC()
+	_, err := q.db.Exec(`
+		INSERT INTO nodes (name, shared_storage, started_at, last_seen_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET shared_storage = excluded.shared_storage, started_at = excluded.started_at, last_seen_at = excluded.last_seen_at`,
+		name, sharedStorage, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to register node %q: %w", name, err)
+	}
+
+	q.node = name
+	q.owner = name
+
+	return nil
+}
+
+// TouchNode records that the registered node is still alive.
+func (q *Queue) TouchNode() error {
+	if q.node == "" {
+		return nil
+	}
+
+	if _, err := q.db.Exec(`UPDATE nodes SET last_seen_at = ? WHERE name = ?`, time.Now().UTC(), q.node); err != nil {
+		return fmt.Errorf("failed to update node %q: %w", q.node, err)
+	}
+
+	return nil
+}
+
+// ListNodes returns the registered nodes ordered by name.
+func (q *Queue) ListNodes() ([]Node, error) {
+	rows, err := q.db.Query(`SELECT name, shared_storage, started_at, last_seen_at FROM nodes ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var nodes []Node
+	for rows.Next() {
+		var n Node
+		if err := rows.Scan(&n.Name, &n.SharedStorage, &n.StartedAt, &n.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan node row: %w", err)
+		}
+		nodes = append(nodes, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating nodes: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// reachableCondition restricts a job query to the jobs the registered node
+// can reach. It is empty when no node is registered.
+func (q *Queue) reachableCondition() (string, []any) {
+	if q.node == "" {
+		return "", nil
+	}
+
+	return ` AND (COALESCE(node, '') = '' OR node = ? OR node IN (SELECT name FROM nodes WHERE shared_storage = 1))`, []any{q.node}
+}
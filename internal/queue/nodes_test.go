@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNodeQueue(t *testing.T, dbPath, name string, shared bool) *Queue {
+	t.Helper()
+
+	q, err := NewQueue(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+
+	require.NoError(t, q.RegisterNode(name, shared))
+
+	return q
+}
+
+func TestNodes_OnlyClaimReachableJobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+	a := newNodeQueue(t, dbPath, "a", false)
+	b := newNodeQueue(t, dbPath, "b", false)
+
+	require.NoError(t, a.AddJob("/a/watch/local.nzb", "local.nzb"))
+
+	_, err := b.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "jobs of a node without shared storage stay on that node")
+
+	require.NoError(t, a.RegisterNode("a", true))
+	job, err := b.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/a/watch/local.nzb", job.FilePath)
+
+	nodes, err := a.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "a", nodes[0].Name)
+	assert.True(t, nodes[0].SharedStorage)
+}
+
+func TestNodes_CleanupOnlyResetsOwnJobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+	a := newNodeQueue(t, dbPath, "a", true)
+	b := newNodeQueue(t, dbPath, "b", true)
+
+	require.NoError(t, a.AddJob("/shared/one.nzb", "one.nzb"))
+	require.NoError(t, a.AddJob("/shared/two.nzb", "two.nzb"))
+
+	_, err := a.GetNextJob()
+	require.NoError(t, err)
+	_, err = b.GetNextJob()
+	require.NoError(t, err)
+
+	reset, err := b.CleanupProcessingJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), reset)
+
+	counts, err := a.CountByStatus()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts[StatusProcessing])
+	assert.Equal(t, int64(1), counts[StatusPending])
+}
@@ -0,0 +1,75 @@
+package queue
+
+import "fmt"
+
+// Orders in which GetNextJob picks pending jobs.
+const (
+	// OrderPriority picks the job with the highest priority, the oldest among
+	// equal priorities.
+	OrderPriority = "priority"
+	// OrderFIFO picks the oldest job, ignoring priorities.
+	OrderFIFO = "fifo"
+	// OrderSmallestFirst picks the job with the smallest NZB, ignoring
+	// priorities, so many small repairs finish before a large one occupies a
+	// worker. Jobs queued without a size go last.
+	OrderSmallestFirst = "smallest-first"
+)
+
+// SetOrder sets the order in which GetNextJob picks pending jobs, one of
+// OrderPriority (the default), OrderFIFO and OrderSmallestFirst. With fair
+// scheduling it orders the jobs within a category.
+func (q *Queue) SetOrder(order string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.order = order
+}
+
+// orderBy returns the ORDER BY terms of the configured order.
+func (q *Queue) orderBy() string {
+	switch q.order {
+	case OrderFIFO:
+		return `created_at ASC, id ASC`
+	case OrderSmallestFirst:
+		return `size_bytes IS NULL, size_bytes ASC, created_at ASC`
+	}
+
+	return `priority DESC, created_at ASC`
+}
+
+// byPriority reports whether the configured order picks by priority.
+func (q *Queue) byPriority() bool {
+	return q.order != OrderFIFO && q.order != OrderSmallestFirst
+}
+
+// ListPendingJobs returns the pending jobs, including deferred ones, in the
+// order set with SetOrder. Fair scheduling and category limits are not
+// applied.
+func (q *Queue) ListPendingJobs() ([]*Job, error) {
+	q.mu.Lock()
+	orderBy := q.orderBy()
+	q.mu.Unlock()
+
+	rows, err := q.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE status = ? ORDER BY `+orderBy, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending jobs: %w", err)
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drainPaths(t *testing.T, q *Queue) []string {
+	t.Helper()
+
+	var paths []string
+	for {
+		job, err := q.GetNextJob()
+		if err != nil {
+			break
+		}
+		paths = append(paths, job.FilePath)
+		require.NoError(t, q.UpdateJobStatus(job.ID, StatusCompleted, ""))
+	}
+
+	return paths
+}
+
+func addOrderJobs(t *testing.T, q *Queue) {
+	t.Helper()
+
+	require.NoError(t, q.AddJobWithOptions("/watch/tv/huge.nzb", "tv/huge.nzb", AddOptions{SizeBytes: 50 << 30}))
+	require.NoError(t, q.AddJobWithOptions("/watch/tv/unknown.nzb", "tv/unknown.nzb", AddOptions{}))
+	require.NoError(t, q.AddJobWithOptions("/watch/movies/urgent.nzb", "movies/urgent.nzb", AddOptions{SizeBytes: 8 << 30, Priority: 5}))
+	require.NoError(t, q.AddJobWithOptions("/watch/tv/small.nzb", "tv/small.nzb", AddOptions{SizeBytes: 1 << 20}))
+}
+
+func TestSetOrder(t *testing.T) {
+	for _, tc := range []struct {
+		order string
+		want  []string
+	}{
+		{OrderPriority, []string{"/watch/movies/urgent.nzb", "/watch/tv/huge.nzb", "/watch/tv/unknown.nzb", "/watch/tv/small.nzb"}},
+		{OrderFIFO, []string{"/watch/tv/huge.nzb", "/watch/tv/unknown.nzb", "/watch/movies/urgent.nzb", "/watch/tv/small.nzb"}},
+		{OrderSmallestFirst, []string{"/watch/tv/small.nzb", "/watch/movies/urgent.nzb", "/watch/tv/huge.nzb", "/watch/tv/unknown.nzb"}},
+	} {
+		t.Run(tc.order, func(t *testing.T) {
+			q, err := NewQueue(":memory:")
+			require.NoError(t, err)
+			q.SetOrder(tc.order)
+
+			addOrderJobs(t, q)
+
+			assert.Equal(t, tc.want, drainPaths(t, q))
+		})
+	}
+}
+
+func TestSetOrder_FairScheduling(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	q.SetOrder(OrderSmallestFirst)
+	q.EnableFairScheduling(nil)
+
+	addOrderJobs(t, q)
+
+	// Categories still alternate, the smallest job of each comes first and
+	// the priority of movies/urgent.nzb does not hold tv back.
+	assert.Equal(t, []string{"/watch/tv/small.nzb", "/watch/movies/urgent.nzb", "/watch/tv/huge.nzb", "/watch/tv/unknown.nzb"}, drainPaths(t, q))
+}
+
+func TestAddJob_RecordsSize(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJobWithOptions("/watch/a.nzb", "a.nzb", AddOptions{SizeBytes: 1234}))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+
+	a, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), a.SizeBytes)
+
+	b, err := q.GetJobByPath("/watch/b.nzb")
+	require.NoError(t, err)
+	assert.Zero(t, b.SizeBytes)
+}
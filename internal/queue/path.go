@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	appDirName = "nzb-repair"
+	dbFileName = "queue.db"
+)
+
+// DefaultPath returns the default location of the queue database in the user
+// data directory: $XDG_DATA_HOME (or ~/.local/share) on Linux, ~/Library/Application
+// Support on macOS and %APPDATA% on Windows. It falls back to queue.db in the
+// working directory when no data directory can be determined.
+func DefaultPath() string {
+	dir := userDataDir()
+	if dir == "" {
+		return dbFileName
+	}
+
+	return filepath.Join(dir, appDirName, dbFileName)
+}
+
+func userDataDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return os.Getenv("APPDATA")
+	case "darwin":
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, "Library", "Application Support")
+		}
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+			return dir
+		}
+
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "share")
+		}
+	}
+
+	return ""
+}
+
+// isFileDatabase reports whether dbPath refers to a database file on disk,
+// as opposed to an in-memory database or a DSN.
+func isFileDatabase(dbPath string) bool {
+	return dbPath != "" && dbPath != ":memory:" && !strings.HasPrefix(dbPath, "file:")
+}
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultPath_UsesXDGDataHome(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG_DATA_HOME is only used on Unix-like systems")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+
+	assert.Equal(t, filepath.Join(dir, "nzb-repair", "queue.db"), DefaultPath())
+}
+
+func TestNewQueue_CreatesDatabaseDirectory(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data", "nzb-repair", "queue.db")
+
+	q, err := NewQueue(dbPath)
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = os.Stat(dbPath)
+	assert.NoError(t, err)
+}
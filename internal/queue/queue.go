@@ -2,11 +2,13 @@ package queue
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,23 @@ const (
 	StatusCompleted  JobStatus = "completed"
 	StatusFailed     JobStatus = "failed"
 	StatusMoved      JobStatus = "moved"
+	StatusSkipped    JobStatus = "skipped"
+	// StatusHeld jobs stay in the queue without being processed until released.
+	StatusHeld JobStatus = "held"
+	// StatusTooLarge jobs exceed the configured maximum NZB size.
+	StatusTooLarge JobStatus = "too_large"
+	// StatusAwaitingApproval jobs were triaged by a watcher in triage mode and
+	// are only repaired once approved.
+	StatusAwaitingApproval JobStatus = "awaiting_approval"
+	// StatusHealthy jobs had no missing segments, so nothing was repaired.
+	StatusHealthy JobStatus = "healthy"
+	// StatusMissingSource jobs lost their NZB, deleted or moved out of the
+	// watch directory, before they were processed. They are queued again if
+	// the file comes back.
+	StatusMissingSource JobStatus = "missing_source"
+	// StatusReported jobs were damaged but not repaired because their route
+	// disables uploads. Their verdict tells whether they are repairable.
+	StatusReported JobStatus = "reported"
 )
 
 // ErrDuplicateJob can be used by mock implementations.
@@ -29,6 +48,20 @@ const (
 // and doesn't currently return a specific exported error type for this.
 var ErrDuplicateJob = errors.New("job already exists or is being processed")
 
+// ErrNotAwaitingApproval is returned by ApproveJob for jobs that are not
+// awaiting approval.
+var ErrNotAwaitingApproval = errors.New("job is not awaiting approval")
+
+// ErrJobNotFound is returned for job IDs that do not exist.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobProcessing is returned by OverrideJobStatus and DeleteJob for jobs a
+// worker is processing.
+var ErrJobProcessing = errors.New("job is being processed")
+
+// ErrJobNotFailed is returned by RetryJob for jobs that have not failed.
+var ErrJobNotFailed = errors.New("job has not failed")
+
 type Job struct {
 	ID           int64
 	FilePath     string
@@ -36,8 +69,42 @@ type Job struct {
 	Status       JobStatus
 	ErrorMsg     sql.NullString
 	RetryCount   int64
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// Priority orders pending jobs with OrderPriority; higher values are
+	// picked first.
+	Priority int
+	// ContentHash is the SHA-256 of the NZB file, used to detect NZBs that
+	// were already repaired under another name.
+	ContentHash string
+	// OutputPath is where the repaired NZB was written.
+	OutputPath string
+	// Category is the top-level folder of the job in the watch directory.
+	Category string
+	// Verdict is the repairability verdict recorded when the job was triaged.
+	Verdict string
+	// Approved jobs are repaired without being triaged again.
+	Approved bool
+	// SizeBytes is the total size of the NZB, 0 when it was not recorded.
+	SizeBytes int64
+	// StartedAt is when the job was last claimed for processing, zero when
+	// it never was.
+	StartedAt time.Time
+	// Note is free text attached by an operator.
+	Note string
+	// Progress is the last progress reported by the repair of a processing
+	// job, nil when there is none.
+	Progress  *JobProgress
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// JobProgress is the progress of the current phase of a job's repair.
+type JobProgress struct {
+	Phase string `json:"phase"`
+	Unit  string `json:"unit"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+	// Rate is Done per second since the phase started.
+	Rate float64 `json:"rate"`
 }
 
 // Queuer defines the interface for adding jobs, primarily used for dependency injection.
@@ -51,82 +118,169 @@ type Queuer interface {
 // Ensure Queue implements Queuer
 var _ Queuer = (*Queue)(nil)
 
+// jobColumns are the columns scanned by scanJob.
+const jobColumns = `id, filepath, relative_path, status, error_msg, retry_count, priority, COALESCE(content_hash, ''), COALESCE(output_path, ''), COALESCE(category, ''), COALESCE(verdict, ''), approved, COALESCE(progress, ''), COALESCE(size_bytes, 0), started_at, COALESCE(note, ''), created_at, updated_at`
+
+// scanJob scans a row selected with jobColumns.
+func scanJob(row interface{ Scan(dest ...any) error }) (*Job, error) {
+	job := &Job{}
+	var progress string
+	var startedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.FilePath, &job.RelativePath, &job.Status, &job.ErrorMsg, &job.RetryCount, &job.Priority, &job.ContentHash, &job.OutputPath, &job.Category, &job.Verdict, &job.Approved, &progress, &job.SizeBytes, &startedAt, &job.Note, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.StartedAt = startedAt.Time
+
+	// Progress left by a job that is no longer processing, e.g. after a
+	// crash, is stale.
+	if progress != "" && job.Status == StatusProcessing {
+		job.Progress = &JobProgress{}
+		if err := json.Unmarshal([]byte(progress), job.Progress); err != nil {
+			job.Progress = nil
+		}
+	}
+
+	return job, nil
+}
+
+// pendingCondition matches pending jobs that are not deferred. It takes the
+// pending status and the current UTC time as arguments.
+const pendingCondition = `status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)`
+
 type Queue struct {
-	db *sql.DB
-	mu sync.Mutex
+	db   *sql.DB
+	mu   sync.Mutex
+	fair *fairScheduler
+	// categoryLimits caps the processing jobs per category.
+	categoryLimits map[string]int
+	// order is the order of GetNextJob, see SetOrder.
+	order string
+	// node is the name registered with RegisterNode.
+	node string
+	// owner identifies the claims of this queue: the node name, or the host
+	// and process when no node is registered.
+	owner string
+	// lease is how long a claim stays valid without being renewed.
+	lease time.Duration
+	// maxRetries is the retry count from which pending jobs are no longer
+	// picked, see SetMaxRetries.
+	maxRetries int64
 }
 
-// NewQueue initializes the SQLite database and creates/updates the jobs table.
+// NewQueue opens the SQLite database and migrates its schema to the latest version.
 func NewQueue(dbPath string) (*Queue, error) {
+	if isFileDatabase(dbPath) {
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Create the jobs table if it doesn't exist
-	query := `
-	CREATE TABLE IF NOT EXISTS jobs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		filepath TEXT NOT NULL UNIQUE,
-		relative_path TEXT NOT NULL DEFAULT '',
-		status TEXT NOT NULL DEFAULT 'pending',
-		error_msg TEXT,
-		retry_count INTEGER NOT NULL DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-	_, err = db.Exec(query)
-	if err != nil {
-		// Close DB if table creation fails
+	if err := migrate(db); err != nil {
+		// Close DB if the schema can't be brought up to date
 		_ = db.Close()
-		return nil, fmt.Errorf("failed to create jobs table: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	// Attempt to add the retry_count column if it doesn't exist (migration for older dbs)
-	alterQuery := `ALTER TABLE jobs ADD COLUMN retry_count INTEGER NOT NULL DEFAULT 0`
-	_, err = db.Exec(alterQuery)
-	if err != nil {
-		// Ignore error if the column already exists
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			// Log other alteration errors but don't fail initialization
-			slog.Warn("failed to add retry_count column (might already exist)", "error", err)
-		}
+	return &Queue{db: db, mu: sync.Mutex{}, owner: defaultOwner(), lease: DefaultLeaseDuration}, nil
+}
+
+// Named job priorities accepted by ParsePriority.
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// ParsePriority parses a named priority (low, normal, high) or an integer.
+func ParsePriority(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
 	}
 
-	// Attempt to add the relative_path column if it doesn't exist (migration for older dbs)
-	// This avoids errors if the table already exists without the column.
-	alterQuery = `ALTER TABLE jobs ADD COLUMN relative_path TEXT NOT NULL DEFAULT ''`
-	_, err = db.Exec(alterQuery)
+	p, err := strconv.Atoi(s)
 	if err != nil {
-		// Ignore error if the column already exists
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			// Log other alteration errors but don't fail initialization
-			slog.Warn("failed to add relative_path column (might already exist)", "error", err)
-		}
+		return 0, fmt.Errorf("invalid priority %q, expected low, normal, high or a number", s)
 	}
 
-	// Add indexes
-	indexQueries := []string{
-		`CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs (status, created_at);`,
-		// No need to index relative_path unless we plan to query by it frequently
-		// `CREATE INDEX IF NOT EXISTS idx_jobs_relative_path ON jobs (relative_path);`,
-	}
-	for _, iq := range indexQueries {
-		_, err = db.Exec(iq)
-		if err != nil {
-			// Log index creation errors but don't fail initialization
-			slog.Warn("failed to create index", "query", iq, "error", err)
-		}
+	return p, nil
+}
+
+// AddOptions customizes a job added with AddJobWithOptions.
+type AddOptions struct {
+	// Status of the new job. Defaults to StatusPending.
+	Status JobStatus
+	// Reason is stored as the job's error message, e.g. why it is held.
+	Reason   string
+	Priority int
+	// NotBefore delays processing of a pending job until the given time.
+	NotBefore time.Time
+	// RetryCount raises the retry count of the job, e.g. to MaxRetries so a job
+	// failed on admission is moved to the broken folder right away.
+	RetryCount int64
+	// ContentHash is the SHA-256 of the NZB file.
+	ContentHash string
+	// OutputPath points to an existing repaired NZB, for jobs added as completed.
+	OutputPath string
+	// Category defaults to the top-level folder of the relative path.
+	Category string
+	// SizeBytes is the total size of the NZB, for OrderSmallestFirst. 0
+	// leaves it unknown.
+	SizeBytes int64
+}
+
+// CategoryOf returns the top-level folder of a path relative to the watch
+// directory, or "" for files directly in it.
+func CategoryOf(relativePath string) string {
+	if dir, _, found := strings.Cut(filepath.ToSlash(relativePath), "/"); found {
+		return dir
 	}
 
-	return &Queue{db: db, mu: sync.Mutex{}}, nil
+	return ""
 }
 
 // AddJob adds a new NZB file path (absolute and relative) to the queue with pending status.
 // It ignores duplicates based on the absolute filepath unless the existing job is failed,
 // in which case it resets the status to pending and updates the relative path.
 func (q *Queue) AddJob(filePath string, relativePath string) error {
+	return q.AddJobWithOptions(filePath, relativePath, AddOptions{})
+}
+
+// AddJobWithOptions behaves like AddJob but sets the status, reason and priority
+// of the inserted or reset job from opts.
+func (q *Queue) AddJobWithOptions(filePath string, relativePath string, opts AddOptions) error {
+	if opts.Status == "" {
+		opts.Status = StatusPending
+	}
+
+	if opts.Category == "" {
+		opts.Category = CategoryOf(relativePath)
+	}
+
+	var reason sql.NullString
+	if opts.Reason != "" {
+		reason = sql.NullString{String: opts.Reason, Valid: true}
+	}
+
+	contentHash := sql.NullString{String: opts.ContentHash, Valid: opts.ContentHash != ""}
+	outputPath := sql.NullString{String: opts.OutputPath, Valid: opts.OutputPath != ""}
+	sizeBytes := sql.NullInt64{Int64: opts.SizeBytes, Valid: opts.SizeBytes > 0}
+
+	var notBefore sql.NullTime
+	if !opts.NotBefore.IsZero() {
+		notBefore = sql.NullTime{Time: opts.NotBefore.UTC(), Valid: true}
+	}
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -148,9 +302,9 @@ func (q *Queue) AddJob(filePath string, relativePath string) error {
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			// Job doesn't exist, insert as pending with relative path
-			insertQuery := `INSERT INTO jobs (filepath, relative_path, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
-			_, err = tx.Exec(insertQuery, filePath, relativePath, StatusPending, now, now)
+			// Job doesn't exist, insert with relative path
+			insertQuery := `INSERT INTO jobs (filepath, relative_path, category, node, status, error_msg, priority, next_attempt_at, retry_count, content_hash, output_path, size_bytes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			_, err = tx.Exec(insertQuery, filePath, relativePath, opts.Category, sql.NullString{String: q.node, Valid: q.node != ""}, opts.Status, reason, opts.Priority, notBefore, opts.RetryCount, contentHash, outputPath, sizeBytes, now, now)
 			if err != nil {
 				return fmt.Errorf("failed to insert new job: %w", err)
 			}
@@ -160,14 +314,14 @@ func (q *Queue) AddJob(filePath string, relativePath string) error {
 		}
 	} else {
 		// Job exists
-		if currentStatus == StatusFailed {
-			// Job failed or completed, reset to pending and update relative path just in case
-			updateQuery := `UPDATE jobs SET status = ?, error_msg = NULL, updated_at = ?, relative_path = ? WHERE filepath = ?`
-			_, err = tx.Exec(updateQuery, StatusPending, now, relativePath, filePath)
+		if currentStatus == StatusFailed || currentStatus == StatusMissingSource {
+			// Job failed or its file came back, reset it and update relative path just in case
+			updateQuery := `UPDATE jobs SET status = ?, error_msg = ?, priority = ?, next_attempt_at = ?, retry_count = MAX(retry_count, ?), content_hash = COALESCE(?, content_hash), output_path = ?, size_bytes = COALESCE(?, size_bytes), category = ?, updated_at = ?, relative_path = ? WHERE filepath = ?`
+			_, err = tx.Exec(updateQuery, opts.Status, reason, opts.Priority, notBefore, opts.RetryCount, contentHash, outputPath, sizeBytes, opts.Category, now, relativePath, filePath)
 			if err != nil {
 				return fmt.Errorf("failed to reset existing job to pending: %w", err)
 			}
-			slog.Debug("Resetting existing job to pending", "filepath", filePath, "relative_path", relativePath)
+			slog.Debug("Resetting existing failed job", "filepath", filePath, "relative_path", relativePath, "status", opts.Status)
 		} else {
 			// Job exists with status pending or processing - ignore
 			slog.Debug("Ignoring add job request for existing non-failed/non-completed job", "filepath", filePath, "status", currentStatus)
@@ -182,8 +336,11 @@ func (q *Queue) AddJob(filePath string, relativePath string) error {
 	return nil
 }
 
-// GetNextJob retrieves the oldest pending job, marks it as processing, and returns it.
-// Returns sql.ErrNoRows if no pending jobs are available.
+// GetNextJob retrieves the next pending job that is not deferred, in the order
+// set with SetOrder (highest priority, oldest first among equal priorities, by
+// default) or interleaved across categories when fair scheduling is enabled,
+// claims it with a lease, marks it as processing, and returns it. Returns
+// sql.ErrNoRows if no pending jobs are available.
 func (q *Queue) GetNextJob() (*Job, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -196,26 +353,34 @@ func (q *Queue) GetNextJob() (*Job, error) {
 		_ = tx.Rollback() // Rollback if anything fails
 	}()
 
-	// Select the oldest pending job, including relative_path
-	selectQuery := `SELECT id, filepath, relative_path, status, error_msg, created_at, updated_at FROM jobs WHERE status = ? ORDER BY created_at ASC LIMIT 1`
-	row := tx.QueryRow(selectQuery, StatusPending)
+	blocked, err := q.blockedCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, args := q.pendingArgs(blocked)
 
-	job := &Job{}
-	// Scan relative_path into the job struct
-	err = row.Scan(&job.ID, &job.FilePath, &job.RelativePath, &job.Status, &job.ErrorMsg, &job.CreatedAt, &job.UpdatedAt)
+	var job *Job
+	if q.fair != nil {
+		job, err = q.fair.next(tx, condition, args, q.orderBy(), q.byPriority())
+	} else {
+		// Select the next pending job, including relative_path
+		selectQuery := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + condition + ` ORDER BY ` + q.orderBy() + ` LIMIT 1`
+		job, err = scanJob(tx.QueryRow(selectQuery, args...))
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows // Specific error for no pending jobs
 		}
-		// Potential error if relative_path column doesn't exist yet (if ALTER TABLE failed silently)
 		// Log the specific scan error for debugging
 		slog.Error("Failed to scan job row", "error", err)
 		return nil, fmt.Errorf("failed to scan job row: %w", err)
 	}
 
 	// Update the job status to processing
-	updateQuery := `UPDATE jobs SET status = ?, updated_at = ? WHERE id = ?`
-	_, err = tx.Exec(updateQuery, StatusProcessing, time.Now(), job.ID)
+	now := time.Now()
+	updateQuery := `UPDATE jobs SET status = ?, claimed_by = ?, lease_expires_at = ?, started_at = ?, updated_at = ? WHERE id = ?`
+	_, err = tx.Exec(updateQuery, StatusProcessing, q.owner, now.Add(q.lease).UTC(), now, now, job.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update job status to processing: %w", err)
 	}
@@ -225,11 +390,148 @@ func (q *Queue) GetNextJob() (*Job, error) {
 	}
 
 	job.Status = StatusProcessing // Update status in the returned struct
+	job.StartedAt = now
 	return job, nil
 }
 
+// ClaimPendingJobs claims every pending job that is not deferred and matches
+// match, like GetNextJob, so they can be processed together with a job
+// already claimed. Category limits do not apply to them.
+func (q *Queue) ClaimPendingJobs(match func(*Job) bool) ([]*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	condition, args := q.pendingArgs(nil)
+	rows, err := tx.Query(`SELECT `+jobColumns+` FROM jobs WHERE `+condition+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		if match(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending jobs: %w", err)
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		_, err = tx.Exec(`UPDATE jobs SET status = ?, claimed_by = ?, lease_expires_at = ?, started_at = ?, updated_at = ? WHERE id = ?`,
+			StatusProcessing, q.owner, now.Add(q.lease).UTC(), now, now, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update job status to processing: %w", err)
+		}
+		job.Status = StatusProcessing
+		job.StartedAt = now
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// SetCategoryLimits caps the number of jobs of a category that may be processing
+// at the same time. Categories without a limit are unrestricted.
+func (q *Queue) SetCategoryLimits(limits map[string]int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.categoryLimits = limits
+}
+
+// SetMaxRetries keeps GetNextJob and ClaimPendingJobs from picking pending
+// jobs that already failed maxRetries times, such as failed jobs queued again
+// by a rescan, so they wait for MoveFailedFiles instead of being retried.
+// A value <= 0 picks jobs regardless of their retry count.
+func (q *Queue) SetMaxRetries(maxRetries int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.maxRetries = maxRetries
+}
+
+// blockedCategories returns the categories that reached their concurrency limit.
+func (q *Queue) blockedCategories(tx *sql.Tx) ([]string, error) {
+	if len(q.categoryLimits) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(`SELECT COALESCE(category, ''), COUNT(*) FROM jobs WHERE status = ? GROUP BY COALESCE(category, '')`, StatusProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count processing jobs: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var blocked []string
+	for rows.Next() {
+		var category string
+		var processing int
+		if err := rows.Scan(&category, &processing); err != nil {
+			return nil, fmt.Errorf("failed to scan processing count: %w", err)
+		}
+
+		if limit, ok := q.categoryLimits[category]; ok && limit > 0 && processing >= limit {
+			blocked = append(blocked, category)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating processing counts: %w", err)
+	}
+
+	return blocked, nil
+}
+
+// pendingArgs returns pendingCondition extended to exclude the blocked
+// categories, jobs out of retries and jobs the registered node cannot reach,
+// along with its arguments.
+func (q *Queue) pendingArgs(blocked []string) (string, []any) {
+	condition := pendingCondition
+	args := []any{StatusPending, time.Now().UTC()}
+
+	if q.maxRetries > 0 {
+		condition += ` AND retry_count < ?`
+		args = append(args, q.maxRetries)
+	}
+
+	reachable, reachableArgs := q.reachableCondition()
+	condition += reachable
+	args = append(args, reachableArgs...)
+
+	if len(blocked) > 0 {
+		condition += ` AND COALESCE(category, '') NOT IN (?` + strings.Repeat(`, ?`, len(blocked)-1) + `)`
+		for _, c := range blocked {
+			args = append(args, c)
+		}
+	}
+
+	return condition, args
+}
+
 // UpdateJobStatus updates the status and optionally the error message for a given job ID.
 // If the status is being set to failed, it will increment the retry count.
+// Setting it to completed or healthy records when the job finished.
 func (q *Queue) UpdateJobStatus(jobID int64, status JobStatus, errorMsg string) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -242,12 +544,17 @@ func (q *Queue) UpdateJobStatus(jobID int64, status JobStatus, errorMsg string)
 	var query string
 	var args []interface{}
 
-	if status == StatusFailed {
+	switch status {
+	case StatusFailed:
 		// Increment retry count when status is set to failed
-		query = `UPDATE jobs SET status = ?, error_msg = ?, updated_at = ?, retry_count = retry_count + 1 WHERE id = ?`
+		query = `UPDATE jobs SET status = ?, error_msg = ?, progress = NULL, updated_at = ?, retry_count = retry_count + 1 WHERE id = ?`
 		args = []interface{}{status, errMsg, time.Now(), jobID}
-	} else {
-		query = `UPDATE jobs SET status = ?, error_msg = ?, updated_at = ? WHERE id = ?`
+	case StatusCompleted, StatusHealthy:
+		now := time.Now()
+		query = `UPDATE jobs SET status = ?, error_msg = ?, progress = NULL, finished_at = ?, updated_at = ? WHERE id = ?`
+		args = []interface{}{status, errMsg, now, now, jobID}
+	default:
+		query = `UPDATE jobs SET status = ?, error_msg = ?, progress = NULL, updated_at = ? WHERE id = ?`
 		args = []interface{}{status, errMsg, time.Now(), jobID}
 	}
 
@@ -258,6 +565,322 @@ func (q *Queue) UpdateJobStatus(jobID int64, status JobStatus, errorMsg string)
 	return nil
 }
 
+// GetJobByPath returns the job for the given absolute file path.
+// Returns sql.ErrNoRows if the file has never been queued.
+func (q *Queue) GetJobByPath(filePath string) (*Job, error) {
+	job, err := scanJob(q.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE filepath = ?`, filePath))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetJob returns the job with jobID. Returns ErrJobNotFound if it does not
+// exist.
+func (q *Queue) GetJob(jobID int64) (*Job, error) {
+	job, err := scanJob(q.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, jobID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("job %d: %w", jobID, ErrJobNotFound)
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+// FailJobPermanently marks a job as failed and raises its retry count to
+// retryCount, so it is moved to the broken folder without further attempts.
+func (q *Queue) FailJobPermanently(jobID int64, retryCount int64, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, error_msg = ?, retry_count = MAX(retry_count, ?), updated_at = ? WHERE id = ?`
+	if _, err := q.db.Exec(query, StatusFailed, reason, retryCount, time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to fail job: %w", err)
+	}
+	return nil
+}
+
+// DeferJob puts a job back to pending and keeps it from being picked before until.
+func (q *Queue) DeferJob(jobID int64, until time.Time, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var errMsg sql.NullString
+	if reason != "" {
+		errMsg = sql.NullString{String: reason, Valid: true}
+	}
+
+	query := `UPDATE jobs SET status = ?, error_msg = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`
+	if _, err := q.db.Exec(query, StatusPending, errMsg, until.UTC(), time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to defer job: %w", err)
+	}
+	return nil
+}
+
+// TriageJob records the repairability verdict of a job and moves it to
+// status, usually StatusAwaitingApproval, with reason as its message.
+func (q *Queue) TriageJob(jobID int64, verdict string, status JobStatus, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, verdict = ?, error_msg = ?, updated_at = ? WHERE id = ?`
+	if _, err := q.db.Exec(query, status, verdict, reason, time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to triage job: %w", err)
+	}
+	return nil
+}
+
+// ReportJob finishes a job checked without repairing it with its verdict.
+func (q *Queue) ReportJob(jobID int64, verdict string, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	query := `UPDATE jobs SET status = ?, verdict = ?, error_msg = ?, progress = NULL, finished_at = ?, updated_at = ? WHERE id = ?`
+	if _, err := q.db.Exec(query, StatusReported, verdict, reason, now, now, jobID); err != nil {
+		return fmt.Errorf("failed to report job: %w", err)
+	}
+	return nil
+}
+
+// ApproveJob puts a job awaiting approval back to pending, marked approved so
+// it is repaired instead of triaged again. Returns ErrNotAwaitingApproval if
+// the job does not exist or is in another status.
+func (q *Queue) ApproveJob(jobID int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, approved = 1, error_msg = NULL, next_attempt_at = NULL, updated_at = ? WHERE id = ? AND status = ?`
+	result, err := q.db.Exec(query, StatusPending, time.Now(), jobID, StatusAwaitingApproval)
+	if err != nil {
+		return fmt.Errorf("failed to approve job: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to approve job: %w", err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("job %d: %w", jobID, ErrNotAwaitingApproval)
+	}
+
+	return nil
+}
+
+// RetryJob puts a failed job back to pending with its retries reset, so it
+// gets the full number of attempts again. Returns ErrJobNotFailed if the job
+// does not exist or has not failed.
+func (q *Queue) RetryJob(jobID int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, error_msg = NULL, retry_count = 0, next_attempt_at = NULL, updated_at = ? WHERE id = ? AND status = ?`
+	result, err := q.db.Exec(query, StatusPending, time.Now(), jobID, StatusFailed)
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("job %d: %w", jobID, ErrJobNotFailed)
+	}
+
+	return nil
+}
+
+// RetryFailedJobs puts every failed job back to pending like RetryJob and
+// returns how many there were.
+func (q *Queue) RetryFailedJobs() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, error_msg = NULL, retry_count = 0, next_attempt_at = NULL, updated_at = ? WHERE status = ?`
+	result, err := q.db.Exec(query, StatusPending, time.Now(), StatusFailed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry failed jobs: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry failed jobs: %w", err)
+	}
+
+	return n, nil
+}
+
+// DeleteJob removes a job from the queue, leaving its NZB where it is, so a
+// later scan queues it again. Returns ErrJobNotFound if the job does not exist
+// and ErrJobProcessing if a worker is processing it.
+func (q *Queue) DeleteJob(jobID int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var current JobStatus
+	if err := tx.QueryRow(`SELECT status FROM jobs WHERE id = ?`, jobID).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("job %d: %w", jobID, ErrJobNotFound)
+		}
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	if current == StatusProcessing {
+		return fmt.Errorf("job %d: %w", jobID, ErrJobProcessing)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, jobID); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetJobNote attaches note to a job, replacing its previous note. An empty
+// note removes it. Returns ErrJobNotFound if the job does not exist.
+func (q *Queue) SetJobNote(jobID int64, note string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result, err := q.db.Exec(`UPDATE jobs SET note = ?, updated_at = ? WHERE id = ?`, sql.NullString{String: note, Valid: note != ""}, time.Now(), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to set job note: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set job note: %w", err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("job %d: %w", jobID, ErrJobNotFound)
+	}
+
+	return nil
+}
+
+// OverrideJobStatus forces a job to status, with reason as its message, for
+// jobs handled outside the tool. A failed job gets at least retryCount
+// retries, so it is moved to the broken folder without further attempts.
+// Returns ErrJobNotFound if the job does not exist and ErrJobProcessing if a
+// worker is processing it.
+func (q *Queue) OverrideJobStatus(jobID int64, status JobStatus, retryCount int64, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var current JobStatus
+	if err := tx.QueryRow(`SELECT status FROM jobs WHERE id = ?`, jobID).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("job %d: %w", jobID, ErrJobNotFound)
+		}
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	if current == StatusProcessing {
+		return fmt.Errorf("job %d: %w", jobID, ErrJobProcessing)
+	}
+
+	if status != StatusFailed {
+		retryCount = 0
+	}
+
+	query := `UPDATE jobs SET status = ?, error_msg = ?, retry_count = MAX(retry_count, ?), next_attempt_at = NULL, updated_at = ? WHERE id = ?`
+	if _, err := tx.Exec(query, status, sql.NullString{String: reason, Valid: reason != ""}, retryCount, time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to override job status: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// FindCompletedByHash returns the most recent completed job whose NZB has the
+// given content hash. Returns sql.ErrNoRows if there is none.
+func (q *Queue) FindCompletedByHash(hash string) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE content_hash = ? AND status = ? AND output_path IS NOT NULL ORDER BY updated_at DESC LIMIT 1`
+
+	job, err := scanJob(q.db.QueryRow(query, hash, StatusCompleted))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to find job by hash: %w", err)
+	}
+
+	return job, nil
+}
+
+// SetJobOutputPath records where the repaired NZB of a job was written.
+func (q *Queue) SetJobOutputPath(jobID int64, outputPath string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.db.Exec(`UPDATE jobs SET output_path = ?, updated_at = ? WHERE id = ?`, outputPath, time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to update job output path: %w", err)
+	}
+	return nil
+}
+
+// SetJobProgress records the progress of a processing job. It is cleared when
+// the status of the job changes.
+func (q *Queue) SetJobProgress(jobID int64, progress JobProgress) error {
+	b, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to encode job progress: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.db.Exec(`UPDATE jobs SET progress = ? WHERE id = ? AND status = ?`, string(b), jobID, StatusProcessing); err != nil {
+		return fmt.Errorf("failed to update job progress: %w", err)
+	}
+	return nil
+}
+
+// SetJobPriority changes the priority of a job.
+func (q *Queue) SetJobPriority(jobID int64, priority int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.db.Exec(`UPDATE jobs SET priority = ?, updated_at = ? WHERE id = ?`, priority, time.Now(), jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update job priority: %w", err)
+	}
+	return nil
+}
+
 // Close closes the database connection.
 func (q *Queue) Close() error {
 	if q.db != nil {
@@ -266,12 +889,19 @@ func (q *Queue) Close() error {
 	return nil
 }
 
-// CleanupProcessingJobs finds all jobs marked as processing and sets their status to failed.
-// This is typically called on application startup to handle jobs interrupted by a previous crash.
+// CleanupProcessingJobs puts processing jobs back to pending that were claimed
+// by this queue's owner, i.e. by a previous run of the same node, or whose
+// lease expired. This is typically called on application startup to handle
+// jobs interrupted by a previous crash. Jobs with a live lease may still be
+// running elsewhere and are left alone; ReclaimExpiredJobs picks them up once
+// their lease runs out.
 func (q *Queue) CleanupProcessingJobs() (int64, error) {
-	query := `UPDATE jobs SET status = ?, updated_at = ? WHERE status = ?`
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `UPDATE jobs SET status = ?, claimed_by = NULL, lease_expires_at = NULL, updated_at = ? WHERE status = ? AND (claimed_by = ? OR ` + leaseExpiredCondition + `)`
 	now := time.Now()
-	result, err := q.db.Exec(query, StatusPending, now, StatusProcessing)
+	result, err := q.db.Exec(query, StatusPending, now, StatusProcessing, q.owner, now.UTC())
 	if err != nil {
 		return 0, fmt.Errorf("failed to update processing jobs to failed: %w", err)
 	}
@@ -291,7 +921,8 @@ func (q *Queue) CleanupProcessingJobs() (int64, error) {
 }
 
 // MoveFailedFiles moves files that have exceeded the maximum number of retries
-// to the broken folder. Returns the number of files moved and any error encountered.
+// to the broken folder, whether their job is failed or was queued again.
+// Returns the number of files moved and any error encountered.
 func (q *Queue) MoveFailedFiles(maxRetries int64, brokenFolder string) (int64, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -301,65 +932,191 @@ func (q *Queue) MoveFailedFiles(maxRetries int64, brokenFolder string) (int64, e
 		return 0, fmt.Errorf("failed to create broken folder: %w", err)
 	}
 
-	// Get all failed jobs that have exceeded max retries
+	// Get all failed or requeued jobs that have exceeded max retries
 	query := `
-		SELECT id, filepath, relative_path 
+		SELECT id, filepath, relative_path, retry_count
 		FROM jobs 
-		WHERE status = ? AND retry_count >= ?
+		WHERE status IN (?, ?) AND retry_count >= ?
 	`
-	rows, err := q.db.Query(query, StatusFailed, maxRetries)
+	reachable, reachableArgs := q.reachableCondition()
+	rows, err := q.db.Query(query+reachable, append([]any{StatusFailed, StatusPending, maxRetries}, reachableArgs...)...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to query failed jobs: %w", err)
 	}
-	defer func() {
-		_ = rows.Close()
-	}()
 
-	var movedCount int64
+	// Collect the jobs before updating them: writing while the read cursor is
+	// open fails with "database is locked".
+	var jobs []Job
 	for rows.Next() {
 		var job Job
-		if err := rows.Scan(&job.ID, &job.FilePath, &job.RelativePath); err != nil {
-			return movedCount, fmt.Errorf("failed to scan job row: %w", err)
+		if err := rows.Scan(&job.ID, &job.FilePath, &job.RelativePath, &job.RetryCount); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("failed to scan job row: %w", err)
 		}
+		jobs = append(jobs, job)
+	}
 
-		// Get the filename from the path
-		_, filename := filepath.Split(job.FilePath)
-		if filename == "" {
-			slog.Warn("Skipping file with empty filename", "filepath", job.FilePath)
-			continue
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return 0, fmt.Errorf("error iterating failed jobs: %w", err)
+	}
+	_ = rows.Close()
+
+	var movedCount int64
+	for _, job := range jobs {
+		if q.moveToBroken(&job, brokenFolder) {
+			movedCount++
 		}
+	}
 
-		// Create destination path in broken folder
-		destPath := filepath.Join(brokenFolder, filename)
+	return movedCount, nil
+}
 
-		// Move the file
-		if err := os.Rename(job.FilePath, destPath); err != nil {
-			slog.Error("Failed to move file to broken folder",
-				"filepath", job.FilePath,
-				"dest", destPath,
-				"error", err)
-			continue
-		}
+// MoveFailedJob moves the file of a failed job that has exceeded the maximum
+// number of retries to the broken folder, so it doesn't wait for the next
+// sweep of MoveFailedFiles. It reports whether the file was moved.
+func (q *Queue) MoveFailedJob(jobID int64, maxRetries int64, brokenFolder string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-		// Update job status to indicate it was moved
-		updateQuery := `UPDATE jobs SET status = 'moved', updated_at = datetime('now') WHERE id = ?`
-		if _, err := q.db.Exec(updateQuery, job.ID); err != nil {
-			slog.Error("Failed to update job status after move",
-				"job_id", job.ID,
-				"error", err)
-			continue
-		}
+	var job Job
+	query := `SELECT id, filepath, relative_path, retry_count FROM jobs WHERE id = ? AND status = ? AND retry_count >= ?`
+	err := q.db.QueryRow(query, jobID, StatusFailed, maxRetries).Scan(&job.ID, &job.FilePath, &job.RelativePath, &job.RetryCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get failed job: %w", err)
+	}
+
+	if err := os.MkdirAll(brokenFolder, 0755); err != nil {
+		return false, fmt.Errorf("failed to create broken folder: %w", err)
+	}
 
-		movedCount++
-		slog.Info("Moved failed file to broken folder",
+	return q.moveToBroken(&job, brokenFolder), nil
+}
+
+// brokenPath returns where the file of a job is moved to in brokenFolder: its
+// path relative to the watch directory, or only its name when the relative
+// path is unknown or leaves the folder.
+func brokenPath(brokenFolder, filePath, relativePath string) string {
+	if relativePath != "" && filepath.IsLocal(relativePath) {
+		return filepath.Join(brokenFolder, relativePath)
+	}
+
+	return filepath.Join(brokenFolder, filepath.Base(filePath))
+}
+
+// moveToBroken moves the file of job to the broken folder and marks the job as
+// moved, logging failures. It reports whether the file was moved. The caller
+// holds q.mu.
+func (q *Queue) moveToBroken(job *Job, brokenFolder string) bool {
+	// Get the filename from the path
+	_, filename := filepath.Split(job.FilePath)
+	if filename == "" {
+		slog.Warn("Skipping file with empty filename", "filepath", job.FilePath)
+		return false
+	}
+
+	// Create destination path in broken folder
+	destPath := brokenPath(brokenFolder, job.FilePath, job.RelativePath)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		slog.Error("Failed to create broken folder",
+			"filepath", job.FilePath,
+			"dest", destPath,
+			"error", err)
+		return false
+	}
+
+	// Move the file
+	if err := os.Rename(job.FilePath, destPath); err != nil {
+		slog.Error("Failed to move file to broken folder",
 			"filepath", job.FilePath,
 			"dest", destPath,
-			"retry_count", job.RetryCount)
+			"error", err)
+		return false
+	}
+
+	// Update job status to indicate it was moved
+	updateQuery := `UPDATE jobs SET status = 'moved', updated_at = datetime('now') WHERE id = ?`
+	if _, err := q.db.Exec(updateQuery, job.ID); err != nil {
+		slog.Error("Failed to update job status after move",
+			"job_id", job.ID,
+			"error", err)
+		return false
+	}
+
+	slog.Info("Moved failed file to broken folder",
+		"filepath", job.FilePath,
+		"dest", destPath,
+		"retry_count", job.RetryCount)
+
+	return true
+}
+
+// CountByStatus returns the number of jobs in each status.
+func (q *Queue) CountByStatus() (map[JobStatus]int64, error) {
+	rows, err := q.db.Query(`SELECT status, jobs FROM job_status_counts`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs by status: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	counts := make(map[JobStatus]int64)
+	for rows.Next() {
+		var status JobStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan job count row: %w", err)
+		}
+		counts[status] = count
 	}
 
 	if err := rows.Err(); err != nil {
-		return movedCount, fmt.Errorf("error iterating failed jobs: %w", err)
+		return nil, fmt.Errorf("error iterating job counts: %w", err)
 	}
 
-	return movedCount, nil
+	return counts, nil
+}
+
+// ListJobs returns jobs, most recently updated first. An empty status returns
+// jobs of every status; limit <= 0 returns all matching jobs.
+func (q *Queue) ListJobs(status JobStatus, limit int) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+
+	query += ` ORDER BY updated_at DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating jobs: %w", err)
+	}
+
+	return jobs, nil
 }
@@ -2,7 +2,14 @@ package queue
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -59,3 +66,472 @@ func TestAddJob_IgnoresPendingJob(t *testing.T) {
 	_, err = q.GetNextJob()
 	assert.ErrorIs(t, err, sql.ErrNoRows)
 }
+
+func TestProviderUsage_Accumulates(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddProviderUsage("news.example.com", "2025-01", 100, 0))
+	require.NoError(t, q.AddProviderUsage("news.example.com", "2025-01", 50, 10))
+	require.NoError(t, q.AddProviderUsage("news.example.com", "2025-02", 1, 0))
+	require.NoError(t, q.AddProviderUsage("block.example.com", "2025-01", 7, 0))
+
+	usage, err := q.GetProviderUsage("2025-01")
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	assert.Equal(t, ProviderUsage{Provider: "block.example.com", Month: "2025-01", DownloadedBytes: 7}, usage[0])
+	assert.Equal(t, ProviderUsage{Provider: "news.example.com", Month: "2025-01", DownloadedBytes: 150, UploadedBytes: 10}, usage[1])
+}
+
+func TestProviderUsage_AccumulatesCompression(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddProviderUsage("news.example.com", "2025-01", 100, 0))
+	require.NoError(t, q.AddProviderCompression("news.example.com", "2025-01", 100, 40))
+	require.NoError(t, q.AddProviderCompression("news.example.com", "2025-01", 50, 20))
+
+	usage, err := q.GetProviderUsage("2025-01")
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, ProviderUsage{
+		Provider:            "news.example.com",
+		Month:               "2025-01",
+		DownloadedBytes:     100,
+		CompressedRawBytes:  150,
+		CompressedWireBytes: 60,
+	}, usage[0])
+}
+
+func TestCountByStatus(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "boom"))
+
+	counts, err := q.CountByStatus()
+	require.NoError(t, err)
+	assert.Equal(t, map[JobStatus]int64{StatusPending: 1, StatusFailed: 1}, counts)
+}
+
+func TestGetNextJob_HonoursPriority(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJob("/watch/old.nzb", "old.nzb"))
+	require.NoError(t, q.AddJob("/watch/urgent.nzb", "urgent.nzb"))
+
+	// Without priorities the oldest job comes first
+	first, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/old.nzb", first.FilePath)
+	require.NoError(t, q.UpdateJobStatus(first.ID, StatusPending, ""))
+	require.NoError(t, q.SetJobPriority(first.ID+1, 10)) // urgent.nzb
+
+	next, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/urgent.nzb", next.FilePath)
+	assert.Equal(t, 10, next.Priority)
+}
+
+func TestMoveFailedFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Moving needs writes while the failed jobs are read, which an in-memory
+	// db serves from a single connection, so a file db is used.
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	path := filepath.Join(dir, "failed.nzb")
+	require.NoError(t, os.WriteFile(path, []byte("nzb"), 0644))
+
+	require.NoError(t, q.AddJob(path, "failed.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "broken"))
+
+	moved, err := q.MoveFailedFiles(1, filepath.Join(dir, "broken"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+	assert.FileExists(t, filepath.Join(dir, "broken", "failed.nzb"))
+}
+
+func TestGetNextJob_ConcurrentClaims(t *testing.T) {
+	q, err := NewQueue(filepath.Join(t.TempDir(), "queue.db"))
+	require.NoError(t, err)
+
+	const jobs = 20
+	for i := range jobs {
+		name := fmt.Sprintf("job%d.nzb", i)
+		require.NoError(t, q.AddJob("/watch/"+name, name))
+	}
+
+	var (
+		mu      sync.Mutex
+		claimed = make(map[int64]int)
+		wg      sync.WaitGroup
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := q.GetNextJob()
+				if errors.Is(err, sql.ErrNoRows) {
+					return
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, claimed, jobs)
+	for id, n := range claimed {
+		assert.Equal(t, 1, n, "job %d claimed by several workers", id)
+	}
+}
+
+func TestClaimPendingJobs(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJob("/watch/show.part1.nzb", "show.part1.nzb"))
+	require.NoError(t, q.AddJob("/watch/show.part2.nzb", "show.part2.nzb"))
+	require.NoError(t, q.AddJob("/watch/other.nzb", "other.nzb"))
+
+	first, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	related, err := q.ClaimPendingJobs(func(j *Job) bool { return strings.HasPrefix(j.RelativePath, "show.") })
+	require.NoError(t, err)
+	require.Len(t, related, 1, "claimed jobs are not claimed again")
+	assert.Equal(t, "/watch/show.part2.nzb", related[0].FilePath)
+	assert.NotEqual(t, first.ID, related[0].ID)
+
+	next, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/other.nzb", next.FilePath)
+}
+
+func TestDeferJob(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJob("/watch/new.nzb", "new.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	require.NoError(t, q.DeferJob(job.ID, time.Now().Add(time.Hour), "waiting"))
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "deferred job must not be picked early")
+
+	require.NoError(t, q.DeferJob(job.ID, time.Now().Add(-time.Second), "waiting"))
+	job, err = q.GetNextJob()
+	require.NoError(t, err)
+	assert.Equal(t, "/watch/new.nzb", job.FilePath)
+}
+
+func TestFailJobPermanently_MovesOnNextSweep(t *testing.T) {
+	dir := t.TempDir()
+	// MoveFailedFiles needs a file db, see TestMoveFailedFiles.
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	path := filepath.Join(dir, "old.nzb")
+	require.NoError(t, os.WriteFile(path, []byte("nzb"), 0644))
+
+	require.NoError(t, q.AddJob(path, "old.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.FailJobPermanently(job.ID, 3, "too old"))
+
+	moved, err := q.MoveFailedFiles(3, filepath.Join(dir, "broken"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+}
+
+func TestGetNextJob_SkipsJobsOutOfRetries(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+	q.SetMaxRetries(1)
+
+	path := filepath.Join(dir, "old.nzb")
+	require.NoError(t, os.WriteFile(path, []byte("nzb"), 0644))
+	require.NoError(t, q.AddJob(path, "old.nzb"))
+
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "boom"))
+
+	// A rescan queues the failed job again.
+	require.NoError(t, q.AddJob(path, "old.nzb"))
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "a job out of retries must not be picked")
+
+	claimed, err := q.ClaimPendingJobs(func(*Job) bool { return true })
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	moved, err := q.MoveFailedFiles(1, filepath.Join(dir, "broken"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), moved, "a requeued job out of retries is moved")
+}
+
+func TestMoveFailedJob(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	path := filepath.Join(dir, "watch", "tv", "show.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("nzb"), 0644))
+	require.NoError(t, q.AddJob(path, filepath.Join("tv", "show.nzb")))
+
+	broken := filepath.Join(dir, "broken")
+	for range 2 {
+		job, err := q.GetNextJob()
+		require.NoError(t, err)
+		moved, err := q.MoveFailedJob(job.ID, 2, broken)
+		require.NoError(t, err)
+		assert.False(t, moved, "a job being processed is not moved")
+
+		require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "boom"))
+		moved, err = q.MoveFailedJob(job.ID, 2, broken)
+		require.NoError(t, err)
+		if job.RetryCount == 0 {
+			assert.False(t, moved, "a job with retries left is not moved")
+			require.NoError(t, q.AddJob(path, filepath.Join("tv", "show.nzb")))
+			continue
+		}
+		assert.True(t, moved)
+	}
+
+	assert.FileExists(t, filepath.Join(broken, "tv", "show.nzb"), "the relative path is kept")
+	assert.NoFileExists(t, path)
+
+	job, err := q.GetJobByPath(path)
+	require.NoError(t, err)
+	assert.Equal(t, StatusMoved, job.Status)
+}
+
+func TestBrokenPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("broken", "tv", "show.nzb"), brokenPath("broken", "/watch/tv/show.nzb", filepath.Join("tv", "show.nzb")))
+	assert.Equal(t, filepath.Join("broken", "show.nzb"), brokenPath("broken", "/watch/tv/show.nzb", ""))
+	assert.Equal(t, filepath.Join("broken", "show.nzb"), brokenPath("broken", "/elsewhere/show.nzb", filepath.Join("..", "elsewhere", "show.nzb")))
+}
+
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]int{"": PriorityNormal, "normal": PriorityNormal, "HIGH": PriorityHigh, "low": PriorityLow, "42": 42, "-3": -3} {
+		got, err := ParsePriority(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := ParsePriority("urgent")
+	assert.Error(t, err)
+}
+
+func TestListJobs(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	a, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(a.ID, StatusFailed, "boom"))
+
+	jobs, err := q.ListJobs("", 0)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 2)
+
+	jobs, err = q.ListJobs(StatusFailed, 0)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "/watch/a.nzb", jobs[0].FilePath)
+	assert.Equal(t, "boom", jobs[0].ErrorMsg.String)
+
+	jobs, err = q.ListJobs("", 1)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestTriageAndApproveJob(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.False(t, job.Approved)
+
+	require.ErrorIs(t, q.ApproveJob(job.ID), ErrNotAwaitingApproval, "processing jobs cannot be approved")
+
+	require.NoError(t, q.TriageJob(job.ID, "repairable", StatusAwaitingApproval, "repairable (3 blocks needed, 10 available)"))
+	triaged, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, StatusAwaitingApproval, triaged.Status)
+	assert.Equal(t, "repairable", triaged.Verdict)
+
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "jobs awaiting approval must not be picked")
+
+	require.NoError(t, q.ApproveJob(job.ID))
+	approved, err := q.GetNextJob()
+	require.NoError(t, err)
+	assert.True(t, approved.Approved)
+	assert.Equal(t, "repairable", approved.Verdict)
+	assert.False(t, approved.ErrorMsg.Valid)
+}
+
+func TestReportJob(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	require.NoError(t, q.ReportJob(job.ID, "unrepairable", "uploads disabled for the job"))
+	reported, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, StatusReported, reported.Status)
+	assert.Equal(t, "unrepairable", reported.Verdict)
+	assert.Equal(t, "uploads disabled for the job", reported.ErrorMsg.String)
+
+	_, err = q.GetNextJob()
+	assert.ErrorIs(t, err, sql.ErrNoRows, "reported jobs are done")
+}
+
+func TestRetryAndDeleteJob(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	a, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	require.ErrorIs(t, q.RetryJob(a.ID), ErrJobNotFailed)
+	require.ErrorIs(t, q.DeleteJob(a.ID), ErrJobProcessing)
+
+	require.NoError(t, q.UpdateJobStatus(a.ID, StatusFailed, "par2 failed"))
+	require.NoError(t, q.RetryJob(a.ID))
+	got, err := q.GetJob(a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, got.Status)
+	assert.Zero(t, got.RetryCount)
+	assert.False(t, got.ErrorMsg.Valid)
+
+	a, err = q.GetNextJob()
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateJobStatus(a.ID, StatusFailed, "par2 failed"))
+	n, err := q.RetryFailedJobs()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.NoError(t, q.DeleteJob(a.ID))
+	_, err = q.GetJob(a.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, q.DeleteJob(a.ID), ErrJobNotFound)
+}
+
+func TestSetJobProgress(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Nil(t, job.Progress)
+
+	progress := JobProgress{Phase: "download", Unit: "bytes", Done: 512, Total: 1024, Rate: 256}
+	require.NoError(t, q.SetJobProgress(job.ID, progress))
+
+	got, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	require.NotNil(t, got.Progress)
+	assert.Equal(t, progress, *got.Progress)
+
+	require.NoError(t, q.UpdateJobStatus(job.ID, StatusCompleted, ""))
+	got, err = q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Nil(t, got.Progress, "progress is cleared once the job is done")
+
+	require.NoError(t, q.SetJobProgress(job.ID, progress))
+	got, err = q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Nil(t, got.Progress, "only processing jobs record progress")
+}
+
+func TestOverrideJobStatus(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetNextJob()
+	require.NoError(t, err)
+
+	require.ErrorIs(t, q.OverrideJobStatus(job.ID, StatusCompleted, 0, ""), ErrJobProcessing)
+	require.ErrorIs(t, q.OverrideJobStatus(job.ID+1, StatusCompleted, 0, ""), ErrJobNotFound)
+
+	require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "par2 failed"))
+	require.NoError(t, q.OverrideJobStatus(job.ID, StatusCompleted, 3, "repaired by hand"))
+
+	got, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, got.Status)
+	assert.Equal(t, "repaired by hand", got.ErrorMsg.String)
+	assert.Equal(t, int64(1), got.RetryCount, "only failed jobs get the retry count")
+
+	require.NoError(t, q.OverrideJobStatus(job.ID, StatusFailed, 3, ""))
+	got, err = q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.False(t, got.ErrorMsg.Valid)
+	assert.Equal(t, int64(3), got.RetryCount)
+}
+
+func TestSetJobNote(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	job, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+
+	require.NoError(t, q.SetJobNote(job.ID, "checked by hand"))
+	got, err := q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Equal(t, "checked by hand", got.Note)
+
+	require.NoError(t, q.SetJobNote(job.ID, ""))
+	got, err = q.GetJobByPath("/watch/a.nzb")
+	require.NoError(t, err)
+	assert.Empty(t, got.Note)
+
+	assert.ErrorIs(t, q.SetJobNote(job.ID+1, "missing"), ErrJobNotFound)
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stats summarizes the jobs of the queue for dashboards.
+type Stats struct {
+	// Counts is the number of jobs in each status.
+	Counts map[JobStatus]int64
+	// OldestPending is when the oldest pending job was queued, zero when no
+	// job is pending.
+	OldestPending time.Time
+	// FailuresPerDay counts the failed jobs and the jobs moved to the broken
+	// folder by UTC day of their last failure, oldest day first.
+	FailuresPerDay []DailyFailures
+}
+
+// DailyFailures is the number of jobs that last failed on Day (YYYY-MM-DD).
+type DailyFailures struct {
+	Day      string
+	Failures int64
+}
+
+// Stats returns the job counts, the oldest pending job and the failures of
+// the last days days, today included.
+func (q *Queue) Stats(days int) (Stats, error) {
+	counts, err := q.CountByStatus()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Counts: counts}
+
+	// MIN() loses the column type, which the driver needs to parse the time.
+	err = q.db.QueryRow(`SELECT created_at FROM jobs WHERE status = ? ORDER BY created_at ASC LIMIT 1`, StatusPending).Scan(&stats.OldestPending)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Stats{}, fmt.Errorf("failed to get oldest pending job: %w", err)
+	}
+
+	rows, err := q.db.Query(`SELECT day, failures FROM job_failures_per_day
+		WHERE day > date('now', ?) ORDER BY day ASC`, fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to query failures per day: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var d DailyFailures
+		if err := rows.Scan(&d.Day, &d.Failures); err != nil {
+			return Stats{}, fmt.Errorf("failed to scan failures per day: %w", err)
+		}
+		stats.FailuresPerDay = append(stats.FailuresPerDay, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("error iterating failures per day: %w", err)
+	}
+
+	return stats, nil
+}
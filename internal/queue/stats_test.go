@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+	defer func() { _ = q.Close() }()
+
+	stats, err := q.Stats(7)
+	require.NoError(t, err)
+	assert.Empty(t, stats.Counts)
+	assert.True(t, stats.OldestPending.IsZero())
+	assert.Empty(t, stats.FailuresPerDay)
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, q.AddJob("/watch/a.nzb", "a.nzb"))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	require.NoError(t, q.AddJob("/watch/c.nzb", "c.nzb"))
+	for range 2 {
+		job, err := q.GetNextJob()
+		require.NoError(t, err)
+		require.NoError(t, q.UpdateJobStatus(job.ID, StatusFailed, "boom"))
+	}
+
+	// A failure older than the window is left out.
+	_, err = q.db.Exec(`UPDATE jobs SET updated_at = ? WHERE filepath = ?`, time.Now().AddDate(0, 0, -10), "/watch/a.nzb")
+	require.NoError(t, err)
+
+	stats, err = q.Stats(7)
+	require.NoError(t, err)
+	assert.Equal(t, map[JobStatus]int64{StatusPending: 1, StatusFailed: 2}, stats.Counts)
+	assert.True(t, stats.OldestPending.After(before), stats.OldestPending)
+	assert.Equal(t, []DailyFailures{{Day: time.Now().UTC().Format(time.DateOnly), Failures: 1}}, stats.FailuresPerDay)
+}
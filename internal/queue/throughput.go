@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// Throughput sums the processing times of recently finished jobs.
+type Throughput struct {
+	// Jobs is the number of sampled jobs and Duration their processing time.
+	Jobs     int64
+	Duration time.Duration
+	// SizedBytes is the total NZB size of the sampled jobs whose size was
+	// recorded and SizedDuration their processing time.
+	SizedBytes    int64
+	SizedDuration time.Duration
+}
+
+// BytesPerSecond returns the NZB bytes processed per second, 0 when no
+// sampled job has a size.
+func (t Throughput) BytesPerSecond() float64 {
+	if t.SizedBytes == 0 || t.SizedDuration <= 0 {
+		return 0
+	}
+
+	return float64(t.SizedBytes) / t.SizedDuration.Seconds()
+}
+
+// Estimate returns how long processing job takes: its size at the measured
+// rate, or the average processing time when its size is unknown. It returns
+// false when there is no history to estimate from.
+func (t Throughput) Estimate(job *Job) (time.Duration, bool) {
+	if rate := t.BytesPerSecond(); rate > 0 && job.SizeBytes > 0 {
+		return time.Duration(float64(job.SizeBytes) / rate * float64(time.Second)), true
+	}
+
+	if t.Jobs == 0 {
+		return 0, false
+	}
+
+	return t.Duration / time.Duration(t.Jobs), true
+}
+
+// Throughput returns the processing times of the last limit jobs that
+// completed or were found healthy after being claimed.
+func (q *Queue) Throughput(limit int) (Throughput, error) {
+	rows, err := q.db.Query(`SELECT COALESCE(size_bytes, 0), started_at, finished_at FROM jobs
+		WHERE status IN (?, ?) AND started_at IS NOT NULL AND finished_at IS NOT NULL
+		ORDER BY finished_at DESC LIMIT ?`, StatusCompleted, StatusHealthy, limit)
+	if err != nil {
+		return Throughput{}, fmt.Errorf("failed to query finished jobs: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var t Throughput
+	for rows.Next() {
+		var size int64
+		var started, finished time.Time
+		if err := rows.Scan(&size, &started, &finished); err != nil {
+			return Throughput{}, fmt.Errorf("failed to scan finished job row: %w", err)
+		}
+
+		d := finished.Sub(started)
+		if d <= 0 {
+			continue
+		}
+
+		t.Jobs++
+		t.Duration += d
+		if size > 0 {
+			t.SizedBytes += size
+			t.SizedDuration += d
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return Throughput{}, fmt.Errorf("error iterating finished jobs: %w", err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThroughput(t *testing.T) {
+	q, err := NewQueue(":memory:")
+	require.NoError(t, err)
+
+	require.NoError(t, q.AddJobWithOptions("/watch/a.nzb", "a.nzb", AddOptions{SizeBytes: 1000}))
+	require.NoError(t, q.AddJob("/watch/b.nzb", "b.nzb"))
+	require.NoError(t, q.AddJob("/watch/failed.nzb", "failed.nzb"))
+
+	// No job finished yet
+	tp, err := q.Throughput(10)
+	require.NoError(t, err)
+	_, ok := tp.Estimate(&Job{})
+	assert.False(t, ok)
+
+	for _, status := range []JobStatus{StatusCompleted, StatusHealthy, StatusFailed} {
+		job, err := q.GetNextJob()
+		require.NoError(t, err)
+		assert.False(t, job.StartedAt.IsZero())
+		require.NoError(t, q.UpdateJobStatus(job.ID, status, ""))
+	}
+
+	// Make the processing times deterministic
+	_, err = q.db.Exec(`UPDATE jobs SET started_at = ?, finished_at = ? WHERE filepath = ?`, time.Unix(0, 0), time.Unix(10, 0), "/watch/a.nzb")
+	require.NoError(t, err)
+	_, err = q.db.Exec(`UPDATE jobs SET started_at = ?, finished_at = ? WHERE filepath = ?`, time.Unix(0, 0), time.Unix(30, 0), "/watch/b.nzb")
+	require.NoError(t, err)
+
+	tp, err = q.Throughput(10)
+	require.NoError(t, err)
+	assert.Equal(t, Throughput{Jobs: 2, Duration: 40 * time.Second, SizedBytes: 1000, SizedDuration: 10 * time.Second}, tp)
+	assert.InDelta(t, 100, tp.BytesPerSecond(), 0.001)
+
+	d, ok := tp.Estimate(&Job{SizeBytes: 500})
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+
+	d, ok = tp.Estimate(&Job{})
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, d)
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProviderUsage holds the bytes transferred through a provider during a month.
+type ProviderUsage struct {
+	Provider        string
+	Month           string
+	DownloadedBytes int64
+	UploadedBytes   int64
+	// CompressedRawBytes and CompressedWireBytes are the uncompressed and
+	// transferred bytes of compressed connections.
+	CompressedRawBytes  int64
+	CompressedWireBytes int64
+}
+
+// UsageMonth returns the accounting month key for t, e.g. "2025-01".
+func UsageMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// AddProviderUsage adds the given byte counts to the provider's totals for month.
+func (q *Queue) AddProviderUsage(provider, month string, downloaded, uploaded int64) error {
+	if downloaded == 0 && uploaded == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `
+	INSERT INTO provider_usage (provider, month, downloaded_bytes, uploaded_bytes)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(provider, month) DO UPDATE SET
+		downloaded_bytes = downloaded_bytes + excluded.downloaded_bytes,
+		uploaded_bytes = uploaded_bytes + excluded.uploaded_bytes
+	`
+	if _, err := q.db.Exec(query, provider, month, downloaded, uploaded); err != nil {
+		return fmt.Errorf("failed to record provider usage: %w", err)
+	}
+
+	return nil
+}
+
+// AddProviderCompression adds the traffic of compressed connections to the
+// provider's totals for month.
+func (q *Queue) AddProviderCompression(provider, month string, raw, wire int64) error {
+	if raw == 0 && wire == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	query := `
+	INSERT INTO provider_usage (provider, month, compressed_raw_bytes, compressed_wire_bytes)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(provider, month) DO UPDATE SET
+		compressed_raw_bytes = compressed_raw_bytes + excluded.compressed_raw_bytes,
+		compressed_wire_bytes = compressed_wire_bytes + excluded.compressed_wire_bytes
+	`
+	if _, err := q.db.Exec(query, provider, month, raw, wire); err != nil {
+		return fmt.Errorf("failed to record provider compression: %w", err)
+	}
+
+	return nil
+}
+
+// GetProviderUsage returns the usage of every provider for month, ordered by provider.
+func (q *Queue) GetProviderUsage(month string) ([]ProviderUsage, error) {
+	rows, err := q.db.Query(`SELECT provider, month, downloaded_bytes, uploaded_bytes, compressed_raw_bytes, compressed_wire_bytes FROM provider_usage WHERE month = ? ORDER BY provider`, month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query provider usage: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var usage []ProviderUsage
+	for rows.Next() {
+		var u ProviderUsage
+		if err := rows.Scan(&u.Provider, &u.Month, &u.DownloadedBytes, &u.UploadedBytes, &u.CompressedRawBytes, &u.CompressedWireBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan provider usage row: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating provider usage: %w", err)
+	}
+
+	return usage, nil
+}
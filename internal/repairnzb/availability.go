@@ -0,0 +1,139 @@
+package repairnzb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultScanConcurrency = 50
+
+// ArticleChecker checks whether articles exist without downloading their
+// bodies, as nntppool.Client does.
+type ArticleChecker interface {
+	Stat(ctx context.Context, messageID string) (*nntppool.StatResult, error)
+	Head(ctx context.Context, messageID string) (*nntppool.ArticleHead, error)
+}
+
+// ScanOptions configure ScanAvailability.
+type ScanOptions struct {
+	// Concurrency is the number of articles checked at once. Defaults to 50.
+	Concurrency int
+	// Head checks articles with HEAD instead of STAT. Some servers answer STAT
+	// from their index even when the article can no longer be retrieved.
+	Head bool
+}
+
+// FileAvailability is the availability of the segments of one NZB file.
+type FileAvailability struct {
+	File nzbparser.NzbFile
+	// Par2 tells whether the file belongs to the par2 set.
+	Par2 bool
+	// Missing are the segments the servers reported as missing.
+	Missing []nzbparser.NzbSegment
+}
+
+// Segments returns the number of segments of the file.
+func (f FileAvailability) Segments() int {
+	return len(f.File.Segments)
+}
+
+// Available returns the number of segments found on the servers.
+func (f FileAvailability) Available() int {
+	return len(f.File.Segments) - len(f.Missing)
+}
+
+// Ratio returns the fraction of available segments, 1 for a file without segments.
+func (f FileAvailability) Ratio() float64 {
+	if len(f.File.Segments) == 0 {
+		return 1
+	}
+
+	return float64(f.Available()) / float64(len(f.File.Segments))
+}
+
+// Availability is the outcome of ScanAvailability, in NZB file order.
+type Availability struct {
+	Files []FileAvailability
+}
+
+// Totals returns the number of segments and of available segments of every file.
+func (a Availability) Totals() (segments, available int) {
+	for _, f := range a.Files {
+		segments += f.Segments()
+		available += f.Available()
+	}
+
+	return segments, available
+}
+
+// Healthy reports whether every segment is available.
+func (a Availability) Healthy() bool {
+	segments, available := a.Totals()
+
+	return segments == available
+}
+
+// ScanAvailability checks every segment of nzb with STAT (or HEAD) only, which
+// takes a fraction of the time of downloading the bodies. Errors other than a
+// missing article abort the scan.
+func ScanAvailability(ctx context.Context, checker ArticleChecker, nzb *nzbparser.Nzb, opts ScanOptions) (*Availability, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultScanConcurrency
+	}
+
+	check := func(ctx context.Context, id string) error {
+		_, err := checker.Stat(ctx, id)
+		return err
+	}
+	if opts.Head {
+		check = func(ctx context.Context, id string) error {
+			_, err := checker.Head(ctx, id)
+			return err
+		}
+	}
+
+	result := &Availability{Files: make([]FileAvailability, len(nzb.Files))}
+
+	var mu sync.Mutex
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.Concurrency)
+	for i, f := range nzb.Files {
+		result.Files[i] = FileAvailability{File: f, Par2: parregexp.MatchString(f.Filename)}
+
+		for _, s := range f.Segments {
+			eg.Go(func() error {
+				err := check(egCtx, s.Id)
+				if err == nil {
+					return nil
+				}
+
+				if !errors.Is(err, nntppool.ErrArticleNotFound) {
+					return fmt.Errorf("failed to check segment %s: %w", s.Id, err)
+				}
+
+				mu.Lock()
+				result.Files[i].Missing = append(result.Files[i].Missing, s)
+				mu.Unlock()
+
+				return nil
+			})
+		}
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range result.Files {
+		sort.Sort(nzbparser.NzbSegments(f.Missing))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package repairnzb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func availabilityNzb() *nzbparser.Nzb {
+	return &nzbparser.Nzb{Files: nzbparser.NzbFiles{
+		{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+			{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"}, {Number: 4, Id: "4@test"},
+		}},
+		{Filename: "show.par2", Segments: nzbparser.NzbSegments{{Number: 1, Id: "p@test"}}},
+	}}
+}
+
+func TestScanAvailability(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	checker := mocks.NewMockArticleChecker(ctrl)
+
+	checker.EXPECT().Stat(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id string) (*nntppool.StatResult, error) {
+		if id == "2@test" || id == "4@test" {
+			return nil, nntppool.ErrArticleNotFound
+		}
+
+		return &nntppool.StatResult{MessageID: id}, nil
+	}).Times(5)
+
+	a, err := ScanAvailability(context.Background(), checker, availabilityNzb(), ScanOptions{Concurrency: 2})
+	require.NoError(t, err)
+	require.Len(t, a.Files, 2)
+
+	assert.False(t, a.Files[0].Par2)
+	assert.Equal(t, 2, a.Files[0].Available())
+	assert.InDelta(t, 0.5, a.Files[0].Ratio(), 0.001)
+	require.Len(t, a.Files[0].Missing, 2)
+	assert.Equal(t, "2@test", a.Files[0].Missing[0].Id, "missing segments are sorted")
+	assert.Equal(t, "4@test", a.Files[0].Missing[1].Id)
+
+	assert.True(t, a.Files[1].Par2)
+	assert.InDelta(t, 1, a.Files[1].Ratio(), 0.001)
+
+	segments, available := a.Totals()
+	assert.Equal(t, 5, segments)
+	assert.Equal(t, 3, available)
+	assert.False(t, a.Healthy())
+}
+
+func TestScanAvailability_Head(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	checker := mocks.NewMockArticleChecker(ctrl)
+
+	checker.EXPECT().Head(gomock.Any(), gomock.Any()).Return(&nntppool.ArticleHead{}, nil).Times(5)
+
+	a, err := ScanAvailability(context.Background(), checker, availabilityNzb(), ScanOptions{Head: true})
+	require.NoError(t, err)
+	assert.True(t, a.Healthy())
+}
+
+func TestScanAvailability_OtherErrorsAbort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	checker := mocks.NewMockArticleChecker(ctrl)
+
+	boom := errors.New("connection reset")
+	checker.EXPECT().Stat(gomock.Any(), gomock.Any()).Return(nil, boom).AnyTimes()
+
+	_, err := ScanAvailability(context.Background(), checker, availabilityNzb(), ScanOptions{})
+	require.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,73 @@
+package repairnzb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Policies for an output path that already exists, set in output_conflict.
+const (
+	// OutputConflictOverwrite backs the existing file up and replaces it.
+	OutputConflictOverwrite = "overwrite"
+	// OutputConflictVersion writes "name (2).nzb", "name (3).nzb"... instead.
+	OutputConflictVersion = "version"
+)
+
+// backupTimeFormat stamps the names of backups made by BackupExisting.
+const backupTimeFormat = "20060102-150405"
+
+// BackupExisting copies the regular file at path, if there is one, to
+// path.<timestamp>.bak before it is overwritten, so no output ever replaces
+// data without a copy. Symlinks hold no data and are not backed up. It returns
+// the backup path, empty when there was nothing to back up.
+func BackupExisting(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q for backup: %w", path, err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	stamp := time.Now().Format(backupTimeFormat)
+	for i := 1; ; i++ {
+		backup := fmt.Sprintf("%s.%s.bak", path, stamp)
+		if i > 1 {
+			backup = fmt.Sprintf("%s.%s-%d.bak", path, stamp, i)
+		}
+
+		// O_EXCL keeps concurrent backups of the same file from sharing a name.
+		dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create backup of %q: %w", path, err)
+		}
+
+		_, err = io.Copy(dst, src)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(backup)
+			return "", fmt.Errorf("failed to write backup of %q: %w", path, err)
+		}
+
+		return backup, nil
+	}
+}
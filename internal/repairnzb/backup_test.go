@@ -0,0 +1,39 @@
+package repairnzb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "show.nzb")
+
+	backup, err := BackupExisting(path)
+	require.NoError(t, err)
+	assert.Empty(t, backup, "a missing file needs no backup")
+
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0644))
+
+	first, err := BackupExisting(path)
+	require.NoError(t, err)
+	assert.Regexp(t, `show\.nzb\.\d{8}-\d{6}\.bak$`, first)
+	got, err := os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(got))
+
+	second, err := BackupExisting(path)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "backups never overwrite each other")
+	assert.FileExists(t, second)
+
+	link := filepath.Join(dir, "link.nzb")
+	require.NoError(t, os.Symlink(path, link))
+	backup, err = BackupExisting(link)
+	require.NoError(t, err)
+	assert.Empty(t, backup, "symlinks are not backed up")
+}
@@ -0,0 +1,431 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// BundleManifestName is the manifest file of an article bundle.
+const BundleManifestName = "manifest.json"
+
+// bundleArticlesDir holds the article files inside a bundle.
+const bundleArticlesDir = "articles"
+
+// ErrBundleExists is returned when a directory already holds an article bundle.
+var ErrBundleExists = errors.New("directory already holds an article bundle")
+
+// ArticleBundle is an upload pool that writes every posted article as a yEnc
+// article file to a directory instead of posting it, so the repaired segments
+// can be posted later with another tool or account. The manifest lists the
+// articles and the repaired NZB referencing them.
+type ArticleBundle struct {
+	dir string
+
+	mu       sync.Mutex
+	articles []BundleArticle
+}
+
+// BundleManifest describes the content of an article bundle.
+type BundleManifest struct {
+	// NZB is the repaired NZB, relative to the bundle directory. Its segments
+	// reference the message ids of the articles, which exist once posted.
+	NZB       string          `json:"nzb"`
+	CreatedAt time.Time       `json:"created_at"`
+	Articles  []BundleArticle `json:"articles"`
+}
+
+// BundleArticle is an article of a bundle: the file holding it and the
+// headers and yEnc metadata it was encoded with.
+type BundleArticle struct {
+	// File is the article, headers and yEnc body, relative to the bundle
+	// directory.
+	File       string    `json:"file"`
+	MessageID  string    `json:"message_id"`
+	From       string    `json:"from"`
+	Subject    string    `json:"subject"`
+	Newsgroups []string  `json:"newsgroups"`
+	Date       time.Time `json:"date"`
+	FileName   string    `json:"file_name"`
+	FileSize   int64     `json:"file_size"`
+	PartNumber int64     `json:"part_number"`
+	TotalParts int64     `json:"total_parts"`
+	PartSize   int64     `json:"part_size"`
+	// Posted is set once PostBundle posted and verified the article.
+	Posted bool `json:"posted,omitempty"`
+}
+
+// NewArticleBundle creates the article bundle in dir, which must not hold one
+// already.
+func NewArticleBundle(dir string) (*ArticleBundle, error) {
+	if _, err := os.Stat(filepath.Join(dir, BundleManifestName)); err == nil {
+		return nil, fmt.Errorf("%s: %w", dir, ErrBundleExists)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, bundleArticlesDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create article bundle: %w", err)
+	}
+
+	return &ArticleBundle{dir: dir}, nil
+}
+
+// Dir returns the directory of the bundle.
+func (b *ArticleBundle) Dir() string {
+	return b.dir
+}
+
+// PostYenc writes the article to the next article file of the bundle.
+func (b *ArticleBundle) PostYenc(_ context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+	b.mu.Lock()
+	name := filepath.Join(bundleArticlesDir, fmt.Sprintf("%06d.yenc", len(b.articles)+1))
+	b.articles = append(b.articles, BundleArticle{File: name})
+	index := len(b.articles) - 1
+	b.mu.Unlock()
+
+	if err := writeArticle(filepath.Join(b.dir, name), headers, body, meta); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.articles[index] = BundleArticle{
+		File:       filepath.ToSlash(name),
+		MessageID:  headers.MessageID,
+		From:       headers.From,
+		Subject:    headers.Subject,
+		Newsgroups: headers.Newsgroups,
+		Date:       headers.Date,
+		FileName:   meta.FileName,
+		FileSize:   meta.FileSize,
+		PartNumber: meta.PartNumber,
+		TotalParts: meta.TotalParts,
+		PartSize:   meta.PartSize,
+	}
+	b.mu.Unlock()
+
+	return &nntppool.PostResult{}, nil
+}
+
+// writeArticle writes the headers and the yEnc encoded body to path.
+func writeArticle(path string, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create article file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write article file: %w", closeErr)
+		}
+	}()
+
+	if _, err := headers.WriteTo(f); err != nil {
+		return fmt.Errorf("failed to write article headers: %w", err)
+	}
+
+	enc, err := rapidyenc.NewEncoder(f, meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode article: %w", err)
+	}
+
+	if _, err := io.Copy(enc, body); err != nil {
+		return fmt.Errorf("failed to encode article: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode article: %w", err)
+	}
+
+	return nil
+}
+
+// BodyStream fails, nothing can be downloaded from a bundle.
+func (b *ArticleBundle) BodyStream(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+	return nil, errors.New("articles cannot be downloaded from an article bundle")
+}
+
+// Close does nothing, the manifest is written by WriteManifest.
+func (b *ArticleBundle) Close() error {
+	return nil
+}
+
+// Len returns the number of articles written to the bundle.
+func (b *ArticleBundle) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.articles)
+}
+
+// WriteManifest writes the manifest of the bundle, referencing the repaired
+// NZB at nzbPath, which should be inside the bundle directory.
+func (b *ArticleBundle) WriteManifest(nzbPath string) error {
+	rel, err := filepath.Rel(b.dir, nzbPath)
+	if err != nil {
+		return fmt.Errorf("failed to reference nzb in manifest: %w", err)
+	}
+
+	b.mu.Lock()
+	manifest := BundleManifest{
+		NZB:       filepath.ToSlash(rel),
+		CreatedAt: time.Now().UTC(),
+		Articles:  append([]BundleArticle(nil), b.articles...),
+	}
+	b.mu.Unlock()
+
+	return writeManifest(b.dir, &manifest)
+}
+
+// writeManifest writes manifest to the bundle in dir.
+func writeManifest(dir string, manifest *BundleManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, BundleManifestName), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// ReadBundleManifest reads the manifest of the article bundle in dir.
+func ReadBundleManifest(dir string) (*BundleManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// BundlePostResult is the outcome of PostBundle.
+type BundlePostResult struct {
+	// NZB is the path of the NZB of the bundle.
+	NZB string
+	// Posted is the number of articles posted and verified.
+	Posted int
+	// Skipped is the number of articles posted by an earlier run.
+	Skipped int
+	// Reposted is the number of Posted articles that were missing after the
+	// first post and were posted again under a new message id, patched into
+	// the NZB.
+	Reposted int
+}
+
+// PostBundle posts the articles of the bundle in dir through uploadPool,
+// workers at a time, and checks with checker that each one arrived. An
+// article missing after its post is posted once more under a new message id,
+// which replaces the old one in the NZB of the bundle. Posted articles are
+// recorded in the manifest, so a run that failed can be repeated without
+// posting them twice. A nil checker skips the verification.
+func PostBundle(ctx context.Context, dir string, uploadPool NNTPPool, checker ArticleChecker, workers int) (*BundlePostResult, error) {
+	manifest, err := ReadBundleManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BundlePostResult{NZB: filepath.Join(dir, filepath.FromSlash(manifest.NZB))}
+	nzb, layout, err := parseNzb(result.NZB)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		renamed = make(map[string]string)
+	)
+	p := pool.New().WithContext(ctx).WithMaxGoroutines(max(workers, 1))
+	for i := range manifest.Articles {
+		a := &manifest.Articles[i]
+		if a.Posted {
+			result.Skipped++
+			continue
+		}
+
+		p.Go(func(ctx context.Context) error {
+			oldID := a.MessageID
+			reposted, err := postBundleArticle(ctx, dir, a, uploadPool, checker)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// The manifest keeps the new message id even when its post
+			// failed, so the NZB must follow.
+			if reposted {
+				renamed[trimMessageID(oldID)] = trimMessageID(a.MessageID)
+			}
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", a.File, err)
+			}
+
+			a.Posted = true
+			result.Posted++
+			if reposted {
+				result.Reposted++
+			}
+
+			return nil
+		})
+	}
+	postErr := p.Wait()
+
+	if len(renamed) > 0 {
+		patchSegmentIDs(nzb, renamed)
+		if err := writeBundleNzb(result.NZB, nzb, layout); err != nil {
+			return result, err
+		}
+	}
+
+	// Recorded even after a failure, so the next run resumes.
+	if err := writeManifest(dir, manifest); err != nil {
+		return result, err
+	}
+
+	if postErr != nil {
+		return result, fmt.Errorf("failed to post bundle: %w", postErr)
+	}
+
+	return result, nil
+}
+
+// postBundleArticle posts a and checks it arrived, posting it once more under
+// a new message id when it did not. It reports whether the message id of a
+// changed.
+func postBundleArticle(ctx context.Context, dir string, a *BundleArticle, uploadPool NNTPPool, checker ArticleChecker) (bool, error) {
+	data, err := readBundleArticle(filepath.Join(dir, filepath.FromSlash(a.File)))
+	if err != nil {
+		return false, err
+	}
+
+	if err := postArticle(ctx, a, data, uploadPool); err != nil {
+		return false, err
+	}
+
+	if checker == nil {
+		return false, nil
+	}
+
+	if arrived, err := articleArrived(ctx, checker, a.MessageID); err != nil || arrived {
+		return false, err
+	}
+
+	slog.WarnContext(ctx, "Posted article is missing, posting it under a new message id", "file", a.File, "message_id", a.MessageID)
+	a.MessageID = fmt.Sprintf("<%s>", generateRandomMessageID())
+	if err := postArticle(ctx, a, data, uploadPool); err != nil {
+		return true, err
+	}
+
+	arrived, err := articleArrived(ctx, checker, a.MessageID)
+	if err != nil {
+		return true, err
+	}
+	if !arrived {
+		return true, fmt.Errorf("article %s is missing after posting it twice", a.MessageID)
+	}
+
+	return true, nil
+}
+
+// postArticle posts data as the article a describes.
+func postArticle(ctx context.Context, a *BundleArticle, data []byte, uploadPool NNTPPool) error {
+	headers := nntppool.PostHeaders{
+		From:       a.From,
+		Subject:    a.Subject,
+		Newsgroups: a.Newsgroups,
+		MessageID:  a.MessageID,
+		Date:       a.Date,
+	}
+	meta := rapidyenc.Meta{
+		FileName:   a.FileName,
+		FileSize:   a.FileSize,
+		PartSize:   a.PartSize,
+		PartNumber: a.PartNumber,
+		TotalParts: a.TotalParts,
+	}
+
+	if _, err := uploadPool.PostYenc(ctx, headers, bytes.NewReader(data), meta); err != nil {
+		return fmt.Errorf("failed to post article %s: %w", a.MessageID, classifyPostError(err))
+	}
+
+	return nil
+}
+
+// articleArrived reports whether checker finds the article with messageID.
+func articleArrived(ctx context.Context, checker ArticleChecker, messageID string) (bool, error) {
+	_, err := checker.Stat(ctx, trimMessageID(messageID))
+	if errors.Is(err, nntppool.ErrArticleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to verify article %s: %w", messageID, err)
+	}
+
+	return true, nil
+}
+
+// readBundleArticle decodes the yEnc body of the article file at path.
+func readBundleArticle(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read article: %w", err)
+	}
+
+	data, err := io.ReadAll(rapidyenc.NewDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode article: %w", err)
+	}
+
+	return data, nil
+}
+
+// patchSegmentIDs replaces the segment ids of nzb found in renamed.
+func patchSegmentIDs(nzb *nzbparser.Nzb, renamed map[string]string) {
+	for i := range nzb.Files {
+		for j := range nzb.Files[i].Segments {
+			if id, ok := renamed[nzb.Files[i].Segments[j].Id]; ok {
+				nzb.Files[i].Segments[j].Id = id
+			}
+		}
+	}
+}
+
+// writeBundleNzb replaces the NZB at path with nzb, in the layout of the
+// document it was read from.
+func writeBundleNzb(path string, nzb *nzbparser.Nzb, layout nzbLayout) error {
+	b, err := marshalNzb(nzb, layout)
+	if err != nil {
+		return fmt.Errorf("failed to write nzb: %w", err)
+	}
+
+	if _, _, err := writeNzbFile(path, b, OutputConflictOverwrite); err != nil {
+		return fmt.Errorf("failed to write nzb: %w", err)
+	}
+
+	return nil
+}
+
+// trimMessageID strips the angle brackets of a message id, as NZB segments
+// store it.
+func trimMessageID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
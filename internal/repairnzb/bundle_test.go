@@ -0,0 +1,155 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestArticleBundle(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bundle")
+	bundle, err := NewArticleBundle(dir)
+	require.NoError(t, err)
+
+	data := []byte("repaired segment data")
+	headers := nntppool.PostHeaders{
+		From:       "poster@example.com",
+		Subject:    "data.mkv yEnc (1/2)",
+		Newsgroups: []string{"alt.binaries.test"},
+		MessageID:  "<new@test>",
+		Date:       time.Date(2023, 3, 15, 13, 20, 0, 0, time.UTC),
+	}
+	meta := rapidyenc.Meta{FileName: "data.mkv", FileSize: 42, PartSize: int64(len(data)), PartNumber: 1, TotalParts: 2}
+	_, err = bundle.PostYenc(context.Background(), headers, bytes.NewReader(data), meta)
+	require.NoError(t, err)
+	assert.Equal(t, 1, bundle.Len())
+
+	nzbPath := filepath.Join(dir, "release.nzb")
+	require.NoError(t, os.WriteFile(nzbPath, []byte("<nzb/>"), 0644))
+	require.NoError(t, bundle.WriteManifest(nzbPath))
+
+	manifest, err := ReadBundleManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "release.nzb", manifest.NZB)
+	require.Len(t, manifest.Articles, 1)
+	article := manifest.Articles[0]
+	assert.Equal(t, "articles/000001.yenc", article.File)
+	assert.Equal(t, "<new@test>", article.MessageID)
+	assert.Equal(t, []string{"alt.binaries.test"}, article.Newsgroups)
+	assert.Equal(t, int64(1), article.PartNumber)
+	assert.Equal(t, int64(2), article.TotalParts)
+
+	raw, err := os.ReadFile(filepath.Join(dir, article.File))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "Message-ID: <new@test>\r\n")
+
+	decoded, err := io.ReadAll(rapidyenc.NewDecoder(bytes.NewReader(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, data, decoded, "the article body decodes to the segment")
+
+	_, err = NewArticleBundle(dir)
+	assert.ErrorIs(t, err, ErrBundleExists)
+}
+
+// lossyChecker finds every article except those in missing.
+type lossyChecker struct {
+	missing map[string]bool
+}
+
+func (c lossyChecker) Stat(_ context.Context, id string) (*nntppool.StatResult, error) {
+	if c.missing[id] {
+		return nil, nntppool.ErrArticleNotFound
+	}
+
+	return &nntppool.StatResult{}, nil
+}
+
+func (c lossyChecker) Head(context.Context, string) (*nntppool.ArticleHead, error) {
+	return &nntppool.ArticleHead{}, nil
+}
+
+func TestPostBundle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	bundle, err := NewArticleBundle(dir)
+	require.NoError(t, err)
+
+	for _, id := range []string{"<lost@test>", "<kept@test>"} {
+		headers := nntppool.PostHeaders{From: "poster@example.com", Subject: "data.mkv", Newsgroups: []string{"alt.binaries.test"}, MessageID: id}
+		meta := rapidyenc.Meta{FileName: "data.mkv", FileSize: 8, PartSize: 4, PartNumber: 1, TotalParts: 2}
+		_, err = bundle.PostYenc(context.Background(), headers, strings.NewReader("data"), meta)
+		require.NoError(t, err)
+	}
+
+	nzbPath := filepath.Join(dir, "release.nzb")
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="poster@example.com" date="1678886400" subject="[1/1] data.mkv yEnc (1/2)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments>
+   <segment bytes="4" number="1">lost@test</segment>
+   <segment bytes="4" number="2">kept@test</segment>
+  </segments>
+ </file>
+</nzb>`
+	require.NoError(t, os.WriteFile(nzbPath, []byte(nzbContent), 0644))
+	require.NoError(t, bundle.WriteManifest(nzbPath))
+
+	var (
+		mu     sync.Mutex
+		posted []string
+	)
+	uploadPool := mocks.NewMockNNTPPool(ctrl)
+	uploadPool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, headers nntppool.PostHeaders, body io.Reader, _ rapidyenc.Meta) (*nntppool.PostResult, error) {
+			data, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, "data", string(data))
+
+			mu.Lock()
+			posted = append(posted, headers.MessageID)
+			mu.Unlock()
+
+			return &nntppool.PostResult{}, nil
+		}).Times(3)
+
+	result, err := PostBundle(context.Background(), dir, uploadPool, lossyChecker{missing: map[string]bool{"lost@test": true}}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Posted)
+	assert.Equal(t, 1, result.Reposted)
+	assert.Len(t, posted, 3, "the lost article is posted twice")
+
+	manifest, err := ReadBundleManifest(dir)
+	require.NoError(t, err)
+	newID := trimMessageID(manifest.Articles[0].MessageID)
+	assert.NotEqual(t, "lost@test", newID)
+	assert.True(t, manifest.Articles[0].Posted)
+	assert.True(t, manifest.Articles[1].Posted)
+
+	nzb, _, err := parseNzb(nzbPath)
+	require.NoError(t, err)
+	assert.Equal(t, newID, nzb.Files[0].Segments[0].Id, "the nzb references the reposted article")
+	assert.Equal(t, "kept@test", nzb.Files[0].Segments[1].Id)
+
+	// Posted articles are not posted again.
+	result, err = PostBundle(context.Background(), dir, uploadPool, nil, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Zero(t, result.Posted)
+}
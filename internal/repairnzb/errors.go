@@ -0,0 +1,73 @@
+package repairnzb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failure modes of a repair, set in failure_mode.
+const (
+	// FailureModeBestEffort goes on after a failed file download or par2
+	// run and records the failure in RepairResult.Errors.
+	FailureModeBestEffort = "best_effort"
+	// FailureModeStrict fails the repair instead.
+	FailureModeStrict = "strict"
+)
+
+var (
+	// ErrNoPar2 is returned when an NZB, or the temporary directory of a
+	// repair, holds no par2 file to repair the missing data with.
+	ErrNoPar2 = errors.New("no par2 files")
+	// ErrRepairNotPossible is returned when par2 fails to repair the
+	// downloaded files.
+	ErrRepairNotPossible = errors.New("repair not possible")
+	// ErrTooDamaged is returned when more data is missing than the available
+	// recovery blocks can rebuild. It also matches ErrRepairNotPossible.
+	ErrTooDamaged = errors.New("too damaged to repair")
+	// ErrDownloadFailed is returned when a file of the NZB could not be
+	// downloaded for another reason than missing articles.
+	ErrDownloadFailed = errors.New("download failed")
+	// ErrUploadFailed is returned when repaired segments or a recreated par2
+	// set could not be posted.
+	ErrUploadFailed = errors.New("upload failed")
+	// ErrArticleTooLarge is returned when a repaired segment is larger than
+	// the smallest max_article_size of the upload providers. Repaired
+	// segments keep the size of the articles they replace and are never
+	// split. It is wrapped in ErrUploadFailed.
+	ErrArticleTooLarge = errors.New("article too large for the upload providers")
+	// ErrPostRejected is returned when the upload providers rejected a
+	// repaired article (NNTP 441). It is wrapped in ErrUploadFailed.
+	ErrPostRejected = errors.New("article rejected by the upload provider")
+	// ErrPostingNotAllowed is returned when an upload provider does not allow
+	// posting (NNTP 440), e.g. for an account without posting rights. It is
+	// wrapped in ErrUploadFailed.
+	ErrPostingNotAllowed = errors.New("posting not allowed by the upload provider")
+)
+
+// Par2Error is returned by Par2CmdExecutor when par2 exits with an error
+// code. It matches ErrRepairNotPossible and, for the exit codes telling that
+// too few recovery blocks are available, ErrTooDamaged.
+type Par2Error struct {
+	ExitCode int
+	Stderr   string
+}
+
+func (e *Par2Error) Error() string {
+	if msg, ok := par2ExitCodes[e.ExitCode]; ok {
+		return fmt.Sprintf("par2 exited with code %d: %s. Stderr: %s", e.ExitCode, msg, e.Stderr)
+	}
+
+	return fmt.Sprintf("par2 exited with unknown code %d. Stderr: %s", e.ExitCode, e.Stderr)
+}
+
+// Is reports whether the exit code of par2 means target.
+func (e *Par2Error) Is(target error) bool {
+	switch target {
+	case ErrRepairNotPossible:
+		return true
+	case ErrTooDamaged:
+		return e.ExitCode == par2ExitRepairNotPossible || e.ExitCode == par2ExitInsufficientData
+	}
+
+	return false
+}
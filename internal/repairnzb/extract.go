@@ -0,0 +1,126 @@
+package repairnzb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+var (
+	// rarPartRegexp matches the volumes of a new style rar set, whose first
+	// volume is the part numbered 1.
+	rarPartRegexp = regexp.MustCompile(`(?i)\.part(\d+)\.rar$`)
+	// splitRegexp matches the volumes of a split 7z or zip archive, whose
+	// first volume is numbered 1.
+	splitRegexp = regexp.MustCompile(`(?i)\.(?:7z|zip)\.(\d+)$`)
+	// archiveRegexp matches single archives and the first volume of old style
+	// rar sets, whose other volumes are .r00, .r01 and so on.
+	archiveRegexp = regexp.MustCompile(`(?i)\.(?:rar|7z|zip)$`)
+)
+
+// firstVolumes returns the names of the first volume of every archive set
+// among names, sorted. The archiver finds the other volumes next to it.
+func firstVolumes(names []string) []string {
+	var first []string
+	for _, name := range names {
+		if m := rarPartRegexp.FindStringSubmatch(name); m != nil {
+			if strings.TrimLeft(m[1], "0") == "1" {
+				first = append(first, name)
+			}
+			continue
+		}
+		if m := splitRegexp.FindStringSubmatch(name); m != nil {
+			if strings.TrimLeft(m[1], "0") == "1" {
+				first = append(first, name)
+			}
+			continue
+		}
+		if archiveRegexp.MatchString(name) {
+			first = append(first, name)
+		}
+	}
+	slices.Sort(first)
+
+	return first
+}
+
+// extractArchives unpacks every archive set in srcDir into destDir with the
+// 7-Zip executable exe, and returns the first volumes unpacked.
+func extractArchives(ctx context.Context, exe, srcDir, destDir string) ([]string, error) {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files to extract: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	archives := firstVolumes(names)
+	if len(archives) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	for _, archive := range archives {
+		slog.InfoContext(ctx, "Extracting archive", "archive", archive, "dest", destDir)
+
+		var stderr strings.Builder
+		cmd := execCommand(ctx, exe, "x", "-y", "-o"+destDir, filepath.Join(srcDir, archive))
+		cmd.Dir = srcDir
+		cmd.Stderr = &stderr
+		cmd.Stdout = progressWriter{ctx: ctx}
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w: %s", archive, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	return archives, nil
+}
+
+// extractRelease unpacks the archives of a complete release from tmpDir into
+// a folder named after the first NZB. An extraction failure is recorded in
+// the result without failing the repair, whose NZB is fine.
+func (o options) extractRelease(ctx context.Context, cfg config.Config, tmpDir string, nzbFiles []string, outputFile string) {
+	dir := cfg.Extract.Dir
+	if dir == "" {
+		dir = filepath.Dir(nzbFiles[0])
+		if outputFile != "" {
+			dir = filepath.Dir(outputFile)
+		}
+	}
+	base := filepath.Base(nzbFiles[0])
+	dest := filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base)))
+
+	end := o.startPhase(ctx, PhaseExtract)
+	archives, err := extractArchives(ctx, cfg.Extract.Exe, tmpDir, dest)
+	end(err)
+	if err != nil {
+		slog.With("err", err).WarnContext(ctx, "failed to extract the release")
+		o.result.Errors = append(o.result.Errors, err.Error())
+
+		return
+	}
+
+	if len(archives) == 0 {
+		slog.InfoContext(ctx, "No archives found to extract")
+
+		return
+	}
+
+	o.result.ExtractedTo = dest
+	slog.InfoContext(ctx, "Release extracted", "dest", dest, "archives", len(archives))
+}
@@ -0,0 +1,69 @@
+package repairnzb
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstVolumes(t *testing.T) {
+	names := []string{
+		"movie.part01.rar", "movie.part02.rar",
+		"old.rar", "old.r00", "old.r01",
+		"docs.7z.001", "docs.7z.002",
+		"single.zip", "Photos.ZIP",
+		"movie.par2", "movie.vol00+01.par2", "readme.nfo",
+	}
+
+	assert.Equal(t, []string{"Photos.ZIP", "docs.7z.001", "movie.part01.rar", "old.rar", "single.zip"}, firstVolumes(names))
+}
+
+func TestExtractArchives(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "release")
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "movie.part1.rar"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "movie.part2.rar"), nil, 0644))
+
+	var capturedArgs [][]string
+	originalExecCommand := execCommand
+	execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		capturedArgs = append(capturedArgs, args)
+		cs := []string{"-test.run=TestHelperProcess", "--", "echo"}
+		cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+		cmd.Env = append(os.Environ(), "GO_TEST_HELPER_PROCESS=1",
+			"TEST_PAR2_EXIT_CODE=0", "TEST_PAR2_STDOUT=", "TEST_PAR2_STDERR=")
+		return cmd
+	}
+	defer func() { execCommand = originalExecCommand }()
+
+	archives, err := extractArchives(context.Background(), "7z", srcDir, destDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"movie.part1.rar"}, archives)
+	assert.Equal(t, [][]string{{"x", "-y", "-o" + destDir, filepath.Join(srcDir, "movie.part1.rar")}}, capturedArgs)
+	assert.DirExists(t, destDir)
+
+	t.Run("Failure", func(t *testing.T) {
+		execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+			cs := []string{"-test.run=TestHelperProcess", "--", "echo"}
+			cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+			cmd.Env = append(os.Environ(), "GO_TEST_HELPER_PROCESS=1",
+				"TEST_PAR2_EXIT_CODE=2", "TEST_PAR2_STDOUT=", "TEST_PAR2_STDERR=CRC Failed")
+			return cmd
+		}
+
+		_, err := extractArchives(context.Background(), "7z", srcDir, destDir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "CRC Failed")
+	})
+
+	t.Run("No archives", func(t *testing.T) {
+		archives, err := extractArchives(context.Background(), "7z", t.TempDir(), destDir)
+		require.NoError(t, err)
+		assert.Empty(t, archives)
+	})
+}
@@ -0,0 +1,339 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// nzbgetPartialSuffixes are appended by NZBGet to files still being written
+// in its intermediate directory.
+var nzbgetPartialSuffixes = []string{".out.tmp", ".out"}
+
+// nzbgetWrittenCheck is how many bytes at either end of a segment must not
+// all be zero for it to be taken from a file of NZBGet.
+const nzbgetWrittenCheck = 512
+
+// nzbgetDownloadDir returns the folder NZBGet created in interDir for the NZB
+// at nzbPath, named "<nzb name>.#<NZB ID>". With an nzbID, only the folder of
+// that download is returned; without one, that of the latest download of the
+// NZB, the one with the highest ID. It returns "" when there is none.
+func nzbgetDownloadDir(interDir, nzbPath string, nzbID int) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(nzbPath), filepath.Ext(nzbPath))
+
+	entries, err := os.ReadDir(interDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read nzbget intermediate directory: %w", err)
+	}
+
+	dir, latest := "", 0
+	for _, e := range entries {
+		idStr, ok := strings.CutPrefix(e.Name(), name+".#")
+		if !e.IsDir() || !ok {
+			continue
+		}
+
+		id, err := strconv.Atoi(idStr)
+		if err != nil || (nzbID > 0 && id != nzbID) || id <= latest {
+			continue
+		}
+
+		dir, latest = filepath.Join(interDir, e.Name()), id
+	}
+
+	return dir, nil
+}
+
+// nzbgetFiles maps the files NZBGet left in dir back to the files of nzb:
+// finished files keep their name and partial ones have a .out or .out.tmp
+// suffix. A finished file wins over a partial one.
+func nzbgetFiles(dir string, nzb *nzbparser.Nzb) (map[string]string, error) {
+	wanted := make(map[string]bool, len(nzb.Files))
+	for _, f := range nzb.Files {
+		wanted[f.Filename] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nzbget download directory: %w", err)
+	}
+
+	files := make(map[string]string)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		name := e.Name()
+		partial := false
+		for _, suffix := range nzbgetPartialSuffixes {
+			if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+				name, partial = trimmed, true
+				break
+			}
+		}
+
+		if !wanted[name] {
+			continue
+		}
+		if _, found := files[name]; found && partial {
+			continue
+		}
+
+		files[name] = filepath.Join(dir, e.Name())
+	}
+
+	return files, nil
+}
+
+// linkNzbgetFiles links the bytes NZBGet already wrote for the NZB at nzbPath,
+// downloaded with nzbID if not 0, into the reference folder of tmpDir, so
+// par2 takes blocks from them instead of recovering them. It returns the
+// number of files linked.
+func linkNzbgetFiles(interDir, nzbPath string, nzbID int, nzb *nzbparser.Nzb, tmpDir string) (int, error) {
+	dir, err := nzbgetDownloadDir(interDir, nzbPath, nzbID)
+	if err != nil || dir == "" {
+		return 0, err
+	}
+
+	files, err := nzbgetFiles(dir, nzb)
+	if err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for name, path := range files {
+		ok, err := linkReference(path, filepath.Join(tmpDir, referenceDirName, "nzbget_"+name))
+		if err != nil {
+			return linked, fmt.Errorf("failed to link %s: %w", path, err)
+		}
+		if ok {
+			linked++
+		}
+	}
+
+	return linked, nil
+}
+
+// nzbgetSource is a file NZBGet wrote for a download, finished or partial.
+// NZBGet writes every article it decoded at its offset in the file, leaving
+// zeros where articles are missing, so the segments found there are taken
+// from it instead of downloaded again.
+type nzbgetSource struct {
+	f    *os.File
+	size int64
+}
+
+// openNzbgetSources opens the files NZBGet left in interDir for the NZBs at
+// nzbPaths, downloaded with nzbID if not 0, by the name of the file of nzb
+// they hold.
+func openNzbgetSources(interDir string, nzbPaths []string, nzbID int, nzb *nzbparser.Nzb) (map[string]*nzbgetSource, error) {
+	sources := make(map[string]*nzbgetSource)
+	var errs []error
+	for _, nzbPath := range nzbPaths {
+		dir, err := nzbgetDownloadDir(interDir, nzbPath, nzbID)
+		if err != nil || dir == "" {
+			errs = append(errs, err)
+			continue
+		}
+
+		files, err := nzbgetFiles(dir, nzb)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for name, path := range files {
+			f, err := os.Open(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			info, err := f.Stat()
+			if err != nil {
+				_ = f.Close()
+				errs = append(errs, err)
+				continue
+			}
+
+			sources[name] = &nzbgetSource{f: f, size: info.Size()}
+		}
+	}
+
+	return sources, errors.Join(errs...)
+}
+
+// closeNzbgetSources closes the files of sources.
+func closeNzbgetSources(sources map[string]*nzbgetSource) {
+	for _, s := range sources {
+		_ = s.f.Close()
+	}
+}
+
+// part returns the offset and bytes of part number of the total parts of
+// partSize bytes the file was posted in, the last one holding the rest of
+// the file, if NZBGet wrote it: the file holds the part whole and neither of
+// its ends is all zeros. Nothing is returned by a nil source.
+func (s *nzbgetSource) part(number, total int, partSize int64) (int64, []byte, bool) {
+	if s == nil || partSize <= 0 {
+		return 0, nil, false
+	}
+
+	offset := int64(number-1) * partSize
+	size := partSize
+	if number == total {
+		size = s.size - offset
+	}
+	if size <= 0 || size > partSize || offset+size > s.size {
+		return 0, nil, false
+	}
+
+	buf := make([]byte, size)
+	if _, err := s.f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, false
+	}
+
+	check := min(int(size), nzbgetWrittenCheck)
+	if allZero(buf[:check]) || allZero(buf[int(size)-check:]) {
+		return 0, nil, false
+	}
+
+	return offset, buf, true
+}
+
+func allZero(b []byte) bool {
+	return len(bytes.Trim(b, "\x00")) == 0
+}
+
+// nzbgetVerifier checks the segments copied from NZBGet, which came without
+// the CRC of their article, against the slice checksums of the par2 set. The
+// checksums are downloaded once, for the first file with such segments.
+type nzbgetVerifier struct {
+	pool     NNTPPool
+	parFiles []nzbparser.NzbFile
+	store    SegmentStore
+	stateDir string
+
+	sums   *par2Checksums
+	loaded bool
+}
+
+// check checks the segments of file copied from NZBGet. A segment is vouched
+// for when every par2 slice it overlaps matches its checksum; the others, and
+// all of them when the par2 set cannot be read, are marked pending in the
+// download state so that downloading file again downloads them. It returns
+// the number of segments marked pending.
+func (v *nzbgetVerifier) check(ctx context.Context, file nzbparser.NzbFile, copied []segmentCheck) (int, error) {
+	if !v.loaded {
+		sums, err := readPar2Checksums(ctx, v.pool, v.parFiles)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+
+			slog.With("err", err).WarnContext(ctx, "failed to read par2 checksums, downloading the segments taken from nzbget")
+		}
+		v.sums, v.loaded = sums, true
+	}
+
+	untrusted := copied
+	if v.sums != nil {
+		var err error
+		if untrusted, err = v.sums.mismatches(v.store, file.Filename, copied); err != nil {
+			return 0, err
+		}
+	}
+	if len(untrusted) == 0 {
+		return 0, nil
+	}
+
+	ordered := segmentsInOrder(file)
+	state, _, err := loadSegmentState(v.stateDir, file.Filename, ordered)
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, fmt.Errorf("no download state of %s", file.Filename)
+	}
+	defer func() { _ = state.close() }()
+
+	index := make(map[string]int, len(ordered))
+	for i, s := range ordered {
+		index[s.Id] = i
+	}
+
+	for _, c := range untrusted {
+		if err := state.markPending(index[c.segment.Id]); err != nil {
+			return 0, fmt.Errorf("failed to record segment %d: %w", c.segment.Number, err)
+		}
+	}
+
+	return len(untrusted), nil
+}
+
+// mismatches returns the segments of the file name of store among cs that
+// overlap a slice not matching its checksum, or all of them when the file is
+// not in the set.
+func (p *par2Checksums) mismatches(store SegmentStore, name string, cs []segmentCheck) ([]segmentCheck, error) {
+	sums, ok := p.files[name]
+	if !ok {
+		return cs, nil
+	}
+
+	f, err := store.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, p.sliceSize)
+	matches := make(map[int64]bool)
+	var untrusted []segmentCheck
+	for _, c := range cs {
+		trusted := c.size > 0
+		for k := c.offset / p.sliceSize; trusted && k <= (c.offset+int64(c.size)-1)/p.sliceSize; k++ {
+			match, seen := matches[k]
+			if !seen {
+				if match, err = p.sliceMatches(f, buf, sums, k); err != nil {
+					return nil, err
+				}
+				matches[k] = match
+			}
+			trusted = match
+		}
+
+		if !trusted {
+			untrusted = append(untrusted, c)
+		}
+	}
+
+	return untrusted, nil
+}
+
+// sliceMatches reports whether slice k of f matches its checksum in sums.
+func (p *par2Checksums) sliceMatches(f io.ReaderAt, buf []byte, sums par2FileChecksums, k int64) (bool, error) {
+	offset := k * p.sliceSize
+	if k >= int64(len(sums.crcs)) || offset >= sums.size {
+		return false, nil
+	}
+
+	// The last slice is padded with zeros.
+	clear(buf)
+	n := min(p.sliceSize, sums.size-offset)
+	if _, err := f.ReadAt(buf[:n], offset); err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	return crc32.ChecksumIEEE(buf) == sums.crcs[k], nil
+}
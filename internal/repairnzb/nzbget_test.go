@@ -0,0 +1,233 @@
+package repairnzb
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLinkNzbgetFiles(t *testing.T) {
+	interDir := t.TempDir()
+	dir := filepath.Join(interDir, "Show.S01E01.#42")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(interDir, "Other.#43"), 0755))
+	for _, name := range []string{"show.mkv.out.tmp", "show.r00", "show.r00.out", "show.nfo.out", "_brokenlog.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{{Filename: "show.mkv"}, {Filename: "show.r00"}, {Filename: "show.par2"}}}
+
+	files, err := nzbgetFiles(dir, nzb)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"show.mkv": filepath.Join(dir, "show.mkv.out.tmp"),
+		"show.r00": filepath.Join(dir, "show.r00"),
+	}, files, "finished files win over partial ones and unknown files are ignored")
+
+	tmpDir := t.TempDir()
+	linked, err := linkNzbgetFiles(interDir, "/watch/Show.S01E01.nzb", 0, nzb, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, linked)
+	assert.Len(t, referenceFiles(tmpDir), 2)
+
+	linked, err = linkNzbgetFiles(interDir, "/watch/Unknown.nzb", 0, nzb, t.TempDir())
+	require.NoError(t, err)
+	assert.Zero(t, linked, "nzbs nzbget never downloaded have nothing to reuse")
+}
+
+func TestNzbgetDownloadDir(t *testing.T) {
+	interDir := t.TempDir()
+	for _, name := range []string{"Show.#7", "Show.#12", "Show.#9", "Show.Extra.#20", "Show.#tmp"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(interDir, name), 0755))
+	}
+
+	dir, err := nzbgetDownloadDir(interDir, "/watch/Show.nzb", 9)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(interDir, "Show.#9"), dir, "the folder of the NZB ID")
+
+	dir, err = nzbgetDownloadDir(interDir, "/watch/Show.nzb", 0)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(interDir, "Show.#12"), dir, "without an NZB ID, the latest download")
+
+	dir, err = nzbgetDownloadDir(interDir, "/watch/Show.nzb", 8)
+	require.NoError(t, err)
+	assert.Empty(t, dir)
+}
+
+func TestDownloadWorker_Nzbget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	segment := func(begin int64, data string) func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+		return func(_ context.Context, _ string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			for _, f := range onMeta {
+				f(nntppool.YEncMeta{PartBegin: begin, PartSize: int64(len(data))})
+			}
+			_, err := w.Write([]byte(data))
+
+			return &nntppool.ArticleBody{}, err
+		}
+	}
+
+	// NZBGet wrote the second and fourth parts of a file it preallocated and
+	// is missing the third.
+	file := nzbparser.NzbFile{Filename: "show.mkv", TotalSegments: 4, Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"}, {Number: 4, Id: "4@test"},
+	}}
+	out := filepath.Join(t.TempDir(), "show.mkv.out.tmp")
+	require.NoError(t, os.WriteFile(out, []byte("\x00\x00\x00\x00bbbb\x00\x00\x00\x00dd"), 0644))
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	source := &nzbgetSource{f: f, size: 14}
+
+	pool.EXPECT().BodyStream(gomock.Any(), "1@test", gomock.Any(), gomock.Any()).DoAndReturn(segment(0, "aaaa")).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "3@test", gomock.Any(), gomock.Any()).DoAndReturn(segment(8, "cccc")).Times(1)
+
+	tmpDir := t.TempDir()
+	segments, _, err := downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, nil, nil, DiskStore{Dir: tmpDir}, filepath.Join(tmpDir, stateDirName), source)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), segments)
+
+	b, err := os.ReadFile(filepath.Join(tmpDir, file.Filename))
+	require.NoError(t, err)
+	assert.Equal(t, "aaaabbbbccccdd", string(b))
+}
+
+// failingStore is a memoryStore whose files fail to be written at failAt.
+type failingStore struct {
+	*memoryStore
+	failAt int64
+}
+
+func (s failingStore) Create(name string) (SegmentFile, error) {
+	f, err := s.memoryStore.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return failingFile{SegmentFile: f, failAt: s.failAt}, nil
+}
+
+type failingFile struct {
+	SegmentFile
+	failAt int64
+}
+
+func (f failingFile) WriteAt(p []byte, off int64) (int, error) {
+	if off == f.failAt {
+		return 0, errors.New("disk full")
+	}
+
+	return f.SegmentFile.WriteAt(p, off)
+}
+
+func TestDownloadWorker_NzbgetWriteFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	// NZBGet wrote the third part, which fails to be copied while the
+	// second is still being downloaded.
+	file := nzbparser.NzbFile{Filename: "show.mkv", TotalSegments: 3, Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"},
+	}}
+	out := filepath.Join(t.TempDir(), "show.mkv.out.tmp")
+	require.NoError(t, os.WriteFile(out, []byte("\x00\x00\x00\x00\x00\x00\x00\x00cc"), 0644))
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	source := &nzbgetSource{f: f, size: 10}
+
+	pool.EXPECT().BodyStream(gomock.Any(), "1@test", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, w io.Writer, onMeta ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write([]byte("aaaa"))
+
+			return &nntppool.ArticleBody{}, err
+		}).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "2@test", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			time.Sleep(20 * time.Millisecond)
+
+			return nil, nntppool.ErrArticleNotFound
+		}).Times(1)
+
+	brokenSegmentCh := make(chan brokenSegment, 3)
+	store := failingStore{memoryStore: newMemoryStore(), failAt: 8}
+	_, _, err = downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, brokenSegmentCh, nil, nil, store, "", source)
+	require.ErrorContains(t, err, "disk full")
+
+	// The segment being downloaded was reported before the worker returned.
+	close(brokenSegmentCh)
+	assert.Len(t, brokenSegmentCh, 1)
+}
+
+func TestNzbgetVerifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	write := func(data []byte, crc uint32) func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+		return func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(data)
+
+			return &nntppool.ArticleBody{ExpectedCRC: crc}, err
+		}
+	}
+
+	// NZBGet wrote the second part right and the third one wrong.
+	file := nzbparser.NzbFile{Filename: "show.mkv", TotalSegments: 3, Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"},
+	}}
+	out := filepath.Join(t.TempDir(), "show.mkv.out.tmp")
+	require.NoError(t, os.WriteFile(out, []byte("\x00\x00\x00\x00bbbbcXcc"), 0644))
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	source := &nzbgetSource{f: f, size: 12}
+
+	par2 := nzbparser.NzbFile{Filename: "show.par2", Segments: nzbparser.NzbSegments{{Number: 1, Id: "par@test"}}}
+	index := append(mainPacket(4), fileChecksumPackets(1, "show.mkv", []byte("aaaabbbbcccc"), 4)...)
+
+	pool.EXPECT().BodyStream(gomock.Any(), "1@test", gomock.Any(), gomock.Any()).DoAndReturn(write([]byte("aaaa"), crc32.ChecksumIEEE([]byte("aaaa")))).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "par@test", gomock.Any()).DoAndReturn(write(index, 0)).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "3@test", gomock.Any(), gomock.Any()).DoAndReturn(write([]byte("cccc"), crc32.ChecksumIEEE([]byte("cccc")))).Times(1)
+
+	tmpDir := t.TempDir()
+	store := DiskStore{Dir: tmpDir}
+	stateDir := filepath.Join(tmpDir, stateDirName)
+	checks := &downloadChecks{}
+	_, _, err = downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, checks, nil, store, stateDir, source)
+	require.NoError(t, err)
+	require.Len(t, checks.copied, 2)
+
+	v := &nzbgetVerifier{pool: pool, parFiles: []nzbparser.NzbFile{par2}, store: store, stateDir: stateDir}
+	pending, err := v.check(context.Background(), file, checks.copied)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pending, "the third part does not match par2")
+
+	// Downloading the file again downloads the third part only.
+	_, _, err = downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, nil, nil, store, stateDir, nil)
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(tmpDir, file.Filename))
+	require.NoError(t, err)
+	assert.Equal(t, "aaaabbbbcccc", string(b))
+
+	// Without par2 checksums, none of the copied segments is vouched for.
+	v = &nzbgetVerifier{pool: pool, store: store, stateDir: stateDir}
+	pending, err = v.check(context.Background(), file, checks.copied)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pending)
+}
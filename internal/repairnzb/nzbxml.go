@@ -0,0 +1,161 @@
+package repairnzb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// xmlNzb is the document of an NZB, laid out like nzbparser writes it.
+type xmlNzb struct {
+	Comment string             `xml:",comment"`
+	XMLName xml.Name           `xml:"nzb"`
+	Xmlns   string             `xml:"xmlns,attr"`
+	Meta    []xmlNzbMeta       `xml:"head>meta"`
+	Files   nzbparser.NzbFiles `xml:"file"`
+}
+
+type xmlNzbMeta struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",innerxml"`
+}
+
+// xmlNzbLayout is the order of the meta and file elements of an NZB
+// document.
+type xmlNzbLayout struct {
+	Meta []struct {
+		Type string `xml:"type,attr"`
+	} `xml:"head>meta"`
+	Files []struct {
+		Subject string `xml:"subject,attr"`
+	} `xml:"file"`
+}
+
+// nzbLayout is what marshalNzb needs of the document an NZB was read from:
+// the order of its meta and the document itself, written back as it was read
+// while the NZB is not changed.
+type nzbLayout struct {
+	metaOrder []string
+	source    []byte
+}
+
+// parseNzb reads and parses the NZB at path. nzbparser sorts the files by
+// the number in their subject and keeps the meta in a map, so the files are
+// put back in the order of the document and the layout of the document is
+// returned, for marshalNzb to keep it.
+func parseNzb(path string) (*nzbparser.Nzb, nzbLayout, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nzbLayout{}, err
+	}
+
+	return parseNzbContent(content)
+}
+
+// parseNzbContent parses the NZB document content like parseNzb.
+func parseNzbContent(content []byte) (*nzbparser.Nzb, nzbLayout, error) {
+	nzb, err := nzbparser.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, nzbLayout{}, err
+	}
+
+	// A document nzbparser reads but the layout decoder does not, like one
+	// in another charset, keeps the order of nzbparser.
+	var layout xmlNzbLayout
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+	if err := decoder.Decode(&layout); err != nil {
+		return nzb, nzbLayout{source: content}, nil
+	}
+
+	positions := make(map[string]int, len(layout.Files))
+	for i, f := range layout.Files {
+		if _, ok := positions[f.Subject]; !ok {
+			positions[f.Subject] = i
+		}
+	}
+	slices.SortStableFunc(nzb.Files, func(a, b nzbparser.NzbFile) int {
+		return positions[a.Subject] - positions[b.Subject]
+	})
+
+	metaOrder := make([]string, 0, len(layout.Meta))
+	for _, m := range layout.Meta {
+		if !slices.Contains(metaOrder, m.Type) {
+			metaOrder = append(metaOrder, m.Type)
+		}
+	}
+
+	return nzb, nzbLayout{metaOrder: metaOrder, source: content}, nil
+}
+
+// marshalNzb writes nzb as nzbparser does, but deterministically: the files
+// keep their order, the meta follow the order of layout, with any other meta
+// after them by type, and the comment is not padded again. An NZB that was
+// not changed since its document was read is written byte for byte as it was
+// read, whatever tool wrote it; a changed one is indented and escaped the way
+// encoding/xml does it.
+func marshalNzb(nzb *nzbparser.Nzb, layout nzbLayout) ([]byte, error) {
+	b, err := marshalNzbDocument(nzb, layout.metaOrder)
+	if err != nil || layout.source == nil {
+		return b, err
+	}
+
+	read, readLayout, err := parseNzbContent(layout.source)
+	if err != nil {
+		return b, nil
+	}
+	if unchanged, err := marshalNzbDocument(read, readLayout.metaOrder); err == nil && bytes.Equal(unchanged, b) {
+		return layout.source, nil
+	}
+
+	return b, nil
+}
+
+// marshalNzbDocument writes nzb as marshalNzb writes a changed NZB.
+func marshalNzbDocument(nzb *nzbparser.Nzb, metaOrder []string) ([]byte, error) {
+	doc := xmlNzb{
+		Xmlns: nzbparser.Xmlns,
+		Files: nzb.Files,
+	}
+	if comment := strings.TrimSpace(nzb.Comment); comment != "" {
+		doc.Comment = " " + comment + " "
+	}
+
+	types := make([]string, 0, len(nzb.Meta))
+	for t := range nzb.Meta {
+		if !slices.Contains(metaOrder, t) {
+			types = append(types, t)
+		}
+	}
+	slices.Sort(types)
+	for _, t := range append(slices.Clone(metaOrder), types...) {
+		if v, ok := nzb.Meta[t]; ok {
+			doc.Meta = append(doc.Meta, xmlNzbMeta{Type: t, Value: v})
+		}
+	}
+
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nzbparser.Header), b...), nil
+}
+
+// merge returns the layout of the NZB merged from those of l and other: the
+// meta types of other not in l yet follow those of l, and the merged NZB has
+// no document to write back.
+func (l nzbLayout) merge(other nzbLayout) nzbLayout {
+	merged := nzbLayout{metaOrder: slices.Clone(l.metaOrder)}
+	for _, t := range other.metaOrder {
+		if !slices.Contains(merged.metaOrder, t) {
+			merged.metaOrder = append(merged.metaOrder, t)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,139 @@
+package repairnzb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canonicalNzb lists its files and meta in another order than nzbparser
+// sorts them in.
+const canonicalNzb = `<?xml version="1.0" encoding="utf-8" ?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <!-- posted by test -->
+  <head>
+    <meta type="title">Show</meta>
+    <meta type="password">secret</meta>
+    <meta type="category">TV</meta>
+  </head>
+  <file poster="poster@example.com" date="1700000000" subject="[2/2] - &#34;show.par2&#34; yEnc (1/1)">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="700" number="1">par@test</segment>
+    </segments>
+  </file>
+  <file poster="poster@example.com" date="1700000000" subject="[1/2] - &#34;show.mkv&#34; yEnc (1/2)">
+    <groups>
+      <group>alt.binaries.test</group>
+      <group>alt.binaries.misc</group>
+    </groups>
+    <segments>
+      <segment bytes="10000" number="1">1@test</segment>
+      <segment bytes="5000" number="2">2@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+func TestMarshalNzb_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "show.nzb")
+	require.NoError(t, os.WriteFile(path, []byte(canonicalNzb), 0644))
+
+	nzb, layout, err := parseNzb(path)
+	require.NoError(t, err)
+	assert.Equal(t, "show.par2", nzb.Files[0].Filename, "the files keep the order of the document")
+	assert.Equal(t, []string{"title", "password", "category"}, layout.metaOrder)
+
+	// The meta map is walked in another order every time.
+	for range 10 {
+		b, err := marshalNzbDocument(nzb, layout.metaOrder)
+		require.NoError(t, err)
+		require.Equal(t, canonicalNzb, string(b))
+	}
+}
+
+// nyuuNzb is an NZB as the Nyuu poster writes it: indented with tabs, quotes
+// escaped as &quot; and the size of the file after the subject.
+const nyuuNzb = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+	<head>
+		<meta type="title">Show.S01E01.1080p.WEB.h264</meta>
+		<meta type="password">secret</meta>
+	</head>
+	<file poster="Nyuu &lt;nyuu@example.com&gt;" date="1700000000" subject="[1/2] - &quot;show.s01e01.mkv&quot; yEnc (1/3) 1887436">
+		<groups>
+			<group>alt.binaries.test</group>
+		</groups>
+		<segments>
+			<segment bytes="739730" number="1">OvVaEvRjXxQdMkYwKtFbHnZs-1700000000000@nyuu</segment>
+			<segment bytes="739715" number="2">PcWtLgUoBaJrIeNyDhSmQfXv-1700000000001@nyuu</segment>
+			<segment bytes="445012" number="3">KzRbTnYuGcHwEsVoAqLiMjPd-1700000000002@nyuu</segment>
+		</segments>
+	</file>
+	<file poster="Nyuu &lt;nyuu@example.com&gt;" date="1700000001" subject="[2/2] - &quot;show.s01e01.par2&quot; yEnc (1/1) 42884">
+		<groups>
+			<group>alt.binaries.test</group>
+		</groups>
+		<segments>
+			<segment bytes="44220" number="1">XhGfSbDeWqTyUiOpLkJmNcVa-1700000000003@nyuu</segment>
+		</segments>
+	</file>
+</nzb>
+`
+
+func TestMarshalNzb_PosterFormatting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "show.nzb")
+	require.NoError(t, os.WriteFile(path, []byte(nyuuNzb), 0644))
+
+	nzb, layout, err := parseNzb(path)
+	require.NoError(t, err)
+
+	b, err := marshalNzb(nzb, layout)
+	require.NoError(t, err)
+	assert.Equal(t, nyuuNzb, string(b), "an unchanged NZB is written byte for byte as it was read")
+
+	nzb.Files[0].Segments[1].Id = "replaced@test"
+	changed, err := marshalNzb(nzb, layout)
+	require.NoError(t, err)
+	assert.Contains(t, string(changed), "\n      <segment bytes=\"739715\" number=\"2\">replaced@test</segment>")
+
+	// A written NZB reads back and, even without its document, writes out
+	// byte for byte the same.
+	written := filepath.Join(dir, "written.nzb")
+	require.NoError(t, os.WriteFile(written, changed, 0644))
+
+	nzb, layout, err = parseNzb(written)
+	require.NoError(t, err)
+	layout.source = nil
+	again, err := marshalNzb(nzb, layout)
+	require.NoError(t, err)
+	assert.Equal(t, string(changed), string(again))
+}
+
+func TestMarshalNzb_OtherMeta(t *testing.T) {
+	nzb := &nzbparser.Nzb{
+		Comment: "  padded  ",
+		Meta:    map[string]string{"title": "Show", "tag": "b", "category": "TV"},
+	}
+
+	b, err := marshalNzb(nzb, nzbLayout{metaOrder: []string{"title", "password"}})
+	require.NoError(t, err)
+
+	out := string(b)
+	assert.Contains(t, out, "<!-- padded -->")
+	title := strings.Index(out, `type="title"`)
+	category := strings.Index(out, `type="category"`)
+	tag := strings.Index(out, `type="tag"`)
+	assert.Less(t, title, category, "meta in the order come first")
+	assert.Less(t, category, tag, "other meta follow by type")
+	assert.NotContains(t, out, "password")
+}
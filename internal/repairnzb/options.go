@@ -0,0 +1,224 @@
+package repairnzb
+
+import (
+	"context"
+	"time"
+
+	"github.com/javi11/nzb-repair/internal/events"
+)
+
+// Repair phases reported through phase events.
+const (
+	PhaseDownload     = "download"
+	PhaseVerify       = "verify"
+	PhasePar2Check    = "par2_check"
+	PhasePar2Repair   = "par2_repair"
+	PhaseUpload       = "upload"
+	PhasePar2Recreate = "par2_recreate"
+	PhaseWriteOutput  = "write_output"
+	PhaseExtract      = "extract"
+)
+
+// Option configures optional behaviour of RepairNzb.
+type Option func(*options)
+
+type options struct {
+	events   events.Publisher
+	result   *RepairResult
+	progress func()
+	reporter ProgressReporter
+	sink     OutputSink
+	store    SegmentStore
+	noUpload bool
+	dryRun   bool
+	nzbgetID int
+}
+
+// RepairResult describes the outcome of a repair. It is returned even when
+// the repair fails, with what was done until then.
+type RepairResult struct {
+	// OutputPath is where the repaired NZB was stored. It differs from the
+	// requested output file when the fallback output directory was used, a
+	// new version was written or the output sink is not local.
+	OutputPath string
+	// OutputFallback is set when the repaired NZB was written to the fallback
+	// output directory.
+	OutputFallback bool
+	// Healthy is set when every data segment was available and the par2 set
+	// needed no recreation, so nothing was uploaded and no NZB was written.
+	Healthy bool
+	// Verdict is VerdictHealthy for healthy NZBs, VerdictRepairable once the
+	// broken segments were repaired, VerdictUnrepairable when par2 could not
+	// repair them and VerdictUnknown when the repair stopped before.
+	Verdict Verdict
+	// NotUploaded is set when the release was damaged but nothing was
+	// uploaded because of WithoutUpload.
+	NotUploaded bool
+	// DryRun is set when par2 only verified the files, because of
+	// WithDryRun. NotUploaded is set too.
+	DryRun bool
+	// Par2Recreate is set when enough par2 segments were missing for the
+	// par2 set to be recreated, even if it was not because nothing is
+	// uploaded.
+	Par2Recreate bool
+	// SegmentsChecked is the number of data segments downloaded or found
+	// missing.
+	SegmentsChecked int
+	// SegmentsMissing is the number of data segments the providers did not
+	// have.
+	SegmentsMissing int
+	// SegmentsReplaced is the number of data segments uploaded again.
+	SegmentsReplaced int
+	// BrokenSegments is the number of data segments that were missing or
+	// corrupt and were repaired.
+	BrokenSegments int
+	// CorruptSegments is the number of BrokenSegments that were downloaded
+	// but failed CRC verification.
+	CorruptSegments int
+	// Damage lists the broken segments per file.
+	Damage []FileDamage
+	// BytesDownloaded and BytesUploaded are the decoded bytes of the data and
+	// par2 articles transferred.
+	BytesDownloaded int64
+	BytesUploaded   int64
+	// Phases lists the phases run, in order, with how long they took.
+	Phases []PhaseTiming
+	// BackupPath is the timestamped copy of the file that the repaired NZB
+	// replaced, empty when nothing was overwritten.
+	BackupPath string
+	// ExtractedTo is the folder the archives of the release were unpacked
+	// into, empty when extraction is disabled or found no archive.
+	ExtractedTo string
+	// Errors lists the failed file downloads and par2 runs the repair went on
+	// despite, with FailureModeBestEffort.
+	Errors []string
+}
+
+// PhaseTiming is how long a repair phase took.
+type PhaseTiming struct {
+	Phase    string
+	Duration time.Duration
+	// Error is set when the phase failed.
+	Error string
+}
+
+// Duration returns the total time spent in phase.
+func (r *RepairResult) Duration(phase string) time.Duration {
+	var d time.Duration
+	for _, p := range r.Phases {
+		if p.Phase == phase {
+			d += p.Duration
+		}
+	}
+
+	return d
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		events: events.Discard,
+		result: &RepairResult{Verdict: VerdictUnknown},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithEvents publishes the start and end of every repair phase to p.
+func WithEvents(p events.Publisher) Option {
+	return func(o *options) {
+		if p != nil {
+			o.events = p
+		}
+	}
+}
+
+// WithoutUpload only reports the health of the release: broken segments are
+// repaired locally with par2 to find out whether the release is repairable,
+// but nothing is uploaded and no NZB is written.
+func WithoutUpload() Option {
+	return func(o *options) {
+		o.noUpload = true
+	}
+}
+
+// WithDryRun only reports the damage of the release and whether it can be
+// repaired: par2 verifies the downloaded files without repairing them,
+// nothing is uploaded and no NZB is written.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.noUpload = true
+		o.dryRun = true
+	}
+}
+
+// WithNzbgetID reuses the files of the download with NZB ID id in the
+// InterDir of NZBGet, rather than those of the latest download of the NZB.
+func WithNzbgetID(id int) Option {
+	return func(o *options) {
+		o.nzbgetID = id
+	}
+}
+
+// WithProgress calls fn whenever the repair advances: a phase starts or ends,
+// a segment is downloaded, checked or uploaded, or par2 prints output. fn is
+// called concurrently and must be cheap.
+func WithProgress(fn func()) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+type progressKey struct{}
+
+// withProgress returns a context carrying fn for reportProgress, so code
+// below RepairNzb, such as the par2 executor, can report progress.
+func withProgress(ctx context.Context, fn func()) context.Context {
+	if fn == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress calls the progress function of ctx, if any.
+func reportProgress(ctx context.Context) {
+	if fn, ok := ctx.Value(progressKey{}).(func()); ok {
+		fn()
+	}
+}
+
+// progressWriter reports progress on every write, for command output that is
+// otherwise discarded.
+type progressWriter struct {
+	ctx context.Context
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	reportProgress(w.ctx)
+
+	return len(p), nil
+}
+
+// startPhase publishes a PhaseStarted event and returns a function that
+// publishes the matching PhaseFinished event and records the phase in the
+// result.
+func (o options) startPhase(ctx context.Context, phase string) func(err error) {
+	started := time.Now()
+	reportProgress(ctx)
+	o.events.Publish(ctx, events.Event{Type: events.PhaseStarted, Phase: phase})
+
+	return func(err error) {
+		reportProgress(ctx)
+		e := events.Event{Type: events.PhaseFinished, Phase: phase, Duration: time.Since(started)}
+		if err != nil {
+			e.Error = err.Error()
+		}
+
+		o.result.Phases = append(o.result.Phases, PhaseTiming{Phase: phase, Duration: e.Duration, Error: e.Error})
+		o.events.Publish(ctx, e)
+	}
+}
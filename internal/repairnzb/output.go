@@ -0,0 +1,71 @@
+package repairnzb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+)
+
+// OutputSink stores repaired NZBs. RepairNzb writes to a LocalSink built from
+// the config unless WithOutputSink sets another one.
+type OutputSink interface {
+	// WriteNzb stores nzb, the serialized repaired NZB whose output path is
+	// path, and returns where it was stored.
+	WriteNzb(ctx context.Context, path string, nzb []byte) (StoredNzb, error)
+}
+
+// StoredNzb is where an OutputSink stored a repaired NZB.
+type StoredNzb struct {
+	// Location is the path, URL or downloader id of the stored NZB.
+	Location string
+	// BackupPath is the timestamped copy of the file the NZB replaced, empty
+	// when nothing was overwritten.
+	BackupPath string
+	// Fallback is set when the NZB could not be stored at its output path and
+	// was written to the fallback output directory instead.
+	Fallback bool
+}
+
+// WithOutputSink stores the repaired NZB in s instead of writing it to the
+// output path. A nil s keeps the default.
+func WithOutputSink(s OutputSink) Option {
+	return func(o *options) {
+		if s != nil {
+			o.sink = s
+		}
+	}
+}
+
+// LocalSink writes repaired NZBs to their output path, creating its
+// directory if needed.
+type LocalSink struct {
+	// Conflict is OutputConflictOverwrite or OutputConflictVersion.
+	Conflict string
+	// FallbackDir receives the NZB when writing it to its output path fails.
+	// Empty disables it.
+	FallbackDir string
+}
+
+// WriteNzb writes nzb to path or, when that fails, to the fallback
+// directory.
+func (s *LocalSink) WriteNzb(ctx context.Context, path string, nzb []byte) (StoredNzb, error) {
+	written, backup, err := writeNzbFile(path, nzb, s.Conflict)
+	if err == nil {
+		return StoredNzb{Location: written, BackupPath: backup}, nil
+	}
+
+	if s.FallbackDir == "" {
+		return StoredNzb{}, err
+	}
+
+	fallbackPath := filepath.Join(s.FallbackDir, filepath.Base(path))
+	slog.With("err", err).WarnContext(ctx, "failed to write repaired nzb file, using fallback output directory", "path", path, "fallback", fallbackPath)
+
+	written, backup, fallbackErr := writeNzbFile(fallbackPath, nzb, s.Conflict)
+	if fallbackErr != nil {
+		return StoredNzb{}, fmt.Errorf("failed to write %s: %w; fallback %s: %w", path, err, fallbackPath, fallbackErr)
+	}
+
+	return StoredNzb{Location: written, BackupPath: backup, Fallback: true}, nil
+}
@@ -14,10 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/Tensai75/nzbparser"
-	"github.com/schollz/progressbar/v3"
 )
 
 // Allow mocking exec.CommandContext in tests
@@ -26,12 +24,35 @@ var execCommand = exec.CommandContext
 // Par2Executor defines the interface for executing par2 commands.
 type Par2Executor interface {
 	Repair(ctx context.Context, tmpPath string) error
+	// Verify checks the files in tmpPath against the par2 set without
+	// changing them. It returns nil when they are complete or repairable.
+	Verify(ctx context.Context, tmpPath string) error
 	// Create generates a new par2 set for all non-par2 files in tmpPath.
-	// redundancy is the recovery percentage (e.g. 10 = 10%).
+	// redundancy is the recovery percentage (e.g. 10 = 10%). blockCount is
+	// the number of source blocks the files are split into and blockSize the
+	// size of a block in bytes, a multiple of 4; par2 accepts one of them and
+	// chooses when both are 0.
 	// Returns absolute paths of all generated .par2 files.
-	Create(ctx context.Context, tmpPath string, redundancy int) ([]string, error)
+	Create(ctx context.Context, tmpPath string, redundancy, blockCount int, blockSize int64) ([]string, error)
 }
 
+// par2CreateArgs returns the par2 create flags sizing the recovery data.
+func par2CreateArgs(redundancy, blockCount int, blockSize int64) []string {
+	args := []string{fmt.Sprintf("-r%d", redundancy)}
+	if blockCount > 0 {
+		args = append(args, fmt.Sprintf("-b%d", blockCount))
+	}
+	if blockSize > 0 {
+		args = append(args, fmt.Sprintf("-s%d", blockSize))
+	}
+
+	return args
+}
+
+// Par2StderrFile is the file in the temporary directory that receives the
+// stderr of a failed par2 run, so it survives in kept temporary directories.
+const Par2StderrFile = "par2.stderr.log"
+
 // Par2CmdExecutor implements Par2Executor using the command line.
 type Par2CmdExecutor struct {
 	ExePath string
@@ -54,6 +75,32 @@ var (
 	}
 )
 
+// par2TargetFound matches the line par2 prints for a file that verifies,
+// before the repair for intact files and after it for repaired ones.
+var par2TargetFound = regexp.MustCompile(`^Target: "(.+)" - found\.$`)
+
+type repairedFileKey struct{}
+
+// withRepairedFile makes Par2CmdExecutor.Repair call fn with the name of
+// every file par2 reports complete, while it still works on the others.
+func withRepairedFile(ctx context.Context, fn func(name string)) context.Context {
+	return context.WithValue(ctx, repairedFileKey{}, fn)
+}
+
+// reportRepairedFile passes name to the function of withRepairedFile, if any.
+func reportRepairedFile(ctx context.Context, name string) {
+	if fn, ok := ctx.Value(repairedFileKey{}).(func(name string)); ok {
+		fn(name)
+	}
+}
+
+// par2 exit codes telling whether the recovery blocks suffice.
+const (
+	par2ExitRepairPossible    = 1
+	par2ExitRepairNotPossible = 2
+	par2ExitInsufficientData  = 4
+)
+
 func splitParWithRest(nfile *nzbparser.Nzb) (parFiles []nzbparser.NzbFile, restFiles []nzbparser.NzbFile) {
 	parFiles = make([]nzbparser.NzbFile, 0)
 	restFiles = make([]nzbparser.NzbFile, 0)
@@ -73,11 +120,44 @@ func splitParWithRest(nfile *nzbparser.Nzb) (parFiles []nzbparser.NzbFile, restF
 func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 	slog.InfoContext(ctx, "Starting repair process", "executor", "Par2CmdExecutor")
 
+	// Delete par2 after repair
+	if err := p.run(ctx, tmpPath, "r", "-q", "-p"); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Par2 repair completed successfully")
+
+	return nil
+}
+
+// Verify executes par2 verify on the files in the target folder. par2 exits
+// with "Repair possible" for damaged files it has enough recovery blocks for,
+// which is not an error here.
+func (p *Par2CmdExecutor) Verify(ctx context.Context, tmpPath string) error {
+	slog.InfoContext(ctx, "Starting verify process", "executor", "Par2CmdExecutor")
+
+	err := p.run(ctx, tmpPath, "v", "-q")
+	var par2Err *Par2Error
+	if errors.As(err, &par2Err) && par2Err.ExitCode == par2ExitRepairPossible {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Par2 verify completed successfully")
+
+	return nil
+}
+
+// run executes par2 with the operation args on the first par2 file in
+// tmpPath and the reference files.
+func (p *Par2CmdExecutor) run(ctx context.Context, tmpPath string, args ...string) error {
+
 	var (
-		par2FileName   string
-		parameters     []string
-		parProgressBar *progressbar.ProgressBar
-		err            error
+		par2FileName string
+		parameters   []string
+		err          error
 	)
 
 	par2Exe := p.ExePath
@@ -104,6 +184,10 @@ func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 		if err != nil {
 			return err
 		}
+		// Reference files are passed to par2 below, never used as the main par2 file.
+		if info.IsDir() && info.Name() == referenceDirName {
+			return filepath.SkipDir
+		}
 		if !info.IsDir() && exp.MatchString(filepath.Base(info.Name())) {
 			// Use the first .par2 file found as the main input for par2
 			// par2 should automatically find related files.
@@ -119,19 +203,17 @@ func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 
 	if par2FileName == "" {
 		slog.WarnContext(ctx, "No .par2 file found in the temporary directory, skipping repair.", "path", tmpPath)
-		// Depending on requirements, this might be an error or just a skip condition.
-		// For now, assume it's okay to skip if no par2 file exists.
-		return nil
+		return fmt.Errorf("%w in %s", ErrNoPar2, tmpPath)
 	}
 
-	slog.InfoContext(ctx, "Found par2 file for repair", "file", par2FileName)
+	slog.InfoContext(ctx, "Found par2 file", "file", par2FileName)
 
 	// set parameters
-	parameters = append(parameters, "r", "-q")
-	// Delete par2 after repair
-	parameters = append(parameters, "-p")
+	parameters = append(parameters, args...)
 	// The filename of the par2 file
 	parameters = append(parameters, filepath.Join(tmpPath, par2FileName))
+	// Extra files par2 scans for blocks it can reuse
+	parameters = append(parameters, referenceFiles(tmpPath)...)
 
 	// Use the package-level variable instead of calling exec.CommandContext directly
 	cmd := execCommand(ctx, par2Exe, parameters...)
@@ -164,6 +246,7 @@ func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 	go func() {
 		defer wg.Done()
 		for errScanner.Scan() {
+			reportProgress(ctx)
 			line := strings.TrimSpace(errScanner.Text())
 			if line != "" {
 				slog.DebugContext(ctx, "PAR2 STDERR:", "line", line)
@@ -174,38 +257,30 @@ func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 		}
 	}()
 
+	progress := startProgress(ctx, PhasePar2Repair, ProgressPercent, 100)
+	defer progress.Finish()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		// Ensure parProgressBar is initialized before use
-		parProgressBar = progressbar.NewOptions(100, // Use 100 as max for percentage
-			progressbar.OptionSetDescription("INFO:    Repairing files    "),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionThrottle(time.Millisecond*100),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-			progressbar.OptionClearOnFinish(),
-			progressbar.OptionOnCompletion(func() {
-				// new line after progress bar
-				fmt.Println()
-			}),
-		)
-		defer func() {
-			_ = parProgressBar.Close() // Close the progress bar when done
-		}()
-
 		for scanner.Scan() {
+			reportProgress(ctx)
 			output := strings.Trim(scanner.Text(), " \r\n")
 			if output != "" && !strings.Contains(output, "%") {
 				slog.DebugContext(ctx, fmt.Sprintf("PAR2 STDOUT: %v", output))
 			}
 
+			if m := par2TargetFound.FindStringSubmatch(output); m != nil {
+				reportRepairedFile(ctx, m[1])
+			}
+
 			exp := regexp.MustCompile(`(\d+)\.?\d*%`)
 			if output != "" && exp.MatchString(output) {
 				percentStr := exp.FindStringSubmatch(output)
 				if len(percentStr) > 1 {
 					percentInt, err := strconv.Atoi(percentStr[1])
 					if err == nil {
-						_ = parProgressBar.Set(percentInt)
+						progress.Set(int64(percentInt))
 					}
 				}
 			}
@@ -213,47 +288,37 @@ func (p *Par2CmdExecutor) Repair(ctx context.Context, tmpPath string) error {
 
 	}()
 
-	if err = cmd.Run(); err != nil {
+	if err = cmd.Start(); err == nil {
+		// Wait closes the pipes, so the readers must be done before it is called.
+		wg.Wait()
+		err = cmd.Wait()
+	}
+
+	if err != nil {
 		mu.Lock()
 		output := stderrOutput.String()
 		mu.Unlock()
 
-		if exitError, ok := err.(*exec.ExitError); ok {
-			if parProgressBar != nil {
-				_ = parProgressBar.Close() // Attempt to close/clear on error too
-			}
+		writePar2Stderr(ctx, tmpPath, output)
 
-			if errMsg, ok := par2ExitCodes[exitError.ExitCode()]; ok {
-				// Specific known error codes from par2
-				fullErrMsg := fmt.Sprintf("par2 exited with code %d: %s. Stderr: %s", exitError.ExitCode(), errMsg, output)
-				slog.ErrorContext(ctx, fullErrMsg)
-				// Treat specific codes as potentially non-fatal or requiring different handling
-				// For now, return all as errors, but could customize (e.g., ignore exit code 1 if repair was possible)
-				return errors.New(fullErrMsg)
-			}
-			// Unknown exit code
-			unknownErrMsg := fmt.Sprintf("par2 exited with unknown code %d. Stderr: %s", exitError.ExitCode(), output)
-			slog.ErrorContext(ctx, unknownErrMsg)
-			return errors.New(unknownErrMsg)
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			par2Err := &Par2Error{ExitCode: exitError.ExitCode(), Stderr: output}
+			slog.ErrorContext(ctx, par2Err.Error())
+			return par2Err
 		}
 		// Error not related to exit code (e.g., command not found)
 		return fmt.Errorf("failed to run par2 command '%s': %w. Stderr: %s", cmd.String(), err, output)
 	}
 
-	if parProgressBar != nil {
-		_ = parProgressBar.Finish() // Ensure finish is called on success
-	}
-
-	wg.Wait()
-
-	slog.InfoContext(ctx, "Par2 repair completed successfully")
+	progress.Set(100)
 
 	return nil
 }
 
 // Create generates a new par2 set protecting all non-par2 files in tmpPath.
-func (p *Par2CmdExecutor) Create(ctx context.Context, tmpPath string, redundancy int) ([]string, error) {
-	slog.InfoContext(ctx, "Creating par2 set", "tmpPath", tmpPath, "redundancy", redundancy)
+func (p *Par2CmdExecutor) Create(ctx context.Context, tmpPath string, redundancy, blockCount int, blockSize int64) ([]string, error) {
+	slog.InfoContext(ctx, "Creating par2 set", "tmpPath", tmpPath, "redundancy", redundancy, "block_count", blockCount, "block_size", blockSize)
 
 	par2Exe := p.ExePath
 	if par2Exe == "" {
@@ -284,12 +349,15 @@ func (p *Par2CmdExecutor) Create(ctx context.Context, tmpPath string, redundancy
 	}
 
 	archiveName := "repair.par2"
-	args := append([]string{"c", fmt.Sprintf("-r%d", redundancy), archiveName}, dataFiles...)
+	args := append([]string{"c"}, par2CreateArgs(redundancy, blockCount, blockSize)...)
+	args = append(args, archiveName)
+	args = append(args, dataFiles...)
 	cmd := execCommand(ctx, par2Exe, args...)
 	cmd.Dir = tmpPath
 
 	var stderr strings.Builder
 	cmd.Stderr = &stderr
+	cmd.Stdout = progressWriter{ctx: ctx}
 
 	if err := cmd.Run(); err != nil {
 		code := -1
@@ -300,6 +368,7 @@ func (p *Par2CmdExecutor) Create(ctx context.Context, tmpPath string, redundancy
 		if !known {
 			msg = fmt.Sprintf("unknown exit code %d", code)
 		}
+		writePar2Stderr(ctx, tmpPath, stderr.String())
 		return nil, fmt.Errorf("par2 create failed (%s): %s", msg, stderr.String())
 	}
 
@@ -320,6 +389,13 @@ func (p *Par2CmdExecutor) Create(ctx context.Context, tmpPath string, redundancy
 }
 
 // scanLines is a helper for bufio.Scanner to split lines correctly
+// writePar2Stderr stores the stderr of a failed par2 run in tmpPath.
+func writePar2Stderr(ctx context.Context, tmpPath, stderr string) {
+	if err := os.WriteFile(filepath.Join(tmpPath, Par2StderrFile), []byte(stderr), 0644); err != nil {
+		slog.WarnContext(ctx, "Failed to save par2 stderr", "path", tmpPath, "error", err)
+	}
+}
+
 func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -68,6 +68,32 @@ Repair complete.
 		assert.NoError(t, err)
 	})
 
+	t.Run("Reports Repaired Files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		f, err := os.Create(filepath.Join(tmpDir, "test.par2"))
+		require.NoError(t, err)
+		_ = f.Close()
+
+		_ = os.Setenv("TEST_PAR2_EXIT_CODE", "0")
+		_ = os.Setenv("TEST_PAR2_STDOUT", `Target: "intact.bin" - found.
+Target: "data.bin" - damaged. Found 3 of 4 data blocks.
+Verifying repaired files:
+Target: "data.bin" - found.
+Repair complete.`)
+		_ = os.Setenv("TEST_PAR2_STDERR", "")
+		defer func() {
+			_ = os.Unsetenv("TEST_PAR2_EXIT_CODE")
+			_ = os.Unsetenv("TEST_PAR2_STDOUT")
+			_ = os.Unsetenv("TEST_PAR2_STDERR")
+		}()
+
+		var found []string
+		ctx := withRepairedFile(context.Background(), func(name string) { found = append(found, name) })
+		executor := &Par2CmdExecutor{ExePath: "par2"}
+		require.NoError(t, executor.Repair(ctx, tmpDir))
+		assert.Equal(t, []string{"intact.bin", "data.bin"}, found)
+	})
+
 	t.Run("No Par2 File", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		// No .par2 file created
@@ -75,7 +101,7 @@ Repair complete.
 		executor := &Par2CmdExecutor{ExePath: "par2"}
 		ctx := context.Background()
 		err := executor.Repair(ctx, tmpDir)
-		assert.NoError(t, err, "Should not return error if no par2 file is found")
+		assert.ErrorIs(t, err, ErrNoPar2)
 	})
 
 	t.Run("Repair Possible Exit Code 1", func(t *testing.T) {
@@ -102,6 +128,12 @@ Repair possible.
 		err = executor.Repair(ctx, tmpDir)
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "par2 exited with code 1: Repair possible")
+		assert.ErrorIs(t, err, ErrRepairNotPossible)
+		assert.NotErrorIs(t, err, ErrTooDamaged)
+
+		stderr, readErr := os.ReadFile(filepath.Join(tmpDir, Par2StderrFile))
+		require.NoError(t, readErr)
+		assert.Contains(t, string(stderr), "Some warnings maybe")
 	})
 
 	t.Run("Repair Not Possible Exit Code 2", func(t *testing.T) {
@@ -126,6 +158,13 @@ Need 10 recovery blocks, only 5 available.`)
 		err = executor.Repair(ctx, tmpDir)
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "par2 exited with code 2: Repair not possible")
+		assert.ErrorIs(t, err, ErrTooDamaged)
+		assert.ErrorIs(t, err, ErrRepairNotPossible)
+
+		var par2Err *Par2Error
+		require.ErrorAs(t, err, &par2Err)
+		assert.Equal(t, 2, par2Err.ExitCode)
+		assert.Contains(t, par2Err.Stderr, "Not enough data")
 	})
 
 	t.Run("Unknown Exit Code", func(t *testing.T) {
@@ -233,6 +272,29 @@ Done.`)
 		}
 	})
 
+	t.Run("Reference files are passed as extra files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, referenceDirName), 0755))
+		// A par2 file among the references must not be taken as the main one.
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, referenceDirName, "a.par2"), nil, 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "test.par2"), nil, 0644))
+
+		var capturedArgs []string
+		execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+			capturedArgs = args
+			cs := []string{"-test.run=TestHelperProcess", "--", "echo"}
+			cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+			cmd.Env = append(os.Environ(), "GO_TEST_HELPER_PROCESS=1",
+				"TEST_PAR2_EXIT_CODE=0", "TEST_PAR2_STDOUT=", "TEST_PAR2_STDERR=")
+			return cmd
+		}
+		defer func() { execCommand = originalExecCommand }()
+
+		executor := &Par2CmdExecutor{ExePath: "par2"}
+		require.NoError(t, executor.Repair(context.Background(), tmpDir))
+		assert.Equal(t, []string{"r", "-q", "-p", filepath.Join(tmpDir, "test.par2"), filepath.Join(tmpDir, referenceDirName, "a.par2")}, capturedArgs)
+	})
+
 	t.Run("Empty ExePath uses default", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		par2File := filepath.Join(tmpDir, "test.par2")
@@ -286,7 +348,7 @@ func TestPar2CmdExecutor_Create(t *testing.T) {
 		}()
 
 		p := &Par2CmdExecutor{ExePath: "par2"}
-		files, err := p.Create(context.Background(), tmpDir, 10)
+		files, err := p.Create(context.Background(), tmpDir, 10, 0, 0)
 		require.NoError(t, err)
 		_ = files // mock doesn't actually create files
 	})
@@ -305,7 +367,7 @@ func TestPar2CmdExecutor_Create(t *testing.T) {
 		}()
 
 		p := &Par2CmdExecutor{ExePath: "par2"}
-		_, err := p.Create(context.Background(), tmpDir, 10)
+		_, err := p.Create(context.Background(), tmpDir, 10, 0, 0)
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "par2 create failed")
 	})
@@ -313,12 +375,68 @@ func TestPar2CmdExecutor_Create(t *testing.T) {
 	t.Run("NoDataFiles", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		p := &Par2CmdExecutor{ExePath: "par2"}
-		files, err := p.Create(context.Background(), tmpDir, 10)
+		files, err := p.Create(context.Background(), tmpDir, 10, 0, 0)
 		require.NoError(t, err)
 		assert.Empty(t, files)
 	})
 }
 
+func TestPar2CmdExecutor_Verify(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() { execCommand = originalExecCommand }()
+
+	var capturedArgs []string
+	execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		capturedArgs = args
+		return mockExecCommand(ctx, command, args...)
+	}
+
+	tests := []struct {
+		name     string
+		exitCode string
+		wantErr  error
+	}{
+		{name: "Complete", exitCode: "0"},
+		{name: "Repair Possible", exitCode: "1"},
+		{name: "Repair Not Possible", exitCode: "2", wantErr: ErrTooDamaged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			f, err := os.Create(filepath.Join(tmpDir, "test.par2"))
+			require.NoError(t, err)
+			_ = f.Close()
+
+			_ = os.Setenv("TEST_PAR2_EXIT_CODE", tt.exitCode)
+			_ = os.Setenv("TEST_PAR2_STDOUT", "")
+			_ = os.Setenv("TEST_PAR2_STDERR", "")
+			defer func() {
+				_ = os.Unsetenv("TEST_PAR2_EXIT_CODE")
+				_ = os.Unsetenv("TEST_PAR2_STDOUT")
+				_ = os.Unsetenv("TEST_PAR2_STDERR")
+			}()
+
+			executor := &Par2CmdExecutor{ExePath: "par2"}
+			err = executor.Verify(context.Background(), tmpDir)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			require.NotEmpty(t, capturedArgs)
+			assert.Equal(t, "v", capturedArgs[0], "files are only verified")
+			assert.NotContains(t, capturedArgs, "-p", "the par2 files are kept")
+		})
+	}
+}
+
+func TestPar2CreateArgs(t *testing.T) {
+	assert.Equal(t, []string{"-r10"}, par2CreateArgs(10, 0, 0))
+	assert.Equal(t, []string{"-r5", "-b2000"}, par2CreateArgs(5, 2000, 0))
+	assert.Equal(t, []string{"-r5", "-s768000"}, par2CreateArgs(5, 0, 768000))
+}
+
 // testHelperProcess is run when the test binary is executed with a specific env var.
 // It simulates the behavior of the par2 command based on environment variables.
 func testHelperProcess(t *testing.T) {
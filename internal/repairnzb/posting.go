@@ -0,0 +1,112 @@
+package repairnzb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/mnightingale/rapidyenc"
+)
+
+// PostAttempts records the upload pools that rejected an article, so that a
+// pool posting through several others, like pools.Spread, posts it again
+// through another one instead of the same providers.
+type PostAttempts struct {
+	mu       sync.Mutex
+	rejected []NNTPPool
+	retry    bool
+}
+
+type postAttemptsKey struct{}
+
+// WithPostAttempts makes the posts made with the returned context record
+// their rejections in a.
+func WithPostAttempts(ctx context.Context, a *PostAttempts) context.Context {
+	return context.WithValue(ctx, postAttemptsKey{}, a)
+}
+
+// PostAttemptsFrom returns the PostAttempts of ctx, nil when there is none.
+func PostAttemptsFrom(ctx context.Context) *PostAttempts {
+	a, _ := ctx.Value(postAttemptsKey{}).(*PostAttempts)
+	return a
+}
+
+// Rejected reports whether p rejected the article.
+func (a *PostAttempts) Rejected(p NNTPPool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return slices.Contains(a.rejected, p)
+}
+
+// Reject records that p rejected the article. retry tells whether another
+// pool can still take it.
+func (a *PostAttempts) Reject(p NNTPPool, retry bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rejected = append(a.rejected, p)
+	a.retry = retry
+}
+
+// takeRetry reports whether the last rejection can be retried through
+// another pool, and clears it.
+func (a *PostAttempts) takeRetry() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	retry := a.retry
+	a.retry = false
+
+	return retry
+}
+
+// IsPostRejection reports whether err is a post the upload provider turned
+// down (NNTP 440 or 441), which is not posted through the same provider
+// again.
+func IsPostRejection(err error) bool {
+	return errors.Is(err, nntppool.ErrPostingFailed) || errors.Is(err, nntppool.ErrPostingNotPermitted)
+}
+
+// classifyPostError wraps the rejections of err in ErrPostRejected or
+// ErrPostingNotAllowed.
+func classifyPostError(err error) error {
+	switch {
+	case errors.Is(err, nntppool.ErrPostingNotPermitted):
+		return fmt.Errorf("%w: %w", ErrPostingNotAllowed, err)
+	case errors.Is(err, nntppool.ErrPostingFailed):
+		return fmt.Errorf("%w: %w", ErrPostRejected, err)
+	}
+
+	return err
+}
+
+// postRepairedArticle posts an article with the body returned by body under
+// a new message id, which it returns. An article the upload provider rejected
+// is posted again, under another message id, only when uploadPool has another
+// pool to post it through.
+func postRepairedArticle(ctx context.Context, uploadPool NNTPPool, headers nntppool.PostHeaders, body func() io.Reader, meta rapidyenc.Meta) (string, error) {
+	attempts := &PostAttempts{}
+	ctx = WithPostAttempts(ctx, attempts)
+
+	for {
+		msgId := generateRandomMessageID()
+		headers.MessageID = fmt.Sprintf("<%s>", msgId)
+
+		_, err := uploadPool.PostYenc(ctx, headers, body(), meta)
+		if err == nil {
+			return msgId, nil
+		}
+
+		if !IsPostRejection(err) || !attempts.takeRetry() {
+			return "", classifyPostError(err)
+		}
+
+		slog.With("err", err).WarnContext(ctx, "Article rejected, posting it through another upload provider", "subject", headers.Subject)
+	}
+}
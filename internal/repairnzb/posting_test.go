@@ -0,0 +1,79 @@
+package repairnzb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostRepairedArticle_RetriesThroughAnotherPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	var ids []string
+	gomock.InOrder(
+		pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, h nntppool.PostHeaders, body io.Reader, _ rapidyenc.Meta) (*nntppool.PostResult, error) {
+				ids = append(ids, h.MessageID)
+				// A pool posting through others records the rejection.
+				PostAttemptsFrom(ctx).Reject(pool, true)
+				return nil, nntppool.ErrPostingFailed
+			}),
+		pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, h nntppool.PostHeaders, body io.Reader, _ rapidyenc.Meta) (*nntppool.PostResult, error) {
+				ids = append(ids, h.MessageID)
+				b, err := io.ReadAll(body)
+				require.NoError(t, err)
+				assert.Equal(t, "data", string(b), "the body is read again")
+				return &nntppool.PostResult{}, nil
+			}),
+	)
+
+	msgId, err := postRepairedArticle(context.Background(), pool, nntppool.PostHeaders{}, func() io.Reader { return strings.NewReader("data") }, rapidyenc.Meta{})
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+	assert.NotEqual(t, ids[0], ids[1], "the article is posted again under a new message id")
+	assert.Equal(t, "<"+msgId+">", ids[1])
+}
+
+func TestPostRepairedArticle_ClassifiesRejections(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "441", err: nntppool.ErrPostingFailed, want: ErrPostRejected},
+		{name: "440", err: nntppool.ErrPostingNotPermitted, want: ErrPostingNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := mocks.NewMockNNTPPool(gomock.NewController(t))
+			// A single pool cannot post the article elsewhere, so it is not
+			// posted again.
+			pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, tt.err).Times(1)
+
+			_, err := postRepairedArticle(context.Background(), pool, nntppool.PostHeaders{}, func() io.Reader { return strings.NewReader("data") }, rapidyenc.Meta{})
+			require.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestPostRepairedArticle_OtherErrors(t *testing.T) {
+	pool := mocks.NewMockNNTPPool(gomock.NewController(t))
+	pool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")).Times(1)
+
+	_, err := postRepairedArticle(context.Background(), pool, nntppool.PostHeaders{}, func() io.Reader { return strings.NewReader("data") }, rapidyenc.Meta{})
+	require.EqualError(t, err, "connection reset")
+	assert.False(t, IsPostRejection(err))
+}
@@ -0,0 +1,277 @@
+package repairnzb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Units of Progress.
+const (
+	ProgressBytes    = "bytes"
+	ProgressSegments = "segments"
+	ProgressPercent  = "percent"
+)
+
+// progressInterval bounds how often a phase reports progress between its
+// start and its end.
+const progressInterval = 100 * time.Millisecond
+
+// Progress is a snapshot of the progress of a repair phase.
+type Progress struct {
+	Phase string `json:"phase"`
+	Unit  string `json:"unit"`
+	Done  int64  `json:"done"`
+	// Total is zero when it is not known.
+	Total int64 `json:"total"`
+	// Rate is Done per second since the phase started.
+	Rate    float64       `json:"rate"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Finished is set on the last snapshot of the phase.
+	Finished bool `json:"finished,omitempty"`
+}
+
+// ProgressReporter receives the progress of a repair: the terminal bars, the
+// JSON lines emitter, or the progress column and event stream of the watcher.
+// Snapshots of a phase arrive in order, at most every progressInterval plus
+// its first and last one.
+type ProgressReporter interface {
+	ReportProgress(ctx context.Context, p Progress)
+}
+
+// ProgressReporterFunc adapts a function to a ProgressReporter.
+type ProgressReporterFunc func(ctx context.Context, p Progress)
+
+// ReportProgress calls f(ctx, p).
+func (f ProgressReporterFunc) ReportProgress(ctx context.Context, p Progress) { f(ctx, p) }
+
+// MultiProgress returns a ProgressReporter that passes every snapshot to each
+// of reporters. Nil reporters are skipped.
+func MultiProgress(reporters ...ProgressReporter) ProgressReporter {
+	var rs multiProgress
+	for _, r := range reporters {
+		if r != nil {
+			rs = append(rs, r)
+		}
+	}
+
+	return rs
+}
+
+type multiProgress []ProgressReporter
+
+func (m multiProgress) ReportProgress(ctx context.Context, p Progress) {
+	for _, r := range m {
+		r.ReportProgress(ctx, p)
+	}
+}
+
+// WithProgressReporter sends the progress of every phase to r.
+func WithProgressReporter(r ProgressReporter) Option {
+	return func(o *options) {
+		o.reporter = r
+	}
+}
+
+type reporterKey struct{}
+
+// withProgressReporter returns a context carrying r for startProgress.
+func withProgressReporter(ctx context.Context, r ProgressReporter) context.Context {
+	if r == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// progressTracker counts the progress of a phase and reports it to the
+// reporter of the context it was started with. A nil tracker reports nothing.
+type progressTracker struct {
+	ctx      context.Context
+	reporter ProgressReporter
+	phase    string
+	unit     string
+	total    int64
+	started  time.Time
+
+	mu       sync.Mutex
+	done     int64
+	reported time.Time
+	finished bool
+}
+
+// startProgress starts tracking phase, counting total units, and reports its
+// first snapshot. It returns nil when ctx carries no reporter.
+func startProgress(ctx context.Context, phase, unit string, total int64) *progressTracker {
+	r, ok := ctx.Value(reporterKey{}).(ProgressReporter)
+	if !ok {
+		return nil
+	}
+
+	t := &progressTracker{ctx: ctx, reporter: r, phase: phase, unit: unit, total: total, started: time.Now()}
+	t.mu.Lock()
+	t.reportLocked(t.started)
+	t.mu.Unlock()
+
+	return t
+}
+
+// Add advances the phase by n units.
+func (t *progressTracker) Add(n int64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done += n
+	t.maybeReportLocked()
+}
+
+// Set sets the units done, for phases that only learn their absolute
+// progress, such as par2 printing percentages.
+func (t *progressTracker) Set(n int64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done = n
+	t.maybeReportLocked()
+}
+
+// Finish reports the last snapshot of the phase. Later calls do nothing.
+func (t *progressTracker) Finish() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.finished {
+		return
+	}
+	t.finished = true
+	t.reportLocked(time.Now())
+}
+
+func (t *progressTracker) maybeReportLocked() {
+	if t.finished {
+		return
+	}
+
+	if now := time.Now(); now.Sub(t.reported) >= progressInterval {
+		t.reportLocked(now)
+	}
+}
+
+func (t *progressTracker) reportLocked(now time.Time) {
+	t.reported = now
+	elapsed := now.Sub(t.started)
+
+	p := Progress{
+		Phase:    t.phase,
+		Unit:     t.unit,
+		Done:     t.done,
+		Total:    t.total,
+		Elapsed:  elapsed,
+		Finished: t.finished,
+	}
+	if elapsed > 0 {
+		p.Rate = float64(t.done) / elapsed.Seconds()
+	}
+
+	t.reporter.ReportProgress(t.ctx, p)
+}
+
+// NewBarProgress returns a ProgressReporter drawing one progress bar per
+// phase on w.
+func NewBarProgress(w io.Writer) ProgressReporter {
+	return &barProgress{w: w}
+}
+
+type barProgress struct {
+	w io.Writer
+
+	mu    sync.Mutex
+	phase string
+	bar   *progressbar.ProgressBar
+}
+
+func (b *barProgress) ReportProgress(_ context.Context, p Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.bar == nil || b.phase != p.Phase {
+		if b.bar != nil {
+			_ = b.bar.Finish()
+		}
+
+		b.phase = p.Phase
+		b.bar = b.newBar(p)
+	}
+
+	_ = b.bar.Set64(p.Done)
+
+	if p.Finished {
+		_ = b.bar.Finish()
+		b.bar = nil
+	}
+}
+
+func (b *barProgress) newBar(p Progress) *progressbar.ProgressBar {
+	total := p.Total
+	if total <= 0 {
+		total = -1
+	}
+
+	return progressbar.NewOptions64(total,
+		progressbar.OptionSetWriter(b.w),
+		progressbar.OptionSetDescription(fmt.Sprintf("%-12s", p.Phase)),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionShowBytes(p.Unit == ProgressBytes),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+		progressbar.OptionOnCompletion(func() {
+			_, _ = fmt.Fprintln(b.w)
+		}),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+}
+
+// NewJSONProgress returns a ProgressReporter writing every snapshot to w as a
+// line of JSON, stamped with the time it was taken.
+func NewJSONProgress(w io.Writer) ProgressReporter {
+	return &jsonProgress{enc: json.NewEncoder(w)}
+}
+
+type jsonProgress struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (j *jsonProgress) ReportProgress(_ context.Context, p Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_ = j.enc.Encode(struct {
+		Time time.Time `json:"time"`
+		Progress
+	}{Time: time.Now(), Progress: p})
+}
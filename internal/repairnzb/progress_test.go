@@ -0,0 +1,57 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var got []Progress
+	r := ProgressReporterFunc(func(_ context.Context, p Progress) { got = append(got, p) })
+
+	assert.Nil(t, startProgress(context.Background(), PhaseDownload, ProgressBytes, 10), "no reporter, no tracker")
+	var none *progressTracker
+	none.Add(1)
+	none.Finish()
+
+	ctx := withProgressReporter(context.Background(), MultiProgress(nil, r))
+	tracker := startProgress(ctx, PhaseDownload, ProgressBytes, 300)
+	tracker.Add(100)
+	tracker.Add(100)
+	tracker.Finish()
+	tracker.Finish()
+
+	require.Len(t, got, 2, "updates within the interval are folded into the last snapshot")
+	assert.Equal(t, Progress{Phase: PhaseDownload, Unit: ProgressBytes, Total: 300}, got[0])
+	assert.Equal(t, int64(200), got[1].Done)
+	assert.Equal(t, int64(300), got[1].Total)
+	assert.True(t, got[1].Finished)
+	assert.Positive(t, got[1].Rate)
+}
+
+func TestJSONProgress(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONProgress(&buf)
+	r.ReportProgress(context.Background(), Progress{Phase: PhaseUpload, Unit: ProgressSegments, Done: 3, Total: 4, Rate: 1.5})
+	r.ReportProgress(context.Background(), Progress{Phase: PhaseUpload, Unit: ProgressSegments, Done: 4, Total: 4, Finished: true})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &line))
+	assert.Equal(t, PhaseUpload, line["phase"])
+	assert.Equal(t, ProgressSegments, line["unit"])
+	assert.Equal(t, 3.0, line["done"])
+	assert.Equal(t, 1.5, line["rate"])
+	assert.NotEmpty(t, line["time"])
+	assert.NotContains(t, line, "finished")
+
+	require.NoError(t, json.Unmarshal(lines[1], &line))
+	assert.Equal(t, true, line["finished"])
+}
@@ -0,0 +1,88 @@
+package repairnzb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// referenceDirName is the folder of the temporary directory that holds the
+// links to the files of the reference directory while par2 runs.
+const referenceDirName = ".reference"
+
+// linkReferenceFiles hardlinks every file below refDir into the reference
+// folder of tmpDir, so par2 can take blocks from them. Files on another
+// filesystem, which cannot be hardlinked, are symlinked. It returns the number
+// of files linked.
+func linkReferenceFiles(refDir, tmpDir string) (int, error) {
+	absRefDir, err := filepath.Abs(refDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve reference directory: %w", err)
+	}
+
+	dest := filepath.Join(tmpDir, referenceDirName)
+	linked := 0
+	err = filepath.WalkDir(absRefDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(absRefDir, path)
+		if err != nil {
+			return err
+		}
+
+		// The links are flat, so nested files keep their folders in the name.
+		ok, err := linkReference(path, filepath.Join(dest, strings.ReplaceAll(rel, string(filepath.Separator), "_")))
+		if ok {
+			linked++
+		}
+
+		return err
+	})
+	if err != nil {
+		return linked, fmt.Errorf("failed to link reference files from %s: %w", refDir, err)
+	}
+
+	return linked, nil
+}
+
+// linkReference hardlinks src at link, or symlinks it when src is on another
+// filesystem. It reports false when link already exists.
+func linkReference(src, link string) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return false, err
+	}
+
+	if err := os.Link(src, link); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return false, nil
+		}
+		if err := os.Symlink(src, link); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// referenceFiles returns the files linked into the reference folder of tmpPath.
+func referenceFiles(tmpPath string) []string {
+	entries, err := os.ReadDir(filepath.Join(tmpPath, referenceDirName))
+	if err != nil {
+		return nil
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, filepath.Join(tmpPath, referenceDirName, e.Name()))
+	}
+
+	return files
+}
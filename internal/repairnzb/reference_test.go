@@ -0,0 +1,39 @@
+package repairnzb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkReferenceFiles(t *testing.T) {
+	refDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(refDir, "show.mkv"), []byte("partial"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(refDir, "extras"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(refDir, "extras", "sample.mkv"), []byte("sample"), 0644))
+
+	tmpDir := t.TempDir()
+	assert.Empty(t, referenceFiles(tmpDir))
+
+	linked, err := linkReferenceFiles(refDir, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, linked)
+
+	files := referenceFiles(tmpDir)
+	require.Equal(t, []string{
+		filepath.Join(tmpDir, referenceDirName, "extras_sample.mkv"),
+		filepath.Join(tmpDir, referenceDirName, "show.mkv"),
+	}, files)
+
+	src, err := os.Stat(filepath.Join(refDir, "show.mkv"))
+	require.NoError(t, err)
+	link, err := os.Stat(files[1])
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(src, link), "reference files are hardlinked, not copied")
+
+	_, err = linkReferenceFiles(filepath.Join(refDir, "missing"), tmpDir)
+	require.Error(t, err)
+}
@@ -1,7 +1,6 @@
 package repairnzb
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"errors"
@@ -10,6 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,9 +17,7 @@ import (
 	"github.com/Tensai75/nzbparser"
 	nntppool "github.com/javi11/nntppool/v4"
 	"github.com/javi11/nzb-repair/internal/config"
-	"github.com/k0kubun/go-ansi"
 	"github.com/mnightingale/rapidyenc"
-	"github.com/schollz/progressbar/v3"
 	"github.com/sourcegraph/conc/pool"
 )
 
@@ -40,6 +38,9 @@ func countMissingParSegments(
 	downloadPool NNTPPool,
 	parFiles []nzbparser.NzbFile,
 ) (missing, total int64, err error) {
+	progress := startProgress(ctx, PhasePar2Check, ProgressSegments, filesSegments(parFiles))
+	defer progress.Finish()
+
 	for _, f := range parFiles {
 		for _, s := range f.Segments {
 			total++
@@ -47,6 +48,8 @@ func countMissingParSegments(
 				return missing, total, ctx.Err()
 			}
 			_, segErr := downloadPool.BodyStream(ctx, s.Id, io.Discard)
+			reportProgress(ctx)
+			progress.Add(1)
 			if segErr != nil {
 				if errors.Is(segErr, nntppool.ErrArticleNotFound) {
 					missing++
@@ -60,6 +63,8 @@ func countMissingParSegments(
 }
 
 // uploadPar2Files uploads generated par2 files and returns new NzbFile entries.
+// The par2 files replace the ones of nzb, so they are numbered after its data
+// files.
 func uploadPar2Files(
 	ctx context.Context,
 	par2FilePaths []string,
@@ -74,89 +79,133 @@ func uploadPar2Files(
 		groups = nzb.Files[0].Groups
 	}
 
-	for _, path := range par2FilePaths {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read par2 file %s: %w", path, err)
-		}
-
-		filename := filepath.Base(path)
-		fileSize := int64(len(data))
-		segSize := defaultSegmentSize
-		totalSegments := (len(data) + segSize - 1) / segSize
-
-		nzbFile := nzbparser.NzbFile{
-			Filename:      filename,
-			Basefilename:  filename,
-			Poster:        "nzb-repair",
-			Date:          int(time.Now().Unix()),
-			TotalSegments: totalSegments,
-			Bytes:         fileSize,
-			Groups:        groups,
-		}
-
-		p := pool.New().WithContext(ctx).
-			WithMaxGoroutines(cfg.UploadWorkers).
-			WithCancelOnError()
-
-		segments := make([]nzbparser.NzbSegment, totalSegments)
-		for i := range totalSegments {
-			segNum := i + 1
-			start := i * segSize
-			end := start + segSize
-			if end > len(data) {
-				end = len(data)
-			}
-			chunk := make([]byte, end-start)
-			copy(chunk, data[start:end])
-
-			p.Go(func(ctx context.Context) error {
-				msgId := generateRandomMessageID()
-				subject := fmt.Sprintf("[1/1] \"%s\" yEnc (%d/%d)", filename, segNum, totalSegments)
-				fName := filename
-				if cfg.Upload.ObfuscationPolicy != config.ObfuscationPolicyNone {
-					fName = rand.Text()
-					subject = rand.Text()
-				}
-
-				headers := nntppool.PostHeaders{
-					From:       "nzb-repair",
-					Subject:    subject,
-					Newsgroups: groups,
-					MessageID:  fmt.Sprintf("<%s>", msgId),
-				}
-				meta := rapidyenc.Meta{
-					FileName:   fName,
-					FileSize:   fileSize,
-					PartSize:   int64(len(chunk)),
-					PartNumber: int64(segNum),
-					Offset:     int64(start),
-					TotalParts: int64(totalSegments),
-				}
-				if _, err := uploadPool.PostYenc(ctx, headers, bytes.NewReader(chunk), meta); err != nil {
-					return fmt.Errorf("failed to upload par2 segment: %w", err)
-				}
-				segments[i] = nzbparser.NzbSegment{
-					Bytes:  len(chunk),
-					Number: segNum,
-					Id:     msgId,
-				}
-				return nil
-			})
+	dataFiles := 0
+	for _, f := range nzb.Files {
+		if !parregexp.MatchString(f.Filename) {
+			dataFiles++
 		}
+	}
+	totalFiles := dataFiles + len(par2FilePaths)
 
-		if err := p.Wait(); err != nil {
+	for i, path := range par2FilePaths {
+		nzbFile, err := uploadPar2File(ctx, path, cfg, uploadPool, groups, dataFiles+i+1, totalFiles)
+		if err != nil {
 			return nil, err
 		}
 
-		nzbFile.Segments = segments
 		newFiles = append(newFiles, nzbFile)
-		slog.InfoContext(ctx, "Uploaded par2 file", "filename", filename, "segments", totalSegments)
 	}
 
 	return newFiles, nil
 }
 
+// uploadPar2File uploads the par2 file at path as file number of totalFiles,
+// streaming each segment from the file to the encoder, and returns its NZB
+// entry.
+func uploadPar2File(
+	ctx context.Context,
+	path string,
+	cfg config.Config,
+	uploadPool NNTPPool,
+	groups []string,
+	number, totalFiles int,
+) (nzbparser.NzbFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nzbparser.NzbFile{}, fmt.Errorf("failed to read par2 file %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nzbparser.NzbFile{}, fmt.Errorf("failed to read par2 file %s: %w", path, err)
+	}
+
+	filename := filepath.Base(path)
+	fileSize := info.Size()
+	segSize := int64(defaultSegmentSize)
+	if maxSize := cfg.MaxArticleSize(); maxSize > 0 {
+		segSize = min(segSize, maxSize)
+	}
+	totalSegments := int((fileSize + segSize - 1) / segSize)
+
+	nzbFile := nzbparser.NzbFile{
+		Number:        number,
+		Filename:      filename,
+		Basefilename:  filename,
+		Poster:        "nzb-repair",
+		Date:          int(time.Now().Unix()),
+		TotalSegments: totalSegments,
+		Bytes:         fileSize,
+		Groups:        groups,
+	}
+
+	p := pool.New().WithContext(ctx).
+		WithMaxGoroutines(cfg.UploadWorkers).
+		WithCancelOnError()
+
+	segments := make([]nzbparser.NzbSegment, totalSegments)
+	for i := range totalSegments {
+		segNum := i + 1
+		start := int64(i) * segSize
+		size := min(segSize, fileSize-start)
+
+		p.Go(func(ctx context.Context) error {
+			subject := articleSubject{
+				File:     number,
+				Files:    totalFiles,
+				Filename: filename,
+				Part:     int64(segNum),
+				Parts:    int64(totalSegments),
+			}.render(cfg.Upload.SubjectTemplate, par2SubjectTemplate)
+			fName := filename
+			if cfg.Upload.ObfuscationPolicy != config.ObfuscationPolicyNone {
+				fName = rand.Text()
+				subject = rand.Text()
+			}
+
+			headers := nntppool.PostHeaders{
+				From:       "nzb-repair",
+				Subject:    subject,
+				Newsgroups: groups,
+			}
+			meta := rapidyenc.Meta{
+				FileName:   fName,
+				FileSize:   fileSize,
+				PartSize:   size,
+				PartNumber: int64(segNum),
+				Offset:     start,
+				TotalParts: int64(totalSegments),
+			}
+			msgId, err := postRepairedArticle(ctx, uploadPool, headers, func() io.Reader { return segmentReader(f, start, size) }, meta)
+			if err != nil {
+				return fmt.Errorf("failed to upload par2 segment: %w", err)
+			}
+			reportProgress(ctx)
+			segments[i] = nzbparser.NzbSegment{
+				Bytes:  int(size),
+				Number: segNum,
+				Id:     msgId,
+			}
+			return nil
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return nzbparser.NzbFile{}, err
+	}
+
+	nzbFile.Segments = segments
+	slog.InfoContext(ctx, "Uploaded par2 file", "filename", filename, "segments", totalSegments)
+
+	return nzbFile, nil
+}
+
+// RepairNzb repairs the NZB at nzbFile: missing and corrupt segments are
+// recovered with par2 and uploaded again, and the repaired NZB is written to
+// outputFile, or next to nzbFile when it is empty.
 func RepairNzb(
 	ctx context.Context,
 	cfg config.Config,
@@ -166,25 +215,56 @@ func RepairNzb(
 	nzbFile string,
 	outputFile string,
 	tmpDir string,
-) error {
-	content, err := os.Open(nzbFile)
-	if err != nil {
-		return err
+	opts ...Option,
+) (*RepairResult, error) {
+	return RepairNzbs(ctx, cfg, downloadPool, uploadPool, par2Executor, []string{nzbFile}, outputFile, tmpDir, opts...)
+}
+
+// RepairNzbs repairs a release whose data files and par2 volumes are split
+// across several NZBs. The NZBs are merged and repaired in a single tmp dir,
+// and one merged NZB is written. Without outputFile it is written next to
+// the first NZB.
+func RepairNzbs(
+	ctx context.Context,
+	cfg config.Config,
+	downloadPool NNTPPool,
+	uploadPool NNTPPool,
+	par2Executor Par2Executor,
+	nzbFiles []string,
+	outputFile string,
+	tmpDir string,
+	opts ...Option,
+) (_ *RepairResult, err error) {
+	o := newOptions(opts)
+	ctx = withProgress(ctx, o.progress)
+	ctx = withProgressReporter(ctx, o.reporter)
+
+	if len(nzbFiles) == 0 {
+		return o.result, errors.New("no nzb files to repair")
 	}
 
-	nzb, err := nzbparser.Parse(content)
-	if err != nil {
-		_ = content.Close()
+	nzbs := make([]*nzbparser.Nzb, 0, len(nzbFiles))
+	var layout nzbLayout
+	for i, nzbFile := range nzbFiles {
+		nzb, l, err := parseNzb(nzbFile)
+		if err != nil {
+			return o.result, err
+		}
 
-		return err
+		nzbs = append(nzbs, nzb)
+		if i == 0 {
+			layout = l
+		} else {
+			layout = layout.merge(l)
+		}
 	}
 
-	_ = content.Close()
+	nzb := mergeNzbs(nzbs)
 
 	parFiles, restFiles := splitParWithRest(nzb)
 	if len(parFiles) == 0 {
 		slog.InfoContext(ctx, "No par2 files found in NZB, stopping repair.")
-		return nil
+		return o.result, ErrNoPar2
 	}
 
 	brokenSegments := make(map[*nzbparser.NzbFile][]brokenSegment, 0)
@@ -216,57 +296,201 @@ func RepairNzb(
 	if len(restFiles) == 0 {
 		slog.InfoContext(ctx, "No files to repair, stopping repair.")
 
-		return nil
+		return o.result, nil
 	}
 
 	firstFile := restFiles[0]
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
 		if !errors.Is(err, os.ErrExist) {
 			slog.With("err", err).ErrorContext(ctx, "failed to ensure temp folder exists")
-			return err
+			return o.result, err
 		}
 	}
 
+	// complete is set once every data file in tmpDir is whole, so the release
+	// can be extracted.
+	complete := false
 	defer func() {
+		if err == nil && complete && cfg.Extract.Enabled && !o.dryRun && ctx.Err() == nil {
+			o.extractRelease(ctx, cfg, tmpDir, nzbFiles, outputFile)
+		}
+
+		if ctx.Err() != nil && HasResumeState(tmpDir) {
+			slog.InfoContext(ctx, "Keeping temporary directory of interrupted download to resume it", "path", tmpDir)
+			return
+		}
+
+		if err != nil && cfg.KeepTmpOnFailure {
+			slog.InfoContext(ctx, "Keeping temporary directory of failed repair", "path", tmpDir)
+			return
+		}
+
 		slog.InfoContext(ctx, "Cleaning up temporary directory", "path", tmpDir)
 		if err := os.RemoveAll(tmpDir); err != nil {
 			slog.ErrorContext(ctx, "Failed to clean up temporary directory", "path", tmpDir, "error", err)
 		}
 	}()
 
-	// Download files
+	// Downloads into the temporary directory resume where an interrupted
+	// repair of the same NZBs stopped.
+	store := o.store
+	var stateDir string
+	if store == nil {
+		store = DiskStore{Dir: tmpDir}
+		resumed, resumeErr := prepareResume(tmpDir, releaseName(nzbFiles))
+		if resumeErr != nil {
+			return o.result, fmt.Errorf("failed to prepare the download state: %w", resumeErr)
+		}
+		if resumed {
+			slog.InfoContext(ctx, "Resuming interrupted download", "path", tmpDir)
+		}
+		stateDir = filepath.Join(tmpDir, stateDirName)
+	}
+
+	// tolerate records a failure to go on despite it, or returns it when the
+	// failure mode is strict.
+	tolerate := func(err error) error {
+		if cfg.FailureMode == FailureModeStrict {
+			return err
+		}
+
+		slog.With("err", err).WarnContext(ctx, "going on with the repair despite the failure")
+		o.result.Errors = append(o.result.Errors, err.Error())
+
+		return nil
+	}
+
+	// The segments NZBGet already wrote for the NZBs are not downloaded
+	// again. Those par2 does not vouch for are, through the download state.
+	var nzbgetSources map[string]*nzbgetSource
+	if cfg.NzbgetInterDir != "" && stateDir != "" {
+		var nzbgetErr error
+		nzbgetSources, nzbgetErr = openNzbgetSources(cfg.NzbgetInterDir, nzbFiles, o.nzbgetID, nzb)
+		if nzbgetErr != nil {
+			slog.With("err", nzbgetErr).WarnContext(ctx, "failed to open nzbget intermediate files, downloading their segments")
+		}
+		defer closeNzbgetSources(nzbgetSources)
+	}
+	nzbgetCheck := &nzbgetVerifier{pool: downloadPool, parFiles: parFiles, store: store, stateDir: stateDir}
+
+	// Download files. Each downloaded file is verified while the next ones
+	// download.
+	var downloadErr error
+	verifier := newFileVerifier(ctx, store)
+	defer func() {
+		// The verification must end before the temporary directory is removed.
+		_, _ = verifier.wait()
+	}()
 	startTime := time.Now()
+	endDownload := o.startPhase(ctx, PhaseDownload)
+	downloadProgress := startProgress(ctx, PhaseDownload, ProgressBytes, filesBytes(restFiles))
+	// partSizes keeps the part size of every file, so repaired segments are
+	// posted at the offsets of the articles they replace.
+	partSizes := make(map[string]int64, len(restFiles))
+	// articleSizes keeps the measured size of the downloaded articles, to
+	// correct the segment sizes the NZB gets wrong.
+	articleSizes := make(map[string]map[int]articleSize, len(restFiles))
 	for _, f := range restFiles {
 		if ctx.Err() != nil {
 			slog.With("err", err).ErrorContext(ctx, "repair canceled")
+			downloadProgress.Finish()
+			endDownload(ctx.Err())
 
-			return nil
+			return o.result, nil
 		}
 
-		err := downloadWorker(ctx, cfg, downloadPool, f, brokenSegmentCh, tmpDir)
+		checks := &downloadChecks{}
+		segments, written, err := downloadWorker(ctx, cfg, downloadPool, f, brokenSegmentCh, checks, downloadProgress, store, stateDir, nzbgetSources[f.Filename])
+		if err == nil && len(checks.copied) > 0 {
+			var pending int
+			pending, err = nzbgetCheck.check(ctx, f, checks.copied)
+			if err == nil && pending > 0 {
+				slog.InfoContext(ctx, fmt.Sprintf("%d segments of %s taken from nzbget do not match par2, downloading them", pending, f.Filename))
+
+				// The download resumes with the other segments, already
+				// counted in the progress.
+				var again int64
+				checks = &downloadChecks{}
+				segments, again, err = downloadWorker(ctx, cfg, downloadPool, f, brokenSegmentCh, checks, nil, store, stateDir, nil)
+				written += again
+			}
+		}
+		verifier.verify(checks.checks)
+		if size := checks.partSize(f.TotalSegments); size > 0 {
+			partSizes[f.Filename] = size
+		}
+		articleSizes[f.Filename] = checks.articleSizes()
+		o.result.SegmentsChecked += int(segments)
+		o.result.BytesDownloaded += written
+		if err != nil && ctx.Err() != nil {
+			// Canceled, reported once the download phase ends.
+			break
+		}
 		if err != nil {
 			slog.With("err", err).ErrorContext(ctx, "failed to download file")
+			if downloadErr = tolerate(fmt.Errorf("%w: %s: %w", ErrDownloadFailed, f.Filename, err)); downloadErr != nil {
+				break
+			}
 		}
-
 	}
 
 	close(brokenSegmentCh)
 	bswg.Wait()
+	for _, bs := range brokenSegments {
+		o.result.SegmentsMissing += len(bs)
+	}
+	downloadProgress.Finish()
+	if downloadErr != nil {
+		endDownload(downloadErr)
+
+		return o.result, downloadErr
+	}
+	endDownload(ctx.Err())
 
 	if ctx.Err() != nil {
 		slog.With("err", err).ErrorContext(ctx, "repair canceled")
 
-		return nil
+		return o.result, nil
 	}
 
 	elapsed := time.Since(startTime)
 
 	slog.InfoContext(ctx, fmt.Sprintf("%d files downloaded in %s", len(restFiles), elapsed))
 
+	// Wait for the verification of the downloaded segments, so corrupt ones
+	// are repaired like missing ones.
+	var damaged []brokenSegment
+	if verified := verifier.queuedSegments(); verified > 0 {
+		endVerify := o.startPhase(ctx, PhaseVerify)
+		damaged, err = verifier.wait()
+		endVerify(err)
+		if err != nil {
+			return o.result, fmt.Errorf("failed to verify downloaded segments: %w", err)
+		}
+
+		if len(damaged) > 0 {
+			slog.InfoContext(ctx, fmt.Sprintf("%d of %d downloaded segments failed CRC verification", len(damaged), verified))
+		}
+	}
+
+	for _, s := range damaged {
+		brokenSegments[s.file] = append(brokenSegments[s.file], s)
+	}
+
+	// par2 changes the files from here on, so a later run downloads them
+	// again.
+	if stateDir != "" {
+		if err := os.RemoveAll(stateDir); err != nil {
+			slog.With("err", err).WarnContext(ctx, "failed to remove download state")
+		}
+	}
+
 	// Check par2 threshold (if configured)
 	needsParRecreation := false
 	if cfg.Par2RecreateThreshold > 0 && len(parFiles) > 0 {
+		endCheck := o.startPhase(ctx, PhasePar2Check)
 		missing, total, countErr := countMissingParSegments(ctx, downloadPool, parFiles)
+		endCheck(countErr)
 		if countErr != nil {
 			slog.With("err", countErr).WarnContext(ctx, "failed to count missing par2 segments, skipping threshold check")
 		} else if total > 0 {
@@ -275,55 +499,166 @@ func RepairNzb(
 			if ratio >= cfg.Par2RecreateThreshold {
 				slog.InfoContext(ctx, "par2 missing threshold exceeded, will recreate par2 set")
 				needsParRecreation = true
+				o.result.Par2Recreate = true
 			}
 		}
 	}
 
+	complete = len(brokenSegments) == 0
 	if len(brokenSegments) == 0 && !needsParRecreation {
 		slog.InfoContext(ctx, "No broken segments and par2 is healthy, stopping repair.")
+		o.result.Healthy = true
+		o.result.Verdict = VerdictHealthy
 
-		return nil
+		return o.result, nil
 	}
 
+	for _, bs := range brokenSegments {
+		o.result.BrokenSegments += len(bs)
+	}
+	o.result.CorruptSegments = len(damaged)
+	o.result.Damage = damageMap(brokenSegments)
+
 	// Repair broken data segments (if any)
 	if len(brokenSegments) > 0 {
 		slog.InfoContext(ctx, fmt.Sprintf("%d broken segments found. Downloading par2 files", len(brokenSegments)))
+		endRepair := o.startPhase(ctx, PhasePar2Repair)
+		parProgress := startProgress(ctx, PhaseDownload, ProgressBytes, filesBytes(parFiles))
 		for _, f := range parFiles {
 			if ctx.Err() != nil {
-				return nil
+				return o.result, nil
+			}
+
+			_, written, err := downloadWorker(ctx, cfg, downloadPool, f, nil, nil, parProgress, store, "", nil)
+			o.result.BytesDownloaded += written
+			if ctx.Err() != nil {
+				parProgress.Finish()
+				endRepair(ctx.Err())
+
+				return o.result, nil
+			}
+			// par2 repairs with the recovery blocks of the articles found.
+			if errors.Is(err, nntppool.ErrArticleNotFound) {
+				slog.With("err", err).InfoContext(ctx, "par2 file is incomplete")
+			} else if err != nil {
+				slog.With("err", err).ErrorContext(ctx, "failed to download par2 file")
+				if err := tolerate(fmt.Errorf("%w: %s: %w", ErrDownloadFailed, f.Filename, err)); err != nil {
+					parProgress.Finish()
+					endRepair(err)
+
+					return o.result, err
+				}
+			}
+		}
+		parProgress.Finish()
+
+		if cfg.ReferenceDir != "" {
+			linked, linkErr := linkReferenceFiles(cfg.ReferenceDir, tmpDir)
+			if linkErr != nil {
+				slog.With("err", linkErr).WarnContext(ctx, "failed to link reference files, repairing without some of them")
 			}
+			slog.InfoContext(ctx, "Linked reference files for par2", "dir", cfg.ReferenceDir, "files", linked)
+		}
+
+		if cfg.NzbgetInterDir != "" {
+			for _, nzbFile := range nzbFiles {
+				linked, linkErr := linkNzbgetFiles(cfg.NzbgetInterDir, nzbFile, o.nzbgetID, nzb, tmpDir)
+				if linkErr != nil {
+					slog.With("err", linkErr).WarnContext(ctx, "failed to link nzbget intermediate files")
+				}
+				if linked > 0 {
+					slog.InfoContext(ctx, "Linked nzbget intermediate files for par2", "nzb", nzbFile, "files", linked)
+				}
+			}
+		}
+
+		// The files par2 reports complete are posted while it works on the
+		// others.
+		var uploader *segmentUploader
+		repairCtx := ctx
+		if !o.noUpload {
+			uploader = newSegmentUploader(ctx, brokenSegments, store, cfg, uploadPool, nzb, partSizes)
+			repairCtx = withRepairedFile(ctx, uploader.start)
+		}
+
+		if o.dryRun {
+			verifyErr := par2Executor.Verify(ctx, tmpDir)
+			endRepair(verifyErr)
+
+			return o.dryRunReport(ctx, verifyErr)
+		}
+
+		repairErr := par2Executor.Repair(repairCtx, tmpDir)
+		if repairErr != nil {
+			slog.With("err", repairErr).ErrorContext(ctx, "failed to repair files")
+			o.result.Verdict = VerdictUnrepairable
+		}
+		endRepair(repairErr)
+		complete = repairErr == nil
+
+		// Without par2 files or enough recovery blocks nothing was repaired,
+		// so there is nothing worth uploading.
+		if errors.Is(repairErr, ErrNoPar2) || errors.Is(repairErr, ErrTooDamaged) {
+			if uploader != nil {
+				uploader.abort()
+			}
+
+			return o.result, repairErr
+		}
+		if repairErr != nil {
+			if err := tolerate(repairErr); err != nil {
+				if uploader != nil {
+					uploader.abort()
+				}
 
-			if err := downloadWorker(ctx, cfg, downloadPool, f, nil, tmpDir); err != nil {
-				slog.With("err", err).InfoContext(ctx, "failed to download par2 file, cancelling repair")
+				return o.result, err
 			}
 		}
 
-		if err := par2Executor.Repair(ctx, tmpDir); err != nil {
-			slog.With("err", err).ErrorContext(ctx, "failed to repair files")
+		// The links must not end up in the uploaded segments or a recreated par2 set.
+		if err := os.RemoveAll(filepath.Join(tmpDir, referenceDirName)); err != nil {
+			slog.With("err", err).WarnContext(ctx, "failed to remove reference file links")
+		}
+
+		if o.noUpload {
+			return o.reportOnly(ctx), nil
 		}
 
 		startTime = time.Now()
-		if err := replaceBrokenSegments(ctx, brokenSegments, tmpDir, cfg, uploadPool, nzb); err != nil {
+		endUpload := o.startPhase(ctx, PhaseUpload)
+		replaced, uploaded, err := uploader.finish()
+		o.result.SegmentsReplaced += replaced
+		o.result.BytesUploaded += uploaded
+		if err != nil {
 			slog.With("err", err).ErrorContext(ctx, "failed to upload repaired files")
-			return err
+			endUpload(err)
+			return o.result, fmt.Errorf("%w: %w", ErrUploadFailed, err)
 		}
+		endUpload(nil)
 		slog.InfoContext(ctx, fmt.Sprintf("%d broken segments uploaded in %s", len(brokenSegments), time.Since(startTime)))
 	}
 
+	if o.noUpload {
+		return o.reportOnly(ctx), nil
+	}
+
 	// Recreate par2 set (if threshold exceeded)
 	if needsParRecreation {
 		slog.InfoContext(ctx, "Recreating par2 set")
-		newPar2Paths, createErr := par2Executor.Create(ctx, tmpDir, cfg.Par2RecreateRedundancy)
+		endRecreate := o.startPhase(ctx, PhasePar2Recreate)
+		newPar2Paths, createErr := par2Executor.Create(ctx, tmpDir, cfg.Par2RecreateRedundancy, cfg.Par2RecreateBlockCount, cfg.Par2RecreateBlockSize)
 		if createErr != nil {
 			slog.With("err", createErr).ErrorContext(ctx, "failed to create new par2 set")
-			return createErr
+			endRecreate(createErr)
+			return o.result, createErr
 		}
 
 		if len(newPar2Paths) > 0 {
 			newPar2Files, uploadErr := uploadPar2Files(ctx, newPar2Paths, cfg, uploadPool, nzb)
 			if uploadErr != nil {
 				slog.With("err", uploadErr).ErrorContext(ctx, "failed to upload new par2 files")
-				return uploadErr
+				endRecreate(uploadErr)
+				return o.result, fmt.Errorf("%w: %w", ErrUploadFailed, uploadErr)
 			}
 
 			// Replace par2 entries in NZB: remove old, add new
@@ -334,8 +669,15 @@ func RepairNzb(
 				}
 			}
 			nzb.Files = append(filtered, newPar2Files...)
+			o.result.BytesUploaded += filesBytes(newPar2Files)
 			slog.InfoContext(ctx, fmt.Sprintf("Replaced par2 set with %d new files", len(newPar2Files)))
 		}
+		endRecreate(nil)
+	}
+
+	// Downloaders show sizes and progress from the segment sizes.
+	if corrected := correctSegmentBytes(nzb, articleSizes); corrected > 0 {
+		slog.InfoContext(ctx, fmt.Sprintf("Corrected the declared size of %d segments", corrected))
 	}
 
 	// write the repaired nzb file
@@ -343,181 +685,180 @@ func RepairNzb(
 	if outputFile != "" {
 		nzbFileName = outputFile
 	} else {
-		inputFileFolder := filepath.Dir(nzbFile)
+		inputFileFolder := filepath.Dir(nzbFiles[0])
 		nzbFileName = filepath.Join(inputFileFolder, fmt.Sprintf("%s.repaired.nzb", firstFile.Basefilename))
 	}
 
-	// Ensure output directory exists
-	outputDirPath := filepath.Dir(nzbFileName)
-	if err := os.MkdirAll(outputDirPath, 0755); err != nil {
-		if !errors.Is(err, os.ErrExist) {
-			slog.With("err", err).ErrorContext(ctx, "failed to create output directory")
-			return err
-		}
-	}
-
-	b, err := nzbparser.Write(nzb)
-	if err != nil {
-		slog.With("err", err).ErrorContext(ctx, "failed to write repaired nzb file")
-
-		return err
-	}
-
-	nzbFileHandle, err := os.Create(nzbFileName)
+	nzbFileName, err = writeRepairedNzb(ctx, cfg, nzb, layout, nzbFileName, o)
 	if err != nil {
-		slog.With("err", err).ErrorContext(ctx, "failed to create repaired nzb file")
-
-		return err
+		return o.result, err
 	}
 
-	defer func() {
-		_ = nzbFileHandle.Close()
-	}()
-
-	if _, err := nzbFileHandle.Write(b); err != nil {
-		slog.With("err", err).ErrorContext(ctx, "failed to write repaired nzb file")
-
-		return err
+	o.result.OutputPath = nzbFileName
+	if o.result.Verdict == VerdictUnknown {
+		o.result.Verdict = VerdictRepairable
 	}
 
 	slog.InfoContext(ctx, fmt.Sprintf("Repaired nzb file written to %s", nzbFileName))
 	slog.InfoContext(ctx, fmt.Sprintf("%d broken segments uploaded in %s", len(brokenSegments), time.Since(startTime)))
 	slog.InfoContext(ctx, "Repair completed successfully")
 
-	return nil
+	return o.result, nil
 }
 
-func replaceBrokenSegments(
-	ctx context.Context,
-	brokenSegments map[*nzbparser.NzbFile][]brokenSegment,
-	tmpFolder string,
-	cfg config.Config,
-	uploadPool NNTPPool,
-	nzb *nzbparser.Nzb,
-) error {
-	for nzbFile, bs := range brokenSegments {
-		if ctx.Err() != nil {
-			slog.ErrorContext(ctx, "repair canceled")
+// reportOnly finishes a repair without upload once the damage is known.
+func (o options) reportOnly(ctx context.Context) *RepairResult {
+	o.result.NotUploaded = true
+	o.result.DryRun = o.dryRun
+	if o.result.Verdict == VerdictUnknown {
+		o.result.Verdict = VerdictRepairable
+	}
 
-			return nil
-		}
+	slog.InfoContext(ctx, "Uploads are disabled, stopping repair without writing the nzb", "verdict", o.result.Verdict)
 
-		tmpFile, err := os.Open(filepath.Join(tmpFolder, nzbFile.Filename))
-		if err != nil {
-			slog.With("err", err).ErrorContext(ctx, "failed to open file")
+	return o.result
+}
 
-			return err
-		}
+// dryRunReport finishes a dry run once par2 verified the files. A release
+// par2 cannot repair is reported as unrepairable rather than failed; other
+// verify errors fail the dry run.
+func (o options) dryRunReport(ctx context.Context, verifyErr error) (*RepairResult, error) {
+	o.result.NotUploaded = true
+	o.result.DryRun = true
+
+	switch {
+	case verifyErr == nil:
+		o.result.Verdict = VerdictRepairable
+	case errors.Is(verifyErr, ErrNoPar2) || errors.Is(verifyErr, ErrTooDamaged):
+		o.result.Verdict = VerdictUnrepairable
+	default:
+		slog.With("err", verifyErr).ErrorContext(ctx, "failed to verify files")
+		return o.result, verifyErr
+	}
 
-		fs, err := tmpFile.Stat()
-		if err != nil {
-			slog.With("err", err).ErrorContext(ctx, "failed to get file info")
-			_ = tmpFile.Close()
+	slog.InfoContext(ctx, "Dry run, stopping repair without uploading or writing the nzb", "verdict", o.result.Verdict, "broken_segments", o.result.BrokenSegments)
 
-			return err
-		}
+	return o.result, nil
+}
 
-		fileSize := fs.Size()
-		totalSegments := int64(nzbFile.TotalSegments)
-		// s.segment.Bytes is the yEnc-encoded article size (~10% larger than decoded binary).
-		// The repaired file contains decoded binary data, so compute offsets from actual file size.
-		decodedSegSize := (fileSize + totalSegments - 1) / totalSegments
+// mergeNzbs combines the files of nzbs into the first one. Files listed in
+// more than one NZB, like a par2 index posted with every part, are kept once.
+func mergeNzbs(nzbs []*nzbparser.Nzb) *nzbparser.Nzb {
+	merged := nzbs[0]
+	if len(nzbs) == 1 {
+		return merged
+	}
 
-		p := pool.New().WithContext(ctx).
-			WithMaxGoroutines(cfg.UploadWorkers).
-			WithCancelOnError()
+	for _, nzb := range nzbs[1:] {
+		merged.Files = append(merged.Files, nzb.Files...)
+		for k, v := range nzb.Meta {
+			if _, ok := merged.Meta[k]; !ok {
+				merged.Meta[k] = v
+			}
+		}
+	}
 
-		for _, s := range bs {
-			p.Go(func(ctx context.Context) error {
-				if ctx.Err() != nil {
-					slog.With("err", err).ErrorContext(ctx, "repair canceled")
+	nzbparser.MakeUnique(merged)
+	nzbparser.ScanNzbFile(merged)
 
-					return nil
-				}
+	return merged
+}
 
-				// Get the segment from the file using decoded segment boundaries.
-				segNum := int64(s.segment.Number)
-				readOffset := (segNum - 1) * decodedSegSize
-				readSize := decodedSegSize
-				if segNum >= totalSegments {
-					readSize = fileSize - readOffset
-				}
+// writeRepairedNzb serializes nzb, in the layout of the NZBs it was read
+// from, and stores it in the output sink, by default at nzbFileName or in the
+// fallback output directory. It returns where the NZB was stored.
+func writeRepairedNzb(ctx context.Context, cfg config.Config, nzb *nzbparser.Nzb, layout nzbLayout, nzbFileName string, o options) (path string, err error) {
+	endWrite := o.startPhase(ctx, PhaseWriteOutput)
+	defer func() {
+		endWrite(err)
+	}()
 
-				buff := make([]byte, readSize)
-				_, err := tmpFile.ReadAt(buff, readOffset)
-				if err != nil {
-					slog.With("err", err).ErrorContext(ctx, "failed to read segment")
+	b, err := marshalNzb(nzb, layout)
+	if err != nil {
+		slog.With("err", err).ErrorContext(ctx, "failed to write repaired nzb file")
 
-					return err
-				}
+		return "", err
+	}
 
-				partSize := readSize
-				date := time.Unix(int64(nzbFile.Date), 0)
+	sink := o.sink
+	if sink == nil {
+		sink = &LocalSink{Conflict: cfg.OutputConflict, FallbackDir: cfg.FallbackOutputDir}
+	}
 
-				subject := fmt.Sprintf("[%v/%v] %v - \"\" yEnc (%v/%v)", s.file.Number, nzb.TotalFiles, s.file.Filename, int64(s.segment.Number), s.file.TotalSegments)
+	stored, err := sink.WriteNzb(ctx, nzbFileName, b)
+	if err != nil {
+		slog.With("err", err).ErrorContext(ctx, "failed to write repaired nzb file")
 
-				var fName string
+		return "", err
+	}
 
-				if cfg.Upload.ObfuscationPolicy == config.ObfuscationPolicyNone {
-					fName = s.file.Filename
-				} else {
-					fName = rand.Text()
-					subject = rand.Text()
-				}
+	if stored.BackupPath != "" {
+		slog.InfoContext(ctx, "Backed up existing file before overwriting it", "path", stored.Location, "backup", stored.BackupPath)
+		o.result.BackupPath = stored.BackupPath
+	}
+	o.result.OutputFallback = stored.Fallback
 
-				msgId := generateRandomMessageID()
+	return stored.Location, nil
+}
 
-				headers := nntppool.PostHeaders{
-					From:       nzbFile.Poster,
-					Subject:    subject,
-					Newsgroups: nzbFile.Groups,
-					MessageID:  fmt.Sprintf("<%s>", msgId),
-					Date:       date.UTC(),
-				}
+// writeNzbFile writes b to path, creating its directory if needed, or to the
+// first free version of path when it exists and conflict is
+// OutputConflictVersion. An overwritten file is backed up first. A partially
+// written file is removed. It returns the path written and the backup.
+func writeNzbFile(path string, b []byte, conflict string) (written, backup string, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create output directory: %w", err)
+	}
 
-				meta := rapidyenc.Meta{
-					FileName:   fName,
-					FileSize:   fileSize,
-					PartSize:   partSize,
-					PartNumber: int64(s.segment.Number),
-					TotalParts: int64(s.file.TotalSegments),
-				}
+	var f *os.File
+	if conflict == OutputConflictVersion {
+		f, path, err = createVersioned(path)
+	} else {
+		backup, err = BackupExisting(path)
+		if err != nil {
+			return "", "", err
+		}
 
-				// Upload the segment
-				_, err = uploadPool.PostYenc(ctx, headers, bytes.NewReader(buff), meta)
-				if err != nil {
-					slog.With("err", err).ErrorContext(ctx, "failed to upload segment")
+		f, err = os.Create(path)
+	}
+	if err != nil {
+		return "", backup, fmt.Errorf("failed to create repaired nzb file: %w", err)
+	}
 
-					return err
-				}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
 
-				slog.InfoContext(ctx, fmt.Sprintf("Uploaded segment %s", s.segment.Id))
-				nzbFile.Segments[s.segment.Number-1].Id = msgId
+	if err != nil {
+		_ = os.Remove(path)
 
-				return nil
-			})
-		}
+		return "", backup, fmt.Errorf("failed to write repaired nzb file: %w", err)
+	}
 
-		if err := p.Wait(); err != nil {
-			slog.With("err", err).ErrorContext(ctx, "failed to upload segments")
-			_ = tmpFile.Close()
+	return path, backup, nil
+}
 
-			return err
+// createVersioned creates path, or "name (2).nzb", "name (3).nzb"... next to
+// it when taken. O_EXCL makes concurrent writers pick different versions.
+func createVersioned(path string) (*os.File, string, error) {
+	ext := filepath.Ext(path)
+	for n := 1; ; n++ {
+		candidate := path
+		if n > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
 		}
 
-		_ = tmpFile.Close()
-		slog.InfoContext(ctx, fmt.Sprintf("Uploaded %d segments for file %s", len(bs), nzbFile.Filename))
-
-		// Replace the original broken file in the nzb with the repaired version
-		for i, f := range nzb.Files {
-			if f.Filename == nzbFile.Filename {
-				nzb.Files[i] = *nzbFile
-				break
-			}
+		f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
 		}
-	}
 
-	return nil
+		return f, candidate, nil
+	}
 }
 
 func downloadWorker(
@@ -526,9 +867,18 @@ func downloadWorker(
 	downloadPool NNTPPool,
 	file nzbparser.NzbFile,
 	brokenSegmentCh chan<- brokenSegment,
-	tmpFolder string,
-) error {
+	checks *downloadChecks,
+	progress *progressTracker,
+	store SegmentStore,
+	stateDir string,
+	nzbget *nzbgetSource,
+) (segments int64, written int64, err error) {
 	brokenSegmentCounter := atomic.Int64{}
+	// The counts are returned whatever the outcome.
+	var segmentCounter, writtenCounter atomic.Int64
+	defer func() {
+		segments, written = segmentCounter.Load(), writtenCounter.Load()
+	}()
 
 	p := pool.New().WithContext(ctx).
 		WithMaxGoroutines(config.DownloadWorkers).
@@ -536,54 +886,139 @@ func downloadWorker(
 
 	slog.InfoContext(ctx, fmt.Sprintf("Starting downloading file %s", file.Filename))
 
-	filePath := filepath.Join(tmpFolder, file.Filename)
+	// Segments are downloaded in file order within a window, so the file
+	// fills up from the front.
+	ordered := segmentsInOrder(file)
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); err == nil {
-		slog.InfoContext(ctx, fmt.Sprintf("File %s already exists, skipping download", file.Filename))
-		return nil
-	}
-
-	fileWriter, err := os.Create(filePath)
+	fileWriter, state, resumed, err := openDownload(store, stateDir, file.Filename, ordered)
 	if err != nil {
 		slog.With("err", err).ErrorContext(ctx, "failed to create file: %v")
 
-		return fmt.Errorf("failed to create file: %w", err)
+		return 0, 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	if fileWriter == nil {
+		slog.InfoContext(ctx, fmt.Sprintf("File %s already exists, skipping download", file.Filename))
+		return 0, 0, nil
 	}
 
 	defer func() {
 		_ = fileWriter.Close()
+		_ = state.close()
 	}()
 
-	bar := progressbar.NewOptions(int(file.Bytes),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionShowTotalBytes(true),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
-
 	c, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	once := sync.Once{}
+	window := newSegmentWindow(len(ordered), segmentWindowFactor*config.DownloadWorkers)
+
+	// The segments NZBGet wrote are taken from its file once the first one
+	// tells the part size, which places them.
+	var partSize atomic.Int64
+	firstDone := make(chan struct{})
+	var firstOnce sync.Once
+	finishFirst := func() { firstOnce.Do(func() { close(firstDone) }) }
+	totalParts := file.TotalSegments
+	if n := len(ordered); n > 0 {
+		totalParts = max(totalParts, ordered[n-1].Number)
+	}
+	var fromNzbget int
+	defer func() {
+		if fromNzbget > 0 {
+			slog.InfoContext(ctx, fmt.Sprintf("Took %d segments of %s from nzbget", fromNzbget, file.Filename))
+		}
+	}()
+
+	// On cancellation the loop stops, and the segments being downloaded are
+	// waited for before returning.
+loop:
+	for i, s := range ordered {
+		if window.wait(ctx, i) != nil {
+			break
+		}
+
+		// Segments written before the download was interrupted are kept,
+		// and checked and measured from their record as if downloaded again.
+		if resumed != nil && resumed[i] != nil {
+			r := resumed[i]
+			if i == 0 {
+				partSize.Store(int64(r.size))
+				finishFirst()
+			}
+			c := segmentCheck{
+				segment:     &s,
+				file:        &file,
+				name:        file.Filename,
+				offset:      r.offset,
+				size:        r.size,
+				expectedCRC: r.crc,
+			}
+			if r.copied {
+				checks.addCopied(c)
+			} else {
+				checks.add(c)
+			}
+			checks.measure(s.Number, r.article)
+			window.finish(i)
+			segmentCounter.Add(1)
+			progress.Add(int64(s.Bytes))
+			continue
+		}
+
+		if nzbget != nil && i > 0 {
+			select {
+			case <-firstDone:
+			case <-ctx.Done():
+				break loop
+			}
+
+			if offset, data, ok := nzbget.part(s.Number, totalParts, partSize.Load()); ok {
+				_, err := fileWriter.WriteAt(data, offset)
+				if err != nil {
+					err = fmt.Errorf("failed to write segment %d taken from nzbget: %w", s.Number, err)
+				} else if err = state.markWritten(i, segmentRecord{offset: offset, size: len(data), copied: true}); err != nil {
+					err = fmt.Errorf("failed to record segment %d: %w", s.Number, err)
+				}
+				if err != nil {
+					// The segments being downloaded end before the file closes.
+					cancel()
+					_ = p.Wait()
+
+					return 0, 0, err
+				}
+
+				checks.addCopied(segmentCheck{
+					segment: &s,
+					file:    &file,
+					name:    file.Filename,
+					offset:  offset,
+					size:    len(data),
+				})
+				window.finish(i)
+				segmentCounter.Add(1)
+				progress.Add(int64(s.Bytes))
+				fromNzbget++
+				continue
+			}
+		}
 
-	for _, s := range file.Segments {
 		select {
 		case <-c.Done():
-			return nil
+			break loop
 		case <-ctx.Done():
-			return nil
+			break loop
 		default:
 			p.Go(func(c context.Context) error {
-				buff := bytes.NewBuffer(make([]byte, 0))
-				if _, err := downloadPool.BodyStream(c, s.Id, buff); err != nil {
+				defer window.finish(i)
+				if i == 0 {
+					defer finishFirst()
+				}
+
+				// The decoded bytes go straight to the file. A CRC mismatch
+				// still delivers them; the verification pass sends the
+				// segment to par2.
+				sw := newSegmentWriter(fileWriter, s.Number)
+				body, err := downloadPool.BodyStream(c, s.Id, sw, sw.onMeta)
+				if err != nil && !errors.Is(err, nntppool.ErrCRCMismatch) {
 					if errors.Is(err, nntppool.ErrArticleNotFound) {
 						if brokenSegmentCh != nil {
 							slog.DebugContext(ctx, fmt.Sprintf("segment %s not found, sending for repair: %v", s.Id, err))
@@ -593,15 +1028,9 @@ func downloadWorker(
 								file:    &file,
 							}
 							brokenSegmentCounter.Add(1)
-
-							// Recalculate segment size for wrong segment sizes
-							once.Do(func() {
-								for _, s := range file.Segments {
-									s.Bytes = buff.Len()
-								}
-							})
+							segmentCounter.Add(1)
 						} else if !errors.Is(err, context.Canceled) {
-							return fmt.Errorf("segment %v not found", s.Id)
+							return fmt.Errorf("segment %v not found: %w", s.Id, err)
 						}
 
 						return nil
@@ -617,16 +1046,45 @@ func downloadWorker(
 					return err
 				}
 
-				start := (s.Number - 1) * buff.Len()
+				// A segment with a CRC mismatch is downloaded again on resume.
+				crcMismatch := err != nil
 
-				_, err = fileWriter.WriteAt(buff.Bytes(), int64(start))
+				start, size, err := sw.finish()
 				if err != nil {
 					slog.With("err", err).ErrorContext(ctx, "failed to write segment")
 
 					return err
 				}
 
-				_ = bar.Add(s.Bytes)
+				record := segmentRecord{offset: start, size: size}
+				if body != nil {
+					record.crc = body.ExpectedCRC
+					record.article = articleSize{encoded: body.BytesConsumed, decoded: body.BytesDecoded}
+					checks.add(segmentCheck{
+						segment:     &s,
+						file:        &file,
+						name:        file.Filename,
+						offset:      start,
+						size:        size,
+						expectedCRC: record.crc,
+					})
+					checks.measure(s.Number, record.article)
+				}
+
+				if i == 0 && !crcMismatch {
+					partSize.Store(int64(size))
+				}
+
+				if !crcMismatch {
+					if err := state.markWritten(i, record); err != nil {
+						return fmt.Errorf("failed to record segment %d: %w", s.Number, err)
+					}
+				}
+
+				segmentCounter.Add(1)
+				writtenCounter.Add(int64(size))
+				progress.Add(int64(s.Bytes))
+				reportProgress(ctx)
 
 				return nil
 			})
@@ -634,8 +1092,8 @@ func downloadWorker(
 	}
 
 	if err := p.Wait(); err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	return nil
+	return 0, 0, ctx.Err()
 }
@@ -3,15 +3,19 @@ package repairnzb
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Tensai75/nzbparser"
 	nntppool "github.com/javi11/nntppool/v4"
 	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/events"
 	"github.com/javi11/nzb-repair/internal/mocks" // Import the generated mocks
 	"github.com/mnightingale/rapidyenc"
 	"github.com/stretchr/testify/assert"
@@ -87,10 +91,10 @@ func TestRepairNzb(t *testing.T) {
 
 	// Download Expectations:
 	// Segment 1 (broken) - Not Found
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), brokenSegmentID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), brokenSegmentID, gomock.Any(), gomock.Any()).
 		Return(nil, nntppool.ErrArticleNotFound)
 	// Segment 2 (good) - Found & Written
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), goodSegmentID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), goodSegmentID, gomock.Any(), gomock.Any()).
 		DoAndReturn(func(_ context.Context, _ string, writer io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
 			if writer != nil {
 				// Simulate writing segment 2 content to the correct offset in the temp file
@@ -114,7 +118,7 @@ func TestRepairNzb(t *testing.T) {
 			return &nntppool.ArticleBody{}, nil
 		}).Times(1)
 	// Par2 Segment - Found & Written
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), parSegmentID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), parSegmentID, gomock.Any(), gomock.Any()).
 		DoAndReturn(func(_ context.Context, _ string, writer io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
 			// Simulate writing the par2 file content
 			parFilePath := filepath.Join(tmpDir, par2FileName)
@@ -154,8 +158,21 @@ func TestRepairNzb(t *testing.T) {
 		}).Times(1)
 
 	// --- Call the function ---
-	err = RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
+	result, err := RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
 	require.NoError(t, err)
+	assert.False(t, result.Healthy)
+	assert.Equal(t, 1, result.BrokenSegments)
+	assert.Equal(t, VerdictRepairable, result.Verdict)
+	assert.Equal(t, 2, result.SegmentsChecked)
+	assert.Equal(t, 1, result.SegmentsMissing)
+	assert.Equal(t, 1, result.SegmentsReplaced)
+	assert.Equal(t, int64(postedArticle.Len()), result.BytesUploaded)
+	assert.Positive(t, result.BytesDownloaded)
+	phases := make([]string, 0, len(result.Phases))
+	for _, p := range result.Phases {
+		phases = append(phases, p.Phase)
+	}
+	assert.Equal(t, []string{PhaseDownload, PhasePar2Repair, PhaseUpload, PhaseWriteOutput}, phases)
 
 	// --- Assertions ---
 
@@ -200,7 +217,8 @@ func TestRepairNzb_Par2ThresholdTriggersRecreation(t *testing.T) {
 		UploadWorkers:          1,
 		Par2RecreateThreshold:  1.0, // 100% — 1/1 missing triggers recreation
 		Par2RecreateRedundancy: 10,
-		Upload: config.UploadConfig{ObfuscationPolicy: config.ObfuscationPolicyNone},
+		Par2RecreateBlockCount: 2000,
+		Upload:                 config.UploadConfig{ObfuscationPolicy: config.ObfuscationPolicyNone},
 	}
 
 	mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
@@ -233,21 +251,21 @@ func TestRepairNzb_Par2ThresholdTriggersRecreation(t *testing.T) {
 	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
 
 	// Data segment found (no broken data segments)
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any(), gomock.Any()).
 		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
 			_, _ = w.Write([]byte("videodata"))
 			return &nntppool.ArticleBody{}, nil
 		}).Times(1)
 
 	// Par2 segment is missing → threshold triggered
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any(), gomock.Any()).
 		Return(nil, nntppool.ErrArticleNotFound).Times(1)
 
 	// Expect Create (threshold exceeded); Repair must NOT be called
-	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), 10).
+	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), 10, 2000, int64(0)).
 		Return([]string{}, nil).Times(1)
 
-	err := RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
+	_, err := RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
 	require.NoError(t, err)
 }
 
@@ -286,22 +304,25 @@ func TestRepairNzb_Par2ThresholdNotReached(t *testing.T) {
 	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
 
 	// Data segment found
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any(), gomock.Any()).
 		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
 			_, _ = w.Write([]byte("data"))
 			return &nntppool.ArticleBody{}, nil
 		}).Times(1)
 
 	// Par2 segment found (0% missing, threshold not reached)
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any(), gomock.Any()).
 		Return(&nntppool.ArticleBody{}, nil).Times(1)
 
 	// No Create, no Repair
-	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 	mockPar2Executor.EXPECT().Repair(gomock.Any(), gomock.Any()).Times(0)
 
-	err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, "", tmpDir)
+	result, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, "", tmpDir)
 	require.NoError(t, err)
+	assert.True(t, result.Healthy, "nothing missing means no repair was needed")
+	assert.Equal(t, VerdictHealthy, result.Verdict)
+	assert.Empty(t, result.OutputPath)
 }
 
 func TestRepairNzb_Par2ThresholdDisabled(t *testing.T) {
@@ -339,20 +360,20 @@ func TestRepairNzb_Par2ThresholdDisabled(t *testing.T) {
 	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
 
 	// Data segment found — threshold disabled so par2 NOT checked
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any()).
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), dataSegID, gomock.Any(), gomock.Any()).
 		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
 			_, _ = w.Write([]byte("data"))
 			return &nntppool.ArticleBody{}, nil
 		}).Times(1)
 
 	// Par2 must NOT be fetched for threshold check
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any()).Times(0)
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), par2SegID, gomock.Any(), gomock.Any()).Times(0)
 
 	// No Create, no Repair
-	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPar2Executor.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 	mockPar2Executor.EXPECT().Repair(gomock.Any(), gomock.Any()).Times(0)
 
-	err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, "", tmpDir)
+	_, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, "", tmpDir)
 	require.NoError(t, err)
 }
 
@@ -403,16 +424,430 @@ func TestRepairNzb_NoPar2Files(t *testing.T) {
 	// --- Mock Expectations ---
 	// No downloads, repairs, or uploads should be attempted as there are no par files.
 	// We expect the function to return early.
-	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any()).Times(0) // No downloads expected
-	mockPar2Executor.EXPECT().Repair(gomock.Any(), gomock.Any()).Times(0)                   // No repair expected
-	mockUploadPool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0) // No uploads expected
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0) // No downloads expected
+	mockPar2Executor.EXPECT().Repair(gomock.Any(), gomock.Any()).Times(0)                                 // No repair expected
+	mockUploadPool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)     // No uploads expected
 
 	// --- Call the function ---
-	err = RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
-	require.NoError(t, err) // Expecting graceful exit with no error
+	_, err = RepairNzb(ctx, cfg, mockDownloadPool, mockUploadPool, mockPar2Executor, nzbFile, outputFile, tmpDir)
+	require.ErrorIs(t, err, ErrNoPar2)
 
 	// --- Assertions ---
 	// 1. Check that the output NZB file was NOT created
 	_, err = os.Stat(outputFile)
 	assert.True(t, os.IsNotExist(err), "Output NZB file should NOT exist when no par2 files are present")
 }
+
+func TestRepairNzb_PublishesPhaseEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	cfg := config.Config{
+		DownloadWorkers: 1,
+	}
+
+	mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
+	mockPar2Executor := mocks.NewMockPar2Executor(ctrl)
+
+	inputDir := t.TempDir()
+	tmpDir := t.TempDir()
+	nzbFile := filepath.Join(inputDir, "input.nzb")
+
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="20" number="1">dataSeg@test</segment></segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] data.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2Seg@test</segment></segments>
+ </file>
+</nzb>`
+	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
+
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "dataSeg@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, _ = w.Write([]byte("data"))
+			return &nntppool.ArticleBody{}, nil
+		}).Times(1)
+
+	var got []events.Event
+	bus := events.NewBus()
+	bus.Subscribe(events.SubscriberFunc(func(_ context.Context, e events.Event) {
+		got = append(got, e)
+	}))
+
+	var progress atomic.Int64
+	_, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, "", tmpDir,
+		WithEvents(events.ForJob(bus, 7, nzbFile)), WithProgress(func() { progress.Add(1) }))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), progress.Load(), "phase start, downloaded segment and phase end")
+
+	require.Len(t, got, 2)
+	assert.Equal(t, events.PhaseStarted, got[0].Type)
+	assert.Equal(t, PhaseDownload, got[0].Phase)
+	assert.Equal(t, events.PhaseFinished, got[1].Type)
+	assert.Equal(t, PhaseDownload, got[1].Phase)
+	assert.Equal(t, int64(7), got[1].JobID)
+	assert.Empty(t, got[1].Error)
+}
+
+func TestRepairNzb_WithoutUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	cfg := config.Config{
+		DownloadWorkers: 1,
+	}
+
+	mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
+	mockPar2Executor := mocks.NewMockPar2Executor(ctrl)
+
+	inputDir := t.TempDir()
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(t.TempDir(), "output.nzb")
+	nzbFile := filepath.Join(inputDir, "input.nzb")
+
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="20" number="1">dataSeg@test</segment></segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] data.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2Seg@test</segment></segments>
+ </file>
+</nzb>`
+	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
+
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "dataSeg@test", gomock.Any(), gomock.Any()).
+		Return(nil, nntppool.ErrArticleNotFound)
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "par2Seg@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, _ = w.Write([]byte("par2"))
+			return &nntppool.ArticleBody{}, nil
+		}).Times(1)
+	mockPar2Executor.EXPECT().Repair(gomock.Any(), tmpDir).Return(nil).Times(1)
+
+	// A nil upload pool panics if anything is uploaded.
+	result, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, outputFile, tmpDir, WithoutUpload())
+	require.NoError(t, err)
+	assert.True(t, result.NotUploaded)
+	assert.False(t, result.Healthy)
+	assert.Equal(t, VerdictRepairable, result.Verdict)
+	assert.Equal(t, 1, result.BrokenSegments)
+	assert.Zero(t, result.SegmentsReplaced)
+	assert.Empty(t, result.OutputPath)
+
+	_, err = os.Stat(outputFile)
+	assert.True(t, os.IsNotExist(err), "no nzb is written without upload")
+}
+
+func TestRepairNzb_DryRun(t *testing.T) {
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="20" number="1">dataSeg@test</segment></segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] data.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2Seg@test</segment></segments>
+ </file>
+</nzb>`
+
+	tests := []struct {
+		name      string
+		verifyErr error
+		wantErr   bool
+		verdict   Verdict
+	}{
+		{name: "repairable", verdict: VerdictRepairable},
+		{name: "too damaged", verifyErr: &Par2Error{ExitCode: 2}, verdict: VerdictUnrepairable},
+		{name: "verify fails", verifyErr: &Par2Error{ExitCode: 6}, wantErr: true, verdict: VerdictUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			cfg := config.Config{
+				DownloadWorkers: 1,
+				Extract:         config.ExtractConfig{Enabled: true},
+			}
+
+			mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
+			mockPar2Executor := mocks.NewMockPar2Executor(ctrl)
+
+			tmpDir := t.TempDir()
+			outputFile := filepath.Join(t.TempDir(), "output.nzb")
+			nzbFile := filepath.Join(t.TempDir(), "input.nzb")
+			require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
+
+			mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "dataSeg@test", gomock.Any(), gomock.Any()).
+				Return(nil, nntppool.ErrArticleNotFound)
+			mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "par2Seg@test", gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+					_, _ = w.Write([]byte("par2"))
+					return &nntppool.ArticleBody{}, nil
+				}).Times(1)
+			// par2 only verifies, Repair is never called.
+			mockPar2Executor.EXPECT().Verify(gomock.Any(), tmpDir).Return(tt.verifyErr).Times(1)
+
+			// A nil upload pool panics if anything is uploaded.
+			result, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, outputFile, tmpDir, WithDryRun())
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, result.DryRun)
+				assert.True(t, result.NotUploaded)
+			}
+			assert.Equal(t, tt.verdict, result.Verdict)
+			assert.Equal(t, 1, result.BrokenSegments)
+			require.Len(t, result.Damage, 1)
+			assert.Equal(t, "data.mkv", result.Damage[0].Filename)
+			assert.Empty(t, result.OutputPath)
+			assert.Empty(t, result.ExtractedTo)
+
+			_, err = os.Stat(outputFile)
+			assert.True(t, os.IsNotExist(err), "no nzb is written in a dry run")
+		})
+	}
+}
+
+func TestRepairNzb_TooDamaged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	cfg := config.Config{
+		DownloadWorkers: 1,
+	}
+
+	mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
+	mockPar2Executor := mocks.NewMockPar2Executor(ctrl)
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(t.TempDir(), "output.nzb")
+	nzbFile := filepath.Join(t.TempDir(), "input.nzb")
+
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="20" number="1">dataSeg@test</segment></segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] data.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2Seg@test</segment></segments>
+ </file>
+</nzb>`
+	require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
+
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "dataSeg@test", gomock.Any(), gomock.Any()).
+		Return(nil, nntppool.ErrArticleNotFound)
+	mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "par2Seg@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, _ = w.Write([]byte("par2"))
+			return &nntppool.ArticleBody{}, nil
+		}).Times(1)
+	mockPar2Executor.EXPECT().Repair(gomock.Any(), tmpDir).Return(&Par2Error{ExitCode: 2}).Times(1)
+
+	// A nil upload pool panics if anything is uploaded.
+	result, err := RepairNzb(ctx, cfg, mockDownloadPool, nil, mockPar2Executor, nzbFile, outputFile, tmpDir)
+	require.ErrorIs(t, err, ErrTooDamaged)
+	assert.Equal(t, VerdictUnrepairable, result.Verdict)
+
+	_, err = os.Stat(outputFile)
+	assert.True(t, os.IsNotExist(err), "no nzb is written when nothing could be repaired")
+}
+
+func TestRepairNzb_FailureMode(t *testing.T) {
+	nzbContent := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <file poster="test@example.com" date="1678886400" subject="[1/2] data.mkv yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="20" number="1">dataSeg@test</segment></segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] data.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="50" number="1">par2Seg@test</segment></segments>
+ </file>
+</nzb>`
+
+	run := func(t *testing.T, mode string) (*RepairResult, error) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		nzbFile := filepath.Join(t.TempDir(), "input.nzb")
+		require.NoError(t, os.WriteFile(nzbFile, []byte(nzbContent), 0644))
+
+		mockDownloadPool := mocks.NewMockNNTPPool(ctrl)
+		mockDownloadPool.EXPECT().BodyStream(gomock.Any(), "dataSeg@test", gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("connection reset"))
+
+		cfg := config.Config{DownloadWorkers: 1, FailureMode: mode}
+		return RepairNzb(context.Background(), cfg, mockDownloadPool, nil, mocks.NewMockPar2Executor(ctrl), nzbFile, filepath.Join(t.TempDir(), "output.nzb"), t.TempDir())
+	}
+
+	t.Run("best effort", func(t *testing.T) {
+		result, err := run(t, FailureModeBestEffort)
+		require.NoError(t, err)
+		require.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[0], "data.mkv")
+		assert.Contains(t, result.Errors[0], "connection reset")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		result, err := run(t, FailureModeStrict)
+		require.ErrorIs(t, err, ErrDownloadFailed)
+		assert.Empty(t, result.Errors)
+		assert.False(t, result.Healthy)
+	})
+}
+
+func TestWriteRepairedNzb_FallbackOutputDir(t *testing.T) {
+	dir := t.TempDir()
+
+	// A regular file where the output directory should be makes the primary
+	// location unwritable, even when running as root.
+	blocker := filepath.Join(dir, "readonly")
+	require.NoError(t, os.WriteFile(blocker, nil, 0644))
+
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{{Filename: "file.bin", Groups: []string{"alt.binaries.test"}}}}
+	primary := filepath.Join(blocker, "out.nzb")
+	fallbackDir := filepath.Join(dir, "fallback")
+
+	_, err := writeRepairedNzb(context.Background(), config.Config{}, nzb, nzbLayout{}, primary, newOptions(nil))
+	require.Error(t, err)
+
+	o := newOptions(nil)
+	path, err := writeRepairedNzb(context.Background(), config.Config{FallbackOutputDir: fallbackDir}, nzb, nzbLayout{}, primary, o)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(fallbackDir, "out.nzb"), path)
+	assert.FileExists(t, path)
+	assert.True(t, o.result.OutputFallback)
+}
+
+type sinkFunc func(ctx context.Context, path string, nzb []byte) (StoredNzb, error)
+
+func (f sinkFunc) WriteNzb(ctx context.Context, path string, nzb []byte) (StoredNzb, error) {
+	return f(ctx, path, nzb)
+}
+
+func TestWriteRepairedNzb_OutputSink(t *testing.T) {
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{{Filename: "file.bin", Groups: []string{"alt.binaries.test"}}}}
+	out := filepath.Join(t.TempDir(), "show.nzb")
+
+	var got []byte
+	o := newOptions([]Option{WithOutputSink(sinkFunc(func(_ context.Context, path string, b []byte) (StoredNzb, error) {
+		assert.Equal(t, out, path)
+		got = b
+
+		return StoredNzb{Location: "s3://nzbs/show.nzb"}, nil
+	}))})
+
+	path, err := writeRepairedNzb(context.Background(), config.Config{}, nzb, nzbLayout{}, out, o)
+	require.NoError(t, err)
+	assert.Equal(t, "s3://nzbs/show.nzb", path)
+	assert.Contains(t, string(got), "alt.binaries.test")
+	assert.NoFileExists(t, out, "the sink replaces the local file")
+	assert.False(t, o.result.OutputFallback)
+}
+
+func TestWriteRepairedNzb_OutputConflict(t *testing.T) {
+	dir := t.TempDir()
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{{Filename: "file.bin", Groups: []string{"alt.binaries.test"}}}}
+	out := filepath.Join(dir, "show.nzb")
+	require.NoError(t, os.WriteFile(out, []byte("existing"), 0644))
+
+	cfg := config.Config{OutputConflict: OutputConflictVersion}
+	for _, want := range []string{"show (2).nzb", "show (3).nzb"} {
+		path, err := writeRepairedNzb(context.Background(), cfg, nzb, nzbLayout{}, out, newOptions(nil))
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, want), path)
+	}
+
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(got), "versions never replace the existing output")
+
+	o := newOptions(nil)
+	path, err := writeRepairedNzb(context.Background(), config.Config{OutputConflict: OutputConflictOverwrite}, nzb, nzbLayout{}, out, o)
+	require.NoError(t, err)
+	assert.Equal(t, out, path)
+	require.NotEmpty(t, o.result.BackupPath)
+	got, err = os.ReadFile(o.result.BackupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(got))
+}
+
+func TestMergeNzbs(t *testing.T) {
+	index := nzbparser.NzbFile{Subject: `"show.par2" yEnc (1/1)`, Segments: nzbparser.NzbSegments{{Number: 1, Id: "idx", Bytes: 10}}}
+	first := &nzbparser.Nzb{
+		Meta: map[string]string{"name": "show"},
+		Files: nzbparser.NzbFiles{
+			{Subject: `"show.mkv" yEnc (1/1)`, Segments: nzbparser.NzbSegments{{Number: 1, Id: "d1", Bytes: 100}}},
+			index,
+		},
+	}
+	second := &nzbparser.Nzb{
+		Meta: map[string]string{"name": "other", "category": "tv"},
+		Files: nzbparser.NzbFiles{
+			{Subject: `"show.vol0+1.par2" yEnc (1/1)`, Segments: nzbparser.NzbSegments{{Number: 1, Id: "v1", Bytes: 50}}},
+			index,
+		},
+	}
+
+	merged := mergeNzbs([]*nzbparser.Nzb{first, second})
+	require.Len(t, merged.Files, 3, "files listed in both nzbs are kept once")
+	assert.Equal(t, int64(160), merged.Bytes)
+	assert.Equal(t, map[string]string{"name": "show", "category": "tv"}, merged.Meta)
+
+	parFiles, rest := splitParWithRest(merged)
+	assert.Len(t, parFiles, 2)
+	assert.Len(t, rest, 1)
+}
+
+func TestDownloadWorker_Canceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The repair is canceled while the segments are being downloaded; those
+	// still report their outcome before the worker returns.
+	var calls atomic.Int64
+	pool.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, string, io.Writer, ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			calls.Add(1)
+			cancel()
+			time.Sleep(20 * time.Millisecond)
+
+			return nil, nntppool.ErrArticleNotFound
+		}).MinTimes(1)
+
+	file := nzbparser.NzbFile{Filename: "show.mkv", TotalSegments: 3, Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"},
+	}}
+	brokenSegmentCh := make(chan brokenSegment, 3)
+
+	_, _, err := downloadWorker(ctx, config.Config{DownloadWorkers: 2}, pool, file, brokenSegmentCh, nil, nil, DiskStore{Dir: t.TempDir()}, "", nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	close(brokenSegmentCh)
+	assert.Len(t, brokenSegmentCh, int(calls.Load()))
+}
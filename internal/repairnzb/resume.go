@@ -0,0 +1,306 @@
+package repairnzb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// stateDirName is the folder of the temporary directory that holds the
+// segment state of the files being downloaded, so an interrupted repair
+// resumes where it stopped.
+const stateDirName = ".state"
+
+// releaseStateName is the file of the state folder naming the NZBs the
+// state belongs to.
+const releaseStateName = "release"
+
+// First bytes of the records of a segment state file, one per segment in
+// file order. A record of fixed size per segment lets the download workers
+// write their segments concurrently.
+const (
+	segmentPending byte = '0'
+	segmentWritten byte = '1'
+	// segmentCopied is a segment copied from a file of NZBGet, without the
+	// CRC of its article.
+	segmentCopied byte = '2'
+)
+
+// segmentRecordSize is the size of a record of a segment state file: its
+// state byte, then the offset, size, CRC and article sizes of a segmentRecord.
+const segmentRecordSize = 1 + 8 + 4*4
+
+// segmentRecord is what the state keeps of a written segment: where its yEnc
+// part began in the file, its decoded size, the CRC its trailer announced and
+// the measured article size. A resumed download replays them as if the
+// segment had been downloaded again, so it is verified and the part size and
+// segment bytes are taken from it.
+type segmentRecord struct {
+	offset  int64
+	size    int
+	crc     uint32
+	article articleSize
+	// copied is set for a segment copied from a file of NZBGet.
+	copied bool
+}
+
+// appendSegmentRecord appends the record of the written segment r to b.
+func appendSegmentRecord(b []byte, r segmentRecord) []byte {
+	state := segmentWritten
+	if r.copied {
+		state = segmentCopied
+	}
+
+	b = append(b, state)
+	b = binary.LittleEndian.AppendUint64(b, uint64(r.offset))
+	b = binary.LittleEndian.AppendUint32(b, uint32(r.size))
+	b = binary.LittleEndian.AppendUint32(b, r.crc)
+	b = binary.LittleEndian.AppendUint32(b, uint32(r.article.encoded))
+	return binary.LittleEndian.AppendUint32(b, uint32(r.article.decoded))
+}
+
+// readSegmentRecord reads the record b, of segmentRecordSize bytes. It returns
+// nil for a segment that was not written.
+func readSegmentRecord(b []byte) *segmentRecord {
+	if b[0] != segmentWritten && b[0] != segmentCopied {
+		return nil
+	}
+
+	return &segmentRecord{
+		offset: int64(binary.LittleEndian.Uint64(b[1:])),
+		size:   int(binary.LittleEndian.Uint32(b[9:])),
+		crc:    binary.LittleEndian.Uint32(b[13:]),
+		article: articleSize{
+			encoded: int(binary.LittleEndian.Uint32(b[17:])),
+			decoded: int(binary.LittleEndian.Uint32(b[21:])),
+		},
+		copied: b[0] == segmentCopied,
+	}
+}
+
+// reopener is a SegmentStore that can reopen a partly downloaded file to
+// write its remaining segments. Downloads only resume in such a store.
+type reopener interface {
+	// Reopen opens the file name for writing without truncating it.
+	Reopen(name string) (SegmentFile, error)
+}
+
+// Reopen opens the file name in Dir for writing without truncating it.
+func (s DiskStore) Reopen(name string) (SegmentFile, error) {
+	f, err := os.OpenFile(filepath.Join(s.Dir, name), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// HasResumeState reports whether dir holds the segment state of an
+// interrupted repair, which a new repair of the same NZBs resumes.
+func HasResumeState(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, stateDirName, releaseStateName))
+	return err == nil
+}
+
+// prepareResume readies tmpDir for the repair of the NZBs named release.
+// The files of an interrupted repair of the same NZBs are kept so their
+// download resumes; those of another release are removed. It returns
+// whether a repair resumes.
+func prepareResume(tmpDir, release string) (bool, error) {
+	stateDir := filepath.Join(tmpDir, stateDirName)
+	recorded, err := os.ReadFile(filepath.Join(stateDir, releaseStateName))
+	switch {
+	case err == nil && string(recorded) == release:
+		return true, nil
+	case err == nil:
+		entries, err := os.ReadDir(tmpDir)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(filepath.Join(tmpDir, e.Name())); err != nil {
+				return false, err
+			}
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, err
+	}
+
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return false, err
+	}
+
+	return false, os.WriteFile(filepath.Join(stateDir, releaseStateName), []byte(release), 0644)
+}
+
+// releaseName identifies the NZBs of a repair in its state.
+func releaseName(nzbFiles []string) string {
+	names := make([]string, 0, len(nzbFiles))
+	for _, f := range nzbFiles {
+		names = append(names, filepath.Base(f))
+	}
+
+	return strings.Join(names, "\n")
+}
+
+// segmentState records which segments of a file were written, and where, in
+// <file>.state of the state folder. Its header identifies the segments by
+// their message ids, so the state of another file of the same name is never
+// taken for it. Segments that were not found stay pending, so a resumed
+// download reports them for repair again.
+type segmentState struct {
+	f      *os.File
+	header int64
+}
+
+// stateHeader is the first line of the state file of segments.
+func stateHeader(segments nzbparser.NzbSegments) []byte {
+	h := crc32.NewIEEE()
+	for _, s := range segments {
+		_, _ = h.Write([]byte(s.Id))
+		_, _ = h.Write([]byte{'\n'})
+	}
+
+	return fmt.Appendf(nil, "%08x %d\n", h.Sum32(), len(segments))
+}
+
+// loadSegmentState opens the state of the file name with segments, in file
+// order, and returns the records of those that were written, nil for the
+// others. It returns a nil state when there is no state of these segments.
+func loadSegmentState(dir, name string, segments nzbparser.NzbSegments) (*segmentState, []*segmentRecord, error) {
+	path := filepath.Join(dir, name+".state")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, err
+	}
+
+	header := stateHeader(segments)
+	if !bytes.HasPrefix(b, header) || len(b) != len(header)+len(segments)*segmentRecordSize {
+		return nil, nil, nil
+	}
+
+	written := make([]*segmentRecord, len(segments))
+	for i := range written {
+		start := len(header) + i*segmentRecordSize
+		written[i] = readSegmentRecord(b[start : start+segmentRecordSize])
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &segmentState{f: f, header: int64(len(header))}, written, nil
+}
+
+// createSegmentState creates the state of the file name with segments, in
+// file order, with none of them written.
+func createSegmentState(dir, name string, segments nzbparser.NzbSegments) (*segmentState, error) {
+	path := filepath.Join(dir, name+".state")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	header := stateHeader(segments)
+	b := append(header, bytes.Repeat([]byte{segmentPending}, len(segments)*segmentRecordSize)...)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmentState{f: f, header: int64(len(header))}, nil
+}
+
+// markWritten records that the segment at index i of the file order was
+// written as r. Nothing is recorded by a nil state.
+func (s *segmentState) markWritten(i int, r segmentRecord) error {
+	if s == nil {
+		return nil
+	}
+
+	_, err := s.f.WriteAt(appendSegmentRecord(nil, r), s.header+int64(i)*segmentRecordSize)
+	return err
+}
+
+// markPending records that the segment at index i of the file order must be
+// downloaded again. Nothing is recorded by a nil state.
+func (s *segmentState) markPending(i int) error {
+	if s == nil {
+		return nil
+	}
+
+	_, err := s.f.WriteAt(bytes.Repeat([]byte{segmentPending}, segmentRecordSize), s.header+int64(i)*segmentRecordSize)
+	return err
+}
+
+// close closes the state file. Nothing is closed by a nil state.
+func (s *segmentState) close() error {
+	if s == nil {
+		return nil
+	}
+
+	return s.f.Close()
+}
+
+// openDownload opens the file name of store to download segments, in file
+// order, into. With a state folder, a file with a state of these segments is
+// reopened and the records of the segments already written are returned; any
+// other file is created anew with a fresh state. Without one, an existing
+// file is taken for complete and no file is returned.
+func openDownload(store SegmentStore, stateDir, name string, segments nzbparser.NzbSegments) (SegmentFile, *segmentState, []*segmentRecord, error) {
+	r, ok := store.(reopener)
+	if stateDir == "" || !ok {
+		if _, err := store.Size(name); err == nil {
+			return nil, nil, nil, nil
+		}
+
+		f, err := store.Create(name)
+		return f, nil, nil, err
+	}
+
+	state, written, err := loadSegmentState(stateDir, name, segments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if state != nil {
+		if _, err := store.Size(name); err == nil {
+			f, err := r.Reopen(name)
+			if err != nil {
+				_ = state.close()
+				return nil, nil, nil, err
+			}
+
+			return f, state, written, nil
+		}
+		_ = state.close()
+	}
+
+	state, err = createSegmentState(stateDir, name, segments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	f, err := store.Create(name)
+	if err != nil {
+		_ = state.close()
+		return nil, nil, nil, err
+	}
+
+	return f, state, nil, nil
+}
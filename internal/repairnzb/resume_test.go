@@ -0,0 +1,186 @@
+package repairnzb
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPrepareResume(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	resumed, err := prepareResume(tmpDir, "show.nzb")
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	assert.True(t, HasResumeState(tmpDir))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "show.mkv"), []byte("first"), 0644))
+
+	resumed, err = prepareResume(tmpDir, "show.nzb")
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.FileExists(t, filepath.Join(tmpDir, "show.mkv"))
+
+	resumed, err = prepareResume(tmpDir, "other.nzb")
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	assert.NoFileExists(t, filepath.Join(tmpDir, "show.mkv"), "the files of another release are removed")
+	assert.True(t, HasResumeState(tmpDir))
+}
+
+func TestSegmentState(t *testing.T) {
+	dir := t.TempDir()
+	segments := nzbparser.NzbSegments{{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"}}
+
+	state, written, err := loadSegmentState(dir, "show.mkv", segments)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+	assert.Nil(t, written)
+
+	state, err = createSegmentState(dir, "show.mkv", segments)
+	require.NoError(t, err)
+	first := segmentRecord{offset: 0, size: 700, crc: 0xdeadbeef, article: articleSize{encoded: 720, decoded: 700}}
+	second := segmentRecord{offset: 700, size: 700, copied: true}
+	third := segmentRecord{offset: 1 << 33, size: 300, crc: 1, article: articleSize{encoded: 310, decoded: 300}}
+	require.NoError(t, state.markWritten(0, first))
+	require.NoError(t, state.markWritten(1, second))
+	require.NoError(t, state.markWritten(2, third))
+	require.NoError(t, state.close())
+
+	state, written, err = loadSegmentState(dir, "show.mkv", segments)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, []*segmentRecord{&first, &second, &third}, written)
+	require.NoError(t, state.markPending(2))
+	require.NoError(t, state.close())
+
+	state, written, err = loadSegmentState(dir, "show.mkv", segments)
+	require.NoError(t, err)
+	assert.Equal(t, []*segmentRecord{&first, &second, nil}, written)
+	require.NoError(t, state.close())
+
+	// The state of other segments is not taken for the file.
+	state, _, err = loadSegmentState(dir, "show.mkv", segments[:2])
+	require.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+func TestDownloadWorker_Resume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	second := []byte("secnd")
+	pool.EXPECT().BodyStream(gomock.Any(), "2@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(second)
+
+			return &nntppool.ArticleBody{ExpectedCRC: crc32.ChecksumIEEE(second)}, err
+		}).Times(1)
+
+	file := nzbparser.NzbFile{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test", Bytes: 5}, {Number: 2, Id: "2@test", Bytes: 5},
+	}}
+
+	// An interrupted download wrote the first segment only.
+	tmpDir := t.TempDir()
+	stateDir := filepath.Join(tmpDir, stateDirName)
+	state, err := createSegmentState(stateDir, file.Filename, file.Segments)
+	require.NoError(t, err)
+	require.NoError(t, state.markWritten(0, segmentRecord{size: 5, crc: crc32.ChecksumIEEE([]byte("first"))}))
+	require.NoError(t, state.close())
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, file.Filename), []byte("first"), 0644))
+
+	store := DiskStore{Dir: tmpDir}
+	segments, written, err := downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, nil, nil, store, stateDir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), segments)
+	assert.Equal(t, int64(5), written)
+
+	b, err := os.ReadFile(filepath.Join(tmpDir, file.Filename))
+	require.NoError(t, err)
+	assert.Equal(t, "firstsecnd", string(b))
+
+	state, done, err := loadSegmentState(stateDir, file.Filename, file.Segments)
+	require.NoError(t, err)
+	require.Len(t, done, 2)
+	require.NotNil(t, done[1])
+	assert.Equal(t, segmentRecord{offset: 5, size: 5, crc: crc32.ChecksumIEEE(second)}, *done[1])
+	require.NoError(t, state.close())
+
+	// A file without a state is downloaded again rather than taken for
+	// complete.
+	require.NoError(t, os.Remove(filepath.Join(stateDir, file.Filename+".state")))
+	pool.EXPECT().BodyStream(gomock.Any(), "1@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write([]byte("first"))
+
+			return &nntppool.ArticleBody{}, err
+		}).Times(1)
+	pool.EXPECT().BodyStream(gomock.Any(), "2@test", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(second)
+
+			return &nntppool.ArticleBody{}, err
+		}).Times(1)
+
+	segments, _, err = downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, nil, nil, store, stateDir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), segments)
+}
+
+func TestDownloadWorker_ResumeUnevenParts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	// Nothing is downloaded again.
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	file := nzbparser.NzbFile{Filename: "show.mkv", TotalSegments: 3, Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test", Bytes: 1}, {Number: 2, Id: "2@test", Bytes: 1}, {Number: 3, Id: "3@test", Bytes: 1},
+	}}
+	parts := []string{"aaaaaaaa", "bbbbbbbb", "cc"}
+
+	// An interrupted download wrote every segment of a file whose last part
+	// is much shorter than the others.
+	tmpDir := t.TempDir()
+	stateDir := filepath.Join(tmpDir, stateDirName)
+	state, err := createSegmentState(stateDir, file.Filename, file.Segments)
+	require.NoError(t, err)
+	var offset int64
+	for i, part := range parts {
+		require.NoError(t, state.markWritten(i, segmentRecord{
+			offset:  offset,
+			size:    len(part),
+			crc:     crc32.ChecksumIEEE([]byte(part)),
+			article: articleSize{encoded: len(part) + 40, decoded: len(part)},
+		}))
+		offset += int64(len(part))
+	}
+	require.NoError(t, state.close())
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, file.Filename), []byte("aaaaaaaabbbbbbbbcc"), 0644))
+
+	checks := &downloadChecks{}
+	segments, _, err := downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, checks, nil, DiskStore{Dir: tmpDir}, stateDir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), segments)
+
+	// The part size comes from the records rather than an even split of the
+	// file, which would put the repaired segments at the wrong offsets.
+	partSize := checks.partSize(file.TotalSegments)
+	assert.Equal(t, int64(8), partSize)
+	assert.Equal(t, int64(8), decodedPartSize(offset, 3, partSize))
+	assert.Equal(t, articleSize{encoded: 42, decoded: 2}, checks.articleSizes()[3])
+
+	require.Len(t, checks.checks, 3)
+	damaged, err := verifySegments(context.Background(), DiskStore{Dir: tmpDir}, checks.checks, 1)
+	require.NoError(t, err)
+	assert.Empty(t, damaged, "the replayed segments verify at their recorded offsets")
+}
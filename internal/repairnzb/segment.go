@@ -1,8 +1,78 @@
 package repairnzb
 
-import "github.com/Tensai75/nzbparser"
+import (
+	"bytes"
+	"io"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+)
 
 type brokenSegment struct {
 	segment *nzbparser.NzbSegment
 	file    *nzbparser.NzbFile
+	// reason is DamageCRC for segments that failed verification, empty for
+	// missing ones. offset and size are only known for the former.
+	reason string
+	offset int64
+	size   int
+}
+
+// segmentWriter writes the decoded bytes of a downloaded segment to the file
+// as they arrive, at the offset of the yEnc part header. Without one, the
+// first part starts at the beginning of the file and later parts are buffered
+// and placed by their number and size.
+type segmentWriter struct {
+	file   io.WriterAt
+	number int
+
+	offset int64
+	// direct tells that offset is known and bytes go straight to the file.
+	direct bool
+	n      int64
+	buf    bytes.Buffer
+}
+
+func newSegmentWriter(file io.WriterAt, number int) *segmentWriter {
+	w := &segmentWriter{file: file, number: number}
+	w.onMeta(nntppool.YEncMeta{})
+
+	return w
+}
+
+// onMeta takes the offset from the yEnc headers of an article. It is called
+// before every attempt to decode the article, which starts the segment over.
+func (w *segmentWriter) onMeta(m nntppool.YEncMeta) {
+	w.n = 0
+	w.buf.Reset()
+	w.offset, w.direct = 0, w.number == 1
+	if m.PartSize > 0 {
+		w.offset, w.direct = m.PartBegin, true
+	}
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	if !w.direct {
+		return w.buf.Write(p)
+	}
+
+	n, err := w.file.WriteAt(p, w.offset+w.n)
+	w.n += int64(n)
+
+	return n, err
+}
+
+// finish writes a buffered segment and returns where the segment lies in the
+// file.
+func (w *segmentWriter) finish() (offset int64, size int, err error) {
+	if w.direct {
+		return w.offset, int(w.n), nil
+	}
+
+	w.offset = int64(w.number-1) * int64(w.buf.Len())
+	if _, err := w.file.WriteAt(w.buf.Bytes(), w.offset); err != nil {
+		return 0, 0, err
+	}
+
+	return w.offset, w.buf.Len(), nil
 }
@@ -0,0 +1,90 @@
+package repairnzb
+
+import (
+	"github.com/Tensai75/nzbparser"
+)
+
+// articleSize is the measured size of a downloaded article: the yEnc bytes
+// read from the server and the bytes they decoded to.
+type articleSize struct {
+	encoded int
+	decoded int
+}
+
+// measure records the size of the article of segment number. Like add, it
+// records nothing on a nil downloadChecks.
+func (d *downloadChecks) measure(number int, size articleSize) {
+	if d == nil || size.encoded <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sizes == nil {
+		d.sizes = make(map[int]articleSize)
+	}
+	d.sizes[number] = size
+}
+
+// articleSizes returns the measured sizes by segment number.
+func (d *downloadChecks) articleSizes() map[int]articleSize {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.sizes
+}
+
+// wrongSegmentBytes reports whether declared, the bytes an NZB gives for a
+// segment, cannot be the size of the article measured as size. Posters count
+// the article a little differently, some with its headers, so only a size
+// below the decoded data or more than a tenth over the article is wrong.
+func wrongSegmentBytes(declared int, size articleSize) bool {
+	return declared < size.decoded || declared > size.encoded+size.encoded/10
+}
+
+// correctSegmentBytes replaces the bytes of the segments of nzb whose
+// declared size is wrong with the measured article size, taken from sizes by
+// file name and segment number, and recomputes the file and NZB totals. It
+// returns the number of segments corrected.
+func correctSegmentBytes(nzb *nzbparser.Nzb, sizes map[string]map[int]articleSize) int {
+	corrected := 0
+	for i := range nzb.Files {
+		file := &nzb.Files[i]
+		measured := sizes[file.Filename]
+		if len(measured) == 0 {
+			continue
+		}
+
+		for j := range file.Segments {
+			s := &file.Segments[j]
+			size, ok := measured[s.Number]
+			if !ok || !wrongSegmentBytes(s.Bytes, size) {
+				continue
+			}
+
+			s.Bytes = size.encoded
+			corrected++
+		}
+	}
+
+	if corrected == 0 {
+		return 0
+	}
+
+	nzb.Bytes = 0
+	for i := range nzb.Files {
+		file := &nzb.Files[i]
+		file.Bytes = 0
+		for _, s := range file.Segments {
+			file.Bytes += int64(s.Bytes)
+		}
+		nzb.Bytes += file.Bytes
+	}
+
+	return corrected
+}
@@ -0,0 +1,58 @@
+package repairnzb
+
+import (
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrongSegmentBytes(t *testing.T) {
+	size := articleSize{encoded: 10000, decoded: 9700}
+
+	assert.False(t, wrongSegmentBytes(10000, size))
+	assert.False(t, wrongSegmentBytes(10600, size), "a size with the headers is kept")
+	assert.False(t, wrongSegmentBytes(9800, size))
+	assert.True(t, wrongSegmentBytes(0, size))
+	assert.True(t, wrongSegmentBytes(9000, size), "smaller than the decoded data")
+	assert.True(t, wrongSegmentBytes(20000, size))
+}
+
+func TestCorrectSegmentBytes(t *testing.T) {
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{
+		{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+			{Number: 1, Id: "1@test", Bytes: 10000},
+			{Number: 2, Id: "2@test", Bytes: 1},
+			{Number: 3, Id: "3@test", Bytes: 1},
+		}},
+		{Filename: "show.par2", Segments: nzbparser.NzbSegments{
+			{Number: 1, Id: "p@test", Bytes: 500},
+		}},
+	}}
+
+	corrected := correctSegmentBytes(nzb, map[string]map[int]articleSize{
+		"show.mkv": {
+			1: {encoded: 10050, decoded: 9700},
+			2: {encoded: 10100, decoded: 9700},
+		},
+	})
+
+	assert.Equal(t, 1, corrected)
+	assert.Equal(t, 10000, nzb.Files[0].Segments[0].Bytes, "a plausible size is kept")
+	assert.Equal(t, 10100, nzb.Files[0].Segments[1].Bytes)
+	assert.Equal(t, 1, nzb.Files[0].Segments[2].Bytes, "a segment not downloaded is kept")
+	assert.Equal(t, int64(20101), nzb.Files[0].Bytes)
+	assert.Equal(t, int64(500), nzb.Files[1].Bytes)
+	assert.Equal(t, int64(20601), nzb.Bytes)
+}
+
+func TestDownloadChecks_Measure(t *testing.T) {
+	var none *downloadChecks
+	none.measure(1, articleSize{encoded: 10})
+	assert.Nil(t, none.articleSizes())
+
+	checks := &downloadChecks{}
+	checks.measure(1, articleSize{encoded: 10, decoded: 8})
+	checks.measure(2, articleSize{})
+	assert.Equal(t, map[int]articleSize{1: {encoded: 10, decoded: 8}}, checks.articleSizes())
+}
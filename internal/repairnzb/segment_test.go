@@ -0,0 +1,59 @@
+package repairnzb
+
+import (
+	"testing"
+
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferAt is an io.WriterAt over a byte slice that grows as needed.
+type bufferAt struct {
+	b []byte
+}
+
+func (w *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(w.b) {
+		w.b = append(w.b, make([]byte, end-len(w.b))...)
+	}
+
+	return copy(w.b[off:], p), nil
+}
+
+func TestSegmentWriter(t *testing.T) {
+	file := &bufferAt{}
+
+	// The short last part lands at the offset of its part header.
+	last := newSegmentWriter(file, 3)
+	last.onMeta(nntppool.YEncMeta{Part: 3, PartBegin: 8, PartSize: 2})
+	_, err := last.Write([]byte("ij"))
+	require.NoError(t, err)
+	offset, size, err := last.finish()
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), offset)
+	assert.Equal(t, 2, size)
+
+	// A retry starts the segment over.
+	first := newSegmentWriter(file, 1)
+	_, err = first.Write([]byte("xx"))
+	require.NoError(t, err)
+	first.onMeta(nntppool.YEncMeta{})
+	_, err = first.Write([]byte("abcd"))
+	require.NoError(t, err)
+	offset, size, err = first.finish()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, 4, size)
+
+	// Without a part header, a later part is placed by its number.
+	second := newSegmentWriter(file, 2)
+	_, err = second.Write([]byte("efgh"))
+	require.NoError(t, err)
+	offset, size, err = second.finish()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), offset)
+	assert.Equal(t, 4, size)
+
+	assert.Equal(t, "abcdefghij", string(file.b))
+}
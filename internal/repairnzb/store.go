@@ -0,0 +1,74 @@
+package repairnzb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SegmentStore holds the files of a repair, named after the files of the
+// NZB, while their segments are downloaded, verified and uploaded again.
+// par2 reads and repairs the files in the temporary directory, so the store
+// of a repair that reaches par2 must keep them there, as DiskStore does.
+type SegmentStore interface {
+	// Create creates the file name, replacing an existing one.
+	Create(name string) (SegmentFile, error)
+	// Open opens the file name for reading.
+	Open(name string) (SegmentFile, error)
+	// Size returns the size of the file name, or an error wrapping
+	// fs.ErrNotExist when there is none.
+	Size(name string) (int64, error)
+}
+
+// SegmentFile is a file of a SegmentStore, written and read at the offsets
+// of its segments, concurrently.
+type SegmentFile interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// WithSegmentStore keeps the files of the repair in s instead of the
+// temporary directory. A nil s keeps the default.
+func WithSegmentStore(s SegmentStore) Option {
+	return func(o *options) {
+		if s != nil {
+			o.store = s
+		}
+	}
+}
+
+// DiskStore keeps the files of a repair in Dir, the temporary directory.
+type DiskStore struct {
+	Dir string
+}
+
+// Create creates the file name in Dir.
+func (s DiskStore) Create(name string) (SegmentFile, error) {
+	f, err := os.Create(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Open opens the file name in Dir.
+func (s DiskStore) Open(name string) (SegmentFile, error) {
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Size returns the size of the file name in Dir.
+func (s DiskStore) Size(name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.Dir, name))
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
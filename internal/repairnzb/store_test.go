@@ -0,0 +1,170 @@
+package repairnzb
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// memoryStore is a SegmentStore keeping its files in memory.
+type memoryStore struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{files: make(map[string]*memoryFile)}
+}
+
+func (m *memoryStore) Create(name string) (SegmentFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := &memoryFile{}
+	m.files[name] = f
+
+	return f, nil
+}
+
+func (m *memoryStore) Open(name string) (SegmentFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, fmt.Errorf("open %s: %w", name, fs.ErrNotExist)
+	}
+
+	return f, nil
+}
+
+func (m *memoryStore) Size(name string) (int64, error) {
+	m.mu.Lock()
+	f, ok := m.files[name]
+	m.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("stat %s: %w", name, fs.ErrNotExist)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return int64(len(f.data)), nil
+}
+
+// write stores data as the file name.
+func (m *memoryStore) write(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[name] = &memoryFile{data: data}
+}
+
+type memoryFile struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memoryFile) Close() error { return nil }
+
+func TestDownloadWorker_SegmentStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	pool := mocks.NewMockNNTPPool(ctrl)
+
+	parts := map[string][]byte{"1@test": []byte("first"), "2@test": []byte("secnd")}
+	pool.EXPECT().BodyStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, id string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+			_, err := w.Write(parts[id])
+
+			return &nntppool.ArticleBody{ExpectedCRC: crc32.ChecksumIEEE(parts[id])}, err
+		}).Times(2)
+
+	file := nzbparser.NzbFile{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test", Bytes: 5}, {Number: 2, Id: "2@test", Bytes: 5},
+	}}
+
+	store := newMemoryStore()
+	checks := &downloadChecks{}
+	segments, written, err := downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, checks, nil, store, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), segments)
+	assert.Equal(t, int64(10), written)
+	assert.Equal(t, "firstsecnd", string(store.files["show.mkv"].data))
+
+	damaged, err := verifySegments(context.Background(), store, checks.checks, 1)
+	require.NoError(t, err)
+	assert.Empty(t, damaged)
+
+	// A file already in the store is not downloaded again.
+	_, _, err = downloadWorker(context.Background(), config.Config{DownloadWorkers: 2}, pool, file, nil, nil, nil, store, "", nil)
+	require.NoError(t, err)
+}
+
+func TestDiskStore(t *testing.T) {
+	store := DiskStore{Dir: t.TempDir()}
+
+	_, err := store.Size("show.mkv")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	f, err := store.Create("show.mkv")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("secnd"), 5)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("first"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	size, err := store.Size("show.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+
+	f, err = store.Open("show.mkv")
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "secnd", string(buf))
+}
@@ -0,0 +1,68 @@
+package repairnzb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Built-in subjects of repaired segments and recreated par2 files, used when
+// upload.subject_template is empty.
+const (
+	segmentSubjectTemplate = `[{file}/{files}] {filename} - "" yEnc ({part}/{parts})`
+	par2SubjectTemplate    = `[{file}/{files}] "{filename}" yEnc ({part}/{parts})`
+)
+
+// subjectVar matches a {variable} of a subject template.
+var subjectVar = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// subjectVars are the variables a subject template may use.
+var subjectVars = []string{"file", "files", "filename", "part", "parts"}
+
+// ValidateSubjectTemplate rejects subject templates with unknown variables.
+func ValidateSubjectTemplate(tmpl string) error {
+	for _, m := range subjectVar.FindAllStringSubmatch(tmpl, -1) {
+		known := false
+		for _, v := range subjectVars {
+			known = known || m[1] == v
+		}
+		if !known {
+			return fmt.Errorf("unknown variable {%s} in subject_template, expected one of %s", m[1], strings.Join(subjectVars, ", "))
+		}
+	}
+
+	return nil
+}
+
+// articleSubject is the position of an article in the post, which a subject
+// template lays out.
+type articleSubject struct {
+	File, Files int
+	Filename    string
+	Part, Parts int64
+}
+
+// render expands the variables of tmpl, or of fallback when tmpl is empty.
+func (a articleSubject) render(tmpl, fallback string) string {
+	if tmpl == "" {
+		tmpl = fallback
+	}
+
+	return subjectVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		switch m[1 : len(m)-1] {
+		case "file":
+			return strconv.Itoa(a.File)
+		case "files":
+			return strconv.Itoa(a.Files)
+		case "filename":
+			return a.Filename
+		case "part":
+			return strconv.FormatInt(a.Part, 10)
+		case "parts":
+			return strconv.FormatInt(a.Parts, 10)
+		}
+
+		return m
+	})
+}
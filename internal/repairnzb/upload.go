@@ -0,0 +1,353 @@
+package repairnzb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// segmentUploader posts the repaired segments of the broken files and points
+// the NZB at the new articles. Each file is posted once start is called with
+// its name, so the files par2 is done with are posted while it still works on
+// the others. The files share cfg.UploadWorkers posting goroutines.
+//
+// The articles carry the part size, file number and totals of the original
+// post, so they cannot be told apart from the articles they replace.
+type segmentUploader struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	store      SegmentStore
+	cfg        config.Config
+	uploadPool NNTPPool
+	nzb        *nzbparser.Nzb
+	files      map[string]*nzbparser.NzbFile
+	broken     map[*nzbparser.NzbFile][]brokenSegment
+	workers    chan struct{}
+	segments   int64
+
+	// partSizes holds the decoded size of the full parts of the original
+	// post, by file name, when the download saw one.
+	partSizes map[string]int64
+	// numbers holds the number of every file in the release, and totalFiles
+	// the number of files of the release.
+	numbers    map[string]int
+	totalFiles int
+
+	// progress starts with the first file, so the upload phase is not shown
+	// before par2 completes a file.
+	progressOnce sync.Once
+	progress     *progressTracker
+
+	mu      sync.Mutex
+	started map[*nzbparser.NzbFile]bool
+	err     error
+
+	wg                 sync.WaitGroup
+	replaced, uploaded atomic.Int64
+}
+
+func newSegmentUploader(
+	ctx context.Context,
+	brokenSegments map[*nzbparser.NzbFile][]brokenSegment,
+	store SegmentStore,
+	cfg config.Config,
+	uploadPool NNTPPool,
+	nzb *nzbparser.Nzb,
+	partSizes map[string]int64,
+) *segmentUploader {
+	var segments int64
+	files := make(map[string]*nzbparser.NzbFile, len(brokenSegments))
+	for f, bs := range brokenSegments {
+		segments += int64(len(bs))
+		files[f.Filename] = f
+	}
+
+	// The numbers are taken before the uploads replace the files of nzb.
+	numbers := make(map[string]int, len(nzb.Files))
+	for i, f := range nzb.Files {
+		numbers[f.Filename] = fileNumber(f, i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &segmentUploader{
+		ctx:        ctx,
+		cancel:     cancel,
+		store:      store,
+		cfg:        cfg,
+		uploadPool: uploadPool,
+		nzb:        nzb,
+		files:      files,
+		broken:     brokenSegments,
+		workers:    make(chan struct{}, max(cfg.UploadWorkers, 1)),
+		segments:   segments,
+		partSizes:  partSizes,
+		numbers:    numbers,
+		totalFiles: max(nzb.TotalFiles, len(nzb.Files)),
+		started:    make(map[*nzbparser.NzbFile]bool, len(brokenSegments)),
+	}
+}
+
+// fileNumber returns the number of the i-th file of an NZB: the one its
+// subject announces, or its place in the NZB when the subject has none.
+func fileNumber(f nzbparser.NzbFile, i int) int {
+	if f.Number > 0 {
+		return f.Number
+	}
+
+	return i + 1
+}
+
+// decodedPartSize returns the decoded size of the full parts of a file of
+// fileSize bytes posted in totalSegments parts. partSize is the size the
+// download saw, if any and it fits the file; otherwise the file is assumed
+// split evenly.
+func decodedPartSize(fileSize, totalSegments, partSize int64) int64 {
+	if partSize > 0 && (totalSegments-1)*partSize < fileSize && totalSegments*partSize >= fileSize {
+		return partSize
+	}
+
+	return (fileSize + totalSegments - 1) / totalSegments
+}
+
+// start starts posting the repaired segments of the file name, unless it has
+// no broken segments or was started before.
+func (u *segmentUploader) start(name string) {
+	f, ok := u.files[name]
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.started[f] {
+		return
+	}
+	u.started[f] = true
+	u.progressOnce.Do(func() {
+		u.progress = startProgress(u.ctx, PhaseUpload, ProgressSegments, u.segments)
+	})
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+
+		if err := u.uploadFile(f, u.broken[f]); err != nil {
+			u.fail(err)
+		}
+	}()
+}
+
+// fail records the first error and stops the uploads.
+func (u *segmentUploader) fail(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.err == nil {
+		u.err = err
+		u.cancel()
+	}
+}
+
+// finish starts the files not started yet, waits for every upload and returns
+// the number of replaced segments, the bytes posted and the first error.
+func (u *segmentUploader) finish() (replaced int, uploaded int64, err error) {
+	for name := range u.files {
+		u.start(name)
+	}
+
+	u.wg.Wait()
+	u.progress.Finish()
+	u.cancel()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return int(u.replaced.Load()), u.uploaded.Load(), u.err
+}
+
+// abort stops the started uploads and waits for them.
+func (u *segmentUploader) abort() {
+	u.cancel()
+	u.wg.Wait()
+	u.progress.Finish()
+}
+
+// uploadFile posts the broken segments bs of nzbFile from the repaired file
+// and replaces the file in the NZB once all are posted.
+func (u *segmentUploader) uploadFile(nzbFile *nzbparser.NzbFile, bs []brokenSegment) error {
+	ctx := u.ctx
+	if ctx.Err() != nil {
+		slog.ErrorContext(ctx, "repair canceled")
+
+		return nil
+	}
+
+	fileSize, err := u.store.Size(nzbFile.Filename)
+	if err != nil {
+		slog.With("err", err).ErrorContext(ctx, "failed to get file info")
+
+		return err
+	}
+
+	tmpFile, err := u.store.Open(nzbFile.Filename)
+	if err != nil {
+		slog.With("err", err).ErrorContext(ctx, "failed to open file")
+
+		return err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+	}()
+
+	totalSegments := int64(nzbFile.TotalSegments)
+	// s.segment.Bytes is the yEnc-encoded article size (~10% larger than decoded binary).
+	// The repaired file contains decoded binary data, so offsets follow the
+	// decoded part size of the original post.
+	decodedSegSize := decodedPartSize(fileSize, totalSegments, u.partSizes[nzbFile.Filename])
+	if maxSize := u.cfg.MaxArticleSize(); maxSize > 0 && decodedSegSize > maxSize {
+		return fmt.Errorf("%w: the parts of %s have %d bytes, the smallest max_article_size of the upload providers is %d", ErrArticleTooLarge, nzbFile.Filename, decodedSegSize, maxSize)
+	}
+
+	p := pool.New().WithContext(ctx).WithCancelOnError()
+
+	for _, s := range bs {
+		select {
+		case u.workers <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		p.Go(func(ctx context.Context) error {
+			defer func() {
+				<-u.workers
+			}()
+
+			if ctx.Err() != nil {
+				slog.ErrorContext(ctx, "repair canceled")
+
+				return nil
+			}
+
+			// Stream the segment from the file using decoded segment boundaries.
+			segNum := int64(s.segment.Number)
+			readOffset := (segNum - 1) * decodedSegSize
+			readSize := decodedSegSize
+			if segNum >= totalSegments {
+				readSize = fileSize - readOffset
+			}
+
+			partSize := readSize
+			date := time.Unix(int64(nzbFile.Date), 0)
+
+			subject := articleSubject{
+				File:     u.numbers[nzbFile.Filename],
+				Files:    u.totalFiles,
+				Filename: s.file.Filename,
+				Part:     segNum,
+				Parts:    totalSegments,
+			}.render(u.cfg.Upload.SubjectTemplate, segmentSubjectTemplate)
+
+			var fName string
+
+			if u.cfg.Upload.ObfuscationPolicy == config.ObfuscationPolicyNone {
+				fName = s.file.Filename
+			} else {
+				fName = rand.Text()
+				subject = rand.Text()
+			}
+
+			headers := nntppool.PostHeaders{
+				From:       nzbFile.Poster,
+				Subject:    subject,
+				Newsgroups: nzbFile.Groups,
+				Date:       date.UTC(),
+			}
+
+			meta := rapidyenc.Meta{
+				FileName:   fName,
+				FileSize:   fileSize,
+				PartSize:   partSize,
+				PartNumber: segNum,
+				Offset:     readOffset,
+				TotalParts: totalSegments,
+			}
+
+			// Upload the segment, encoding it as it is read from the file.
+			msgId, err := postRepairedArticle(ctx, u.uploadPool, headers, func() io.Reader { return segmentReader(tmpFile, readOffset, readSize) }, meta)
+			if err != nil {
+				slog.With("err", err).ErrorContext(ctx, "failed to upload segment")
+
+				return err
+			}
+
+			slog.InfoContext(ctx, fmt.Sprintf("Uploaded segment %s", s.segment.Id))
+			reportProgress(ctx)
+			u.progress.Add(1)
+			u.replaced.Add(1)
+			u.uploaded.Add(readSize)
+			nzbFile.Segments[s.segment.Number-1].Id = msgId
+
+			return nil
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		slog.With("err", err).ErrorContext(ctx, "failed to upload segments")
+
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	slog.InfoContext(ctx, fmt.Sprintf("Uploaded %d segments for file %s", len(bs), nzbFile.Filename))
+
+	// Replace the original broken file in the nzb with the repaired version
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i, f := range u.nzb.Files {
+		if f.Filename == nzbFile.Filename {
+			u.nzb.Files[i] = *nzbFile
+			break
+		}
+	}
+
+	return nil
+}
+
+// segmentReader streams size bytes of f from off, so a segment goes to the
+// yEnc encoder without being held in memory. It fails with
+// io.ErrUnexpectedEOF when f ends early, instead of posting a short article.
+func segmentReader(f io.ReaderAt, off, size int64) io.Reader {
+	return &exactReader{r: io.NewSectionReader(f, off, size), left: size}
+}
+
+// exactReader reads from r, which must deliver left bytes.
+type exactReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.left -= int64(n)
+	if err == io.EOF && e.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,152 @@
+package repairnzb
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/config"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSegmentUploader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := newMemoryStore()
+	store.write("data.bin", []byte("abcdefgh"))
+
+	nzb := &nzbparser.Nzb{TotalFiles: 1, Files: nzbparser.NzbFiles{{
+		Filename:      "data.bin",
+		TotalSegments: 2,
+		Segments:      nzbparser.NzbSegments{{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}},
+	}}}
+	file := nzb.Files[0]
+	broken := map[*nzbparser.NzbFile][]brokenSegment{
+		&file: {{segment: &file.Segments[1], file: &file}},
+	}
+
+	uploadPool := mocks.NewMockNNTPPool(ctrl)
+	uploadPool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+			data, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, "efgh", string(data))
+			assert.Equal(t, int64(2), meta.PartNumber)
+			assert.Equal(t, int64(2), meta.TotalParts)
+			assert.Equal(t, int64(4), meta.Offset)
+			assert.Equal(t, `[1/1] data.bin - "" yEnc (2/2)`, headers.Subject)
+
+			return &nntppool.PostResult{}, nil
+		}).Times(1)
+
+	u := newSegmentUploader(context.Background(), broken, store, config.Config{UploadWorkers: 2, Upload: config.UploadConfig{ObfuscationPolicy: config.ObfuscationPolicyNone}}, uploadPool, nzb, nil)
+	u.start("data.bin")
+	u.start("data.bin")
+	u.start("intact.bin")
+
+	replaced, uploaded, err := u.finish()
+	require.NoError(t, err)
+	assert.Equal(t, 1, replaced)
+	assert.Equal(t, int64(4), uploaded)
+	assert.Equal(t, "1@test", nzb.Files[0].Segments[0].Id)
+	assert.NotEqual(t, "2@test", nzb.Files[0].Segments[1].Id, "the nzb references the new article")
+}
+
+func TestSegmentUploaderKeepsOriginalLayout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := newMemoryStore()
+	store.write("data.bin", []byte("abcdefghi"))
+
+	// The release announces 5 files in its subjects; the file is the third.
+	nzb := &nzbparser.Nzb{TotalFiles: 5, Files: nzbparser.NzbFiles{{
+		Number:        3,
+		Filename:      "data.bin",
+		TotalSegments: 3,
+		Segments:      nzbparser.NzbSegments{{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"}},
+	}}}
+	file := nzb.Files[0]
+	broken := map[*nzbparser.NzbFile][]brokenSegment{
+		&file: {{segment: &file.Segments[1], file: &file}},
+	}
+
+	uploadPool := mocks.NewMockNNTPPool(ctrl)
+	uploadPool.EXPECT().PostYenc(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, headers nntppool.PostHeaders, body io.Reader, meta rapidyenc.Meta) (*nntppool.PostResult, error) {
+			data, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, "efgh", string(data), "the part size of the original post places the segment")
+			assert.Equal(t, int64(4), meta.Offset)
+			assert.Equal(t, int64(3), meta.TotalParts)
+			assert.Equal(t, `[3/5] data.bin - "" yEnc (2/3)`, headers.Subject)
+
+			return &nntppool.PostResult{}, nil
+		}).Times(1)
+
+	u := newSegmentUploader(context.Background(), broken, store, config.Config{UploadWorkers: 1, Upload: config.UploadConfig{ObfuscationPolicy: config.ObfuscationPolicyNone}}, uploadPool, nzb, map[string]int64{"data.bin": 4})
+	_, _, err := u.finish()
+	require.NoError(t, err)
+}
+
+func TestSegmentUploaderRejectsOversizedArticles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := newMemoryStore()
+	store.write("data.bin", []byte("abcdefgh"))
+
+	nzb := &nzbparser.Nzb{TotalFiles: 1, Files: nzbparser.NzbFiles{{
+		Filename:      "data.bin",
+		TotalSegments: 2,
+		Segments:      nzbparser.NzbSegments{{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}},
+	}}}
+	file := nzb.Files[0]
+	broken := map[*nzbparser.NzbFile][]brokenSegment{
+		&file: {{segment: &file.Segments[1], file: &file}},
+	}
+
+	// Nothing is posted.
+	uploadPool := mocks.NewMockNNTPPool(ctrl)
+
+	cfg := config.Config{UploadWorkers: 1, UploadProviders: []config.ProviderConfig{{Host: "a", MaxArticleSize: 3}}}
+	u := newSegmentUploader(context.Background(), broken, store, cfg, uploadPool, nzb, nil)
+	_, _, err := u.finish()
+	assert.ErrorIs(t, err, ErrArticleTooLarge)
+}
+
+func TestDecodedPartSize(t *testing.T) {
+	assert.Equal(t, int64(4), decodedPartSize(9, 3, 4), "the part size seen on download")
+	assert.Equal(t, int64(3), decodedPartSize(9, 3, 0), "an even split without one")
+	assert.Equal(t, int64(3), decodedPartSize(9, 3, 5), "a part size that does not fit the file")
+	assert.Equal(t, int64(3), decodedPartSize(9, 3, 2), "a part size too small for the file")
+}
+
+func TestSegmentReader(t *testing.T) {
+	file := strings.NewReader("abcdefgh")
+
+	data, err := io.ReadAll(segmentReader(file, 4, 4))
+	require.NoError(t, err)
+	assert.Equal(t, "efgh", string(data))
+
+	_, err = io.ReadAll(segmentReader(file, 6, 4))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "a short file does not post a short article")
+}
+
+func TestArticleSubject(t *testing.T) {
+	a := articleSubject{File: 3, Files: 12, Filename: "movie.mkv", Part: 7, Parts: 40}
+
+	assert.Equal(t, `[3/12] movie.mkv - "" yEnc (7/40)`, a.render("", segmentSubjectTemplate))
+	assert.Equal(t, `movie.mkv [3/12] - yEnc (7/40)`, a.render("{filename} [{file}/{files}] - yEnc ({part}/{parts})", segmentSubjectTemplate))
+
+	require.NoError(t, ValidateSubjectTemplate(`[{file}/{files}] "{filename}" yEnc ({part}/{parts})`))
+	require.Error(t, ValidateSubjectTemplate("{name} yEnc"))
+}
@@ -3,6 +3,8 @@ package repairnzb
 import (
 	"math/rand"
 	"time"
+
+	"github.com/Tensai75/nzbparser"
 )
 
 func generateRandomMessageID() string {
@@ -20,3 +22,23 @@ func generateRandomString(size int) string {
 	}
 	return string(result)
 }
+
+// filesBytes returns the posted size of files.
+func filesBytes(files []nzbparser.NzbFile) int64 {
+	var total int64
+	for _, f := range files {
+		total += int64(f.Bytes)
+	}
+
+	return total
+}
+
+// filesSegments returns the number of segments of files.
+func filesSegments(files []nzbparser.NzbFile) int64 {
+	var total int64
+	for _, f := range files {
+		total += int64(len(f.Segments))
+	}
+
+	return total
+}
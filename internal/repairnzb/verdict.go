@@ -0,0 +1,341 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// Verdict tells whether an NZB needs and allows a repair.
+type Verdict string
+
+const (
+	// VerdictHealthy means every segment is available.
+	VerdictHealthy Verdict = "healthy"
+	// VerdictRepairable means enough par2 recovery blocks are available to
+	// rebuild the missing data.
+	VerdictRepairable Verdict = "repairable"
+	// VerdictUnrepairable means the missing data exceeds the available
+	// recovery blocks.
+	VerdictUnrepairable Verdict = "unrepairable"
+	// VerdictUnknown means data is missing but the par2 block size could not
+	// be read, as no par2 file is completely available.
+	VerdictUnknown Verdict = "unknown"
+)
+
+// maxPar2Candidates bounds how many par2 files are downloaded looking for the
+// block size. The index file, tried first, is only a few KB.
+const maxPar2Candidates = 3
+
+var (
+	par2PacketMagic  = []byte("PAR2\x00PKT")
+	par2MainType     = []byte("PAR 2.0\x00Main\x00\x00\x00\x00")
+	par2FileDescType = []byte("PAR 2.0\x00FileDesc")
+	par2IFSCType     = []byte("PAR 2.0\x00IFSC\x00\x00\x00\x00")
+)
+
+// CheckingPool downloads and checks articles, as the download pool does.
+type CheckingPool interface {
+	NNTPPool
+	ArticleChecker
+}
+
+// Repairability is the outcome of AssessRepairability.
+type Repairability struct {
+	Verdict      Verdict
+	Availability *Availability
+	// SliceSize is the par2 block size, 0 when it was not read.
+	SliceSize int64
+	// BlocksNeeded estimates the recovery blocks needed to rebuild the
+	// missing data segments.
+	BlocksNeeded int
+	// BlocksAvailable counts the recovery blocks of the available par2
+	// segments.
+	BlocksAvailable int
+}
+
+// AssessRepairability scans nzb like ScanAvailability and, when data is
+// missing, reads the par2 block size from the smallest complete par2 file to
+// compare the recovery blocks needed with those available. Nothing else is
+// downloaded, so the verdict is an estimate: missing segments are mapped to
+// blocks by their encoded size.
+func AssessRepairability(ctx context.Context, pool CheckingPool, nzb *nzbparser.Nzb, opts ScanOptions) (*Repairability, error) {
+	a, err := ScanAvailability(ctx, pool, nzb, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Repairability{Verdict: VerdictHealthy, Availability: a}
+
+	var par2Files []FileAvailability
+	dataMissing := false
+	for _, f := range a.Files {
+		if f.Par2 {
+			par2Files = append(par2Files, f)
+			r.BlocksAvailable += availableBlocks(f)
+		} else if len(f.Missing) > 0 {
+			dataMissing = true
+		}
+	}
+
+	if !dataMissing {
+		return r, nil
+	}
+
+	if r.BlocksAvailable == 0 {
+		r.Verdict = VerdictUnrepairable
+		return r, nil
+	}
+
+	r.SliceSize, err = readSliceSize(ctx, pool, par2Files)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		r.Verdict = VerdictUnknown
+		return r, nil
+	}
+
+	for _, f := range a.Files {
+		if !f.Par2 {
+			r.BlocksNeeded += neededBlocks(f, r.SliceSize)
+		}
+	}
+
+	r.Verdict = VerdictRepairable
+	if r.BlocksNeeded > r.BlocksAvailable {
+		r.Verdict = VerdictUnrepairable
+	}
+
+	return r, nil
+}
+
+// availableBlocks returns the recovery blocks of a par2 volume named like
+// name.vol03+04.par2, in proportion to its available segments.
+func availableBlocks(f FileAvailability) int {
+	m := parregexp.FindStringSubmatch(f.File.Filename)
+	if m == nil || m[2] == "" {
+		return 0
+	}
+
+	blocks, _ := strconv.Atoi(m[2])
+
+	return int(float64(blocks) * f.Ratio())
+}
+
+// neededBlocks returns the number of slices of f touched by its missing segments.
+func neededBlocks(f FileAvailability, sliceSize int64) int {
+	if len(f.Missing) == 0 || sliceSize <= 0 {
+		return 0
+	}
+
+	segments := append(nzbparser.NzbSegments{}, f.File.Segments...)
+	sort.Sort(segments)
+
+	missing := make(map[string]bool, len(f.Missing))
+	for _, s := range f.Missing {
+		missing[s.Id] = true
+	}
+
+	blocks := make(map[int64]struct{})
+	var offset int64
+	for _, s := range segments {
+		end := offset + int64(s.Bytes)
+		if missing[s.Id] && end > offset {
+			for b := offset / sliceSize; b <= (end-1)/sliceSize; b++ {
+				blocks[b] = struct{}{}
+			}
+		}
+		offset = end
+	}
+
+	return len(blocks)
+}
+
+// readSliceSize downloads the smallest complete par2 files until one holds a
+// main packet.
+func readSliceSize(ctx context.Context, pool NNTPPool, par2Files []FileAvailability) (int64, error) {
+	candidates := make([]nzbparser.NzbFile, 0, len(par2Files))
+	for _, f := range par2Files {
+		if len(f.Missing) == 0 {
+			candidates = append(candidates, f.File)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Bytes < candidates[j].Bytes })
+
+	lastErr := errors.New("no complete par2 file")
+	for _, f := range candidates[:min(len(candidates), maxPar2Candidates)] {
+		data, err := downloadPar2File(ctx, pool, f)
+		if err != nil {
+			return 0, err
+		}
+
+		size, err := par2SliceSize(data)
+		if err == nil {
+			return size, nil
+		}
+
+		lastErr = fmt.Errorf("%s: %w", f.Filename, err)
+	}
+
+	return 0, lastErr
+}
+
+// downloadPar2File downloads the segments of the par2 file f in order.
+func downloadPar2File(ctx context.Context, pool NNTPPool, f nzbparser.NzbFile) ([]byte, error) {
+	var buf bytes.Buffer
+	segments := append(nzbparser.NzbSegments{}, f.Segments...)
+	sort.Sort(segments)
+
+	for _, s := range segments {
+		if _, err := pool.BodyStream(ctx, s.Id, &buf); err != nil {
+			return nil, fmt.Errorf("failed to download par2 segment %s: %w", s.Id, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// par2Packets calls fn with the type and body of the packets of the par2
+// data, skipping corrupt ones, until fn returns false.
+func par2Packets(data []byte, fn func(packetType, body []byte) bool) {
+	const headerSize = 64
+
+	for {
+		i := bytes.Index(data, par2PacketMagic)
+		if i < 0 || len(data)-i < headerSize {
+			return
+		}
+		data = data[i:]
+
+		length := binary.LittleEndian.Uint64(data[8:16])
+		if length < headerSize || length > uint64(len(data)) {
+			// Corrupt length, look for the next packet.
+			data = data[len(par2PacketMagic):]
+			continue
+		}
+
+		if !fn(data[48:64], data[headerSize:length]) {
+			return
+		}
+		data = data[length:]
+	}
+}
+
+// par2SliceSize returns the slice size recorded in the main packet of a par2 file.
+func par2SliceSize(data []byte) (int64, error) {
+	var size uint64
+	found := false
+	par2Packets(data, func(packetType, body []byte) bool {
+		if !bytes.Equal(packetType, par2MainType) || len(body) < 8 {
+			return true
+		}
+
+		size, found = binary.LittleEndian.Uint64(body), true
+		return false
+	})
+
+	if !found {
+		return 0, errors.New("no par2 main packet found")
+	}
+	if size == 0 {
+		return 0, errors.New("invalid par2 slice size")
+	}
+
+	return int64(size), nil
+}
+
+// par2Checksums is what a par2 file records of the files of its recovery
+// set: their size and the CRC32 of each of their slices, the last one padded
+// with zeros, by file name.
+type par2Checksums struct {
+	sliceSize int64
+	files     map[string]par2FileChecksums
+}
+
+type par2FileChecksums struct {
+	size int64
+	crcs []uint32
+}
+
+// parsePar2Checksums reads the main, file description and slice checksum
+// packets of a par2 file.
+func parsePar2Checksums(data []byte) (*par2Checksums, error) {
+	sums := &par2Checksums{files: make(map[string]par2FileChecksums)}
+	names := make(map[string]string)
+	sizes := make(map[string]int64)
+	crcs := make(map[string][]uint32)
+
+	par2Packets(data, func(packetType, body []byte) bool {
+		switch {
+		case bytes.Equal(packetType, par2MainType) && len(body) >= 8:
+			sums.sliceSize = int64(binary.LittleEndian.Uint64(body))
+		case bytes.Equal(packetType, par2FileDescType) && len(body) >= 56:
+			// File ID, MD5 of the file and of its first 16 KB, size, then name.
+			id := string(body[:16])
+			sizes[id] = int64(binary.LittleEndian.Uint64(body[48:56]))
+			names[id] = string(bytes.TrimRight(body[56:], "\x00"))
+		case bytes.Equal(packetType, par2IFSCType) && len(body) >= 16:
+			// File ID, then the MD5 and CRC32 of every slice.
+			id := string(body[:16])
+			entries := body[16:]
+			for ; len(entries) >= 20; entries = entries[20:] {
+				crcs[id] = append(crcs[id], binary.LittleEndian.Uint32(entries[16:20]))
+			}
+		}
+
+		return true
+	})
+
+	if sums.sliceSize <= 0 {
+		return nil, errors.New("no par2 main packet found")
+	}
+
+	for id, name := range names {
+		if c, ok := crcs[id]; ok {
+			sums.files[name] = par2FileChecksums{size: sizes[id], crcs: c}
+		}
+	}
+
+	return sums, nil
+}
+
+// readPar2Checksums downloads the smallest par2 files of parFiles until one
+// holds the slice checksums of the files of the set.
+func readPar2Checksums(ctx context.Context, pool NNTPPool, parFiles []nzbparser.NzbFile) (*par2Checksums, error) {
+	candidates := append([]nzbparser.NzbFile{}, parFiles...)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Bytes < candidates[j].Bytes })
+
+	lastErr := errors.New("no par2 file")
+	for _, f := range candidates[:min(len(candidates), maxPar2Candidates)] {
+		data, err := downloadPar2File(ctx, pool, f)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			lastErr = fmt.Errorf("%s: %w", f.Filename, err)
+			continue
+		}
+
+		sums, err := parsePar2Checksums(data)
+		if err == nil && len(sums.files) > 0 {
+			return sums, nil
+		}
+		if err == nil {
+			err = errors.New("no par2 slice checksums found")
+		}
+
+		lastErr = fmt.Errorf("%s: %w", f.Filename, err)
+	}
+
+	return nil, lastErr
+}
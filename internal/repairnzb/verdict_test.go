@@ -0,0 +1,163 @@
+package repairnzb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	nntppool "github.com/javi11/nntppool/v4"
+	"github.com/javi11/nzb-repair/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type checkingPool struct {
+	*mocks.MockNNTPPool
+	*mocks.MockArticleChecker
+}
+
+// par2Packet builds a packet of the given type with body.
+func par2Packet(packetType []byte, body []byte) []byte {
+	var p bytes.Buffer
+	p.Write(par2PacketMagic)
+	_ = binary.Write(&p, binary.LittleEndian, uint64(64+len(body)))
+	p.Write(make([]byte, 32)) // md5 and recovery set id
+	p.Write(packetType)
+	p.Write(body)
+
+	return p.Bytes()
+}
+
+func mainPacket(sliceSize uint64) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, sliceSize)
+	body = binary.LittleEndian.AppendUint32(body, 1)
+
+	return par2Packet(par2MainType, body)
+}
+
+func TestPar2SliceSize(t *testing.T) {
+	creator := par2Packet([]byte("PAR 2.0\x00Creator\x00"), []byte("nzb-repair\x00\x00"))
+	data := append(append([]byte("garbage"), creator...), mainPacket(768000)...)
+
+	size, err := par2SliceSize(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(768000), size)
+
+	_, err = par2SliceSize(creator)
+	require.Error(t, err)
+}
+
+// fileChecksumPackets builds the file description and slice checksum packets
+// of the file name with data, cut in slices of sliceSize.
+func fileChecksumPackets(id byte, name string, data []byte, sliceSize int) []byte {
+	fileID := bytes.Repeat([]byte{id}, 16)
+
+	desc := append(append([]byte{}, fileID...), make([]byte, 32)...) // md5 of the file and its first 16 KB
+	desc = binary.LittleEndian.AppendUint64(desc, uint64(len(data)))
+	desc = append(desc, name...)
+	desc = append(desc, make([]byte, (4-len(name)%4)%4)...)
+
+	ifsc := append([]byte{}, fileID...)
+	for offset := 0; offset < len(data); offset += sliceSize {
+		slice := make([]byte, sliceSize)
+		copy(slice, data[offset:])
+		ifsc = append(ifsc, make([]byte, 16)...) // md5 of the slice
+		ifsc = binary.LittleEndian.AppendUint32(ifsc, crc32.ChecksumIEEE(slice))
+	}
+
+	return append(par2Packet(par2FileDescType, desc), par2Packet(par2IFSCType, ifsc)...)
+}
+
+func TestParsePar2Checksums(t *testing.T) {
+	data := append(mainPacket(4), fileChecksumPackets(1, "show.mkv", []byte("aaaabbbbcc"), 4)...)
+	data = append(data, fileChecksumPackets(2, "show.nfo", []byte("nfo"), 4)...)
+
+	sums, err := parsePar2Checksums(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), sums.sliceSize)
+	require.Len(t, sums.files, 2)
+	assert.Equal(t, int64(10), sums.files["show.mkv"].size)
+	assert.Equal(t, []uint32{
+		crc32.ChecksumIEEE([]byte("aaaa")),
+		crc32.ChecksumIEEE([]byte("bbbb")),
+		crc32.ChecksumIEEE([]byte("cc\x00\x00")),
+	}, sums.files["show.mkv"].crcs, "the last slice is padded with zeros")
+
+	_, err = parsePar2Checksums(fileChecksumPackets(1, "show.mkv", []byte("aaaa"), 4))
+	require.Error(t, err, "no main packet")
+}
+
+func TestNeededAndAvailableBlocks(t *testing.T) {
+	f := FileAvailability{
+		File: nzbparser.NzbFile{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+			{Number: 1, Id: "1", Bytes: 100}, {Number: 2, Id: "2", Bytes: 100}, {Number: 3, Id: "3", Bytes: 100}, {Number: 4, Id: "4", Bytes: 100},
+		}},
+		Missing: nzbparser.NzbSegments{{Number: 2, Id: "2", Bytes: 100}, {Number: 3, Id: "3", Bytes: 100}},
+	}
+	// Bytes 100-299 span the slices [0,150), [150,300).
+	assert.Equal(t, 2, neededBlocks(f, 150))
+	assert.Equal(t, 0, neededBlocks(FileAvailability{File: f.File}, 150))
+
+	vol := FileAvailability{
+		File:    nzbparser.NzbFile{Filename: "show.vol07+08.par2", Segments: nzbparser.NzbSegments{{Id: "a"}, {Id: "b"}}},
+		Missing: nzbparser.NzbSegments{{Id: "b"}},
+	}
+	assert.Equal(t, 4, availableBlocks(vol))
+	assert.Equal(t, 0, availableBlocks(FileAvailability{File: nzbparser.NzbFile{Filename: "show.par2"}}))
+}
+
+func TestAssessRepairability(t *testing.T) {
+	nzb := &nzbparser.Nzb{Files: nzbparser.NzbFiles{
+		{Filename: "show.mkv", Segments: nzbparser.NzbSegments{{Number: 1, Id: "d1", Bytes: 100}, {Number: 2, Id: "d2", Bytes: 100}}},
+		{Filename: "show.par2", Bytes: 50, Segments: nzbparser.NzbSegments{{Number: 1, Id: "idx"}}},
+		{Filename: "show.vol0+1.par2", Bytes: 500, Segments: nzbparser.NzbSegments{{Number: 1, Id: "v1"}}},
+	}}
+
+	tests := []struct {
+		name     string
+		missing  map[string]bool
+		slice    uint64
+		expected Verdict
+		needed   int
+	}{
+		{name: "healthy", expected: VerdictHealthy},
+		{name: "repairable", missing: map[string]bool{"d2": true}, slice: 200, expected: VerdictRepairable, needed: 1},
+		{name: "unrepairable", missing: map[string]bool{"d1": true, "d2": true}, slice: 50, expected: VerdictUnrepairable, needed: 4},
+		{name: "no recovery blocks", missing: map[string]bool{"d1": true, "v1": true}, expected: VerdictUnrepairable},
+		{name: "index missing", missing: map[string]bool{"d1": true, "idx": true}, slice: 0, expected: VerdictUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			pool := checkingPool{mocks.NewMockNNTPPool(ctrl), mocks.NewMockArticleChecker(ctrl)}
+
+			pool.MockArticleChecker.EXPECT().Stat(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id string) (*nntppool.StatResult, error) {
+				if tt.missing[id] {
+					return nil, nntppool.ErrArticleNotFound
+				}
+
+				return &nntppool.StatResult{MessageID: id}, nil
+			}).Times(4)
+
+			// The index is the smallest complete par2 file. The volume holds no
+			// main packet in this test.
+			pool.MockNNTPPool.EXPECT().BodyStream(gomock.Any(), "idx", gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, w io.Writer, _ ...func(nntppool.YEncMeta)) (*nntppool.ArticleBody, error) {
+					_, err := w.Write(mainPacket(tt.slice))
+					return &nntppool.ArticleBody{}, err
+				}).AnyTimes()
+			pool.MockNNTPPool.EXPECT().BodyStream(gomock.Any(), "v1", gomock.Any()).Return(&nntppool.ArticleBody{}, nil).AnyTimes()
+
+			r, err := AssessRepairability(context.Background(), pool, nzb, ScanOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, r.Verdict)
+			assert.Equal(t, tt.needed, r.BlocksNeeded)
+		})
+	}
+}
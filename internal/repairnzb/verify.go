@@ -0,0 +1,282 @@
+package repairnzb
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// Reasons a segment is listed in the damage map.
+const (
+	DamageMissing = "missing"
+	DamageCRC     = "crc_mismatch"
+)
+
+// SegmentDamage is a data segment that could not be used as downloaded.
+type SegmentDamage struct {
+	Number    int
+	MessageID string
+	Reason    string
+	// Offset and Size locate the segment in the decoded file. They are zero
+	// for missing segments, which were never written.
+	Offset int64
+	Size   int
+}
+
+// FileDamage lists the damaged segments of a file, ordered by number.
+type FileDamage struct {
+	Filename string
+	Segments []SegmentDamage
+}
+
+// segmentCheck is a segment written to disk during the download, with the
+// CRC32 its yEnc trailer announced for the decoded bytes.
+type segmentCheck struct {
+	segment     *nzbparser.NzbSegment
+	file        *nzbparser.NzbFile
+	name        string
+	offset      int64
+	size        int
+	expectedCRC uint32
+}
+
+// downloadChecks collects the segments written by the download workers.
+type downloadChecks struct {
+	mu     sync.Mutex
+	checks []segmentCheck
+	// copied holds the segments copied from the files of NZBGet, which came
+	// without a CRC.
+	copied []segmentCheck
+	// sizes holds the measured size of the downloaded articles by segment
+	// number.
+	sizes map[int]articleSize
+}
+
+// add records c. Segments without a CRC cannot be verified and, like any
+// segment of a nil downloadChecks, are not recorded.
+func (d *downloadChecks) add(c segmentCheck) {
+	if d == nil || c.expectedCRC == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.checks = append(d.checks, c)
+}
+
+// addCopied records c, a segment copied from a file of NZBGet. Nothing is
+// recorded by a nil downloadChecks.
+func (d *downloadChecks) addCopied(c segmentCheck) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.copied = append(d.copied, c)
+}
+
+// partSize returns the decoded size of the full parts of the file, taken from
+// any recorded segment but the last of its totalSegments, or 0 if there is
+// none.
+func (d *downloadChecks) partSize(totalSegments int) int64 {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, c := range d.checks {
+		if c.segment.Number < totalSegments && c.size > 0 {
+			return int64(c.size)
+		}
+	}
+
+	return 0
+}
+
+// verifySegments reads every checked segment back from store and compares
+// its CRC32 with the one of its yEnc trailer, spread over workers goroutines,
+// one per CPU when workers is not positive. The articles were already decoded
+// by rapidyenc on download; this pass catches segments that decoded to the
+// wrong bytes or were written at the wrong offset. It returns the segments
+// that failed, which par2 must repair.
+func verifySegments(ctx context.Context, store SegmentStore, checks []segmentCheck, workers int) ([]brokenSegment, error) {
+	progress := startProgress(ctx, PhaseVerify, ProgressSegments, int64(len(checks)))
+	defer progress.Finish()
+
+	return checkSegments(ctx, store, checks, workers, progress)
+}
+
+// checkSegments does the work of verifySegments, advancing progress by one
+// per segment read.
+func checkSegments(ctx context.Context, store SegmentStore, checks []segmentCheck, workers int, progress *progressTracker) ([]brokenSegment, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	files := make(map[string]SegmentFile)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	for _, c := range checks {
+		if _, ok := files[c.name]; ok {
+			continue
+		}
+
+		f, err := store.Open(c.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s for verification: %w", c.name, err)
+		}
+		files[c.name] = f
+	}
+
+	var mu sync.Mutex
+	var damaged []brokenSegment
+
+	p := pool.New().WithContext(ctx).
+		WithMaxGoroutines(workers).
+		WithCancelOnError()
+
+	for _, c := range checks {
+		p.Go(func(ctx context.Context) error {
+			buff := make([]byte, c.size)
+			if _, err := files[c.name].ReadAt(buff, c.offset); err != nil {
+				return fmt.Errorf("failed to read segment %s for verification: %w", c.segment.Id, err)
+			}
+			reportProgress(ctx)
+			progress.Add(1)
+
+			if crc32.ChecksumIEEE(buff) == c.expectedCRC {
+				return nil
+			}
+
+			mu.Lock()
+			damaged = append(damaged, brokenSegment{
+				segment: c.segment,
+				file:    c.file,
+				reason:  DamageCRC,
+				offset:  c.offset,
+				size:    c.size,
+			})
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+
+	return damaged, nil
+}
+
+// fileVerifier verifies the segments of every downloaded file in the
+// background, so a file is checked while the next ones are still downloading
+// and only the last file is left to verify once the download ends.
+type fileVerifier struct {
+	ctx   context.Context
+	store SegmentStore
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	queued  int
+	damaged []brokenSegment
+	err     error
+}
+
+func newFileVerifier(ctx context.Context, store SegmentStore) *fileVerifier {
+	return &fileVerifier{ctx: ctx, store: store}
+}
+
+// verify starts verifying the segments of a downloaded file.
+func (v *fileVerifier) verify(checks []segmentCheck) {
+	if len(checks) == 0 {
+		return
+	}
+
+	v.mu.Lock()
+	v.queued += len(checks)
+	v.mu.Unlock()
+
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+
+		damaged, err := checkSegments(v.ctx, v.store, checks, 0, nil)
+
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		v.damaged = append(v.damaged, damaged...)
+		if err != nil && v.err == nil {
+			v.err = err
+		}
+	}()
+}
+
+// queuedSegments returns the number of segments passed to verify.
+func (v *fileVerifier) queuedSegments() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.queued
+}
+
+// wait waits for every started verification and returns the segments that
+// failed, or the first error.
+func (v *fileVerifier) wait() ([]brokenSegment, error) {
+	v.wg.Wait()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	return v.damaged, nil
+}
+
+// damageMap lists the broken segments per file, ordered by file name and
+// segment number.
+func damageMap(brokenSegments map[*nzbparser.NzbFile][]brokenSegment) []FileDamage {
+	damage := make([]FileDamage, 0, len(brokenSegments))
+	for file, bs := range brokenSegments {
+		fd := FileDamage{Filename: file.Filename, Segments: make([]SegmentDamage, 0, len(bs))}
+		for _, s := range bs {
+			reason := s.reason
+			if reason == "" {
+				reason = DamageMissing
+			}
+
+			fd.Segments = append(fd.Segments, SegmentDamage{
+				Number:    s.segment.Number,
+				MessageID: s.segment.Id,
+				Reason:    reason,
+				Offset:    s.offset,
+				Size:      s.size,
+			})
+		}
+
+		sort.Slice(fd.Segments, func(i, j int) bool { return fd.Segments[i].Number < fd.Segments[j].Number })
+		damage = append(damage, fd)
+	}
+
+	sort.Slice(damage, func(i, j int) bool { return damage[i].Filename < damage[j].Filename })
+
+	return damage
+}
@@ -0,0 +1,83 @@
+package repairnzb
+
+import (
+	"context"
+	"hash/crc32"
+	"testing"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySegments(t *testing.T) {
+	store := newMemoryStore()
+	parts := [][]byte{[]byte("first"), []byte("secnd"), []byte("third")}
+	store.write("show.mkv", []byte("firstXXXXXthird"))
+
+	file := &nzbparser.NzbFile{Filename: "show.mkv", Segments: nzbparser.NzbSegments{
+		{Number: 1, Id: "1@test"}, {Number: 2, Id: "2@test"}, {Number: 3, Id: "3@test"},
+	}}
+
+	checks := &downloadChecks{}
+	for i, part := range parts {
+		checks.add(segmentCheck{
+			segment:     &file.Segments[i],
+			file:        file,
+			name:        "show.mkv",
+			offset:      int64(i * len(part)),
+			size:        len(part),
+			expectedCRC: crc32.ChecksumIEEE(part),
+		})
+	}
+	checks.add(segmentCheck{segment: &file.Segments[0], file: file, name: "show.mkv"})
+	require.Len(t, checks.checks, 3, "segments without a CRC are not recorded")
+
+	damaged, err := verifySegments(context.Background(), store, checks.checks, 2)
+	require.NoError(t, err)
+	require.Len(t, damaged, 1)
+	assert.Equal(t, "2@test", damaged[0].segment.Id)
+	assert.Equal(t, DamageCRC, damaged[0].reason)
+
+	missing := brokenSegment{segment: &nzbparser.NzbSegment{Number: 4, Id: "4@test"}, file: file}
+	other := &nzbparser.NzbFile{Filename: "show.r00"}
+	brokenSegments := map[*nzbparser.NzbFile][]brokenSegment{
+		file:  {missing, damaged[0]},
+		other: {{segment: &nzbparser.NzbSegment{Number: 1, Id: "r1@test"}, file: other}},
+	}
+
+	assert.Equal(t, []FileDamage{
+		{Filename: "show.mkv", Segments: []SegmentDamage{
+			{Number: 2, MessageID: "2@test", Reason: DamageCRC, Offset: 5, Size: 5},
+			{Number: 4, MessageID: "4@test", Reason: DamageMissing},
+		}},
+		{Filename: "show.r00", Segments: []SegmentDamage{
+			{Number: 1, MessageID: "r1@test", Reason: DamageMissing},
+		}},
+	}, damageMap(brokenSegments))
+}
+
+func TestFileVerifier(t *testing.T) {
+	store := newMemoryStore()
+	store.write("show.mkv", []byte("good"))
+	store.write("show.r00", []byte("XXXX"))
+
+	v := newFileVerifier(context.Background(), store)
+	for _, name := range []string{"show.mkv", "show.r00"} {
+		file := &nzbparser.NzbFile{Filename: name, Segments: nzbparser.NzbSegments{{Number: 1, Id: name + "@test"}}}
+		v.verify([]segmentCheck{{
+			segment:     &file.Segments[0],
+			file:        file,
+			name:        name,
+			size:        4,
+			expectedCRC: crc32.ChecksumIEEE([]byte("good")),
+		}})
+	}
+	v.verify(nil)
+	assert.Equal(t, 2, v.queuedSegments())
+
+	damaged, err := v.wait()
+	require.NoError(t, err)
+	require.Len(t, damaged, 1)
+	assert.Equal(t, "show.r00@test", damaged[0].segment.Id)
+}
@@ -0,0 +1,84 @@
+package repairnzb
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Tensai75/nzbparser"
+)
+
+// segmentWindowFactor sizes the segment window of a file download as a
+// multiple of the download workers, so the workers stay busy while a slow
+// segment holds the window back.
+const segmentWindowFactor = 2
+
+// segmentWindow keeps the downloads of a file within size segments of the
+// first segment not done yet, so the file is written roughly front to back
+// instead of in the order the pool happens to finish the segments.
+type segmentWindow struct {
+	size int
+
+	mu   sync.Mutex
+	done []bool
+	// next is the index of the first segment not done yet.
+	next int
+	// advanced is closed and replaced whenever next moves.
+	advanced chan struct{}
+}
+
+func newSegmentWindow(segments, size int) *segmentWindow {
+	return &segmentWindow{
+		size:     max(size, 1),
+		done:     make([]bool, segments),
+		advanced: make(chan struct{}),
+	}
+}
+
+// wait blocks until segment i is within the window.
+func (w *segmentWindow) wait(ctx context.Context, i int) error {
+	for {
+		w.mu.Lock()
+		if i < w.next+w.size {
+			w.mu.Unlock()
+			return nil
+		}
+		advanced := w.advanced
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-advanced:
+		}
+	}
+}
+
+// finish marks segment i done, whatever its outcome, and moves the window.
+func (w *segmentWindow) finish(i int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done[i] = true
+	next := w.next
+	for next < len(w.done) && w.done[next] {
+		next++
+	}
+	if next != w.next {
+		w.next = next
+		close(w.advanced)
+		w.advanced = make(chan struct{})
+	}
+}
+
+// segmentsInOrder returns the segments of file sorted by part number, the
+// order of their offsets in the file.
+func segmentsInOrder(file nzbparser.NzbFile) nzbparser.NzbSegments {
+	segments := slices.Clone(file.Segments)
+	slices.SortStableFunc(segments, func(a, b nzbparser.NzbSegment) int {
+		return cmp.Compare(a.Number, b.Number)
+	})
+
+	return segments
+}
@@ -0,0 +1,48 @@
+package repairnzb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentWindow(t *testing.T) {
+	w := newSegmentWindow(5, 2)
+	require.NoError(t, w.wait(context.Background(), 0))
+	require.NoError(t, w.wait(context.Background(), 1))
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- w.wait(context.Background(), 2)
+	}()
+
+	// Finishing a later segment does not move the window.
+	w.finish(1)
+	select {
+	case <-waited:
+		t.Fatal("segment 2 started before segment 0 finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	w.finish(0)
+	require.NoError(t, <-waited)
+	require.NoError(t, w.wait(context.Background(), 3), "segments 0 and 1 are done")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, w.wait(ctx, 4), context.Canceled)
+}
+
+func TestSegmentsInOrder(t *testing.T) {
+	file := nzbparser.NzbFile{Segments: nzbparser.NzbSegments{
+		{Number: 3, Id: "c"}, {Number: 1, Id: "a"}, {Number: 2, Id: "b"},
+	}}
+
+	ordered := segmentsInOrder(file)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{ordered[0].Id, ordered[1].Id, ordered[2].Id})
+	assert.Equal(t, "c", file.Segments[0].Id, "the nzb keeps its order")
+}
@@ -0,0 +1,223 @@
+// Package rules evaluates the admission and routing rules configured for the
+// watcher. Each rule is an expr (https://expr-lang.org) boolean expression over
+// the attributes of an NZB; the first matching rule decides what happens to the
+// job and how it is processed.
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Tensai75/nzbparser"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+// Action is what happens to a job matched by a rule.
+type Action string
+
+const (
+	// ActionAccept queues the job normally and stops rule evaluation.
+	ActionAccept Action = "accept"
+	// ActionHold keeps the job in the queue without processing it.
+	ActionHold Action = "hold"
+	// ActionSkip marks the job as skipped.
+	ActionSkip Action = "skip"
+)
+
+// Attributes are the NZB properties rules are evaluated against.
+type Attributes struct {
+	Name         string   `expr:"name"`
+	Path         string   `expr:"path"`
+	RelativePath string   `expr:"relative_path"`
+	Category     string   `expr:"category"`
+	Groups       []string `expr:"groups"`
+	Files        int      `expr:"files"`
+	SizeBytes    int64    `expr:"size_bytes"`
+	SizeGB       float64  `expr:"size_gb"`
+	// AgeDays is the age of the oldest post in the NZB.
+	AgeDays float64 `expr:"age_days"`
+	// OldestPost and NewestPost are the post dates of the NZB files; zero when
+	// the NZB carries no dates.
+	OldestPost time.Time `expr:"-"`
+	NewestPost time.Time `expr:"-"`
+}
+
+// Decision is the outcome of evaluating the rules for a job.
+type Decision struct {
+	Action Action
+	// Rule is the name of the matching rule, empty when no rule matched.
+	Rule   string
+	Reason string
+	// Route holds the processing overrides of the matching rule.
+	Route config.RouteConfig
+}
+
+type rule struct {
+	name    string
+	program *vm.Program
+	action  Action
+	reason  string
+	route   config.RouteConfig
+}
+
+// Engine holds the compiled rules.
+type Engine struct {
+	rules []rule
+}
+
+// Compile validates and compiles the configured rules.
+func Compile(cfgs []config.RuleConfig) (*Engine, error) {
+	e := &Engine{}
+
+	for i, c := range cfgs {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		action := Action(c.Action)
+		switch action {
+		case "":
+			action = ActionAccept
+		case ActionAccept, ActionHold, ActionSkip:
+		default:
+			return nil, fmt.Errorf("%s: unknown action %q", name, c.Action)
+		}
+
+		switch c.Route.ObfuscationPolicy {
+		case "", config.ObfuscationPolicyNone, config.ObfuscationPolicyFull:
+		default:
+			return nil, fmt.Errorf("%s: unknown obfuscation policy %q", name, c.Route.ObfuscationPolicy)
+		}
+
+		program, err := expr.Compile(c.When, expr.Env(Attributes{}), expr.AsBool())
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid expression: %w", name, err)
+		}
+
+		reason := c.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("matched rule %q", name)
+		}
+
+		e.rules = append(e.rules, rule{name: name, program: program, action: action, reason: reason, route: c.Route})
+	}
+
+	return e, nil
+}
+
+// Providers returns every download provider name referenced by a route.
+func (e *Engine) Providers() []string {
+	var names []string
+	for _, r := range e.rules {
+		names = append(names, r.route.Providers...)
+	}
+
+	return names
+}
+
+// UploadProviders returns every upload provider name referenced by a route.
+func (e *Engine) UploadProviders() []string {
+	var names []string
+	for _, r := range e.rules {
+		names = append(names, r.route.UploadProviders...)
+	}
+
+	return names
+}
+
+// Empty reports whether no rules are configured.
+func (e *Engine) Empty() bool {
+	return len(e.rules) == 0
+}
+
+// Evaluate returns the decision of the first rule matching a, or ActionAccept
+// when none matches.
+func (e *Engine) Evaluate(a Attributes) (Decision, error) {
+	for _, r := range e.rules {
+		out, err := expr.Run(r.program, a)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to evaluate %s: %w", r.name, err)
+		}
+
+		if matched, _ := out.(bool); matched {
+			return Decision{Action: r.action, Rule: r.name, Reason: r.reason, Route: r.route}, nil
+		}
+	}
+
+	return Decision{Action: ActionAccept}, nil
+}
+
+// Inspect reads the NZB at path and collects its attributes. relPath is the
+// path relative to the watch directory; its top-level folder is the category,
+// falling back to the category meta tag of the NZB.
+func Inspect(path, relPath string) (Attributes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Attributes{}, fmt.Errorf("failed to open nzb: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	nzb, err := nzbparser.Parse(f)
+	if err != nil {
+		return Attributes{}, fmt.Errorf("failed to parse nzb: %w", err)
+	}
+
+	return attributesOf(nzb, path, relPath), nil
+}
+
+func attributesOf(nzb *nzbparser.Nzb, path, relPath string) Attributes {
+	a := Attributes{
+		Name:         strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Path:         path,
+		RelativePath: relPath,
+		Files:        len(nzb.Files),
+		SizeBytes:    nzb.Bytes,
+		SizeGB:       float64(nzb.Bytes) / (1 << 30),
+	}
+
+	if dir, _, found := strings.Cut(filepath.ToSlash(relPath), "/"); found {
+		a.Category = dir
+	} else {
+		a.Category = nzb.Meta["category"]
+	}
+
+	for _, file := range nzb.Files {
+		if file.Date <= 0 {
+			continue
+		}
+
+		posted := time.Unix(int64(file.Date), 0)
+		if a.OldestPost.IsZero() || posted.Before(a.OldestPost) {
+			a.OldestPost = posted
+		}
+
+		if posted.After(a.NewestPost) {
+			a.NewestPost = posted
+		}
+	}
+
+	if !a.OldestPost.IsZero() {
+		a.AgeDays = time.Since(a.OldestPost).Hours() / 24
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range nzb.Files {
+		for _, g := range file.Groups {
+			if !seen[g] {
+				seen[g] = true
+				a.Groups = append(a.Groups, g)
+			}
+		}
+	}
+
+	return a
+}
@@ -0,0 +1,120 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/nzb-repair/internal/config"
+)
+
+const testNzb = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <head><meta type="category">TV</meta></head>
+ <file poster="test@example.com" date="1678886400" subject="[1/2] show.mkv yEnc (1/2)">
+  <groups><group>alt.binaries.test</group><group>alt.binaries.tv</group></groups>
+  <segments>
+   <segment bytes="700" number="1">a@test</segment>
+   <segment bytes="300" number="2">b@test</segment>
+  </segments>
+ </file>
+ <file poster="test@example.com" date="1678886400" subject="[2/2] show.mkv.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.test</group></groups>
+  <segments><segment bytes="24" number="1">c@test</segment></segments>
+ </file>
+</nzb>`
+
+func TestInspect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "show.nzb")
+	require.NoError(t, os.WriteFile(path, []byte(testNzb), 0644))
+
+	t.Run("category from top-level folder", func(t *testing.T) {
+		a, err := Inspect(path, filepath.Join("movies", "hd", "show.nzb"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "show", a.Name)
+		assert.Equal(t, "movies", a.Category)
+		assert.Equal(t, 2, a.Files)
+		assert.Equal(t, int64(1024), a.SizeBytes)
+		assert.ElementsMatch(t, []string{"alt.binaries.test", "alt.binaries.tv"}, a.Groups)
+	})
+
+	t.Run("category from meta tag", func(t *testing.T) {
+		a, err := Inspect(path, "show.nzb")
+		require.NoError(t, err)
+		assert.Equal(t, "TV", a.Category)
+	})
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	e, err := Compile([]config.RuleConfig{
+		{Name: "small-tv", When: `category == "tv" && size_gb < 1`, Action: "accept"},
+		{Name: "huge-movies", When: `size_gb > 100 && category == "movies"`, Action: "hold", Reason: "too big for now"},
+		{Name: "no-ebooks", When: `"alt.binaries.ebook" in groups`, Action: "skip"},
+	})
+	require.NoError(t, err)
+
+	d, err := e.Evaluate(Attributes{Category: "movies", SizeGB: 150})
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Action: ActionHold, Rule: "huge-movies", Reason: "too big for now"}, d)
+
+	d, err = e.Evaluate(Attributes{Groups: []string{"alt.binaries.ebook"}})
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Action: ActionSkip, Rule: "no-ebooks", Reason: `matched rule "no-ebooks"`}, d)
+
+	d, err = e.Evaluate(Attributes{Category: "tv", SizeGB: 0.5, Groups: []string{"alt.binaries.ebook"}})
+	require.NoError(t, err)
+	assert.Equal(t, ActionAccept, d.Action, "first matching rule wins")
+	assert.Equal(t, "small-tv", d.Rule)
+
+	d, err = e.Evaluate(Attributes{Category: "music"})
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Action: ActionAccept}, d)
+}
+
+func TestCompile_Errors(t *testing.T) {
+	_, err := Compile([]config.RuleConfig{{When: "size_gb > 1", Action: "explode"}})
+	assert.ErrorContains(t, err, "unknown action")
+
+	_, err = Compile([]config.RuleConfig{{When: "size_gb +", Action: "hold"}})
+	assert.ErrorContains(t, err, "invalid expression")
+
+	_, err = Compile([]config.RuleConfig{{When: "unknown_field > 1", Action: "hold"}})
+	assert.Error(t, err)
+
+	_, err = Compile([]config.RuleConfig{{When: "size_gb", Action: "hold"}})
+	assert.Error(t, err, "expressions must be boolean")
+}
+
+func TestEngine_Route(t *testing.T) {
+	e, err := Compile([]config.RuleConfig{
+		{
+			Name: "anime",
+			When: `"alt.binaries.anime" in groups`,
+			Route: config.RouteConfig{
+				OutputDir:         "/srv/anime",
+				Priority:          5,
+				Providers:         []string{"cheap"},
+				UploadProviders:   []string{"poster"},
+				ObfuscationPolicy: config.ObfuscationPolicyFull,
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cheap"}, e.Providers())
+	assert.Equal(t, []string{"poster"}, e.UploadProviders())
+
+	d, err := e.Evaluate(Attributes{Groups: []string{"alt.binaries.anime"}})
+	require.NoError(t, err)
+	assert.Equal(t, ActionAccept, d.Action, "action defaults to accept")
+	assert.Equal(t, "/srv/anime", d.Route.OutputDir)
+	assert.Equal(t, 5, d.Route.Priority)
+	assert.Equal(t, config.ObfuscationPolicyFull, d.Route.ObfuscationPolicy)
+
+	_, err = Compile([]config.RuleConfig{{When: "true", Route: config.RouteConfig{ObfuscationPolicy: "partial"}}})
+	assert.ErrorContains(t, err, "unknown obfuscation policy")
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import "syscall"
+
+// networkFilesystems maps the statfs magic numbers of network and FUSE file
+// systems, whose changes made by other hosts raise no inotify events, to
+// their name.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+	0x5346414f: "afs",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+}
+
+// networkFS returns the name of the file system of dir when it is a network
+// file system.
+func networkFS(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+
+	// The magic numbers are 32 bits wide; Type is signed and 32 bits on some
+	// architectures.
+	name, ok := networkFilesystems[uint32(st.Type)]
+	return name, ok
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+// networkFS reports no network file systems: detecting them is only
+// implemented on Linux, where inotify misses changes made by other hosts.
+func networkFS(string) (string, bool) {
+	return "", false
+}
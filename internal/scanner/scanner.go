@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/javi11/nzb-repair/internal/queue"
-	"github.com/opencontainers/selinux/pkg/pwalkdir"
 )
 
 // Scanner periodically scans directories for .nzb files.
@@ -21,22 +23,43 @@ type Scanner struct {
 	log          *slog.Logger
 	scanInterval time.Duration
 	isScanning   bool
+	// debounce enables file system events, see WithEvents.
+	debounce time.Duration
+	// events delays the NZBs reported by file system events while Run watches
+	// them.
+	events *debouncer
+	// maxDepth and followSymlinks limit the walks, see WithMaxDepth and
+	// WithFollowSymlinks.
+	maxDepth       int
+	followSymlinks bool
+	// rescan holds a pending request for an immediate scan, see Rescan.
+	rescan chan struct{}
+	// scanned is closed once the initial scan of Run finished, see Scanned.
+	scanned     chan struct{}
+	scannedOnce sync.Once
 }
 
 // NewScanner creates a new Scanner instance.
-func New(dir string, q queue.Queuer, logger *slog.Logger, scanInterval time.Duration) *Scanner {
+func New(dir string, q queue.Queuer, logger *slog.Logger, scanInterval time.Duration, opts ...Option) *Scanner {
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		logger.Warn("Failed to get absolute path for scan directory, relative paths might be inconsistent.", "directory", dir, "error", err)
 		absDir = dir
 	}
 
-	return &Scanner{
+	s := &Scanner{
 		dir:          absDir,
 		queue:        q,
 		log:          logger.With("component", "scanner", "directory", absDir),
 		scanInterval: scanInterval,
+		rescan:       make(chan struct{}, 1),
+		scanned:      make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Run starts the periodic scanning process.
@@ -47,16 +70,71 @@ func (s *Scanner) Run(ctx context.Context) error {
 	ticker := time.NewTicker(s.scanInterval)
 	defer ticker.Stop()
 
+	// Watch before the initial scan so no file slips between them
+	var (
+		events chan fsnotify.Event
+		errs   chan error
+		ready  chan string
+	)
+	watcher := s.openWatcher(ctx)
+	if watcher != nil {
+		defer func() {
+			_ = watcher.Close()
+		}()
+
+		s.events = newDebouncer(s.debounce, ctx.Done())
+		s.watch(ctx, watcher, nil, s.dir)
+		events, errs, ready = watcher.Events, watcher.Errors, s.events.ready
+	}
+
 	// Perform initial scan
 	if err := s.scanDirectory(ctx, s.dir); err != nil {
 		s.log.ErrorContext(ctx, "Initial scan failed", "error", err)
 	}
+	s.scannedOnce.Do(func() { close(s.scanned) })
 
 	for {
 		select {
 		case <-ctx.Done():
 			s.log.InfoContext(ctx, "Stopping scanner due to context cancellation")
 			return ctx.Err()
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.handleEvent(ctx, watcher, s.events, e)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				s.log.WarnContext(ctx, "File system watch error", "error", err)
+				continue
+			}
+
+			// Events were lost and may be again: poll from now on, starting
+			// with a scan for what was dropped.
+			s.log.WarnContext(ctx, "File system events were dropped, falling back to polling every scan interval; raise fs.inotify.max_queued_events to keep events", "interval", s.scanInterval, "error", err)
+			_ = watcher.Close()
+			events, errs = nil, nil
+			if err := s.scanDirectory(ctx, s.dir); err != nil {
+				s.log.ErrorContext(ctx, "Scan failed", "error", err)
+			}
+			ticker.Reset(s.scanInterval)
+		case path := <-ready:
+			if _, err := os.Stat(path); err != nil {
+				s.log.DebugContext(ctx, "NZB file gone before it was queued", "path", path, "error", err)
+				continue
+			}
+			s.addFileToQueue(ctx, path)
+		case <-s.rescan:
+			s.log.InfoContext(ctx, "Rescan requested")
+			if err := s.scanDirectory(ctx, s.dir); err != nil {
+				s.log.ErrorContext(ctx, "Scan failed", "error", err)
+			}
+			ticker.Reset(s.scanInterval)
 		case <-ticker.C:
 			if s.isScanning {
 				s.log.DebugContext(ctx, "Skipping scan as previous scan is still in progress")
@@ -70,6 +148,26 @@ func (s *Scanner) Run(ctx context.Context) error {
 	}
 }
 
+// Rescan asks Run for a full scan right away instead of at the next
+// interval. Requests made while a scan is pending are merged into it.
+func (s *Scanner) Rescan() {
+	select {
+	case s.rescan <- struct{}{}:
+	default:
+	}
+}
+
+// Scanned returns a channel that is closed once Run finished its initial
+// scan, so every NZB already in the directory at startup is queued.
+func (s *Scanner) Scanned() <-chan struct{} {
+	return s.scanned
+}
+
+// Dir returns the absolute path of the scanned directory.
+func (s *Scanner) Dir() string {
+	return s.dir
+}
+
 // scanDirectory recursively scans a directory for .nzb files and adds them to the queue.
 func (s *Scanner) scanDirectory(ctx context.Context, dirPath string) error {
 	s.isScanning = true
@@ -78,7 +176,7 @@ func (s *Scanner) scanDirectory(ctx context.Context, dirPath string) error {
 	s.log.InfoContext(ctx, "Starting directory scan", "directory", dirPath)
 	startTime := time.Now()
 
-	err := pwalkdir.Walk(dirPath, func(path string, info fs.DirEntry, walkErr error) error {
+	err := s.walk(dirPath, func(path string, info fs.DirEntry, walkErr error) error {
 		// Check for context cancellation
 		select {
 		case <-ctx.Done():
@@ -95,8 +193,13 @@ func (s *Scanner) scanDirectory(ctx context.Context, dirPath string) error {
 			return nil
 		}
 
-		// Process NZB files
-		if !info.IsDir() && strings.ToLower(filepath.Ext(info.Name())) == ".nzb" {
+		// Process NZB files, leaving those still being written to the events
+		if !info.IsDir() && isNzb(path) {
+			if s.events != nil && s.events.pending(path) {
+				s.log.DebugContext(ctx, "Skipping NZB file with pending events", "path", path)
+				return nil
+			}
+
 			s.log.DebugContext(ctx, "Found NZB file during scan", "path", path)
 			s.addFileToQueue(ctx, path)
 		}
@@ -114,6 +217,11 @@ func (s *Scanner) scanDirectory(ctx context.Context, dirPath string) error {
 	return nil
 }
 
+// isNzb reports whether name has the .nzb extension.
+func isNzb(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".nzb"
+}
+
 // addFileToQueue handles the logic of validating and adding a file path to the queue.
 func (s *Scanner) addFileToQueue(ctx context.Context, filePath string) {
 	s.log.InfoContext(ctx, "Adding detected NZB file to queue", "path", filePath)
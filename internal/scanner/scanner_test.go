@@ -3,6 +3,7 @@ package scanner
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -155,6 +156,37 @@ func TestScanner_Run(t *testing.T) {
 	}
 }
 
+func TestScanner_Scanned(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "existing.nzb"), nil, 0644))
+
+	mockQ := &mockQueue{}
+	scanner := New(tempDir, mockQ, slog.New(slog.NewTextHandler(io.Discard, nil)), time.Hour)
+
+	select {
+	case <-scanner.Scanned():
+		t.Fatal("scanned before Run")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = scanner.Run(ctx)
+	}()
+
+	select {
+	case <-scanner.Scanned():
+	case <-time.After(5 * time.Second):
+		t.Fatal("initial scan did not finish")
+	}
+
+	mockQ.mu.Lock()
+	defer mockQ.mu.Unlock()
+	require.Len(t, mockQ.jobs, 1, "the existing NZB is queued by the time the scan is done")
+	assert.Equal(t, "existing.nzb", mockQ.jobs[0].relPath)
+}
+
 func TestScanner_NestedFolders(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir, err := os.MkdirTemp("", "scanner-test-*")
@@ -205,3 +237,162 @@ func TestScanner_NestedFolders(t *testing.T) {
 		assert.True(t, foundFiles[expectedFile], "Expected to find %s", expectedFile)
 	}
 }
+
+func TestScanner_RunEvents(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockQ := &mockQueue{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	scanner := New(tempDir, mockQ, logger, time.Hour, WithEvents(100*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+
+	// Write a temporary file and rename it into place like a download manager
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tmp := filepath.Join(tempDir, "test.nzb.tmp")
+		f, err := os.Create(tmp)
+		if err != nil {
+			return
+		}
+		for range 3 {
+			_, _ = f.WriteString("<nzb>")
+			time.Sleep(20 * time.Millisecond)
+		}
+		_ = f.Close()
+		_ = os.Rename(tmp, filepath.Join(tempDir, "test.nzb"))
+	}()
+
+	err := scanner.Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	mockQ.mu.Lock()
+	defer mockQ.mu.Unlock()
+
+	// The burst is coalesced into one add of the final name, long before the
+	// next scan
+	require.Len(t, mockQ.jobs, 1)
+	assert.Equal(t, "test.nzb", filepath.Base(mockQ.jobs[0].absPath))
+}
+
+func TestDebouncer(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	d := newDebouncer(50*time.Millisecond, done)
+	d.touch("a.nzb")
+	d.touch("b.nzb")
+	time.Sleep(30 * time.Millisecond)
+	d.touch("a.nzb")
+	d.cancel("b.nzb")
+
+	assert.True(t, d.pending("a.nzb"))
+	assert.False(t, d.pending("b.nzb"))
+
+	select {
+	case path := <-d.ready:
+		assert.Equal(t, "a.nzb", path)
+	case <-time.After(time.Second):
+		t.Fatal("debounced path not reported")
+	}
+	assert.False(t, d.pending("a.nzb"))
+}
+
+func TestScanner_MaxDepth(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"root.nzb", "a/one.nzb", "a/b/two.nzb"} {
+		path := filepath.Join(tempDir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	for depth, want := range map[int][]string{
+		0: {"root.nzb", "a/one.nzb", "a/b/two.nzb"},
+		1: {"root.nzb"},
+		2: {"root.nzb", "a/one.nzb"},
+	} {
+		mockQ := &mockQueue{}
+		scanner := New(tempDir, mockQ, logger, time.Second, WithMaxDepth(depth))
+		require.NoError(t, scanner.scanDirectory(context.Background(), tempDir))
+
+		var got []string
+		for _, job := range mockQ.jobs {
+			got = append(got, filepath.ToSlash(job.relPath))
+		}
+		assert.ElementsMatch(t, want, got, "depth %d", depth)
+	}
+}
+
+func TestScanner_FollowSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	other := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(other, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "sub", "other.nzb"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "root.nzb"), nil, 0644))
+
+	// A link into another volume, a loop back to it and a link to the watch
+	// directory itself
+	require.NoError(t, os.Symlink(other, filepath.Join(tempDir, "volume")))
+	require.NoError(t, os.Symlink(other, filepath.Join(other, "sub", "loop")))
+	require.NoError(t, os.Symlink(tempDir, filepath.Join(tempDir, "self")))
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	for follow, want := range map[bool][]string{
+		false: {"root.nzb"},
+		true:  {"root.nzb", "volume/sub/other.nzb"},
+	} {
+		var opts []Option
+		if follow {
+			opts = append(opts, WithFollowSymlinks())
+		}
+
+		mockQ := &mockQueue{}
+		scanner := New(tempDir, mockQ, logger, time.Second, opts...)
+		require.NoError(t, scanner.scanDirectory(context.Background(), tempDir))
+
+		var got []string
+		for _, job := range mockQ.jobs {
+			got = append(got, filepath.ToSlash(job.relPath))
+		}
+		assert.ElementsMatch(t, want, got, "follow %v", follow)
+	}
+}
+
+func TestScanner_Rescan(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockQ := &mockQueue{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	scanner := New(tempDir, mockQ, logger, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// Restored from a backup after the initial scan, without events
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(tempDir, "restored.nzb"), nil, 0644)
+		scanner.Rescan()
+		scanner.Rescan()
+	}()
+
+	err := scanner.Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	mockQ.mu.Lock()
+	defer mockQ.mu.Unlock()
+
+	require.NotEmpty(t, mockQ.jobs)
+	assert.Equal(t, "restored.nzb", filepath.Base(mockQ.jobs[0].absPath))
+}
+
+func TestNetworkFS(t *testing.T) {
+	// Temporary directories are local, so events are relied on
+	_, ok := networkFS(t.TempDir())
+	assert.False(t, ok)
+
+	_, ok = networkFS("/non/existent/path")
+	assert.False(t, ok)
+}
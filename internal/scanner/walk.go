@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithMaxDepth limits how deep the scanner and the watcher descend, like
+// find -maxdepth: 1 only looks at the NZBs in the directory itself, 2 also at
+// those of its subdirectories and so on. 0 does not limit the depth.
+func WithMaxDepth(depth int) Option {
+	return func(s *Scanner) {
+		s.maxDepth = depth
+	}
+}
+
+// WithFollowSymlinks makes the scanner and the watcher descend into
+// symlinked directories, e.g. into other volumes. Every directory is walked
+// once however many links lead to it, so links back to an ancestor do not
+// loop, and links to directories inside the watched directory are skipped.
+func WithFollowSymlinks() Option {
+	return func(s *Scanner) {
+		s.followSymlinks = true
+	}
+}
+
+// depth returns the depth of path below the scanned directory, 0 for the
+// directory itself.
+func (s *Scanner) depth(path string) int {
+	rel, err := filepath.Rel(s.dir, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// tooDeep reports whether the entries of a directory at depth are beyond the
+// maximum depth.
+func (s *Scanner) tooDeep(depth int) bool {
+	return s.maxDepth > 0 && depth >= s.maxDepth
+}
+
+// walk calls fn for dir and every entry below it like filepath.WalkDir,
+// honouring the maximum depth and following symlinked directories when
+// enabled. Entries found through a link are reported below the link, so
+// their path stays inside the scanned directory.
+func (s *Scanner) walk(dir string, fn fs.WalkDirFunc) error {
+	var root string
+	if s.followSymlinks {
+		if real, err := filepath.EvalSymlinks(s.dir); err == nil {
+			root = real
+		}
+	}
+
+	return s.walkDir(dir, dir, root, make(map[string]bool), fn)
+}
+
+// walkDir walks the real directory dir, reporting its entries below logical.
+func (s *Scanner) walkDir(dir, logical, root string, visited map[string]bool, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		path = logical + strings.TrimPrefix(path, dir)
+		if err != nil {
+			return fn(path, entry, err)
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 && s.followSymlinks {
+			return s.walkLink(path, root, visited, fn)
+		}
+
+		if err := fn(path, entry, nil); err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != logical && s.tooDeep(s.depth(path)) {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+}
+
+// walkLink walks the directory the symlink at path points to, once.
+func (s *Scanner) walkLink(path, root string, visited map[string]bool, fn fs.WalkDirFunc) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, nil, err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return fn(path, nil, err)
+	}
+
+	if !info.IsDir() {
+		return fn(path, fs.FileInfoToDirEntry(info), nil)
+	}
+
+	if visited[target] || (root != "" && isWithin(root, target)) {
+		return nil
+	}
+	visited[target] = true
+
+	if s.tooDeep(s.depth(path)) {
+		err := fn(path, fs.FileInfoToDirEntry(info), nil)
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	return s.walkDir(target, path, root, visited, fn)
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
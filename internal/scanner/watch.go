@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Option configures a Scanner.
+type Option func(*Scanner)
+
+// WithEvents makes Run also watch the directory for file system events and
+// queue an NZB once no event for it arrived for debounce, instead of waiting
+// for the next scan. Download managers writing name.nzb.tmp and renaming it
+// produce a burst of events per file; they are coalesced into one add of the
+// final name. Scans skip NZBs whose events are still settling.
+func WithEvents(debounce time.Duration) Option {
+	return func(s *Scanner) {
+		s.debounce = debounce
+	}
+}
+
+// debouncer delays paths until no event touched them for delay, then sends
+// them to ready.
+type debouncer struct {
+	delay  time.Duration
+	ready  chan string
+	done   <-chan struct{}
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newDebouncer(delay time.Duration, done <-chan struct{}) *debouncer {
+	return &debouncer{
+		delay:  delay,
+		ready:  make(chan string),
+		done:   done,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// touch (re)starts the delay of path.
+func (d *debouncer) touch(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.timers[path]; ok {
+		t.Reset(d.delay)
+		return
+	}
+
+	d.timers[path] = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		delete(d.timers, path)
+		d.mu.Unlock()
+
+		select {
+		case d.ready <- path:
+		case <-d.done:
+		}
+	})
+}
+
+// cancel drops path, e.g. when it was removed or renamed away.
+func (d *debouncer) cancel(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.timers[path]; ok {
+		t.Stop()
+		delete(d.timers, path)
+	}
+}
+
+// pending reports whether the delay of path is running.
+func (d *debouncer) pending(path string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.timers[path]
+	return ok
+}
+
+// openWatcher returns the watcher for the file system events of the
+// directory, or nil when events are disabled or cannot be relied on, leaving
+// Run to poll with scans.
+func (s *Scanner) openWatcher(ctx context.Context) *fsnotify.Watcher {
+	if s.debounce <= 0 {
+		return nil
+	}
+
+	if fsType, ok := networkFS(s.dir); ok {
+		s.log.WarnContext(ctx, "Watch directory is on a network file system where changes made by other hosts raise no events, falling back to polling every scan interval", "fs", fsType, "interval", s.scanInterval)
+		return nil
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		s.log.WarnContext(ctx, "File system events unavailable, falling back to polling every scan interval", "interval", s.scanInterval, "error", err)
+		return nil
+	}
+
+	return w
+}
+
+// watch adds dir and its subdirectories to w. With a non-nil d, the NZBs they
+// hold are delayed like new files.
+func (s *Scanner) watch(ctx context.Context, w *fsnotify.Watcher, d *debouncer, dir string) {
+	err := s.walk(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			s.log.WarnContext(ctx, "Error accessing path while adding watches", "path", path, "error", err)
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.IsDir() {
+			if d != nil && isNzb(path) {
+				d.touch(path)
+			}
+			return nil
+		}
+
+		// Directories whose files are too deep are left alone
+		if s.tooDeep(s.depth(path)) {
+			return nil
+		}
+
+		if err := w.Add(path); err != nil {
+			s.log.WarnContext(ctx, "Failed to watch directory, relying on scans", "path", path, "error", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.log.WarnContext(ctx, "Failed to add watches", "directory", dir, "error", err)
+	}
+}
+
+// handleEvent reacts to a file system event. Renames into the directory are
+// reported as a Create of the new name, renames out of it as a Rename of the
+// old one.
+func (s *Scanner) handleEvent(ctx context.Context, w *fsnotify.Watcher, d *debouncer, e fsnotify.Event) {
+	switch {
+	case e.Has(fsnotify.Create):
+		info, err := os.Lstat(e.Name)
+		if err != nil {
+			return
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 && s.followSymlinks {
+			if info, err = os.Stat(e.Name); err != nil {
+				return
+			}
+		}
+
+		if s.tooDeep(s.depth(filepath.Dir(e.Name))) {
+			return
+		}
+
+		if info.IsDir() {
+			// A directory created or moved in: watch it and queue the NZBs
+			// it already holds.
+			s.watch(ctx, w, d, e.Name)
+			return
+		}
+
+		if isNzb(e.Name) {
+			d.touch(e.Name)
+		}
+	case e.Has(fsnotify.Write):
+		if isNzb(e.Name) && !s.tooDeep(s.depth(filepath.Dir(e.Name))) {
+			d.touch(e.Name)
+		}
+	case e.Has(fsnotify.Remove), e.Has(fsnotify.Rename):
+		d.cancel(e.Name)
+	}
+}
@@ -0,0 +1,357 @@
+// Package client is a Go client for the HTTP API of the nzb-repair watcher.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIPrefix is the path prefix of every API endpoint.
+const APIPrefix = "/api/v1"
+
+// Client calls the API of a running watcher.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient uses c instead of a default http.Client. Its transport is
+// replaced for unix socket addresses.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		if c != nil {
+			cl.httpClient = c
+		}
+	}
+}
+
+// New returns a client for the API listening on addr, either an HTTP base URL
+// such as http://127.0.0.1:8090 or a unix socket such as
+// unix:/run/nzb-repair.sock.
+func New(addr string, opts ...Option) (*Client, error) {
+	c := &Client{httpClient: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if socket, ok := strings.CutPrefix(addr, "unix:"); ok {
+		socket = strings.TrimPrefix(socket, "//")
+		if socket == "" {
+			return nil, errors.New("empty unix socket path")
+		}
+
+		httpClient := *c.httpClient
+		httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		c.httpClient = &httpClient
+		c.baseURL = "http://unix"
+
+		return c, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API address %q: %w", addr, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid API address %q: scheme must be http, https or unix", addr)
+	}
+
+	c.baseURL = strings.TrimSuffix(u.String(), "/")
+
+	return c, nil
+}
+
+// APIError is returned when the API answers with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// AddJob adds an NZB file to the queue. The file is read by the daemon, so
+// its path must be valid on the daemon's host.
+func (c *Client) AddJob(ctx context.Context, req AddJobRequest) (AddJobResult, error) {
+	var res AddJobResult
+	err := c.do(ctx, http.MethodPost, "/jobs", nil, req, &res)
+
+	return res, err
+}
+
+// ListJobs returns the jobs of the queue, most recently updated first.
+func (c *Client) ListJobs(ctx context.Context, opts ListJobsOptions) ([]Job, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var jobs []Job
+	err := c.do(ctx, http.MethodGet, "/jobs", query, nil, &jobs)
+
+	return jobs, err
+}
+
+// GetJob returns the job with id.
+func (c *Client) GetJob(ctx context.Context, id int64) (Job, error) {
+	var job Job
+	err := c.do(ctx, http.MethodGet, "/jobs/"+strconv.FormatInt(id, 10), nil, nil, &job)
+
+	return job, err
+}
+
+// RetryJob puts a failed job back to pending with its retries reset.
+func (c *Client) RetryJob(ctx context.Context, id int64) error {
+	resp, err := c.send(ctx, http.MethodPost, "/jobs/"+strconv.FormatInt(id, 10)+"/retry", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// RetryFailedJobs puts every failed job back to pending with its retries
+// reset and returns how many there were.
+func (c *Client) RetryFailedJobs(ctx context.Context) (int64, error) {
+	var res RetryResult
+	err := c.do(ctx, http.MethodPost, "/jobs/retry", nil, nil, &res)
+
+	return res.Retried, err
+}
+
+// DeleteJob removes a job that is not being processed from the queue. Its
+// NZB is left where it is.
+func (c *Client) DeleteJob(ctx context.Context, id int64) error {
+	resp, err := c.send(ctx, http.MethodDelete, "/jobs/"+strconv.FormatInt(id, 10), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// ApproveJob repairs a job left awaiting approval by a watcher in triage mode.
+func (c *Client) ApproveJob(ctx context.Context, id int64) error {
+	resp, err := c.send(ctx, http.MethodPost, "/jobs/"+strconv.FormatInt(id, 10)+"/approve", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// SetJobNote attaches a free-text note to a job, replacing its previous note.
+// An empty note removes it.
+func (c *Client) SetJobNote(ctx context.Context, id int64, note string) error {
+	resp, err := c.send(ctx, http.MethodPut, "/jobs/"+strconv.FormatInt(id, 10)+"/note", nil, JobNoteRequest{Note: note})
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// OverrideJobStatus marks a job that is not being processed as completed or
+// failed, for jobs handled outside the daemon. reason replaces its error
+// message. Failed jobs are not retried.
+func (c *Client) OverrideJobStatus(ctx context.Context, id int64, status, reason string) error {
+	resp, err := c.send(ctx, http.MethodPost, "/jobs/"+strconv.FormatInt(id, 10)+"/status", nil, JobStatusRequest{Status: status, Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Stats returns the bandwidth usage of month (YYYY-MM, empty for the current
+// month) and the number of jobs per status.
+func (c *Client) Stats(ctx context.Context, month string) (Stats, error) {
+	query := url.Values{}
+	if month != "" {
+		query.Set("month", month)
+	}
+
+	var stats Stats
+	err := c.do(ctx, http.MethodGet, "/stats", query, nil, &stats)
+
+	return stats, err
+}
+
+// LogLevel returns the current log level of the daemon.
+func (c *Client) LogLevel(ctx context.Context) (string, error) {
+	var res LogLevel
+	err := c.do(ctx, http.MethodGet, "/log-level", nil, nil, &res)
+
+	return res.Level, err
+}
+
+// SetLogLevel changes the log level of the daemon to debug, info, warn or
+// error until it restarts, and returns the new level.
+func (c *Client) SetLogLevel(ctx context.Context, level string) (string, error) {
+	var res LogLevel
+	err := c.do(ctx, http.MethodPut, "/log-level", nil, LogLevel{Level: level}, &res)
+
+	return res.Level, err
+}
+
+// WorkerState returns whether the workers of the daemon are paused.
+func (c *Client) WorkerState(ctx context.Context) (WorkerState, error) {
+	var res WorkerState
+	err := c.do(ctx, http.MethodGet, "/worker", nil, nil, &res)
+
+	return res, err
+}
+
+// PauseWorker stops the workers of the daemon from picking new jobs until
+// ResumeWorker or a restart. Jobs being processed are finished.
+func (c *Client) PauseWorker(ctx context.Context) (WorkerState, error) {
+	var res WorkerState
+	err := c.do(ctx, http.MethodPost, "/worker/pause", nil, nil, &res)
+
+	return res, err
+}
+
+// ResumeWorker lets paused workers pick jobs again.
+func (c *Client) ResumeWorker(ctx context.Context) (WorkerState, error) {
+	var res WorkerState
+	err := c.do(ctx, http.MethodPost, "/worker/resume", nil, nil, &res)
+
+	return res, err
+}
+
+// Rescan starts a full scan of every watch directory of the daemon, e.g.
+// after restoring NZBs from a backup, and returns the directories. The scans
+// run in the background.
+func (c *Client) Rescan(ctx context.Context) ([]string, error) {
+	var res RescanResult
+	err := c.do(ctx, http.MethodPost, "/rescan", nil, nil, &res)
+
+	return res.Directories, err
+}
+
+// JobEvents streams events to fn until ctx is canceled, the daemon closes the
+// stream or fn returns an error. A jobID of 0 streams the events of every job.
+func (c *Client) JobEvents(ctx context.Context, jobID int64, fn func(Event) error) error {
+	query := url.Values{}
+	if jobID != 0 {
+		query.Set("job_id", strconv.FormatInt(jobID, 10))
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return ctx.Err()
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// send performs the request and returns the response of a successful call.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	u := c.baseURL + APIPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call API: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && e.Error != "" {
+			apiErr.Message = e.Error
+		}
+
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
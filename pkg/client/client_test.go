@@ -0,0 +1,24 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New("http://127.0.0.1:8090/")
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8090", c.baseURL)
+
+	c, err = New("unix:///run/nzb-repair.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "http://unix", c.baseURL)
+
+	_, err = New("127.0.0.1:8090")
+	assert.Error(t, err)
+
+	_, err = New("unix:")
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package client
+
+import "time"
+
+// Job is a job of the watcher queue.
+type Job struct {
+	ID           int64     `json:"id"`
+	FilePath     string    `json:"file_path"`
+	RelativePath string    `json:"relative_path"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	RetryCount   int64     `json:"retry_count"`
+	Priority     int       `json:"priority"`
+	Category     string    `json:"category,omitempty"`
+	OutputPath   string    `json:"output_path,omitempty"`
+	Verdict      string    `json:"verdict,omitempty"`
+	Note         string    `json:"note,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Progress is the progress of the current repair phase of a processing
+	// job.
+	Progress *JobProgress `json:"progress,omitempty"`
+	// ETA is the estimated time until a processing or pending job finishes,
+	// from the throughput of recently finished jobs. 0 when unknown.
+	ETA time.Duration `json:"eta,omitempty"`
+}
+
+// JobProgress is the progress of a repair phase. Unit is bytes, segments or
+// percent, and Total is zero when it is not known.
+type JobProgress struct {
+	Phase string `json:"phase"`
+	Unit  string `json:"unit"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+	// Rate is Done per second since the phase started.
+	Rate float64 `json:"rate"`
+}
+
+// AddJobRequest adds an NZB file, readable by the daemon, to the queue.
+type AddJobRequest struct {
+	// Path is the path of the NZB file on the daemon's host.
+	Path string `json:"path"`
+	// Priority is a named priority (low, normal, high) or a number. Empty
+	// means normal.
+	Priority string `json:"priority,omitempty"`
+	// Category groups the job like a top-level subdirectory of the watch
+	// directory.
+	Category string `json:"category,omitempty"`
+}
+
+// JobNoteRequest attaches a note to a job. An empty note removes it.
+type JobNoteRequest struct {
+	Note string `json:"note"`
+}
+
+// JobStatusRequest forces the status of a job handled outside the daemon.
+type JobStatusRequest struct {
+	// Status is completed or failed.
+	Status string `json:"status"`
+	// Reason replaces the error message of the job.
+	Reason string `json:"reason,omitempty"`
+}
+
+// AddJobResult is the outcome of AddJob.
+type AddJobResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// ListJobsOptions filters ListJobs.
+type ListJobsOptions struct {
+	// Status only returns jobs in this status.
+	Status string
+	// Limit caps the number of returned jobs, most recently updated first.
+	Limit int
+}
+
+// Event is a job lifecycle or repair phase event.
+type Event struct {
+	Type       string         `json:"type"`
+	Time       time.Time      `json:"time"`
+	JobID      int64          `json:"job_id,omitempty"`
+	FilePath   string         `json:"file_path,omitempty"`
+	OutputPath string         `json:"output_path,omitempty"`
+	Phase      string         `json:"phase,omitempty"`
+	Duration   time.Duration  `json:"duration,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Fields     map[string]any `json:"fields,omitempty"`
+}
+
+// ProviderStats is the bandwidth used through a provider in a month.
+type ProviderStats struct {
+	Provider        string `json:"provider"`
+	DownloadedBytes int64  `json:"downloaded_bytes"`
+	UploadedBytes   int64  `json:"uploaded_bytes"`
+	MonthlyCapBytes int64  `json:"monthly_cap_bytes,omitempty"`
+	// CompressedRawBytes and CompressedWireBytes are the uncompressed and
+	// transferred bytes of compressed connections.
+	CompressedRawBytes  int64 `json:"compressed_raw_bytes,omitempty"`
+	CompressedWireBytes int64 `json:"compressed_wire_bytes,omitempty"`
+}
+
+// Node is an instance working on a shared queue.
+type Node struct {
+	Name          string    `json:"name"`
+	SharedStorage bool      `json:"shared_storage"`
+	StartedAt     time.Time `json:"started_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+}
+
+// DailyFailures is the number of jobs that last failed on Day (YYYY-MM-DD, UTC).
+type DailyFailures struct {
+	Day      string `json:"day"`
+	Failures int64  `json:"failures"`
+}
+
+// Stats are the bandwidth usage of a month, the current job counts, the
+// estimated time until the queue is done and the nodes working on the queue.
+type Stats struct {
+	Month     string           `json:"month"`
+	Providers []ProviderStats  `json:"providers"`
+	Jobs      map[string]int64 `json:"jobs"`
+	// OldestPendingAge is how long the oldest pending job has been queued, 0
+	// when no job is pending.
+	OldestPendingAge time.Duration `json:"oldest_pending_age,omitempty"`
+	// FailuresPerDay counts the jobs that failed over the last days, oldest
+	// day first. Days without failures are missing.
+	FailuresPerDay []DailyFailures `json:"failures_per_day,omitempty"`
+	// QueueETA is the estimated time until every processing and pending job
+	// finishes, 0 when unknown or the queue is empty.
+	QueueETA time.Duration `json:"queue_eta,omitempty"`
+	// Throughput is the NZB bytes a worker processes per second, measured
+	// over recently finished jobs.
+	Throughput float64 `json:"throughput,omitempty"`
+	Nodes      []Node  `json:"nodes,omitempty"`
+}
+
+// RetryResult is the number of failed jobs put back to pending.
+type RetryResult struct {
+	Retried int64 `json:"retried"`
+}
+
+// WorkerState tells whether the workers of the daemon are paused. Paused
+// workers finish their current job but pick no new ones.
+type WorkerState struct {
+	Paused bool `json:"paused"`
+}
+
+// LogLevel is the log level of the daemon: debug, info, warn or error.
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// RescanResult lists the watch directories a rescan was started for.
+type RescanResult struct {
+	Directories []string `json:"directories"`
+}
+
+// errorResponse is the body of a failed API request.
+type errorResponse struct {
+	Error string `json:"error"`
+}